@@ -136,6 +136,11 @@ type InfluxdOpts struct {
 	SecretStore string
 	VaultConfig vault.Config
 
+	RemoteTokenKey     string
+	RemoteTokenKeyPath string
+
+	ReplicationMaxQueueSizeLimit int64
+
 	HttpBindAddress       string
 	HttpReadHeaderTimeout time.Duration
 	HttpReadTimeout       time.Duration
@@ -290,6 +295,21 @@ func (o *InfluxdOpts) BindCliOpts() []cli.Opt {
 			Default: o.SecretStore,
 			Desc:    "data store for secrets (bolt or vault)",
 		},
+		{
+			DestP: &o.RemoteTokenKey,
+			Flag:  "remote-token-encryption-key",
+			Desc:  "base64-encoded 32-byte key to encrypt the API tokens of replication remotes with in the sqlite database. existing plaintext tokens are encrypted on startup",
+		},
+		{
+			DestP: &o.RemoteTokenKeyPath,
+			Flag:  "remote-token-encryption-key-path",
+			Desc:  "path to a file containing the base64-encoded remote token encryption key, as an alternative to remote-token-encryption-key",
+		},
+		{
+			DestP: &o.ReplicationMaxQueueSizeLimit,
+			Flag:  "replication-max-queue-size-limit",
+			Desc:  "largest maxQueueSizeBytes a replication can be created or updated with. 0 means no limit",
+		},
 		{
 			DestP:   &o.ReportingDisabled,
 			Flag:    "reporting-disabled",
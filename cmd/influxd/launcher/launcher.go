@@ -55,6 +55,7 @@ import (
 	"github.com/influxdata/influxdb/v2/query/fluxlang"
 	"github.com/influxdata/influxdb/v2/query/stdlib/influxdata/influxdb"
 	"github.com/influxdata/influxdb/v2/remotes"
+	"github.com/influxdata/influxdb/v2/remotes/tokencrypt"
 	remotesTransport "github.com/influxdata/influxdb/v2/remotes/transport"
 	"github.com/influxdata/influxdb/v2/replications"
 	replicationTransport "github.com/influxdata/influxdb/v2/replications/transport"
@@ -348,16 +349,38 @@ func (m *Launcher) run(ctx context.Context, opts *InfluxdOpts) (err error) {
 		restoreService platform.RestoreService = m.engine
 	)
 
-	remotesSvc := remotes.NewService(m.sqlStore)
-	remotesServer := remotesTransport.NewInstrumentedRemotesHandler(
-		m.log.With(zap.String("handler", "remotes")), m.reg, remotesSvc)
+	var tokenCipher *tokencrypt.Cipher
+	tokenKey, err := tokencrypt.LoadKey(opts.RemoteTokenKey, opts.RemoteTokenKeyPath)
+	if err != nil {
+		m.log.Error("Failed to load remote token encryption key", zap.Error(err))
+		return err
+	}
+	if tokenKey != nil {
+		if tokenCipher, err = tokencrypt.New(tokenKey); err != nil {
+			m.log.Error("Failed to load remote token encryption key", zap.Error(err))
+			return err
+		}
+	}
 
-	replicationSvc := replications.NewService(m.sqlStore, ts, pointsWriter, m.log.With(zap.String("service", "replications")), opts.EnginePath)
+	replicationSvc := replications.NewService(m.sqlStore, ts, pointsWriter, m.log.With(zap.String("service", "replications")), opts.EnginePath,
+		replications.WithTokenCipher(tokenCipher), replications.WithMaxQueueSizeLimit(opts.ReplicationMaxQueueSizeLimit))
+	m.reg.MustRegister(replicationSvc.PrometheusCollectors()...)
 	replicationServer := replicationTransport.NewInstrumentedReplicationHandler(
 		m.log.With(zap.String("handler", "replications")), m.reg, replicationSvc)
 	ts.BucketService = replications.NewBucketService(
 		m.log.With(zap.String("service", "replication_buckets")), ts.BucketService, replicationSvc)
 
+	remotesStore := remotes.NewService(m.sqlStore, tokenCipher, replicationSvc)
+	// Tokens and client certificate keys stored before a key was configured are encrypted now, and the server
+	// refuses to start if any are encrypted but the key is missing or wrong.
+	if err := remotesStore.EncryptStoredTokens(ctx); err != nil {
+		m.log.Error("Failed to migrate remote API tokens and client keys", zap.Error(err))
+		return err
+	}
+	remotesSvc := replications.NewRemoteService(remotesStore, replicationSvc)
+	remotesServer := remotesTransport.NewInstrumentedRemotesHandler(
+		m.log.With(zap.String("handler", "remotes")), m.reg, remotesSvc)
+
 	if feature.ReplicationStreamBackend().Enabled(ctx, m.flagger) {
 		if err = replicationSvc.Open(ctx); err != nil {
 			m.log.Error("Failed to open replications service", zap.Error(err))
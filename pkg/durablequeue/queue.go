@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
@@ -14,6 +15,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/influxdata/influxdb/v2/pkg/file"
 	"go.uber.org/zap"
 )
 
@@ -341,6 +343,22 @@ func (l *Queue) Position() (*QueuePos, error) {
 	return qp, nil
 }
 
+// Sync flushes the tail segment and the queue directory to stable storage. Append already syncs the segment
+// it writes to, but not the directory, so a segment created by an Append may be lost on a crash until Sync
+// is called. Once Sync returns, every block appended before the call survives a crash.
+func (l *Queue) Sync() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.tail == nil {
+		return ErrNotOpen
+	}
+	if err := l.tail.sync(); err != nil {
+		return err
+	}
+	return file.SyncDir(l.dir)
+}
+
 // Empty returns whether the queue's underlying segments are empty.
 func (l *Queue) Empty() bool {
 	l.mu.RLock()
@@ -480,6 +498,13 @@ func (l *Queue) TotalSegments() int {
 	return n
 }
 
+// OpenFiles returns the number of segment files held open by the queue.
+func (l *Queue) OpenFiles() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.segments)
+}
+
 // Append appends a byte slice to the end of the queue.
 func (l *Queue) Append(b []byte) error {
 	// Only allow append if there aren't too many concurrent requests.
@@ -540,6 +565,31 @@ func (l *Queue) PeekN(n int) ([][]byte, error) {
 	return l.head.peek(n)
 }
 
+// ForEach calls fn with each byte slice remaining in the queue, oldest first, without advancing the queue. The
+// remaining data of one segment is held in memory at a time.
+func (l *Queue) ForEach(fn func([]byte) error) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.head == nil {
+		return ErrNotOpen
+	}
+
+	for _, seg := range l.segments {
+		blocks, err := seg.peek(math.MaxInt32)
+		if err == io.EOF {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (l *Queue) NewScanner() (Scanner, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
@@ -1116,6 +1166,17 @@ func (l *segment) lastModified() (time.Time, error) {
 	return stats.ModTime().UTC(), nil
 }
 
+// sync flushes the segment file to stable storage.
+func (l *segment) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return ErrNotOpen
+	}
+	return l.file.Sync()
+}
+
 func (l *segment) diskUsage() int64 {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
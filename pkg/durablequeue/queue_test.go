@@ -221,6 +221,17 @@ func TestQueueFull(t *testing.T) {
 	require.Equal(t, ErrQueueFull, q.Append([]byte(strings.Repeat("a", 65))))
 }
 
+func TestQueueSync(t *testing.T) {
+	q, dir := newTestQueue(t)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, q.Append([]byte("test")))
+	require.NoError(t, q.Sync())
+
+	require.NoError(t, q.Close())
+	require.Equal(t, ErrNotOpen, q.Sync())
+}
+
 func TestQueueChangeMaxSize(t *testing.T) {
 	q, dir := newTestQueue(t, withMaxSize(64), withMaxSegmentSize(12))
 	defer os.RemoveAll(dir)
@@ -395,6 +406,33 @@ func TestQueue_TotalBytes(t *testing.T) {
 	}
 }
 
+func TestQueue_ForEach(t *testing.T) {
+	q, dir := newTestQueue(t, withMaxSegmentSize(32))
+	defer os.RemoveAll(dir)
+
+	// The records are spread over several segments.
+	var exp []string
+	for i := 0; i < 4; i++ {
+		b := fmt.Sprintf("record %d", i)
+		require.NoError(t, q.Append([]byte(b)))
+		exp = append(exp, b)
+	}
+	require.NoError(t, q.Advance())
+	require.Greater(t, len(q.segments), 1)
+
+	var got []string
+	require.NoError(t, q.ForEach(func(b []byte) error {
+		got = append(got, string(b))
+		return nil
+	}))
+	require.Equal(t, exp[1:], got)
+
+	// The queue isn't advanced.
+	cur, err := q.Current()
+	require.NoError(t, err)
+	require.Equal(t, exp[1], string(cur))
+}
+
 // This test verifies the queue will advance in the following scenario:
 //
 //    * There is one segment
@@ -1,19 +1,252 @@
 package influxdb
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
 	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/platform/errors"
 )
 
+var ErrInvalidCertFingerprint = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "remoteCertFingerprint must be a hex-encoded SHA-256 digest, optionally separated by colons",
+}
+
+var ErrInvalidRemoteURL = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "remoteURL must be an http(s) URL with a host, and no query, fragment, or credentials",
+}
+
+var ErrInvalidRemoteContentType = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "remoteContentType must be one of " + strings.Join(AllowedRemoteContentTypes, ", "),
+}
+
+var ErrInvalidRemoteWritePath = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "remoteWritePath must be a clean absolute URL path, without a query, fragment, or trailing slash",
+}
+
+var ErrInvalidRemoteProxyURL = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "proxyURL must be an http(s) or socks5 URL with a host, and no path, query, or fragment",
+}
+
+var ErrInvalidRemoteWriteTimeout = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  fmt.Sprintf("writeTimeoutSeconds must be between 1 and %d", MaxRemoteWriteTimeoutSeconds),
+}
+
+var ErrInvalidRemoteClientCert = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "clientCert and clientKey must be set together, to a PEM-encoded certificate and its private key",
+}
+
+var ErrInvalidRemoteCACert = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "caCert must contain one or more PEM-encoded certificates",
+}
+
+var ErrInvalidRemoteAPIType = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  fmt.Sprintf("remoteAPIType must be one of %q or %q", RemoteAPITypeV2, RemoteAPITypeV1),
+}
+
+var ErrInvalidRemoteFormat = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  fmt.Sprintf("remoteFormat must be one of %q or %q", RemoteFormatInflux, RemoteFormatPrometheusRemoteWrite),
+}
+
+var ErrInvalidRemoteHeaders = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "remoteHeaders must be valid HTTP header names and values, and can't set " + strings.Join(reservedRemoteHeaders, ", "),
+}
+
+// reservedRemoteHeaders are set on each request to a remote by the replication itself, so can't be overridden
+// by RemoteHeaders.
+var reservedRemoteHeaders = []string{"Authorization", "Content-Encoding", "Content-Type", "Content-Length", "Host"}
+
+// RemoteHeaders are extra HTTP headers sent with every request to a remote, i.e. {"X-Tenant-Id": "1234"} for
+// gateways in front of it.
+type RemoteHeaders map[string]string
+
+func (h RemoteHeaders) OK() error {
+	for k, v := range h {
+		if !validHeaderName(k) || strings.ContainsAny(v, "\r\n\x00") {
+			return &ErrInvalidRemoteHeaders
+		}
+		for _, reserved := range reservedRemoteHeaders {
+			if http.CanonicalHeaderKey(k) == reserved {
+				return &ErrInvalidRemoteHeaders
+			}
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is a non-empty RFC 7230 token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Value implements the database/sql Valuer interface for storing RemoteHeaders as JSON.
+func (h RemoteHeaders) Value() (driver.Value, error) {
+	if len(h) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the database/sql Scanner interface for loading RemoteHeaders stored as JSON.
+func (h *RemoteHeaders) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return &errors.Error{
+			Code: errors.EInternal,
+			Msg:  "could not load remote headers from sqlite",
+		}
+	}
+	var headers RemoteHeaders
+	if err := json.Unmarshal(b, &headers); err != nil {
+		return err
+	}
+	*h = headers
+	return nil
+}
+
+const (
+	// DefaultRemoteWriteTimeoutSeconds is how long a write to a remote may take unless configured otherwise.
+	DefaultRemoteWriteTimeoutSeconds int32 = 30
+	// MaxRemoteWriteTimeoutSeconds is the longest a write to a remote may be configured to take.
+	MaxRemoteWriteTimeoutSeconds int32 = 3600
+)
+
+// RemoteAPIType is the write API data is sent to a remote through.
+type RemoteAPIType string
+
+const (
+	// RemoteAPITypeV2 remotes are written to through the InfluxDB 2.x /api/v2/write API, authenticating with an
+	// API token. This is the default.
+	RemoteAPITypeV2 RemoteAPIType = "v2"
+	// RemoteAPITypeV1 remotes are written to through the InfluxDB 1.x /write API, into the database and retention
+	// policy each replication maps its bucket to, authenticating with basic auth.
+	RemoteAPITypeV1 RemoteAPIType = "v1"
+)
+
+func (t RemoteAPIType) OK() error {
+	switch t {
+	case RemoteAPITypeV2, RemoteAPITypeV1:
+		return nil
+	default:
+		return &ErrInvalidRemoteAPIType
+	}
+}
+
+// RemoteFormat is the format data is sent to a remote in.
+type RemoteFormat string
+
+const (
+	// RemoteFormatInflux remotes are sent line protocol through the write API of their RemoteAPIType. This is the
+	// default.
+	RemoteFormatInflux RemoteFormat = "influx"
+	// RemoteFormatPrometheusRemoteWrite remotes are sent snappy-compressed Prometheus remote-write protobufs, for
+	// forwarding to Prometheus-compatible stores like Cortex, Mimir, and Thanos. The translation from line protocol
+	// is lossy; see the replications/internal package for how points are mapped to samples.
+	RemoteFormatPrometheusRemoteWrite RemoteFormat = "prometheus_remote_write"
+)
+
+func (f RemoteFormat) OK() error {
+	switch f {
+	case RemoteFormatInflux, RemoteFormatPrometheusRemoteWrite:
+		return nil
+	default:
+		return &ErrInvalidRemoteFormat
+	}
+}
+
+// DefaultRemoteContentType is the Content-Type of the line protocol sent to remotes unless overridden.
+const DefaultRemoteContentType = "text/plain; charset=utf-8"
+
+// AllowedRemoteContentTypes are the Content-Types a remote may be configured to receive line protocol as.
+// Gateways in front of some remotes only accept a specific one of these.
+var AllowedRemoteContentTypes = []string{
+	DefaultRemoteContentType,
+	"text/plain",
+	"application/octet-stream",
+	"application/vnd.influx.line-protocol",
+}
+
 // RemoteConnection contains all info about a remote InfluxDB instance that should be returned to users.
 // Note that the auth token used by the request is *not* included here.
 type RemoteConnection struct {
-	ID               platform.ID `json:"id" db:"id"`
-	OrgID            platform.ID `json:"orgID" db:"org_id"`
-	Name             string      `json:"name" db:"name"`
-	Description      *string     `json:"description,omitempty" db:"description"`
-	RemoteURL        string      `json:"remoteURL" db:"remote_url"`
-	RemoteOrgID      platform.ID `json:"remoteOrgID" db:"remote_org_id"`
-	AllowInsecureTLS bool        `json:"allowInsecureTLS" db:"allow_insecure_tls"`
+	ID                    platform.ID `json:"id" db:"id"`
+	OrgID                 platform.ID `json:"orgID" db:"org_id"`
+	Name                  string      `json:"name" db:"name"`
+	Description           *string     `json:"description,omitempty" db:"description"`
+	RemoteURL             string      `json:"remoteURL" db:"remote_url"`
+	RemoteOrgID           platform.ID `json:"remoteOrgID" db:"remote_org_id"`
+	AllowInsecureTLS      bool        `json:"allowInsecureTLS" db:"allow_insecure_tls"`
+	RemoteCertFingerprint *string     `json:"remoteCertFingerprint,omitempty" db:"remote_cert_fingerprint"`
+	RemoteContentType     *string     `json:"remoteContentType,omitempty" db:"remote_content_type"`
+	// RemoteWritePath, if set, is the path writes are sent to instead of /api/v2/write, for remotes behind
+	// gateways which route by path. It's appended to any path prefix of RemoteURL.
+	RemoteWritePath *string `json:"remoteWritePath,omitempty" db:"remote_write_path"`
+	// RemoteHeaders are extra HTTP headers sent with every request to the remote.
+	RemoteHeaders RemoteHeaders `json:"remoteHeaders,omitempty" db:"remote_headers"`
+	// ProxyURL, if set, is the HTTP proxy requests to the remote are sent through. Otherwise the proxy is
+	// taken from the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables.
+	ProxyURL *string `json:"proxyURL,omitempty" db:"proxy_url"`
+	// WriteTimeoutSeconds, if set, is how long each write to the remote may take before it's abandoned and
+	// retried, instead of DefaultRemoteWriteTimeoutSeconds.
+	WriteTimeoutSeconds *int32 `json:"writeTimeoutSeconds,omitempty" db:"write_timeout_seconds"`
+	// ClientCert, if set, is the PEM-encoded certificate presented to the remote for mutual TLS. Like the API
+	// token, its private key is not included here.
+	ClientCert *string `json:"clientCert,omitempty" db:"client_cert"`
+	// CACert, if set, holds the PEM-encoded certificates the remote's certificate is verified against, instead
+	// of the system's.
+	CACert *string `json:"caCert,omitempty" db:"ca_cert"`
+	// RemoteAPIType, if set, is the write API of the remote. Remotes without one are InfluxDB 2.x remotes.
+	RemoteAPIType *RemoteAPIType `json:"remoteAPIType,omitempty" db:"remote_api_type"`
+	// RemoteUsername, if set, is the user InfluxDB 1.x remotes are written to as, with the API token as their
+	// password. No credentials are sent to 1.x remotes without one.
+	RemoteUsername *string `json:"remoteUsername,omitempty" db:"remote_username"`
+	// RemoteFormat, if set, is the format data is sent to the remote in. Remotes without one are sent line
+	// protocol. Prometheus remote-write remotes are sent the API token as a bearer token, or as the password of
+	// RemoteUsername if it's set.
+	RemoteFormat *RemoteFormat `json:"remoteFormat,omitempty" db:"remote_format"`
 }
 
 // RemoteConnectionListFilter is a selection filter for listing remote InfluxDB instances.
@@ -31,21 +264,295 @@ type RemoteConnections struct {
 // CreateRemoteConnectionRequest contains all info needed to establish a new connection to a remote
 // InfluxDB instance.
 type CreateRemoteConnectionRequest struct {
-	OrgID            platform.ID `json:"orgID"`
-	Name             string      `json:"name"`
-	Description      *string     `json:"description,omitempty"`
-	RemoteURL        string      `json:"remoteURL"`
-	RemoteToken      string      `json:"remoteAPIToken"`
-	RemoteOrgID      platform.ID `json:"remoteOrgID"`
-	AllowInsecureTLS bool        `json:"allowInsecureTLS"`
+	OrgID                 platform.ID    `json:"orgID"`
+	Name                  string         `json:"name"`
+	Description           *string        `json:"description,omitempty"`
+	RemoteURL             string         `json:"remoteURL"`
+	RemoteToken           string         `json:"remoteAPIToken"`
+	RemoteOrgID           platform.ID    `json:"remoteOrgID"`
+	AllowInsecureTLS      bool           `json:"allowInsecureTLS"`
+	RemoteCertFingerprint *string        `json:"remoteCertFingerprint,omitempty"`
+	RemoteContentType     *string        `json:"remoteContentType,omitempty"`
+	RemoteWritePath       *string        `json:"remoteWritePath,omitempty"`
+	RemoteHeaders         RemoteHeaders  `json:"remoteHeaders,omitempty"`
+	ProxyURL              *string        `json:"proxyURL,omitempty"`
+	WriteTimeoutSeconds   *int32         `json:"writeTimeoutSeconds,omitempty"`
+	ClientCert            *string        `json:"clientCert,omitempty"`
+	ClientKey             *string        `json:"clientKey,omitempty"`
+	CACert                *string        `json:"caCert,omitempty"`
+	RemoteAPIType         *RemoteAPIType `json:"remoteAPIType,omitempty"`
+	RemoteUsername        *string        `json:"remoteUsername,omitempty"`
+	RemoteFormat          *RemoteFormat  `json:"remoteFormat,omitempty"`
+}
+
+func (r *CreateRemoteConnectionRequest) OK() error {
+	if _, err := NormalizeRemoteURL(r.RemoteURL); err != nil {
+		return err
+	}
+	if r.RemoteAPIType != nil {
+		if err := r.RemoteAPIType.OK(); err != nil {
+			return err
+		}
+	}
+	if r.RemoteFormat != nil {
+		if err := r.RemoteFormat.OK(); err != nil {
+			return err
+		}
+	}
+	if err := ValidateRemoteClientCert(r.ClientCert, r.ClientKey); err != nil {
+		return err
+	}
+	if r.CACert != nil {
+		if err := ValidateRemoteCACert(*r.CACert); err != nil {
+			return err
+		}
+	}
+	if r.WriteTimeoutSeconds != nil {
+		if err := ValidateRemoteWriteTimeout(*r.WriteTimeoutSeconds); err != nil {
+			return err
+		}
+	}
+	if r.ProxyURL != nil {
+		if err := ValidateRemoteProxyURL(*r.ProxyURL); err != nil {
+			return err
+		}
+	}
+	if err := r.RemoteHeaders.OK(); err != nil {
+		return err
+	}
+	if r.RemoteWritePath != nil {
+		if err := ValidateRemoteWritePath(*r.RemoteWritePath); err != nil {
+			return err
+		}
+	}
+	if r.RemoteContentType != nil {
+		if _, err := NormalizeRemoteContentType(*r.RemoteContentType); err != nil {
+			return err
+		}
+	}
+	if r.RemoteCertFingerprint == nil {
+		return nil
+	}
+	_, err := NormalizeCertFingerprint(*r.RemoteCertFingerprint)
+	return err
 }
 
 // UpdateRemoteConnectionRequest contains a partial update to existing info about a remote InfluxDB instance.
+// Setting RemoteCertFingerprint to an empty string removes the pinned certificate fingerprint, and setting
+// RemoteContentType or RemoteWritePath to an empty string restores the default Content-Type or write path.
+// Setting ProxyURL to an empty string goes back to taking the proxy from the environment, and setting
+// WriteTimeoutSeconds to 0 restores the default write timeout. ClientCert and ClientKey are updated together, and
+// setting both, or CACert, to an empty string removes them. Setting RemoteAPIType or RemoteUsername to an empty
+// string goes back to the 2.x write API, or to sending no credentials to 1.x remotes, and setting RemoteFormat to
+// an empty string goes back to sending line protocol.
+// Non-nil RemoteHeaders replace the remote's headers, with an empty map removing them.
 type UpdateRemoteConnectionRequest struct {
-	Name             *string      `json:"name,omitempty"`
-	Description      *string      `json:"description,omitempty"`
-	RemoteURL        *string      `json:"remoteURL,omitempty"`
-	RemoteToken      *string      `json:"remoteAPIToken,omitempty"`
-	RemoteOrgID      *platform.ID `json:"remoteOrgID,omitempty"`
-	AllowInsecureTLS *bool        `json:"allowInsecureTLS,omitempty"`
+	Name                  *string        `json:"name,omitempty"`
+	Description           *string        `json:"description,omitempty"`
+	RemoteURL             *string        `json:"remoteURL,omitempty"`
+	RemoteToken           *string        `json:"remoteAPIToken,omitempty"`
+	RemoteOrgID           *platform.ID   `json:"remoteOrgID,omitempty"`
+	AllowInsecureTLS      *bool          `json:"allowInsecureTLS,omitempty"`
+	RemoteCertFingerprint *string        `json:"remoteCertFingerprint,omitempty"`
+	RemoteContentType     *string        `json:"remoteContentType,omitempty"`
+	RemoteWritePath       *string        `json:"remoteWritePath,omitempty"`
+	RemoteHeaders         RemoteHeaders  `json:"remoteHeaders,omitempty"`
+	ProxyURL              *string        `json:"proxyURL,omitempty"`
+	WriteTimeoutSeconds   *int32         `json:"writeTimeoutSeconds,omitempty"`
+	ClientCert            *string        `json:"clientCert,omitempty"`
+	ClientKey             *string        `json:"clientKey,omitempty"`
+	CACert                *string        `json:"caCert,omitempty"`
+	RemoteAPIType         *RemoteAPIType `json:"remoteAPIType,omitempty"`
+	RemoteUsername        *string        `json:"remoteUsername,omitempty"`
+	RemoteFormat          *RemoteFormat  `json:"remoteFormat,omitempty"`
+}
+
+func (r *UpdateRemoteConnectionRequest) OK() error {
+	if r.RemoteAPIType != nil && *r.RemoteAPIType != "" {
+		if err := r.RemoteAPIType.OK(); err != nil {
+			return err
+		}
+	}
+	if r.RemoteFormat != nil && *r.RemoteFormat != "" {
+		if err := r.RemoteFormat.OK(); err != nil {
+			return err
+		}
+	}
+	if !r.RemovesClientCert() {
+		if err := ValidateRemoteClientCert(r.ClientCert, r.ClientKey); err != nil {
+			return err
+		}
+	}
+	if r.CACert != nil && *r.CACert != "" {
+		if err := ValidateRemoteCACert(*r.CACert); err != nil {
+			return err
+		}
+	}
+	if r.WriteTimeoutSeconds != nil && *r.WriteTimeoutSeconds != 0 {
+		if err := ValidateRemoteWriteTimeout(*r.WriteTimeoutSeconds); err != nil {
+			return err
+		}
+	}
+	if r.RemoteURL != nil {
+		if _, err := NormalizeRemoteURL(*r.RemoteURL); err != nil {
+			return err
+		}
+	}
+	if r.ProxyURL != nil && *r.ProxyURL != "" {
+		if err := ValidateRemoteProxyURL(*r.ProxyURL); err != nil {
+			return err
+		}
+	}
+	if err := r.RemoteHeaders.OK(); err != nil {
+		return err
+	}
+	if r.RemoteContentType != nil && *r.RemoteContentType != "" {
+		if _, err := NormalizeRemoteContentType(*r.RemoteContentType); err != nil {
+			return err
+		}
+	}
+	if r.RemoteWritePath != nil && *r.RemoteWritePath != "" {
+		if err := ValidateRemoteWritePath(*r.RemoteWritePath); err != nil {
+			return err
+		}
+	}
+	if r.RemoteCertFingerprint == nil || *r.RemoteCertFingerprint == "" {
+		return nil
+	}
+	_, err := NormalizeCertFingerprint(*r.RemoteCertFingerprint)
+	return err
+}
+
+// RemovesClientCert reports whether the update removes the client certificate of the remote.
+func (r *UpdateRemoteConnectionRequest) RemovesClientCert() bool {
+	return r.ClientCert != nil && r.ClientKey != nil && *r.ClientCert == "" && *r.ClientKey == ""
+}
+
+// ValidateRemoteClientCert checks that a client certificate and private key for mutual TLS with a remote are
+// either both unset, or a PEM-encoded certificate and its matching private key.
+func ValidateRemoteClientCert(cert, key *string) error {
+	if cert == nil && key == nil {
+		return nil
+	}
+	if cert == nil || key == nil {
+		return &ErrInvalidRemoteClientCert
+	}
+	if _, err := tls.X509KeyPair([]byte(*cert), []byte(*key)); err != nil {
+		return &ErrInvalidRemoteClientCert
+	}
+	return nil
+}
+
+// ValidateRemoteCACert checks that the CA certificates to verify a remote's certificate against parse as PEM.
+func ValidateRemoteCACert(caCert string) error {
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(caCert)) {
+		return &ErrInvalidRemoteCACert
+	}
+	return nil
+}
+
+// NormalizeCertFingerprint validates a SHA-256 certificate fingerprint, returning it as lower-case hex
+// without separators. Both "ab12..." and "AB:12:..." forms are accepted.
+func NormalizeCertFingerprint(fingerprint string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+	if b, err := hex.DecodeString(normalized); err != nil || len(b) != 32 {
+		return "", &ErrInvalidCertFingerprint
+	}
+	return normalized, nil
+}
+
+// NormalizeRemoteContentType validates a Content-Type to send line protocol to a remote as against
+// AllowedRemoteContentTypes, returning it in canonical form. Case and spacing are ignored.
+func NormalizeRemoteContentType(contentType string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", &ErrInvalidRemoteContentType
+	}
+	for k, v := range params {
+		params[k] = strings.ToLower(v)
+	}
+	normalized := mime.FormatMediaType(mediaType, params)
+	for _, allowed := range AllowedRemoteContentTypes {
+		if normalized == allowed {
+			return normalized, nil
+		}
+	}
+	return "", &ErrInvalidRemoteContentType
+}
+
+// ValidateRemoteWritePath checks that a path to send writes to a remote at is an absolute URL path in clean
+// form, e.g. "/customers/1234/write".
+func ValidateRemoteWritePath(writePath string) error {
+	if writePath == "" || writePath == "/" || writePath[0] != '/' || path.Clean(writePath) != writePath {
+		return &ErrInvalidRemoteWritePath
+	}
+	u, err := url.Parse(writePath)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" || u.Path != writePath || u.EscapedPath() != writePath {
+		return &ErrInvalidRemoteWritePath
+	}
+	return nil
+}
+
+// ValidateRemoteWriteTimeout checks that a remote's write timeout is positive and at most
+// MaxRemoteWriteTimeoutSeconds.
+func ValidateRemoteWriteTimeout(seconds int32) error {
+	if seconds <= 0 || seconds > MaxRemoteWriteTimeoutSeconds {
+		return &ErrInvalidRemoteWriteTimeout
+	}
+	return nil
+}
+
+// ValidateRemoteProxyURL checks that the URL of a proxy to send requests to a remote through is an http(s) or
+// socks5 URL with a host, i.e. "http://proxy.example.com:3128". Credentials for the proxy may be included.
+func ValidateRemoteProxyURL(proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Hostname() == "" || u.Opaque != "" || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return &ErrInvalidRemoteProxyURL
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return &ErrInvalidRemoteProxyURL
+	}
+	if u.Path != "" && u.Path != "/" {
+		return &ErrInvalidRemoteProxyURL
+	}
+	return nil
+}
+
+// NormalizeRemoteURL validates the URL of a remote InfluxDB instance, returning it in canonical form: a lower-case
+// scheme and host, followed by any path prefix the remote is served under, without a trailing slash. The API path
+// ("/api/v2", or "/api/v2/write") is stripped, since it's appended when sending requests. URLs without a scheme
+// are assumed to use https, so API tokens aren't sent in the clear by accident.
+func NormalizeRemoteURL(remoteURL string) (string, error) {
+	remoteURL = strings.TrimSpace(remoteURL)
+	if remoteURL == "" {
+		return "", &ErrInvalidRemoteURL
+	}
+	if !strings.Contains(remoteURL, "://") {
+		remoteURL = "https://" + remoteURL
+	}
+
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", &ErrInvalidRemoteURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Hostname() == "" {
+		return "", &ErrInvalidRemoteURL
+	}
+	if u.User != nil || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" || u.Opaque != "" {
+		return "", &ErrInvalidRemoteURL
+	}
+
+	p := strings.TrimRight(u.Path, "/")
+	for _, suffix := range []string{"/api/v2/write", "/api/v2"} {
+		if strings.HasSuffix(p, suffix) {
+			p = strings.TrimRight(strings.TrimSuffix(p, suffix), "/")
+			break
+		}
+	}
+
+	canonical := url.URL{Scheme: u.Scheme, Host: strings.ToLower(u.Host), Path: p}
+	return canonical.String(), nil
 }
@@ -52,17 +52,17 @@ func (mr *MockRemoteConnectionServiceMockRecorder) CreateRemoteConnection(arg0,
 }
 
 // DeleteRemoteConnection mocks base method.
-func (m *MockRemoteConnectionService) DeleteRemoteConnection(arg0 context.Context, arg1 platform.ID) error {
+func (m *MockRemoteConnectionService) DeleteRemoteConnection(arg0 context.Context, arg1 platform.ID, arg2 bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteRemoteConnection", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeleteRemoteConnection", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteRemoteConnection indicates an expected call of DeleteRemoteConnection.
-func (mr *MockRemoteConnectionServiceMockRecorder) DeleteRemoteConnection(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockRemoteConnectionServiceMockRecorder) DeleteRemoteConnection(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRemoteConnection", reflect.TypeOf((*MockRemoteConnectionService)(nil).DeleteRemoteConnection), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRemoteConnection", reflect.TypeOf((*MockRemoteConnectionService)(nil).DeleteRemoteConnection), arg0, arg1, arg2)
 }
 
 // GetRemoteConnection mocks base method.
@@ -9,6 +9,7 @@ import (
 	"github.com/influxdata/influxdb/v2"
 	"github.com/influxdata/influxdb/v2/kit/platform"
 	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/remotes/tokencrypt"
 	"github.com/influxdata/influxdb/v2/snowflake"
 	"github.com/influxdata/influxdb/v2/sqlite"
 )
@@ -20,20 +21,33 @@ var (
 	}
 )
 
-func NewService(store *sqlite.SqlStore) *service {
+// DeletionHook is notified before a remote is deleted, so services depending on the remote can clean up
+// after it, or refuse the delete while the remote is in use.
+type DeletionHook interface {
+	// OnRemoteDeleting is called before the remote with the given ID is deleted. If cascade is false and
+	// the remote is in use, it should return an error to stop the delete.
+	OnRemoteDeleting(ctx context.Context, remoteID platform.ID, cascade bool) error
+}
+
+// NewService returns a remotes service storing API tokens encrypted with tokens, or in plaintext if it's nil.
+func NewService(store *sqlite.SqlStore, tokens *tokencrypt.Cipher, hooks ...DeletionHook) *service {
 	return &service{
-		store:       store,
-		idGenerator: snowflake.NewIDGenerator(),
+		store:         store,
+		idGenerator:   snowflake.NewIDGenerator(),
+		deletionHooks: hooks,
+		tokens:        tokens,
 	}
 }
 
 type service struct {
-	store       *sqlite.SqlStore
-	idGenerator platform.IDGenerator
+	store         *sqlite.SqlStore
+	idGenerator   platform.IDGenerator
+	deletionHooks []DeletionHook
+	tokens        *tokencrypt.Cipher
 }
 
 func (s service) ListRemoteConnections(ctx context.Context, filter influxdb.RemoteConnectionListFilter) (*influxdb.RemoteConnections, error) {
-	q := sq.Select("id", "org_id", "name", "description", "remote_url", "remote_org_id", "allow_insecure_tls").
+	q := sq.Select("id", "org_id", "name", "description", "remote_url", "remote_org_id", "allow_insecure_tls", "remote_cert_fingerprint", "remote_content_type", "remote_write_path", "remote_headers", "proxy_url", "write_timeout_seconds", "client_cert", "ca_cert", "remote_api_type", "remote_username", "remote_format").
 		From("remotes").
 		Where(sq.Eq{"org_id": filter.OrgID})
 
@@ -41,7 +55,12 @@ func (s service) ListRemoteConnections(ctx context.Context, filter influxdb.Remo
 		q = q.Where(sq.Eq{"name": *filter.Name})
 	}
 	if filter.RemoteURL != nil {
-		q = q.Where(sq.Eq{"remote_url": *filter.RemoteURL})
+		// Remote URLs are stored in canonical form, so match any equivalent URL.
+		remoteURL := *filter.RemoteURL
+		if normalized, err := influxdb.NormalizeRemoteURL(remoteURL); err == nil {
+			remoteURL = normalized
+		}
+		q = q.Where(sq.Eq{"remote_url": remoteURL})
 	}
 
 	query, args, err := q.ToSql()
@@ -58,23 +77,98 @@ func (s service) ListRemoteConnections(ctx context.Context, filter influxdb.Remo
 }
 
 func (s service) CreateRemoteConnection(ctx context.Context, request influxdb.CreateRemoteConnectionRequest) (*influxdb.RemoteConnection, error) {
+	remoteURL, err := influxdb.NormalizeRemoteURL(request.RemoteURL)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := normalizeCertFingerprint(request.RemoteCertFingerprint)
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := normalizeContentType(request.RemoteContentType)
+	if err != nil {
+		return nil, err
+	}
+	if request.RemoteWritePath != nil {
+		if err := influxdb.ValidateRemoteWritePath(*request.RemoteWritePath); err != nil {
+			return nil, err
+		}
+	}
+	if err := request.RemoteHeaders.OK(); err != nil {
+		return nil, err
+	}
+	if request.ProxyURL != nil {
+		if err := influxdb.ValidateRemoteProxyURL(*request.ProxyURL); err != nil {
+			return nil, err
+		}
+	}
+	if request.WriteTimeoutSeconds != nil {
+		if err := influxdb.ValidateRemoteWriteTimeout(*request.WriteTimeoutSeconds); err != nil {
+			return nil, err
+		}
+	}
+	if err := influxdb.ValidateRemoteClientCert(request.ClientCert, request.ClientKey); err != nil {
+		return nil, err
+	}
+	if request.CACert != nil {
+		if err := influxdb.ValidateRemoteCACert(*request.CACert); err != nil {
+			return nil, err
+		}
+	}
+	if request.RemoteAPIType != nil {
+		if err := request.RemoteAPIType.OK(); err != nil {
+			return nil, err
+		}
+	}
+	if request.RemoteFormat != nil {
+		if err := request.RemoteFormat.OK(); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := s.tokens.Encrypt(request.RemoteToken)
+	if err != nil {
+		return nil, err
+	}
+	// The client certificate's private key is as secret as the token, so it's encrypted the same way.
+	var clientKey *string
+	if request.ClientKey != nil {
+		encrypted, err := s.tokens.Encrypt(*request.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		clientKey = &encrypted
+	}
+
 	s.store.Mu.Lock()
 	defer s.store.Mu.Unlock()
 
 	q := sq.Insert("remotes").
 		SetMap(sq.Eq{
-			"id":                 s.idGenerator.ID(),
-			"org_id":             request.OrgID,
-			"name":               request.Name,
-			"description":        request.Description,
-			"remote_url":         request.RemoteURL,
-			"remote_api_token":   request.RemoteToken,
-			"remote_org_id":      request.RemoteOrgID,
-			"allow_insecure_tls": request.AllowInsecureTLS,
-			"created_at":         "datetime('now')",
-			"updated_at":         "datetime('now')",
+			"id":                      s.idGenerator.ID(),
+			"org_id":                  request.OrgID,
+			"name":                    request.Name,
+			"description":             request.Description,
+			"remote_url":              remoteURL,
+			"remote_api_token":        token,
+			"remote_org_id":           request.RemoteOrgID,
+			"allow_insecure_tls":      request.AllowInsecureTLS,
+			"remote_cert_fingerprint": fingerprint,
+			"remote_content_type":     contentType,
+			"remote_write_path":       request.RemoteWritePath,
+			"remote_headers":          request.RemoteHeaders,
+			"proxy_url":               request.ProxyURL,
+			"write_timeout_seconds":   request.WriteTimeoutSeconds,
+			"client_cert":             request.ClientCert,
+			"client_key":              clientKey,
+			"ca_cert":                 request.CACert,
+			"remote_api_type":         request.RemoteAPIType,
+			"remote_username":         request.RemoteUsername,
+			"remote_format":           request.RemoteFormat,
+			"created_at":              "datetime('now')",
+			"updated_at":              "datetime('now')",
 		}).
-		Suffix("RETURNING id, org_id, name, description, remote_url, remote_org_id, allow_insecure_tls")
+		Suffix("RETURNING id, org_id, name, description, remote_url, remote_org_id, allow_insecure_tls, remote_cert_fingerprint, remote_content_type, remote_write_path, remote_headers, proxy_url, write_timeout_seconds, client_cert, ca_cert, remote_api_type, remote_username, remote_format")
 
 	query, args, err := q.ToSql()
 	if err != nil {
@@ -89,7 +183,7 @@ func (s service) CreateRemoteConnection(ctx context.Context, request influxdb.Cr
 }
 
 func (s service) GetRemoteConnection(ctx context.Context, id platform.ID) (*influxdb.RemoteConnection, error) {
-	q := sq.Select("id", "org_id", "name", "description", "remote_url", "remote_org_id", "allow_insecure_tls").
+	q := sq.Select("id", "org_id", "name", "description", "remote_url", "remote_org_id", "allow_insecure_tls", "remote_cert_fingerprint", "remote_content_type", "remote_write_path", "remote_headers", "proxy_url", "write_timeout_seconds", "client_cert", "ca_cert", "remote_api_type", "remote_username", "remote_format").
 		From("remotes").
 		Where(sq.Eq{"id": id})
 
@@ -120,10 +214,18 @@ func (s service) UpdateRemoteConnection(ctx context.Context, id platform.ID, req
 		updates["remote_org_id"] = *request.RemoteOrgID
 	}
 	if request.RemoteURL != nil {
-		updates["remote_url"] = *request.RemoteURL
+		remoteURL, err := influxdb.NormalizeRemoteURL(*request.RemoteURL)
+		if err != nil {
+			return nil, err
+		}
+		updates["remote_url"] = remoteURL
 	}
 	if request.RemoteToken != nil {
-		updates["remote_api_token"] = *request.RemoteToken
+		token, err := s.tokens.Encrypt(*request.RemoteToken)
+		if err != nil {
+			return nil, err
+		}
+		updates["remote_api_token"] = token
 	}
 	if request.Name != nil {
 		updates["name"] = *request.Name
@@ -131,9 +233,126 @@ func (s service) UpdateRemoteConnection(ctx context.Context, id platform.ID, req
 	if request.Description != nil {
 		updates["description"] = *request.Description
 	}
+	if request.RemoteCertFingerprint != nil {
+		// An empty fingerprint removes the pin.
+		var fingerprint *string
+		if *request.RemoteCertFingerprint != "" {
+			var err error
+			if fingerprint, err = normalizeCertFingerprint(request.RemoteCertFingerprint); err != nil {
+				return nil, err
+			}
+		}
+		updates["remote_cert_fingerprint"] = fingerprint
+	}
+	if request.RemoteContentType != nil {
+		// An empty content type restores the default.
+		var contentType *string
+		if *request.RemoteContentType != "" {
+			var err error
+			if contentType, err = normalizeContentType(request.RemoteContentType); err != nil {
+				return nil, err
+			}
+		}
+		updates["remote_content_type"] = contentType
+	}
+	if request.RemoteWritePath != nil {
+		// An empty path restores the default.
+		var writePath *string
+		if *request.RemoteWritePath != "" {
+			if err := influxdb.ValidateRemoteWritePath(*request.RemoteWritePath); err != nil {
+				return nil, err
+			}
+			writePath = request.RemoteWritePath
+		}
+		updates["remote_write_path"] = writePath
+	}
+	if request.RemoteHeaders != nil {
+		if err := request.RemoteHeaders.OK(); err != nil {
+			return nil, err
+		}
+		// Empty headers remove them; their Value is NULL.
+		updates["remote_headers"] = request.RemoteHeaders
+	}
+	if request.ProxyURL != nil {
+		// An empty proxy URL goes back to the environment's proxy.
+		var proxyURL *string
+		if *request.ProxyURL != "" {
+			if err := influxdb.ValidateRemoteProxyURL(*request.ProxyURL); err != nil {
+				return nil, err
+			}
+			proxyURL = request.ProxyURL
+		}
+		updates["proxy_url"] = proxyURL
+	}
+	if request.WriteTimeoutSeconds != nil {
+		// A zero timeout restores the default.
+		var timeout *int32
+		if *request.WriteTimeoutSeconds != 0 {
+			if err := influxdb.ValidateRemoteWriteTimeout(*request.WriteTimeoutSeconds); err != nil {
+				return nil, err
+			}
+			timeout = request.WriteTimeoutSeconds
+		}
+		updates["write_timeout_seconds"] = timeout
+	}
+	if request.RemovesClientCert() {
+		updates["client_cert"] = nil
+		updates["client_key"] = nil
+	} else if request.ClientCert != nil || request.ClientKey != nil {
+		if err := influxdb.ValidateRemoteClientCert(request.ClientCert, request.ClientKey); err != nil {
+			return nil, err
+		}
+		clientKey, err := s.tokens.Encrypt(*request.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		updates["client_cert"] = *request.ClientCert
+		updates["client_key"] = clientKey
+	}
+	if request.CACert != nil {
+		// An empty CA certificate goes back to verifying the remote against the system's CAs.
+		var caCert *string
+		if *request.CACert != "" {
+			if err := influxdb.ValidateRemoteCACert(*request.CACert); err != nil {
+				return nil, err
+			}
+			caCert = request.CACert
+		}
+		updates["ca_cert"] = caCert
+	}
+	if request.RemoteAPIType != nil {
+		// An empty API type goes back to the 2.x write API.
+		var apiType *influxdb.RemoteAPIType
+		if *request.RemoteAPIType != "" {
+			if err := request.RemoteAPIType.OK(); err != nil {
+				return nil, err
+			}
+			apiType = request.RemoteAPIType
+		}
+		updates["remote_api_type"] = apiType
+	}
+	if request.RemoteUsername != nil {
+		// An empty username removes it.
+		var username *string
+		if *request.RemoteUsername != "" {
+			username = request.RemoteUsername
+		}
+		updates["remote_username"] = username
+	}
+	if request.RemoteFormat != nil {
+		// An empty format goes back to sending line protocol.
+		var format *influxdb.RemoteFormat
+		if *request.RemoteFormat != "" {
+			if err := request.RemoteFormat.OK(); err != nil {
+				return nil, err
+			}
+			format = request.RemoteFormat
+		}
+		updates["remote_format"] = format
+	}
 
 	q := sq.Update("remotes").SetMap(updates).Where(sq.Eq{"id": id}).
-		Suffix("RETURNING id, org_id, name, description, remote_url, remote_org_id, allow_insecure_tls")
+		Suffix("RETURNING id, org_id, name, description, remote_url, remote_org_id, allow_insecure_tls, remote_cert_fingerprint, remote_content_type, remote_write_path, remote_headers, proxy_url, write_timeout_seconds, client_cert, ca_cert, remote_api_type, remote_username, remote_format")
 
 	query, args, err := q.ToSql()
 	if err != nil {
@@ -150,7 +369,17 @@ func (s service) UpdateRemoteConnection(ctx context.Context, id platform.ID, req
 	return &rc, nil
 }
 
-func (s service) DeleteRemoteConnection(ctx context.Context, id platform.ID) error {
+func (s service) DeleteRemoteConnection(ctx context.Context, id platform.ID, cascade bool) error {
+	if _, err := s.GetRemoteConnection(ctx, id); err != nil {
+		return err
+	}
+	// Hooks run before taking the store lock, since they may need it themselves.
+	for _, hook := range s.deletionHooks {
+		if err := hook.OnRemoteDeleting(ctx, id, cascade); err != nil {
+			return err
+		}
+	}
+
 	s.store.Mu.Lock()
 	defer s.store.Mu.Unlock()
 
@@ -169,3 +398,25 @@ func (s service) DeleteRemoteConnection(ctx context.Context, id platform.ID) err
 	}
 	return nil
 }
+
+func normalizeCertFingerprint(fingerprint *string) (*string, error) {
+	if fingerprint == nil {
+		return nil, nil
+	}
+	normalized, err := influxdb.NormalizeCertFingerprint(*fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return &normalized, nil
+}
+
+func normalizeContentType(contentType *string) (*string, error) {
+	if contentType == nil {
+		return nil, nil
+	}
+	normalized, err := influxdb.NormalizeRemoteContentType(*contentType)
+	if err != nil {
+		return nil, err
+	}
+	return &normalized, nil
+}
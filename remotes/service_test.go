@@ -2,6 +2,7 @@ package remotes
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/influxdata/influxdb/v2"
@@ -75,6 +76,119 @@ func TestCreateAndGetConnection(t *testing.T) {
 	require.Equal(t, connection, *got)
 }
 
+func TestCreateConnection_NormalizesURL(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	req.RemoteURL = "https://influxdb.cloud/api/v2/"
+	created, err := svc.CreateRemoteConnection(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, connection, *created)
+
+	// Listing by an equivalent URL finds the connection.
+	listed, err := svc.ListRemoteConnections(ctx, influxdb.RemoteConnectionListFilter{OrgID: connection.OrgID, RemoteURL: &req.RemoteURL})
+	require.NoError(t, err)
+	require.Equal(t, []influxdb.RemoteConnection{connection}, listed.Remotes)
+
+	newURL := "other.influxdb/"
+	updated, err := svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteURL: &newURL})
+	require.NoError(t, err)
+	require.Equal(t, "https://other.influxdb", updated.RemoteURL)
+
+	// Clearly invalid URLs are rejected.
+	invalid := "ftp://influxdb.cloud"
+	_, err = svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteURL: &invalid})
+	require.Equal(t, &influxdb.ErrInvalidRemoteURL, err)
+	req.RemoteURL = ""
+	_, err = svc.CreateRemoteConnection(ctx, req)
+	require.Equal(t, &influxdb.ErrInvalidRemoteURL, err)
+}
+
+func TestConnectionContentType(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	contentType := "Text/Plain"
+	req.RemoteContentType = &contentType
+	created, err := svc.CreateRemoteConnection(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", *created.RemoteContentType)
+
+	// Invalid content types are rejected at config time.
+	invalid := "application/json"
+	_, err = svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteContentType: &invalid})
+	require.Equal(t, &influxdb.ErrInvalidRemoteContentType, err)
+	req.RemoteContentType = &invalid
+	_, err = svc.CreateRemoteConnection(ctx, req)
+	require.Equal(t, &influxdb.ErrInvalidRemoteContentType, err)
+
+	// An empty content type restores the default.
+	empty := ""
+	updated, err := svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteContentType: &empty})
+	require.NoError(t, err)
+	require.Nil(t, updated.RemoteContentType)
+}
+
+func TestConnectionWritePath(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	writePath := "/customers/1234/write"
+	req.RemoteWritePath = &writePath
+	created, err := svc.CreateRemoteConnection(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, writePath, *created.RemoteWritePath)
+
+	// Malformed paths are rejected.
+	invalid := "customers/../write?x=y"
+	_, err = svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteWritePath: &invalid})
+	require.Equal(t, &influxdb.ErrInvalidRemoteWritePath, err)
+	req.RemoteWritePath = &invalid
+	_, err = svc.CreateRemoteConnection(ctx, req)
+	require.Equal(t, &influxdb.ErrInvalidRemoteWritePath, err)
+
+	// An empty path restores the default.
+	empty := ""
+	updated, err := svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteWritePath: &empty})
+	require.NoError(t, err)
+	require.Nil(t, updated.RemoteWritePath)
+}
+
+func TestConnectionHeaders(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	req.RemoteHeaders = influxdb.RemoteHeaders{"X-Tenant-Id": "1234"}
+	created, err := svc.CreateRemoteConnection(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, req.RemoteHeaders, created.RemoteHeaders)
+
+	// Headers the replication sets itself are rejected.
+	reserved := influxdb.RemoteHeaders{"Authorization": "Token other"}
+	_, err = svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteHeaders: reserved})
+	require.Equal(t, &influxdb.ErrInvalidRemoteHeaders, err)
+	req.RemoteHeaders = reserved
+	_, err = svc.CreateRemoteConnection(ctx, req)
+	require.Equal(t, &influxdb.ErrInvalidRemoteHeaders, err)
+
+	// Empty headers remove them.
+	updated, err := svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{RemoteHeaders: influxdb.RemoteHeaders{}})
+	require.NoError(t, err)
+	require.Nil(t, updated.RemoteHeaders)
+}
+
 func TestUpdateAndGetConnection(t *testing.T) {
 	t.Parallel()
 
@@ -131,13 +245,13 @@ func TestDeleteConnection(t *testing.T) {
 	defer clean(t)
 
 	// Deleting a nonexistent ID should return an error.
-	require.Equal(t, errRemoteNotFound, svc.DeleteRemoteConnection(ctx, initID))
+	require.Equal(t, errRemoteNotFound, svc.DeleteRemoteConnection(ctx, initID, false))
 
 	// Create a connection, then delete it.
 	created, err := svc.CreateRemoteConnection(ctx, createReq)
 	require.NoError(t, err)
 	require.Equal(t, connection, *created)
-	require.NoError(t, svc.DeleteRemoteConnection(ctx, initID))
+	require.NoError(t, svc.DeleteRemoteConnection(ctx, initID, false))
 
 	// Looking up the ID should again produce an error.
 	got, err := svc.GetRemoteConnection(ctx, initID)
@@ -145,6 +259,44 @@ func TestDeleteConnection(t *testing.T) {
 	require.Nil(t, got)
 }
 
+type fakeDeletionHook struct {
+	calls []bool
+	err   error
+}
+
+func (h *fakeDeletionHook) OnRemoteDeleting(_ context.Context, _ platform.ID, cascade bool) error {
+	h.calls = append(h.calls, cascade)
+	return h.err
+}
+
+func TestDeleteConnection_Hooks(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+	hook := &fakeDeletionHook{}
+	svc.deletionHooks = []DeletionHook{hook}
+
+	// Hooks aren't run for nonexistent remotes.
+	require.Equal(t, errRemoteNotFound, svc.DeleteRemoteConnection(ctx, initID, true))
+	require.Empty(t, hook.calls)
+
+	_, err := svc.CreateRemoteConnection(ctx, createReq)
+	require.NoError(t, err)
+
+	// A hook refusing the delete keeps the remote around.
+	hook.err = errors.New("in use")
+	require.Equal(t, hook.err, svc.DeleteRemoteConnection(ctx, initID, false))
+	_, err = svc.GetRemoteConnection(ctx, initID)
+	require.NoError(t, err)
+
+	hook.err = nil
+	require.NoError(t, svc.DeleteRemoteConnection(ctx, initID, true))
+	require.Equal(t, []bool{false, true}, hook.calls)
+	_, err = svc.GetRemoteConnection(ctx, initID)
+	require.Equal(t, errRemoteNotFound, err)
+}
+
 func TestListConnections(t *testing.T) {
 	t.Parallel()
 
@@ -231,3 +383,61 @@ func newTestService(t *testing.T) (*service, func(t *testing.T)) {
 
 	return &svc, clean
 }
+
+func TestConnectionProxyURL(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	proxyURL := "http://proxy.example.com:3128"
+	req.ProxyURL = &proxyURL
+	created, err := svc.CreateRemoteConnection(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, proxyURL, *created.ProxyURL)
+
+	// Malformed proxy URLs are rejected.
+	invalid := "proxy.example.com:3128"
+	_, err = svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{ProxyURL: &invalid})
+	require.Equal(t, &influxdb.ErrInvalidRemoteProxyURL, err)
+	req.ProxyURL = &invalid
+	_, err = svc.CreateRemoteConnection(ctx, req)
+	require.Equal(t, &influxdb.ErrInvalidRemoteProxyURL, err)
+
+	// An empty proxy URL goes back to the environment's proxy.
+	empty := ""
+	updated, err := svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{ProxyURL: &empty})
+	require.NoError(t, err)
+	require.Nil(t, updated.ProxyURL)
+}
+
+func TestConnectionWriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	timeout := int32(120)
+	req.WriteTimeoutSeconds = &timeout
+	created, err := svc.CreateRemoteConnection(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, timeout, *created.WriteTimeoutSeconds)
+
+	// Timeouts out of bounds are rejected.
+	for _, invalid := range []int32{-1, influxdb.MaxRemoteWriteTimeoutSeconds + 1} {
+		invalid := invalid
+		_, err = svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{WriteTimeoutSeconds: &invalid})
+		require.Equal(t, &influxdb.ErrInvalidRemoteWriteTimeout, err)
+		req.WriteTimeoutSeconds = &invalid
+		_, err = svc.CreateRemoteConnection(ctx, req)
+		require.Equal(t, &influxdb.ErrInvalidRemoteWriteTimeout, err)
+	}
+
+	// A zero timeout restores the default.
+	zero := int32(0)
+	updated, err := svc.UpdateRemoteConnection(ctx, initID, influxdb.UpdateRemoteConnectionRequest{WriteTimeoutSeconds: &zero})
+	require.NoError(t, err)
+	require.Nil(t, updated.WriteTimeoutSeconds)
+}
@@ -0,0 +1,84 @@
+package remotes
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/remotes/tokencrypt"
+)
+
+// EncryptStoredTokens brings the stored API tokens and client certificate keys in line with the service's token
+// encryption, and should be called on startup. With a key configured, secrets stored in plaintext before it was
+// are encrypted, and the already-encrypted ones are checked to decrypt with the key. Without one, it fails if
+// any secrets are encrypted, since their remotes couldn't be replicated to.
+func (s service) EncryptStoredTokens(ctx context.Context) error {
+	s.store.Mu.Lock()
+	defer s.store.Mu.Unlock()
+
+	q := sq.Select("id", "remote_api_token", "client_key").From("remotes")
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var stored []struct {
+		ID        platform.ID `db:"id"`
+		Token     string      `db:"remote_api_token"`
+		ClientKey *string     `db:"client_key"`
+	}
+	if err := s.store.DB.SelectContext(ctx, &stored, query, args...); err != nil {
+		return err
+	}
+
+	for _, r := range stored {
+		updates := sq.Eq{}
+		token, changed, err := s.encryptStored(r.Token)
+		if err != nil {
+			return err
+		} else if changed {
+			updates["remote_api_token"] = token
+		}
+		if r.ClientKey != nil {
+			clientKey, changed, err := s.encryptStored(*r.ClientKey)
+			if err != nil {
+				return err
+			} else if changed {
+				updates["client_key"] = clientKey
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+
+		q := sq.Update("remotes").SetMap(updates).Where(sq.Eq{"id": r.ID})
+		query, args, err := q.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := s.store.DB.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptStored checks a stored secret decrypts if it's encrypted, or encrypts it if a key is configured,
+// reporting whether it needs to be stored again.
+func (s service) encryptStored(stored string) (string, bool, error) {
+	if tokencrypt.IsEncrypted(stored) {
+		if _, err := s.tokens.Decrypt(stored); err != nil {
+			return "", false, err
+		}
+		return stored, false, nil
+	}
+	if s.tokens == nil {
+		return stored, false, nil
+	}
+
+	encrypted, err := s.tokens.Encrypt(stored)
+	if err != nil {
+		return "", false, err
+	}
+	return encrypted, true, nil
+}
@@ -0,0 +1,82 @@
+package remotes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/remotes/tokencrypt"
+	"github.com/stretchr/testify/require"
+)
+
+func storedToken(t *testing.T, svc *service) string {
+	t.Helper()
+
+	var token string
+	require.NoError(t, svc.store.DB.Get(&token, "SELECT remote_api_token FROM remotes WHERE id = ?", initID))
+	return token
+}
+
+func storedClientKey(t *testing.T, svc *service) string {
+	t.Helper()
+
+	var key string
+	require.NoError(t, svc.store.DB.Get(&key, "SELECT client_key FROM remotes WHERE id = ?", initID))
+	return key
+}
+
+func TestEncryptStoredTokens(t *testing.T) {
+	t.Parallel()
+
+	svc, clean := newTestService(t)
+	defer clean(t)
+
+	// Tokens are stored in plaintext without a key.
+	_, err := svc.CreateRemoteConnection(ctx, createReq)
+	require.NoError(t, err)
+	_, err = svc.store.DB.Exec("UPDATE remotes SET client_key = ? WHERE id = ?", "client-key", initID)
+	require.NoError(t, err)
+	require.Equal(t, fakeToken, storedToken(t, svc))
+	require.NoError(t, svc.EncryptStoredTokens(ctx))
+	require.Equal(t, fakeToken, storedToken(t, svc))
+	require.Equal(t, "client-key", storedClientKey(t, svc))
+
+	// Once a key is configured, they're encrypted on startup.
+	tokens, err := tokencrypt.New(bytes.Repeat([]byte{1}, tokencrypt.KeySize))
+	require.NoError(t, err)
+	svc.tokens = tokens
+	require.NoError(t, svc.EncryptStoredTokens(ctx))
+	stored := storedToken(t, svc)
+	require.True(t, tokencrypt.IsEncrypted(stored))
+	token, err := tokens.Decrypt(stored)
+	require.NoError(t, err)
+	require.Equal(t, fakeToken, token)
+	storedKey := storedClientKey(t, svc)
+	require.True(t, tokencrypt.IsEncrypted(storedKey))
+	key, err := tokens.Decrypt(storedKey)
+	require.NoError(t, err)
+	require.Equal(t, "client-key", key)
+
+	// Encrypting again leaves them be.
+	require.NoError(t, svc.EncryptStoredTokens(ctx))
+	require.Equal(t, stored, storedToken(t, svc))
+	require.Equal(t, storedKey, storedClientKey(t, svc))
+
+	// Updated tokens are encrypted too.
+	_, err = svc.UpdateRemoteConnection(ctx, initID, updateReq)
+	require.NoError(t, err)
+	token, err = tokens.Decrypt(storedToken(t, svc))
+	require.NoError(t, err)
+	require.Equal(t, fakeToken2, token)
+
+	// Starting without the key, or with the wrong one, fails.
+	svc.tokens = nil
+	require.Equal(t, tokencrypt.ErrKeyMissing, svc.EncryptStoredTokens(ctx))
+	svc.tokens, err = tokencrypt.New(bytes.Repeat([]byte{2}, tokencrypt.KeySize))
+	require.NoError(t, err)
+	require.Equal(t, tokencrypt.ErrDecrypt, svc.EncryptStoredTokens(ctx))
+
+	// So does an encrypted client key the key can't decrypt, even if the token is in plaintext.
+	_, err = svc.store.DB.Exec("UPDATE remotes SET remote_api_token = ?, client_key = ? WHERE id = ?", fakeToken, storedKey, initID)
+	require.NoError(t, err)
+	require.Equal(t, tokencrypt.ErrDecrypt, svc.EncryptStoredTokens(ctx))
+}
@@ -0,0 +1,119 @@
+// Package tokencrypt encrypts the API tokens of remote connections before they're stored, so they aren't
+// readable from the sqlite file on disk.
+package tokencrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/influxdata/influxdb/v2/kit/platform/errors"
+)
+
+// KeySize is the size of token encryption keys in bytes. Tokens are sealed with AES-256-GCM.
+const KeySize = 32
+
+// encryptedPrefix marks stored tokens which are encrypted, and the scheme they're encrypted with. Tokens
+// without it are plaintext, stored before encryption was configured.
+const encryptedPrefix = "enc:v1:"
+
+var (
+	ErrKeyMissing = &errors.Error{
+		Code: errors.EInternal,
+		Msg:  "remote API tokens are stored encrypted, but no token encryption key is configured",
+	}
+
+	ErrDecrypt = &errors.Error{
+		Code: errors.EInternal,
+		Msg:  "failed to decrypt remote API token, the configured token encryption key may not be the one it was encrypted with",
+	}
+)
+
+// Cipher encrypts and decrypts stored tokens. A nil Cipher stores tokens in plaintext.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// New returns a Cipher encrypting tokens with the given KeySize-byte key.
+func New(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("token encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// LoadKey decodes a base64-encoded key given either directly or as the contents of the file at path. It returns
+// a nil key if neither is set.
+func LoadKey(encoded, path string) ([]byte, error) {
+	if encoded != "" && path != "" {
+		return nil, fmt.Errorf("token encryption key and key path are mutually exclusive")
+	}
+	if path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading token encryption key: %w", err)
+		}
+		encoded = string(contents)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("token encryption key must be base64-encoded: %w", err)
+	}
+	return key, nil
+}
+
+// IsEncrypted reports whether a stored token is encrypted.
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, encryptedPrefix)
+}
+
+// Encrypt seals a token for storage. A nil Cipher returns it unchanged.
+func (c *Cipher) Encrypt(token string) (string, error) {
+	if c == nil {
+		return token, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(token), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt recovers a stored token. Plaintext tokens are returned unchanged, while encrypted ones fail with
+// ErrKeyMissing if the Cipher is nil.
+func (c *Cipher) Decrypt(stored string) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+	if c == nil {
+		return "", ErrKeyMissing
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	token, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(token), nil
+}
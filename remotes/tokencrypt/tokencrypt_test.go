@@ -0,0 +1,71 @@
+package tokencrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher(t *testing.T) {
+	c, err := New(bytes.Repeat([]byte{1}, KeySize))
+	require.NoError(t, err)
+
+	stored, err := c.Encrypt("my-token")
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(stored))
+	require.NotContains(t, stored, "my-token")
+
+	token, err := c.Decrypt(stored)
+	require.NoError(t, err)
+	require.Equal(t, "my-token", token)
+
+	// Plaintext tokens stored before encryption was configured are read as they are.
+	token, err = c.Decrypt("my-token")
+	require.NoError(t, err)
+	require.Equal(t, "my-token", token)
+
+	// Without the key, encrypted tokens can't be read.
+	var none *Cipher
+	_, err = none.Decrypt(stored)
+	require.Equal(t, ErrKeyMissing, err)
+	plain, err := none.Encrypt("my-token")
+	require.NoError(t, err)
+	require.Equal(t, "my-token", plain)
+
+	// Nor with the wrong key.
+	other, err := New(bytes.Repeat([]byte{2}, KeySize))
+	require.NoError(t, err)
+	_, err = other.Decrypt(stored)
+	require.Equal(t, ErrDecrypt, err)
+
+	_, err = New([]byte("short"))
+	require.Error(t, err)
+}
+
+func TestLoadKey(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, KeySize)
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	got, err := LoadKey(encoded, "")
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, ioutil.WriteFile(path, []byte(encoded+"\n"), 0600))
+	got, err = LoadKey("", path)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	got, err = LoadKey("", "")
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	_, err = LoadKey(encoded, path)
+	require.Error(t, err)
+	_, err = LoadKey("not base64!", "")
+	require.Error(t, err)
+}
@@ -3,6 +3,7 @@ package transport
 import (
 	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -29,6 +30,11 @@ var (
 		Code: errors.EInvalid,
 		Msg:  "remote-connection ID is invalid",
 	}
+
+	errBadCascade = &errors.Error{
+		Code: errors.EInvalid,
+		Msg:  "cascade must be true or false",
+	}
 )
 
 type RemoteConnectionService interface {
@@ -45,7 +51,9 @@ type RemoteConnectionService interface {
 	UpdateRemoteConnection(context.Context, platform.ID, influxdb.UpdateRemoteConnectionRequest) (*influxdb.RemoteConnection, error)
 
 	// DeleteRemoteConnection deletes all info for the remote InfluxDB connection with the given ID.
-	DeleteRemoteConnection(context.Context, platform.ID) error
+	// If cascade is true, replications to the remote are deleted along with it. Otherwise, the delete
+	// fails while any replications to the remote exist.
+	DeleteRemoteConnection(ctx context.Context, id platform.ID, cascade bool) error
 }
 
 type RemoteConnectionHandler struct {
@@ -208,7 +216,16 @@ func (h *RemoteConnectionHandler) handleDeleteRemote(w http.ResponseWriter, r *h
 		return
 	}
 
-	if err := h.remotesService.DeleteRemoteConnection(r.Context(), *id); err != nil {
+	// cascade is optional, and defaults to refusing to delete remotes which are in use.
+	var cascade bool
+	if c := r.URL.Query().Get("cascade"); c != "" {
+		if cascade, err = strconv.ParseBool(c); err != nil {
+			h.api.Err(w, r, errBadCascade)
+			return
+		}
+	}
+
+	if err := h.remotesService.DeleteRemoteConnection(r.Context(), *id, cascade); err != nil {
 		h.api.Err(w, r, err)
 		return
 	}
@@ -112,11 +112,31 @@ func TestRemoteConnectionHandler(t *testing.T) {
 
 		req := newTestRequest(t, "DELETE", ts.URL+"/"+id.String(), nil)
 
-		svc.EXPECT().DeleteRemoteConnection(gomock.Any(), *id).Return(nil)
+		svc.EXPECT().DeleteRemoteConnection(gomock.Any(), *id, false).Return(nil)
 
 		doTestRequest(t, req, http.StatusNoContent, false)
 	})
 
+	t.Run("delete remote with cascade", func(t *testing.T) {
+		ts, svc := newTestServer(t)
+		defer ts.Close()
+
+		req := newTestRequest(t, "DELETE", ts.URL+"/"+id.String()+"?cascade=true", nil)
+
+		svc.EXPECT().DeleteRemoteConnection(gomock.Any(), *id, true).Return(nil)
+
+		doTestRequest(t, req, http.StatusNoContent, false)
+	})
+
+	t.Run("delete remote with invalid cascade", func(t *testing.T) {
+		ts, _ := newTestServer(t)
+		defer ts.Close()
+
+		req := newTestRequest(t, "DELETE", ts.URL+"/"+id.String()+"?cascade=maybe", nil)
+
+		doTestRequest(t, req, http.StatusBadRequest, true)
+	})
+
 	t.Run("update remote happy path", func(t *testing.T) {
 		ts, svc := newTestServer(t)
 		defer ts.Close()
@@ -69,7 +69,7 @@ func (a authCheckingService) UpdateRemoteConnection(ctx context.Context, id plat
 	return a.underlying.UpdateRemoteConnection(ctx, id, request)
 }
 
-func (a authCheckingService) DeleteRemoteConnection(ctx context.Context, id platform.ID) error {
+func (a authCheckingService) DeleteRemoteConnection(ctx context.Context, id platform.ID, cascade bool) error {
 	r, err := a.underlying.GetRemoteConnection(ctx, id)
 	if err != nil {
 		return err
@@ -77,5 +77,5 @@ func (a authCheckingService) DeleteRemoteConnection(ctx context.Context, id plat
 	if _, _, err := authorizer.AuthorizeWrite(ctx, influxdb.RemotesResourceType, id, r.OrgID); err != nil {
 		return err
 	}
-	return a.underlying.DeleteRemoteConnection(ctx, id)
+	return a.underlying.DeleteRemoteConnection(ctx, id, cascade)
 }
@@ -71,7 +71,7 @@ func (l loggingService) UpdateRemoteConnection(ctx context.Context, id platform.
 	return l.underlying.UpdateRemoteConnection(ctx, id, request)
 }
 
-func (l loggingService) DeleteRemoteConnection(ctx context.Context, id platform.ID) (err error) {
+func (l loggingService) DeleteRemoteConnection(ctx context.Context, id platform.ID, cascade bool) (err error) {
 	defer func(start time.Time) {
 		dur := zap.Duration("took", time.Since(start))
 		if err != nil {
@@ -80,5 +80,5 @@ func (l loggingService) DeleteRemoteConnection(ctx context.Context, id platform.
 		}
 		l.logger.Debug("remote delete", dur)
 	}(time.Now())
-	return l.underlying.DeleteRemoteConnection(ctx, id)
+	return l.underlying.DeleteRemoteConnection(ctx, id, cascade)
 }
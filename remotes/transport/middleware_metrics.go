@@ -49,7 +49,7 @@ func (m metricsService) UpdateRemoteConnection(ctx context.Context, id platform.
 	return rc, rec(err)
 }
 
-func (m metricsService) DeleteRemoteConnection(ctx context.Context, id platform.ID) error {
+func (m metricsService) DeleteRemoteConnection(ctx context.Context, id platform.ID, cascade bool) error {
 	rec := m.rec.Record("delete_remote")
-	return rec(m.underlying.DeleteRemoteConnection(ctx, id))
+	return rec(m.underlying.DeleteRemoteConnection(ctx, id, cascade))
 }
@@ -1,10 +1,14 @@
 package influxdb
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/influxdata/influxdb/v2/kit/platform"
 	"github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/models"
 )
 
 const (
@@ -17,20 +21,723 @@ var ErrMaxQueueSizeTooSmall = errors.Error{
 	Msg:  fmt.Sprintf("maxQueueSize too small, must be at least %d", MinReplicationMaxQueueSizeBytes),
 }
 
-// Replication contains all info about a replication that should be returned to users.
-type Replication struct {
-	ID                    platform.ID `json:"id" db:"id"`
-	OrgID                 platform.ID `json:"orgID" db:"org_id"`
-	Name                  string      `json:"name" db:"name"`
-	Description           *string     `json:"description,omitempty" db:"description"`
+// MaxReplicationFlushIntervalSeconds bounds how long a replication can hold data back to send it in larger batches.
+const MaxReplicationFlushIntervalSeconds int64 = 3600
+
+var ErrInvalidFlushInterval = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  fmt.Sprintf("flushIntervalSeconds must be between 0 and %d", MaxReplicationFlushIntervalSeconds),
+}
+
+func validateFlushInterval(seconds int64) error {
+	if seconds < 0 || seconds > MaxReplicationFlushIntervalSeconds {
+		return &ErrInvalidFlushInterval
+	}
+	return nil
+}
+
+// MaxReplicationRetryIntervalSeconds bounds how long a replication can wait between attempts to send data its
+// remote failed to accept.
+const MaxReplicationRetryIntervalSeconds int64 = 24 * 60 * 60
+
+// DefaultReplicationMaxRetryIntervalSeconds is how long the wait between retries of a replication with a retry
+// interval can grow to, unless configured otherwise.
+const DefaultReplicationMaxRetryIntervalSeconds int64 = 5 * 60
+
+var ErrInvalidRetryInterval = errors.Error{
+	Code: errors.EInvalid,
+	Msg: fmt.Sprintf("retryIntervalSeconds and maxRetryIntervalSeconds must be between 0 and %d",
+		MaxReplicationRetryIntervalSeconds),
+}
+
+var ErrInvalidDeadLetterBucket = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "deadLetterBucketID must differ from localBucketID",
+}
+
+var ErrDeadLetterBucketConflict = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "deadLetterBucketID can't be set while removing the dead-letter bucket",
+}
+
+var ErrInvalidRemoteDatabase = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "remoteRetentionPolicy requires remoteDatabase to be set",
+}
+
+var ErrMaxRetryIntervalTooSmall = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "maxRetryIntervalSeconds must not be less than retryIntervalSeconds",
+}
+
+func validateRetryInterval(seconds int64) error {
+	if seconds < 0 || seconds > MaxReplicationRetryIntervalSeconds {
+		return &ErrInvalidRetryInterval
+	}
+	return nil
+}
+
+// MaxReplicationTimestampOffsetSeconds bounds how far a replication can shift the timestamps of the points it
+// sends, in either direction: roughly 10 years.
+const MaxReplicationTimestampOffsetSeconds int64 = 10 * 365 * 24 * 60 * 60
+
+var ErrInvalidTimestampOffset = errors.Error{
+	Code: errors.EInvalid,
+	Msg: fmt.Sprintf("timestampOffsetSeconds must be between %d and %d",
+		-MaxReplicationTimestampOffsetSeconds, MaxReplicationTimestampOffsetSeconds),
+}
+
+func validateTimestampOffset(seconds int64) error {
+	if seconds < -MaxReplicationTimestampOffsetSeconds || seconds > MaxReplicationTimestampOffsetSeconds {
+		return &ErrInvalidTimestampOffset
+	}
+	return nil
+}
+
+var ErrInvalidDurabilityTier = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  fmt.Sprintf("durabilityTier must be one of %q or %q", DurabilityBestEffort, DurabilityGuaranteed),
+}
+
+// DurabilityTier controls how writes to a replication's local bucket react to failing to enqueue
+// points into the replication.
+type DurabilityTier string
+
+const (
+	// DurabilityBestEffort replications drop points they fail to enqueue, without failing the write.
+	DurabilityBestEffort DurabilityTier = "best_effort"
+	// DurabilityGuaranteed replications fail the write if they can't enqueue its points, pushing back
+	// on the client so it retries the write instead of the points being lost.
+	DurabilityGuaranteed DurabilityTier = "guaranteed"
+)
+
+func (t DurabilityTier) OK() error {
+	switch t {
+	case DurabilityBestEffort, DurabilityGuaranteed:
+		return nil
+	default:
+		return &ErrInvalidDurabilityTier
+	}
+}
+
+// ReplicationHealth summarizes how well a replication is keeping its remote up to date.
+type ReplicationHealth string
+
+const (
+	// ReplicationHealthy replications are delivering their data to the remote.
+	ReplicationHealthy ReplicationHealth = "healthy"
+	// ReplicationDegraded replications are still keeping up, but their last write to the remote failed, their
+	// queue is nearly full, or they haven't delivered any of the data queued for a while.
+	ReplicationDegraded ReplicationHealth = "degraded"
+	// ReplicationFailing replications are falling behind: their last write to the remote failed and their queue
+	// is growing, or points written to the local bucket can't be queued at all.
+	ReplicationFailing ReplicationHealth = "failing"
+	// ReplicationPaused replications have been paused, and aren't sending anything.
+	ReplicationPaused ReplicationHealth = "paused"
+)
+
+var ErrInvalidRemoteBucketDeletedPolicy = errors.Error{
+	Code: errors.EInvalid,
+	Msg: fmt.Sprintf("remoteBucketDeletedPolicy must be one of %q, %q or %q",
+		RemoteBucketDeletedPauseAndAlert, RemoteBucketDeletedDrop, RemoteBucketDeletedRecreate),
+}
+
+// RemoteBucketDeletedPolicy controls what a replication does when its remote reports that the
+// remote bucket doesn't exist, i.e. because it was deleted while the replication was running.
+type RemoteBucketDeletedPolicy string
+
+const (
+	// RemoteBucketDeletedPauseAndAlert replications stop sending, keeping their queued data, and log
+	// an error. Sending resumes once the replication is updated.
+	RemoteBucketDeletedPauseAndAlert RemoteBucketDeletedPolicy = "pause-and-alert"
+	// RemoteBucketDeletedDrop replications drop data the remote bucket can't receive.
+	RemoteBucketDeletedDrop RemoteBucketDeletedPolicy = "drop"
+	// RemoteBucketDeletedRecreate replications create a new bucket on the remote, with the name of the
+	// local bucket, and switch to sending to it. This requires remote bucket auto-creation to be enabled
+	// on the server, and otherwise behaves like RemoteBucketDeletedPauseAndAlert.
+	RemoteBucketDeletedRecreate RemoteBucketDeletedPolicy = "recreate"
+)
+
+func (p RemoteBucketDeletedPolicy) OK() error {
+	switch p {
+	case RemoteBucketDeletedPauseAndAlert, RemoteBucketDeletedDrop, RemoteBucketDeletedRecreate:
+		return nil
+	default:
+		return &ErrInvalidRemoteBucketDeletedPolicy
+	}
+}
+
+var ErrInvalidRemoteWritePrecision = errors.Error{
+	Code: errors.EInvalid,
+	Msg: fmt.Sprintf("remoteWritePrecision must be one of %q, %q, %q or %q",
+		WritePrecisionNanoseconds, WritePrecisionMicroseconds, WritePrecisionMilliseconds, WritePrecisionSeconds),
+}
+
+// WritePrecision is the precision of the timestamps a replication sends to its remote. Points are queued
+// with nanosecond timestamps, which are truncated to the precision of the replication when they're sent.
+type WritePrecision string
+
+const (
+	WritePrecisionNanoseconds  WritePrecision = "ns"
+	WritePrecisionMicroseconds WritePrecision = "us"
+	WritePrecisionMilliseconds WritePrecision = "ms"
+	WritePrecisionSeconds      WritePrecision = "s"
+)
+
+func (p WritePrecision) OK() error {
+	switch p {
+	case WritePrecisionNanoseconds, WritePrecisionMicroseconds, WritePrecisionMilliseconds, WritePrecisionSeconds:
+		return nil
+	default:
+		return &ErrInvalidRemoteWritePrecision
+	}
+}
+
+var ErrInvalidReplicationCompression = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  fmt.Sprintf("compression must be one of %q, %q or %q", CompressionGzip, CompressionZstd, CompressionNone),
+}
+
+// ReplicationCompression is the codec a replication compresses the line protocol it queues with. Queued data is
+// sent to the remote as-is, with the matching Content-Encoding.
+type ReplicationCompression string
+
+const (
+	CompressionGzip ReplicationCompression = "gzip"
+	CompressionZstd ReplicationCompression = "zstd"
+	// CompressionNone replications queue and send line protocol uncompressed, trading disk space and bandwidth
+	// for the CPU time spent compressing it.
+	CompressionNone ReplicationCompression = "none"
+)
+
+func (c ReplicationCompression) OK() error {
+	switch c {
+	case CompressionGzip, CompressionZstd, CompressionNone:
+		return nil
+	default:
+		return &ErrInvalidReplicationCompression
+	}
+}
+
+var ErrInvalidRemoteBucketMapping = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "remoteBucketTag and remoteBucketMapping must be set together, and the mapping must only hold valid bucket IDs",
+}
+
+// RemoteBucketMapping maps the values of a tag to the remote buckets points with them are sent to.
+type RemoteBucketMapping map[string]platform.ID
+
+func (m RemoteBucketMapping) OK() error {
+	for _, id := range m {
+		if !id.Valid() {
+			return &ErrInvalidRemoteBucketMapping
+		}
+	}
+	return nil
+}
+
+// Value implements the database/sql Valuer interface for storing a RemoteBucketMapping as JSON.
+func (m RemoteBucketMapping) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the database/sql Scanner interface for loading a RemoteBucketMapping stored as JSON.
+func (m *RemoteBucketMapping) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return &errors.Error{
+			Code: errors.EInternal,
+			Msg:  "could not load remote bucket mapping from sqlite",
+		}
+	}
+	var mapping RemoteBucketMapping
+	if err := json.Unmarshal(b, &mapping); err != nil {
+		return err
+	}
+	*m = mapping
+	return nil
+}
+
+var ErrInvalidTagFilter = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "tagFilter keys and values must not be empty",
+}
+
+// ReplicationTagFilter restricts a replication to the points whose tags have all of the given values. Points
+// missing any of the tags don't match.
+type ReplicationTagFilter map[string]string
+
+func (f ReplicationTagFilter) OK() error {
+	for k, v := range f {
+		if k == "" || v == "" {
+			return &ErrInvalidTagFilter
+		}
+	}
+	return nil
+}
+
+// Value implements the database/sql Valuer interface for storing a ReplicationTagFilter as JSON.
+func (f ReplicationTagFilter) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the database/sql Scanner interface for loading a ReplicationTagFilter stored as JSON.
+func (f *ReplicationTagFilter) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return &errors.Error{
+			Code: errors.EInternal,
+			Msg:  "could not load tag filter from sqlite",
+		}
+	}
+	var filter ReplicationTagFilter
+	if err := json.Unmarshal(b, &filter); err != nil {
+		return err
+	}
+	*f = filter
+	return nil
+}
+
+var ErrInvalidRenameRules = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "renameRules must rename measurements and fields to non-empty, printable names, without renaming two fields of a measurement to the same name",
+}
+
+// ReplicationRenameRule renames a measurement, and optionally some of its fields, in the data sent to the remote.
+type ReplicationRenameRule struct {
+	// Measurement, if set, is the measurement points are renamed to. Empty keeps the measurement's name, to only
+	// rename fields.
+	Measurement string `json:"measurement,omitempty"`
+	// Fields maps the fields of the measurement to rename to their new names.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// ReplicationRenameRules maps the measurements whose points are renamed as they're sent to the remote to how they're
+// renamed, i.e. to prefix the measurements written to a remote shared with other sources. Tags and timestamps are
+// kept, as are points of measurements without a rule. A field renamed to the name of another field of the point
+// replaces it.
+type ReplicationRenameRules map[string]ReplicationRenameRule
+
+func (r ReplicationRenameRules) OK() error {
+	for measurement, rule := range r {
+		if !validRenameToken(measurement) || (rule.Measurement != "" && !validRenameToken(rule.Measurement)) {
+			return &ErrInvalidRenameRules
+		}
+		if rule.Measurement == "" && len(rule.Fields) == 0 {
+			return &ErrInvalidRenameRules
+		}
+		targets := make(map[string]bool, len(rule.Fields))
+		for from, to := range rule.Fields {
+			if !validRenameToken(from) || !validRenameToken(to) || targets[to] {
+				return &ErrInvalidRenameRules
+			}
+			targets[to] = true
+		}
+	}
+	return nil
+}
+
+// validRenameToken reports whether a name is a valid line protocol measurement or field name.
+func validRenameToken(name string) bool {
+	return name != "" && models.ValidToken([]byte(name))
+}
+
+// Value implements the database/sql Valuer interface for storing ReplicationRenameRules as JSON.
+func (r ReplicationRenameRules) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the database/sql Scanner interface for loading ReplicationRenameRules stored as JSON.
+func (r *ReplicationRenameRules) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return &errors.Error{
+			Code: errors.EInternal,
+			Msg:  "could not load rename rules from sqlite",
+		}
+	}
+	var rules ReplicationRenameRules
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
+
+// MaxReplicationDownsampleWindowSeconds bounds the windows replications can downsample data into.
+const MaxReplicationDownsampleWindowSeconds int64 = 24 * 60 * 60
+
+var ErrInvalidDownsample = errors.Error{
+	Code: errors.EInvalid,
+	Msg: fmt.Sprintf("downsample windowSeconds must be between 1 and %d, and aggregate one of %q",
+		MaxReplicationDownsampleWindowSeconds, DownsampleAggregates),
+}
+
+// DownsampleAggregate is how the values of a field within a downsampling window are rolled up into one.
+type DownsampleAggregate string
+
+const (
+	DownsampleMean  DownsampleAggregate = "mean"
+	DownsampleMin   DownsampleAggregate = "min"
+	DownsampleMax   DownsampleAggregate = "max"
+	DownsampleSum   DownsampleAggregate = "sum"
+	DownsampleCount DownsampleAggregate = "count"
+	DownsampleLast  DownsampleAggregate = "last"
+)
+
+// DownsampleAggregates are the aggregates replications can downsample data with.
+var DownsampleAggregates = []DownsampleAggregate{
+	DownsampleMean, DownsampleMin, DownsampleMax, DownsampleSum, DownsampleCount, DownsampleLast,
+}
+
+// ReplicationDownsample rolls up the points a replication sends to its remote into one point per series per
+// window, timestamped at the start of the window. Each field is aggregated over the points of the window which
+// have it, so a rolled-up point has every field seen in its window, and windows without points are skipped.
+//
+// The mean of a field is a float, and its count an integer. The sum, min and max of integer and unsigned fields
+// keep their type. String and boolean fields can't be aggregated, so take their last value in the window, except
+// for count.
+//
+// Points are rolled up as they're sent, one block of queued data at a time, so a window whose points are split
+// across blocks is sent once per block, and the last of them overwrites the others on the remote. Setting the
+// replication's flush interval to at least the window keeps windows together. The local bucket always gets every
+// point at full resolution.
+type ReplicationDownsample struct {
+	WindowSeconds int64               `json:"windowSeconds"`
+	Aggregate     DownsampleAggregate `json:"aggregate"`
+}
+
+func (d ReplicationDownsample) OK() error {
+	if d.WindowSeconds < 1 || d.WindowSeconds > MaxReplicationDownsampleWindowSeconds {
+		return &ErrInvalidDownsample
+	}
+	for _, a := range DownsampleAggregates {
+		if d.Aggregate == a {
+			return nil
+		}
+	}
+	return &ErrInvalidDownsample
+}
+
+// IsZero reports whether d is the zero value, which removes the downsampling of a replication on update.
+func (d ReplicationDownsample) IsZero() bool {
+	return d == ReplicationDownsample{}
+}
+
+// Value implements the database/sql Valuer interface for storing a ReplicationDownsample as JSON.
+func (d ReplicationDownsample) Value() (driver.Value, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the database/sql Scanner interface for loading a ReplicationDownsample stored as JSON.
+func (d *ReplicationDownsample) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return &errors.Error{
+			Code: errors.EInternal,
+			Msg:  "could not load downsample from sqlite",
+		}
+	}
+	return json.Unmarshal(b, d)
+}
+
+// RemoteCapabilities are what a replication's remote was detected to support, by probing its health, ready and
+// write endpoints. They're refreshed periodically, and whenever the replication is validated.
+type RemoteCapabilities struct {
+	// Version is the version of InfluxDB the remote reported, if any.
+	Version string `json:"version,omitempty"`
+	// APIVersion is the major version of the remote's API: 1 for InfluxDB 1.x, 2 otherwise.
+	APIVersion int `json:"apiVersion"`
+	// Encodings are the compression codecs the remote's write endpoint accepts. Uncompressed writes are always
+	// accepted.
+	Encodings []ReplicationCompression `json:"encodings"`
+	// Endpoints are the paths of the status endpoints the remote serves, i.e. /health and /ready.
+	Endpoints  []string  `json:"endpoints"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// AcceptsEncoding returns whether the remote accepts writes compressed with the given codec.
+func (c *RemoteCapabilities) AcceptsEncoding(compression ReplicationCompression) bool {
+	if compression == CompressionNone {
+		return true
+	}
+	for _, e := range c.Encodings {
+		if e == compression {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements the database/sql Valuer interface for storing RemoteCapabilities as JSON.
+func (c RemoteCapabilities) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the database/sql Scanner interface for loading RemoteCapabilities stored as JSON.
+func (c *RemoteCapabilities) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	default:
+		return &errors.Error{
+			Code: errors.EInternal,
+			Msg:  "could not load remote capabilities from sqlite",
+		}
+	}
+}
+
+var ErrInvalidReplicationDestination = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "each additional destination must be a different remote than the replication's own and the other destinations",
+}
+
+// ReplicationDestination is an additional remote a replication fans its data out to.
+type ReplicationDestination struct {
+	RemoteID       platform.ID `json:"remoteID"`
+	RemoteBucketID platform.ID `json:"remoteBucketID"`
+}
+
+func validateDestinations(remoteID platform.ID, destinations []ReplicationDestination) error {
+	seen := map[platform.ID]struct{}{remoteID: {}}
+	for _, d := range destinations {
+		if _, ok := seen[d.RemoteID]; ok {
+			return &ErrInvalidReplicationDestination
+		}
+		seen[d.RemoteID] = struct{}{}
+	}
+	return nil
+}
+
+// ReplicationDestinationStatus reports on one of the additional destinations of a replication. Each destination
+// has a queue of its own, so a slow or failing remote doesn't hold up the others.
+type ReplicationDestinationStatus struct {
+	// ReplicationID identifies the replication delivering to the destination, which can be fetched, paused and
+	// flushed on its own.
+	ReplicationID         platform.ID `json:"replicationID" db:"id"`
 	RemoteID              platform.ID `json:"remoteID" db:"remote_id"`
-	LocalBucketID         platform.ID `json:"localBucketID" db:"local_bucket_id"`
 	RemoteBucketID        platform.ID `json:"remoteBucketID" db:"remote_bucket_id"`
-	MaxQueueSizeBytes     int64       `json:"maxQueueSizeBytes" db:"max_queue_size_bytes"`
-	CurrentQueueSizeBytes int64       `json:"currentQueueSizeBytes" db:"current_queue_size_bytes"`
 	LatestResponseCode    *int32      `json:"latestResponseCode,omitempty" db:"latest_response_code"`
 	LatestErrorMessage    *string     `json:"latestErrorMessage,omitempty" db:"latest_error_message"`
-	DropNonRetryableData  bool        `json:"dropNonRetryableData" db:"drop_non_retryable_data"`
+	StatusReason          string      `json:"statusReason,omitempty" db:"-"`
+	CurrentQueueSizeBytes int64       `json:"currentQueueSizeBytes" db:"-"`
+	// FanOutParentID is the replication the destination belongs to.
+	FanOutParentID platform.ID `json:"-" db:"fanout_parent_id"`
+}
+
+// Replication contains all info about a replication that should be returned to users.
+type Replication struct {
+	ID                    platform.ID    `json:"id" db:"id"`
+	OrgID                 platform.ID    `json:"orgID" db:"org_id"`
+	Name                  string         `json:"name" db:"name"`
+	Description           *string        `json:"description,omitempty" db:"description"`
+	RemoteID              platform.ID    `json:"remoteID" db:"remote_id"`
+	LocalBucketID         platform.ID    `json:"localBucketID" db:"local_bucket_id"`
+	RemoteBucketID        platform.ID    `json:"remoteBucketID" db:"remote_bucket_id"`
+	MaxQueueSizeBytes     int64          `json:"maxQueueSizeBytes" db:"max_queue_size_bytes"`
+	CurrentQueueSizeBytes int64          `json:"currentQueueSizeBytes" db:"current_queue_size_bytes"`
+	LatestResponseCode    *int32         `json:"latestResponseCode,omitempty" db:"latest_response_code"`
+	LatestErrorMessage    *string        `json:"latestErrorMessage,omitempty" db:"latest_error_message"`
+	LatestStatusAt        *time.Time     `json:"latestStatusAt,omitempty" db:"latest_status_at"`
+	LatestSuccessAt       *time.Time     `json:"latestSuccessAt,omitempty" db:"latest_success_at"`
+	StatusReason          string         `json:"statusReason,omitempty" db:"-"`
+	DropNonRetryableData  bool           `json:"dropNonRetryableData" db:"drop_non_retryable_data"`
+	EnqueueOnLocalFailure bool           `json:"enqueueOnLocalFailure" db:"enqueue_on_local_failure"`
+	DurabilityTier        DurabilityTier `json:"durabilityTier" db:"durability_tier"`
+	SerializedEnqueue     bool           `json:"serializedEnqueue" db:"serialized_enqueue"`
+	DeliveredBytes        int64          `json:"deliveredBytes" db:"delivered_bytes"`
+	DeliveredPoints       int64          `json:"deliveredPoints" db:"delivered_points"`
+	ConsecutiveFailures   int64          `json:"consecutiveFailures" db:"consecutive_failures"`
+	// DeadLetterBucketID, if set, is the local bucket the lines the remote rejects as non-retryable are recorded
+	// in, instead of being dropped, when DropNonRetryableData is set. DeadLetteredPoints counts the lines recorded.
+	DeadLetterBucketID *platform.ID `json:"deadLetterBucketID,omitempty" db:"dead_letter_bucket_id"`
+	DeadLetteredPoints int64        `json:"deadLetteredPoints" db:"dead_lettered_points"`
+	// RemoteDatabase and RemoteRetentionPolicy are the database and retention policy the replication writes to
+	// on InfluxDB 1.x remotes, in place of the remote bucket. Without a retention policy, the database's default
+	// one is written to.
+	RemoteDatabase        *string `json:"remoteDatabase,omitempty" db:"remote_database"`
+	RemoteRetentionPolicy *string `json:"remoteRetentionPolicy,omitempty" db:"remote_retention_policy"`
+	// Downsample, if set, rolls up the points sent to the remote into one per series per window.
+	Downsample *ReplicationDownsample `json:"downsample,omitempty" db:"downsample"`
+	// RenameRules, if set, rename measurements and fields in the data sent to the remote.
+	RenameRules ReplicationRenameRules `json:"renameRules,omitempty" db:"rename_rules"`
+
+	RemoteBucketDeletedPolicy RemoteBucketDeletedPolicy `json:"remoteBucketDeletedPolicy" db:"remote_bucket_deleted_policy"`
+	// RemoteBucketMissing is set when the remote last reported that the remote bucket doesn't exist.
+	RemoteBucketMissing bool `json:"remoteBucketMissing" db:"remote_bucket_missing"`
+	// OrderedDelivery replications deliver the points of each series in the order they were enqueued,
+	// skipping points already delivered when a send is retried.
+	OrderedDelivery bool `json:"orderedDelivery" db:"ordered_delivery"`
+	// PreserveWriteBoundaries replications deliver the points of each write to the local bucket as exactly
+	// one request to the remote, never splitting a write across requests or combining writes.
+	PreserveWriteBoundaries bool `json:"preserveWriteBoundaries" db:"preserve_write_boundaries"`
+	// FilterExpression, if set, is evaluated against each point written to the local bucket, and only points
+	// it's true for are replicated.
+	FilterExpression *string `json:"filterExpression,omitempty" db:"filter_expression"`
+	// DurableAck replications only acknowledge writes to the local bucket once their points are flushed to
+	// stable storage in the replication queue, trading higher write latency for not losing acknowledged
+	// writes if the host crashes. Failing to enqueue into a DurableAck replication always fails the write.
+	DurableAck bool `json:"durableAck" db:"durable_ack"`
+	// Paused replications keep queueing points, but don't send them to the remote. A replication paused with a
+	// PausedUntil time resumes automatically once it passes.
+	Paused      bool       `json:"paused" db:"paused"`
+	PausedUntil *time.Time `json:"pausedUntil,omitempty" db:"paused_until"`
+	// Watermark, if set, is the time from which live replication is known to have delivered the local bucket's
+	// data to the remote. Backfills skip time ranges at or after it.
+	Watermark *time.Time `json:"watermark,omitempty" db:"watermark"`
+	// NewestDeliveredPointNS is the timestamp of the newest point the remote has received, in nanoseconds.
+	NewestDeliveredPointNS *int64 `json:"-" db:"newest_delivered_point_ns"`
+	// ReplicationLag is how far behind real time the remote is: the time elapsed since the timestamp of the
+	// newest point it has received. It's unset until a point with a timestamp has been delivered.
+	ReplicationLag *time.Duration `json:"replicationLag,omitempty" db:"-"`
+	// ErrorRate is the fraction of the sends to the remote over the recent window which failed. It's unset if
+	// nothing was sent within the window.
+	ErrorRate *float64 `json:"errorRate,omitempty" db:"-"`
+	// EnqueueRatePointsPerSecond and SendRatePointsPerSecond are how many points per second were queued for the
+	// remote and sent to it over the recent window. The queue fills up if the enqueue rate persistently exceeds
+	// the send rate.
+	EnqueueRatePointsPerSecond float64 `json:"enqueueRatePointsPerSecond" db:"-"`
+	SendRatePointsPerSecond    float64 `json:"sendRatePointsPerSecond" db:"-"`
+	// RemainingQueueBytes is how much more data the replication's queue can hold before hitting
+	// MaxQueueSizeBytes. QueueFull is set once there's no room left, and writes to the local bucket are no
+	// longer being queued for the remote.
+	RemainingQueueBytes int64 `json:"remainingQueueBytes" db:"-"`
+	QueueFull           bool  `json:"queueFull" db:"-"`
+	// RemoteWritePrecision is the precision of the timestamps sent to the remote.
+	RemoteWritePrecision WritePrecision `json:"remoteWritePrecision" db:"remote_write_precision"`
+	// FlushIntervalSeconds, if non-zero, is how long queued data is accumulated before being sent to the remote,
+	// so it's sent in fewer, larger writes. Zero sends data as soon as it's queued.
+	FlushIntervalSeconds int64 `json:"flushIntervalSeconds" db:"flush_interval_seconds"`
+	// Compression is the codec queued data is compressed with, and sent to the remote with.
+	Compression ReplicationCompression `json:"compression" db:"compression"`
+	// RemoteCapabilities are what the remote was last detected to support. They're unset until the remote has
+	// been probed.
+	RemoteCapabilities *RemoteCapabilities `json:"remoteCapabilities,omitempty" db:"remote_capabilities"`
+	// RemoteBucketTag, if set, is the tag whose value picks the remote bucket each point is sent to, according to
+	// RemoteBucketMapping. Points without the tag, or with a value missing from the mapping, are sent to
+	// RemoteBucketID. All points still share the replication's queue.
+	RemoteBucketTag     *string             `json:"remoteBucketTag,omitempty" db:"remote_bucket_tag"`
+	RemoteBucketMapping RemoteBucketMapping `json:"remoteBucketMapping,omitempty" db:"remote_bucket_mapping"`
+	// BlockOnFullQueue replications make writes to the local bucket wait for room to free up in a full queue as
+	// the sender drains it, for as long as the write's context allows, instead of dropping or rejecting points.
+	// Writes whose context ends while waiting fail.
+	BlockOnFullQueue bool `json:"blockOnFullQueue" db:"block_on_full_queue"`
+	// TimestampOffsetSeconds shifts the timestamp of every point sent to the remote, i.e. so replicated test data
+	// lands in a different time range than production data on the remote. Points in the local bucket keep their
+	// original timestamps.
+	TimestampOffsetSeconds int64 `json:"timestampOffsetSeconds" db:"timestamp_offset_seconds"`
+	// MeasurementFilter, if set, is a regular expression matched against the measurement of each point written to
+	// the local bucket, and only points whose measurement matches are replicated, i.e. "^(cpu|mem)$". It's applied
+	// together with FilterExpression. Each replication of a bucket is enqueued only the points passing its own
+	// filters, while the local bucket always gets every point.
+	MeasurementFilter *string `json:"measurementFilter,omitempty" db:"measurement_filter"`
+	// QueueUnwritable is set while points can't be enqueued into the replication because its queue directory
+	// can't be written to, i.e. because of its permissions or a read-only mount. Unlike a full queue, it needs
+	// an operator to fix.
+	QueueUnwritable bool `json:"queueUnwritable" db:"-"`
+	// RetryIntervalSeconds, if non-zero, is how long the replication waits before sending again after its remote
+	// fails to accept data. The wait doubles, with jitter, on each consecutive failure up to
+	// MaxRetryIntervalSeconds (or DefaultReplicationMaxRetryIntervalSeconds if that's zero). Zero retries
+	// whenever more data is queued.
+	RetryIntervalSeconds    int64 `json:"retryIntervalSeconds" db:"retry_interval_seconds"`
+	MaxRetryIntervalSeconds int64 `json:"maxRetryIntervalSeconds" db:"max_retry_interval_seconds"`
+	// NextRetryAt is set while the replication is backing off after failing to send, to when it sends again.
+	NextRetryAt *time.Time `json:"nextRetryAt,omitempty" db:"-"`
+	// TagFilter, if set, restricts the replication to the points with all of the given tag values, i.e.
+	// {"region": "us-west"}. It's applied together with MeasurementFilter and FilterExpression.
+	TagFilter ReplicationTagFilter `json:"tagFilter,omitempty" db:"tag_filter"`
+	// Status is the overall health of the replication, derived from its latest response, its queue, and when it
+	// last delivered data to the remote.
+	Status ReplicationHealth `json:"status" db:"-"`
+	// Destinations are the additional remotes the replication fans its data out to, besides RemoteID. Points
+	// written to the local bucket are serialized once and enqueued for every destination.
+	Destinations []ReplicationDestinationStatus `json:"destinations,omitempty" db:"-"`
+	// FanOutParentID is set on the replications delivering to the additional destinations of another
+	// replication, to that replication. They're managed through it, and left out of listings.
+	FanOutParentID *platform.ID `json:"fanOutParentID,omitempty" db:"fanout_parent_id"`
+}
+
+// ReplicationEffectiveConfig is the fully-resolved configuration a replication operates under: the
+// replication's own settings merged with the connection settings of its remote. The remote's API
+// token is redacted.
+type ReplicationEffectiveConfig struct {
+	Replication
+	RemoteURL             string      `json:"remoteURL"`
+	RemoteToken           string      `json:"remoteAPIToken"`
+	RemoteOrgID           platform.ID `json:"remoteOrgID"`
+	AllowInsecureTLS      bool        `json:"allowInsecureTLS"`
+	RemoteCertFingerprint *string     `json:"remoteCertFingerprint,omitempty"`
+	RemoteContentType     *string     `json:"remoteContentType,omitempty"`
+	RemoteWritePath       *string     `json:"remoteWritePath,omitempty"`
+	// RemoteHeaders are the extra headers sent to the remote, with their values redacted.
+	RemoteHeaders RemoteHeaders `json:"remoteHeaders,omitempty"`
+	ProxyURL      *string       `json:"proxyURL,omitempty"`
+	// WriteTimeoutSeconds is the remote's write timeout, or nil if it uses DefaultRemoteWriteTimeoutSeconds.
+	WriteTimeoutSeconds *int32  `json:"writeTimeoutSeconds,omitempty"`
+	ClientCert          *string `json:"clientCert,omitempty"`
+	// ClientKey is redacted if the remote has a client certificate.
+	ClientKey *string `json:"clientKey,omitempty"`
+	CACert    *string `json:"caCert,omitempty"`
 }
 
 // ReplicationListFilter is a selection filter for listing replications.
@@ -39,24 +746,102 @@ type ReplicationListFilter struct {
 	Name          *string
 	RemoteID      *platform.ID
 	LocalBucketID *platform.ID
+
+	// Limit, if non-zero, caps the number of replications listed, starting Offset replications into the
+	// matches. SortBy is one of ReplicationSortFields, and orders the matches in ascending order unless
+	// Descending is set.
+	Limit      int
+	Offset     int
+	SortBy     string
+	Descending bool
+}
+
+// ReplicationSortFields are the fields replications can be listed in order of.
+var ReplicationSortFields = []string{"id", "name", "createdAt", "updatedAt", "remoteID", "localBucketID"}
+
+var ErrInvalidReplicationSortBy = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  fmt.Sprintf("sortBy must be one of %v", ReplicationSortFields),
+}
+
+var ErrInvalidReplicationPage = errors.Error{
+	Code: errors.EInvalid,
+	Msg:  "limit and offset must not be negative",
+}
+
+// OK validates the pagination and sorting of a listing.
+func (f ReplicationListFilter) OK() error {
+	if f.Limit < 0 || f.Offset < 0 {
+		return &ErrInvalidReplicationPage
+	}
+	if f.SortBy == "" {
+		return nil
+	}
+	for _, field := range ReplicationSortFields {
+		if f.SortBy == field {
+			return nil
+		}
+	}
+	return &ErrInvalidReplicationSortBy
+}
+
+// Paginated reports whether only a page of the matching replications is listed.
+func (f ReplicationListFilter) Paginated() bool {
+	return f.Limit > 0 || f.Offset > 0
 }
 
 // Replications is a collection of metadata about replications.
 type Replications struct {
 	Replications []Replication `json:"replications"`
+	// TotalCount is set on paginated listings, to the number of replications matching the filter across all
+	// pages.
+	TotalCount int `json:"totalCount,omitempty"`
 }
 
 // CreateReplicationRequest contains all info needed to establish a new replication
 // to a remote InfluxDB bucket.
 type CreateReplicationRequest struct {
-	OrgID                platform.ID `json:"orgID"`
-	Name                 string      `json:"name"`
-	Description          *string     `json:"description,omitempty"`
-	RemoteID             platform.ID `json:"remoteID"`
-	LocalBucketID        platform.ID `json:"localBucketID"`
-	RemoteBucketID       platform.ID `json:"remoteBucketID"`
-	MaxQueueSizeBytes    int64       `json:"maxQueueSizeBytes,omitempty"`
-	DropNonRetryableData bool        `json:"dropNonRetryableData,omitempty"`
+	OrgID                 platform.ID    `json:"orgID"`
+	Name                  string         `json:"name"`
+	Description           *string        `json:"description,omitempty"`
+	RemoteID              platform.ID    `json:"remoteID"`
+	LocalBucketID         platform.ID    `json:"localBucketID"`
+	RemoteBucketID        platform.ID    `json:"remoteBucketID"`
+	MaxQueueSizeBytes     int64          `json:"maxQueueSizeBytes,omitempty"`
+	DropNonRetryableData  bool           `json:"dropNonRetryableData,omitempty"`
+	EnqueueOnLocalFailure bool           `json:"enqueueOnLocalFailure,omitempty"`
+	DurabilityTier        DurabilityTier `json:"durabilityTier,omitempty"`
+	SerializedEnqueue     bool           `json:"serializedEnqueue,omitempty"`
+
+	RemoteBucketDeletedPolicy RemoteBucketDeletedPolicy `json:"remoteBucketDeletedPolicy,omitempty"`
+	OrderedDelivery           bool                      `json:"orderedDelivery,omitempty"`
+	PreserveWriteBoundaries   bool                      `json:"preserveWriteBoundaries,omitempty"`
+	FilterExpression          *string                   `json:"filterExpression,omitempty"`
+	DurableAck                bool                      `json:"durableAck,omitempty"`
+	RemoteWritePrecision      WritePrecision            `json:"remoteWritePrecision,omitempty"`
+	FlushIntervalSeconds      int64                     `json:"flushIntervalSeconds,omitempty"`
+	Compression               ReplicationCompression    `json:"compression,omitempty"`
+	RemoteBucketTag           *string                   `json:"remoteBucketTag,omitempty"`
+	RemoteBucketMapping       RemoteBucketMapping       `json:"remoteBucketMapping,omitempty"`
+	BlockOnFullQueue          bool                      `json:"blockOnFullQueue,omitempty"`
+	TimestampOffsetSeconds    int64                     `json:"timestampOffsetSeconds,omitempty"`
+	MeasurementFilter         *string                   `json:"measurementFilter,omitempty"`
+	TagFilter                 ReplicationTagFilter      `json:"tagFilter,omitempty"`
+	RetryIntervalSeconds      int64                     `json:"retryIntervalSeconds,omitempty"`
+	MaxRetryIntervalSeconds   int64                     `json:"maxRetryIntervalSeconds,omitempty"`
+	// DeadLetterBucketID, if set, is the local bucket lines rejected by the remote are recorded in instead of
+	// being dropped, when DropNonRetryableData is set.
+	DeadLetterBucketID *platform.ID `json:"deadLetterBucketID,omitempty"`
+	// RemoteDatabase and RemoteRetentionPolicy are written to in place of the remote bucket on InfluxDB 1.x
+	// remotes.
+	RemoteDatabase        *string `json:"remoteDatabase,omitempty"`
+	RemoteRetentionPolicy *string `json:"remoteRetentionPolicy,omitempty"`
+	// Downsample, if set, rolls up the points sent to the remote into one per series per window.
+	Downsample *ReplicationDownsample `json:"downsample,omitempty"`
+	// RenameRules, if set, rename measurements and fields in the data sent to the remote.
+	RenameRules ReplicationRenameRules `json:"renameRules,omitempty"`
+	// AdditionalDestinations are further remotes to fan the replication's data out to, besides RemoteID.
+	AdditionalDestinations []ReplicationDestination `json:"additionalDestinations,omitempty"`
 }
 
 func (r *CreateReplicationRequest) OK() error {
@@ -64,20 +849,219 @@ func (r *CreateReplicationRequest) OK() error {
 		return &ErrMaxQueueSizeTooSmall
 	}
 
+	if r.DurabilityTier != "" {
+		if err := r.DurabilityTier.OK(); err != nil {
+			return err
+		}
+	}
+
+	if r.RemoteBucketDeletedPolicy != "" {
+		if err := r.RemoteBucketDeletedPolicy.OK(); err != nil {
+			return err
+		}
+	}
+
+	if r.RemoteWritePrecision != "" {
+		if err := r.RemoteWritePrecision.OK(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateFlushInterval(r.FlushIntervalSeconds); err != nil {
+		return err
+	}
+
+	if err := validateTimestampOffset(r.TimestampOffsetSeconds); err != nil {
+		return err
+	}
+
+	if err := r.TagFilter.OK(); err != nil {
+		return err
+	}
+
+	if err := validateRetryInterval(r.RetryIntervalSeconds); err != nil {
+		return err
+	}
+	if err := validateRetryInterval(r.MaxRetryIntervalSeconds); err != nil {
+		return err
+	}
+	if r.MaxRetryIntervalSeconds != 0 && r.MaxRetryIntervalSeconds < r.RetryIntervalSeconds {
+		return &ErrMaxRetryIntervalTooSmall
+	}
+
+	if r.Compression != "" {
+		if err := r.Compression.OK(); err != nil {
+			return err
+		}
+	}
+
+	if (r.RemoteBucketTag != nil && *r.RemoteBucketTag != "") != (len(r.RemoteBucketMapping) > 0) {
+		return &ErrInvalidRemoteBucketMapping
+	}
+	if err := r.RemoteBucketMapping.OK(); err != nil {
+		return err
+	}
+
+	if r.DeadLetterBucketID != nil && *r.DeadLetterBucketID == r.LocalBucketID {
+		return &ErrInvalidDeadLetterBucket
+	}
+
+	if r.RemoteRetentionPolicy != nil && *r.RemoteRetentionPolicy != "" && (r.RemoteDatabase == nil || *r.RemoteDatabase == "") {
+		return &ErrInvalidRemoteDatabase
+	}
+
+	if r.Downsample != nil {
+		if err := r.Downsample.OK(); err != nil {
+			return err
+		}
+	}
+
+	if err := r.RenameRules.OK(); err != nil {
+		return err
+	}
+
+	if err := r.ValidateDestinations(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// ValidateDestinations checks that the additional destinations of the request are all distinct remotes.
+func (r *CreateReplicationRequest) ValidateDestinations() error {
+	return validateDestinations(r.RemoteID, r.AdditionalDestinations)
+}
+
 // UpdateReplicationRequest contains a partial update to existing info about a replication.
 type UpdateReplicationRequest struct {
-	Name                 *string      `json:"name,omitempty"`
-	Description          *string      `json:"description,omitempty"`
-	RemoteID             *platform.ID `json:"remoteID,omitempty"`
-	RemoteBucketID       *platform.ID `json:"remoteBucketID,omitempty"`
-	MaxQueueSizeBytes    *int64       `json:"maxQueueSizeBytes,omitempty"`
-	DropNonRetryableData *bool        `json:"dropNonRetryableData,omitempty"`
+	Name                  *string         `json:"name,omitempty"`
+	Description           *string         `json:"description,omitempty"`
+	RemoteID              *platform.ID    `json:"remoteID,omitempty"`
+	RemoteBucketID        *platform.ID    `json:"remoteBucketID,omitempty"`
+	MaxQueueSizeBytes     *int64          `json:"maxQueueSizeBytes,omitempty"`
+	DropNonRetryableData  *bool           `json:"dropNonRetryableData,omitempty"`
+	EnqueueOnLocalFailure *bool           `json:"enqueueOnLocalFailure,omitempty"`
+	DurabilityTier        *DurabilityTier `json:"durabilityTier,omitempty"`
+	SerializedEnqueue     *bool           `json:"serializedEnqueue,omitempty"`
+
+	RemoteBucketDeletedPolicy *RemoteBucketDeletedPolicy `json:"remoteBucketDeletedPolicy,omitempty"`
+	OrderedDelivery           *bool                      `json:"orderedDelivery,omitempty"`
+	PreserveWriteBoundaries   *bool                      `json:"preserveWriteBoundaries,omitempty"`
+	// FilterExpression replaces the filter expression of the replication. An empty expression removes the filter.
+	FilterExpression *string `json:"filterExpression,omitempty"`
+	DurableAck       *bool   `json:"durableAck,omitempty"`
+	// Watermark replaces the watermark of the replication. The zero time removes the watermark.
+	Watermark            *time.Time      `json:"watermark,omitempty"`
+	RemoteWritePrecision *WritePrecision `json:"remoteWritePrecision,omitempty"`
+	FlushIntervalSeconds *int64          `json:"flushIntervalSeconds,omitempty"`
+	// Compression changes the codec data is queued with. Data already queued is sent as it was compressed.
+	Compression *ReplicationCompression `json:"compression,omitempty"`
+	// RemoteBucketTag replaces the tag points are routed to remote buckets by. An empty tag removes the routing,
+	// along with the mapping.
+	RemoteBucketTag *string `json:"remoteBucketTag,omitempty"`
+	// RemoteBucketMapping, if non-nil, replaces the mapping of tag values to remote buckets.
+	RemoteBucketMapping RemoteBucketMapping `json:"remoteBucketMapping,omitempty"`
+	BlockOnFullQueue    *bool               `json:"blockOnFullQueue,omitempty"`
+	// TimestampOffsetSeconds changes the offset applied to timestamps. Data already queued is sent as it was
+	// queued.
+	TimestampOffsetSeconds *int64 `json:"timestampOffsetSeconds,omitempty"`
+	// MeasurementFilter replaces the measurement filter of the replication. An empty filter removes it.
+	MeasurementFilter *string `json:"measurementFilter,omitempty"`
+	// TagFilter, if non-nil, replaces the tag filter of the replication. An empty filter removes it.
+	TagFilter ReplicationTagFilter `json:"tagFilter,omitempty"`
+	// RetryIntervalSeconds and MaxRetryIntervalSeconds change how the replication backs off after failing to send.
+	// The current backoff is kept until the next successful send. A max below the interval is raised to it.
+	RetryIntervalSeconds    *int64 `json:"retryIntervalSeconds,omitempty"`
+	MaxRetryIntervalSeconds *int64 `json:"maxRetryIntervalSeconds,omitempty"`
+	// DeadLetterBucketID replaces the bucket rejected lines are recorded in. RemoveDeadLetterBucket goes back to
+	// dropping them instead.
+	DeadLetterBucketID     *platform.ID `json:"deadLetterBucketID,omitempty"`
+	RemoveDeadLetterBucket bool         `json:"removeDeadLetterBucket,omitempty"`
+	// RemoteDatabase and RemoteRetentionPolicy replace the database and retention policy written to on InfluxDB
+	// 1.x remotes. An empty string removes them.
+	RemoteDatabase        *string `json:"remoteDatabase,omitempty"`
+	RemoteRetentionPolicy *string `json:"remoteRetentionPolicy,omitempty"`
+	// Downsample, if non-nil, replaces the downsampling of the data sent to the remote. The zero value removes it.
+	// Data already queued is downsampled as it's sent.
+	Downsample *ReplicationDownsample `json:"downsample,omitempty"`
+	// RenameRules, if non-nil, replace the rename rules of the replication. Empty rules remove them. Data already
+	// queued is renamed as it's sent.
+	RenameRules ReplicationRenameRules `json:"renameRules,omitempty"`
 }
 
 func (r *UpdateReplicationRequest) OK() error {
+	if r.DeadLetterBucketID != nil && r.RemoveDeadLetterBucket {
+		return &ErrDeadLetterBucketConflict
+	}
+
+	if r.Downsample != nil && !r.Downsample.IsZero() {
+		if err := r.Downsample.OK(); err != nil {
+			return err
+		}
+	}
+
+	if err := r.RenameRules.OK(); err != nil {
+		return err
+	}
+
+	if r.DurabilityTier != nil {
+		if err := r.DurabilityTier.OK(); err != nil {
+			return err
+		}
+	}
+
+	if r.RemoteBucketDeletedPolicy != nil {
+		if err := r.RemoteBucketDeletedPolicy.OK(); err != nil {
+			return err
+		}
+	}
+
+	if r.RemoteWritePrecision != nil {
+		if err := r.RemoteWritePrecision.OK(); err != nil {
+			return err
+		}
+	}
+
+	if r.FlushIntervalSeconds != nil {
+		if err := validateFlushInterval(*r.FlushIntervalSeconds); err != nil {
+			return err
+		}
+	}
+
+	if r.TimestampOffsetSeconds != nil {
+		if err := validateTimestampOffset(*r.TimestampOffsetSeconds); err != nil {
+			return err
+		}
+	}
+
+	if err := r.TagFilter.OK(); err != nil {
+		return err
+	}
+
+	if r.RetryIntervalSeconds != nil {
+		if err := validateRetryInterval(*r.RetryIntervalSeconds); err != nil {
+			return err
+		}
+	}
+	if r.MaxRetryIntervalSeconds != nil {
+		if err := validateRetryInterval(*r.MaxRetryIntervalSeconds); err != nil {
+			return err
+		}
+	}
+
+	if r.Compression != nil {
+		if err := r.Compression.OK(); err != nil {
+			return err
+		}
+	}
+
+	if r.RemoteBucketTag != nil && *r.RemoteBucketTag == "" && len(r.RemoteBucketMapping) > 0 {
+		return &ErrInvalidRemoteBucketMapping
+	}
+	if err := r.RemoteBucketMapping.OK(); err != nil {
+		return err
+	}
+
 	if r.MaxQueueSizeBytes == nil {
 		return nil
 	}
@@ -88,3 +1072,130 @@ func (r *UpdateReplicationRequest) OK() error {
 
 	return nil
 }
+
+// OrgEgressUsage reports the number of bytes an org's replications have sent to remotes
+// during the current quota period.
+type OrgEgressUsage struct {
+	OrgID       platform.ID `json:"orgID" db:"org_id"`
+	PeriodStart time.Time   `json:"periodStart" db:"period_start"`
+	BytesSent   int64       `json:"bytesSent" db:"bytes_sent"`
+	QuotaBytes  *int64      `json:"quotaBytes,omitempty" db:"quota_bytes"`
+	Paused      bool        `json:"paused" db:"-"`
+}
+
+// ReplicationTimeToFull projects when the queue of a replication will reach its max size, based on its recent growth.
+type ReplicationTimeToFull struct {
+	ReplicationID            platform.ID `json:"replicationID"`
+	CurrentQueueSizeBytes    int64       `json:"currentQueueSizeBytes"`
+	MaxQueueSizeBytes        int64       `json:"maxQueueSizeBytes"`
+	GrowthRateBytesPerSecond float64     `json:"growthRateBytesPerSecond"`
+	// Growing is false if the queue is stable or draining, or hasn't been tracked for long enough to tell.
+	// TimeToFull is only set while the queue is growing.
+	Growing    bool           `json:"growing"`
+	TimeToFull *time.Duration `json:"timeToFull,omitempty"`
+}
+
+// ReplicationQueueSizeRecommendation suggests a max queue size for a replication, based on how fast data was
+// recently enqueued into it and the longest recent outage of its remote.
+type ReplicationQueueSizeRecommendation struct {
+	ReplicationID     platform.ID `json:"replicationID"`
+	MaxQueueSizeBytes int64       `json:"maxQueueSizeBytes"`
+	// RecommendedMaxQueueSizeBytes would have buffered everything enqueued during the longest outage, scaled
+	// by Headroom. It's never below the minimum allowed queue size.
+	RecommendedMaxQueueSizeBytes int64         `json:"recommendedMaxQueueSizeBytes"`
+	EnqueueRateBytesPerSecond    float64       `json:"enqueueRateBytesPerSecond"`
+	LongestOutage                time.Duration `json:"longestOutage"`
+	Headroom                     float64       `json:"headroom"`
+}
+
+// ReplicationRoutingDecision explains whether a point written to a local bucket would be enqueued into one of
+// the bucket's replications.
+type ReplicationRoutingDecision struct {
+	ReplicationID platform.ID `json:"replicationID"`
+	Name          string      `json:"name"`
+	Included      bool        `json:"included"`
+	Reason        string      `json:"reason"`
+}
+
+// ReplicationWriteDryRun reports what a write to a local bucket would enqueue into the bucket's replications,
+// without writing or enqueueing anything. Replications which would be enqueued nothing aren't listed.
+type ReplicationWriteDryRun struct {
+	Bytes        int64                       `json:"bytes"`
+	Points       int64                       `json:"points"`
+	Replications []ReplicationDryRunEnqueued `json:"replications"`
+}
+
+// ReplicationDryRunEnqueued is the compressed data a dry-run write would enqueue into one replication.
+type ReplicationDryRunEnqueued struct {
+	ReplicationID platform.ID `json:"replicationID"`
+	Bytes         int64       `json:"bytes"`
+	Points        int64       `json:"points"`
+	Blocks        int         `json:"blocks"`
+}
+
+// ReplicationQueueBreakdown counts the points of each measurement in a sample of the oldest data in a
+// replication's queue. The sample only approximates the proportions of the whole queue.
+type ReplicationQueueBreakdown struct {
+	ReplicationID platform.ID      `json:"replicationID"`
+	SampledBytes  int64            `json:"sampledBytes"`
+	SampledPoints int64            `json:"sampledPoints"`
+	Measurements  map[string]int64 `json:"measurements"`
+}
+
+// ReplicationBucketSummary aggregates the replications of a local bucket.
+type ReplicationBucketSummary struct {
+	LocalBucketID    platform.ID `json:"localBucketID"`
+	ReplicationCount int         `json:"replicationCount"`
+	QueuedBytes      int64       `json:"queuedBytes"`
+	// ErrorCount is the number of replications whose latest write got a non-2xx response.
+	ErrorCount int `json:"errorCount"`
+}
+
+// ReplicationQueuesDiskUsage is the space on disk taken up by replication queues, in total and for each org.
+type ReplicationQueuesDiskUsage struct {
+	TotalBytes int64                 `json:"totalBytes"`
+	ByOrg      map[platform.ID]int64 `json:"byOrg"`
+}
+
+// ReplicationsSchemaVersion is the migration state of the metadata tables holding replications and remotes.
+type ReplicationsSchemaVersion struct {
+	// Version is the version of the latest migration applied to the metadata store.
+	Version int `json:"version"`
+	// LatestVersion is the version of the latest migration known to this release.
+	LatestVersion int `json:"latestVersion"`
+	// PendingMigrations are the names of known migrations which haven't been applied yet.
+	PendingMigrations []string `json:"pendingMigrations,omitempty"`
+}
+
+// Pending reports whether any known migrations haven't been applied yet.
+func (v *ReplicationsSchemaVersion) Pending() bool {
+	return len(v.PendingMigrations) > 0
+}
+
+// BackfillState is the state of a replication backfill job.
+type BackfillState string
+
+const (
+	BackfillRunning   BackfillState = "running"
+	BackfillCompleted BackfillState = "completed"
+	BackfillCanceled  BackfillState = "canceled"
+	BackfillFailed    BackfillState = "failed"
+)
+
+// BackfillProgress reports the progress of a job enqueueing historical data into a replication.
+type BackfillProgress struct {
+	JobID                platform.ID   `json:"jobID"`
+	ReplicationID        platform.ID   `json:"replicationID"`
+	Start                time.Time     `json:"start"`
+	End                  time.Time     `json:"end"`
+	State                BackfillState `json:"state"`
+	ChunksTotal          int           `json:"chunksTotal"`
+	ChunksDone           int           `json:"chunksDone"`
+	PointsEnqueued       int64         `json:"pointsEnqueued"`
+	EstimatedTotalPoints int64         `json:"estimatedTotalPoints"`
+	Error                *string       `json:"error,omitempty"`
+	// ChunksSkipped counts the chunks, included in ChunksDone, which weren't read because they're at or after
+	// the replication's watermark, and so were already delivered by live replication.
+	ChunksSkipped int        `json:"chunksSkipped"`
+	Watermark     *time.Time `json:"watermark,omitempty"`
+}
@@ -0,0 +1,229 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/models"
+	"go.uber.org/zap"
+)
+
+// DefaultBackfillChunkDuration is the width of the time windows a backfill reads and enqueues at once.
+const DefaultBackfillChunkDuration = time.Hour
+
+var errBackfillJobNotFound = &ierrors.Error{
+	Code: ierrors.ENotFound,
+	Msg:  "backfill job not found",
+}
+
+var errBackfillUnsupported = &ierrors.Error{
+	Code: ierrors.ENotImplemented,
+	Msg:  "backfilling replications requires a local points reader",
+}
+
+// PointsReader reads historical points from local storage, to backfill them into a replication.
+type PointsReader interface {
+	// ReadPoints returns all points in the bucket with timestamps in [start, end).
+	ReadPoints(ctx context.Context, orgID, bucketID platform.ID, start, end time.Time) ([]models.Point, error)
+}
+
+type backfillJob struct {
+	mu       sync.RWMutex
+	progress influxdb.BackfillProgress
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func (j *backfillJob) snapshot() influxdb.BackfillProgress {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.progress
+}
+
+func (j *backfillJob) update(fn func(p *influxdb.BackfillProgress)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.progress)
+}
+
+// backfillJobs tracks running and finished backfill jobs by ID.
+type backfillJobs struct {
+	mu   sync.RWMutex
+	jobs map[platform.ID]*backfillJob
+}
+
+func newBackfillJobs() *backfillJobs {
+	return &backfillJobs{jobs: make(map[platform.ID]*backfillJob)}
+}
+
+func (b *backfillJobs) get(id platform.ID) (*backfillJob, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	j, ok := b.jobs[id]
+	return j, ok
+}
+
+func (b *backfillJobs) add(id platform.ID, j *backfillJob) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.jobs[id] = j
+}
+
+// BackfillReplication starts a job which enqueues all locally-stored points in [start, end) from the replication's
+// local bucket into its queue, reading and enqueueing one time-windowed chunk at a time. It returns the ID of the
+// job, which can be used to poll its progress or cancel it. Cancelling ctx also stops the job after the chunk it's
+// working on.
+func (s service) BackfillReplication(ctx context.Context, id platform.ID, start, end time.Time) (platform.ID, error) {
+	if s.backfillReader == nil {
+		return 0, errBackfillUnsupported
+	}
+	if !start.Before(end) {
+		return 0, &ierrors.Error{
+			Code: ierrors.EInvalid,
+			Msg:  "backfill start must be before its end",
+		}
+	}
+
+	q := sq.Select("org_id", "local_bucket_id", "watermark", "compression", "timestamp_offset_seconds").From("replications").Where(sq.Eq{"id": id})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var r influxdb.Replication
+	if err := s.store.DB.GetContext(ctx, &r, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errReplicationNotFound
+		}
+		return 0, err
+	}
+
+	chunk := s.backfillChunkDuration
+	if chunk <= 0 {
+		chunk = DefaultBackfillChunkDuration
+	}
+	chunks := int((end.Sub(start) + chunk - 1) / chunk)
+
+	jobID := s.idGenerator.ID()
+	jobCtx, cancel := context.WithCancel(ctx)
+	job := &backfillJob{
+		progress: influxdb.BackfillProgress{
+			JobID:         jobID,
+			ReplicationID: id,
+			Start:         start,
+			End:           end,
+			State:         influxdb.BackfillRunning,
+			ChunksTotal:   chunks,
+			Watermark:     r.Watermark,
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.backfills.add(jobID, job)
+
+	go func() {
+		defer close(job.done)
+		defer cancel()
+
+		offset := time.Duration(r.TimestampOffsetSeconds) * time.Second
+		err := s.runBackfill(jobCtx, job, r.OrgID, r.LocalBucketID, r.Compression, offset, chunk)
+		job.update(func(p *influxdb.BackfillProgress) {
+			switch {
+			case err == nil:
+				p.State = influxdb.BackfillCompleted
+			case errors.Is(err, context.Canceled):
+				p.State = influxdb.BackfillCanceled
+			default:
+				p.State = influxdb.BackfillFailed
+				msg := err.Error()
+				p.Error = &msg
+			}
+		})
+		if err != nil {
+			s.log.Warn("Replication backfill stopped", zap.String("id", id.String()), zap.String("job_id", jobID.String()), zap.Error(err))
+		}
+	}()
+
+	return jobID, nil
+}
+
+func (s service) runBackfill(ctx context.Context, job *backfillJob, orgID, bucketID platform.ID, compression influxdb.ReplicationCompression, offset, chunk time.Duration) error {
+	p := job.snapshot()
+	for chunkStart := p.Start; chunkStart.Before(p.End); chunkStart = chunkStart.Add(chunk) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Live replication has already delivered everything at or after the watermark, so only the range
+		// before it needs filling.
+		if p.Watermark != nil && !chunkStart.Before(*p.Watermark) {
+			job.update(func(p *influxdb.BackfillProgress) {
+				p.ChunksDone++
+				p.ChunksSkipped++
+			})
+			continue
+		}
+
+		chunkEnd := chunkStart.Add(chunk)
+		if chunkEnd.After(p.End) {
+			chunkEnd = p.End
+		}
+		if p.Watermark != nil && chunkEnd.After(*p.Watermark) {
+			chunkEnd = *p.Watermark
+		}
+
+		points, err := s.backfillReader.ReadPoints(ctx, orgID, bucketID, chunkStart, chunkEnd)
+		if err != nil {
+			return fmt.Errorf("failed to read points for backfill: %w", err)
+		}
+		// Points are enqueued shifted by the replication's timestamp offset, like live writes.
+		if shifted, _ := shiftTimestamps(points, offset); len(shifted) > 0 {
+			if err := serializePoints(shifted, compression, s.maxSerializationBufferBytes, func(data []byte, points int) error {
+				return s.durableQueueManager.EnqueueData(p.ReplicationID, data, points)
+			}); err != nil {
+				return fmt.Errorf("failed to enqueue points for backfill: %w", err)
+			}
+		}
+
+		job.update(func(p *influxdb.BackfillProgress) {
+			p.ChunksDone++
+			p.PointsEnqueued += int64(len(points))
+			p.EstimatedTotalPoints = p.PointsEnqueued * int64(p.ChunksTotal-p.ChunksSkipped) / int64(p.ChunksDone-p.ChunksSkipped)
+		})
+	}
+	return nil
+}
+
+// GetBackfillProgress returns the progress of a backfill job.
+func (s service) GetBackfillProgress(ctx context.Context, jobID platform.ID) (*influxdb.BackfillProgress, error) {
+	job, ok := s.backfills.get(jobID)
+	if !ok {
+		return nil, errBackfillJobNotFound
+	}
+	p := job.snapshot()
+	return &p, nil
+}
+
+// CancelBackfill stops a running backfill job after the chunk it's working on, and waits for it to exit.
+func (s service) CancelBackfill(ctx context.Context, jobID platform.ID) error {
+	job, ok := s.backfills.get(jobID)
+	if !ok {
+		return errBackfillJobNotFound
+	}
+	job.cancel()
+
+	select {
+	case <-job.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,222 @@
+package replications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePointsReader returns the same points for every chunk. Once blockAfter reads have been made,
+// further reads block until their context is cancelled. The end of each chunk read is sent to ends, if set.
+type fakePointsReader struct {
+	points     []models.Point
+	blockAfter int
+	reads      chan time.Time
+	ends       chan time.Time
+	n          int
+}
+
+func (r *fakePointsReader) ReadPoints(ctx context.Context, _, _ platform.ID, start, end time.Time) ([]models.Point, error) {
+	r.n++
+	r.reads <- start
+	if r.ends != nil {
+		r.ends <- end
+	}
+	if r.blockAfter > 0 && r.n > r.blockAfter {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return r.points, nil
+}
+
+func setupBackfill(t *testing.T, reader *fakePointsReader) (*service, mocks, func(t *testing.T)) {
+	t.Helper()
+
+	svc, mocks, clean := newTestService(t)
+	svc.backfillReader = reader
+	svc.backfillChunkDuration = time.Hour
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	return svc, mocks, clean
+}
+
+func TestBackfillReplication(t *testing.T) {
+	t.Parallel()
+
+	reader := &fakePointsReader{
+		points: mustParsePoints(t, "cpu value=1 1\ncpu value=2 2"),
+		reads:  make(chan time.Time, 10),
+	}
+	svc, mocks, clean := setupBackfill(t, reader)
+	defer clean(t)
+
+	start := time.Unix(0, 0)
+	end := start.Add(3*time.Hour + time.Minute)
+
+	_, err := svc.BackfillReplication(ctx, initID+1, start, end)
+	require.Equal(t, errReplicationNotFound, err)
+
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil).Times(4)
+	jobID, err := svc.BackfillReplication(ctx, initID, start, end)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		p, err := svc.GetBackfillProgress(ctx, jobID)
+		require.NoError(t, err)
+		return p.State != influxdb.BackfillRunning
+	}, time.Second, 10*time.Millisecond)
+
+	p, err := svc.GetBackfillProgress(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, influxdb.BackfillProgress{
+		JobID:                jobID,
+		ReplicationID:        initID,
+		Start:                start,
+		End:                  end,
+		State:                influxdb.BackfillCompleted,
+		ChunksTotal:          4,
+		ChunksDone:           4,
+		PointsEnqueued:       8,
+		EstimatedTotalPoints: 8,
+	}, *p)
+
+	// Each chunk covered the next hour of the range.
+	close(reader.reads)
+	var starts []time.Time
+	for s := range reader.reads {
+		starts = append(starts, s)
+	}
+	require.Equal(t, []time.Time{start, start.Add(time.Hour), start.Add(2 * time.Hour), start.Add(3 * time.Hour)}, starts)
+
+	_, err = svc.GetBackfillProgress(ctx, jobID+1)
+	require.Equal(t, errBackfillJobNotFound, err)
+}
+
+func TestBackfillReplication_Watermark(t *testing.T) {
+	t.Parallel()
+
+	reader := &fakePointsReader{
+		points: mustParsePoints(t, "cpu value=1 1\ncpu value=2 2"),
+		reads:  make(chan time.Time, 10),
+		ends:   make(chan time.Time, 10),
+	}
+	svc, mocks, clean := setupBackfill(t, reader)
+	defer clean(t)
+
+	start := time.Unix(0, 0).UTC()
+	end := start.Add(3*time.Hour + time.Minute)
+	watermark := start.Add(90 * time.Minute)
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	r, err := svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{Watermark: &watermark})
+	require.NoError(t, err)
+	require.NotNil(t, r.Watermark)
+	require.True(t, watermark.Equal(*r.Watermark))
+
+	// Only the chunks before the watermark are read and enqueued.
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	jobID, err := svc.BackfillReplication(ctx, initID, start, end)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		p, err := svc.GetBackfillProgress(ctx, jobID)
+		require.NoError(t, err)
+		return p.State != influxdb.BackfillRunning
+	}, time.Second, 10*time.Millisecond)
+
+	p, err := svc.GetBackfillProgress(ctx, jobID)
+	require.NoError(t, err)
+	require.NotNil(t, p.Watermark)
+	require.True(t, watermark.Equal(*p.Watermark))
+	p.Watermark = nil
+	require.Equal(t, influxdb.BackfillProgress{
+		JobID:                jobID,
+		ReplicationID:        initID,
+		Start:                start,
+		End:                  end,
+		State:                influxdb.BackfillCompleted,
+		ChunksTotal:          4,
+		ChunksDone:           4,
+		ChunksSkipped:        2,
+		PointsEnqueued:       4,
+		EstimatedTotalPoints: 4,
+	}, *p)
+
+	// The chunk straddling the watermark stops at it.
+	close(reader.reads)
+	close(reader.ends)
+	var starts, ends []time.Time
+	for s := range reader.reads {
+		starts = append(starts, s)
+	}
+	for e := range reader.ends {
+		ends = append(ends, e)
+	}
+	require.Equal(t, []time.Time{start, start.Add(time.Hour)}, starts)
+	require.Len(t, ends, 2)
+	require.Equal(t, start.Add(time.Hour), ends[0])
+	require.True(t, watermark.Equal(ends[1]))
+
+	// Removing the watermark backfills the whole range again.
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{Watermark: &time.Time{}})
+	require.NoError(t, err)
+	require.Nil(t, r.Watermark)
+}
+
+func TestBackfillReplication_Cancel(t *testing.T) {
+	t.Parallel()
+
+	reader := &fakePointsReader{
+		points:     mustParsePoints(t, "cpu value=1 1\ncpu value=2 2"),
+		blockAfter: 2,
+		reads:      make(chan time.Time, 10),
+	}
+	svc, mocks, clean := setupBackfill(t, reader)
+	defer clean(t)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	start := time.Unix(0, 0)
+	jobID, err := svc.BackfillReplication(jobCtx, initID, start, start.Add(10*time.Hour))
+	require.NoError(t, err)
+
+	// Wait for the job to block on its third chunk, and check the progress so far.
+	for i := 0; i < 3; i++ {
+		<-reader.reads
+	}
+	p, err := svc.GetBackfillProgress(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, influxdb.BackfillRunning, p.State)
+	require.Equal(t, 2, p.ChunksDone)
+	require.Equal(t, int64(4), p.PointsEnqueued)
+	require.Equal(t, int64(20), p.EstimatedTotalPoints)
+
+	// Cancelling stops the job where it is.
+	cancel()
+	require.Eventually(t, func() bool {
+		p, err := svc.GetBackfillProgress(ctx, jobID)
+		require.NoError(t, err)
+		return p.State == influxdb.BackfillCanceled
+	}, time.Second, 10*time.Millisecond)
+
+	p, err = svc.GetBackfillProgress(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, 2, p.ChunksDone)
+	require.Nil(t, p.Error)
+}
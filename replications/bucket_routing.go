@@ -0,0 +1,31 @@
+package replications
+
+import "github.com/influxdata/influxdb/v2/models"
+
+// groupPointsByTag returns the points grouped by their value of a tag, in the order each value first appears,
+// so the points routed to each remote bucket form a contiguous sub-batch. Points are otherwise kept in order, so
+// the points of each series stay in the order they were written. The given slice isn't modified.
+func groupPointsByTag(points []models.Point, tag string) []models.Point {
+	key := []byte(tag)
+	index := make(map[string]int)
+	var groups [][]models.Point
+	for _, p := range points {
+		value := string(p.Tags().Get(key))
+		i, ok := index[value]
+		if !ok {
+			i = len(groups)
+			index[value] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p)
+	}
+	if len(groups) <= 1 {
+		return points
+	}
+
+	grouped := make([]models.Point, 0, len(points))
+	for _, g := range groups {
+		grouped = append(grouped, g...)
+	}
+	return grouped
+}
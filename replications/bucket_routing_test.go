@@ -0,0 +1,105 @@
+package replications
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupPointsByTag(t *testing.T) {
+	t.Parallel()
+
+	points := mustParsePoints(t, "cpu,region=eu value=1 1\ncpu,region=us value=2 2\ncpu value=3 3\ncpu,region=eu value=4 4\ncpu,region=us value=5 5")
+	grouped := groupPointsByTag(points, "region")
+
+	var lines []string
+	for _, p := range grouped {
+		lines = append(lines, p.String())
+	}
+	require.Equal(t, []string{
+		"cpu,region=eu value=1 1",
+		"cpu,region=eu value=4 4",
+		"cpu,region=us value=2 2",
+		"cpu,region=us value=5 5",
+		"cpu value=3 3",
+	}, lines)
+	// The written points are left as they were.
+	require.Equal(t, "cpu,region=us value=2 2", points[1].String())
+
+	// Points which are already grouped are returned as-is.
+	require.Equal(t, points[:1], groupPointsByTag(points[:1], "region"))
+}
+
+func TestWritePoints_RemoteBucketRouting(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	tag := "region"
+	req := createReq
+	req.RemoteBucketTag = &tag
+	req.RemoteBucketMapping = influxdb.RemoteBucketMapping{"us": platform.ID(301), "eu": platform.ID(302)}
+
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), req.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, req.MaxQueueSizeBytes)
+	r, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, &tag, r.RemoteBucketTag)
+	require.Equal(t, req.RemoteBucketMapping, r.RemoteBucketMapping)
+
+	// The sender is given the mapping.
+	conf, err := svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, &tag, conf.RemoteBucketTag)
+	require.Equal(t, req.RemoteBucketMapping, conf.RemoteBucketMapping)
+
+	// All points share the replication's queue, with the points of each remote bucket in a contiguous sub-batch.
+	points := mustParsePoints(t, "cpu,region=eu value=1 1\ncpu,region=us value=2 2\ncpu value=3 3\ncpu,region=eu value=4 4")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), req.OrgID, req.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+		require.Equal(t, "cpu,region=eu value=1 1\ncpu,region=eu value=4 4\ncpu,region=us value=2 2\ncpu value=3 3\n", string(gunzip(t, data)))
+		return nil
+	})
+	require.NoError(t, svc.WritePoints(ctx, req.OrgID, req.LocalBucketID, points))
+
+	// Clearing the tag removes the routing.
+	empty := ""
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{RemoteBucketTag: &empty})
+	require.NoError(t, err)
+	require.Nil(t, r.RemoteBucketTag)
+	require.Nil(t, r.RemoteBucketMapping)
+}
+
+func TestRemoteBucketMapping_Validation(t *testing.T) {
+	t.Parallel()
+
+	tag, empty := "region", ""
+	mapping := influxdb.RemoteBucketMapping{"us": platform.ID(301)}
+
+	valid := createReq
+	valid.RemoteBucketTag, valid.RemoteBucketMapping = &tag, mapping
+	require.NoError(t, valid.OK())
+
+	noMapping := createReq
+	noMapping.RemoteBucketTag = &tag
+	require.Error(t, noMapping.OK())
+
+	noTag := createReq
+	noTag.RemoteBucketMapping = mapping
+	require.Error(t, noTag.OK())
+
+	badID := valid
+	badID.RemoteBucketMapping = influxdb.RemoteBucketMapping{"us": 0}
+	require.Error(t, badID.OK())
+
+	require.Error(t, (&influxdb.UpdateReplicationRequest{RemoteBucketTag: &empty, RemoteBucketMapping: mapping}).OK())
+	require.NoError(t, (&influxdb.UpdateReplicationRequest{RemoteBucketMapping: mapping}).OK())
+}
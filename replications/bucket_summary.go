@@ -0,0 +1,66 @@
+package replications
+
+import (
+	"context"
+	"sort"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+)
+
+// SummarizeReplicationsByBucket returns, for each local bucket of the org with replications, the number of
+// replications, the total size of their queues and how many of them are in an error state, ordered by bucket ID.
+func (s service) SummarizeReplicationsByBucket(ctx context.Context, orgID platform.ID) ([]influxdb.ReplicationBucketSummary, error) {
+	q := sq.Select("id", "local_bucket_id", "latest_response_code").
+		From("replications").
+		Where(sq.Eq{"org_id": orgID})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rs []struct {
+		ID                 platform.ID `db:"id"`
+		LocalBucketID      platform.ID `db:"local_bucket_id"`
+		LatestResponseCode *int32      `db:"latest_response_code"`
+	}
+	if err := s.store.DB.SelectContext(ctx, &rs, query, args...); err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return []influxdb.ReplicationBucketSummary{}, nil
+	}
+
+	ids := make([]platform.ID, len(rs))
+	for i := range rs {
+		ids[i] = rs[i].ID
+	}
+	sizes, err := s.durableQueueManager.CurrentQueueSizes(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byBucket := make(map[platform.ID]*influxdb.ReplicationBucketSummary)
+	for _, r := range rs {
+		summary, ok := byBucket[r.LocalBucketID]
+		if !ok {
+			summary = &influxdb.ReplicationBucketSummary{LocalBucketID: r.LocalBucketID}
+			byBucket[r.LocalBucketID] = summary
+		}
+		summary.ReplicationCount++
+		summary.QueuedBytes += sizes[r.ID]
+		if code := r.LatestResponseCode; code != nil && (*code < 200 || *code >= 300) {
+			summary.ErrorCount++
+		}
+	}
+
+	summaries := make([]influxdb.ReplicationBucketSummary, 0, len(byBucket))
+	for _, summary := range byBucket {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].LocalBucketID < summaries[j].LocalBucketID
+	})
+	return summaries, nil
+}
@@ -0,0 +1,56 @@
+package replications
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeReplicationsByBucket(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	summaries, err := svc.SummarizeReplicationsByBucket(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+
+	// Two replications of one bucket, and one of another.
+	otherBucketID := createReq.LocalBucketID + 1
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock().Times(3)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(3)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), gomock.Any()).Return(&influxdb.Bucket{}, nil).Times(3)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), createReq.MaxQueueSizeBytes).Times(3)
+	for i, bucketID := range []platform.ID{createReq.LocalBucketID, createReq.LocalBucketID, otherBucketID} {
+		req := createReq
+		req.Name = string(rune('a' + i))
+		req.LocalBucketID = bucketID
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+	ids := []platform.ID{initID, initID + 1, initID + 2}
+
+	// The first replication's latest write succeeded, while the others' failed.
+	for id, code := range map[platform.ID]int{ids[0]: 204, ids[1]: 500, ids[2]: 401} {
+		_, err := svc.store.DB.Exec("UPDATE replications SET latest_response_code = ? WHERE id = ?", code, id)
+		require.NoError(t, err)
+	}
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes(ids).Return(map[platform.ID]int64{ids[0]: 100, ids[1]: 200, ids[2]: 400}, nil)
+	summaries, err = svc.SummarizeReplicationsByBucket(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.Equal(t, []influxdb.ReplicationBucketSummary{
+		{LocalBucketID: createReq.LocalBucketID, ReplicationCount: 2, QueuedBytes: 300, ErrorCount: 1},
+		{LocalBucketID: otherBucketID, ReplicationCount: 1, QueuedBytes: 400, ErrorCount: 1},
+	}, summaries)
+
+	// Other orgs' replications aren't counted.
+	summaries, err = svc.SummarizeReplicationsByBucket(ctx, replication.OrgID+1)
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+}
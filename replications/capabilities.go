@@ -0,0 +1,150 @@
+package replications
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/influxdata/influxdb/v2/sqlite"
+	"go.uber.org/zap"
+)
+
+const defaultCapabilityProbeInterval = time.Hour
+
+// capabilityProber detects what the remote of a replication supports.
+type capabilityProber func(ctx context.Context, conf *internal.ReplicationHTTPConfig) (*influxdb.RemoteCapabilities, error)
+
+// capabilityDetector probes the remotes of replications for their capabilities, caching them on each replication
+// for the sender to adapt to. Replications are probed once their capabilities are older than the interval, or if
+// they've never been probed.
+type capabilityDetector struct {
+	store      *sqlite.SqlStore
+	probe      capabilityProber
+	configs    internal.HTTPConfigFunc
+	invalidate func(replicationID platform.ID)
+	interval   time.Duration
+	now        func() time.Time
+	log        *zap.Logger
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newCapabilityDetector(store *sqlite.SqlStore, probe capabilityProber, configs internal.HTTPConfigFunc, interval time.Duration, log *zap.Logger) *capabilityDetector {
+	if interval <= 0 {
+		interval = defaultCapabilityProbeInterval
+	}
+	return &capabilityDetector{
+		store:    store,
+		probe:    probe,
+		configs:  configs,
+		interval: interval,
+		now:      time.Now,
+		log:      log,
+	}
+}
+
+// start probes the replications due to be probed in the background, immediately and then periodically until
+// stop is called.
+func (d *capabilityDetector) start() {
+	d.done = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer cancel()
+
+		go func() {
+			<-d.done
+			cancel()
+		}()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			d.probeDue(ctx)
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (d *capabilityDetector) stop() {
+	if d.done == nil {
+		return
+	}
+	close(d.done)
+	d.wg.Wait()
+	d.done = nil
+}
+
+// probeDue probes every replication whose capabilities are missing or older than the probe interval.
+func (d *capabilityDetector) probeDue(ctx context.Context) {
+	query, args, err := sq.Select("id", "remote_capabilities").From("replications").ToSql()
+	if err != nil {
+		d.log.Warn("Failed to list replications to probe", zap.Error(err))
+		return
+	}
+	var rs []influxdb.Replication
+	if err := d.store.DB.SelectContext(ctx, &rs, query, args...); err != nil {
+		d.log.Warn("Failed to list replications to probe", zap.Error(err))
+		return
+	}
+
+	now := d.now()
+	for _, r := range rs {
+		if ctx.Err() != nil {
+			return
+		}
+		if r.RemoteCapabilities != nil && now.Sub(r.RemoteCapabilities.DetectedAt) < d.interval {
+			continue
+		}
+		conf, err := d.configs(ctx, r.ID)
+		if err != nil {
+			d.log.Warn("Failed to look up remote of replication to probe", zap.String("id", r.ID.String()), zap.Error(err))
+			continue
+		}
+		d.refresh(ctx, r.ID, conf)
+	}
+}
+
+// refresh probes the remote of a replication, caching its capabilities. Failed probes are logged, and leave the
+// previously detected capabilities in place. It's a no-op on a nil detector.
+func (d *capabilityDetector) refresh(ctx context.Context, id platform.ID, conf *internal.ReplicationHTTPConfig) {
+	if d == nil {
+		return
+	}
+
+	caps, err := d.probe(ctx, conf)
+	if err != nil {
+		d.log.Warn("Failed to probe capabilities of replication remote", zap.String("id", id.String()), zap.Error(err))
+		return
+	}
+
+	query, args, err := sq.Update("replications").
+		Set("remote_capabilities", caps).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		d.log.Warn("Failed to record capabilities of replication remote", zap.String("id", id.String()), zap.Error(err))
+		return
+	}
+
+	d.store.Mu.Lock()
+	_, err = d.store.DB.ExecContext(ctx, query, args...)
+	d.store.Mu.Unlock()
+	if err != nil {
+		d.log.Warn("Failed to record capabilities of replication remote", zap.String("id", id.String()), zap.Error(err))
+		return
+	}
+	if d.invalidate != nil {
+		d.invalidate(id)
+	}
+}
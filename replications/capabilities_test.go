@@ -0,0 +1,103 @@
+package replications
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestCapabilityDetector(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).AnyTimes()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	detected := influxdb.RemoteCapabilities{
+		Version:    "v2.1.1",
+		APIVersion: 2,
+		Encodings:  []influxdb.ReplicationCompression{influxdb.CompressionGzip},
+		Endpoints:  []string{"/health", "/ready"},
+		DetectedAt: now,
+	}
+	var probes int
+	var probeErr error
+	probe := func(context.Context, *internal.ReplicationHTTPConfig) (*influxdb.RemoteCapabilities, error) {
+		probes++
+		if probeErr != nil {
+			return nil, probeErr
+		}
+		caps := detected
+		return &caps, nil
+	}
+	svc.capabilities = newCapabilityDetector(svc.store, probe, svc.getFullHTTPConfig, time.Hour, zaptest.NewLogger(t))
+	svc.capabilities.now = func() time.Time { return now }
+
+	// Replications are unprobed until the detector runs.
+	r, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Nil(t, r.RemoteCapabilities)
+
+	svc.capabilities.probeDue(ctx)
+	require.Equal(t, 1, probes)
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.NotNil(t, r.RemoteCapabilities)
+	require.Equal(t, detected, *r.RemoteCapabilities)
+
+	// The sender sees the cached capabilities.
+	conf, err := svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, detected, *conf.RemoteCapabilities)
+
+	// Cached capabilities aren't re-probed until they're older than the interval.
+	svc.capabilities.probeDue(ctx)
+	require.Equal(t, 1, probes)
+	now = now.Add(time.Hour)
+	detected.Encodings = append(detected.Encodings, influxdb.CompressionZstd)
+	detected.DetectedAt = now
+	svc.capabilities.probeDue(ctx)
+	require.Equal(t, 2, probes)
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.True(t, r.RemoteCapabilities.AcceptsEncoding(influxdb.CompressionZstd))
+
+	// Failed probes keep the capabilities detected before.
+	now = now.Add(time.Hour)
+	probeErr = errors.New("dial tcp: connection refused")
+	svc.capabilities.probeDue(ctx)
+	require.Equal(t, 3, probes)
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, detected, *r.RemoteCapabilities)
+
+	// Validating the replication re-probes its remote.
+	probeErr = nil
+	mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).Return(nil)
+	require.NoError(t, svc.ValidateReplication(ctx, initID))
+	require.Equal(t, 4, probes)
+
+	// Switching the replication to another remote discards the capabilities of the old one.
+	otherRemote := replication.RemoteID + 1
+	insertRemote(t, svc.store, otherRemote)
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{RemoteID: &otherRemote})
+	require.NoError(t, err)
+	require.Nil(t, r.RemoteCapabilities)
+}
@@ -0,0 +1,136 @@
+package replications
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+// defaultCoalesceMaxPoints is the number of points a coalesced block is enqueued at, unless configured otherwise.
+const defaultCoalesceMaxPoints = 5000
+
+// enqueueCoalescer merges the points of small writes to the same bucket arriving within a short window, so they're
+// serialized and enqueued into the bucket's replications as a single block instead of one block per write. Each
+// write waits for the window to close and the merged block to be enqueued, adding up to the window to its
+// latency, and gets the outcome of the merged enqueue.
+type enqueueCoalescer struct {
+	window time.Duration
+	// maxPoints caps the number of points merged into a block. A batch reaching it is enqueued immediately.
+	maxPoints int
+	enqueue   func(targets []replicationTarget, points []models.Point) error
+
+	mu      sync.Mutex
+	pending map[string]*coalescedBatch
+}
+
+// coalescedBatch is the points of the writes merged within one window.
+type coalescedBatch struct {
+	targets []replicationTarget
+	points  []models.Point
+	timer   *time.Timer
+	done    chan struct{}
+	err     error
+}
+
+func newEnqueueCoalescer(window time.Duration, maxPoints int, enqueue func([]replicationTarget, []models.Point) error) *enqueueCoalescer {
+	return &enqueueCoalescer{
+		window:    window,
+		maxPoints: maxPoints,
+		enqueue:   enqueue,
+		pending:   make(map[string]*coalescedBatch),
+	}
+}
+
+// canCoalesce reports whether a write of n points into the given replications can be merged with other writes.
+// Replications preserving write boundaries must get each write as its own block, and serialized-enqueue ones
+// order blocks per write. Replications enqueueing through local failures need the outcome of each write's local
+// write to decide what's enqueued, and ones blocking on a full queue wait for as long as each write's context allows.
+func (c *enqueueCoalescer) canCoalesce(targets []replicationTarget, n int) bool {
+	if c == nil || n > c.maxPoints {
+		return false
+	}
+	for _, t := range targets {
+		if t.PreserveWriteBoundaries || t.SerializedEnqueue || t.EnqueueOnLocalFailure || t.BlockOnFullQueue {
+			return false
+		}
+	}
+	return true
+}
+
+// write adds the points of a write to the batch being merged for its bucket, and waits for the batch to be
+// enqueued. Writes are only merged with writes into the same set of replications.
+func (c *enqueueCoalescer) write(bucketID platform.ID, targets []replicationTarget, points []models.Point) error {
+	key := coalesceKey(bucketID, targets)
+
+	c.mu.Lock()
+	b, ok := c.pending[key]
+	if !ok {
+		b = &coalescedBatch{targets: targets, done: make(chan struct{})}
+		c.pending[key] = b
+		b.timer = time.AfterFunc(c.window, func() { c.flush(key, b) })
+	}
+	b.points = append(b.points, points...)
+	full := len(b.points) >= c.maxPoints
+	c.mu.Unlock()
+
+	if full && b.timer.Stop() {
+		c.flush(key, b)
+	}
+	<-b.done
+	return b.err
+}
+
+// flush stops merging writes into a batch and enqueues it.
+func (c *enqueueCoalescer) flush(key string, b *coalescedBatch) {
+	c.mu.Lock()
+	if c.pending[key] == b {
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+
+	b.err = c.enqueue(b.targets, b.points)
+	close(b.done)
+}
+
+func coalesceKey(bucketID platform.ID, targets []replicationTarget) string {
+	var sb strings.Builder
+	sb.WriteString(bucketID.String())
+	for _, t := range targets {
+		sb.WriteByte(',')
+		sb.WriteString(t.ID.String())
+	}
+	return sb.String()
+}
+
+// enqueueCoalesced serializes the points of coalesced writes and enqueues them into their replications, the
+// same way WritePoints does for a single write.
+func (s service) enqueueCoalesced(targets []replicationTarget, points []models.Point) error {
+	// No single write's context covers the merged block, since each write may return before the others.
+	ctx := context.Background()
+	var enqueueFailed *PartialEnqueueError
+	for _, group := range s.groupTargetsByFilter(targets) {
+		groupPoints := s.shiftGroupTimestamps(group, group.filter.filter(points))
+		if len(groupPoints) == 0 {
+			continue
+		}
+		if group.routeTag != "" {
+			groupPoints = groupPointsByTag(groupPoints, group.routeTag)
+		}
+		err := serializePoints(groupPoints, group.compression, s.maxSerializationBufferBytes, func(data []byte, n int) error {
+			return s.enqueue(ctx, group.targets, nil, data, n)
+		})
+		if pe, ok := err.(*PartialEnqueueError); ok {
+			enqueueFailed = enqueueFailed.add(pe)
+		} else if err != nil {
+			return err
+		}
+	}
+	if enqueueFailed != nil {
+		return errEnqueueFailed(enqueueFailed)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package replications
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePoints_Coalescing(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, req influxdb.CreateReplicationRequest) (*service, mocks, func(t *testing.T)) {
+		svc, mocks, clean := newTestService(t)
+		svc.coalescer = newEnqueueCoalescer(50*time.Millisecond, 100, svc.enqueueCoalesced)
+
+		insertRemote(t, svc.store, req.RemoteID)
+		mocks.bucketSvc.EXPECT().RLock()
+		mocks.bucketSvc.EXPECT().RUnlock()
+		mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), req.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+		mocks.durableQueueManager.EXPECT().InitializeQueue(initID, req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+		return svc, mocks, clean
+	}
+
+	writeConcurrently := func(t *testing.T, svc *service, writes [][]models.Point) {
+		var wg sync.WaitGroup
+		wg.Add(len(writes))
+		for _, points := range writes {
+			go func(points []models.Point) {
+				defer wg.Done()
+				require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+			}(points)
+		}
+		wg.Wait()
+	}
+
+	writes := make([][]models.Point, 10)
+	var want []string
+	for i := range writes {
+		line := fmt.Sprintf("cpu,host=%d value=%d 1000", i, i)
+		writes[i] = mustParsePoints(t, line)
+		want = append(want, line)
+	}
+
+	t.Run("merges concurrent writes", func(t *testing.T) {
+		svc, mocks, clean := setup(t, createReq)
+		defer clean(t)
+
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, gomock.Any()).Times(len(writes))
+		var enqueued [][]byte
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			enqueued = append(enqueued, append([]byte(nil), data...))
+			return nil
+		})
+
+		writeConcurrently(t, svc, writes)
+
+		require.Len(t, enqueued, 1)
+		got := strings.Split(strings.TrimSpace(string(gunzip(t, enqueued[0]))), "\n")
+		sort.Strings(got)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("flushes full batches early", func(t *testing.T) {
+		svc, mocks, clean := setup(t, createReq)
+		defer clean(t)
+		svc.coalescer = newEnqueueCoalescer(time.Hour, 2, svc.enqueueCoalesced)
+
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, gomock.Any()).Times(2)
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil)
+
+		writeConcurrently(t, svc, writes[:2])
+	})
+
+	t.Run("preserved write boundaries aren't coalesced", func(t *testing.T) {
+		req := createReq
+		req.PreserveWriteBoundaries = true
+		svc, mocks, clean := setup(t, req)
+		defer clean(t)
+
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, gomock.Any()).Times(len(writes))
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil).Times(len(writes))
+
+		writeConcurrently(t, svc, writes)
+	})
+}
@@ -0,0 +1,108 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/models"
+	"go.uber.org/zap"
+)
+
+func errDeadLetterBucketNotFound(id platform.ID, cause error) error {
+	return &ierrors.Error{
+		Code: ierrors.EInvalid,
+		Msg:  fmt.Sprintf("dead-letter bucket %q not found", id),
+		Err:  cause,
+	}
+}
+
+// checkDeadLetterBucket checks that the dead-letter bucket of a replication exists in the replication's org.
+// The caller must hold the bucket service's read lock.
+func (s service) checkDeadLetterBucket(ctx context.Context, orgID, bucketID platform.ID) error {
+	b, err := s.bucketService.FindBucketByID(ctx, bucketID)
+	if err != nil {
+		return errDeadLetterBucketNotFound(bucketID, err)
+	}
+	if b.OrgID != orgID {
+		return errDeadLetterBucketNotFound(bucketID, nil)
+	}
+	return nil
+}
+
+// checkUpdatedDeadLetterBucket checks the dead-letter bucket an existing replication is being updated to use.
+// The caller must hold the bucket service's read lock.
+func (s service) checkUpdatedDeadLetterBucket(ctx context.Context, id, bucketID platform.ID) error {
+	query, args, err := sq.Select("org_id", "local_bucket_id").From("replications").Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return err
+	}
+	var r influxdb.Replication
+	if err := s.store.DB.GetContext(ctx, &r, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errReplicationNotFound
+		}
+		return err
+	}
+	if bucketID == r.LocalBucketID {
+		return &influxdb.ErrInvalidDeadLetterBucket
+	}
+	return s.checkDeadLetterBucket(ctx, r.OrgID, bucketID)
+}
+
+// deadLetterMeasurement is the measurement lines rejected by remotes are recorded under in dead-letter buckets.
+const deadLetterMeasurement = "replication_dead_letter"
+
+// writeDeadLetter records lines rejected by the remote of a replication in its dead-letter bucket, and counts them
+// against the replication. Remotes mostly reject lines they can't parse, so each line is recorded verbatim, as the
+// "line" field of a point tagged with the replication's ID, along with the remote's reason for rejecting it.
+func (s service) writeDeadLetter(ctx context.Context, replicationID, bucketID platform.ID, lines []string, reason string) (int, error) {
+	now := time.Now()
+	tags := models.NewTags(map[string]string{"replicationID": replicationID.String()})
+	points := make([]models.Point, 0, len(lines))
+	for i, line := range lines {
+		// Each line gets its own timestamp, so lines rejected together don't overwrite each other.
+		p, err := models.NewPoint(deadLetterMeasurement, tags, models.Fields{"line": line, "reason": reason}, now.Add(time.Duration(i)))
+		if err != nil {
+			return 0, err
+		}
+		points = append(points, p)
+	}
+
+	query, args, err := sq.Select("org_id").From("replications").Where(sq.Eq{"id": replicationID}).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var orgID platform.ID
+	if err := s.store.DB.GetContext(ctx, &orgID, query, args...); err != nil {
+		return 0, err
+	}
+	if err := s.localWriter.WritePoints(ctx, orgID, bucketID, points); err != nil {
+		return 0, err
+	}
+
+	if err := s.countDeadLettered(ctx, replicationID, len(points)); err != nil {
+		s.log.Warn("Failed to count dead-lettered points", zap.String("id", replicationID.String()), zap.Error(err))
+	}
+	return len(points), nil
+}
+
+func (s service) countDeadLettered(ctx context.Context, replicationID platform.ID, n int) error {
+	s.store.Mu.Lock()
+	defer s.store.Mu.Unlock()
+
+	query, args, err := sq.Update("replications").
+		Set("dead_lettered_points", sq.Expr("dead_lettered_points + ?", n)).
+		Where(sq.Eq{"id": replicationID}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.store.DB.ExecContext(ctx, query, args...)
+	return err
+}
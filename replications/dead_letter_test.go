@@ -0,0 +1,78 @@
+package replications
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetter(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	deadLetterBucketID := platform.ID(2000)
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock().AnyTimes()
+	mocks.bucketSvc.EXPECT().RUnlock().AnyTimes()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+
+	// The dead-letter bucket must be in the replication's org.
+	req := createReq
+	req.DeadLetterBucketID = &deadLetterBucketID
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), deadLetterBucketID).
+		Return(&influxdb.Bucket{ID: deadLetterBucketID, OrgID: platform.ID(77)}, nil)
+	_, err := svc.CreateReplication(ctx, req)
+	require.Error(t, err)
+
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), deadLetterBucketID).
+		Return(&influxdb.Bucket{ID: deadLetterBucketID, OrgID: createReq.OrgID}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	created, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, &deadLetterBucketID, created.DeadLetterBucketID)
+
+	conf, err := svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, &deadLetterBucketID, conf.DeadLetterBucketID)
+
+	// Rejected lines are recorded verbatim, since the remote usually rejected them for not parsing.
+	lines := []string{`cpu,host=a value=`, `cpu value="x`}
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), createReq.OrgID, deadLetterBucketID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ platform.ID, points []models.Point) error {
+			require.Len(t, points, len(lines))
+			for i, p := range points {
+				require.Equal(t, deadLetterMeasurement, string(p.Name()))
+				require.Equal(t, initID.String(), p.Tags().GetString("replicationID"))
+				fields, err := p.Fields()
+				require.NoError(t, err)
+				require.Equal(t, lines[i], fields["line"])
+				require.Equal(t, "partial write", fields["reason"])
+			}
+			return nil
+		})
+	n, err := svc.writeDeadLetter(ctx, initID, deadLetterBucketID, lines, "partial write")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	got, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), got.DeadLetteredPoints)
+
+	// The dead-letter bucket can't be the local bucket, and can be removed.
+	_, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{DeadLetterBucketID: &createReq.LocalBucketID})
+	require.Equal(t, &influxdb.ErrInvalidDeadLetterBucket, err)
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	updated, err := svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{RemoveDeadLetterBucket: true})
+	require.NoError(t, err)
+	require.Nil(t, updated.DeadLetterBucketID)
+}
@@ -0,0 +1,56 @@
+package replications
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+)
+
+// TotalQueueDiskUsage returns the space on disk taken up by the queues of all replications, in total and for each
+// org, to help account for the storage cost of replication. Usage is the size of the queues' files, not the
+// amount of data waiting to be sent. The per-org usage metric is refreshed at the same time.
+func (s service) TotalQueueDiskUsage(ctx context.Context) (*influxdb.ReplicationQueuesDiskUsage, error) {
+	query, args, err := sq.Select("id", "org_id").From("replications").ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rs []influxdb.Replication
+	if err := s.store.DB.SelectContext(ctx, &rs, query, args...); err != nil {
+		return nil, err
+	}
+
+	ids := make([]platform.ID, len(rs))
+	for i, r := range rs {
+		ids[i] = r.ID
+	}
+	sizes, err := s.durableQueueManager.CurrentQueueSizes(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := queueDiskUsage(rs, sizes)
+	recordQueueDiskUsage(s.metrics, usage)
+	return usage, nil
+}
+
+// queueDiskUsage sums the sizes of replication queues, in total and for each org.
+func queueDiskUsage(rs []influxdb.Replication, sizes map[platform.ID]int64) *influxdb.ReplicationQueuesDiskUsage {
+	usage := &influxdb.ReplicationQueuesDiskUsage{ByOrg: make(map[platform.ID]int64)}
+	for _, r := range rs {
+		size := sizes[r.ID]
+		usage.TotalBytes += size
+		usage.ByOrg[r.OrgID] += size
+	}
+	return usage
+}
+
+// recordQueueDiskUsage publishes the queue disk usage of each org, forgetting orgs which no longer have queues.
+func recordQueueDiskUsage(m *metrics.ReplicationsMetrics, usage *influxdb.ReplicationQueuesDiskUsage) {
+	m.QueueDiskUsage.Reset()
+	for orgID, size := range usage.ByOrg {
+		m.QueueDiskUsage.WithLabelValues(orgID.String()).Set(float64(size))
+	}
+}
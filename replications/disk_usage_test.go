@@ -0,0 +1,58 @@
+package replications
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestTotalQueueDiskUsage(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock().Times(3)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(3)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(3)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), createReq.MaxQueueSizeBytes).Times(3)
+	ids := make([]platform.ID, 3)
+	for i := range ids {
+		req := createReq
+		req.Name = fmt.Sprintf("repl%d", i)
+		r, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+		ids[i] = r.ID
+	}
+
+	// Move the last replication into another org.
+	otherOrg := platform.ID(99)
+	svc.store.Mu.Lock()
+	_, err := svc.store.DB.Exec("UPDATE replications SET org_id = ? WHERE id = ?", otherOrg, ids[2])
+	svc.store.Mu.Unlock()
+	require.NoError(t, err)
+
+	sizes := map[platform.ID]int64{ids[0]: 1000, ids[1]: 250, ids[2]: 4096}
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes(gomock.Any()).Return(sizes, nil)
+
+	usage, err := svc.TotalQueueDiskUsage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000+250+4096), usage.TotalBytes)
+	require.Equal(t, map[platform.ID]int64{replication.OrgID: 1250, otherOrg: 4096}, usage.ByOrg)
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(svc.metrics.PrometheusCollectors()...)
+	mfs := promtest.MustGather(t, reg)
+	for orgID, want := range usage.ByOrg {
+		m := promtest.MustFindMetric(t, mfs, "replications_queue_disk_usage_bytes", map[string]string{"orgID": orgID.String()})
+		require.Equal(t, float64(want), m.Gauge.GetValue())
+	}
+}
@@ -0,0 +1,125 @@
+package replications
+
+import (
+	"sync"
+	"time"
+
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/pkg/fs"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"go.uber.org/zap"
+)
+
+const defaultDiskWatchdogInterval = 10 * time.Second
+
+var errEnqueuePausedLowDisk = &ierrors.Error{
+	Code: ierrors.EUnavailable,
+	Msg:  "enqueueing into replication queues is paused because disk space is low",
+}
+
+// diskWatchdog periodically checks the free space on the disk holding the replication queues, and pauses
+// enqueueing into all replications while it's below a threshold, so a long remote outage can't fill the disk.
+// Enqueueing resumes once space is freed, i.e. by queues draining after the remotes come back.
+//
+// This is a safety valve for the whole disk, in addition to the size caps of individual queues.
+type diskWatchdog struct {
+	path         string
+	minFreeBytes uint64
+	interval     time.Duration
+	diskUsage    func(path string) (*fs.DiskStatus, error)
+	metrics      *metrics.ReplicationsMetrics
+	log          *zap.Logger
+
+	mu     sync.RWMutex
+	paused bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newDiskWatchdog(path string, minFreeBytes uint64, interval time.Duration, metrics *metrics.ReplicationsMetrics, log *zap.Logger) *diskWatchdog {
+	if interval <= 0 {
+		interval = defaultDiskWatchdogInterval
+	}
+	return &diskWatchdog{
+		path:         path,
+		minFreeBytes: minFreeBytes,
+		interval:     interval,
+		diskUsage:    fs.DiskUsage,
+		metrics:      metrics,
+		log:          log,
+	}
+}
+
+// start checks the free space immediately, then periodically until stop is called.
+func (w *diskWatchdog) start() {
+	w.check()
+
+	w.done = make(chan struct{})
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+func (w *diskWatchdog) stop() {
+	if w.done == nil {
+		return
+	}
+	close(w.done)
+	w.wg.Wait()
+	w.done = nil
+}
+
+// check updates whether enqueueing is paused based on the current free space.
+func (w *diskWatchdog) check() {
+	usage, err := w.diskUsage(w.path)
+	if err != nil {
+		// Keep the current state rather than guessing.
+		w.log.Warn("Failed to check free disk space for replication queues", zap.String("path", w.path), zap.Error(err))
+		return
+	}
+	low := usage.Avail < w.minFreeBytes
+
+	w.mu.Lock()
+	changed := low != w.paused
+	w.paused = low
+	w.mu.Unlock()
+
+	if low {
+		w.metrics.EnqueuePausedLowDisk.Set(1)
+	} else {
+		w.metrics.EnqueuePausedLowDisk.Set(0)
+	}
+	if !changed {
+		return
+	}
+	if low {
+		w.log.Error("Free disk space for replication queues is critically low, pausing enqueueing into all replications",
+			zap.String("path", w.path), zap.Uint64("avail_bytes", usage.Avail), zap.Uint64("min_free_bytes", w.minFreeBytes))
+	} else {
+		w.log.Info("Free disk space for replication queues recovered, resuming enqueueing",
+			zap.String("path", w.path), zap.Uint64("avail_bytes", usage.Avail))
+	}
+}
+
+// enqueuePaused reports whether enqueueing is paused. A nil watchdog never pauses enqueueing.
+func (w *diskWatchdog) enqueuePaused() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.paused
+}
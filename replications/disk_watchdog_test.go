@@ -0,0 +1,108 @@
+package replications
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/pkg/fs"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeDisk reports a settable amount of available space.
+type fakeDisk struct {
+	mu    sync.Mutex
+	avail uint64
+}
+
+func (d *fakeDisk) set(avail uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.avail = avail
+}
+
+func (d *fakeDisk) usage(string) (*fs.DiskStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &fs.DiskStatus{Avail: d.avail}, nil
+}
+
+func TestDiskWatchdog(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	disk := &fakeDisk{avail: 1 << 30}
+	m := metrics.NewReplicationsMetrics()
+	svc.diskWatchdog = newDiskWatchdog(t.TempDir(), 1<<20, 0, m, zaptest.NewLogger(t))
+	svc.diskWatchdog.diskUsage = disk.usage
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(m.PrometheusCollectors()...)
+	pausedGauge := func() float64 {
+		mfs := promtest.MustGather(t, reg)
+		return promtest.MustFindMetric(t, mfs, "replications_queue_enqueue_paused_low_disk", nil).Gauge.GetValue()
+	}
+
+	// Register a best-effort and a guaranteed replication on the same bucket.
+	guaranteedReq := createReq
+	guaranteedReq.Name = "test2"
+	guaranteedReq.DurabilityTier = influxdb.DurabilityGuaranteed
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	insertRemote(t, svc.store, createReq.RemoteID)
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, guaranteedReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+	guaranteedID := initID + 1
+
+	points := mustParsePoints(t, `cpu,host=A value=1.2 2000000000`)
+
+	// With enough space, points are enqueued as usual.
+	svc.diskWatchdog.check()
+	require.False(t, svc.diskWatchdog.enqueuePaused())
+	require.Equal(t, 0.0, pausedGauge())
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+
+	// Once space runs low, nothing is enqueued (the mock rejects any EnqueueData call), and writes
+	// to guaranteed replications fail.
+	disk.set(1 << 10)
+	svc.diskWatchdog.check()
+	require.True(t, svc.diskWatchdog.enqueuePaused())
+	require.Equal(t, 1.0, pausedGauge())
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+	require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+	require.Contains(t, err.Error(), guaranteedID.String())
+
+	// Enqueueing resumes once space recovers.
+	disk.set(1 << 30)
+	svc.diskWatchdog.check()
+	require.False(t, svc.diskWatchdog.enqueuePaused())
+	require.Equal(t, 0.0, pausedGauge())
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+
+	// The watchdog can be started and stopped with the service.
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{
+		initID:       createReq.MaxQueueSizeBytes,
+		guaranteedID: createReq.MaxQueueSizeBytes,
+	})
+	require.NoError(t, svc.Open(ctx))
+	mocks.durableQueueManager.EXPECT().CloseAll()
+	require.NoError(t, svc.Close())
+}
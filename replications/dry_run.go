@@ -0,0 +1,94 @@
+package replications
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+// WritePointsDryRun serializes and validates a write to a local bucket the same way WritePoints does, reporting
+// the size and number of points it would enqueue into each of the bucket's replications. Nothing is written to
+// local storage or enqueued, and no metrics are recorded. Writes which WritePoints would reject for replication,
+// i.e. because they hold points without fields which are rejected, return the same error.
+func (s service) WritePointsDryRun(ctx context.Context, orgID, bucketID platform.ID, points []models.Point) (*influxdb.ReplicationWriteDryRun, error) {
+	q := sq.Select("id", "enqueue_on_local_failure", "durability_tier", "serialized_enqueue", "preserve_write_boundaries", "filter_expression", "durable_ack", "compression",
+		"remote_bucket_tag", "timestamp_offset_seconds", "measurement_filter", "tag_filter").
+		From("replications").
+		Where(sq.Eq{"org_id": orgID, "local_bucket_id": bucketID}).
+		OrderBy("id")
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []replicationTarget
+	if err := s.store.DB.SelectContext(ctx, &targets, query, args...); err != nil {
+		return nil, err
+	}
+
+	res := &influxdb.ReplicationWriteDryRun{Replications: []influxdb.ReplicationDryRunEnqueued{}}
+	if len(targets) == 0 || len(points) == 0 {
+		return res, nil
+	}
+
+	points, skipped := withoutFieldlessPoints(points)
+	if skipped > 0 && s.rejectFieldlessPoints {
+		return nil, errFieldlessPoints(skipped)
+	}
+
+	enqueued := make(map[platform.ID]*influxdb.ReplicationDryRunEnqueued, len(targets))
+	flushTo := func(targets []replicationTarget) func(data []byte, n int) error {
+		return func(data []byte, n int) error {
+			for _, t := range targets {
+				e := enqueued[t.ID]
+				e.Bytes += int64(len(data))
+				e.Points += int64(n)
+				e.Blocks++
+			}
+			return nil
+		}
+	}
+	for _, t := range targets {
+		enqueued[t.ID] = &influxdb.ReplicationDryRunEnqueued{ReplicationID: t.ID}
+	}
+
+	// Mirror the serialization passes of WritePoints: one per filter and codec, with replications preserving
+	// write boundaries getting the whole write as a single block.
+	for _, group := range s.groupTargetsByFilter(targets) {
+		groupPoints, _ := shiftTimestamps(group.filter.filter(points), group.timestampOffset)
+		if len(groupPoints) == 0 {
+			continue
+		}
+		if group.routeTag != "" {
+			groupPoints = groupPointsByTag(groupPoints, group.routeTag)
+		}
+		wholeTargets, splitTargets := partitionTargets(group.targets)
+		if s.maxSerializationBufferBytes == 0 {
+			wholeTargets, splitTargets = nil, group.targets
+		}
+		if len(splitTargets) > 0 {
+			if err := serializePoints(groupPoints, group.compression, s.maxSerializationBufferBytes, flushTo(splitTargets)); err != nil {
+				return nil, err
+			}
+		}
+		if len(wholeTargets) > 0 {
+			if err := serializePoints(groupPoints, group.compression, 0, flushTo(wholeTargets)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, t := range targets {
+		e := enqueued[t.ID]
+		if e.Blocks == 0 {
+			continue
+		}
+		res.Bytes += e.Bytes
+		res.Points += e.Points
+		res.Replications = append(res.Replications, *e)
+	}
+	return res, nil
+}
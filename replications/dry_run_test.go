@@ -0,0 +1,70 @@
+package replications
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePointsDryRun(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mem := `measurement == "mem"`
+	disk := `measurement == "disk"`
+	reqs := []influxdb.CreateReplicationRequest{createReq, createReq, createReq}
+	reqs[1].Name, reqs[1].FilterExpression = "mem", &mem
+	reqs[2].Name, reqs[2].FilterExpression = "disk", &disk
+
+	mocks.bucketSvc.EXPECT().RLock().Times(len(reqs))
+	mocks.bucketSvc.EXPECT().RUnlock().Times(len(reqs))
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(len(reqs))
+	for _, req := range reqs {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+
+	// The mocks fail the test if anything is written locally or enqueued.
+	points := mustParsePoints(t, "cpu value=1 1\nmem value=2 2\nmem value=3 3")
+	points = append(points, fieldlessPoint{mustParsePoints(t, "mem,host=a value=4 4")[0]})
+	res, err := svc.WritePointsDryRun(ctx, replication.OrgID, replication.LocalBucketID, points)
+	require.NoError(t, err)
+
+	var all, memOnly []byte
+	kept, _ := withoutFieldlessPoints(points)
+	require.NoError(t, serializePoints(kept, influxdb.CompressionGzip, 0, func(data []byte, _ int) error {
+		all = data
+		return nil
+	}))
+	require.NoError(t, serializePoints(kept[1:], influxdb.CompressionGzip, 0, func(data []byte, _ int) error {
+		memOnly = data
+		return nil
+	}))
+
+	// The field-less point is left out, and the disk replication isn't enqueued anything.
+	require.Equal(t, []influxdb.ReplicationDryRunEnqueued{
+		{ReplicationID: initID, Bytes: int64(len(all)), Points: 3, Blocks: 1},
+		{ReplicationID: initID + 1, Bytes: int64(len(memOnly)), Points: 2, Blocks: 1},
+	}, res.Replications)
+	require.Equal(t, int64(len(all)+len(memOnly)), res.Bytes)
+	require.Equal(t, int64(5), res.Points)
+
+	// Writes which would be rejected fail the same way.
+	svc.rejectFieldlessPoints = true
+	_, err = svc.WritePointsDryRun(ctx, replication.OrgID, replication.LocalBucketID, points)
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+
+	// Buckets without replications would enqueue nothing.
+	res, err = svc.WritePointsDryRun(ctx, replication.OrgID, platform.ID(12345), points)
+	require.NoError(t, err)
+	require.Empty(t, res.Replications)
+	require.Zero(t, res.Bytes)
+}
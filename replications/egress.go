@@ -0,0 +1,470 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/influxdata/influxdb/v2/sqlite"
+	"go.uber.org/zap"
+)
+
+const defaultEgressFlushInterval = 10 * time.Second
+
+// egressTracker tracks the cumulative number of bytes sent to remotes by each org's replications, and pauses
+// all of an org's replications once the org exceeds its egress quota for the current (monthly) period. Paused
+// replications are resumed when the period rolls over or the quota is raised.
+//
+// Usage is added up in memory, so sends never wait on the store, and persisted every interval and when the
+// tracker is stopped.
+type egressTracker struct {
+	store    *sqlite.SqlStore
+	queues   DurableQueueManager
+	log      *zap.Logger
+	now      func() time.Time
+	interval time.Duration
+	metrics  *metrics.ReplicationsMetrics // nil unless set
+
+	mu         sync.Mutex
+	orgs       map[platform.ID]platform.ID // replication ID -> org ID
+	usages     map[platform.ID]influxdb.OrgEgressUsage
+	dirty      map[platform.ID]struct{} // orgs whose usage changed since it was persisted
+	pausedOrgs map[platform.ID]*time.Timer
+	stopped    bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newEgressTracker(store *sqlite.SqlStore, queues DurableQueueManager, log *zap.Logger) *egressTracker {
+	return &egressTracker{
+		store:      store,
+		queues:     queues,
+		log:        log,
+		now:        time.Now,
+		interval:   defaultEgressFlushInterval,
+		orgs:       make(map[platform.ID]platform.ID),
+		usages:     make(map[platform.ID]influxdb.OrgEgressUsage),
+		dirty:      make(map[platform.ID]struct{}),
+		pausedOrgs: make(map[platform.ID]*time.Timer),
+	}
+}
+
+// start persists usage periodically until stop is called.
+func (t *egressTracker) start() {
+	t.mu.Lock()
+	t.stopped = false
+	t.mu.Unlock()
+
+	t.done = make(chan struct{})
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+				if err := t.flush(context.Background()); err != nil {
+					t.log.Error("Failed to persist replication egress", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// stop stops persisting usage periodically, and the timers re-checking the quotas of paused orgs. Quotas aren't
+// enforced once stopped, since the queues are about to be closed. The usage still has to be flushed afterwards.
+func (t *egressTracker) stop() {
+	if t.done != nil {
+		close(t.done)
+		t.wg.Wait()
+		t.done = nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	for orgID, timer := range t.pausedOrgs {
+		timer.Stop()
+		delete(t.pausedOrgs, orgID)
+	}
+	if t.metrics != nil {
+		t.metrics.EgressQuotaPausedOrgs.Set(0)
+	}
+}
+
+// periodStart returns the beginning of the quota period containing t.
+func periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// observe wraps a durable queue write function, recording the size of every block successfully
+// sent to the remote against the owning org's egress usage.
+func (t *egressTracker) observe(write func(platform.ID, []byte) error) func(platform.ID, []byte) error {
+	return func(replicationID platform.ID, data []byte) error {
+		if err := write(replicationID, data); err != nil {
+			return err
+		}
+		if err := t.record(context.Background(), replicationID, int64(len(data))); err != nil {
+			t.log.Warn("Failed to record replication egress", zap.String("id", replicationID.String()), zap.Error(err))
+		}
+		return nil
+	}
+}
+
+// record adds n bytes to the egress usage of the org owning the replication, and enforces the org's quota.
+func (t *egressTracker) record(ctx context.Context, replicationID platform.ID, n int64) error {
+	orgID, err := t.orgOf(ctx, replicationID)
+	if err != nil {
+		return err
+	}
+
+	usage, err := t.update(ctx, orgID, func(usage *influxdb.OrgEgressUsage) {
+		usage.BytesSent += n
+	})
+	if err != nil {
+		return err
+	}
+	return t.enforce(ctx, usage)
+}
+
+// update applies a change to the usage of an org in the current period, loading it from the store the first
+// time, and marks it to be persisted. It returns the updated usage.
+func (t *egressTracker) update(ctx context.Context, orgID platform.ID, change func(*influxdb.OrgEgressUsage)) (*influxdb.OrgEgressUsage, error) {
+	if err := t.load(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage := t.current(orgID)
+	change(&usage)
+	t.usages[orgID] = usage
+	t.dirty[orgID] = struct{}{}
+	return &usage, nil
+}
+
+// load caches the persisted usage of an org, unless it's already cached.
+func (t *egressTracker) load(ctx context.Context, orgID platform.ID) error {
+	t.mu.Lock()
+	_, ok := t.usages[orgID]
+	t.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	usage, err := t.getUsage(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.usages[orgID]; !ok {
+		t.usages[orgID] = *usage
+	}
+	return nil
+}
+
+// current returns the cached usage of an org, resetting the byte count if its period has ended. t.mu must be
+// held, and the usage loaded.
+func (t *egressTracker) current(orgID platform.ID) influxdb.OrgEgressUsage {
+	usage := t.usages[orgID]
+	if start := periodStart(t.now()); usage.PeriodStart.Before(start) {
+		usage.PeriodStart = start
+		usage.BytesSent = 0
+		t.usages[orgID] = usage
+		t.dirty[orgID] = struct{}{}
+	}
+	return usage
+}
+
+// flush persists the usage of the orgs which changed since the last flush. Usage which fails to be persisted
+// is retried on the next flush.
+func (t *egressTracker) flush(ctx context.Context) error {
+	t.mu.Lock()
+	usages := make([]influxdb.OrgEgressUsage, 0, len(t.dirty))
+	for orgID := range t.dirty {
+		usages = append(usages, t.usages[orgID])
+	}
+	t.dirty = make(map[platform.ID]struct{})
+	t.mu.Unlock()
+	if len(usages) == 0 {
+		return nil
+	}
+
+	t.store.Mu.Lock()
+	defer t.store.Mu.Unlock()
+
+	for i, usage := range usages {
+		q := sq.Insert("replication_egress").
+			SetMap(sq.Eq{
+				"org_id":       usage.OrgID,
+				"period_start": usage.PeriodStart,
+				"bytes_sent":   usage.BytesSent,
+				"quota_bytes":  usage.QuotaBytes,
+			}).
+			Suffix("ON CONFLICT (org_id) DO UPDATE SET period_start = excluded.period_start, bytes_sent = excluded.bytes_sent")
+
+		query, args, err := q.ToSql()
+		if err == nil {
+			_, err = t.store.DB.ExecContext(ctx, query, args...)
+		}
+		if err != nil {
+			t.mu.Lock()
+			for _, usage := range usages[i:] {
+				t.dirty[usage.OrgID] = struct{}{}
+			}
+			t.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// setQuota updates the egress quota of an org. A nil quota removes the limit.
+func (t *egressTracker) setQuota(ctx context.Context, orgID platform.ID, quotaBytes *int64) error {
+	if quotaBytes != nil {
+		quota := *quotaBytes
+		quotaBytes = &quota
+	}
+
+	usage, err := func() (*influxdb.OrgEgressUsage, error) {
+		t.store.Mu.Lock()
+		defer t.store.Mu.Unlock()
+
+		usage, err := t.update(ctx, orgID, func(usage *influxdb.OrgEgressUsage) {
+			usage.QuotaBytes = quotaBytes
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		q := sq.Insert("replication_egress").
+			SetMap(sq.Eq{
+				"org_id":       orgID,
+				"period_start": usage.PeriodStart,
+				"bytes_sent":   usage.BytesSent,
+				"quota_bytes":  quotaBytes,
+			}).
+			Suffix("ON CONFLICT (org_id) DO UPDATE SET quota_bytes = excluded.quota_bytes")
+
+		query, args, err := q.ToSql()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.store.DB.ExecContext(ctx, query, args...); err != nil {
+			return nil, err
+		}
+		return usage, nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	return t.enforce(ctx, usage)
+}
+
+// usage returns the egress usage of an org in the current period.
+func (t *egressTracker) usage(ctx context.Context, orgID platform.ID) (*influxdb.OrgEgressUsage, error) {
+	if err := t.load(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := t.current(orgID)
+	_, usage.Paused = t.pausedOrgs[orgID]
+
+	return &usage, nil
+}
+
+// getUsage reads the persisted egress usage of an org, resetting the byte count if the
+// period it was recorded in has ended.
+func (t *egressTracker) getUsage(ctx context.Context, orgID platform.ID) (*influxdb.OrgEgressUsage, error) {
+	q := sq.Select("org_id", "period_start", "bytes_sent", "quota_bytes").
+		From("replication_egress").
+		Where(sq.Eq{"org_id": orgID})
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	current := periodStart(t.now())
+
+	var usage influxdb.OrgEgressUsage
+	if err := t.store.DB.GetContext(ctx, &usage, query, args...); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		usage.OrgID = orgID
+	}
+	if usage.PeriodStart.Before(current) {
+		usage.PeriodStart = current
+		usage.BytesSent = 0
+	}
+
+	return &usage, nil
+}
+
+// enforce pauses the org's replications if its usage is over quota, and resumes them otherwise.
+func (t *egressTracker) enforce(ctx context.Context, usage *influxdb.OrgEgressUsage) error {
+	overQuota := usage.QuotaBytes != nil && usage.BytesSent >= *usage.QuotaBytes
+
+	t.mu.Lock()
+	timer, paused := t.pausedOrgs[usage.OrgID]
+	if overQuota == paused || t.stopped {
+		t.mu.Unlock()
+		return nil
+	}
+	if overQuota {
+		// Re-check the quota once the current period ends, so the org's replications resume
+		// without having to wait for a send (which will never happen while they're paused).
+		next := usage.PeriodStart.AddDate(0, 1, 0)
+		t.pausedOrgs[usage.OrgID] = time.AfterFunc(next.Sub(t.now()), func() {
+			if err := t.reevaluate(context.Background(), usage.OrgID); err != nil {
+				t.log.Error("Failed to re-evaluate replication egress quota", zap.String("org_id", usage.OrgID.String()), zap.Error(err))
+			}
+		})
+	} else {
+		timer.Stop()
+		delete(t.pausedOrgs, usage.OrgID)
+	}
+	if t.metrics != nil {
+		t.metrics.EgressQuotaPausedOrgs.Set(float64(len(t.pausedOrgs)))
+	}
+	t.mu.Unlock()
+
+	ids, err := t.orgReplications(ctx, usage.OrgID)
+	if err != nil {
+		return err
+	}
+
+	if overQuota {
+		t.log.Warn("Org exceeded its replication egress quota, pausing its replications",
+			zap.String("org_id", usage.OrgID.String()), zap.Int64("bytes_sent", usage.BytesSent), zap.Int64("quota_bytes", *usage.QuotaBytes))
+	} else {
+		t.log.Info("Org is within its replication egress quota, resuming its replications", zap.String("org_id", usage.OrgID.String()))
+	}
+
+	for _, id := range ids {
+		var err error
+		if overQuota {
+			err = t.queues.PauseQueueFor(id, internal.PauseReasonQuota)
+		} else {
+			err = t.queues.ResumeQueueFor(id, internal.PauseReasonQuota)
+		}
+		if err != nil {
+			t.log.Error("Failed to apply replication egress quota", zap.String("id", id.String()), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// restore pauses the replications of the orgs whose persisted usage is over their quota, i.e. when the service
+// is opened, since which orgs are paused isn't persisted itself.
+func (t *egressTracker) restore(ctx context.Context) error {
+	q := sq.Select("org_id").From("replication_egress").Where(sq.NotEq{"quota_bytes": nil})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var orgIDs []platform.ID
+	if err := t.store.DB.SelectContext(ctx, &orgIDs, query, args...); err != nil {
+		return err
+	}
+	for _, orgID := range orgIDs {
+		if err := t.reevaluate(ctx, orgID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pauseIfOverQuota pauses a newly created replication if its org is over its egress quota.
+func (t *egressTracker) pauseIfOverQuota(ctx context.Context, orgID, replicationID platform.ID) error {
+	usage, err := t.usage(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if usage.QuotaBytes == nil || usage.BytesSent < *usage.QuotaBytes {
+		return nil
+	}
+	// Pauses the org's other replications too, if it isn't paused yet.
+	if err := t.enforce(ctx, usage); err != nil {
+		return err
+	}
+	return t.queues.PauseQueueFor(replicationID, internal.PauseReasonQuota)
+}
+
+func (t *egressTracker) reevaluate(ctx context.Context, orgID platform.ID) error {
+	usage, err := t.usage(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	return t.enforce(ctx, usage)
+}
+
+// orgOf returns the ID of the org owning the replication, caching the result.
+func (t *egressTracker) orgOf(ctx context.Context, replicationID platform.ID) (platform.ID, error) {
+	t.mu.Lock()
+	orgID, ok := t.orgs[replicationID]
+	t.mu.Unlock()
+	if ok {
+		return orgID, nil
+	}
+
+	q := sq.Select("org_id").From("replications").Where(sq.Eq{"id": replicationID})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	if err := t.store.DB.GetContext(ctx, &orgID, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errReplicationNotFound
+		}
+		return 0, err
+	}
+
+	t.mu.Lock()
+	t.orgs[replicationID] = orgID
+	t.mu.Unlock()
+
+	return orgID, nil
+}
+
+// forget drops the cached org of a replication which was deleted.
+func (t *egressTracker) forget(replicationID platform.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.orgs, replicationID)
+}
+
+func (t *egressTracker) orgReplications(ctx context.Context, orgID platform.ID) ([]platform.ID, error) {
+	q := sq.Select("id").From("replications").Where(sq.Eq{"org_id": orgID})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []platform.ID
+	if err := t.store.DB.SelectContext(ctx, &ids, query, args...); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,148 @@
+package replications
+
+import (
+	"context"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+)
+
+// enqueueSequencers orders the enqueues into replications configured for serialized enqueue, so their
+// blocks are appended to the queue strictly in the order the WritePoints calls producing them arrived,
+// even if a later call finishes its local write and serialization first.
+//
+// Each WritePoints call takes a ticket per serialized replication on arrival, and may only enqueue into
+// a replication once all calls holding earlier tickets for it have released theirs.
+type enqueueSequencers struct {
+	mu         sync.Mutex
+	sequencers map[platform.ID]*enqueueSequencer
+}
+
+type enqueueSequencer struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	next     uint64
+	serving  uint64
+	released map[uint64]struct{}
+	// forgotten is set once the replication is deleted, so calls waiting for their turn stop waiting.
+	forgotten bool
+}
+
+func newEnqueueSequencers() *enqueueSequencers {
+	return &enqueueSequencers{sequencers: make(map[platform.ID]*enqueueSequencer)}
+}
+
+// acquire hands out a ticket for each of the given replications. Tickets for all replications are taken
+// atomically, so concurrent calls are ordered the same way in every replication and can't deadlock
+// waiting on each other.
+func (s *enqueueSequencers) acquire(ids []platform.ID) map[platform.ID]uint64 {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tickets := make(map[platform.ID]uint64, len(ids))
+	for _, id := range ids {
+		seq, ok := s.sequencers[id]
+		if !ok {
+			seq = &enqueueSequencer{released: make(map[uint64]struct{})}
+			seq.cond = sync.NewCond(&seq.mu)
+			s.sequencers[id] = seq
+		}
+
+		seq.mu.Lock()
+		tickets[id] = seq.next
+		seq.next++
+		seq.mu.Unlock()
+	}
+	return tickets
+}
+
+// wait blocks until it's the turn of the ticket to enqueue into the replication, or the context ends. The
+// ticket must still be released if the context ends first.
+func (s *enqueueSequencers) wait(ctx context.Context, id platform.ID, ticket uint64) error {
+	seq := s.get(id)
+	if seq == nil {
+		return nil
+	}
+
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	if seq.serving == ticket || seq.forgotten || ctx.Done() == nil {
+		for seq.serving != ticket && !seq.forgotten {
+			seq.cond.Wait()
+		}
+		return nil
+	}
+
+	// Wake up the wait below if the context ends first.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			seq.mu.Lock()
+			seq.cond.Broadcast()
+			seq.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	for seq.serving != ticket && !seq.forgotten {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		seq.cond.Wait()
+	}
+	return nil
+}
+
+// release gives up all the given tickets, letting the next calls in line enqueue. Tickets may be
+// released before their turn comes (i.e. if the write failed), in which case they're skipped.
+func (s *enqueueSequencers) release(tickets map[platform.ID]uint64) {
+	for id, ticket := range tickets {
+		seq := s.get(id)
+		if seq == nil {
+			continue
+		}
+
+		seq.mu.Lock()
+		seq.released[ticket] = struct{}{}
+		for {
+			if _, ok := seq.released[seq.serving]; !ok {
+				break
+			}
+			delete(seq.released, seq.serving)
+			seq.serving++
+		}
+		seq.cond.Broadcast()
+		seq.mu.Unlock()
+	}
+}
+
+// forget drops the sequencer of a deleted replication, letting any calls waiting for their turn go ahead.
+func (s *enqueueSequencers) forget(id platform.ID) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	seq, ok := s.sequencers[id]
+	delete(s.sequencers, id)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	seq.mu.Lock()
+	seq.forgotten = true
+	seq.cond.Broadcast()
+	seq.mu.Unlock()
+}
+
+func (s *enqueueSequencers) get(id platform.ID) *enqueueSequencer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sequencers[id]
+}
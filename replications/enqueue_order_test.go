@@ -0,0 +1,94 @@
+package replications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnqueueSequencers_ReleaseOutOfTurn(t *testing.T) {
+	t.Parallel()
+
+	id := platform.ID(1)
+	seqs := newEnqueueSequencers()
+	first := seqs.acquire([]platform.ID{id})
+	second := seqs.acquire([]platform.ID{id})
+	third := seqs.acquire([]platform.ID{id})
+
+	// The second ticket gives up its turn before it comes, i.e. because its write failed.
+	seqs.release(second)
+
+	waited := make(chan struct{})
+	go func() {
+		require.NoError(t, seqs.wait(context.Background(), id, third[id]))
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("third ticket was served before the first was released")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	require.NoError(t, seqs.wait(context.Background(), id, first[id]))
+	seqs.release(first)
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("third ticket was not served after all earlier tickets were released")
+	}
+	seqs.release(third)
+}
+
+func TestEnqueueSequencers_WaitContext(t *testing.T) {
+	t.Parallel()
+
+	id := platform.ID(1)
+	seqs := newEnqueueSequencers()
+	first := seqs.acquire([]platform.ID{id})
+	second := seqs.acquire([]platform.ID{id})
+
+	// The second ticket gives up waiting once its context ends, while the first is still held.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, seqs.wait(ctx, id, second[id]), context.DeadlineExceeded)
+	seqs.release(second)
+
+	require.NoError(t, seqs.wait(context.Background(), id, first[id]))
+	seqs.release(first)
+
+	// Later tickets aren't held up by the one which gave up.
+	third := seqs.acquire([]platform.ID{id})
+	require.NoError(t, seqs.wait(context.Background(), id, third[id]))
+	seqs.release(third)
+}
+
+func TestEnqueueSequencers_Forget(t *testing.T) {
+	t.Parallel()
+
+	id := platform.ID(1)
+	seqs := newEnqueueSequencers()
+	first := seqs.acquire([]platform.ID{id})
+	second := seqs.acquire([]platform.ID{id})
+
+	waited := make(chan error)
+	go func() {
+		waited <- seqs.wait(context.Background(), id, second[id])
+	}()
+
+	// Deleting the replication lets the waiting call go ahead, and drops its sequencer.
+	seqs.forget(id)
+	select {
+	case err := <-waited:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiting ticket was not let go when the replication was forgotten")
+	}
+	seqs.release(first)
+	seqs.release(second)
+	require.Empty(t, seqs.sequencers)
+}
@@ -0,0 +1,145 @@
+package replications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+)
+
+const (
+	defaultErrorRateWindow = 5 * time.Minute
+	// errorRateBuckets is the number of buckets the window is divided into. Sends age out of the window a bucket
+	// at a time.
+	errorRateBuckets = 30
+)
+
+// errorRateTracker counts the sends of each replication to its remote, and how many of them failed, over a
+// rolling window. The resulting error rate is a smoother health signal than the outcome of the latest send,
+// which a single intermittent failure flips. Counts are kept in memory, so they start over when the server
+// restarts.
+type errorRateTracker struct {
+	window  time.Duration
+	bucket  time.Duration
+	now     func() time.Time
+	metrics *metrics.ReplicationsMetrics
+
+	mu      sync.Mutex
+	history map[platform.ID][]sendBucket
+}
+
+// sendBucket counts the sends started within a fixed-size slice of the window.
+type sendBucket struct {
+	start    time.Time
+	sends    int64
+	failures int64
+}
+
+func newErrorRateTracker(window time.Duration, metrics *metrics.ReplicationsMetrics) *errorRateTracker {
+	if window <= 0 {
+		window = defaultErrorRateWindow
+	}
+	bucket := window / errorRateBuckets
+	if bucket <= 0 {
+		bucket = window
+	}
+	return &errorRateTracker{
+		window:  window,
+		bucket:  bucket,
+		now:     time.Now,
+		metrics: metrics,
+		history: make(map[platform.ID][]sendBucket),
+	}
+}
+
+// observe wraps a durable queue write function, counting the outcome of every send.
+func (t *errorRateTracker) observe(write func(platform.ID, []byte) error) func(platform.ID, []byte) error {
+	return func(replicationID platform.ID, data []byte) error {
+		err := write(replicationID, data)
+		rate := t.record(replicationID, t.now(), err != nil)
+		t.metrics.ErrorRate.WithLabelValues(replicationID.String()).Set(rate)
+		return err
+	}
+}
+
+// record counts a send to a replication's remote at the given time, returning the replication's error rate.
+func (t *errorRateTracker) record(id platform.ID, at time.Time, failed bool) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets := t.history[id]
+	start := at.Truncate(t.bucket)
+	if n := len(buckets); n == 0 || !buckets[n-1].start.Equal(start) {
+		buckets = append(buckets, sendBucket{start: start})
+	}
+	last := &buckets[len(buckets)-1]
+	last.sends++
+	if failed {
+		last.failures++
+	}
+	t.history[id] = t.expire(buckets, at)
+
+	rate, _ := errorRate(t.history[id])
+	return rate
+}
+
+// expire drops the buckets which have fallen out of the window.
+func (t *errorRateTracker) expire(buckets []sendBucket, now time.Time) []sendBucket {
+	cutoff := now.Add(-t.window)
+	for len(buckets) > 0 && !buckets[0].start.Add(t.bucket).After(cutoff) {
+		buckets = buckets[1:]
+	}
+	return buckets
+}
+
+// rate returns the fraction of a replication's sends over the window which failed, or false if it made no sends
+// within the window. A nil tracker never knows the rate.
+func (t *errorRateTracker) rate(id platform.ID, now time.Time) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets, ok := t.history[id]
+	if !ok {
+		return 0, false
+	}
+	buckets = t.expire(buckets, now)
+	t.history[id] = buckets
+	return errorRate(buckets)
+}
+
+func errorRate(buckets []sendBucket) (float64, bool) {
+	var sends, failures int64
+	for _, b := range buckets {
+		sends += b.sends
+		failures += b.failures
+	}
+	if sends == 0 {
+		return 0, false
+	}
+	return float64(failures) / float64(sends), true
+}
+
+// setErrorRate fills in the error rate of a replication which has made sends within the window.
+func (t *errorRateTracker) setErrorRate(r *influxdb.Replication, now time.Time) {
+	r.ErrorRate = nil
+	if rate, ok := t.rate(r.ID, now); ok {
+		r.ErrorRate = &rate
+	}
+}
+
+// forget drops the history of a deleted replication. A nil tracker has nothing to forget.
+func (t *errorRateTracker) forget(id platform.ID) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.history, id)
+	t.metrics.ErrorRate.DeleteLabelValues(id.String())
+}
@@ -0,0 +1,98 @@
+package replications
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestErrorRateTracker(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.NewReplicationsMetrics()
+	tracker := newErrorRateTracker(time.Minute, m)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	tracker.now = func() time.Time { return now }
+
+	id := platform.ID(1)
+	_, ok := tracker.rate(id, now)
+	require.False(t, ok)
+
+	// One in four sends fails.
+	var fail bool
+	write := tracker.observe(func(platform.ID, []byte) error {
+		if fail {
+			return errors.New("O NO")
+		}
+		return nil
+	})
+	for i := 0; i < 100; i++ {
+		fail = i%4 == 0
+		_ = write(id, nil)
+		now = now.Add(100 * time.Millisecond)
+	}
+	rate, ok := tracker.rate(id, now)
+	require.True(t, ok)
+	require.InDelta(t, 0.25, rate, 0.01)
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(m.PrometheusCollectors()...)
+	gauge := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_error_rate", map[string]string{"replicationID": id.String()})
+	require.InDelta(t, 0.25, gauge.Gauge.GetValue(), 0.01)
+
+	// After a minute of successful sends, the earlier failures have aged out of the window.
+	fail = false
+	for i := 0; i < 60; i++ {
+		_ = write(id, nil)
+		now = now.Add(time.Second)
+	}
+	rate, ok = tracker.rate(id, now)
+	require.True(t, ok)
+	require.InDelta(t, 0, rate, 0.01)
+
+	// With no recent sends, the rate is unknown.
+	_, ok = tracker.rate(id, now.Add(2*time.Minute))
+	require.False(t, ok)
+
+	tracker.forget(id)
+	_, ok = tracker.rate(id, now)
+	require.False(t, ok)
+}
+
+func TestGetReplication_ErrorRate(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.errorRates = newErrorRateTracker(time.Minute, svc.metrics)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(ctx, createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).Times(2)
+	r, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Nil(t, r.ErrorRate)
+
+	now := time.Now()
+	svc.errorRates.record(initID, now, true)
+	svc.errorRates.record(initID, now, false)
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.NotNil(t, r.ErrorRate)
+	require.InDelta(t, 0.5, *r.ErrorRate, 0.01)
+}
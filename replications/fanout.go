@@ -0,0 +1,125 @@
+package replications
+
+import (
+	"context"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"go.uber.org/zap"
+)
+
+// Each additional destination of a replication is delivered to by a replication of its own, with the same local
+// bucket and settings but a different remote, linked to the replication through its fanout_parent_id. That gives
+// every destination its own queue, status and delivery counters, while writes to the local bucket are still
+// serialized once for all of them, since their points are grouped by the replications' settings.
+
+// destinationName names the replication delivering to a destination, keeping names unique within the org.
+func destinationName(name string, remoteID platform.ID) string {
+	return fmt.Sprintf("%s (%s)", name, remoteID)
+}
+
+// destinationRequest derives the request to create the replication delivering to a destination. Remote bucket
+// routing is specific to the bucket IDs of the replication's own remote, so destinations get all points in
+// their remote bucket.
+func destinationRequest(request influxdb.CreateReplicationRequest, d influxdb.ReplicationDestination) influxdb.CreateReplicationRequest {
+	request.Name = destinationName(request.Name, d.RemoteID)
+	request.RemoteID = d.RemoteID
+	request.RemoteBucketID = d.RemoteBucketID
+	request.RemoteBucketTag = nil
+	request.RemoteBucketMapping = nil
+	request.AdditionalDestinations = nil
+	return request
+}
+
+// insertDestinations creates the replications delivering to the additional destinations of r. If any fails, r
+// is deleted along with the destinations already created.
+func (s service) insertDestinations(ctx context.Context, r *influxdb.Replication, request influxdb.CreateReplicationRequest) error {
+	for _, d := range request.AdditionalDestinations {
+		dr, err := s.insertReplication(ctx, destinationRequest(request, d), &r.ID)
+		if err != nil {
+			if cleanupErr := s.deleteReplication(ctx, r.ID); cleanupErr != nil {
+				s.log.Warn("replication remaining after failing to create its destinations", zap.Error(cleanupErr), zap.String("id", r.ID.String()))
+			}
+			return err
+		}
+		r.Destinations = append(r.Destinations, influxdb.ReplicationDestinationStatus{
+			ReplicationID:  dr.ID,
+			RemoteID:       dr.RemoteID,
+			RemoteBucketID: dr.RemoteBucketID,
+			FanOutParentID: r.ID,
+		})
+	}
+	return nil
+}
+
+// updateDestinations applies an update of r to the replications delivering to its additional destinations, other
+// than the parts specific to r's own remote.
+func (s service) updateDestinations(ctx context.Context, r *influxdb.Replication, request influxdb.UpdateReplicationRequest) error {
+	destinations, _, err := s.destinations(ctx, []platform.ID{r.ID})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range destinations[r.ID] {
+		dr := request
+		dr.Name = nil
+		if request.Name != nil {
+			name := destinationName(*request.Name, d.RemoteID)
+			dr.Name = &name
+		}
+		dr.Description = nil
+		dr.RemoteID = nil
+		dr.RemoteBucketID = nil
+		dr.RemoteBucketTag = nil
+		dr.RemoteBucketMapping = nil
+		dr.Watermark = nil
+		if _, err := s.updateReplication(ctx, d.ReplicationID, dr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// destinations looks up the additional destinations of the given replications, keyed by replication ID, along
+// with the IDs of the replications delivering to them.
+func (s service) destinations(ctx context.Context, ids []platform.ID) (map[platform.ID][]influxdb.ReplicationDestinationStatus, []platform.ID, error) {
+	q := sq.Select("id", "remote_id", "remote_bucket_id", "latest_response_code", "latest_error_message", "fanout_parent_id").
+		From("replications").
+		Where(sq.Eq{"fanout_parent_id": ids}).
+		OrderBy("id")
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ds []influxdb.ReplicationDestinationStatus
+	if err := s.store.DB.SelectContext(ctx, &ds, query, args...); err != nil {
+		return nil, nil, err
+	}
+
+	byParent := make(map[platform.ID][]influxdb.ReplicationDestinationStatus)
+	destinationIDs := make([]platform.ID, 0, len(ds))
+	for _, d := range ds {
+		byParent[d.FanOutParentID] = append(byParent[d.FanOutParentID], d)
+		destinationIDs = append(destinationIDs, d.ReplicationID)
+	}
+	return byParent, destinationIDs, nil
+}
+
+// destinationIDs returns the IDs of the replications delivering to the additional destinations of a replication.
+func (s service) destinationIDs(ctx context.Context, id platform.ID) ([]platform.ID, error) {
+	_, ids, err := s.destinations(ctx, []platform.ID{id})
+	return ids, err
+}
+
+// setDestinations fills in the additional destinations of a replication, given the sizes of their queues.
+func setDestinations(r *influxdb.Replication, destinations map[platform.ID][]influxdb.ReplicationDestinationStatus, sizes map[platform.ID]int64) {
+	r.Destinations = destinations[r.ID]
+	for i := range r.Destinations {
+		d := &r.Destinations[i]
+		d.CurrentQueueSizeBytes = sizes[d.ReplicationID]
+		d.StatusReason = statusReason(d.LatestResponseCode, d.LatestErrorMessage)
+	}
+}
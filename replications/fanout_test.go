@@ -0,0 +1,96 @@
+package replications
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanOut(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	otherRemoteID := platform.ID(200)
+	insertRemote(t, svc.store, createReq.RemoteID)
+	insertRemote(t, svc.store, otherRemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+
+	// Each destination gets a queue of its own.
+	req := createReq
+	req.AdditionalDestinations = []influxdb.ReplicationDestination{{RemoteID: otherRemoteID, RemoteBucketID: platform.ID(55555)}}
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID+1, createReq.MaxQueueSizeBytes)
+	created, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, []influxdb.ReplicationDestinationStatus{{
+		ReplicationID:  initID + 1,
+		RemoteID:       otherRemoteID,
+		RemoteBucketID: platform.ID(55555),
+		FanOutParentID: initID,
+	}}, created.Destinations)
+
+	// The destination is reported with the replication, with its own queue size, and left out of listings.
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID, initID + 1}).
+		Return(map[platform.ID]int64{initID: 10, initID + 1: 20}, nil).Times(2)
+	got, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Len(t, got.Destinations, 1)
+	require.Equal(t, int64(20), got.Destinations[0].CurrentQueueSizeBytes)
+	rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID})
+	require.NoError(t, err)
+	require.Len(t, rs.Replications, 1)
+	require.Equal(t, got.Destinations, rs.Replications[0].Destinations)
+
+	// The destination can still be fetched on its own.
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID + 1}).
+		Return(map[platform.ID]int64{initID + 1: 20}, nil)
+	dest, err := svc.GetReplication(ctx, initID+1)
+	require.NoError(t, err)
+	require.Equal(t, otherRemoteID, dest.RemoteID)
+	require.Equal(t, initID, *dest.FanOutParentID)
+	require.Equal(t, destinationName(createReq.Name, otherRemoteID), dest.Name)
+
+	// Updates to the replication's settings apply to its destinations, but not those of its own remote.
+	newSize := 2 * createReq.MaxQueueSizeBytes
+	newBucketID := platform.ID(66666)
+	mocks.durableQueueManager.EXPECT().UpdateMaxQueueSize(initID, newSize)
+	mocks.durableQueueManager.EXPECT().UpdateMaxQueueSize(initID+1, newSize)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes(gomock.Any()).Return(map[platform.ID]int64{}, nil).Times(2)
+	_, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{MaxQueueSizeBytes: &newSize, RemoteBucketID: &newBucketID})
+	require.NoError(t, err)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID + 1}).Return(map[platform.ID]int64{}, nil)
+	dest, err = svc.GetReplication(ctx, initID+1)
+	require.NoError(t, err)
+	require.Equal(t, newSize, dest.MaxQueueSizeBytes)
+	require.Equal(t, platform.ID(55555), dest.RemoteBucketID)
+
+	// Pausing and deleting the replication cover its destinations.
+	mocks.durableQueueManager.EXPECT().PauseQueue(initID)
+	mocks.durableQueueManager.EXPECT().PauseQueue(initID + 1)
+	require.NoError(t, svc.PauseReplication(ctx, initID, nil))
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID)
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID + 1)
+	require.NoError(t, svc.DeleteReplication(ctx, initID))
+	_, err = svc.GetReplication(ctx, initID+1)
+	require.Equal(t, errReplicationNotFound, err)
+}
+
+func TestFanOut_InvalidDestinations(t *testing.T) {
+	t.Parallel()
+
+	for _, destinations := range [][]influxdb.ReplicationDestination{
+		{{RemoteID: createReq.RemoteID, RemoteBucketID: platform.ID(55555)}},
+		{{RemoteID: platform.ID(200), RemoteBucketID: platform.ID(55555)}, {RemoteID: platform.ID(200), RemoteBucketID: platform.ID(66666)}},
+	} {
+		req := createReq
+		req.AdditionalDestinations = destinations
+		require.Equal(t, &influxdb.ErrInvalidReplicationDestination, req.OK())
+	}
+}
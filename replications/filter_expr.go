@@ -0,0 +1,726 @@
+package replications
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/influxdata/influxdb/v2"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+const (
+	// maxFilterExpressionLength and maxFilterExpressionNodes bound the cost of evaluating a filter expression
+	// against each point. Expressions have no loops or calls, so evaluation is linear in the number of nodes,
+	// and regular expressions are compiled up front and matched in linear time.
+	maxFilterExpressionLength = 4096
+	maxFilterExpressionNodes  = 256
+)
+
+func errInvalidFilterExpression(expr string, cause error) error {
+	return &ierrors.Error{
+		Code: ierrors.EInvalid,
+		Msg:  fmt.Sprintf("invalid filter expression %q", expr),
+		Err:  cause,
+	}
+}
+
+func errInvalidMeasurementFilter(pattern string, cause error) error {
+	return &ierrors.Error{
+		Code: ierrors.EInvalid,
+		Msg:  fmt.Sprintf("invalid measurement filter %q", pattern),
+		Err:  cause,
+	}
+}
+
+// filterExpr is a compiled filter expression, deciding whether a point is enqueued into a replication.
+//
+// Expressions compare the point's measurement, tags and fields against literals:
+//
+//	measurement == "cpu" && (tags.region == "us" || tags["host name"] =~ "^web-") && fields.usage > 90
+//
+// Supported operators are ==, !=, <, <=, >, >=, =~ and !~ (with a regex literal on the right), &&, || and !.
+// Literals are double- or single-quoted strings, numbers, true and false. Missing tags are empty strings, and
+// comparisons against missing fields or values of a different type are false (or true for != and !~).
+type filterExpr struct {
+	root       filterNode
+	usesFields bool
+}
+
+// compileFilterExpr parses and type-checks a filter expression.
+func compileFilterExpr(expr string) (*filterExpr, error) {
+	if len(expr) > maxFilterExpressionLength {
+		return nil, errInvalidFilterExpression(expr, fmt.Errorf("expression is longer than %d bytes", maxFilterExpressionLength))
+	}
+	tokens, err := lexFilterExpr(expr)
+	if err != nil {
+		return nil, errInvalidFilterExpression(expr, err)
+	}
+
+	p := filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %s", p.peek())
+	}
+	if err == nil && p.nodes > maxFilterExpressionNodes {
+		err = fmt.Errorf("expression has more than %d terms", maxFilterExpressionNodes)
+	}
+	if err == nil && !root.boolean() {
+		err = fmt.Errorf("expression must evaluate to true or false")
+	}
+	if err != nil {
+		return nil, errInvalidFilterExpression(expr, err)
+	}
+	return &filterExpr{root: root, usesFields: p.usesFields}, nil
+}
+
+// match reports whether the expression is true for the point. Points whose fields can't be parsed never match.
+func (f *filterExpr) match(p models.Point) bool {
+	ctx := filterEvalContext{point: p}
+	if f.usesFields {
+		fields, err := p.Fields()
+		if err != nil {
+			return false
+		}
+		ctx.fields = fields
+	}
+	return f.root.eval(&ctx).truthy()
+}
+
+// compileMeasurementFilter compiles a regular expression matched against the measurement of points into the
+// equivalent of the filter expression measurement =~ pattern.
+func compileMeasurementFilter(pattern string) (*filterExpr, error) {
+	if len(pattern) > maxFilterExpressionLength {
+		return nil, errInvalidMeasurementFilter(pattern, fmt.Errorf("filter is longer than %d bytes", maxFilterExpressionLength))
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errInvalidMeasurementFilter(pattern, err)
+	}
+	return &filterExpr{root: regexNode{left: measurementNode{}, re: re}}, nil
+}
+
+// compileTagFilter compiles a tag filter into the equivalent of the filter expression
+// tags.k1 == "v1" && tags.k2 == "v2" && ..., over the keys in sorted order. Missing tags are empty strings, and
+// tag filters can't have empty values, so points missing any of the tags don't match.
+func compileTagFilter(tags influxdb.ReplicationTagFilter) *filterExpr {
+	var root filterNode
+	for _, k := range tagFilterKeys(tags) {
+		node := compareNode{
+			op:    "==",
+			left:  tagNode{key: []byte(k)},
+			right: literalNode{v: filterValue{kind: valueString, s: tags[k]}},
+		}
+		if root == nil {
+			root = node
+			continue
+		}
+		root = logicalNode{and: true, left: root, right: node}
+	}
+	if root == nil {
+		return nil
+	}
+	return &filterExpr{root: root}
+}
+
+func tagFilterKeys(tags influxdb.ReplicationTagFilter) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tagFilterString formats a tag filter in sorted order, i.e. host="a", region="us".
+func tagFilterString(tags influxdb.ReplicationTagFilter) string {
+	var b strings.Builder
+	for i, k := range tagFilterKeys(tags) {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(tags[k]))
+	}
+	return b.String()
+}
+
+// and returns an expression matching the points both expressions match. A nil expression matches all points.
+func (f *filterExpr) and(g *filterExpr) *filterExpr {
+	switch {
+	case f == nil:
+		return g
+	case g == nil:
+		return f
+	}
+	return &filterExpr{
+		root:       logicalNode{and: true, left: f.root, right: g.root},
+		usesFields: f.usesFields || g.usesFields,
+	}
+}
+
+// filter returns the points matching the expression. A nil expression matches all points.
+func (f *filterExpr) filter(points []models.Point) []models.Point {
+	if f == nil {
+		return points
+	}
+	var matched []models.Point
+	for _, p := range points {
+		if f.match(p) {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// filterExprCache holds compiled filter expressions, measurement filters and tag filters, so they're compiled once rather
+// than on every write.
+type filterExprCache struct {
+	mu           sync.Mutex
+	exprs        map[string]*filterExpr
+	measurements map[string]*filterExpr
+	tags         map[string]*filterExpr
+}
+
+func newFilterExprCache() *filterExprCache {
+	return &filterExprCache{
+		exprs:        make(map[string]*filterExpr),
+		measurements: make(map[string]*filterExpr),
+		tags:         make(map[string]*filterExpr),
+	}
+}
+
+// get returns the compiled form of an expression. A nil or empty expression compiles to a nil filter.
+func (c *filterExprCache) get(expr *string) (*filterExpr, error) {
+	if expr == nil || *expr == "" {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.exprs[*expr]; ok {
+		return f, nil
+	}
+	f, err := compileFilterExpr(*expr)
+	if err != nil {
+		return nil, err
+	}
+	c.exprs[*expr] = f
+	return f, nil
+}
+
+// getMeasurementFilter returns the compiled form of a measurement filter. A nil or empty filter compiles to a nil
+// filter.
+func (c *filterExprCache) getMeasurementFilter(pattern *string) (*filterExpr, error) {
+	if pattern == nil || *pattern == "" {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.measurements[*pattern]; ok {
+		return f, nil
+	}
+	f, err := compileMeasurementFilter(*pattern)
+	if err != nil {
+		return nil, err
+	}
+	c.measurements[*pattern] = f
+	return f, nil
+}
+
+// getTagFilter returns the compiled form of a tag filter. An empty filter compiles to a nil filter.
+func (c *filterExprCache) getTagFilter(tags influxdb.ReplicationTagFilter) *filterExpr {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	key := tagFilterString(tags)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.tags[key]; ok {
+		return f
+	}
+	f := compileTagFilter(tags)
+	c.tags[key] = f
+	return f
+}
+
+// forTarget returns the filter deciding which points are enqueued into a replication: its measurement filter, tag
+// filter and filter expression combined. They're evaluated in that order, cheapest first.
+func (c *filterExprCache) forTarget(t replicationTarget) (*filterExpr, error) {
+	measurements, err := c.getMeasurementFilter(t.MeasurementFilter)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := c.get(t.FilterExpression)
+	if err != nil {
+		return nil, err
+	}
+	return measurements.and(c.getTagFilter(t.TagFilter)).and(expr), nil
+}
+
+type filterEvalContext struct {
+	point  models.Point
+	fields models.Fields
+}
+
+type filterValueKind int
+
+const (
+	valueMissing filterValueKind = iota
+	valueString
+	valueNumber
+	valueBool
+)
+
+type filterValue struct {
+	kind filterValueKind
+	s    string
+	n    float64
+	b    bool
+}
+
+func (v filterValue) truthy() bool {
+	return v.kind == valueBool && v.b
+}
+
+func boolValue(b bool) filterValue {
+	return filterValue{kind: valueBool, b: b}
+}
+
+type filterNode interface {
+	eval(ctx *filterEvalContext) filterValue
+	// boolean reports whether the node always evaluates to a bool.
+	boolean() bool
+}
+
+type literalNode struct{ v filterValue }
+
+func (n literalNode) eval(*filterEvalContext) filterValue { return n.v }
+func (n literalNode) boolean() bool                       { return n.v.kind == valueBool }
+
+type measurementNode struct{}
+
+func (measurementNode) eval(ctx *filterEvalContext) filterValue {
+	return filterValue{kind: valueString, s: string(ctx.point.Name())}
+}
+func (measurementNode) boolean() bool { return false }
+
+type tagNode struct{ key []byte }
+
+func (n tagNode) eval(ctx *filterEvalContext) filterValue {
+	v := filterValue{kind: valueString}
+	// Walk the tags rather than calling Tags, which caches them on the point while it may be in use elsewhere.
+	ctx.point.ForEachTag(func(k, val []byte) bool {
+		if bytes.Equal(k, n.key) {
+			v.s = string(val)
+			return false
+		}
+		return true
+	})
+	return v
+}
+func (tagNode) boolean() bool { return false }
+
+type fieldNode struct{ key string }
+
+func (n fieldNode) eval(ctx *filterEvalContext) filterValue {
+	switch v := ctx.fields[n.key].(type) {
+	case float64:
+		return filterValue{kind: valueNumber, n: v}
+	case int64:
+		return filterValue{kind: valueNumber, n: float64(v)}
+	case uint64:
+		return filterValue{kind: valueNumber, n: float64(v)}
+	case string:
+		return filterValue{kind: valueString, s: v}
+	case bool:
+		return boolValue(v)
+	default:
+		return filterValue{}
+	}
+}
+func (fieldNode) boolean() bool { return false }
+
+type notNode struct{ x filterNode }
+
+func (n notNode) eval(ctx *filterEvalContext) filterValue { return boolValue(!n.x.eval(ctx).truthy()) }
+func (notNode) boolean() bool                             { return true }
+
+type logicalNode struct {
+	and         bool
+	left, right filterNode
+}
+
+func (n logicalNode) eval(ctx *filterEvalContext) filterValue {
+	left := n.left.eval(ctx).truthy()
+	if n.and != left {
+		// Short-circuit: false && x, or true || x.
+		return boolValue(left)
+	}
+	return boolValue(n.right.eval(ctx).truthy())
+}
+func (logicalNode) boolean() bool { return true }
+
+type compareNode struct {
+	op          string
+	left, right filterNode
+}
+
+func (n compareNode) eval(ctx *filterEvalContext) filterValue {
+	l, r := n.left.eval(ctx), n.right.eval(ctx)
+	if l.kind != r.kind || l.kind == valueMissing {
+		return boolValue(n.op == "!=")
+	}
+
+	var cmp int
+	switch l.kind {
+	case valueString:
+		cmp = strings.Compare(l.s, r.s)
+	case valueNumber:
+		switch {
+		case l.n < r.n:
+			cmp = -1
+		case l.n > r.n:
+			cmp = 1
+		}
+	case valueBool:
+		if l.b != r.b {
+			// Bools are only ordered for equality.
+			return boolValue(n.op == "!=")
+		}
+		if n.op != "==" && n.op != "!=" {
+			return boolValue(false)
+		}
+	}
+
+	switch n.op {
+	case "==":
+		return boolValue(cmp == 0)
+	case "!=":
+		return boolValue(cmp != 0)
+	case "<":
+		return boolValue(cmp < 0)
+	case "<=":
+		return boolValue(cmp <= 0)
+	case ">":
+		return boolValue(cmp > 0)
+	default: // ">="
+		return boolValue(cmp >= 0)
+	}
+}
+func (compareNode) boolean() bool { return true }
+
+type regexNode struct {
+	negate bool
+	left   filterNode
+	re     *regexp.Regexp
+}
+
+func (n regexNode) eval(ctx *filterEvalContext) filterValue {
+	v := n.left.eval(ctx)
+	if v.kind != valueString {
+		return boolValue(n.negate)
+	}
+	return boolValue(n.re.MatchString(v.s) != n.negate)
+}
+func (regexNode) boolean() bool { return true }
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+func (t filterToken) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q at offset %d", t.text, t.pos)
+}
+
+var filterOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", "."}
+
+func lexFilterExpr(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			s, n, err := lexFilterString(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at offset %d", err, i)
+			}
+			tokens = append(tokens, filterToken{kind: tokString, text: s, pos: i})
+			i += n
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(expr) && strings.ContainsRune("0123456789.eE+-", rune(expr[j])) {
+				if (expr[j] == '+' || expr[j] == '-') && expr[j-1] != 'e' && expr[j-1] != 'E' {
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokNumber, text: expr[i:j], pos: i})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j]))) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokIdent, text: expr[i:j], pos: i})
+			i = j
+		default:
+			var op string
+			for _, candidate := range filterOperators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			tokens = append(tokens, filterToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, filterToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+// lexFilterString reads a quoted string literal, returning its unescaped value and its length in the input.
+func lexFilterString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			i++
+			b.WriteByte(s[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type filterParser struct {
+	tokens     []filterToken
+	pos        int
+	nodes      int
+	usesFields bool
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *filterParser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		return fmt.Errorf("expected %q, got %s", op, p.peek())
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if !left.boolean() || !right.boolean() {
+			return nil, fmt.Errorf("operands of || must be conditions")
+		}
+		p.nodes++
+		left = logicalNode{left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if !left.boolean() || !right.boolean() {
+			return nil, fmt.Errorf("operands of && must be conditions")
+		}
+		p.nodes++
+		left = logicalNode{and: true, left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if _, ok := p.acceptOp("!"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if !x.boolean() {
+			return nil, fmt.Errorf("operand of ! must be a condition")
+		}
+		p.nodes++
+		return notNode{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := p.acceptOp("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return left, nil
+	}
+	p.nodes++
+
+	if op == "=~" || op == "!~" {
+		t := p.next()
+		if t.kind != tokString {
+			return nil, fmt.Errorf("right side of %s must be a string holding a regular expression, got %s", op, t)
+		}
+		re, err := regexp.Compile(t.text)
+		if err != nil {
+			return nil, err
+		}
+		return regexNode{negate: op == "!~", left: left, re: re}, nil
+	}
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	p.nodes++
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literalNode{v: filterValue{kind: valueString, s: t.text}}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+		return literalNode{v: filterValue{kind: valueNumber, n: n}}, nil
+	case tokOp:
+		if t.text != "(" {
+			break
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return literalNode{v: boolValue(t.text == "true")}, nil
+		case "measurement":
+			return measurementNode{}, nil
+		case "tags", "fields":
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			if t.text == "tags" {
+				return tagNode{key: []byte(key)}, nil
+			}
+			p.usesFields = true
+			return fieldNode{key: key}, nil
+		}
+		return nil, fmt.Errorf("unknown identifier %s, expected measurement, tags or fields", t)
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+// parseKey parses the key following "tags" or "fields", as either .key or ["key"].
+func (p *filterParser) parseKey() (string, error) {
+	if _, ok := p.acceptOp("."); ok {
+		t := p.next()
+		if t.kind != tokIdent {
+			return "", fmt.Errorf("expected a key after \".\", got %s", t)
+		}
+		return t.text, nil
+	}
+	if err := p.expectOp("["); err != nil {
+		return "", err
+	}
+	t := p.next()
+	if t.kind != tokString {
+		return "", fmt.Errorf("expected a quoted key, got %s", t)
+	}
+	if err := p.expectOp("]"); err != nil {
+		return "", err
+	}
+	return t.text, nil
+}
@@ -0,0 +1,320 @@
+package replications
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterExpr(t *testing.T) {
+	t.Parallel()
+
+	points := mustParsePoints(t, strings.Join([]string{
+		`cpu,region=us,host=a usage=95,idle=5i,state="busy",ok=true 1`,
+		`cpu,region=eu,host=b usage=20,idle=80i,state="idle",ok=false 2`,
+		`mem,region=us,host=a used=1024i 3`,
+		`disk,host=web-1 free=10 4`,
+	}, "\n"))
+
+	tests := []struct {
+		expr string
+		want []int
+	}{
+		{expr: `measurement == "cpu"`, want: []int{0, 1}},
+		{expr: `measurement == "cpu" && tags.region == "us"`, want: []int{0}},
+		{expr: `measurement == 'cpu' || tags["region"] == "us"`, want: []int{0, 1, 2}},
+		{expr: `!(measurement == "cpu")`, want: []int{2, 3}},
+		{expr: `measurement != "cpu" && measurement != "mem"`, want: []int{3}},
+		{expr: `fields.usage > 90`, want: []int{0}},
+		{expr: `fields.usage >= 20 && fields.usage <= 20`, want: []int{1}},
+		{expr: `fields.idle < 10`, want: []int{0}},
+		{expr: `fields.used > 1e3`, want: []int{2}},
+		{expr: `fields.state == "idle"`, want: []int{1}},
+		{expr: `fields.ok == true`, want: []int{0}},
+		{expr: `tags.host =~ "^web-"`, want: []int{3}},
+		{expr: `tags.host !~ "^web-"`, want: []int{0, 1, 2}},
+		// Missing tags are empty strings.
+		{expr: `tags.region == ""`, want: []int{3}},
+		// Comparisons against missing fields or values of another type are false, except for !=.
+		{expr: `fields.usage < 1000`, want: []int{0, 1}},
+		{expr: `fields.usage != 95`, want: []int{1, 2, 3}},
+		{expr: `fields.state > 1`, want: nil},
+		{expr: `true`, want: []int{0, 1, 2, 3}},
+		{expr: `(false)`, want: nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := compileFilterExpr(tt.expr)
+			require.NoError(t, err)
+
+			var got []int
+			for i, p := range points {
+				if f.match(p) {
+					got = append(got, i)
+				}
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFilterExpr_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{
+		``,
+		`measurement`,
+		`measurement ==`,
+		`measurement == "cpu" &&`,
+		`measurement == "cpu`,
+		`(measurement == "cpu"`,
+		`measurement == "cpu")`,
+		`host == "a"`,
+		`tags.`,
+		`tags[region] == "us"`,
+		`tags.host =~ fields.pattern`,
+		`tags.host =~ "("`,
+		`measurement == "cpu" && fields.usage`,
+		`!fields.usage`,
+		`measurement = "cpu"`,
+		`measurement == "cpu" ; drop`,
+		strings.Repeat(`measurement == "cpu" || `, 100) + `true`,
+		strings.Repeat("(", maxFilterExpressionLength) + "true",
+	} {
+		_, err := compileFilterExpr(expr)
+		require.Error(t, err, expr)
+		require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err), expr)
+	}
+}
+
+func TestWritePoints_FilterExpression(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	mocks.bucketSvc.EXPECT().RLock().Times(3)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(3)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(3)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	// Invalid expressions are rejected up front.
+	invalid := `measurement ==`
+	req := createReq
+	req.FilterExpression = &invalid
+	_, err := svc.CreateReplication(ctx, req)
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+
+	// Register a filtered and an unfiltered replication on the same bucket.
+	expr := `measurement == "cpu" && tags.region == "us"`
+	req.Name = "filtered"
+	req.FilterExpression = &expr
+
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, req} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		r, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, req.FilterExpression, r.FilterExpression)
+	}
+	unfilteredID, filteredID := initID, initID+1
+
+	enqueued := func(id platform.ID) *string {
+		var lp string
+		mocks.durableQueueManager.EXPECT().EnqueueData(id, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			gzr, err := gzip.NewReader(bytes.NewReader(data))
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			_, err = buf.ReadFrom(gzr)
+			require.NoError(t, err)
+			lp = buf.String()
+			return nil
+		})
+		return &lp
+	}
+
+	points := mustParsePoints(t, "cpu,region=us value=1 1\ncpu,region=eu value=2 2\nmem,region=us value=3 3")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	unfiltered, filtered := enqueued(unfilteredID), enqueued(filteredID)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, "cpu,region=us value=1 1\ncpu,region=eu value=2 2\nmem,region=us value=3 3\n", *unfiltered)
+	require.Equal(t, "cpu,region=us value=1 1\n", *filtered)
+
+	// Writes with no matching points aren't enqueued into the filtered replication at all.
+	points = mustParsePoints(t, "mem,region=us value=4 4")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	unfiltered = enqueued(unfilteredID)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, "mem,region=us value=4 4\n", *unfiltered)
+
+	// Removing the filter replicates everything again.
+	empty := ""
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{filteredID}).Return(map[platform.ID]int64{filteredID: 0}, nil)
+	r, err := svc.UpdateReplication(ctx, filteredID, influxdb.UpdateReplicationRequest{FilterExpression: &empty})
+	require.NoError(t, err)
+	require.Nil(t, r.FilterExpression)
+
+	_, err = svc.UpdateReplication(ctx, filteredID, influxdb.UpdateReplicationRequest{FilterExpression: &invalid})
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+}
+
+func TestWritePoints_MeasurementFilter(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	mocks.bucketSvc.EXPECT().RLock().Times(3)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(3)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(3)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	// Invalid regular expressions are rejected up front.
+	invalid := `^(cpu`
+	req := createReq
+	req.MeasurementFilter = &invalid
+	_, err := svc.CreateReplication(ctx, req)
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+
+	// Register replications of the same bucket with different filters: one taking cpu and mem, and one taking
+	// only the cpu points of the us region.
+	cpuAndMem, cpu, usOnly := `^(cpu|mem)$`, `^cpu$`, `tags.region == "us"`
+	req.Name = "cpu and mem"
+	req.MeasurementFilter = &cpuAndMem
+	usReq := createReq
+	usReq.Name = "us cpu"
+	usReq.MeasurementFilter = &cpu
+	usReq.FilterExpression = &usOnly
+	for _, req := range []influxdb.CreateReplicationRequest{req, usReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		r, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, req.MeasurementFilter, r.MeasurementFilter)
+	}
+	cpuAndMemID, usID := initID, initID+1
+
+	enqueued := func(id platform.ID) *string {
+		var lp string
+		mocks.durableQueueManager.EXPECT().EnqueueData(id, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			lp = string(gunzip(t, data))
+			return nil
+		})
+		return &lp
+	}
+
+	// The local bucket gets every point, while each replication only gets the points passing its own filters.
+	points := mustParsePoints(t, "cpu,region=us value=1 1\ncpu,region=eu value=2 2\nmem,region=us value=3 3\ncpus,region=us value=4 4\ndisk,region=us value=5 5")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	gotCPUAndMem, gotUS := enqueued(cpuAndMemID), enqueued(usID)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, "cpu,region=us value=1 1\ncpu,region=eu value=2 2\nmem,region=us value=3 3\n", *gotCPUAndMem)
+	require.Equal(t, "cpu,region=us value=1 1\n", *gotUS)
+
+	// Routing is explained by the measurement filter.
+	decisions, err := svc.ExplainRouting(ctx, replication.OrgID, replication.LocalBucketID, points[2])
+	require.NoError(t, err)
+	require.Len(t, decisions, 2)
+	require.True(t, decisions[0].Included)
+	require.False(t, decisions[1].Included)
+	require.Contains(t, decisions[1].Reason, "measurement filter")
+
+	// Removing the measurement filter replicates every measurement again.
+	empty := ""
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{cpuAndMemID}).Return(map[platform.ID]int64{cpuAndMemID: 0}, nil)
+	r, err := svc.UpdateReplication(ctx, cpuAndMemID, influxdb.UpdateReplicationRequest{MeasurementFilter: &empty})
+	require.NoError(t, err)
+	require.Nil(t, r.MeasurementFilter)
+
+	points = mustParsePoints(t, "disk,region=us value=6 6")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	gotCPUAndMem = enqueued(cpuAndMemID)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, "disk,region=us value=6 6\n", *gotCPUAndMem)
+
+	_, err = svc.UpdateReplication(ctx, cpuAndMemID, influxdb.UpdateReplicationRequest{MeasurementFilter: &invalid})
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+}
+
+func TestWritePoints_TagFilter(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	mocks.bucketSvc.EXPECT().RLock().Times(3)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(3)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(3)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	// Empty values are rejected up front.
+	req := createReq
+	req.TagFilter = influxdb.ReplicationTagFilter{"region": ""}
+	_, err := svc.CreateReplication(ctx, req)
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+
+	// Register replications of the same bucket with different tag filters: one taking the us region, and one
+	// taking only host a in the us region.
+	req.Name = "us"
+	req.TagFilter = influxdb.ReplicationTagFilter{"region": "us"}
+	hostReq := createReq
+	hostReq.Name = "us host a"
+	hostReq.TagFilter = influxdb.ReplicationTagFilter{"region": "us", "host": "a"}
+	for _, req := range []influxdb.CreateReplicationRequest{req, hostReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		r, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, req.TagFilter, r.TagFilter)
+	}
+	usID, hostID := initID, initID+1
+
+	enqueued := func(id platform.ID) *string {
+		var lp string
+		mocks.durableQueueManager.EXPECT().EnqueueData(id, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			lp = string(gunzip(t, data))
+			return nil
+		})
+		return &lp
+	}
+
+	// The local bucket gets every point. Points missing a filtered tag don't match, and every constraint of a
+	// filter must match.
+	points := mustParsePoints(t, "cpu,host=a,region=us value=1 1\ncpu,host=b,region=us value=2 2\ncpu,host=a,region=eu value=3 3\ncpu,host=a value=4 4\ncpu value=5 5")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	gotUS, gotHost := enqueued(usID), enqueued(hostID)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, "cpu,host=a,region=us value=1 1\ncpu,host=b,region=us value=2 2\n", *gotUS)
+	require.Equal(t, "cpu,host=a,region=us value=1 1\n", *gotHost)
+
+	// Routing is explained by the tag filter.
+	decisions, err := svc.ExplainRouting(ctx, replication.OrgID, replication.LocalBucketID, points[1])
+	require.NoError(t, err)
+	require.Len(t, decisions, 2)
+	require.True(t, decisions[0].Included)
+	require.False(t, decisions[1].Included)
+	require.Contains(t, decisions[1].Reason, "tag filter")
+
+	// Removing the tag filter replicates every point again.
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{usID}).Return(map[platform.ID]int64{usID: 0}, nil)
+	r, err := svc.UpdateReplication(ctx, usID, influxdb.UpdateReplicationRequest{TagFilter: influxdb.ReplicationTagFilter{}})
+	require.NoError(t, err)
+	require.Nil(t, r.TagFilter)
+
+	points = mustParsePoints(t, "cpu value=6 6")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	gotUS = enqueued(usID)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, "cpu value=6 6\n", *gotUS)
+
+	_, err = svc.UpdateReplication(ctx, usID, influxdb.UpdateReplicationRequest{TagFilter: influxdb.ReplicationTagFilter{"": "us"}})
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+}
@@ -0,0 +1,53 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+)
+
+func errFlushTimeout(id platform.ID, remaining int64, err error) error {
+	return &ierrors.Error{
+		Code: ierrors.EUnavailable,
+		Msg:  fmt.Sprintf("timed out flushing the queue of replication %q with %d point(s) left; check that its remote is reachable", id, remaining),
+		Err:  err,
+	}
+}
+
+// FlushReplication sends the data queued for a replication to its remote straight away, and waits until its queue
+// is empty, i.e. before decommissioning the node. If ctx is done first, i.e. because the remote is unreachable, it
+// returns the number of points left in the queue and an EUnavailable error. Paused replications can't be flushed.
+func (s service) FlushReplication(ctx context.Context, id platform.ID) (int64, error) {
+	q := sq.Select("id").From("replications").Where(sq.Eq{"id": id})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var found platform.ID
+	if err := s.store.DB.GetContext(ctx, &found, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errReplicationNotFound
+		}
+		return 0, err
+	}
+
+	remaining, err := s.durableQueueManager.Flush(ctx, id)
+	switch {
+	case errors.Is(err, internal.ErrFlushTimeout):
+		return remaining, errFlushTimeout(id, remaining, err)
+	case errors.Is(err, internal.ErrFlushPaused):
+		return 0, &ierrors.Error{
+			Code: ierrors.EConflict,
+			Msg:  fmt.Sprintf("replication %q is paused; resume it before flushing its queue", id),
+		}
+	case err != nil:
+		return 0, err
+	}
+	return 0, nil
+}
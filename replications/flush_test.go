@@ -0,0 +1,48 @@
+package replications
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushReplication(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	_, err := svc.FlushReplication(ctx, initID)
+	require.Equal(t, errReplicationNotFound, err)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err = svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	mocks.durableQueueManager.EXPECT().Flush(gomock.Any(), initID).Return(int64(0), nil)
+	remaining, err := svc.FlushReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Zero(t, remaining)
+
+	// If the remote is unreachable, the points left in the queue are reported along with the timeout.
+	timeoutErr := fmt.Errorf("%w: 12 points remain: %v", internal.ErrFlushTimeout, context.DeadlineExceeded)
+	mocks.durableQueueManager.EXPECT().Flush(gomock.Any(), initID).Return(int64(12), timeoutErr)
+	remaining, err = svc.FlushReplication(ctx, initID)
+	require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+	require.Contains(t, err.Error(), "12 point(s) left")
+	require.Equal(t, int64(12), remaining)
+
+	mocks.durableQueueManager.EXPECT().Flush(gomock.Any(), initID).Return(int64(0), internal.ErrFlushPaused)
+	_, err = svc.FlushReplication(ctx, initID)
+	require.Equal(t, ierrors.EConflict, ierrors.ErrorCode(err))
+}
@@ -0,0 +1,63 @@
+package replications
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+const (
+	// nearlyFullQueueFraction is how full a replication's queue can get before the replication is degraded.
+	nearlyFullQueueFraction = 0.9
+	// successOverdueThreshold is how long a replication with queued data can go without delivering any of it
+	// to the remote before it's degraded.
+	successOverdueThreshold = 15 * time.Minute
+)
+
+// setHealth fills in the status of a replication whose queue size, latest status and pause state are set.
+// In order:
+//   - paused replications are paused, whatever else is going on;
+//   - replications are failing if points can't be queued because the queue is full or unwritable, or if
+//     their last write to the remote failed and their queue is growing. Without enough samples to tell
+//     whether the queue is growing, any queued data counts as growing;
+//   - replications are degraded if their last write failed, their queue is at least 90% full, or they
+//     have queued data but haven't delivered anything for successOverdueThreshold;
+//   - otherwise they're healthy.
+func (s service) setHealth(r *influxdb.Replication, now time.Time) {
+	rate, ok := s.queueGrowth.rate(r.ID)
+	r.Status = replicationHealth(r, now, rate, ok)
+}
+
+func replicationHealth(r *influxdb.Replication, now time.Time, growthRate float64, growthKnown bool) influxdb.ReplicationHealth {
+	if r.Paused {
+		return influxdb.ReplicationPaused
+	}
+
+	failed := lastWriteFailed(r)
+	growing := growthRate > 0
+	if !growthKnown {
+		growing = r.CurrentQueueSizeBytes > 0
+	}
+	if r.QueueFull || r.QueueUnwritable || (failed && growing) {
+		return influxdb.ReplicationFailing
+	}
+
+	nearlyFull := r.MaxQueueSizeBytes > 0 &&
+		float64(r.CurrentQueueSizeBytes) >= nearlyFullQueueFraction*float64(r.MaxQueueSizeBytes)
+	overdue := r.CurrentQueueSizeBytes > 0 && r.LatestSuccessAt != nil &&
+		now.Sub(*r.LatestSuccessAt) > successOverdueThreshold
+	if failed || nearlyFull || overdue {
+		return influxdb.ReplicationDegraded
+	}
+	return influxdb.ReplicationHealthy
+}
+
+// lastWriteFailed reports whether the latest write to the remote failed. Stale statuses have already been
+// cleared, so don't count.
+func lastWriteFailed(r *influxdb.Replication) bool {
+	if r.LatestResponseCode == nil {
+		return r.LatestErrorMessage != nil
+	}
+	code := *r.LatestResponseCode
+	return code < 200 || code >= 300
+}
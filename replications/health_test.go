@@ -0,0 +1,129 @@
+package replications
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestReplicationHealth(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, time.October, 1, 12, 0, 0, 0, time.UTC)
+	ok, unavailable := int32(204), int32(503)
+	refused := "dial tcp: connection refused"
+	recent, overdue := now.Add(-time.Minute), now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		r         influxdb.Replication
+		rate      float64
+		rateKnown bool
+		want      influxdb.ReplicationHealth
+	}{
+		{
+			name: "nothing sent yet",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100},
+			want: influxdb.ReplicationHealthy,
+		},
+		{
+			name: "delivering",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, CurrentQueueSizeBytes: 10, LatestResponseCode: &ok, LatestSuccessAt: &recent},
+			want: influxdb.ReplicationHealthy,
+		},
+		{
+			name: "paused while failing",
+			r:    influxdb.Replication{Paused: true, QueueFull: true, LatestResponseCode: &unavailable},
+			want: influxdb.ReplicationPaused,
+		},
+		{
+			name: "failed with empty queue",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, LatestResponseCode: &unavailable},
+			want: influxdb.ReplicationDegraded,
+		},
+		{
+			name:      "failed with shrinking queue",
+			r:         influxdb.Replication{MaxQueueSizeBytes: 100, CurrentQueueSizeBytes: 10, LatestErrorMessage: &refused},
+			rate:      -5,
+			rateKnown: true,
+			want:      influxdb.ReplicationDegraded,
+		},
+		{
+			name:      "failed with growing queue",
+			r:         influxdb.Replication{MaxQueueSizeBytes: 100, CurrentQueueSizeBytes: 10, LatestResponseCode: &unavailable},
+			rate:      5,
+			rateKnown: true,
+			want:      influxdb.ReplicationFailing,
+		},
+		{
+			name: "failed with queued data and unknown growth",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, CurrentQueueSizeBytes: 10, LatestErrorMessage: &refused},
+			want: influxdb.ReplicationFailing,
+		},
+		{
+			name: "nearly full",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, CurrentQueueSizeBytes: 90, LatestResponseCode: &ok, LatestSuccessAt: &recent},
+			want: influxdb.ReplicationDegraded,
+		},
+		{
+			name: "full",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, CurrentQueueSizeBytes: 100, QueueFull: true, LatestResponseCode: &ok},
+			want: influxdb.ReplicationFailing,
+		},
+		{
+			name: "unwritable",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, QueueUnwritable: true},
+			want: influxdb.ReplicationFailing,
+		},
+		{
+			name: "no recent success with queued data",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, CurrentQueueSizeBytes: 10, LatestSuccessAt: &overdue},
+			want: influxdb.ReplicationDegraded,
+		},
+		{
+			name: "no recent success with empty queue",
+			r:    influxdb.Replication{MaxQueueSizeBytes: 100, LatestResponseCode: &ok, LatestSuccessAt: &overdue},
+			want: influxdb.ReplicationHealthy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, replicationHealth(&tt.r, now, tt.rate, tt.rateKnown))
+		})
+	}
+}
+
+func TestGetReplication_Status(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	created, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	require.Equal(t, influxdb.ReplicationHealthy, created.Status)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 1234}, nil).AnyTimes()
+
+	svc.stats = newStatsRecorder(svc.store, zaptest.NewLogger(t))
+	write := svc.stats.observe(func(platform.ID, []byte) error { return errors.New("dial tcp: connection refused") })
+	require.Error(t, write(initID, nil))
+
+	r, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, influxdb.ReplicationFailing, r.Status)
+
+	rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID})
+	require.NoError(t, err)
+	require.Equal(t, influxdb.ReplicationFailing, rs.Replications[0].Status)
+}
@@ -0,0 +1,156 @@
+package replications
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+)
+
+const (
+	defaultHTTPConfigCacheSize = 1024
+	defaultHTTPConfigCacheTTL  = time.Minute
+)
+
+// httpConfigCache is a size-bounded LRU cache of resolved HTTP configs, so sending and validating don't
+// need to read them from SQLite every time. It holds both the full configs of replications, and the remote
+// parts of configs keyed by remote ID. Entries expire after a TTL as a backstop to explicit invalidation.
+//
+// A nil cache is valid, and never holds anything.
+type httpConfigCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // of *httpConfigCacheEntry, most recently used first
+	entries map[httpConfigCacheKey]*list.Element
+}
+
+type httpConfigCacheKey struct {
+	// remote is set for entries holding only the config of a remote, keyed by the remote's ID.
+	remote bool
+	id     platform.ID
+}
+
+type httpConfigCacheEntry struct {
+	key      httpConfigCacheKey
+	remoteID platform.ID
+	conf     internal.ReplicationHTTPConfig
+	expires  time.Time
+}
+
+func newHTTPConfigCache(size int, ttl time.Duration) *httpConfigCache {
+	if size <= 0 {
+		return nil
+	}
+	return &httpConfigCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: make(map[httpConfigCacheKey]*list.Element),
+	}
+}
+
+// getReplication returns a copy of the cached config of a replication.
+func (c *httpConfigCache) getReplication(replicationID platform.ID) (*internal.ReplicationHTTPConfig, bool) {
+	return c.get(httpConfigCacheKey{id: replicationID})
+}
+
+// getRemote returns a copy of the cached config of a remote. Only its remote fields are set.
+func (c *httpConfigCache) getRemote(remoteID platform.ID) (*internal.ReplicationHTTPConfig, bool) {
+	return c.get(httpConfigCacheKey{remote: true, id: remoteID})
+}
+
+func (c *httpConfigCache) putReplication(replicationID, remoteID platform.ID, conf internal.ReplicationHTTPConfig) {
+	c.put(httpConfigCacheKey{id: replicationID}, remoteID, conf)
+}
+
+func (c *httpConfigCache) putRemote(remoteID platform.ID, conf internal.ReplicationHTTPConfig) {
+	c.put(httpConfigCacheKey{remote: true, id: remoteID}, remoteID, conf)
+}
+
+func (c *httpConfigCache) get(key httpConfigCacheKey) (*internal.ReplicationHTTPConfig, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*httpConfigCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+
+	conf := entry.conf
+	return &conf, true
+}
+
+func (c *httpConfigCache) put(key httpConfigCacheKey, remoteID platform.ID, conf internal.ReplicationHTTPConfig) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&httpConfigCacheEntry{
+		key:      key,
+		remoteID: remoteID,
+		conf:     conf,
+		expires:  c.now().Add(c.ttl),
+	})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidateReplication drops the cached config of a replication.
+func (c *httpConfigCache) invalidateReplication(replicationID platform.ID) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[httpConfigCacheKey{id: replicationID}]; ok {
+		c.remove(elem)
+	}
+}
+
+// invalidateRemote drops the cached config of a remote, and of all replications sending to it.
+func (c *httpConfigCache) invalidateRemote(remoteID platform.ID) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*httpConfigCacheEntry).remoteID == remoteID {
+			c.remove(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *httpConfigCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*httpConfigCacheEntry).key)
+}
@@ -0,0 +1,118 @@
+package replications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	remotesMock "github.com/influxdata/influxdb/v2/remotes/mock"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPConfigCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := newHTTPConfigCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	conf := func(url string) internal.ReplicationHTTPConfig {
+		return internal.ReplicationHTTPConfig{RemoteURL: url}
+	}
+
+	c.putReplication(1, 100, conf("a"))
+	c.putRemote(100, conf("a"))
+	got, ok := c.getReplication(1)
+	require.True(t, ok)
+	require.Equal(t, "a", got.RemoteURL)
+
+	// Returned configs are copies.
+	got.RemoteURL = "changed"
+	got, _ = c.getReplication(1)
+	require.Equal(t, "a", got.RemoteURL)
+
+	// The least recently used entry is evicted once the cache is full.
+	c.putReplication(2, 200, conf("b"))
+	_, ok = c.getRemote(100)
+	require.False(t, ok)
+	_, ok = c.getReplication(1)
+	require.True(t, ok)
+
+	// Invalidating a remote drops the replications sending to it.
+	c.invalidateRemote(100)
+	_, ok = c.getReplication(1)
+	require.False(t, ok)
+	_, ok = c.getReplication(2)
+	require.True(t, ok)
+
+	// Entries expire after the TTL.
+	now = now.Add(time.Minute)
+	_, ok = c.getReplication(2)
+	require.False(t, ok)
+
+	// A disabled cache never holds anything.
+	var disabled *httpConfigCache
+	disabled.putReplication(1, 100, conf("a"))
+	_, ok = disabled.getReplication(1)
+	require.False(t, ok)
+}
+
+func TestGetFullHTTPConfig_Cached(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.configCache = newHTTPConfigCache(defaultHTTPConfigCacheSize, time.Hour)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	conf, err := svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, httpConfig, *conf)
+
+	// Changes made behind the cache's back aren't seen, since the query is skipped.
+	_, err = svc.store.DB.Exec("UPDATE remotes SET remote_url = ? WHERE id = ?", "http://moved.cloud", replication.RemoteID)
+	require.NoError(t, err)
+	conf, err = svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, httpConfig.RemoteURL, conf.RemoteURL)
+
+	var remoteConf internal.ReplicationHTTPConfig
+	require.NoError(t, svc.populateRemoteHTTPConfig(ctx, replication.RemoteID, &remoteConf))
+	require.Equal(t, "http://moved.cloud", remoteConf.RemoteURL)
+	_, err = svc.store.DB.Exec("UPDATE remotes SET remote_url = ? WHERE id = ?", "http://moved-again.cloud", replication.RemoteID)
+	require.NoError(t, err)
+	require.NoError(t, svc.populateRemoteHTTPConfig(ctx, replication.RemoteID, &remoteConf))
+	require.Equal(t, "http://moved.cloud", remoteConf.RemoteURL)
+
+	// Updating the remote through the wrapped remotes service forces a refresh.
+	ctrl := gomock.NewController(t)
+	remotesSvc := remotesMock.NewMockRemoteConnectionService(ctrl)
+	remotesSvc.EXPECT().UpdateRemoteConnection(gomock.Any(), replication.RemoteID, gomock.Any()).Return(&influxdb.RemoteConnection{}, nil)
+	_, err = NewRemoteService(remotesSvc, svc).UpdateRemoteConnection(ctx, replication.RemoteID, influxdb.UpdateRemoteConnectionRequest{})
+	require.NoError(t, err)
+
+	conf, err = svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, "http://moved-again.cloud", conf.RemoteURL)
+	require.NoError(t, svc.populateRemoteHTTPConfig(ctx, replication.RemoteID, &remoteConf))
+	require.Equal(t, "http://moved-again.cloud", remoteConf.RemoteURL)
+
+	// Updating the replication refreshes its config too.
+	newBucketID := platform.ID(12345)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	_, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{RemoteBucketID: &newBucketID})
+	require.NoError(t, err)
+	conf, err = svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, newBucketID, conf.RemoteBucketID)
+}
@@ -0,0 +1,157 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/sqlite"
+)
+
+// inFlightLimiter tracks the total size of the batches being sent to each remote at once, across all of the
+// remote's replications, and optionally caps it. Once a remote's cap is reached, the queues of its replications
+// are held back by the queue manager's send gate before reading their next batch, without tying up a sender
+// worker, and are woken once outstanding sends bring the remote below its cap again. A batch is only held back
+// before it's read, so the cap can be exceeded by the batches already being read when it's reached. This bounds
+// the memory held by send buffers when a remote is slow but still accepting writes.
+type inFlightLimiter struct {
+	store *sqlite.SqlStore
+	max   int64
+	// wake is called for each replication held back by admit once its remote is below the cap again.
+	wake func(replicationID platform.ID)
+
+	mu       sync.Mutex
+	inFlight map[platform.ID]int64                    // remote ID -> bytes
+	held     map[platform.ID]map[platform.ID]struct{} // remote ID -> replication IDs held back
+	remotes  map[platform.ID]platform.ID              // replication ID -> remote ID
+}
+
+// newInFlightLimiter creates a limiter with the given cap. A cap of zero only tracks in-flight bytes.
+func newInFlightLimiter(store *sqlite.SqlStore, maxBytesPerRemote int64) *inFlightLimiter {
+	return &inFlightLimiter{
+		store:    store,
+		max:      maxBytesPerRemote,
+		inFlight: make(map[platform.ID]int64),
+		held:     make(map[platform.ID]map[platform.ID]struct{}),
+		remotes:  make(map[platform.ID]platform.ID),
+	}
+}
+
+// limit wraps a durable queue write function, accounting each batch against the in-flight bytes of the
+// replication's remote while it's being sent.
+func (l *inFlightLimiter) limit(write func(platform.ID, []byte) error) func(platform.ID, []byte) error {
+	return func(replicationID platform.ID, data []byte) error {
+		remoteID, err := l.remoteOf(context.Background(), replicationID)
+		if err != nil {
+			return err
+		}
+
+		n := int64(len(data))
+		l.acquire(remoteID, n)
+		defer l.release(remoteID, n)
+		return write(replicationID, data)
+	}
+}
+
+// admit is the queue manager's send gate. It returns whether the replication may send its next batch, which it
+// may unless its remote is at the cap. Replications which may not are woken once the remote is below it again.
+func (l *inFlightLimiter) admit(replicationID platform.ID) bool {
+	if l.max <= 0 {
+		return true
+	}
+	remoteID, err := l.remoteOf(context.Background(), replicationID)
+	if err != nil {
+		// The send fails with the same error.
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight[remoteID] < l.max {
+		return true
+	}
+	if l.held[remoteID] == nil {
+		l.held[remoteID] = make(map[platform.ID]struct{})
+	}
+	l.held[remoteID][replicationID] = struct{}{}
+	return false
+}
+
+func (l *inFlightLimiter) acquire(remoteID platform.ID, n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight[remoteID] += n
+}
+
+func (l *inFlightLimiter) release(remoteID platform.ID, n int64) {
+	l.mu.Lock()
+	l.inFlight[remoteID] -= n
+	if l.inFlight[remoteID] == 0 {
+		delete(l.inFlight, remoteID)
+	}
+	var wake map[platform.ID]struct{}
+	if l.inFlight[remoteID] < l.max {
+		wake = l.held[remoteID]
+		delete(l.held, remoteID)
+	}
+	l.mu.Unlock()
+
+	for replicationID := range wake {
+		if l.wake != nil {
+			l.wake(replicationID)
+		}
+	}
+}
+
+// bytes returns the number of bytes currently in flight to the remote.
+func (l *inFlightLimiter) bytes(remoteID platform.ID) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight[remoteID]
+}
+
+// remoteOf returns the ID of the remote a replication currently sends to. It's cached until the replication is
+// forgotten, i.e. when it's updated to point at a different remote, or deleted.
+func (l *inFlightLimiter) remoteOf(ctx context.Context, replicationID platform.ID) (platform.ID, error) {
+	l.mu.Lock()
+	remoteID, ok := l.remotes[replicationID]
+	l.mu.Unlock()
+	if ok {
+		return remoteID, nil
+	}
+
+	q := sq.Select("remote_id").From("replications").Where(sq.Eq{"id": replicationID})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := l.store.DB.GetContext(ctx, &remoteID, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errReplicationNotFound
+		}
+		return 0, err
+	}
+
+	l.mu.Lock()
+	l.remotes[replicationID] = remoteID
+	l.mu.Unlock()
+	return remoteID, nil
+}
+
+// forget drops the cached remote of a replication.
+func (l *inFlightLimiter) forget(replicationID platform.ID) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.remotes, replicationID)
+}
@@ -0,0 +1,78 @@
+package replications
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightLimiter(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	// Three replications sending to the same remote.
+	insertRemote(t, svc.store, createReq.RemoteID)
+	ids := []platform.ID{initID, initID + 1, initID + 2}
+	for i, id := range ids {
+		mocks.bucketSvc.EXPECT().RLock()
+		mocks.bucketSvc.EXPECT().RUnlock()
+		mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+		mocks.durableQueueManager.EXPECT().InitializeQueue(id, createReq.MaxQueueSizeBytes)
+
+		req := createReq
+		req.Name = fmt.Sprintf("repl-%d", i)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+
+	const maxBytes = 100
+	l := newInFlightLimiter(svc.store, maxBytes)
+	woken := make(chan platform.ID, len(ids))
+	l.wake = func(id platform.ID) { woken <- id }
+
+	unblock := make(chan struct{})
+	sending := make(chan struct{})
+	write := l.limit(func(platform.ID, []byte) error {
+		sending <- struct{}{}
+		<-unblock
+		return nil
+	})
+
+	// Replications may send until their remote reaches the cap.
+	require.True(t, l.admit(ids[0]))
+	done := make(chan error)
+	go func() { done <- write(ids[0], make([]byte, 60)) }()
+	<-sending
+	require.True(t, l.admit(ids[1]))
+	go func() { done <- write(ids[1], make([]byte, 60)) }()
+	<-sending
+	require.Equal(t, int64(120), l.bytes(createReq.RemoteID))
+
+	// At the cap, the remote's replications are held back instead of blocking, and woken once it's below it.
+	require.False(t, l.admit(ids[1]))
+	require.False(t, l.admit(ids[2]))
+	unblock <- struct{}{}
+	require.NoError(t, <-done)
+	require.ElementsMatch(t, []platform.ID{ids[1], ids[2]}, []platform.ID{<-woken, <-woken})
+	require.True(t, l.admit(ids[2]))
+	unblock <- struct{}{}
+	require.NoError(t, <-done)
+	require.Zero(t, l.bytes(createReq.RemoteID))
+
+	// Remotes are cached until the replication is forgotten.
+	_, err := svc.store.DB.Exec("DELETE FROM replications WHERE id = ?", ids[2])
+	require.NoError(t, err)
+	remoteID, err := l.remoteOf(ctx, ids[2])
+	require.NoError(t, err)
+	require.Equal(t, createReq.RemoteID, remoteID)
+	l.forget(ids[2])
+
+	// Writes for unknown replications fail without being sent.
+	require.Equal(t, errReplicationNotFound, write(ids[2], []byte("data")))
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Blocks appended to replication queues are prefixed with a header recording when they were enqueued: a magic
+// number followed by the enqueue time as big-endian nanoseconds since the epoch. Blocks enqueued by older versions
+// have no header. They're sent as-is, but don't contribute to the queue latency metric.
+//
+// Blocks whose number of points is known when they're enqueued use a different magic number, and the enqueue
+// time is followed by the number of points as a uvarint, so the queue's rates don't have to decompress the block
+// to count them. Blocks enqueued into queues with ordered delivery use a third magic number, and the enqueue time
+// is followed by the number of points in the block and the sequence number of each, as uvarints.
+var (
+	batchHeaderMagic          = []byte("rqt1")
+	countedBatchHeaderMagic   = []byte("rqc1")
+	sequencedBatchHeaderMagic = []byte("rqs1")
+)
+
+const batchHeaderSize = 12
+
+// encodeBatch prefixes a block of data with its enqueue time, and the number of points in it unless points is
+// negative, i.e. unknown.
+func encodeBatch(enqueuedAt time.Time, data []byte, points int64) []byte {
+	if points < 0 {
+		b := make([]byte, batchHeaderSize+len(data))
+		copy(b, batchHeaderMagic)
+		binary.BigEndian.PutUint64(b[len(batchHeaderMagic):], uint64(enqueuedAt.UnixNano()))
+		copy(b[batchHeaderSize:], data)
+		return b
+	}
+
+	b := make([]byte, batchHeaderSize, batchHeaderSize+binary.MaxVarintLen64+len(data))
+	copy(b, countedBatchHeaderMagic)
+	binary.BigEndian.PutUint64(b[len(countedBatchHeaderMagic):], uint64(enqueuedAt.UnixNano()))
+	var buf [binary.MaxVarintLen64]byte
+	b = append(b, buf[:binary.PutUvarint(buf[:], uint64(points))]...)
+	return append(b, data...)
+}
+
+// encodeSequencedBatch prefixes a block of data with its enqueue time and the sequence numbers of its points.
+func encodeSequencedBatch(enqueuedAt time.Time, data []byte, seqs []uint64) []byte {
+	b := make([]byte, batchHeaderSize, batchHeaderSize+binary.MaxVarintLen64*(len(seqs)+1)+len(data))
+	copy(b, sequencedBatchHeaderMagic)
+	binary.BigEndian.PutUint64(b[len(sequencedBatchHeaderMagic):], uint64(enqueuedAt.UnixNano()))
+	var buf [binary.MaxVarintLen64]byte
+	b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(seqs)))]...)
+	for _, seq := range seqs {
+		b = append(b, buf[:binary.PutUvarint(buf[:], seq)]...)
+	}
+	return append(b, data...)
+}
+
+var errCorruptBatchHeader = errors.New("corrupt batch header")
+
+// decodeBatch splits a block read from a queue into its enqueue time, data and the sequence numbers of its
+// points, if it has any. ok is false if the block has no header, in which case the whole block is returned as
+// the data.
+func decodeBatch(b []byte) (enqueuedAt time.Time, data []byte, seqs []uint64, ok bool, err error) {
+	// Blocks without a header were enqueued by older versions as gzipped line protocol, which can't start with
+	// any of the magic numbers.
+	if len(b) < batchHeaderSize {
+		return time.Time{}, b, nil, false, nil
+	}
+	var counted, sequenced bool
+	switch {
+	case bytes.HasPrefix(b, countedBatchHeaderMagic):
+		counted = true
+	case bytes.HasPrefix(b, sequencedBatchHeaderMagic):
+		sequenced = true
+	case !bytes.HasPrefix(b, batchHeaderMagic):
+		return time.Time{}, b, nil, false, nil
+	}
+	enqueuedAt = time.Unix(0, int64(binary.BigEndian.Uint64(b[4:batchHeaderSize])))
+	b = b[batchHeaderSize:]
+	if !counted && !sequenced {
+		return enqueuedAt, b, nil, true, nil
+	}
+
+	n, size := binary.Uvarint(b)
+	if size <= 0 {
+		return time.Time{}, nil, nil, false, errCorruptBatchHeader
+	}
+	b = b[size:]
+	if counted {
+		return enqueuedAt, b, nil, true, nil
+	}
+	// Every sequence number takes at least a byte.
+	if n > uint64(len(b)) {
+		return time.Time{}, nil, nil, false, errCorruptBatchHeader
+	}
+	seqs = make([]uint64, 0, n)
+	for i := uint64(0); i < n; i++ {
+		seq, size := binary.Uvarint(b)
+		if size <= 0 {
+			return time.Time{}, nil, nil, false, errCorruptBatchHeader
+		}
+		seqs = append(seqs, seq)
+		b = b[size:]
+	}
+	return enqueuedAt, b, seqs, true, nil
+}
+
+// batchPoints returns the number of points in a block read from a queue, as recorded in its header, or -1 if its
+// header doesn't record it.
+func batchPoints(b []byte) int64 {
+	if len(b) <= batchHeaderSize ||
+		!bytes.HasPrefix(b, countedBatchHeaderMagic) && !bytes.HasPrefix(b, sequencedBatchHeaderMagic) {
+		return -1
+	}
+	n, size := binary.Uvarint(b[batchHeaderSize:])
+	if size <= 0 {
+		return -1
+	}
+	return int64(n)
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+// bucketBatch is the sub-batch of a block of queued data sent to one remote bucket.
+type bucketBatch struct {
+	bucketID platform.ID
+	data     []byte
+}
+
+// routeToBuckets splits a block of queued data into a sub-batch per remote bucket, picking the bucket of each
+// line by its value of the given tag. Lines without the tag, or with a value missing from the mapping, go to the
+// default bucket. Sub-batches are compressed with the block's codec, and returned in the order their bucket first
+// appears in the block.
+func routeToBuckets(data []byte, tag string, mapping influxdb.RemoteBucketMapping, defaultBucket platform.ID) ([]bucketBatch, error) {
+	lines, keys, err := splitLines(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tagKey := []byte(tag)
+	index := make(map[platform.ID]int)
+	var buffers []*bytes.Buffer
+	var batches []bucketBatch
+	var compressors []Compressor
+	for i, line := range lines {
+		_, tags := models.ParseKeyBytes([]byte(keys[i]))
+		bucketID, ok := mapping[string(tags.Get(tagKey))]
+		if !ok {
+			bucketID = defaultBucket
+		}
+
+		j, ok := index[bucketID]
+		if !ok {
+			j = len(batches)
+			index[bucketID] = j
+			buf := &bytes.Buffer{}
+			cw, err := NewCompressor(BlockCompression(data), buf)
+			if err != nil {
+				return nil, err
+			}
+			buffers = append(buffers, buf)
+			compressors = append(compressors, cw)
+			batches = append(batches, bucketBatch{bucketID: bucketID})
+		}
+		if _, err := compressors[j].Write(line); err != nil {
+			return nil, err
+		}
+		if _, err := compressors[j].Write([]byte{'\n'}); err != nil {
+			return nil, err
+		}
+	}
+
+	for j, cw := range compressors {
+		if err := cw.Close(); err != nil {
+			return nil, err
+		}
+		batches[j].data = buffers[j].Bytes()
+	}
+	return batches, nil
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteWriter_RoutesToBuckets(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	received := make(map[string]string)
+	var order []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		bucket := r.URL.Query().Get("bucket")
+		received[bucket] += decompress(t, body)
+		order = append(order, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	tag := "region"
+	defaultBucket, usBucket, euBucket := platform.ID(20), platform.ID(21), platform.ID(22)
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:       server.URL,
+		RemoteBucketID:  defaultBucket,
+		RemoteBucketTag: &tag,
+		RemoteBucketMapping: influxdb.RemoteBucketMapping{
+			"us": usBucket,
+			"eu": euBucket,
+		},
+	})
+
+	for _, compression := range []influxdb.ReplicationCompression{influxdb.CompressionGzip, influxdb.CompressionZstd, influxdb.CompressionNone} {
+		t.Run(string(compression), func(t *testing.T) {
+			mu.Lock()
+			received = make(map[string]string)
+			order = nil
+			mu.Unlock()
+
+			lp := "cpu,region=eu value=1 1\n" +
+				"cpu,region=us value=2 2\n" +
+				"cpu value=3 3\n" +
+				"cpu,region=eu value=4 4\n" +
+				"cpu,region=ap value=5 5\n"
+			require.NoError(t, w.Write(id1, compress(t, compression, lp)))
+
+			mu.Lock()
+			defer mu.Unlock()
+			// Each bucket receives only its own points, in a single write per bucket.
+			require.Equal(t, []string{euBucket.String(), usBucket.String(), defaultBucket.String()}, order)
+			require.Equal(t, map[string]string{
+				euBucket.String():      "cpu,region=eu value=1 1\ncpu,region=eu value=4 4\n",
+				usBucket.String():      "cpu,region=us value=2 2\n",
+				defaultBucket.String(): "cpu value=3 3\ncpu,region=ap value=5 5\n",
+			}, received)
+		})
+	}
+}
+
+func TestRemoteWriter_RouteFailureRetriesBlock(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("bucket") == platform.ID(21).String() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	tag := "region"
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:           server.URL,
+		RemoteBucketID:      platform.ID(20),
+		RemoteBucketTag:     &tag,
+		RemoteBucketMapping: influxdb.RemoteBucketMapping{"us": platform.ID(21)},
+	})
+
+	err := w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu value=1 1\ncpu,region=us value=2 2\n"))
+	var writeErr *RemoteWriteError
+	require.ErrorAs(t, err, &writeErr)
+	require.Equal(t, http.StatusServiceUnavailable, writeErr.StatusCode)
+}
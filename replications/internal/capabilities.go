@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+const (
+	// capabilityProbeTimeout bounds each request made to a remote while probing its capabilities.
+	capabilityProbeTimeout = 10 * time.Second
+
+	// versionHeader is the header InfluxDB reports its version in, on every response.
+	versionHeader = "X-Influxdb-Version"
+)
+
+// probedEncodings are the codecs a remote's write endpoint is checked to accept.
+var probedEncodings = []influxdb.ReplicationCompression{influxdb.CompressionGzip, influxdb.CompressionZstd}
+
+// ProbeRemoteCapabilities detects what the remote of a replication supports. The remote's version is read from
+// its /health endpoint, falling back to /ping for remotes without one, and each codec is checked by writing an
+// empty batch compressed with it to the replication's remote bucket. Remotes which can't be reached, or reject
+// writes compressed with every codec as well as the credentials, fail the probe.
+func ProbeRemoteCapabilities(ctx context.Context, conf *ReplicationHTTPConfig) (*influxdb.RemoteCapabilities, error) {
+	u, err := conf.remoteURL()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newTransport(conf.transportSettings())
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport, Timeout: capabilityProbeTimeout}
+	defer transport.CloseIdleConnections()
+
+	caps := &influxdb.RemoteCapabilities{
+		Encodings:  []influxdb.ReplicationCompression{},
+		Endpoints:  []string{},
+		DetectedAt: time.Now().UTC(),
+	}
+
+	get := func(endpoint string) (*http.Response, []byte, error) {
+		eu := *u
+		eu.Path = path.Join(eu.Path, endpoint)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, eu.String(), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		conf.setRemoteHeaders(req)
+		req.Header.Set("User-Agent", userAgent)
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBodyBytes))
+		return res, body, err
+	}
+
+	res, body, err := get("/health")
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe remote: %w", err)
+	}
+	if res.StatusCode == http.StatusOK {
+		caps.Endpoints = append(caps.Endpoints, "/health")
+		var health struct {
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(body, &health) == nil {
+			caps.Version = health.Version
+		}
+	}
+	if caps.Version == "" {
+		caps.Version = res.Header.Get(versionHeader)
+	}
+	if res, _, err := get("/ready"); err == nil && res.StatusCode == http.StatusOK {
+		caps.Endpoints = append(caps.Endpoints, "/ready")
+	}
+	if caps.Version == "" {
+		if res, _, err := get("/ping"); err == nil && res.StatusCode < 300 {
+			caps.Version = res.Header.Get(versionHeader)
+		}
+	}
+	caps.APIVersion = apiVersion(caps.Version)
+	// Prometheus remote-write remotes are always sent snappy-compressed protobufs, so have no codecs to probe.
+	if conf.isPrometheusRemoteWrite() {
+		return caps, nil
+	}
+
+	for _, compression := range probedEncodings {
+		ok, err := acceptsEncoding(ctx, client, conf, compression)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			caps.Encodings = append(caps.Encodings, compression)
+		}
+	}
+	return caps, nil
+}
+
+// apiVersion returns the major API version of a remote reporting the given version of InfluxDB. Remotes which
+// don't report a version are assumed to serve the 2.x API.
+func apiVersion(version string) int {
+	if strings.HasPrefix(strings.TrimPrefix(version, "v"), "1.") {
+		return 1
+	}
+	return 2
+}
+
+// acceptsEncoding writes an empty batch compressed with the given codec to the remote bucket of a replication,
+// returning whether the remote accepted it. Responses rejecting the batch's encoding or body mean the codec isn't
+// supported; any other failure, i.e. bad credentials, fails the probe.
+func acceptsEncoding(ctx context.Context, client *http.Client, conf *ReplicationHTTPConfig, compression influxdb.ReplicationCompression) (bool, error) {
+	var buf bytes.Buffer
+	cw, err := NewCompressor(compression, &buf)
+	if err != nil {
+		return false, err
+	}
+	// A lone newline is an empty batch of line protocol.
+	if _, err := cw.Write([]byte("\n")); err != nil {
+		return false, err
+	}
+	if err := cw.Close(); err != nil {
+		return false, err
+	}
+
+	req, err := newWriteRequest(ctx, conf, buf.Bytes())
+	if err != nil {
+		return false, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to probe remote: %w", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBodyBytes))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return true, nil
+	case res.StatusCode == http.StatusUnsupportedMediaType, res.StatusCode == http.StatusBadRequest:
+		return false, nil
+	default:
+		return false, &RemoteWriteError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+}
+
+// adaptEncoding recompresses a block of queued data the remote doesn't accept the codec of, according to its
+// detected capabilities, with gzip if the remote accepts it and otherwise not at all. Blocks are returned as-is
+// if the remote hasn't been probed.
+func adaptEncoding(data []byte, caps *influxdb.RemoteCapabilities) ([]byte, error) {
+	if caps == nil || caps.AcceptsEncoding(BlockCompression(data)) {
+		return data, nil
+	}
+	compression := influxdb.CompressionNone
+	if caps.AcceptsEncoding(influxdb.CompressionGzip) {
+		compression = influxdb.CompressionGzip
+	}
+
+	zr, err := Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var buf bytes.Buffer
+	cw, err := NewCompressor(compression, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(cw, zr); err != nil {
+		return nil, err
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
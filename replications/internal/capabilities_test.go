@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+// capabilityRemote is a mock remote advertising a set of capabilities.
+type capabilityRemote struct {
+	version   string
+	health    bool
+	ready     bool
+	encodings []string
+	// writeStatus, if set, is the status all writes are rejected with.
+	writeStatus int
+}
+
+func (c capabilityRemote) start(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.version != "" {
+			w.Header().Set(versionHeader, c.version)
+		}
+		switch r.URL.Path {
+		case "/health":
+			if !c.health {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"name":"influxdb","status":"pass","version":%q}`, c.version)
+		case "/ready":
+			if !c.ready {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"ready"}`))
+		case "/ping":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v2/write":
+			if c.writeStatus != 0 {
+				w.WriteHeader(c.writeStatus)
+				return
+			}
+			encoding := r.Header.Get("Content-Encoding")
+			for _, e := range c.encodings {
+				if e == encoding {
+					_, err := io.ReadAll(r.Body)
+					require.NoError(t, err)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProbeRemoteCapabilities(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		remote capabilityRemote
+		want   influxdb.RemoteCapabilities
+	}{
+		{
+			name:   "2.x with gzip",
+			remote: capabilityRemote{version: "v2.1.1", health: true, ready: true, encodings: []string{"gzip"}},
+			want: influxdb.RemoteCapabilities{
+				Version:    "v2.1.1",
+				APIVersion: 2,
+				Encodings:  []influxdb.ReplicationCompression{influxdb.CompressionGzip},
+				Endpoints:  []string{"/health", "/ready"},
+			},
+		},
+		{
+			name:   "2.x with gzip and zstd",
+			remote: capabilityRemote{version: "v2.7.0", health: true, ready: true, encodings: []string{"gzip", "zstd"}},
+			want: influxdb.RemoteCapabilities{
+				Version:    "v2.7.0",
+				APIVersion: 2,
+				Encodings:  []influxdb.ReplicationCompression{influxdb.CompressionGzip, influxdb.CompressionZstd},
+				Endpoints:  []string{"/health", "/ready"},
+			},
+		},
+		{
+			name:   "1.x without health",
+			remote: capabilityRemote{version: "1.8.10", encodings: []string{"gzip"}},
+			want: influxdb.RemoteCapabilities{
+				Version:    "1.8.10",
+				APIVersion: 1,
+				Encodings:  []influxdb.ReplicationCompression{influxdb.CompressionGzip},
+				Endpoints:  []string{},
+			},
+		},
+		{
+			name:   "unknown version without compression",
+			remote: capabilityRemote{health: true},
+			want: influxdb.RemoteCapabilities{
+				APIVersion: 2,
+				Encodings:  []influxdb.ReplicationCompression{},
+				Endpoints:  []string{"/health"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := tt.remote.start(t)
+			caps, err := ProbeRemoteCapabilities(context.Background(), &ReplicationHTTPConfig{
+				RemoteURL:      server.URL,
+				RemoteOrgID:    platform.ID(10),
+				RemoteBucketID: platform.ID(20),
+			})
+			require.NoError(t, err)
+			require.False(t, caps.DetectedAt.IsZero())
+			caps.DetectedAt = tt.want.DetectedAt
+			require.Equal(t, tt.want, *caps)
+		})
+	}
+
+	// Remotes rejecting the credentials fail the probe.
+	server := capabilityRemote{version: "v2.1.1", health: true, writeStatus: http.StatusUnauthorized}.start(t)
+	_, err := ProbeRemoteCapabilities(context.Background(), &ReplicationHTTPConfig{RemoteURL: server.URL})
+	var writeErr *RemoteWriteError
+	require.ErrorAs(t, err, &writeErr)
+	require.Equal(t, http.StatusUnauthorized, writeErr.StatusCode)
+}
+
+func TestRemoteWriter_AdaptsToCapabilities(t *testing.T) {
+	t.Parallel()
+
+	gzipOnly := &influxdb.RemoteCapabilities{APIVersion: 2, Encodings: []influxdb.ReplicationCompression{influxdb.CompressionGzip}}
+	uncompressed := &influxdb.RemoteCapabilities{APIVersion: 2}
+
+	tests := []struct {
+		name         string
+		caps         *influxdb.RemoteCapabilities
+		compression  influxdb.ReplicationCompression
+		wantEncoding string
+	}{
+		{name: "not probed", compression: influxdb.CompressionZstd, wantEncoding: "zstd"},
+		{name: "accepted codec", caps: gzipOnly, compression: influxdb.CompressionGzip, wantEncoding: "gzip"},
+		{name: "falls back to gzip", caps: gzipOnly, compression: influxdb.CompressionZstd, wantEncoding: "gzip"},
+		{name: "falls back to uncompressed", caps: uncompressed, compression: influxdb.CompressionZstd, wantEncoding: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			bodies := make(chan []byte, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.wantEncoding, r.Header.Get("Content-Encoding"))
+				bodies <- b
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			t.Cleanup(server.Close)
+
+			w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, RemoteCapabilities: tt.caps})
+			require.NoError(t, w.Write(id1, compress(t, tt.compression, "cpu value=1 1\n")))
+			require.Equal(t, "cpu value=1 1\n", decompress(t, <-bodies))
+		})
+	}
+}
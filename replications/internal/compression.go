@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Blocks of line protocol are queued compressed with the codec of their replication at the time they were
+// enqueued. The codec of each block is detected from its leading magic number rather than looked up, so blocks
+// queued before a replication's compression was changed are still decompressed, and sent with the matching
+// Content-Encoding. Line protocol can't start with either magic number, so uncompressed blocks are told apart.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Compressor compresses line protocol into a block of queued data. Concatenated blocks compressed with the same
+// codec decompress to the concatenation of their line protocol.
+type Compressor interface {
+	io.WriteCloser
+	// Reset discards the compressor's state, to start compressing a new block into w.
+	Reset(w io.Writer)
+}
+
+// NewCompressor returns a compressor writing blocks compressed with the given codec into w. The empty codec
+// means the default, gzip.
+func NewCompressor(compression influxdb.ReplicationCompression, w io.Writer) (Compressor, error) {
+	switch compression {
+	case influxdb.CompressionGzip, "":
+		return gzip.NewWriter(w), nil
+	case influxdb.CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case influxdb.CompressionNone:
+		return &nopCompressor{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown replication compression %q", compression)
+	}
+}
+
+// nopCompressor writes blocks uncompressed.
+type nopCompressor struct {
+	w io.Writer
+}
+
+func (c *nopCompressor) Write(p []byte) (int, error) { return c.w.Write(p) }
+func (c *nopCompressor) Close() error                { return nil }
+func (c *nopCompressor) Reset(w io.Writer)           { c.w = w }
+
+// BlockCompression returns the codec a block of queued data was compressed with.
+func BlockCompression(data []byte) influxdb.ReplicationCompression {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return influxdb.CompressionGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return influxdb.CompressionZstd
+	default:
+		return influxdb.CompressionNone
+	}
+}
+
+// Decompress returns a reader of the line protocol in a block of queued data, whichever codec it was compressed
+// with.
+func Decompress(data []byte) (io.ReadCloser, error) {
+	switch BlockCompression(data) {
+	case influxdb.CompressionGzip:
+		return gzip.NewReader(bytes.NewReader(data))
+	case influxdb.CompressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+// contentEncoding returns the Content-Encoding of a block of queued data sent to the remote, or the empty string
+// if it's uncompressed.
+func contentEncoding(data []byte) string {
+	switch c := BlockCompression(data); c {
+	case influxdb.CompressionNone:
+		return ""
+	default:
+		return string(c)
+	}
+}
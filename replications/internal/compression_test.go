@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// compress returns line protocol compressed with the given codec, as it would be queued.
+func compress(tb testing.TB, compression influxdb.ReplicationCompression, lp string) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	cw, err := NewCompressor(compression, &buf)
+	require.NoError(tb, err)
+	_, err = cw.Write([]byte(lp))
+	require.NoError(tb, err)
+	require.NoError(tb, cw.Close())
+	return buf.Bytes()
+}
+
+func decompress(tb testing.TB, data []byte) string {
+	tb.Helper()
+
+	zr, err := Decompress(data)
+	require.NoError(tb, err)
+	defer zr.Close()
+	lp, err := io.ReadAll(zr)
+	require.NoError(tb, err)
+	return string(lp)
+}
+
+func TestCompression_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	const lp = "cpu,host=a value=1 1000000000\ncpu,host=b value=2 2000000000\n"
+	for _, compression := range []influxdb.ReplicationCompression{influxdb.CompressionGzip, influxdb.CompressionZstd, influxdb.CompressionNone} {
+		compression := compression
+		t.Run(string(compression), func(t *testing.T) {
+			t.Parallel()
+
+			data := compress(t, compression, lp)
+			require.Equal(t, compression, BlockCompression(data))
+			require.Equal(t, lp, decompress(t, data))
+
+			// Concatenated blocks decompress to the concatenation of their line protocol, so blocks can be
+			// combined into a single write.
+			require.Equal(t, lp+lp, decompress(t, append(append([]byte{}, data...), data...)))
+
+			// Converting the precision of a block keeps its codec.
+			converted, err := convertPrecision(data, influxdb.WritePrecisionSeconds)
+			require.NoError(t, err)
+			require.Equal(t, compression, BlockCompression(converted))
+			require.Equal(t, "cpu,host=a value=1 1\ncpu,host=b value=2 2\n", decompress(t, converted))
+
+			require.NoError(t, verifyBatch(data))
+		})
+	}
+
+	_, err := NewCompressor("lz4", io.Discard)
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+type dedupEntry struct {
+	sum    [sha256.Size]byte
+	sentAt time.Time
+}
+
+// sendDedup is a bounded set of the content hashes of blocks recently sent to a remote.
+// Hashes are forgotten once they're older than the window, or when the set holds more
+// than max entries (oldest first).
+type sendDedup struct {
+	window time.Duration
+	max    int
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries []dedupEntry
+	sums    map[[sha256.Size]byte]time.Time
+}
+
+func newSendDedup(window time.Duration, max int) *sendDedup {
+	if max <= 0 {
+		max = 1
+	}
+	return &sendDedup{
+		window: window,
+		max:    max,
+		now:    time.Now,
+		sums:   make(map[[sha256.Size]byte]time.Time),
+	}
+}
+
+func (d *sendDedup) contains(sum [sha256.Size]byte) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire()
+	_, ok := d.sums[sum]
+	return ok
+}
+
+func (d *sendDedup) add(sum [sha256.Size]byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.entries = append(d.entries, dedupEntry{sum: sum, sentAt: now})
+	d.sums[sum] = now
+	d.expire()
+}
+
+// expire drops entries which are outside of the window, or beyond the size bound.
+// Must be called with d.mu held.
+func (d *sendDedup) expire() {
+	cutoff := d.now().Add(-d.window)
+
+	var i int
+	for ; i < len(d.entries); i++ {
+		if len(d.entries)-i <= d.max && d.entries[i].sentAt.After(cutoff) {
+			break
+		}
+		// Only forget the hash if it wasn't re-added by a later send.
+		if d.sums[d.entries[i].sum].Equal(d.entries[i].sentAt) {
+			delete(d.sums, d.entries[i].sum)
+		}
+	}
+	d.entries = d.entries[i:]
+}
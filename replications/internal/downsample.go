@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+// downsample rolls up the points in a block of queued data according to ds, returning a block compressed with the
+// same codec. See influxdb.ReplicationDownsample for how fields are aggregated. Rolled-up points are written in the
+// order their series and window first appear in the block.
+func downsample(data []byte, ds *influxdb.ReplicationDownsample) ([]byte, error) {
+	zr, err := Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	lp, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	points, err := models.ParsePoints(lp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to downsample replicated data: %w", err)
+	}
+
+	window := ds.WindowSeconds * int64(time.Second)
+	type windowKey struct {
+		series string
+		start  int64
+	}
+	index := make(map[windowKey]*windowAggregate)
+	var windows []*windowAggregate
+	for _, p := range points {
+		ts := p.UnixNano()
+		start := ts - ts%window
+		if ts%window < 0 {
+			start -= window
+		}
+		key := windowKey{series: string(p.Key()), start: start}
+		w, ok := index[key]
+		if !ok {
+			w = &windowAggregate{point: p, start: start, fields: make(map[string]*fieldAggregate)}
+			index[key] = w
+			windows = append(windows, w)
+		}
+		fields, err := p.Fields()
+		if err != nil {
+			return nil, fmt.Errorf("failed to downsample replicated data: %w", err)
+		}
+		for k, v := range fields {
+			f, ok := w.fields[k]
+			if !ok {
+				w.fields[k] = newFieldAggregate(v, ts)
+				continue
+			}
+			f.add(v, ts)
+		}
+	}
+
+	var buf bytes.Buffer
+	cw, err := NewCompressor(BlockCompression(data), &buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		fields := make(models.Fields, len(w.fields))
+		for k, f := range w.fields {
+			fields[k] = f.result(ds.Aggregate)
+		}
+		p, err := models.NewPoint(string(w.point.Name()), w.point.Tags(), fields, time.Unix(0, w.start))
+		if err != nil {
+			return nil, fmt.Errorf("failed to downsample replicated data: %w", err)
+		}
+		if _, err := cw.Write(append([]byte(p.String()), '\n')); err != nil {
+			return nil, err
+		}
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// windowAggregate accumulates the points of one series within one window.
+type windowAggregate struct {
+	// point is the first point of the window, which the rolled-up point takes its measurement and tags from.
+	point  models.Point
+	start  int64
+	fields map[string]*fieldAggregate
+}
+
+// fieldAggregate accumulates the values of one field within a window. Values of a different type than the first
+// one seen, which can only come from points written to different shards of the local bucket, are skipped.
+type fieldAggregate struct {
+	count int64
+	// first is the first value seen, which fixes the field's type.
+	first interface{}
+	// sum, min and max have the field's type. fsum is the sum of the values as floats, for the mean.
+	sum, min, max interface{}
+	fsum          float64
+	// last is the value with the latest timestamp. Of values with the same timestamp, the last one seen wins.
+	last   interface{}
+	lastTs int64
+}
+
+func newFieldAggregate(v interface{}, ts int64) *fieldAggregate {
+	f := &fieldAggregate{count: 1, first: v, sum: v, min: v, max: v, last: v, lastTs: ts}
+	f.fsum, _ = toFloat(v)
+	return f
+}
+
+func (f *fieldAggregate) add(v interface{}, ts int64) {
+	if reflect.TypeOf(v) != reflect.TypeOf(f.first) {
+		return
+	}
+	f.count++
+	if ts >= f.lastTs {
+		f.last, f.lastTs = v, ts
+	}
+	if fv, ok := toFloat(v); ok {
+		f.fsum += fv
+	}
+	switch v := v.(type) {
+	case float64:
+		f.sum = f.sum.(float64) + v
+		if v < f.min.(float64) {
+			f.min = v
+		}
+		if v > f.max.(float64) {
+			f.max = v
+		}
+	case int64:
+		f.sum = f.sum.(int64) + v
+		if v < f.min.(int64) {
+			f.min = v
+		}
+		if v > f.max.(int64) {
+			f.max = v
+		}
+	case uint64:
+		f.sum = f.sum.(uint64) + v
+		if v < f.min.(uint64) {
+			f.min = v
+		}
+		if v > f.max.(uint64) {
+			f.max = v
+		}
+	}
+}
+
+// result returns the aggregate of the field's values.
+func (f *fieldAggregate) result(aggregate influxdb.DownsampleAggregate) interface{} {
+	if aggregate == influxdb.DownsampleCount {
+		return f.count
+	}
+	if _, numeric := toFloat(f.first); !numeric {
+		return f.last
+	}
+	switch aggregate {
+	case influxdb.DownsampleMean:
+		return f.fsum / float64(f.count)
+	case influxdb.DownsampleMin:
+		return f.min
+	case influxdb.DownsampleMax:
+		return f.max
+	case influxdb.DownsampleSum:
+		return f.sum
+	default:
+		return f.last
+	}
+}
+
+// toFloat returns the value of a numeric field as a float.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
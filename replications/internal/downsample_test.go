@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownsample(t *testing.T) {
+	t.Parallel()
+
+	// Two series over two 10s windows. The first series has a sparse field, and nothing in the second window for
+	// host=b.
+	lp := `cpu,host=a usage=1,count=2i,state="idle" 1000000000
+cpu,host=b usage=10 2000000000
+cpu,host=a usage=3,count=4i,state="busy",temp=50u 5000000000
+cpu,host=a usage=5,count=6i 12000000000
+`
+	for _, tc := range []struct {
+		aggregate influxdb.DownsampleAggregate
+		want      string
+	}{
+		{influxdb.DownsampleMean, `cpu,host=a count=3,state="busy",temp=50,usage=2 0
+cpu,host=b usage=10 0
+cpu,host=a count=6,usage=5 10000000000
+`},
+		{influxdb.DownsampleMax, `cpu,host=a count=4i,state="busy",temp=50u,usage=3 0
+cpu,host=b usage=10 0
+cpu,host=a count=6i,usage=5 10000000000
+`},
+		{influxdb.DownsampleSum, `cpu,host=a count=6i,state="busy",temp=50u,usage=4 0
+cpu,host=b usage=10 0
+cpu,host=a count=6i,usage=5 10000000000
+`},
+		{influxdb.DownsampleCount, `cpu,host=a count=2i,state=2i,temp=1i,usage=2i 0
+cpu,host=b usage=1i 0
+cpu,host=a count=1i,usage=1i 10000000000
+`},
+	} {
+		tc := tc
+		t.Run(string(tc.aggregate), func(t *testing.T) {
+			t.Parallel()
+
+			// The rolled-up block keeps the codec of the queued one.
+			data := compress(t, influxdb.CompressionZstd, lp)
+			got, err := downsample(data, &influxdb.ReplicationDownsample{WindowSeconds: 10, Aggregate: tc.aggregate})
+			require.NoError(t, err)
+			require.Equal(t, influxdb.CompressionZstd, BlockCompression(got))
+			require.Equal(t, tc.want, decompress(t, got))
+		})
+	}
+}
+
+func TestRemoteWriter_Downsample(t *testing.T) {
+	t.Parallel()
+
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:  server.URL,
+		Downsample: &influxdb.ReplicationDownsample{WindowSeconds: 60, Aggregate: influxdb.DownsampleLast},
+	})
+
+	// The last value is the latest one, regardless of the order points were queued in.
+	require.NoError(t, w.Write(id1, compress(t, influxdb.CompressionNone, "cpu usage=2 62000000000\ncpu usage=1 61000000000\n")))
+	require.Equal(t, "cpu usage=2 60000000000\n", <-bodies)
+}
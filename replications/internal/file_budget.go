@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SetMaxOpenFiles sets a budget for the number of files held open by all replication queues. Once the budget is
+// exceeded, the files of queues with nothing left to send are closed, least recently used first, and reopened the
+// next time data is enqueued into them. Busy queues keep their files open, so the budget can still be exceeded
+// if enough queues have data waiting to be sent. Zero (the default) means no limit.
+//
+// The open files metric is refreshed whenever queues are created or deleted, and after every enqueue while a
+// budget is set.
+func (qm *durableQueueManager) SetMaxOpenFiles(n int) {
+	qm.mutex.Lock()
+	qm.maxOpenFiles = n
+	qm.mutex.Unlock()
+
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+	qm.enforceFileBudget()
+}
+
+// OpenFiles returns the number of files held open by all replication queues.
+func (qm *durableQueueManager) OpenFiles() int {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+	return qm.openFiles()
+}
+
+func (qm *durableQueueManager) openFiles() int {
+	var n int
+	for _, rq := range qm.replicationQueues {
+		n += rq.openFiles()
+	}
+	return n
+}
+
+// enforceFileBudget closes the files of idle queues until the number of open files is within the budget, and
+// updates the open files metric. qm.mutex must be held.
+func (qm *durableQueueManager) enforceFileBudget() {
+	open := qm.openFiles()
+	if qm.maxOpenFiles > 0 && open > qm.maxOpenFiles {
+		queues := make([]*replicationQueue, 0, len(qm.replicationQueues))
+		for _, rq := range qm.replicationQueues {
+			queues = append(queues, rq)
+		}
+		sort.Slice(queues, func(i, j int) bool {
+			return queues[i].lastUsedAt().Before(queues[j].lastUsedAt())
+		})
+		for _, rq := range queues {
+			if open <= qm.maxOpenFiles {
+				break
+			}
+			open -= rq.closeIdleFiles()
+		}
+	}
+	qm.metrics.QueueOpenFiles.Set(float64(open))
+}
+
+// acquireFiles reopens the queue's files if they were closed while it was idle, and keeps them open until
+// releaseFiles is called.
+func (rq *replicationQueue) acquireFiles() error {
+	rq.filesMu.Lock()
+	defer rq.filesMu.Unlock()
+
+	if rq.filesClosed {
+		if err := rq.queue.Open(); err != nil {
+			return err
+		}
+		rq.filesClosed = false
+		rq.logger.Debug("Reopened idle replication queue")
+	}
+	rq.fileUsers++
+	rq.lastUsed = rq.now()
+	return nil
+}
+
+func (rq *replicationQueue) releaseFiles() {
+	rq.filesMu.Lock()
+	defer rq.filesMu.Unlock()
+	rq.fileUsers--
+}
+
+func (rq *replicationQueue) lastUsedAt() time.Time {
+	rq.filesMu.Lock()
+	defer rq.filesMu.Unlock()
+	return rq.lastUsed
+}
+
+// openFiles returns the number of files the queue holds open. Retry queues are never closed while idle.
+func (rq *replicationQueue) openFiles() int {
+	rq.filesMu.Lock()
+	defer rq.filesMu.Unlock()
+	var n int
+	if rq.retry != nil {
+		n = rq.retry.queue.OpenFiles()
+	}
+	if rq.filesClosed {
+		return n
+	}
+	return n + rq.queue.OpenFiles()
+}
+
+// diskUsage returns the size of the queue on disk, including its retry queue. The size of the main queue doesn't
+// change while its files are closed.
+func (rq *replicationQueue) diskUsage() int64 {
+	rq.filesMu.Lock()
+	defer rq.filesMu.Unlock()
+	var usage int64
+	if rq.retry != nil {
+		usage = rq.retry.queue.DiskUsage()
+	}
+	if rq.filesClosed {
+		return usage + rq.closedDiskUsage
+	}
+	return usage + rq.queue.DiskUsage()
+}
+
+// closeIdleFiles closes the queue's files if it isn't in use and has nothing to send, returning the number of
+// files closed.
+func (rq *replicationQueue) closeIdleFiles() int {
+	rq.filesMu.Lock()
+	defer rq.filesMu.Unlock()
+
+	if rq.filesClosed || rq.fileUsers > 0 {
+		return 0
+	}
+	rq.schedMu.Lock()
+	busy := rq.scheduled || rq.draining || rq.closed
+	rq.schedMu.Unlock()
+	if busy || !rq.queue.Empty() || (rq.retry != nil && !rq.retry.queue.Empty()) {
+		return 0
+	}
+
+	files := rq.queue.OpenFiles()
+	usage := rq.queue.DiskUsage()
+	if err := rq.queue.Close(); err != nil {
+		rq.logger.Warn("Failed to close idle replication queue", zap.Error(err))
+		return 0
+	}
+	// Reopening the queue counts its data towards its size again.
+	rq.totalSize.Add(-usage)
+	rq.closedDiskUsage = usage
+	rq.filesClosed = true
+	rq.logger.Debug("Closed idle replication queue", zap.Int("files", files))
+	return files
+}
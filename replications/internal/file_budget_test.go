@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFileBudget_IdleQueuesReleaseFiles(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	sent := make(map[platform.ID][]string)
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(id platform.ID, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[id] = append(sent[id], string(data))
+		return nil
+	})
+	defer shutdown(t, qm)
+
+	ids := []platform.ID{1, 2, 3, 4, 5}
+	for _, id := range ids {
+		require.NoError(t, qm.InitializeQueue(id, maxQueueSizeBytes))
+	}
+	waitAllIdle(qm)
+	// Each empty queue holds a single segment file open.
+	require.Equal(t, len(ids), qm.OpenFiles())
+
+	// Going over the budget closes the files of idle queues, least recently used first.
+	qm.SetMaxOpenFiles(2)
+	require.Equal(t, 2, qm.OpenFiles())
+	for _, id := range ids[:3] {
+		require.True(t, qm.replicationQueues[id].filesClosed, id)
+	}
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_open_files", nil)
+	require.Equal(t, float64(2), m.Gauge.GetValue())
+
+	// Sizes of closed queues are still reported.
+	sizes, err := qm.CurrentQueueSizes(ids)
+	require.NoError(t, err)
+	for _, id := range ids {
+		require.Equal(t, int64(8), sizes[id], id)
+	}
+
+	// Enqueueing into a closed queue reopens it, and its data is sent.
+	require.NoError(t, qm.EnqueueData(ids[0], []byte("reopened"), 1))
+	require.False(t, qm.replicationQueues[ids[0]].filesClosed)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent[ids[0]]) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "reopened", sent[ids[0]][0])
+	waitAllIdle(qm)
+
+	// The next enqueue brings the queues back within budget, closing the least recently used idle queues.
+	require.NoError(t, qm.EnqueueData(ids[1], []byte("more"), 1))
+	require.LessOrEqual(t, qm.OpenFiles(), 2)
+	require.False(t, qm.replicationQueues[ids[1]].filesClosed)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent[ids[1]]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Closing and reopening a queue doesn't count its data towards its max size twice.
+	rq := qm.replicationQueues[ids[0]]
+	require.NoError(t, rq.acquireFiles())
+	rq.releaseFiles()
+	waitAllIdle(qm)
+	before := rq.totalSize.Value()
+	require.Equal(t, 1, rq.closeIdleFiles())
+	require.NoError(t, rq.acquireFiles())
+	rq.releaseFiles()
+	require.Equal(t, before, rq.totalSize.Value())
+}
+
+func waitAllIdle(qm *durableQueueManager) {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+	for _, rq := range qm.replicationQueues {
+		waitIdle(rq)
+	}
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+)
+
+// defaultFlushPollInterval is how often Flush checks whether a queue has drained, and signals it to retry sends
+// which failed.
+const defaultFlushPollInterval = time.Second
+
+var (
+	// ErrFlushTimeout is wrapped by the errors returned by Flush when its context is done before the queue drains,
+	// i.e. because the remote is unreachable.
+	ErrFlushTimeout = errors.New("timed out waiting for replication queue to drain")
+	// ErrFlushPaused is returned by Flush for paused queues, which would never drain.
+	ErrFlushPaused = errors.New("replication queue is paused")
+)
+
+// Flush sends the data in a replication's queue to its remote straight away, ignoring its flush interval, and
+// waits until the queue and its retry queue are empty. If ctx is done first, the number of points left in the
+// queues is returned along with an error wrapping ErrFlushTimeout.
+func (qm *durableQueueManager) Flush(ctx context.Context, replicationID platform.ID) (int64, error) {
+	qm.mutex.RLock()
+	rq, exist := qm.replicationQueues[replicationID]
+	qm.mutex.RUnlock()
+	if !exist {
+		return 0, fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	if rq.isPaused() {
+		return 0, ErrFlushPaused
+	}
+
+	rq.flushMu.Lock()
+	rq.resetFlushLocked()
+	rq.flushMu.Unlock()
+	rq.signal()
+
+	ticker := time.NewTicker(qm.flushPollInterval)
+	defer ticker.Stop()
+	for {
+		if rq.drained() {
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			remaining, err := rq.pendingPoints()
+			if err != nil {
+				return 0, err
+			}
+			return remaining, fmt.Errorf("%w: %d points remain: %v", ErrFlushTimeout, remaining, ctx.Err())
+		case <-ticker.C:
+			// Sends which failed aren't retried until more data is enqueued, so the queue is signalled again.
+			rq.signal()
+		}
+	}
+}
+
+// drained returns whether the queue and its retry queue hold no data. Queues whose files were closed while idle
+// were empty when they were closed.
+func (rq *replicationQueue) drained() bool {
+	rq.filesMu.Lock()
+	defer rq.filesMu.Unlock()
+	if rq.retry != nil && rq.retry.queue.TotalBytes() > 0 {
+		return false
+	}
+	return rq.filesClosed || rq.queue.TotalBytes() == 0
+}
+
+// pendingPoints counts the points in the queue and its retry queue.
+func (rq *replicationQueue) pendingPoints() (int64, error) {
+	if err := rq.acquireFiles(); err != nil {
+		return 0, err
+	}
+	defer rq.releaseFiles()
+
+	queues := []*durablequeue.Queue{rq.queue}
+	if rq.retry != nil {
+		queues = append(queues, rq.retry.queue)
+	}
+	var n int64
+	for _, q := range queues {
+		err := q.ForEach(func(block []byte) error {
+			if points := batchPoints(block); points >= 0 {
+				n += points
+				return nil
+			}
+			_, data, _, _, err := decodeBatch(block)
+			if err != nil {
+				return err
+			}
+			points, err := countPoints(data)
+			n += points
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// countPoints counts the lines of line protocol in a compressed block.
+func countPoints(data []byte) (int64, error) {
+	zr, err := Decompress(data)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	var n int64
+	r := bufio.NewReader(zr)
+	for {
+		line, err := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && trimmed[0] != '#' {
+			n++
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// blockLines returns the lines of line protocol in a block of data, without parsing them.
+func blockLines(data []byte) ([]string, error) {
+	zr, err := Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var lines []string
+	r := bufio.NewReader(zr)
+	for {
+		line, err := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && trimmed[0] != '#' {
+			lines = append(lines, string(trimmed))
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
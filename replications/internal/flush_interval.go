@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"go.uber.org/zap"
+)
+
+// maxFlushWriteBytes caps the size of the compressed data combined into a single write by a queue with a flush
+// interval. A queue holding more than this when it's flushed sends it as several writes, back to back.
+const maxFlushWriteBytes = 4 * 1024 * 1024
+
+// SetFlushInterval sets how long a replication's queue accumulates data before sending it. Data enqueued into
+// the queue is held until the interval has passed since the first enqueue after the last flush, then everything
+// queued is sent in as few writes as possible, rather than a write per enqueue. Zero or less sends data as soon
+// as it's enqueued, which is the default.
+//
+// Queues with ordered delivery still wait for the interval, but send each enqueued block as its own write.
+func (qm *durableQueueManager) SetFlushInterval(replicationID platform.ID, interval time.Duration) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	rq.setFlushInterval(interval)
+	// Data waiting for the previous interval is sent straight away.
+	rq.signal()
+
+	return nil
+}
+
+// SetMaxWritePoints caps the number of points combined into a single write by every queue created after the call
+// with a flush interval. Queues only have one write in flight at a time, so this bounds the points a failed write
+// has to retry. Blocks with more points than the cap are sent on their own, as are blocks enqueued by older
+// versions, which don't record their number of points. Zero or less means no limit.
+func (qm *durableQueueManager) SetMaxWritePoints(n int64) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	qm.maxWritePoints = n
+}
+
+func (rq *replicationQueue) setFlushInterval(interval time.Duration) {
+	rq.flushMu.Lock()
+	defer rq.flushMu.Unlock()
+
+	if interval < 0 {
+		interval = 0
+	}
+	rq.flushInterval = interval
+	rq.resetFlushLocked()
+}
+
+func (rq *replicationQueue) getFlushInterval() time.Duration {
+	rq.flushMu.Lock()
+	defer rq.flushMu.Unlock()
+	return rq.flushInterval
+}
+
+// markPending records that data was enqueued, returning whether the queue should be signalled to send it now.
+// The first enqueue after a flush into a queue with a flush interval starts a timer to signal the queue once the
+// interval passes, and later enqueues wait for it.
+func (rq *replicationQueue) markPending() bool {
+	rq.flushMu.Lock()
+	defer rq.flushMu.Unlock()
+
+	if rq.flushInterval <= 0 {
+		return true
+	}
+	if rq.pendingSince.IsZero() {
+		rq.pendingSince = rq.now()
+		rq.flushTimer = rq.afterFunc(rq.flushInterval, rq.signal)
+	}
+	return false
+}
+
+// takeFlush returns whether the queue should send its data now, starting a new flush interval if so. Data which
+// isn't waiting for an interval, i.e. because it was left in the queue by a previous run, is sent straight away.
+func (rq *replicationQueue) takeFlush() bool {
+	rq.flushMu.Lock()
+	defer rq.flushMu.Unlock()
+
+	if rq.flushInterval <= 0 || rq.pendingSince.IsZero() {
+		return true
+	}
+	if rq.now().Before(rq.pendingSince.Add(rq.flushInterval)) {
+		return false
+	}
+	rq.resetFlushLocked()
+	return true
+}
+
+// resetFlushLocked clears the pending flush of the queue. rq.flushMu must be held.
+func (rq *replicationQueue) resetFlushLocked() {
+	rq.pendingSince = time.Time{}
+	if rq.flushTimer != nil {
+		rq.flushTimer.Stop()
+		rq.flushTimer = nil
+	}
+}
+
+// sendNext sends the next data from the main queue, combining the queued blocks into larger writes if the queue
+// has a flush interval.
+func (rq *replicationQueue) sendNext() bool {
+	if rq.getFlushInterval() > 0 && rq.getSequences() == nil {
+		return rq.sendCombined()
+	}
+	return rq.SendWrite(rq.sendOrRetry)
+}
+
+// sendCombinedPart sends combined data from the main queue through sendOrRetry, so a write which fails is moved
+// into the retry queue if the queue has one. Without one, data which follows a part already sent from the same
+// scan can't be left in place to be retried, as the scan can't advance past only some of the blocks it read, so
+// it's appended to the back of the queue instead.
+func (rq *replicationQueue) sendCombinedPart(combined []byte, enqueuedAt time.Time, hasHeader bool, points int64, sentBefore bool) error {
+	block := combined
+	if hasHeader {
+		block = encodeBatch(enqueuedAt, combined, points)
+	}
+	err := rq.sendOrRetry(block)
+	if err == nil || !sentBefore {
+		return err
+	}
+	if appendErr := rq.queue.Append(block); appendErr != nil {
+		rq.logger.Warn("Failed to requeue combined write, retrying the blocks it was read from", zap.Error(appendErr))
+		return err
+	}
+	rq.logger.Debug("Requeued combined write which failed to send", zap.Error(err))
+	return nil
+}
+
+// sendCombined sends the blocks at the head of the queue as a single write of up to maxFlushWriteBytes. The
+// compressed data of each block is concatenated, which is itself valid compressed data. Blocks compressed with a
+// different codec than the ones before them, i.e. because the replication's compression was changed, start a new
+// write, as do blocks which would take the write over the queue's cap on points. A write which fails goes through sendCombinedPart; if nothing read has been sent yet and the queue has no
+// retry queue, all of the blocks read stay in the queue to be retried.
+func (rq *replicationQueue) sendCombined() bool {
+	if rq.gated() {
+		return false
+	}
+
+	scan, err := rq.queue.NewScanner()
+	if err != nil {
+		if err != io.EOF {
+			rq.logger.Error("Error creating replications queue scanner", zap.Error(err))
+		}
+		return false
+	}
+
+	var (
+		combined   []byte
+		enqueuedAt time.Time
+		hasHeader  bool
+		points     int64
+		sent       bool
+	)
+	for scan.Next() {
+		if scan.Err() == io.EOF {
+			break
+		}
+		if scan.Err() != nil {
+			rq.logger.Info("Segment read error.", zap.Error(scan.Err()))
+			break
+		}
+
+		at, b, _, ok, err := decodeBatch(scan.Bytes())
+		if err != nil {
+			if err := rq.quarantine(scan.Bytes(), err); err != nil {
+				rq.logger.Error("Error in replication stream", zap.Error(err))
+				return false
+			}
+			continue
+		}
+		if rq.verify {
+			if err := verifyBatch(b); err != nil {
+				if err := rq.quarantine(b, err); err != nil {
+					rq.logger.Error("Error in replication stream", zap.Error(err))
+					return false
+				}
+				continue
+			}
+		}
+
+		n := batchPoints(scan.Bytes())
+		if len(combined) > 0 && (BlockCompression(b) != BlockCompression(combined) || rq.overPointsCap(points, n)) {
+			if err := rq.sendCombinedPart(combined, enqueuedAt, hasHeader, points, sent); err != nil {
+				rq.logger.Error("Error in replication stream", zap.Error(err))
+				return false
+			}
+			sent = true
+			combined, enqueuedAt, hasHeader, points = nil, time.Time{}, false, 0
+		}
+
+		// The latency of the combined write is measured from the oldest block in it.
+		if ok && (!hasHeader || at.Before(enqueuedAt)) {
+			enqueuedAt, hasHeader = at, true
+		}
+		// The combined write's number of points is only known if every block's is.
+		if n >= 0 && points >= 0 {
+			points += n
+		} else {
+			points = -1
+		}
+		combined = append(combined, b...)
+		if len(combined) >= maxFlushWriteBytes {
+			break
+		}
+	}
+
+	if len(combined) > 0 {
+		if err := rq.sendCombinedPart(combined, enqueuedAt, hasHeader, points, sent); err != nil {
+			rq.logger.Error("Error in replication stream", zap.Error(err))
+			return false
+		}
+	}
+
+	_, err = scan.Advance()
+	rq.recordSize()
+	if err != nil {
+		if err != io.EOF {
+			rq.logger.Error("Error in replication queue scanner", zap.Error(err))
+		}
+		return false
+	}
+	return true
+}
+
+// overPointsCap returns whether adding a block of n points to a write of points points takes it over the queue's
+// cap on points. A count of -1 means the number isn't known: blocks of unknown size are only kept out of writes
+// already at the cap, and writes of unknown size are never over it.
+func (rq *replicationQueue) overPointsCap(points, n int64) bool {
+	if rq.maxWritePoints <= 0 || points < 0 {
+		return false
+	}
+	return points >= rq.maxWritePoints || n >= 0 && points+n > rq.maxWritePoints
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFlushInterval(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var sent []string
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(_ platform.ID, b []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, string(b))
+		return nil
+	})
+
+	var clockMu sync.Mutex
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	qm.now = func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	// Capture the flush instead of waiting for a real timer to fire.
+	flushes := make(chan func(), 1)
+	qm.afterFunc = func(d time.Duration, f func()) *time.Timer {
+		require.Equal(t, time.Minute, d)
+		flushes <- f
+		return time.AfterFunc(time.Hour, func() {})
+	}
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+	rq := qm.replicationQueues[id1]
+	require.NoError(t, qm.SetFlushInterval(id1, time.Minute))
+
+	// Data is held back until the interval has passed since the first enqueue.
+	for _, data := range []string{"a", "b", "c"} {
+		require.NoError(t, qm.EnqueueData(id1, []byte(data), 1))
+	}
+	flush := <-flushes
+	waitIdle(rq)
+	mu.Lock()
+	require.Empty(t, sent)
+	mu.Unlock()
+
+	// Once it has, everything queued is sent as a single write.
+	clockMu.Lock()
+	now = now.Add(time.Minute)
+	clockMu.Unlock()
+	flush()
+	waitIdle(rq)
+	mu.Lock()
+	require.Equal(t, []string{"abc"}, sent)
+	mu.Unlock()
+	require.True(t, rq.queue.Empty())
+
+	// The next enqueue starts a new interval.
+	require.NoError(t, qm.EnqueueData(id1, []byte("d"), 1))
+	<-flushes
+
+	// Removing the interval sends the data waiting for it, and later data as soon as it's enqueued.
+	require.NoError(t, qm.SetFlushInterval(id1, 0))
+	require.NoError(t, qm.EnqueueData(id1, []byte("e"), 1))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 3
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"abc", "d", "e"}, sent)
+}
+
+func TestFlushInterval_CodecChangeFails(t *testing.T) {
+	t.Parallel()
+
+	var sent []string
+	failZstd := true
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(_ platform.ID, b []byte) error {
+		if failZstd && BlockCompression(b) == influxdb.CompressionZstd {
+			failZstd = false
+			return errors.New("remote unavailable")
+		}
+		sent = append(sent, decompress(t, b))
+		return nil
+	})
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+	rq := qm.replicationQueues[id1]
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, rq.queue.Append(encodeBatch(now, compress(t, influxdb.CompressionGzip, "cpu value=1 1\n"), 1)))
+	require.NoError(t, rq.queue.Append(encodeBatch(now, compress(t, influxdb.CompressionZstd, "cpu value=2 2\n"), 1)))
+
+	// The gzip block is sent, and the zstd block which failed after it is requeued rather than left to be sent
+	// again along with it.
+	require.True(t, rq.sendCombined())
+	require.Equal(t, []string{"cpu value=1 1\n"}, sent)
+	require.False(t, rq.queue.Empty())
+
+	require.True(t, rq.sendCombined())
+	require.Equal(t, []string{"cpu value=1 1\n", "cpu value=2 2\n"}, sent)
+	require.True(t, rq.queue.Empty())
+}
+
+func TestFlushInterval_MaxWritePoints(t *testing.T) {
+	t.Parallel()
+
+	var sent []string
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(_ platform.ID, b []byte) error {
+		sent = append(sent, string(b))
+		return nil
+	})
+	qm.SetMaxWritePoints(3)
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+	rq := qm.replicationQueues[id1]
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, block := range []struct {
+		data   string
+		points int64
+	}{{"a", 2}, {"b", 2}, {"c", 1}, {"d", 5}, {"e", -1}, {"f", 1}} {
+		require.NoError(t, rq.queue.Append(encodeBatch(now, []byte(block.data), block.points)))
+	}
+
+	// Blocks are combined until the next would take the write over the cap. Blocks over the cap on their own are
+	// sent alone, and blocks without a count don't count towards it.
+	require.True(t, rq.sendCombined())
+	require.Equal(t, []string{"a", "bc", "d", "ef"}, sent)
+	require.True(t, rq.queue.Empty())
+}
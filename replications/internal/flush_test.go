@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlush(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+	defer shutdown(t, qm)
+	qm.flushPollInterval = 10 * time.Millisecond
+
+	_, err := qm.Flush(context.Background(), id1)
+	require.EqualError(t, err, "durable queue not found for replication ID \"0000000000000001\"")
+
+	// The remote fails the first sends, and the queue would otherwise wait an hour before sending.
+	var mu sync.Mutex
+	var sent []string
+	failures := 2
+	qm.writeFunc = func(_ platform.ID, b []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			return errors.New("remote unavailable")
+		}
+		sent = append(sent, decompress(t, b))
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.SetFlushInterval(id1, time.Hour))
+	require.NoError(t, qm.EnqueueData(id1, compress(t, influxdb.CompressionGzip, "cpu value=1 1\n"), 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	remaining, err := qm.Flush(ctx, id1)
+	require.NoError(t, err)
+	require.Zero(t, remaining)
+	mu.Lock()
+	require.Equal(t, []string{"cpu value=1 1\n"}, sent)
+	mu.Unlock()
+
+	// Paused queues would never drain.
+	require.NoError(t, qm.PauseQueue(id1))
+	_, err = qm.Flush(ctx, id1)
+	require.Equal(t, ErrFlushPaused, err)
+	require.NoError(t, qm.ResumeQueue(id1))
+}
+
+func TestFlush_RemoteUnreachable(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+	defer shutdown(t, qm)
+	qm.flushPollInterval = 10 * time.Millisecond
+
+	qm.writeFunc = func(platform.ID, []byte) error {
+		return errors.New("connection refused")
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.EnqueueData(id1, compress(t, influxdb.CompressionGzip, "cpu value=1 1\ncpu value=2 2\n# comment\n"), 2))
+	require.NoError(t, qm.EnqueueData(id1, compress(t, influxdb.CompressionZstd, "mem value=3 3\n"), 1))
+
+	// Flushing gives up once the context is done, reporting the points left in the queue.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	remaining, err := qm.Flush(ctx, id1)
+	require.ErrorIs(t, err, ErrFlushTimeout)
+	require.Equal(t, int64(3), remaining)
+}
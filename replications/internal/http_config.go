@@ -1,6 +1,14 @@
 package internal
 
-import "github.com/influxdata/influxdb/v2/kit/platform"
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+)
 
 // ReplicationHTTPConfig contains all info needed by a client to make HTTP requests against the
 // remote bucket targeted by a replication.
@@ -10,4 +18,101 @@ type ReplicationHTTPConfig struct {
 	RemoteOrgID      platform.ID `db:"remote_org_id"`
 	AllowInsecureTLS bool        `db:"allow_insecure_tls"`
 	RemoteBucketID   platform.ID `db:"remote_bucket_id"`
+	// RemoteCertFingerprint, if set, is the lower-case hex SHA-256 fingerprint the remote's leaf
+	// certificate must match.
+	RemoteCertFingerprint *string `db:"remote_cert_fingerprint"`
+	// RemoteContentType, if set, overrides the Content-Type writes are sent to the remote with.
+	RemoteContentType *string `db:"remote_content_type"`
+	// RemoteWritePath, if set, replaces the /api/v2/write path writes are sent to.
+	RemoteWritePath *string `db:"remote_write_path"`
+	// RemoteHeaders are extra headers sent with every request to the remote.
+	RemoteHeaders influxdb.RemoteHeaders `db:"remote_headers"`
+	// ProxyURL, if set, is the proxy requests to the remote are sent through instead of the environment's.
+	ProxyURL *string `db:"proxy_url"`
+	// WriteTimeoutSeconds, if set, replaces the default timeout of each write to the remote.
+	WriteTimeoutSeconds *int32 `db:"write_timeout_seconds"`
+	// ClientCert and ClientKey, if set, are the PEM-encoded certificate and private key presented to the remote
+	// for mutual TLS.
+	ClientCert *string `db:"client_cert"`
+	ClientKey  *string `db:"client_key"`
+	// CACert, if set, holds the PEM-encoded certificates the remote's certificate is verified against.
+	CACert *string `db:"ca_cert"`
+	// RemoteAPIType is the write API the remote speaks. Nil means the InfluxDB 2.x API.
+	RemoteAPIType *influxdb.RemoteAPIType `db:"remote_api_type"`
+	// RemoteUsername, if set, is sent with RemoteToken as basic auth credentials to InfluxDB 1.x remotes.
+	RemoteUsername *string `db:"remote_username"`
+	// RemoteFormat is the format data is sent to the remote in. Nil means line protocol.
+	RemoteFormat *influxdb.RemoteFormat `db:"remote_format"`
+
+	DropNonRetryableData bool `db:"drop_non_retryable_data"`
+	// DeadLetterBucketID, if set, is the local bucket lines the remote rejects are recorded in instead of being
+	// dropped, if DropNonRetryableData is set.
+	DeadLetterBucketID *platform.ID `db:"dead_letter_bucket_id"`
+	// RemoteWritePrecision is the precision of the timestamps sent to the remote. Empty means nanoseconds.
+	RemoteWritePrecision influxdb.WritePrecision `db:"remote_write_precision"`
+	// RemoteCapabilities are what the remote was last detected to support, or nil if it hasn't been probed.
+	RemoteCapabilities *influxdb.RemoteCapabilities `db:"remote_capabilities"`
+	// RemoteDatabase and RemoteRetentionPolicy are written to in place of RemoteBucketID on InfluxDB 1.x remotes.
+	RemoteDatabase        *string `db:"remote_database"`
+	RemoteRetentionPolicy *string `db:"remote_retention_policy"`
+	// Downsample, if set, rolls up the points sent to the remote.
+	Downsample *influxdb.ReplicationDownsample `db:"downsample"`
+	// RenameRules, if set, rename measurements and fields in the data sent to the remote.
+	RenameRules influxdb.ReplicationRenameRules `db:"rename_rules"`
+}
+
+// isPrometheusRemoteWrite reports whether the remote is sent Prometheus remote-write requests instead of line
+// protocol.
+func (c *ReplicationHTTPConfig) isPrometheusRemoteWrite() bool {
+	return c.RemoteFormat != nil && *c.RemoteFormat == influxdb.RemoteFormatPrometheusRemoteWrite
+}
+
+// isV1 reports whether the remote speaks the InfluxDB 1.x write API.
+func (c *ReplicationHTTPConfig) isV1() bool {
+	return c.RemoteAPIType != nil && *c.RemoteAPIType == influxdb.RemoteAPITypeV1
+}
+
+// remoteURL parses the URL of the remote in canonical form, so API paths can be appended to it. Remotes are
+// stored in canonical form, but ones created before URLs were normalized may not be.
+func (c *ReplicationHTTPConfig) remoteURL() (*url.URL, error) {
+	normalized, err := influxdb.NormalizeRemoteURL(c.RemoteURL)
+	if err != nil {
+		return nil, fmt.Errorf("host URL %q is invalid: %w", c.RemoteURL, err)
+	}
+	return url.Parse(normalized)
+}
+
+// setRemoteHeaders adds the extra headers configured for the remote to a request to it. The headers the
+// replication sets itself can't be configured, so they're safe to set before or after.
+func (c *ReplicationHTTPConfig) setRemoteHeaders(req *http.Request) {
+	for k, v := range c.RemoteHeaders {
+		req.Header.Set(k, v)
+	}
+}
+
+// writeTimeout returns how long each write to the remote may take.
+func (c *ReplicationHTTPConfig) writeTimeout() time.Duration {
+	if c.WriteTimeoutSeconds != nil && *c.WriteTimeoutSeconds > 0 {
+		return time.Duration(*c.WriteTimeoutSeconds) * time.Second
+	}
+	return time.Duration(influxdb.DefaultRemoteWriteTimeoutSeconds) * time.Second
+}
+
+// transportSettings returns the settings connections to the remote are made with.
+func (c *ReplicationHTTPConfig) transportSettings() transportSettings {
+	settings := transportSettings{allowInsecureTLS: c.AllowInsecureTLS}
+	if c.RemoteCertFingerprint != nil {
+		settings.certFingerprint = *c.RemoteCertFingerprint
+	}
+	if c.ProxyURL != nil {
+		settings.proxyURL = *c.ProxyURL
+	}
+	if c.ClientCert != nil && c.ClientKey != nil {
+		settings.clientCert = *c.ClientCert
+		settings.clientKey = *c.ClientKey
+	}
+	if c.CACert != nil {
+		settings.caCert = *c.CACert
+	}
+	return settings
 }
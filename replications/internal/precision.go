@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+// queuedPrecision is the precision of the timestamps in blocks of data read from replication queues.
+const queuedPrecision = influxdb.WritePrecisionNanoseconds
+
+// writePrecision returns the precision writes to the remote are sent at.
+func (c *ReplicationHTTPConfig) writePrecision() influxdb.WritePrecision {
+	if c.RemoteWritePrecision == "" {
+		return queuedPrecision
+	}
+	return c.RemoteWritePrecision
+}
+
+// convertPrecision truncates the timestamps of a block of compressed line protocol, queued at nanosecond
+// precision, to the given precision. Only the trailing timestamp of each line is rewritten; the rest of the
+// line is copied without being parsed. Blocks already at the given precision are returned unchanged.
+func convertPrecision(data []byte, precision influxdb.WritePrecision) ([]byte, error) {
+	if precision == queuedPrecision {
+		return data, nil
+	}
+	divisor := models.GetPrecisionMultiplier(string(precision))
+
+	zr, err := Decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert replicated data to precision %q: %w", precision, err)
+	}
+	defer zr.Close()
+
+	// The converted block is compressed with the same codec, to match the data's Content-Encoding.
+	var buf bytes.Buffer
+	cw, err := NewCompressor(BlockCompression(data), &buf)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(zr)
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, err := cw.Write(convertLinePrecision(line, divisor)); err != nil {
+				return nil, err
+			}
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to convert replicated data to precision %q: %w", precision, readErr)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// convertLinePrecision divides the trailing timestamp of a line of line protocol. Lines without a timestamp
+// are returned as-is.
+func convertLinePrecision(line []byte, divisor int64) []byte {
+	body := bytes.TrimRight(line, "\n")
+	i := bytes.LastIndexByte(body, ' ')
+	if i < 0 {
+		return line
+	}
+	ts, err := strconv.ParseInt(string(body[i+1:]), 10, 64)
+	if err != nil {
+		return line
+	}
+	converted := strconv.AppendInt(append([]byte{}, body[:i+1]...), ts/divisor, 10)
+	return append(converted, line[len(body):]...)
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func gunzipLines(t *testing.T, data []byte) string {
+	t.Helper()
+
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	lp, err := io.ReadAll(gzr)
+	require.NoError(t, err)
+	return string(lp)
+}
+
+func TestConvertPrecision(t *testing.T) {
+	t.Parallel()
+
+	data := gzipLines(t, "cpu,host=a value=1 1633089600123456789\nmem free=2i 1633089601987654321\ndisk note=\"no timestamp\"\n")
+
+	for _, tc := range []struct {
+		precision influxdb.WritePrecision
+		want      string
+	}{
+		{influxdb.WritePrecisionMicroseconds, "cpu,host=a value=1 1633089600123456\nmem free=2i 1633089601987654\ndisk note=\"no timestamp\"\n"},
+		{influxdb.WritePrecisionMilliseconds, "cpu,host=a value=1 1633089600123\nmem free=2i 1633089601987\ndisk note=\"no timestamp\"\n"},
+		{influxdb.WritePrecisionSeconds, "cpu,host=a value=1 1633089600\nmem free=2i 1633089601\ndisk note=\"no timestamp\"\n"},
+	} {
+		converted, err := convertPrecision(data, tc.precision)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, gunzipLines(t, converted), tc.precision)
+	}
+
+	// Blocks already at the target precision are passed through without being decompressed.
+	converted, err := convertPrecision(data, influxdb.WritePrecisionNanoseconds)
+	require.NoError(t, err)
+	require.Equal(t, data, converted)
+}
+
+func TestRemoteWriter_Precision(t *testing.T) {
+	t.Parallel()
+
+	type received struct {
+		precision string
+		lp        string
+	}
+	reqs := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		reqs <- received{precision: r.URL.Query().Get("precision"), lp: gunzipLines(t, body)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	data := gzipLines(t, "cpu value=1 1633089600123456789\n")
+
+	// Replications without a precision send at the nanosecond precision points are queued at.
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, RemoteBucketID: platform.ID(20)})
+	require.NoError(t, w.Write(id1, data))
+	require.Equal(t, received{precision: "ns", lp: "cpu value=1 1633089600123456789\n"}, <-reqs)
+
+	w = newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:            server.URL,
+		RemoteBucketID:       platform.ID(20),
+		RemoteWritePrecision: influxdb.WritePrecisionSeconds,
+	})
+	require.NoError(t, w.Write(id1, data))
+	require.Equal(t, received{precision: "s", lp: "cpu value=1 1633089600\n"}, <-reqs)
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdata/influxdb/v2/models"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// prometheusRemoteWritePath is the path remote-write requests are sent to unless the remote has a
+	// RemoteWritePath. It's the push endpoint of Cortex and Mimir; Prometheus and Thanos need theirs configured.
+	prometheusRemoteWritePath = "/api/v1/push"
+	// prometheusRemoteWriteVersion is the version of the remote-write protocol requests are sent with.
+	prometheusRemoteWriteVersion = "0.1.0"
+	prometheusContentType        = "application/x-protobuf"
+)
+
+// promLabel is a label of a Prometheus series.
+type promLabel struct {
+	name, value string
+}
+
+// promSample is a sample of a Prometheus series, timestamped in milliseconds.
+type promSample struct {
+	value     float64
+	timestamp int64
+}
+
+type promSeries struct {
+	labels  []promLabel
+	samples []promSample
+}
+
+// toPrometheusRemoteWrite translates a block of queued data into the snappy-compressed body of a remote-write
+// request. It also returns the number of fields which had no sample to translate to, and so were dropped.
+//
+// Line protocol carries more than Prometheus samples can, so the translation is lossy:
+//
+//   - Each field of a point becomes a sample of its own series, with the metric name <measurement>_<field>. Float
+//     fields are sent as-is, integer and unsigned fields are converted to floats, so lose precision beyond 2^53,
+//     and boolean fields are sent as 1 or 0. String fields have no numeric value, so are dropped.
+//   - Tags become labels. Characters not allowed in metric or label names are replaced with underscores, and
+//     tags starting with "__", which Prometheus reserves, are prefixed with "tag", so distinct measurements,
+//     fields, or tags can end up with the same name. If two tags of a point do, only the first is kept.
+//   - Timestamps are truncated to milliseconds, so points of a series less than a millisecond apart become
+//     samples with the same timestamp, which remotes reject as duplicates.
+func toPrometheusRemoteWrite(data []byte) ([]byte, int, error) {
+	zr, err := Decompress(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer zr.Close()
+	lp, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, 0, err
+	}
+	points, err := models.ParsePoints(lp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to translate replicated data to Prometheus remote-write: %w", err)
+	}
+
+	var series []*promSeries
+	index := make(map[string]*promSeries)
+	var dropped int
+	for _, p := range points {
+		timestamp := p.UnixNano() / int64(time.Millisecond)
+		iter := p.FieldIterator()
+		for iter.Next() {
+			value, ok, err := sampleValue(iter)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to translate replicated data to Prometheus remote-write: %w", err)
+			}
+			if !ok {
+				dropped++
+				continue
+			}
+
+			labels := promLabels(p.Name(), iter.FieldKey(), p.Tags())
+			key := seriesKey(labels)
+			s, ok := index[key]
+			if !ok {
+				s = &promSeries{labels: labels}
+				index[key] = s
+				series = append(series, s)
+			}
+			s.samples = append(s.samples, promSample{value: value, timestamp: timestamp})
+		}
+	}
+
+	// Remotes reject samples older than the latest one of their series, so each series is sent in time order.
+	for _, s := range series {
+		sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].timestamp < s.samples[j].timestamp })
+	}
+	return snappy.Encode(nil, encodeWriteRequest(series)), dropped, nil
+}
+
+// sampleValue returns the value of the sample a field translates to, or false if it has none.
+func sampleValue(iter models.FieldIterator) (float64, bool, error) {
+	switch iter.Type() {
+	case models.Float:
+		v, err := iter.FloatValue()
+		return v, err == nil, err
+	case models.Integer:
+		v, err := iter.IntegerValue()
+		return float64(v), err == nil, err
+	case models.Unsigned:
+		v, err := iter.UnsignedValue()
+		return float64(v), err == nil, err
+	case models.Boolean:
+		v, err := iter.BooleanValue()
+		if v {
+			return 1, err == nil, err
+		}
+		return 0, err == nil, err
+	default:
+		return 0, false, nil
+	}
+}
+
+// promLabels returns the labels of the series a field of a point translates to, sorted by name as remote-write
+// requires.
+func promLabels(measurement, field []byte, tags models.Tags) []promLabel {
+	labels := make([]promLabel, 0, len(tags)+1)
+	labels = append(labels, promLabel{
+		name:  "__name__",
+		value: promName(string(measurement)+"_"+string(field), true),
+	})
+	seen := map[string]bool{"__name__": true}
+	for _, t := range tags {
+		name := promName(string(t.Key), false)
+		if strings.HasPrefix(name, "__") {
+			name = "tag" + name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		labels = append(labels, promLabel{name: name, value: string(t.Value)})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+// promName replaces the characters of a metric or label name Prometheus doesn't allow with underscores. Colons
+// are only allowed in metric names.
+func promName(name string, metric bool) string {
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, r := range name {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(metric && r == ':') || (i > 0 && r >= '0' && r <= '9')
+		switch {
+		case valid:
+			b.WriteRune(r)
+		case i == 0 && r >= '0' && r <= '9':
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// seriesKey identifies the series with the given sorted labels.
+func seriesKey(labels []promLabel) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.name)
+		b.WriteByte(0)
+		b.WriteString(l.value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// encodeWriteRequest encodes series as a prometheus.WriteRequest protobuf. The message is small enough to be
+// encoded by hand, rather than depending on the generated Prometheus types:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []*promSeries) []byte {
+	var buf, ts, msg []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.labels {
+			msg = msg[:0]
+			msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.name)
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+		for _, sample := range s.samples {
+			msg = msg[:0]
+			msg = protowire.AppendTag(msg, 1, protowire.Fixed64Type)
+			msg = protowire.AppendFixed64(msg, math.Float64bits(sample.value))
+			msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(sample.timestamp))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
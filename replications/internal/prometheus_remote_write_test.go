@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest decodes the snappy-compressed body of a remote-write request.
+func decodeWriteRequest(t *testing.T, body []byte) []promSeries {
+	t.Helper()
+
+	buf, err := snappy.Decode(nil, body)
+	require.NoError(t, err)
+
+	// consume returns the fields of a message, keyed by field number.
+	consume := func(b []byte) map[protowire.Number][][]byte {
+		fields := make(map[protowire.Number][][]byte)
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			require.True(t, n > 0)
+			b = b[n:]
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			require.True(t, n > 0)
+			fields[num] = append(fields[num], b[:n])
+			b = b[n:]
+		}
+		return fields
+	}
+	bytesValue := func(b []byte) []byte {
+		v, n := protowire.ConsumeBytes(b)
+		require.True(t, n > 0)
+		return v
+	}
+
+	var series []promSeries
+	for _, ts := range consume(buf)[1] {
+		var s promSeries
+		fields := consume(bytesValue(ts))
+		for _, l := range fields[1] {
+			label := consume(bytesValue(l))
+			s.labels = append(s.labels, promLabel{name: string(bytesValue(label[1][0])), value: string(bytesValue(label[2][0]))})
+		}
+		for _, sample := range fields[2] {
+			sampleFields := consume(bytesValue(sample))
+			value, _ := protowire.ConsumeFixed64(sampleFields[1][0])
+			timestamp, _ := protowire.ConsumeVarint(sampleFields[2][0])
+			s.samples = append(s.samples, promSample{value: math.Float64frombits(value), timestamp: int64(timestamp)})
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+func TestToPrometheusRemoteWrite(t *testing.T) {
+	t.Parallel()
+
+	data := compress(t, influxdb.CompressionGzip, `cpu,host=a,__name__=x usage=1.5,count=3i,up=true,note="hi" 1633089600123456789
+cpu,host=a usage=0.5 1633089599000000000
+disk.io,9dc=east\ space,host=a read=7u 1633089600000000000
+`)
+	body, dropped, err := toPrometheusRemoteWrite(data)
+	require.NoError(t, err)
+	require.Equal(t, 1, dropped)
+
+	labels := func(name string, tags ...string) []promLabel {
+		ls := []promLabel{{name: "__name__", value: name}}
+		for i := 0; i < len(tags); i += 2 {
+			ls = append(ls, promLabel{name: tags[i], value: tags[i+1]})
+		}
+		return ls
+	}
+	require.Equal(t, []promSeries{
+		// Each numeric field is a series, with timestamps truncated to milliseconds. The string field is dropped,
+		// and the reserved __name__ tag is renamed rather than replacing the metric name.
+		{
+			labels:  labels("cpu_usage", "host", "a", "tag__name__", "x"),
+			samples: []promSample{{value: 1.5, timestamp: 1633089600123}},
+		},
+		{
+			labels:  labels("cpu_count", "host", "a", "tag__name__", "x"),
+			samples: []promSample{{value: 3, timestamp: 1633089600123}},
+		},
+		{
+			labels:  labels("cpu_up", "host", "a", "tag__name__", "x"),
+			samples: []promSample{{value: 1, timestamp: 1633089600123}},
+		},
+		{
+			labels:  labels("cpu_usage", "host", "a"),
+			samples: []promSample{{value: 0.5, timestamp: 1633089599000}},
+		},
+		// Invalid characters are replaced, and labels are sorted by name.
+		{
+			labels:  []promLabel{{name: "_9dc", value: "east space"}, {name: "__name__", value: "disk_io_read"}, {name: "host", value: "a"}},
+			samples: []promSample{{value: 7, timestamp: 1633089600000}},
+		},
+	}, decodeWriteRequest(t, body))
+
+	// Samples of a series are sorted by time.
+	data = compress(t, influxdb.CompressionNone, "cpu usage=2 2000000000\ncpu usage=1 1000000000\n")
+	body, _, err = toPrometheusRemoteWrite(data)
+	require.NoError(t, err)
+	require.Equal(t, []promSeries{{
+		labels:  labels("cpu_usage"),
+		samples: []promSample{{value: 1, timestamp: 1000}, {value: 2, timestamp: 2000}},
+	}}, decodeWriteRequest(t, body))
+}
+
+func TestRemoteWriter_PrometheusRemoteWrite(t *testing.T) {
+	t.Parallel()
+
+	type received struct {
+		req  *http.Request
+		body []byte
+	}
+	reqs := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		reqs <- received{req: r, body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	format := influxdb.RemoteFormatPrometheusRemoteWrite
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:    server.URL,
+		RemoteToken:  "my-token",
+		RemoteFormat: &format,
+		// Line protocol settings don't apply.
+		RemoteWritePrecision: influxdb.WritePrecisionSeconds,
+	})
+	m := metrics.NewReplicationsMetrics()
+	w.SetMetrics(m)
+
+	require.NoError(t, w.Write(id1, compress(t, influxdb.CompressionZstd, "cpu,host=a usage=1.5,note=\"hi\" 1633089600123456789\n")))
+
+	got := <-reqs
+	require.Equal(t, prometheusRemoteWritePath, got.req.URL.Path)
+	require.Empty(t, got.req.URL.RawQuery)
+	require.Equal(t, "Bearer my-token", got.req.Header.Get("Authorization"))
+	require.Equal(t, "snappy", got.req.Header.Get("Content-Encoding"))
+	require.Equal(t, prometheusContentType, got.req.Header.Get("Content-Type"))
+	require.Equal(t, prometheusRemoteWriteVersion, got.req.Header.Get("X-Prometheus-Remote-Write-Version"))
+	require.Equal(t, []promSeries{{
+		labels:  []promLabel{{name: "__name__", value: "cpu_usage"}, {name: "host", value: "a"}},
+		samples: []promSample{{value: 1.5, timestamp: 1633089600123}},
+	}}, decodeWriteRequest(t, got.body))
+
+	// The string field is counted as dropped.
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(m.PrometheusCollectors()...)
+	mfs := promtest.MustGather(t, reg)
+	dropped := promtest.MustFindMetric(t, mfs, "replications_queue_dropped_points_total", map[string]string{
+		"replicationID": id1.String(),
+		"reason":        metrics.DropReasonNonNumeric,
+	})
+	require.Equal(t, 1.0, dropped.Counter.GetValue())
+}
@@ -1,52 +1,189 @@
 package internal
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/influxdata/influxdb/v2"
 	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
 	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
 	"go.uber.org/zap"
 )
 
 type replicationQueue struct {
-	queue   *durablequeue.Queue
-	wg      sync.WaitGroup
-	done    chan struct{}
-	receive chan struct{}
-	logger  *zap.Logger
-
-	writeFunc func([]byte) error
+	id     platform.ID
+	queue  *durablequeue.Queue
+	logger *zap.Logger
+	// totalSize is the amount of data in the queue, used by the queue to enforce its max size.
+	totalSize *durablequeue.SharedCount
+
+	// The queue's files are closed while it's idle if the manager is over its open files budget, and reopened
+	// when it's used again. fileUsers counts the users keeping the files open.
+	filesMu         sync.Mutex
+	filesClosed     bool
+	fileUsers       int
+	lastUsed        time.Time
+	closedDiskUsage int64
+
+	// senders is the pool the queue is drained on. The scheduling state below tracks whether the queue is
+	// waiting for a worker, being drained by one, or had data enqueued while being drained.
+	senders   *senderPool
+	schedMu   sync.Mutex
+	schedCond *sync.Cond
+	scheduled bool
+	draining  bool
+	dirty     bool
+	closed    bool
+
+	pauseMu sync.RWMutex
+	// paused is set while the queue is paused by the user.
+	paused bool
+	// pausedUntil is when a paused queue automatically resumes, or zero if it stays paused until resumed.
+	pausedUntil time.Time
+	// pausedFor holds the other reasons the queue is paused for, which are set and cleared independently.
+	pausedFor   PauseReason
+	resumeTimer *time.Timer
+
+	// dedup is nil unless duplicate suppression is enabled on the queue manager.
+	dedup *sendDedup
+
+	// retry is nil unless retry queues are enabled on the queue manager.
+	retry     *retryQueue
+	afterFunc func(time.Duration, func()) *time.Timer
+
+	// flushInterval is zero unless the replication accumulates data before sending it. pendingSince is when
+	// the first data enqueued since the last flush was enqueued, and flushTimer signals the queue once the
+	// interval has passed since then.
+	flushMu       sync.Mutex
+	flushInterval time.Duration
+	pendingSince  time.Time
+	flushTimer    *time.Timer
+	// maxWritePoints is zero unless the points combined into a single write are capped.
+	maxWritePoints int64
+
+	// backoff delays sends from the main queue after one fails.
+	backoff sendBackoff
+
+	// unwritable is set while writes to the queue fail because its directory can't be written to.
+	unwritableMu sync.Mutex
+	unwritable   bool
+
+	// sequences is nil unless ordered delivery is enabled for the replication.
+	sequencesMu sync.RWMutex
+	sequences   *seriesSequences
+
+	// verify enables checking that each batch is valid compressed line protocol before sending it.
+	// Invalid batches are moved into quarantineDir.
+	verify        bool
+	quarantineDir string
+	metrics       *metrics.ReplicationsMetrics
+	now           func() time.Time
+
+	// rates counts the points enqueued into and sent from the queue, to track how fast it's filling and draining.
+	rates *queueRates
+
+	// sendGate is nil unless a send gate is set on the queue manager.
+	sendGate  func(platform.ID) bool
+	writeFunc func(platform.ID, []byte) error
 }
 
 type durableQueueManager struct {
 	replicationQueues map[platform.ID]*replicationQueue
 	logger            *zap.Logger
 	queuePath         string
+	segmentSize       int64
 	mutex             sync.RWMutex
-
-	writeFunc func([]byte) error
+	senders           *senderPool
+	// maxOpenFiles is the budget for files held open by all queues. Zero means unlimited.
+	maxOpenFiles int
+
+	dedupWindow     time.Duration
+	dedupMaxEntries int
+	verifyBatches   bool
+	sendGate        func(platform.ID) bool
+	maxWritePoints  int64
+	// retryMinBackoff and retryMaxBackoff are zero unless retry queues are enabled.
+	retryMinBackoff time.Duration
+	retryMaxBackoff time.Duration
+
+	metrics   *metrics.ReplicationsMetrics
+	now       func() time.Time
+	afterFunc func(time.Duration, func()) *time.Timer
+	writeFunc func(platform.ID, []byte) error
+	// flushPollInterval is how often Flush checks whether a queue has drained.
+	flushPollInterval time.Duration
+	// syncQueue flushes a queue to stable storage for EnqueueDataSync.
+	syncQueue func(*durablequeue.Queue) error
 }
 
+// ErrAmbiguousWrite should be wrapped by errors returned from a queue's write function when the remote may
+// have received the data despite the error, i.e. because the connection failed while waiting for a response.
+var ErrAmbiguousWrite = errors.New("remote write outcome is unknown")
+
+const (
+	// DefaultSegmentSize is the size of the segment files used by replication queues unless configured otherwise.
+	DefaultSegmentSize int64 = durablequeue.DefaultSegmentSize
+	// MinSegmentSize is the smallest allowed queue segment size. Smaller segments would mean a file per handful
+	// of batches, with the open/close and fsync overhead that implies.
+	MinSegmentSize int64 = 64 * 1024
+	// MaxSegmentSize is the largest allowed queue segment size. A queue must be able to hold at least two segments,
+	// so this is bounded by the smallest allowed max queue size.
+	MaxSegmentSize int64 = influxdb.MinReplicationMaxQueueSizeBytes / 2
+)
+
 var errStartup = errors.New("startup tasks for replications durable queue management failed, see server logs for details")
 var errShutdown = errors.New("shutdown tasks for replications durable queues failed, see server logs for details")
 
+// ValidateSegmentSize checks that size is within the bounds allowed for replication queue segments.
+func ValidateSegmentSize(size int64) error {
+	if size < MinSegmentSize || size > MaxSegmentSize {
+		return fmt.Errorf("queue segment size %d out of range: must be between %d and %d bytes", size, MinSegmentSize, MaxSegmentSize)
+	}
+	return nil
+}
+
 // NewDurableQueueManager creates a new durableQueueManager struct, for managing durable queues associated with
 //replication streams.
-func NewDurableQueueManager(log *zap.Logger, queuePath string, writeFunc func([]byte) error) *durableQueueManager {
+//
+// segmentSize sets the size of the files backing each queue. Data is only reclaimed from disk once every batch
+// in a segment has been sent, so smaller segments free space sooner and waste less of it on queues which hold
+// little data, at the cost of more files and more frequent file rotation for high-throughput replications.
+// A segmentSize of zero uses DefaultSegmentSize. Sizes outside of [MinSegmentSize, MaxSegmentSize] are logged
+// and replaced with DefaultSegmentSize.
+func NewDurableQueueManager(log *zap.Logger, queuePath string, metrics *metrics.ReplicationsMetrics, segmentSize int64, writeFunc func(platform.ID, []byte) error) *durableQueueManager {
 	replicationQueues := make(map[platform.ID]*replicationQueue)
 
 	os.MkdirAll(queuePath, 0777)
 
+	if segmentSize == 0 {
+		segmentSize = DefaultSegmentSize
+	} else if err := ValidateSegmentSize(segmentSize); err != nil {
+		log.Warn("Invalid replication queue segment size, using default", zap.Error(err), zap.Int64("default", DefaultSegmentSize))
+		segmentSize = DefaultSegmentSize
+	}
+
 	return &durableQueueManager{
 		replicationQueues: replicationQueues,
 		logger:            log,
 		queuePath:         queuePath,
+		segmentSize:       segmentSize,
+		senders:           newSenderPool(DefaultSenderWorkers, metrics),
+		metrics:           metrics,
+		now:               time.Now,
+		afterFunc:         time.AfterFunc,
 		writeFunc:         writeFunc,
+		flushPollInterval: defaultFlushPollInterval,
+		syncQueue:         (*durablequeue.Queue).Sync,
 	}
 }
 
@@ -70,11 +207,12 @@ func (qm *durableQueueManager) InitializeQueue(replicationID platform.ID, maxQue
 	}
 
 	// Create a new durable queue
+	totalSize := &durablequeue.SharedCount{}
 	newQueue, err := durablequeue.NewQueue(
 		dir,
 		maxQueueSizeBytes,
-		durablequeue.DefaultSegmentSize,
-		&durablequeue.SharedCount{},
+		qm.segmentSize,
+		totalSize,
 		durablequeue.MaxWritesPending,
 		func(bytes []byte) error {
 			return nil
@@ -91,15 +229,14 @@ func (qm *durableQueueManager) InitializeQueue(replicationID platform.ID, maxQue
 	}
 
 	// Map new durable queue and scanner to its corresponding replication stream via replication ID
-	rq := replicationQueue{
-		queue:     newQueue,
-		done:      make(chan struct{}),
-		receive:   make(chan struct{}),
-		logger:    qm.logger.With(zap.String("replication_id", replicationID.String())),
-		writeFunc: qm.writeFunc,
+	rq := qm.newReplicationQueue(replicationID, newQueue, totalSize)
+	if err := qm.openRetryQueue(rq, maxQueueSizeBytes); err != nil {
+		_ = newQueue.Close()
+		return err
 	}
-	qm.replicationQueues[replicationID] = &rq
+	qm.replicationQueues[replicationID] = rq
 	rq.Open()
+	qm.enforceFileBudget()
 
 	qm.logger.Debug("Created new durable queue for replication stream",
 		zap.String("id", replicationID.String()), zap.String("path", dir))
@@ -107,35 +244,388 @@ func (qm *durableQueueManager) InitializeQueue(replicationID platform.ID, maxQue
 	return nil
 }
 
+// newReplicationQueue wraps an opened durable queue with the state needed to scan it and send its data
+// to the remote.
+func (qm *durableQueueManager) newReplicationQueue(replicationID platform.ID, queue *durablequeue.Queue, totalSize *durablequeue.SharedCount) *replicationQueue {
+	rq := &replicationQueue{
+		id:        replicationID,
+		queue:     queue,
+		totalSize: totalSize,
+		lastUsed:  qm.now(),
+		senders:   qm.senders,
+		logger:    qm.logger.With(zap.String("replication_id", replicationID.String())),
+		writeFunc: qm.writeFunc,
+		sendGate:  qm.sendGate,
+
+		maxWritePoints: qm.maxWritePoints,
+
+		verify:        qm.verifyBatches,
+		quarantineDir: filepath.Join(qm.queuePath, "quarantine", replicationID.String()),
+		metrics:       qm.metrics,
+		now:           qm.now,
+		afterFunc:     qm.afterFunc,
+		rates:         newQueueRates(qm.now()),
+	}
+	rq.schedCond = sync.NewCond(&rq.schedMu)
+	if qm.dedupWindow > 0 {
+		rq.dedup = newSendDedup(qm.dedupWindow, qm.dedupMaxEntries)
+	}
+	rq.recordSize()
+	return rq
+}
+
+// recordSize publishes the queue's current size on disk to the queue size metric.
+func (rq *replicationQueue) recordSize() {
+	rq.metrics.QueueSizeBytes.WithLabelValues(rq.id.String()).Set(float64(rq.diskUsage()))
+}
+
+// stats returns the queue's current enqueue and send rates, publishing them to the rate metrics.
+func (rq *replicationQueue) stats() QueueStats {
+	stats := rq.rates.stats(rq.now())
+	rq.metrics.EnqueueRate.WithLabelValues(rq.id.String()).Set(stats.EnqueueRate)
+	rq.metrics.SendRate.WithLabelValues(rq.id.String()).Set(stats.SendRate)
+	return stats
+}
+
+// countRate adds the points in a block of data to one of the queue's rates. The number of points is only counted
+// from the data when it isn't known, i.e. for blocks enqueued by older versions, as that decompresses it. Such
+// blocks which can't be decompressed aren't counted; they fail verification or are rejected by the remote instead.
+func (rq *replicationQueue) countRate(add func(time.Time, int64), data []byte, points int64) {
+	if points < 0 {
+		n, err := countPoints(data)
+		if err != nil {
+			return
+		}
+		points = n
+	}
+	add(rq.now(), points)
+	rq.stats()
+}
+
+// EnableSendDedup turns on sender-side duplicate suppression for all queues created after the call. Each queue
+// remembers the content hashes of up to maxEntries blocks which were sent (or possibly sent) within the window,
+// and skips sending an identical block again. This protects remotes which don't support idempotent writes
+// against duplicates caused by retrying a write which actually succeeded.
+func (qm *durableQueueManager) EnableSendDedup(window time.Duration, maxEntries int) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	qm.dedupWindow = window
+	qm.dedupMaxEntries = maxEntries
+}
+
+// EnableBatchVerification turns on verification of batches before they're sent for all queues created after the
+// call. Each batch is decompressed and parsed as line protocol, and batches which fail are moved out of the queue
+// into a quarantine directory instead of being sent to the remote. This costs CPU on every send.
+func (qm *durableQueueManager) EnableBatchVerification() {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	qm.verifyBatches = true
+}
+
+// SetSenderWorkers sets the number of workers shared by all queues to send their data to remotes. Zero or less
+// uses DefaultSenderWorkers. Queues waiting for a worker are sent in the order data was enqueued into them, so
+// too few workers for the number of busy replications shows up as a growing SenderQueuesWaiting metric.
+func (qm *durableQueueManager) SetSenderWorkers(n int) {
+	qm.senders.resize(n)
+}
+
+// SenderStats returns the number of sender workers currently sending data, and the number of queues with data
+// to send waiting for a worker.
+func (qm *durableQueueManager) SenderStats() (active, queued int) {
+	return qm.senders.stats()
+}
+
+// Open schedules the queue to send any data already in it.
 func (rq *replicationQueue) Open() {
-	rq.wg.Add(1)
-	go rq.run()
+	rq.signal()
 }
 
+// Close stops the queue being scheduled onto the sender pool, waits for a worker draining it to finish its
+// current send, and closes the underlying durable queue.
 func (rq *replicationQueue) Close() error {
-	close(rq.receive)
-	close(rq.done)
-	rq.wg.Wait() // wait for goroutine to finish processing all messages
+	rq.schedMu.Lock()
+	rq.closed = true
+	for rq.draining {
+		rq.schedCond.Wait()
+	}
+	rq.schedMu.Unlock()
+
+	rq.pauseMu.Lock()
+	rq.stopResumeTimer()
+	rq.pauseMu.Unlock()
+
+	rq.flushMu.Lock()
+	rq.resetFlushLocked()
+	rq.flushMu.Unlock()
+
+	rq.resetBackoff()
+
+	if err := rq.closeRetryQueue(); err != nil {
+		return err
+	}
 	return rq.queue.Close()
 }
 
-// WriteFunc is currently a placeholder for the "default" behavior
-// of the queue scanner sending data from the durable queue to a remote host.
-func WriteFunc(b []byte) error {
+// signal notifies the queue that it may have data to send, scheduling it onto the sender pool unless it's
+// already scheduled. A queue being drained is drained again once the worker finishes, so data enqueued after
+// the worker's last scan isn't left behind.
+func (rq *replicationQueue) signal() {
+	rq.schedMu.Lock()
+	if rq.closed || rq.scheduled {
+		rq.schedMu.Unlock()
+		return
+	}
+	if rq.draining {
+		rq.dirty = true
+		rq.schedMu.Unlock()
+		return
+	}
+	rq.scheduled = true
+	rq.schedMu.Unlock()
+
+	rq.senders.submit(rq)
+}
+
+// unschedule marks the queue as no longer waiting for a worker, for a pool which dropped it while stopping.
+func (rq *replicationQueue) unschedule() {
+	rq.schedMu.Lock()
+	rq.scheduled = false
+	rq.schedMu.Unlock()
+}
+
+// drain runs on a sender pool worker, sending data from the queue until it's empty, paused, or closed.
+func (rq *replicationQueue) drain() {
+	rq.schedMu.Lock()
+	rq.scheduled = false
+	if rq.closed {
+		rq.schedMu.Unlock()
+		return
+	}
+	rq.draining = true
+	rq.dirty = false
+	rq.schedMu.Unlock()
+
+	if err := rq.acquireFiles(); err != nil {
+		rq.logger.Error("Failed to reopen replication queue", zap.Error(err))
+	} else {
+		if !rq.isPaused() && !rq.backingOff() && rq.takeFlush() {
+			for !rq.isClosed() && !rq.isPaused() && rq.sendNext() {
+			}
+		}
+		if !rq.isClosed() && !rq.isPaused() {
+			rq.sendRetries()
+		}
+		rq.releaseFiles()
+	}
+
+	rq.schedMu.Lock()
+	rq.draining = false
+	again := rq.dirty && !rq.closed
+	rq.dirty = false
+	rq.scheduled = again
+	rq.schedCond.Broadcast()
+	rq.schedMu.Unlock()
+
+	if again {
+		rq.senders.submit(rq)
+	}
+}
+
+func (rq *replicationQueue) isClosed() bool {
+	rq.schedMu.Lock()
+	defer rq.schedMu.Unlock()
+	return rq.closed
+}
+
+// write sends a block of data read from the queue to the remote using the queue's write function.
+func (rq *replicationQueue) write(block []byte) error {
+	enqueuedAt, b, seqs, hasHeader, err := decodeBatch(block)
+	if err != nil {
+		return rq.quarantine(block, err)
+	}
+	points := batchPoints(block)
+
+	if rq.verify {
+		if err := verifyBatch(b); err != nil {
+			return rq.quarantine(b, err)
+		}
+	}
+
+	// Blocks enqueued with ordered delivery enabled only have their unsent points sent, in sequence.
+	sequences := rq.getSequences()
+	var batch *sequencedBatch
+	if seqs != nil && sequences != nil {
+		var gaps map[string]uint64
+		batch, gaps, err = sequences.unsent(b, seqs)
+		if err != nil {
+			return rq.quarantine(b, err)
+		}
+		for series, missing := range gaps {
+			rq.logger.Warn("Points of series were lost before being sent, sending later points out of sequence",
+				zap.String("series", series), zap.Uint64("missing", missing))
+		}
+		if len(batch.lines) == 0 {
+			rq.logger.Debug("Skipped resend of already-delivered points")
+			return nil
+		}
+		if len(batch.lines) < len(seqs) {
+			if b, err = batch.compressed(BlockCompression(b)); err != nil {
+				return err
+			}
+			points = int64(len(batch.lines))
+		}
+	}
+
+	if err := rq.dedupSend(b, enqueuedAt, hasHeader, points); err != nil {
+		return err
+	}
+
+	if batch != nil {
+		if err := sequences.markSent(batch); err != nil {
+			rq.logger.Error("Failed to save sent sequence numbers", zap.Error(err))
+		}
+	}
 	return nil
 }
 
-func (rq *replicationQueue) run() {
-	defer rq.wg.Done()
+// dedupSend sends a block of data, unless duplicate suppression is enabled and the block was recently sent.
+func (rq *replicationQueue) dedupSend(b []byte, enqueuedAt time.Time, hasHeader bool, points int64) error {
+	if rq.dedup == nil {
+		return rq.send(b, enqueuedAt, hasHeader, points)
+	}
 
+	sum := sha256.Sum256(b)
+	if rq.dedup.contains(sum) {
+		rq.logger.Debug("Suppressed resend of recently-sent data")
+		return nil
+	}
+
+	err := rq.send(b, enqueuedAt, hasHeader, points)
+	if err == nil || errors.Is(err, ErrAmbiguousWrite) {
+		rq.dedup.add(sum)
+	}
+	return err
+}
+
+// send calls the queue's write function, observing how long the write took, and the time the data spent in the
+// queue if it was sent successfully. points is the number of points in b, or -1 if it isn't known.
+func (rq *replicationQueue) send(b []byte, enqueuedAt time.Time, hasHeader bool, points int64) error {
+	start := rq.now()
+	err := rq.writeFunc(rq.id, b)
+	rq.metrics.RemoteWriteLatency.WithLabelValues(rq.id.String()).Observe(rq.now().Sub(start).Seconds())
+	if err != nil {
+		// The points the remote accepted from a partial write aren't sent again; only the rejected ones are
+		// retried. Sequenced batches are retried whole, to keep their series in order.
+		var pw *PartialWriteError
+		if !errors.As(err, &pw) || pw.Retry == nil || rq.getSequences() != nil {
+			return err
+		}
+		if requeueErr := rq.requeueRejected(pw.Retry); requeueErr != nil {
+			rq.logger.Warn("Failed to queue points rejected by the remote for retrying, retrying the whole batch", zap.Error(requeueErr))
+			return err
+		}
+	}
+	rq.countRate(rq.rates.addSent, b, points)
+	if hasHeader {
+		rq.metrics.QueueLatency.WithLabelValues(rq.id.String()).Observe(rq.now().Sub(enqueuedAt).Seconds())
+	}
+	return nil
+}
+
+func (rq *replicationQueue) getSequences() *seriesSequences {
+	rq.sequencesMu.RLock()
+	defer rq.sequencesMu.RUnlock()
+	return rq.sequences
+}
+
+// verifyBatch checks that a batch decompresses cleanly and holds valid line protocol. The batch is
+// decompressed and parsed one line at a time, to avoid holding all of its points in memory at once.
+func verifyBatch(b []byte) error {
+	zr, err := Decompress(b)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	r := bufio.NewReader(zr)
 	for {
-		select {
-		case <-rq.done: // end the goroutine when done is messaged
-			return
-		case <-rq.receive: // run the scanner on data append
-			for rq.SendWrite(rq.writeFunc) {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if _, perr := models.ParsePoints(line); perr != nil {
+				return perr
 			}
 		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// quarantine moves a batch which failed verification out of the queue, into a file in the queue's quarantine
+// directory. An error is only returned if the batch couldn't be saved, in which case it stays in the queue.
+func (rq *replicationQueue) quarantine(b []byte, cause error) error {
+	if err := os.MkdirAll(rq.quarantineDir, 0777); err != nil {
+		return err
+	}
+	path := filepath.Join(rq.quarantineDir, fmt.Sprintf("%d.gz", time.Now().UnixNano()))
+	if err := os.WriteFile(path, b, 0666); err != nil {
+		return err
+	}
+
+	rq.metrics.BatchesQuarantined.WithLabelValues(rq.id.String()).Inc()
+	rq.logger.Warn("Quarantined corrupt batch instead of sending it to the remote",
+		zap.String("path", path), zap.Error(cause))
+	return nil
+}
+
+// isPaused returns whether the queue is paused for any reason. A queue paused until a deadline counts as
+// resumed once the deadline passes, so the sender picks it up again on its next check.
+func (rq *replicationQueue) isPaused() bool {
+	rq.pauseMu.RLock()
+	defer rq.pauseMu.RUnlock()
+	return rq.pausedFor != 0 || rq.paused && (rq.pausedUntil.IsZero() || rq.now().Before(rq.pausedUntil))
+}
+
+// setPausedFor pauses or resumes the queue for a reason other than the user's.
+func (rq *replicationQueue) setPausedFor(reason PauseReason, paused bool) {
+	rq.pauseMu.Lock()
+	defer rq.pauseMu.Unlock()
+	if paused {
+		rq.pausedFor |= reason
+	} else {
+		rq.pausedFor &^= reason
+	}
+}
+
+func (rq *replicationQueue) setPaused(paused bool) {
+	rq.pauseMu.Lock()
+	defer rq.pauseMu.Unlock()
+	rq.paused = paused
+	rq.pausedUntil = time.Time{}
+	rq.stopResumeTimer()
+}
+
+// setPausedUntil pauses the queue until the given time, using afterFunc to schedule the queue for sending
+// again once it passes.
+func (rq *replicationQueue) setPausedUntil(until time.Time, afterFunc func(time.Duration, func()) *time.Timer) {
+	rq.pauseMu.Lock()
+	defer rq.pauseMu.Unlock()
+	rq.paused = true
+	rq.pausedUntil = until
+	rq.stopResumeTimer()
+	rq.resumeTimer = afterFunc(until.Sub(rq.now()), rq.signal)
+}
+
+// stopResumeTimer cancels a pending automatic resume. rq.pauseMu must be held.
+func (rq *replicationQueue) stopResumeTimer() {
+	if rq.resumeTimer != nil {
+		rq.resumeTimer.Stop()
+		rq.resumeTimer = nil
 	}
 }
 
@@ -144,11 +634,19 @@ func (rq *replicationQueue) run() {
 // Retryable errors should be handled and retried in the dp function.
 // Unprocessable data should be dropped in the dp function.
 func (rq *replicationQueue) SendWrite(dp func([]byte) error) bool {
+	return rq.sendFrom(rq.queue, dp)
+}
+
+// sendFrom is SendWrite for either the main queue or the retry queue.
+func (rq *replicationQueue) sendFrom(queue *durablequeue.Queue, dp func([]byte) error) bool {
+	if rq.gated() {
+		return false
+	}
 
-	// Any error in creating the scanner should exit the loop in run()
+	// Any error in creating the scanner should exit the loop in drain()
 	// Either it is io.EOF indicating no data, or some other failure in making
 	// the Scanner object that we don't know how to handle.
-	scan, err := rq.queue.NewScanner()
+	scan, err := queue.NewScanner()
 	if err != nil {
 		if err != io.EOF {
 			rq.logger.Error("Error creating replications queue scanner", zap.Error(err))
@@ -156,6 +654,7 @@ func (rq *replicationQueue) SendWrite(dp func([]byte) error) bool {
 		return false
 	}
 
+	var held bool
 	for scan.Next() {
 
 		// An io.EOF error here indicates that there is no more data
@@ -178,15 +677,22 @@ func (rq *replicationQueue) SendWrite(dp func([]byte) error) bool {
 			rq.logger.Error("Error in replication stream", zap.Error(err))
 			return false
 		}
+
+		// Stop before reading the next batch while the send gate holds the queue back.
+		if held = rq.gated(); held {
+			break
+		}
 	}
 
-	if _, err = scan.Advance(); err != nil {
+	_, err = scan.Advance()
+	rq.recordSize()
+	if err != nil {
 		if err != io.EOF {
 			rq.logger.Error("Error in replication queue scanner", zap.Error(err))
 		}
 		return false
 	}
-	return true
+	return !held
 }
 
 // DeleteQueue deletes a durable queue and its associated data on disk.
@@ -212,12 +718,21 @@ func (qm *durableQueueManager) DeleteQueue(replicationID platform.ID) error {
 	if err := rq.queue.Remove(); err != nil {
 		return err
 	}
+	if rq.retry != nil {
+		if err := rq.retry.queue.Remove(); err != nil {
+			return err
+		}
+	}
 
 	qm.logger.Debug("Deleted data associated with replication stream durable queue",
 		zap.String("id", replicationID.String()), zap.String("path", rq.queue.Dir()))
 
 	// Remove entry from replicationQueues map
 	delete(qm.replicationQueues, replicationID)
+	qm.metrics.QueueSizeBytes.DeleteLabelValues(replicationID.String())
+	qm.metrics.EnqueueRate.DeleteLabelValues(replicationID.String())
+	qm.metrics.SendRate.DeleteLabelValues(replicationID.String())
+	qm.enforceFileBudget()
 
 	return nil
 }
@@ -231,9 +746,15 @@ func (qm *durableQueueManager) UpdateMaxQueueSize(replicationID platform.ID, max
 		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
 	}
 
-	if err := qm.replicationQueues[replicationID].queue.SetMaxSize(maxQueueSizeBytes); err != nil {
+	rq := qm.replicationQueues[replicationID]
+	if err := rq.queue.SetMaxSize(maxQueueSizeBytes); err != nil {
 		return err
 	}
+	if rq.retry != nil {
+		if err := rq.retry.queue.SetMaxSize(maxQueueSizeBytes); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -249,12 +770,69 @@ func (qm *durableQueueManager) CurrentQueueSizes(ids []platform.ID) (map[platfor
 		if _, exist := qm.replicationQueues[id]; !exist {
 			return nil, fmt.Errorf("durable queue not found for replication ID %q", id)
 		}
-		sizes[id] = qm.replicationQueues[id].queue.DiskUsage()
+		sizes[id] = qm.replicationQueues[id].diskUsage()
 	}
 
 	return sizes, nil
 }
 
+// QueueStats returns how fast points are being enqueued into a replication's queue, and sent from it to the
+// remote, over the recent window.
+func (qm *durableQueueManager) QueueStats(replicationID platform.ID) (QueueStats, error) {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return QueueStats{}, fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	return rq.stats(), nil
+}
+
+// PeekQueue returns the oldest blocks of data in a replication's durable queue, without removing them. Blocks are
+// returned until their total size reaches maxBytes, so the size of the last one may exceed it. Only blocks in
+// the head segment of the queue are returned.
+func (qm *durableQueueManager) PeekQueue(replicationID platform.ID, maxBytes int) ([][]byte, error) {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return nil, fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	if err := rq.acquireFiles(); err != nil {
+		return nil, err
+	}
+	defer rq.releaseFiles()
+
+	// The queue can only be peeked by number of blocks, so peek twice as many until enough data is returned.
+	for n := 16; ; n *= 2 {
+		peeked, err := rq.queue.PeekN(n)
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		blocks := make([][]byte, 0, len(peeked))
+		var size int
+		for _, b := range peeked {
+			_, data, _, _, err := decodeBatch(b)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, data)
+			if size += len(data); size >= maxBytes {
+				return blocks, nil
+			}
+		}
+		if len(peeked) < n {
+			return blocks, nil
+		}
+	}
+}
+
 // StartReplicationQueues updates the durableQueueManager.replicationQueues map, fully removing any partially deleted
 // queues (present on disk, but not tracked in sqlite), opening all current queues, and logging info for each.
 func (qm *durableQueueManager) StartReplicationQueues(trackedReplications map[platform.ID]int64) error {
@@ -262,11 +840,12 @@ func (qm *durableQueueManager) StartReplicationQueues(trackedReplications map[pl
 
 	for id, size := range trackedReplications {
 		// Re-initialize a queue struct for each replication stream from sqlite
+		totalSize := &durablequeue.SharedCount{}
 		queue, err := durablequeue.NewQueue(
 			filepath.Join(qm.queuePath, id.String()),
 			size,
-			durablequeue.DefaultSegmentSize,
-			&durablequeue.SharedCount{},
+			qm.segmentSize,
+			totalSize,
 			durablequeue.MaxWritesPending,
 			func(bytes []byte) error {
 				return nil
@@ -285,18 +864,21 @@ func (qm *durableQueueManager) StartReplicationQueues(trackedReplications map[pl
 			errOccurred = true
 			continue
 		} else {
-			qm.replicationQueues[id] = &replicationQueue{
-				queue:     queue,
-				done:      make(chan struct{}),
-				receive:   make(chan struct{}),
-				logger:    qm.logger.With(zap.String("replication_id", id.String())),
-				writeFunc: qm.writeFunc,
+			rq := qm.newReplicationQueue(id, queue, totalSize)
+			if err := qm.openRetryQueue(rq, size); err != nil {
+				qm.logger.Error("failed to open replication stream retry queue", zap.Error(err), zap.String("id", id.String()))
+				_ = queue.Close()
+				errOccurred = true
+				continue
 			}
+			qm.replicationQueues[id] = rq
 			qm.replicationQueues[id].Open()
 			qm.logger.Info("Opened replication stream", zap.String("id", id.String()), zap.String("path", queue.Dir()))
 		}
 	}
 
+	qm.enforceFileBudget()
+
 	if errOccurred {
 		return errStartup
 	}
@@ -344,6 +926,7 @@ func (qm *durableQueueManager) CloseAll() error {
 			errOccurred = true
 		}
 	}
+	qm.senders.stop()
 
 	if errOccurred {
 		return errShutdown
@@ -352,8 +935,21 @@ func (qm *durableQueueManager) CloseAll() error {
 	}
 }
 
-// EnqueueData persists a set of bytes to a replication's durable queue.
-func (qm *durableQueueManager) EnqueueData(replicationID platform.ID, data []byte) error {
+// EnqueueData persists a set of bytes to a replication's durable queue. data is copied into the queue, and is
+// never modified, so the same block can be enqueued into several replications at once. points is the number of
+// points in data, which is recorded along with it for the queue's rates.
+func (qm *durableQueueManager) EnqueueData(replicationID platform.ID, data []byte, points int) error {
+	return qm.enqueueData(replicationID, data, points, false)
+}
+
+// EnqueueDataSync persists a set of bytes to a replication's durable queue like EnqueueData, but only returns
+// once the data and the queue's directory entries are flushed to stable storage, so the data survives a crash
+// of the host as well as of the process. This costs an extra fsync per call.
+func (qm *durableQueueManager) EnqueueDataSync(replicationID platform.ID, data []byte, points int) error {
+	return qm.enqueueData(replicationID, data, points, true)
+}
+
+func (qm *durableQueueManager) enqueueData(replicationID platform.ID, data []byte, points int, sync bool) error {
 	qm.mutex.RLock()
 	defer qm.mutex.RUnlock()
 
@@ -361,10 +957,157 @@ func (qm *durableQueueManager) EnqueueData(replicationID platform.ID, data []byt
 		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
 	}
 
-	if err := qm.replicationQueues[replicationID].queue.Append(data); err != nil {
-		return err
+	rq := qm.replicationQueues[replicationID]
+	if err := rq.acquireFiles(); err != nil {
+		return rq.checkWritable(err)
+	}
+	if qm.maxOpenFiles > 0 {
+		defer qm.enforceFileBudget()
+	}
+	defer rq.releaseFiles()
+
+	if sequences := rq.getSequences(); sequences != nil {
+		if err := sequences.appendSequenced(data, func(seqs []uint64) error {
+			return rq.queue.Append(encodeSequencedBatch(qm.now(), data, seqs))
+		}); err != nil {
+			return rq.checkWritable(err)
+		}
+	} else if err := rq.queue.Append(encodeBatch(qm.now(), data, int64(points))); err != nil {
+		return rq.checkWritable(err)
+	}
+	rq.recordSize()
+	rq.countRate(rq.rates.addEnqueued, data, int64(points))
+	if sync {
+		if err := qm.syncQueue(rq.queue); err != nil {
+			return rq.checkWritable(err)
+		}
+	}
+	// The queue was written to, so its directory is writable (again).
+	_ = rq.checkWritable(nil)
+	if rq.markPending() {
+		rq.signal()
+	}
+
+	return nil
+}
+
+// SetOrderedDelivery turns ordered delivery on or off for a replication's queue. With ordered delivery, each
+// point enqueued is assigned a per-series sequence number stored with it in the queue, and the sender delivers
+// each series' points in sequence, skipping points already delivered when a write is retried.
+//
+// The sequence state of the queue is kept on disk when ordered delivery is turned off, so sequences continue
+// where they left off if it's turned back on.
+func (qm *durableQueueManager) SetOrderedDelivery(replicationID platform.ID, enabled bool) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+
+	var sequences *seriesSequences
+	if enabled {
+		var err error
+		if sequences, err = loadSeriesSequences(rq.queue.Dir()); err != nil {
+			return err
+		}
+	}
+
+	rq.sequencesMu.Lock()
+	defer rq.sequencesMu.Unlock()
+	if enabled && rq.sequences != nil {
+		return nil
+	}
+	rq.sequences = sequences
+	return nil
+}
+
+// PauseReason is a reason a replication's queue is paused for, other than the user pausing it. A queue paused
+// for several reasons only sends again once it's resumed for all of them.
+type PauseReason uint8
+
+const (
+	// PauseReasonQuota pauses the queues of an org while it's over its egress quota.
+	PauseReasonQuota PauseReason = 1 << iota
+	// PauseReasonBucketMissing pauses a queue while its remote bucket is missing.
+	PauseReasonBucketMissing
+)
+
+// PauseQueueFor stops the scanner of a replication's durable queue from sending data to the remote, for a
+// reason other than the user pausing it. Data can still be enqueued while the queue is paused.
+func (qm *durableQueueManager) PauseQueueFor(replicationID platform.ID, reason PauseReason) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	rq.setPausedFor(reason, true)
+
+	return nil
+}
+
+// ResumeQueueFor clears a reason a replication's durable queue was paused for with PauseQueueFor. The queue
+// restarts sending data unless it's still paused for another reason, or by the user.
+func (qm *durableQueueManager) ResumeQueueFor(replicationID platform.ID, reason PauseReason) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	rq.setPausedFor(reason, false)
+	rq.signal()
+
+	return nil
+}
+
+// PauseQueue stops the scanner of a replication's durable queue from sending data to the remote, on behalf of
+// the user. Data can still be enqueued while the queue is paused.
+func (qm *durableQueueManager) PauseQueue(replicationID platform.ID) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	rq.setPaused(true)
+
+	return nil
+}
+
+// PauseQueueUntil stops the scanner of a replication's durable queue from sending data to the remote until the
+// given time, after which it resumes automatically. Like PauseQueue, data can still be enqueued while paused,
+// and ResumeQueue resumes the queue before the deadline.
+func (qm *durableQueueManager) PauseQueueUntil(replicationID platform.ID, until time.Time) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+	rq.setPausedUntil(until, qm.afterFunc)
+
+	return nil
+}
+
+// ResumeQueue restarts the scanner of a durable queue paused by the user, immediately sending any data
+// enqueued while it was paused, unless it's still paused for another reason.
+func (qm *durableQueueManager) ResumeQueue(replicationID platform.ID) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
 	}
-	qm.replicationQueues[replicationID].receive <- struct{}{}
+	rq.setPaused(false)
+	rq.signal()
 
 	return nil
 }
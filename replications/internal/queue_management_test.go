@@ -1,13 +1,23 @@
 package internal
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/influxdata/influxdb/v2"
 	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
 )
@@ -43,7 +53,7 @@ func TestEnqueueScan(t *testing.T) {
 	// Enqueue some data
 	testData := "weather,location=us-midwest temperature=82 1465839830100400200"
 	qm.writeFunc = getTestWriteFunc(t, testData)
-	err = qm.EnqueueData(id1, []byte(testData))
+	err = qm.EnqueueData(id1, []byte(testData), 1)
 	require.NoError(t, err)
 }
 
@@ -60,10 +70,10 @@ func TestEnqueueScanMultiple(t *testing.T) {
 	// Enqueue some data
 	testData := "weather,location=us-midwest temperature=82 1465839830100400200"
 	qm.writeFunc = getTestWriteFunc(t, testData)
-	err = qm.EnqueueData(id1, []byte(testData))
+	err = qm.EnqueueData(id1, []byte(testData), 1)
 	require.NoError(t, err)
 
-	err = qm.EnqueueData(id1, []byte(testData))
+	err = qm.EnqueueData(id1, []byte(testData), 1)
 	require.NoError(t, err)
 }
 
@@ -270,7 +280,9 @@ func initQueueManager(t *testing.T) (string, *durableQueueManager) {
 	queuePath := filepath.Join(enginePath, "replicationq")
 
 	logger := zaptest.NewLogger(t)
-	qm := NewDurableQueueManager(logger, queuePath, WriteFunc)
+	qm := NewDurableQueueManager(logger, queuePath, metrics.NewReplicationsMetrics(), 0, func(platform.ID, []byte) error {
+		return nil
+	})
 
 	return queuePath, qm
 }
@@ -287,9 +299,9 @@ func shutdown(t *testing.T, qm *durableQueueManager) {
 	qm.replicationQueues = emptyMap
 }
 
-func getTestWriteFunc(t *testing.T, expected string) func([]byte) error {
+func getTestWriteFunc(t *testing.T, expected string) func(platform.ID, []byte) error {
 	t.Helper()
-	return func(b []byte) error {
+	return func(_ platform.ID, b []byte) error {
 		require.Equal(t, expected, string(b))
 		return nil
 	}
@@ -303,7 +315,9 @@ func TestEnqueueData(t *testing.T) {
 	defer os.RemoveAll(queuePath)
 
 	logger := zaptest.NewLogger(t)
-	qm := NewDurableQueueManager(logger, queuePath, WriteFunc)
+	qm := NewDurableQueueManager(logger, queuePath, metrics.NewReplicationsMetrics(), 0, func(platform.ID, []byte) error {
+		return nil
+	})
 
 	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
 	require.DirExists(t, filepath.Join(queuePath, id1.String()))
@@ -315,13 +329,11 @@ func TestEnqueueData(t *testing.T) {
 
 	data := "some fake data"
 
-	// close the scanner goroutine to specifically test EnqueueData()
-	rq, ok := qm.replicationQueues[id1]
-	require.True(t, ok)
-	close(rq.done)
-	go func() { <-rq.receive }() // absorb the receive to avoid testcase deadlock
+	// pause the sender to specifically test EnqueueData()
+	require.NoError(t, qm.PauseQueue(id1))
+	defer shutdown(t, qm)
 
-	require.NoError(t, qm.EnqueueData(id1, []byte(data)))
+	require.NoError(t, qm.EnqueueData(id1, []byte(data), 1))
 	sizes, err = qm.CurrentQueueSizes([]platform.ID{id1})
 	require.NoError(t, err)
 	require.Greater(t, sizes[id1], int64(8))
@@ -329,33 +341,75 @@ func TestEnqueueData(t *testing.T) {
 	written, err := qm.replicationQueues[id1].queue.Current()
 	require.NoError(t, err)
 
-	require.Equal(t, data, string(written))
+	_, payload, _, ok, err := decodeBatch(written)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, data, string(payload))
 }
 
-func TestGoroutineReceives(t *testing.T) {
+func TestPeekQueue(t *testing.T) {
 	t.Parallel()
 
 	path, qm := initQueueManager(t)
 	defer os.RemoveAll(path)
+
 	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
-	require.DirExists(t, filepath.Join(path, id1.String()))
+	require.NoError(t, qm.PauseQueue(id1))
+	defer shutdown(t, qm)
 
-	rq, ok := qm.replicationQueues[id1]
-	require.True(t, ok)
-	require.NotNil(t, rq)
-	close(rq.done) // atypical from normal behavior, but lets us receive channels to test
+	blocks, err := qm.PeekQueue(id1, 1024)
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+
+	data := [][]byte{[]byte("block one"), []byte("block two"), []byte("block three")}
+	for _, b := range data {
+		require.NoError(t, qm.EnqueueData(id1, b, 1))
+	}
+
+	// Blocks are returned without their headers, until their size reaches the limit.
+	blocks, err = qm.PeekQueue(id1, len(data[0])+1)
+	require.NoError(t, err)
+	require.Equal(t, data[:2], blocks)
 
-	go func() { require.NoError(t, qm.EnqueueData(id1, []byte("1234"))) }()
+	blocks, err = qm.PeekQueue(id1, 1024)
+	require.NoError(t, err)
+	require.Equal(t, data, blocks)
+
+	// Peeking doesn't remove anything from the queue.
+	written, err := qm.replicationQueues[id1].queue.Current()
+	require.NoError(t, err)
+	_, payload, _, _, err := decodeBatch(written)
+	require.NoError(t, err)
+	require.Equal(t, data[0], payload)
+
+	_, err = qm.PeekQueue(id2, 1024)
+	require.Error(t, err)
+}
+
+func TestSenderReceives(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	sent := make(chan struct{}, 1)
+	qm.writeFunc = func(platform.ID, []byte) error {
+		sent <- struct{}{}
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.DirExists(t, filepath.Join(path, id1.String()))
+	defer shutdown(t, qm)
+
+	require.NoError(t, qm.EnqueueData(id1, []byte("1234"), 1))
 	select {
-	case <-rq.receive:
-		return
+	case <-sent:
 	case <-time.After(time.Second):
 		t.Fatal("Test timed out")
-		return
 	}
 }
 
-func TestGoroutineCloses(t *testing.T) {
+func TestSenderCloses(t *testing.T) {
 	t.Parallel()
 
 	path, qm := initQueueManager(t)
@@ -368,7 +422,694 @@ func TestGoroutineCloses(t *testing.T) {
 	require.NotNil(t, rq)
 	require.NoError(t, qm.CloseAll())
 
-	// wg should be zero here, indicating that the goroutine has closed
-	// if this does not panic, then the routine is still active
-	require.Panics(t, func() { rq.wg.Add(-1) })
+	// The queue is no longer scheduled, and the pool's workers have all exited.
+	require.True(t, rq.isClosed())
+	rq.signal()
+	qm.senders.mu.Lock()
+	defer qm.senders.mu.Unlock()
+	require.Zero(t, qm.senders.workers)
+	require.Empty(t, qm.senders.pending)
+}
+
+func TestPauseResumeQueue(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	sent := make(chan string, 1)
+	qm.writeFunc = func(id platform.ID, b []byte) error {
+		require.Equal(t, id1, id)
+		sent <- string(b)
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+
+	// Data enqueued while paused should be kept on disk, but not sent.
+	require.NoError(t, qm.PauseQueue(id1))
+	require.NoError(t, qm.EnqueueData(id1, []byte("1234"), 1))
+	select {
+	case <-sent:
+		t.Fatal("paused queue sent data")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.False(t, qm.replicationQueues[id1].queue.Empty())
+
+	// Resuming sends the backlog without any further enqueues.
+	require.NoError(t, qm.ResumeQueue(id1))
+	select {
+	case b := <-sent:
+		require.Equal(t, "1234", b)
+	case <-time.After(time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	require.EqualError(t, qm.PauseQueue(id2), "durable queue not found for replication ID \"0000000000000002\"")
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestPauseQueueUntil(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var clockMu sync.Mutex
+	now := time.Date(2021, time.October, 1, 0, 0, 0, 0, time.UTC)
+	setNow := func(at time.Time) {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		now = at
+	}
+	qm.now = func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	start := qm.now()
+
+	// Capture the automatic resume instead of waiting for a real timer to fire.
+	type scheduled struct {
+		d time.Duration
+		f func()
+	}
+	resumes := make(chan scheduled, 1)
+	qm.afterFunc = func(d time.Duration, f func()) *time.Timer {
+		resumes <- scheduled{d: d, f: f}
+		return time.AfterFunc(time.Hour, func() {})
+	}
+
+	sent := make(chan string, 1)
+	qm.writeFunc = func(id platform.ID, b []byte) error {
+		sent <- string(b)
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+
+	noSend := func() {
+		t.Helper()
+		select {
+		case <-sent:
+			t.Fatal("paused queue sent data")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	t.Run("resumes at the deadline", func(t *testing.T) {
+		require.NoError(t, qm.PauseQueueUntil(id1, start.Add(time.Hour)))
+		resume := <-resumes
+		require.Equal(t, time.Hour, resume.d)
+
+		require.NoError(t, qm.EnqueueData(id1, []byte("1234"), 1))
+		noSend()
+
+		// Still paused just before the deadline, even if the scanner checks.
+		setNow(start.Add(time.Hour - time.Nanosecond))
+		resume.f()
+		noSend()
+
+		setNow(start.Add(time.Hour))
+		resume.f()
+		select {
+		case b := <-sent:
+			require.Equal(t, "1234", b)
+		case <-time.After(time.Second):
+			t.Fatal("Test timed out")
+		}
+	})
+
+	t.Run("indefinite pause", func(t *testing.T) {
+		require.NoError(t, qm.PauseQueue(id1))
+		setNow(start.Add(24 * 365 * time.Hour))
+		require.NoError(t, qm.EnqueueData(id1, []byte("5678"), 1))
+		noSend()
+		require.Empty(t, resumes)
+
+		require.NoError(t, qm.ResumeQueue(id1))
+		select {
+		case b := <-sent:
+			require.Equal(t, "5678", b)
+		case <-time.After(time.Second):
+			t.Fatal("Test timed out")
+		}
+	})
+
+	t.Run("paused for several reasons", func(t *testing.T) {
+		require.NoError(t, qm.PauseQueue(id1))
+		require.NoError(t, qm.PauseQueueFor(id1, PauseReasonQuota))
+		require.NoError(t, qm.EnqueueData(id1, []byte("9012"), 1))
+
+		// Resuming for one reason leaves the queue paused for the other, whichever is resumed first.
+		require.NoError(t, qm.ResumeQueueFor(id1, PauseReasonQuota))
+		noSend()
+		require.NoError(t, qm.PauseQueueFor(id1, PauseReasonQuota))
+		require.NoError(t, qm.ResumeQueue(id1))
+		noSend()
+
+		require.NoError(t, qm.ResumeQueueFor(id1, PauseReasonQuota))
+		select {
+		case b := <-sent:
+			require.Equal(t, "9012", b)
+		case <-time.After(time.Second):
+			t.Fatal("Test timed out")
+		}
+	})
+
+	require.EqualError(t, qm.PauseQueueUntil(id2, start), "durable queue not found for replication ID \"0000000000000002\"")
+}
+
+func TestSendDedup(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var sends int
+	qm.writeFunc = func(_ platform.ID, b []byte) error {
+		sends++
+		if sends == 1 {
+			return fmt.Errorf("connection reset while awaiting response: %w", ErrAmbiguousWrite)
+		}
+		return nil
+	}
+	qm.EnableSendDedup(time.Minute, 2)
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+
+	rq := qm.replicationQueues[id1]
+	now := time.Unix(1000, 0)
+	rq.dedup.now = func() time.Time { return now }
+
+	// The first attempt fails ambiguously, and the retry of the same data is suppressed.
+	require.ErrorIs(t, rq.write([]byte("batch1")), ErrAmbiguousWrite)
+	require.NoError(t, rq.write([]byte("batch1")))
+	require.Equal(t, 1, sends)
+
+	// Different data is sent as usual.
+	require.NoError(t, rq.write([]byte("batch2")))
+	require.Equal(t, 2, sends)
+
+	// Once outside of the window, identical data is sent again.
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, rq.write([]byte("batch1")))
+	require.Equal(t, 3, sends)
+
+	// The set of remembered hashes is bounded.
+	require.NoError(t, rq.write([]byte("batch3")))
+	require.NoError(t, rq.write([]byte("batch4")))
+	require.NoError(t, rq.write([]byte("batch1")))
+	require.Equal(t, 6, sends)
+	require.Len(t, rq.dedup.entries, 2)
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestBatchVerification(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var sent [][]byte
+	qm.writeFunc = func(_ platform.ID, b []byte) error {
+		sent = append(sent, b)
+		return nil
+	}
+	qm.EnableBatchVerification()
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	rq := qm.replicationQueues[id1]
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	_, err := gzw.Write([]byte("weather,location=us-midwest temperature=82 1465839830100400200\n"))
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+	valid := buf.Bytes()
+
+	// A valid batch is sent.
+	require.NoError(t, rq.write(valid))
+	require.Equal(t, [][]byte{valid}, sent)
+
+	// A truncated batch is quarantined rather than sent.
+	truncated := valid[:len(valid)-10]
+	require.NoError(t, rq.write(truncated))
+	require.Len(t, sent, 1)
+
+	quarantined, err := os.ReadDir(rq.quarantineDir)
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	contents, err := os.ReadFile(filepath.Join(rq.quarantineDir, quarantined[0].Name()))
+	require.NoError(t, err)
+	require.Equal(t, truncated, contents)
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	mfs := promtest.MustGather(t, reg)
+	m := promtest.MustFindMetric(t, mfs, "replications_queue_batches_quarantined_total", map[string]string{"replicationID": id1.String()})
+	require.Equal(t, 1.0, m.Counter.GetValue())
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestPartialWrite_RetriesRejectedPoints(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	sent := make(chan string, 2)
+	qm.writeFunc = func(_ platform.ID, b []byte) error {
+		sent <- string(b)
+		if string(b) == "accepted\nrejected\n" {
+			return &PartialWriteError{Dropped: 1, Retry: []byte("rejected\n")}
+		}
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.EnqueueData(id1, []byte("accepted\nrejected\n"), 2))
+
+	// The partially written batch is advanced past, and only its rejected points are sent again.
+	for _, want := range []string{"accepted\nrejected\n", "rejected\n"} {
+		select {
+		case b := <-sent:
+			require.Equal(t, want, b)
+		case <-time.After(time.Second):
+			t.Fatal("Test timed out")
+		}
+	}
+	require.Eventually(t, func() bool {
+		return qm.replicationQueues[id1].queue.Empty()
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, sent)
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestQueueLatency(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var mu sync.Mutex
+	now := time.Unix(1000, 0)
+	qm.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	sent := make(chan string, 1)
+	qm.writeFunc = func(_ platform.ID, b []byte) error {
+		sent <- string(b)
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+
+	// Hold the batch in the queue while time passes.
+	require.NoError(t, qm.PauseQueue(id1))
+	require.NoError(t, qm.EnqueueData(id1, []byte("1234"), 1))
+	advance(90 * time.Second)
+	require.NoError(t, qm.ResumeQueue(id1))
+
+	select {
+	case b := <-sent:
+		require.Equal(t, "1234", b)
+	case <-time.After(time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	require.Eventually(t, func() bool {
+		mfs := promtest.MustGather(t, reg)
+		m := promtest.MustFindMetric(t, mfs, "replications_queue_latency_seconds", map[string]string{"replicationID": id1.String()})
+		return m.Histogram.GetSampleCount() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	mfs := promtest.MustGather(t, reg)
+	m := promtest.MustFindMetric(t, mfs, "replications_queue_latency_seconds", map[string]string{"replicationID": id1.String()})
+	require.Equal(t, 90.0, m.Histogram.GetSampleSum())
+
+	// Blocks enqueued without a header are still sent, but don't affect the latency.
+	rq := qm.replicationQueues[id1]
+	require.NoError(t, rq.write([]byte("5678")))
+	require.Equal(t, "5678", <-sent)
+	mfs = promtest.MustGather(t, reg)
+	m = promtest.MustFindMetric(t, mfs, "replications_queue_latency_seconds", map[string]string{"replicationID": id1.String()})
+	require.Equal(t, uint64(1), m.Histogram.GetSampleCount())
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestRemoteWriteLatency(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var mu sync.Mutex
+	now := time.Unix(1000, 0)
+	qm.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	// Each write takes 2s, and the first one fails.
+	var writes int
+	qm.writeFunc = func(platform.ID, []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(2 * time.Second)
+		writes++
+		if writes == 1 {
+			return errors.New("remote is slow and failing")
+		}
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.PauseQueue(id1))
+	rq := qm.replicationQueues[id1]
+	waitIdle(rq)
+
+	require.Error(t, rq.write([]byte("1234")))
+	require.NoError(t, rq.write([]byte("1234")))
+
+	// Failed writes are timed too.
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	mfs := promtest.MustGather(t, reg)
+	m := promtest.MustFindMetric(t, mfs, "replications_queue_remote_write_duration_seconds", map[string]string{"replicationID": id1.String()})
+	require.Equal(t, uint64(2), m.Histogram.GetSampleCount())
+	require.Equal(t, 4.0, m.Histogram.GetSampleSum())
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func gzipLines(t *testing.T, lines string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	_, err := gzw.Write([]byte(lines))
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+	return buf.Bytes()
+}
+
+func TestOrderedDelivery_ConcurrentEnqueue(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.SetOrderedDelivery(id1, true))
+	require.NoError(t, qm.PauseQueue(id1))
+	rq := qm.replicationQueues[id1]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := gzipLines(t, fmt.Sprintf("cpu,host=a value=%d %d\ncpu,host=b value=%d %d\ncpu,host=a value=%d %d\n", i, i, i, i, i, i+1))
+			require.NoError(t, qm.EnqueueData(id1, data, 3))
+		}(i)
+	}
+	wg.Wait()
+
+	// In queue order, the sequence numbers of each series have no gaps or repeats.
+	scan, err := rq.queue.NewScanner()
+	require.NoError(t, err)
+	last := map[string]uint64{}
+	blocks := 0
+	for scan.Next() {
+		require.NoError(t, scan.Err())
+		_, data, seqs, ok, err := decodeBatch(scan.Bytes())
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		_, keys, err := splitLines(data)
+		require.NoError(t, err)
+		require.Len(t, seqs, len(keys))
+		for i, key := range keys {
+			require.Equal(t, last[key]+1, seqs[i])
+			last[key] = seqs[i]
+		}
+		blocks++
+	}
+	require.Equal(t, 20, blocks)
+	require.Equal(t, map[string]uint64{"cpu,host=a": 40, "cpu,host=b": 20}, last)
+
+	// Sequences continue where they left off after a restart.
+	sequences, err := loadSeriesSequences(rq.queue.Dir())
+	require.NoError(t, err)
+	require.Equal(t, last, sequences.state.Assigned)
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestOrderedDelivery_Retries(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var sent []string
+	var writeErr error
+	qm.writeFunc = func(_ platform.ID, b []byte) error {
+		if writeErr != nil {
+			return writeErr
+		}
+		gzr, err := gzip.NewReader(bytes.NewReader(b))
+		require.NoError(t, err)
+		lines, err := io.ReadAll(gzr)
+		require.NoError(t, err)
+		sent = append(sent, string(lines))
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.SetOrderedDelivery(id1, true))
+	rq := qm.replicationQueues[id1]
+	now := time.Now()
+	// The blocks below are written directly, so record the sequence numbers they hold as assigned.
+	rq.getSequences().state.Assigned = map[string]uint64{"cpu,host=a": 2, "cpu,host=b": 5}
+
+	// A failed send isn't recorded, so the whole block is sent on retry.
+	block := encodeSequencedBatch(now, gzipLines(t, "cpu,host=a value=1 1\ncpu,host=b value=1 1\n"), []uint64{1, 1})
+	writeErr = errors.New("remote unavailable")
+	require.Error(t, rq.write(block))
+	writeErr = nil
+	require.NoError(t, rq.write(block))
+	require.Equal(t, []string{"cpu,host=a value=1 1\ncpu,host=b value=1 1\n"}, sent)
+
+	// Resending a delivered block sends nothing.
+	require.NoError(t, rq.write(block))
+	require.Len(t, sent, 1)
+
+	// Only the undelivered points of a partially-delivered block are sent.
+	block = encodeSequencedBatch(now, gzipLines(t, "cpu,host=a value=1 1\ncpu,host=a value=2 2\n"), []uint64{1, 2})
+	require.NoError(t, rq.write(block))
+	require.Equal(t, "cpu,host=a value=2 2\n", sent[1])
+
+	// Points after a gap are still sent.
+	block = encodeSequencedBatch(now, gzipLines(t, "cpu,host=b value=5 5\n"), []uint64{5})
+	require.NoError(t, rq.write(block))
+	require.Equal(t, "cpu,host=b value=5 5\n", sent[2])
+	require.Equal(t, map[string]uint64{"cpu,host=a": 2, "cpu,host=b": 5}, rq.getSequences().state.Sent)
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestNewDurableQueueManager_SegmentSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		size int64
+		want int64
+	}{
+		{name: "default", size: 0, want: DefaultSegmentSize},
+		{name: "configured", size: MinSegmentSize, want: MinSegmentSize},
+		{name: "max", size: MaxSegmentSize, want: MaxSegmentSize},
+		{name: "too small", size: MinSegmentSize - 1, want: DefaultSegmentSize},
+		{name: "too large", size: MaxSegmentSize + 1, want: DefaultSegmentSize},
+		{name: "negative", size: -1, want: DefaultSegmentSize},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			queuePath := t.TempDir()
+			qm := NewDurableQueueManager(zaptest.NewLogger(t), queuePath, metrics.NewReplicationsMetrics(), tt.size, func(platform.ID, []byte) error {
+				return nil
+			})
+			require.Equal(t, tt.want, qm.segmentSize)
+		})
+	}
+}
+
+func TestValidateSegmentSize(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, ValidateSegmentSize(MinSegmentSize))
+	require.NoError(t, ValidateSegmentSize(DefaultSegmentSize))
+	require.NoError(t, ValidateSegmentSize(MaxSegmentSize))
+	require.Error(t, ValidateSegmentSize(0))
+	require.Error(t, ValidateSegmentSize(MinSegmentSize-1))
+	require.Error(t, ValidateSegmentSize(MaxSegmentSize+1))
+
+	// Every valid segment size must fit twice into the smallest allowed queue.
+	require.LessOrEqual(t, 2*MaxSegmentSize, influxdb.MinReplicationMaxQueueSizeBytes)
+}
+
+func TestSegmentSize_Reclaim(t *testing.T) {
+	t.Parallel()
+
+	queuePath := t.TempDir()
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), queuePath, metrics.NewReplicationsMetrics(), MinSegmentSize, func(platform.ID, []byte) error {
+		return nil
+	})
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+
+	// Pause the sender so data stays queued until it's sent explicitly.
+	rq := qm.replicationQueues[id1]
+	require.NoError(t, qm.PauseQueue(id1))
+	waitIdle(rq)
+	defer qm.CloseAll()
+
+	block := bytes.Repeat([]byte("a"), 16*1024)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qm.EnqueueData(id1, block, 1))
+	}
+
+	// The queue rolls over to a new segment once the tail exceeds the configured size.
+	segments := rq.queue.TotalSegments()
+	require.Greater(t, segments, 1)
+	for _, name := range segmentFiles(t, rq.queue.Dir())[:segments-1] {
+		fi, err := os.Stat(name)
+		require.NoError(t, err)
+		require.Greater(t, fi.Size(), MinSegmentSize)
+		require.Less(t, fi.Size(), MinSegmentSize+2*int64(len(block)))
+	}
+
+	// Sending drains only the head segment, after which the whole segment is removed from disk.
+	usage := rq.queue.DiskUsage()
+	var sent int
+	require.True(t, rq.SendWrite(func(b []byte) error {
+		sent++
+		return nil
+	}))
+	require.Greater(t, sent, 0)
+	require.Less(t, sent, 10)
+	require.Equal(t, segments-1, rq.queue.TotalSegments())
+	require.Less(t, rq.queue.DiskUsage(), usage)
+	require.Len(t, segmentFiles(t, rq.queue.Dir()), segments-1)
+}
+
+func TestQueueSizeMetric(t *testing.T) {
+	t.Parallel()
+
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(platform.ID, []byte) error {
+		return nil
+	})
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	rq := qm.replicationQueues[id1]
+	require.NoError(t, qm.PauseQueue(id1))
+	waitIdle(rq)
+	defer qm.CloseAll()
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	size := func() float64 {
+		m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_size_bytes", map[string]string{"replicationID": id1.String()})
+		return m.Gauge.GetValue()
+	}
+	// Empty queues are 8 bytes for the footer.
+	require.Equal(t, float64(8), size())
+
+	block := bytes.Repeat([]byte("a"), 16*1024)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qm.EnqueueData(id1, block, 1))
+		require.Equal(t, float64(rq.queue.DiskUsage()), size())
+	}
+	full := size()
+	require.Greater(t, full, float64(10*len(block)))
+
+	// Sending the head segment shrinks the queue.
+	require.True(t, rq.SendWrite(func([]byte) error { return nil }))
+	require.Less(t, size(), full)
+	require.Equal(t, float64(rq.queue.DiskUsage()), size())
+
+	// Deleted queues stop being reported.
+	require.NoError(t, qm.DeleteQueue(id1))
+	mfs := promtest.MustGather(t, reg)
+	require.Nil(t, promtest.FindMetric(mfs, "replications_queue_size_bytes", map[string]string{"replicationID": id1.String()}))
+}
+
+// segmentFiles returns the paths of the segment files in a queue directory, in order.
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	return files
+}
+
+func TestEnqueueDataSync(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var syncs int
+	syncErr := errors.New("sync failed")
+	var failSync bool
+	qm.syncQueue = func(q *durablequeue.Queue) error {
+		syncs++
+		if failSync {
+			return syncErr
+		}
+		return q.Sync()
+	}
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+
+	require.NoError(t, qm.EnqueueData(id1, []byte("not synced"), 1))
+	require.Equal(t, 0, syncs)
+
+	require.NoError(t, qm.EnqueueDataSync(id1, []byte("synced"), 1))
+	require.Equal(t, 1, syncs)
+
+	failSync = true
+	require.Equal(t, syncErr, qm.EnqueueDataSync(id1, []byte("sync fails"), 1))
+	require.Equal(t, 2, syncs)
+
+	require.Error(t, qm.EnqueueDataSync(id2, []byte("no queue"), 1))
+	require.Equal(t, 2, syncs)
+}
+
+// waitIdle waits until a queue is neither waiting for nor being drained by a sender pool worker.
+func waitIdle(rq *replicationQueue) {
+	rq.schedMu.Lock()
+	defer rq.schedMu.Unlock()
+	for rq.scheduled || rq.draining {
+		rq.schedCond.Wait()
+	}
 }
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// queueRateWindow is the sliding window the enqueue and send rates of each queue are computed over.
+	queueRateWindow = time.Minute
+	// queueRateBuckets is the number of buckets the window is divided into. Points age out of the window a bucket
+	// at a time.
+	queueRateBuckets = 12
+)
+
+// QueueStats describes how fast a replication's queue is filling up and draining. An enqueue rate persistently
+// above the send rate means the queue grows until it hits its max size.
+type QueueStats struct {
+	// EnqueueRate is the number of points enqueued per second over the recent window.
+	EnqueueRate float64
+	// SendRate is the number of points successfully sent to the remote per second over the recent window.
+	SendRate float64
+}
+
+// queueRates counts the points enqueued into and sent from a replication queue over a sliding window. Counts are
+// kept in memory, so they start over when the server restarts.
+type queueRates struct {
+	window time.Duration
+	bucket time.Duration
+	// since is when counting started. Rates are averaged over the time since then until a full window has passed,
+	// so a queue's rates aren't understated right after it's opened.
+	since time.Time
+
+	mu      sync.Mutex
+	buckets []rateBucket
+}
+
+// rateBucket counts the points enqueued and sent within a fixed-size slice of the window.
+type rateBucket struct {
+	start    time.Time
+	enqueued int64
+	sent     int64
+}
+
+func newQueueRates(now time.Time) *queueRates {
+	return &queueRates{
+		window: queueRateWindow,
+		bucket: queueRateWindow / queueRateBuckets,
+		since:  now,
+	}
+}
+
+// addEnqueued counts points enqueued at the given time.
+func (r *queueRates) addEnqueued(at time.Time, points int64) {
+	r.add(at, points, 0)
+}
+
+// addSent counts points sent at the given time.
+func (r *queueRates) addSent(at time.Time, points int64) {
+	r.add(at, 0, points)
+}
+
+func (r *queueRates) add(at time.Time, enqueued, sent int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := at.Truncate(r.bucket)
+	if n := len(r.buckets); n == 0 || r.buckets[n-1].start.Before(start) {
+		r.buckets = append(r.buckets, rateBucket{start: start})
+	}
+	last := &r.buckets[len(r.buckets)-1]
+	last.enqueued += enqueued
+	last.sent += sent
+	r.expire(at)
+}
+
+// expire drops the buckets which have fallen out of the window.
+func (r *queueRates) expire(now time.Time) {
+	cutoff := now.Add(-r.window)
+	for len(r.buckets) > 0 && !r.buckets[0].start.Add(r.bucket).After(cutoff) {
+		r.buckets = r.buckets[1:]
+	}
+}
+
+// stats returns the enqueue and send rates in points per second over the window ending now.
+func (r *queueRates) stats(now time.Time) QueueStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(now)
+	var enqueued, sent int64
+	for _, b := range r.buckets {
+		enqueued += b.enqueued
+		sent += b.sent
+	}
+
+	span := now.Sub(r.since)
+	if span > r.window {
+		span = r.window
+	}
+	if span < r.bucket {
+		span = r.bucket
+	}
+	return QueueStats{
+		EnqueueRate: float64(enqueued) / span.Seconds(),
+		SendRate:    float64(sent) / span.Seconds(),
+	}
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestQueueRates(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	r := newQueueRates(start)
+	require.Equal(t, QueueStats{}, r.stats(start))
+
+	// Until a full window has passed, rates are averaged over the time since counting started.
+	r.addEnqueued(start, 100)
+	r.addEnqueued(start.Add(10*time.Second), 100)
+	r.addSent(start.Add(15*time.Second), 50)
+	require.Equal(t, QueueStats{EnqueueRate: 10, SendRate: 2.5}, r.stats(start.Add(20*time.Second)))
+
+	// Afterwards, they're averaged over the window.
+	r.addSent(start.Add(50*time.Second), 250)
+	require.Equal(t, QueueStats{EnqueueRate: 200.0 / 60, SendRate: 300.0 / 60}, r.stats(start.Add(time.Minute)))
+
+	// Points age out of the window.
+	require.Equal(t, QueueStats{EnqueueRate: 100.0 / 60, SendRate: 300.0 / 60}, r.stats(start.Add(65*time.Second)))
+	require.Equal(t, QueueStats{}, r.stats(start.Add(2*time.Minute)))
+}
+
+func TestQueueStats(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	var mu sync.Mutex
+	now := time.Unix(1000, 0)
+	qm.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	sent := make(chan struct{}, 1)
+	qm.writeFunc = func(platform.ID, []byte) error {
+		sent <- struct{}{}
+		return nil
+	}
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.PauseQueue(id1))
+
+	_, err := qm.QueueStats(id2)
+	require.Error(t, err)
+
+	mu.Lock()
+	now = now.Add(10 * time.Second)
+	mu.Unlock()
+	require.NoError(t, qm.EnqueueData(id1, gzipLines(t, "m f=1 1\nm f=2 2\nm f=3 3\n"), 3))
+	require.NoError(t, qm.EnqueueData(id1, gzipLines(t, "m f=4 4\n"), 1))
+
+	stats, err := qm.QueueStats(id1)
+	require.NoError(t, err)
+	require.Equal(t, QueueStats{EnqueueRate: 0.4}, stats)
+
+	require.NoError(t, qm.ResumeQueue(id1))
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sent:
+		case <-time.After(time.Second):
+			t.Fatal("Test timed out")
+		}
+	}
+	waitIdle(qm.replicationQueues[id1])
+
+	stats, err = qm.QueueStats(id1)
+	require.NoError(t, err)
+	require.Equal(t, QueueStats{EnqueueRate: 0.4, SendRate: 0.4}, stats)
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	mfs := promtest.MustGather(t, reg)
+	labels := map[string]string{"replicationID": id1.String()}
+	require.Equal(t, 0.4, promtest.MustFindMetric(t, mfs, "replications_queue_enqueue_rate_points_per_second", labels).Gauge.GetValue())
+	require.Equal(t, 0.4, promtest.MustFindMetric(t, mfs, "replications_queue_send_rate_points_per_second", labels).Gauge.GetValue())
+
+	require.NoError(t, qm.CloseAll())
+}
+
+func TestQueueStats_PointCountsFromHeaders(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	now := time.Unix(1000, 0)
+	qm.now = func() time.Time { return now }
+	qm.writeFunc = func(platform.ID, []byte) error { return nil }
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	require.NoError(t, qm.PauseQueue(id1))
+	defer shutdown(t, qm)
+	rq := qm.replicationQueues[id1]
+
+	// The counts given on enqueue are used as-is, without decompressing the data to count its points.
+	now = now.Add(10 * time.Second)
+	require.NoError(t, qm.EnqueueData(id1, []byte("not line protocol"), 3))
+	// Blocks enqueued by older versions don't record their count, so their points are counted from the data.
+	require.NoError(t, rq.queue.Append(encodeBatch(now, gzipLines(t, "m f=1 1\n"), -1)))
+
+	require.True(t, rq.SendWrite(rq.sendOrRetry))
+	stats, err := qm.QueueStats(id1)
+	require.NoError(t, err)
+	require.Equal(t, QueueStats{EnqueueRate: 0.3, SendRate: 0.4}, stats)
+}
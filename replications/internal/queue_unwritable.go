@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// ErrQueueUnwritable is matched by the errors of enqueues which failed because the queue's directory can't be
+// written to, i.e. because its permissions changed or its volume was remounted read-only. Unlike a full queue,
+// this doesn't resolve itself as the queue drains.
+var ErrQueueUnwritable = errors.New("replication queue is not writable")
+
+// QueueUnwritableError is returned by enqueues which failed because the queue's directory can't be written to.
+type QueueUnwritableError struct {
+	Dir string
+	Err error
+}
+
+func (e *QueueUnwritableError) Error() string {
+	return fmt.Sprintf("replication queue directory %q is not writable, check its permissions and that its volume is mounted read-write: %v", e.Dir, e.Err)
+}
+
+func (e *QueueUnwritableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *QueueUnwritableError) Is(target error) bool {
+	return target == ErrQueueUnwritable
+}
+
+// isUnwritable reports whether an error writing to a queue is rooted in the permissions or mount of its directory.
+func isUnwritable(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+// checkWritable tracks whether the queue's directory can be written to, given the outcome of writing to the queue.
+// Errors rooted in the permissions or mount of the directory are returned as a QueueUnwritableError, and the first
+// of them is logged with what to check. Other errors, like the queue being full, are returned as-is and don't
+// change whether the queue is considered writable.
+func (rq *replicationQueue) checkWritable(err error) error {
+	if err != nil && !isUnwritable(err) {
+		return err
+	}
+
+	rq.unwritableMu.Lock()
+	defer rq.unwritableMu.Unlock()
+	if err == nil {
+		if rq.unwritable {
+			rq.unwritable = false
+			rq.metrics.QueueUnwritable.WithLabelValues(rq.id.String()).Set(0)
+			rq.logger.Info("Replication queue directory is writable again", zap.String("path", rq.queue.Dir()))
+		}
+		return nil
+	}
+
+	if !rq.unwritable {
+		rq.unwritable = true
+		rq.metrics.QueueUnwritable.WithLabelValues(rq.id.String()).Set(1)
+		rq.logger.Error("Replication queue directory is not writable, data for the replication can't be queued until "+
+			"the directory's permissions are fixed or its volume is remounted read-write",
+			zap.String("path", rq.queue.Dir()), zap.Error(err))
+	}
+	return &QueueUnwritableError{Dir: rq.queue.Dir(), Err: err}
+}
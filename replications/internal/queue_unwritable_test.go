@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestIsUnwritable(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, isUnwritable(&os.PathError{Op: "open", Path: "/q/1", Err: syscall.EACCES}))
+	require.True(t, isUnwritable(&os.PathError{Op: "open", Path: "/q/1", Err: syscall.EPERM}))
+	require.True(t, isUnwritable(fmt.Errorf("write failed: %w", &os.PathError{Op: "write", Path: "/q/1", Err: syscall.EROFS})))
+	// Size-limit rejections resolve themselves as the queue drains.
+	require.False(t, isUnwritable(durablequeue.ErrQueueFull))
+	require.False(t, isUnwritable(&os.PathError{Op: "write", Path: "/q/1", Err: syscall.ENOSPC}))
+}
+
+func TestEnqueueData_Unwritable(t *testing.T) {
+	t.Parallel()
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	// Simulate the queue's volume being remounted read-only.
+	var readOnly bool
+	qm.syncQueue = func(q *durablequeue.Queue) error {
+		if readOnly {
+			return &os.PathError{Op: "sync", Path: q.Dir(), Err: syscall.EROFS}
+		}
+		return q.Sync()
+	}
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	unwritable := func() float64 {
+		mfs := promtest.MustGather(t, reg)
+		m := promtest.MustFindMetric(t, mfs, "replications_queue_unwritable", map[string]string{"replicationID": id1.String()})
+		return m.Gauge.GetValue()
+	}
+
+	require.NoError(t, qm.EnqueueDataSync(id1, []byte("writable"), 1))
+
+	readOnly = true
+	err := qm.EnqueueDataSync(id1, []byte("read-only"), 1)
+	require.ErrorIs(t, err, ErrQueueUnwritable)
+	require.ErrorIs(t, err, syscall.EROFS)
+	var unwritableErr *QueueUnwritableError
+	require.True(t, errors.As(err, &unwritableErr))
+	require.Equal(t, filepath.Join(path, id1.String()), unwritableErr.Dir)
+	require.Contains(t, err.Error(), "check its permissions")
+	require.Equal(t, 1.0, unwritable())
+
+	// The queue is writable again once an enqueue succeeds.
+	readOnly = false
+	require.NoError(t, qm.EnqueueDataSync(id1, []byte("remounted"), 1))
+	require.Equal(t, 0.0, unwritable())
+}
+
+func TestEnqueueData_UnwritableDirectory(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("file permissions aren't enforced")
+	}
+
+	path, qm := initQueueManager(t)
+	defer os.RemoveAll(path)
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+
+	// Close the idle queue's files, and take away write access to them, so reopening them fails.
+	rq := qm.replicationQueues[id1]
+	require.NotZero(t, rq.closeIdleFiles())
+	dir := filepath.Join(path, id1.String())
+	segments, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, s := range segments {
+		require.NoError(t, os.Chmod(filepath.Join(dir, s.Name()), 0400))
+	}
+	require.NoError(t, os.Chmod(dir, 0500))
+	defer func() {
+		require.NoError(t, os.Chmod(dir, 0700))
+		for _, s := range segments {
+			require.NoError(t, os.Chmod(filepath.Join(dir, s.Name()), 0600))
+		}
+	}()
+
+	err = qm.EnqueueData(id1, []byte("unwritable"), 1)
+	require.ErrorIs(t, err, ErrQueueUnwritable)
+	require.ErrorIs(t, err, os.ErrPermission)
+}
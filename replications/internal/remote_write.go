@@ -0,0 +1,712 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"go.uber.org/zap"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// maxResponseBodyBytes bounds how much of a remote's response body is read when inspecting it.
+const maxResponseBodyBytes = 1 << 20
+
+// maxLoggedRejectedLines bounds how many of the lines rejected from a write are logged when they're dropped.
+const maxLoggedRejectedLines = 10
+
+// HTTPConfigFunc looks up the info needed to send data to a replication's remote.
+type HTTPConfigFunc func(ctx context.Context, replicationID platform.ID) (*ReplicationHTTPConfig, error)
+
+// RemoteWriter sends blocks of compressed line protocol read from replication queues to the
+// write API of their remotes.
+type RemoteWriter struct {
+	configs HTTPConfigFunc
+	logger  *zap.Logger
+	// metrics is nil unless set with SetMetrics.
+	metrics *metrics.ReplicationsMetrics
+	// deadLetter is nil unless set with SetDeadLetterFunc.
+	deadLetter DeadLetterFunc
+
+	// clients holds one client per distinct transport configuration, so connections to remotes can be reused.
+	clientsMu sync.Mutex
+	clients   map[transportSettings]*http.Client
+}
+
+// transportSettings are the parts of a ReplicationHTTPConfig which affect how connections to the remote are made.
+type transportSettings struct {
+	allowInsecureTLS bool
+	certFingerprint  string
+	proxyURL         string
+	// clientCert, clientKey, and caCert are PEM-encoded.
+	clientCert string
+	clientKey  string
+	caCert     string
+}
+
+// DeadLetterFunc records lines of line protocol rejected by the remote of a replication, and the remote's reason
+// for rejecting them, in the local bucket with the given ID. It returns the number of lines recorded.
+type DeadLetterFunc func(ctx context.Context, replicationID, bucketID platform.ID, lines []string, reason string) (int, error)
+
+func NewRemoteWriter(configs HTTPConfigFunc, log *zap.Logger) *RemoteWriter {
+	return &RemoteWriter{
+		configs: configs,
+		logger:  log,
+		clients: make(map[transportSettings]*http.Client),
+	}
+}
+
+// SetMetrics sets the metrics the points dropped by the writer are counted in.
+func (w *RemoteWriter) SetMetrics(m *metrics.ReplicationsMetrics) {
+	w.metrics = m
+}
+
+// SetDeadLetterFunc sets the function points rejected by remotes are written to a dead-letter bucket with, for
+// replications which have one. Without one, rejected points are dropped.
+func (w *RemoteWriter) SetDeadLetterFunc(f DeadLetterFunc) {
+	w.deadLetter = f
+}
+
+func (w *RemoteWriter) client(conf *ReplicationHTTPConfig) (*http.Client, error) {
+	settings := conf.transportSettings()
+
+	w.clientsMu.Lock()
+	defer w.clientsMu.Unlock()
+
+	client, ok := w.clients[settings]
+	if !ok {
+		transport, err := newTransport(settings)
+		if err != nil {
+			return nil, err
+		}
+		// Requests are bounded by the write timeout of their remote instead of a client-wide timeout.
+		client = &http.Client{Transport: transport}
+		w.clients[settings] = client
+	}
+	return client, nil
+}
+
+// newTransport returns a transport making connections to a remote with the given settings.
+func newTransport(settings transportSettings) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = newProxyFunc(settings.proxyURL)
+	return transport, nil
+}
+
+// newProxyFunc returns the proxy function of a transport sending requests through the proxy at proxyURL, or
+// through the proxy configured in the environment if it's empty. Hosts listed in NO_PROXY bypass an explicitly
+// configured proxy too, as do requests to localhost.
+func newProxyFunc(proxyURL string) func(*http.Request) (*url.URL, error) {
+	if proxyURL == "" {
+		return http.ProxyFromEnvironment
+	}
+	conf := httpproxy.FromEnvironment()
+	conf.HTTPProxy = proxyURL
+	conf.HTTPSProxy = proxyURL
+	proxy := conf.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+func newTLSConfig(settings transportSettings) (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: settings.allowInsecureTLS}
+	if settings.clientCert != "" {
+		cert, err := tls.X509KeyPair([]byte(settings.clientCert), []byte(settings.clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate for remote: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	if settings.caCert != "" {
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM([]byte(settings.caCert)) {
+			return nil, errors.New("invalid CA certificate for remote: no PEM-encoded certificates found")
+		}
+	}
+	if settings.certFingerprint == "" {
+		return conf, nil
+	}
+
+	// The pin is checked in addition to the usual chain verification (unless that's disabled),
+	// so a compromised CA can't be used to impersonate the remote.
+	conf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("remote presented no TLS certificate")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		if got := hex.EncodeToString(sum[:]); got != settings.certFingerprint {
+			return fmt.Errorf("remote TLS certificate fingerprint %s does not match pinned fingerprint %s", got, settings.certFingerprint)
+		}
+		return nil
+	}
+	return conf, nil
+}
+
+// Write sends a block of data to the remote of a replication. It has the signature expected of the
+// durable queue manager's write function: a non-nil error keeps the block at the head of the queue.
+func (w *RemoteWriter) Write(replicationID platform.ID, data []byte) error {
+	ctx := context.Background()
+
+	conf, err := w.configs(ctx, replicationID)
+	if err != nil {
+		return err
+	}
+	queued := data
+	if conf.Downsample != nil {
+		if data, err = downsample(data, conf.Downsample); err != nil {
+			return err
+		}
+	}
+	if len(conf.RenameRules) > 0 {
+		if data, err = rename(data, conf.RenameRules); err != nil {
+			return err
+		}
+	}
+	if conf.isPrometheusRemoteWrite() {
+		return w.writePrometheus(ctx, replicationID, conf, data)
+	}
+
+	data, err = convertPrecision(data, conf.writePrecision())
+	if err != nil {
+		return err
+	}
+	data, err = adaptEncoding(data, conf.RemoteCapabilities)
+	if err != nil {
+		return err
+	}
+
+	if conf.RemoteBucketTag == nil || len(conf.RemoteBucketMapping) == 0 {
+		return w.handleRejected(replicationID, conf, queued, data, w.send(ctx, replicationID, conf, data))
+	}
+	// The sub-batch for each remote bucket is posted in turn. If one fails, the whole block is retried, so
+	// buckets whose sub-batches were already accepted receive theirs again. Points rejected from partially
+	// written sub-batches are retried together once all of the sub-batches have been posted.
+	batches, err := routeToBuckets(data, *conf.RemoteBucketTag, conf.RemoteBucketMapping, conf.RemoteBucketID)
+	if err != nil {
+		return err
+	}
+	var partial *PartialWriteError
+	for _, b := range batches {
+		bucketConf := *conf
+		bucketConf.RemoteBucketID = b.bucketID
+		err := w.handleRejected(replicationID, &bucketConf, queued, b.data, w.send(ctx, replicationID, &bucketConf, b.data))
+		var pw *PartialWriteError
+		switch {
+		case errors.As(err, &pw) && partial == nil:
+			partial = pw
+		case errors.As(err, &pw):
+			// Concatenated blocks compressed with the same codec are a valid block.
+			partial.Retry = append(partial.Retry, pw.Retry...)
+		case err != nil:
+			return err
+		}
+	}
+	if partial != nil {
+		return partial
+	}
+	return nil
+}
+
+// writePrometheus translates a block of data into a Prometheus remote-write request, and posts it to the remote.
+// Fields with no numeric value are counted as dropped once the remote accepts the rest of the block.
+func (w *RemoteWriter) writePrometheus(ctx context.Context, replicationID platform.ID, conf *ReplicationHTTPConfig, data []byte) error {
+	body, dropped, err := toPrometheusRemoteWrite(data)
+	if err != nil {
+		return err
+	}
+	if err := w.handleRejected(replicationID, conf, data, data, w.send(ctx, replicationID, conf, body)); err != nil {
+		return err
+	}
+	if dropped > 0 && w.metrics != nil {
+		w.metrics.DroppedPoints.WithLabelValues(replicationID.String(), metrics.DropReasonNonNumeric).Add(float64(dropped))
+	}
+	return nil
+}
+
+// send posts a block of data to the remote bucket in conf.
+// A write which times out is ambiguous, so is retried along with the rest of the block.
+func (w *RemoteWriter) send(ctx context.Context, replicationID platform.ID, conf *ReplicationHTTPConfig, data []byte) error {
+	timeout := conf.writeTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := newWriteRequest(ctx, conf, data)
+	if err != nil {
+		return err
+	}
+
+	client, err := w.client(conf)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if os.IsTimeout(err) {
+			return fmt.Errorf("%w: remote did not respond within the %s write timeout: %v", ErrAmbiguousWrite, timeout, err)
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBodyBytes))
+	if err != nil {
+		if os.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w: remote did not respond within the %s write timeout: %v", ErrAmbiguousWrite, timeout, err)
+		}
+		return fmt.Errorf("%w: failed to read response from remote: %v", ErrAmbiguousWrite, err)
+	}
+
+	if res.StatusCode == http.StatusNotFound && isBucketNotFound(body) {
+		return &RemoteWriteError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body)), Err: ErrRemoteBucketNotFound}
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &RemoteWriteError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	// Some remotes respond with a 2xx even though they rejected part of the write.
+	if pw := parsePartialWrite(res.StatusCode, body); pw != nil {
+		return pw
+	}
+	return nil
+}
+
+// handleRejected applies the replication's policy for data rejected by its remote to the result of sending it
+// the line protocol in sent, read from the queued block. Rejections which can't succeed if retried are dropped if
+// the replication drops non-retryable data. Otherwise, only the points rejected from a partial write are retried,
+// so the points the remote accepted aren't written twice.
+func (w *RemoteWriter) handleRejected(replicationID platform.ID, conf *ReplicationHTTPConfig, queued, sent []byte, err error) error {
+	var pw *PartialWriteError
+	var writeErr *RemoteWriteError
+	switch {
+	case errors.As(err, &pw):
+		if conf.DropNonRetryableData {
+			w.dropRejected(replicationID, conf, pw)
+			return nil
+		}
+		return w.retryRejected(replicationID, conf, queued, pw)
+	case errors.As(err, &writeErr) && !writeErr.Retryable() && conf.DropNonRetryableData:
+		// Every point sent was rejected.
+		rejected := &PartialWriteError{StatusCode: writeErr.StatusCode, Message: writeErr.Message, Dropped: -1}
+		if lines, err := blockLines(sent); err == nil {
+			rejected.Dropped = len(lines)
+			rejected.RejectedLines = lines
+		}
+		w.dropRejected(replicationID, conf, rejected)
+		return nil
+	}
+	return err
+}
+
+// retryRejected returns pw holding the queued lines of the points the remote rejected from a partial write, to be
+// retried in place of the queued block. Rejected points which can't be matched to a queued line, because the
+// remote didn't identify them or they were rolled up by downsampling, can't be retried without resending the
+// accepted points too, so they're dropped instead. nil is returned if there's nothing to retry.
+func (w *RemoteWriter) retryRejected(replicationID platform.ID, conf *ReplicationHTTPConfig, queued []byte, pw *PartialWriteError) error {
+	var lines [][]byte
+	if conf.Downsample == nil && len(pw.RejectedLines) > 0 {
+		var err error
+		if lines, err = queuedLines(queued, conf, pw.RejectedLines); err != nil {
+			return err
+		}
+	}
+
+	if unmatched := pw.Dropped - len(lines); unmatched > 0 || pw.Dropped < 0 && len(lines) == 0 {
+		w.logger.Warn("Remote rejected points of a replicated write which can't be told apart from the accepted ones, dropping them",
+			zap.String("replication_id", replicationID.String()), zap.Int("dropped", unmatched), zap.String("message", pw.Message))
+		if w.metrics != nil && unmatched > 0 {
+			w.metrics.DroppedPoints.WithLabelValues(replicationID.String(), metrics.DropReasonNonRetryable).Add(float64(unmatched))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	retry, err := compressLines(lines, BlockCompression(queued))
+	if err != nil {
+		return err
+	}
+	pw.Retry = retry
+	return pw
+}
+
+// queuedLines returns the lines of a queued block which Write sent to the remote as one of the given lines, by
+// replaying the rewrites Write makes to each line before sending it.
+func queuedLines(queued []byte, conf *ReplicationHTTPConfig, sent []string) ([][]byte, error) {
+	want := make(map[string]bool, 2*len(sent))
+	for _, line := range sent {
+		want[line] = true
+		// Remotes may escape the quotes of the lines they quote in their error messages.
+		want[strings.ReplaceAll(line, `\'`, `'`)] = true
+	}
+	precision := conf.writePrecision()
+	divisor := models.GetPrecisionMultiplier(string(precision))
+
+	zr, err := Decompress(queued)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var matched [][]byte
+	r := bufio.NewReader(zr)
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			sentLine := trimmed
+			if len(conf.RenameRules) > 0 {
+				if renamed, err := renameLine(trimmed, conf.RenameRules); err == nil {
+					sentLine = renamed
+				}
+			}
+			if precision != queuedPrecision {
+				sentLine = convertLinePrecision(sentLine, divisor)
+			}
+			if want[string(sentLine)] {
+				matched = append(matched, trimmed)
+			}
+		}
+		if readErr == io.EOF {
+			return matched, nil
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+}
+
+// dropRejected discards the points of a write the remote rejected, recording the rejected lines which are known in
+// the replication's dead-letter bucket if it has one. Rejected points the remote didn't identify are dropped.
+func (w *RemoteWriter) dropRejected(replicationID platform.ID, conf *ReplicationHTTPConfig, pw *PartialWriteError) {
+	dropped := pw.Dropped
+	if conf.DeadLetterBucketID != nil && w.deadLetter != nil && len(pw.RejectedLines) > 0 {
+		// The local write isn't bounded by the remote's write timeout, which may have nearly run out.
+		n, err := w.deadLetter(context.Background(), replicationID, *conf.DeadLetterBucketID, pw.RejectedLines, pw.Message)
+		if err != nil {
+			w.logger.Error("Failed to write points rejected by remote to the dead-letter bucket",
+				zap.String("replication_id", replicationID.String()), zap.String("bucket_id", conf.DeadLetterBucketID.String()), zap.Error(err))
+		}
+		if n > 0 {
+			w.logger.Warn("Remote rejected points of a replicated write, wrote them to the dead-letter bucket",
+				zap.String("replication_id", replicationID.String()), zap.Int("dead_lettered", n), zap.String("message", pw.Message))
+			if w.metrics != nil {
+				w.metrics.DeadLetteredPoints.WithLabelValues(replicationID.String()).Add(float64(n))
+			}
+			if dropped -= n; dropped <= 0 {
+				return
+			}
+		}
+	}
+
+	logged := pw.RejectedLines
+	if len(logged) > maxLoggedRejectedLines {
+		logged = logged[:maxLoggedRejectedLines]
+	}
+	w.logger.Warn("Remote rejected points of a replicated write, dropping them",
+		zap.String("replication_id", replicationID.String()), zap.Int("dropped", dropped),
+		zap.Strings("rejected_lines", logged), zap.String("message", pw.Message))
+	if w.metrics != nil && dropped > 0 {
+		w.metrics.DroppedPoints.WithLabelValues(replicationID.String(), metrics.DropReasonNonRetryable).Add(float64(dropped))
+	}
+}
+
+// CreateBucket creates a bucket with infinite retention in the remote org of a replication, returning its ID.
+// InfluxDB 1.x remotes have no buckets, so their databases are never created.
+func (w *RemoteWriter) CreateBucket(ctx context.Context, conf *ReplicationHTTPConfig, name string) (platform.ID, error) {
+	if conf.isV1() {
+		return 0, errors.New("buckets can't be created on InfluxDB 1.x remotes")
+	}
+	ctx, cancel := context.WithTimeout(ctx, conf.writeTimeout())
+	defer cancel()
+
+	u, err := conf.remoteURL()
+	if err != nil {
+		return 0, err
+	}
+	u.Path = path.Join(u.Path, "/api/v2/buckets")
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"orgID":          conf.RemoteOrgID.String(),
+		"name":           name,
+		"retentionRules": []interface{}{},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, err
+	}
+	conf.setRemoteHeaders(req)
+	req.Header.Set("Authorization", "Token "+conf.RemoteToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	client, err := w.client(conf)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBodyBytes))
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != http.StatusCreated {
+		return 0, fmt.Errorf("creating remote bucket failed with status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var created struct {
+		ID platform.ID `json:"id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return 0, fmt.Errorf("failed to decode created remote bucket: %w", err)
+	}
+	return created.ID, nil
+}
+
+func newWriteRequest(ctx context.Context, conf *ReplicationHTTPConfig, data []byte) (*http.Request, error) {
+	u, err := conf.remoteURL()
+	if err != nil {
+		return nil, err
+	}
+	writePath := "/api/v2/write"
+	switch {
+	case conf.isPrometheusRemoteWrite():
+		writePath = prometheusRemoteWritePath
+	case conf.isV1():
+		writePath = "/write"
+	}
+	if conf.RemoteWritePath != nil {
+		writePath = *conf.RemoteWritePath
+	}
+	u.Path = path.Join(u.Path, writePath)
+
+	if conf.isPrometheusRemoteWrite() {
+		return newPrometheusWriteRequest(ctx, conf, u, data)
+	}
+
+	params := u.Query()
+	if conf.isV1() {
+		if conf.RemoteDatabase == nil || *conf.RemoteDatabase == "" {
+			return nil, ErrRemoteDatabaseMissing
+		}
+		params.Set("db", *conf.RemoteDatabase)
+		if conf.RemoteRetentionPolicy != nil && *conf.RemoteRetentionPolicy != "" {
+			params.Set("rp", *conf.RemoteRetentionPolicy)
+		}
+		params.Set("precision", v1Precision(conf.writePrecision()))
+	} else {
+		params.Set("org", conf.RemoteOrgID.String())
+		params.Set("bucket", conf.RemoteBucketID.String())
+		params.Set("precision", string(conf.writePrecision()))
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	conf.setRemoteHeaders(req)
+	if !conf.isV1() {
+		req.Header.Set("Authorization", "Token "+conf.RemoteToken)
+	} else if conf.RemoteUsername != nil {
+		// 1.x remotes take the API token as the user's password. Without a username, the remote must not
+		// have authentication enabled.
+		req.SetBasicAuth(*conf.RemoteUsername, conf.RemoteToken)
+	}
+	if encoding := contentEncoding(data); encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	contentType := influxdb.DefaultRemoteContentType
+	if conf.RemoteContentType != nil {
+		contentType = *conf.RemoteContentType
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+// newPrometheusWriteRequest returns a request posting the snappy-compressed body of a Prometheus remote-write
+// request to u. The API token is sent as a bearer token, or as the password of the remote's username if it has one.
+func newPrometheusWriteRequest(ctx context.Context, conf *ReplicationHTTPConfig, u *url.URL, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	conf.setRemoteHeaders(req)
+	if conf.RemoteUsername != nil {
+		req.SetBasicAuth(*conf.RemoteUsername, conf.RemoteToken)
+	} else if conf.RemoteToken != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.RemoteToken)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", prometheusContentType)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", prometheusRemoteWriteVersion)
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+// ErrRemoteDatabaseMissing is returned when writing to an InfluxDB 1.x remote for a replication without a remote
+// database, since 1.x remotes have no buckets to write to.
+var ErrRemoteDatabaseMissing = errors.New("replications to InfluxDB 1.x remotes must set a remote database")
+
+// v1Precision returns the value of the precision parameter of the 1.x write API for a write precision. The 1.x
+// API spells microseconds "u" rather than "us".
+func v1Precision(precision influxdb.WritePrecision) string {
+	if precision == influxdb.WritePrecisionMicroseconds {
+		return "u"
+	}
+	return string(precision)
+}
+
+// RemoteWriteError is returned by the RemoteWriter when the remote responds to a write with a non-2xx status.
+type RemoteWriteError struct {
+	StatusCode int
+	Message    string
+	// Err is a more specific cause of the failure, if one could be determined.
+	Err error
+}
+
+func (e *RemoteWriteError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %s", e.Err, e.Message)
+	}
+	return fmt.Sprintf("remote write failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *RemoteWriteError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable returns whether the remote may accept the write if it's sent again. Client errors mean the remote
+// rejected the data itself, i.e. as malformed or too large, except for missing buckets or endpoints and rejected
+// credentials, which are fixed by configuring the remote, and timeouts and rate limiting.
+func (e *RemoteWriteError) Retryable() bool {
+	if e.StatusCode < 400 || e.StatusCode >= 500 {
+		return true
+	}
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrRemoteBucketNotFound is wrapped by errors returned from Write when the remote reports that the
+// bucket being written to doesn't exist.
+var ErrRemoteBucketNotFound = errors.New("remote bucket not found")
+
+// isBucketNotFound reports whether the body of a 404 response from a remote says that the target bucket, or
+// database on 1.x remotes, doesn't exist, as opposed to i.e. the write endpoint itself being missing.
+func isBucketNotFound(body []byte) bool {
+	var parsed influxdbErrorBody
+	if err := json.Unmarshal(bytes.TrimSpace(body), &parsed); err != nil {
+		return false
+	}
+	if strings.HasPrefix(parsed.Error, "database not found") {
+		return true
+	}
+	return parsed.Code == "not found" && strings.Contains(parsed.Message, "bucket")
+}
+
+// PartialWriteError is returned by the RemoteWriter when the remote accepted a write, but reported
+// that some of its points were rejected.
+type PartialWriteError struct {
+	StatusCode int
+	Message    string
+	// Dropped is the number of points the remote reported as rejected, or -1 if it didn't say.
+	Dropped int
+	// RejectedLines are the lines of line protocol the remote identified as rejected, if any.
+	RejectedLines []string
+	// Retry is a block of queued data holding just the rejected points, to be queued for retrying in place of
+	// the block which was partially written. It's nil unless the rejected points could be identified.
+	Retry []byte
+}
+
+func (e *PartialWriteError) Error() string {
+	if e.Dropped < 0 {
+		return fmt.Sprintf("remote rejected part of the write (status %d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("remote rejected %d points of the write (status %d): %s", e.Dropped, e.StatusCode, e.Message)
+}
+
+// influxdbErrorBody is the body of an error response from the InfluxDB 2.x API.
+type influxdbErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    *int32 `json:"line,omitempty"`
+	// Error holds the message of error responses from the InfluxDB 1.x API instead.
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	droppedPattern      = regexp.MustCompile(`dropped=(\d+)`)
+	rejectedLinePattern = regexp.MustCompile(`unable to parse '((?:[^'\\]|\\.)*)'`)
+)
+
+// parsePartialWrite inspects the body of a successful response from a remote, returning a non-nil error if
+// it describes a partial write in the format used by InfluxDB 2.x. Bodies in any other format are ignored.
+func parsePartialWrite(statusCode int, body []byte) *PartialWriteError {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+
+	var parsed influxdbErrorBody
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil
+	}
+	if !strings.Contains(parsed.Message, "partial write") {
+		return nil
+	}
+
+	pw := &PartialWriteError{
+		StatusCode: statusCode,
+		Message:    parsed.Message,
+		Dropped:    -1,
+	}
+	if m := droppedPattern.FindStringSubmatch(parsed.Message); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			pw.Dropped = n
+		}
+	}
+	for _, m := range rejectedLinePattern.FindAllStringSubmatch(parsed.Message, -1) {
+		pw.RejectedLines = append(pw.RejectedLines, m[1])
+	}
+	if pw.Dropped < 0 && len(pw.RejectedLines) > 0 {
+		pw.Dropped = len(pw.RejectedLines)
+	}
+	return pw
+}
@@ -0,0 +1,629 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+const partialWriteBody = `{"code":"unprocessable entity","message":"partial write: unable to parse 'cpu,host=a value=': missing field value; unable to parse 'cpu value=\\'x\\'': invalid boolean dropped=2"}`
+
+func newTestRemote(t *testing.T, status int, body string) (*httptest.Server, chan *http.Request) {
+	t.Helper()
+
+	reqs := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		reqs <- r
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, reqs
+}
+
+func newTestRemoteWriter(t *testing.T, conf ReplicationHTTPConfig) *RemoteWriter {
+	t.Helper()
+
+	return NewRemoteWriter(func(context.Context, platform.ID) (*ReplicationHTTPConfig, error) {
+		return &conf, nil
+	}, zaptest.NewLogger(t))
+}
+
+func TestRemoteWriter_Write(t *testing.T) {
+	t.Parallel()
+
+	server, reqs := newTestRemote(t, http.StatusNoContent, "")
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:      server.URL,
+		RemoteToken:    "my-token",
+		RemoteOrgID:    platform.ID(10),
+		RemoteBucketID: platform.ID(20),
+	})
+
+	require.NoError(t, w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu value=1\n")))
+
+	req := <-reqs
+	require.Equal(t, "/api/v2/write", req.URL.Path)
+	require.Equal(t, platform.ID(10).String(), req.URL.Query().Get("org"))
+	require.Equal(t, platform.ID(20).String(), req.URL.Query().Get("bucket"))
+	require.Equal(t, "Token my-token", req.Header.Get("Authorization"))
+	require.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+	require.Equal(t, influxdb.DefaultRemoteContentType, req.Header.Get("Content-Type"))
+}
+
+func TestRemoteWriter_ContentEncoding(t *testing.T) {
+	t.Parallel()
+
+	for compression, encoding := range map[influxdb.ReplicationCompression]string{
+		influxdb.CompressionGzip: "gzip",
+		influxdb.CompressionZstd: "zstd",
+		influxdb.CompressionNone: "",
+	} {
+		compression, encoding := compression, encoding
+		t.Run(string(compression), func(t *testing.T) {
+			t.Parallel()
+
+			server, reqs := newTestRemote(t, http.StatusNoContent, "")
+			w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+
+			require.NoError(t, w.Write(id1, compress(t, compression, "cpu value=1\n")))
+			req := <-reqs
+			require.Equal(t, encoding, req.Header.Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestRemoteWriter_WritePath(t *testing.T) {
+	t.Parallel()
+
+	writePath := "/customers/1234/write"
+	server, reqs := newTestRemote(t, http.StatusNoContent, "")
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:       server.URL + "/gateway",
+		RemoteOrgID:     platform.ID(10),
+		RemoteBucketID:  platform.ID(20),
+		RemoteWritePath: &writePath,
+	})
+
+	require.NoError(t, w.Write(id1, []byte("data")))
+
+	req := <-reqs
+	require.Equal(t, "/gateway/customers/1234/write", req.URL.Path)
+	require.Equal(t, platform.ID(10).String(), req.URL.Query().Get("org"))
+	require.Equal(t, platform.ID(20).String(), req.URL.Query().Get("bucket"))
+}
+
+func TestRemoteWriter_V1(t *testing.T) {
+	t.Parallel()
+
+	apiType, db, rp, username := influxdb.RemoteAPITypeV1, "telegraf", "autogen", "writer"
+	server, reqs := newTestRemote(t, http.StatusNoContent, "")
+	conf := ReplicationHTTPConfig{
+		RemoteURL:             server.URL,
+		RemoteToken:           "my-password",
+		RemoteAPIType:         &apiType,
+		RemoteUsername:        &username,
+		RemoteDatabase:        &db,
+		RemoteRetentionPolicy: &rp,
+		RemoteWritePrecision:  influxdb.WritePrecisionMicroseconds,
+	}
+	w := newTestRemoteWriter(t, conf)
+
+	require.NoError(t, w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu value=1 1000\n")))
+
+	req := <-reqs
+	require.Equal(t, "/write", req.URL.Path)
+	require.Equal(t, "telegraf", req.URL.Query().Get("db"))
+	require.Equal(t, "autogen", req.URL.Query().Get("rp"))
+	require.Equal(t, "u", req.URL.Query().Get("precision"))
+	require.Empty(t, req.URL.Query().Get("bucket"))
+	gotUser, gotPassword, ok := req.BasicAuth()
+	require.True(t, ok)
+	require.Equal(t, "writer", gotUser)
+	require.Equal(t, "my-password", gotPassword)
+
+	// Without a username, no credentials are sent.
+	conf.RemoteUsername = nil
+	conf.RemoteRetentionPolicy = nil
+	w = newTestRemoteWriter(t, conf)
+	require.NoError(t, w.Write(id1, []byte("data")))
+	req = <-reqs
+	require.Empty(t, req.Header.Get("Authorization"))
+	require.Empty(t, req.URL.Query().Get("rp"))
+
+	// 1.x remotes have no buckets, so a database is required.
+	conf.RemoteDatabase = nil
+	w = newTestRemoteWriter(t, conf)
+	require.True(t, errors.Is(w.Write(id1, []byte("data")), ErrRemoteDatabaseMissing))
+}
+
+func TestRemoteWriter_Headers(t *testing.T) {
+	t.Parallel()
+
+	server, reqs := newTestRemote(t, http.StatusNoContent, "")
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:     server.URL,
+		RemoteToken:   "my-token",
+		RemoteHeaders: influxdb.RemoteHeaders{"X-Tenant-Id": "1234"},
+	})
+
+	require.NoError(t, w.Write(id1, []byte("data")))
+
+	req := <-reqs
+	require.Equal(t, "1234", req.Header.Get("X-Tenant-Id"))
+	require.Equal(t, "Token my-token", req.Header.Get("Authorization"))
+}
+
+func TestRemoteWriter_ContentType(t *testing.T) {
+	t.Parallel()
+
+	contentType := "application/octet-stream"
+	server, reqs := newTestRemote(t, http.StatusNoContent, "")
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:         server.URL,
+		RemoteContentType: &contentType,
+	})
+
+	require.NoError(t, w.Write(id1, []byte("data")))
+	require.Equal(t, contentType, (<-reqs).Header.Get("Content-Type"))
+}
+
+func TestRemoteWriter_WriteFailure(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestRemote(t, http.StatusServiceUnavailable, "try again later")
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+
+	err := w.Write(id1, []byte("data"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "try again later")
+
+	var writeErr *RemoteWriteError
+	require.True(t, errors.As(err, &writeErr))
+	require.Equal(t, http.StatusServiceUnavailable, writeErr.StatusCode)
+}
+
+func TestRemoteWriter_NonRetryable(t *testing.T) {
+	t.Parallel()
+
+	for _, status := range []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge} {
+		status := status
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			t.Parallel()
+
+			t.Run("not dropped", func(t *testing.T) {
+				t.Parallel()
+
+				server, _ := newTestRemote(t, status, "rejected")
+				w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+
+				var writeErr *RemoteWriteError
+				require.True(t, errors.As(w.Write(id1, []byte("cpu value=1\n")), &writeErr))
+				require.Equal(t, status, writeErr.StatusCode)
+				require.False(t, writeErr.Retryable())
+			})
+
+			t.Run("dropped", func(t *testing.T) {
+				t.Parallel()
+
+				server, reqs := newTestRemote(t, status, "rejected")
+				w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, DropNonRetryableData: true})
+				w.SetMetrics(metrics.NewReplicationsMetrics())
+				reg := prom.NewRegistry(zaptest.NewLogger(t))
+				reg.MustRegister(w.metrics.PrometheusCollectors()...)
+
+				require.NoError(t, w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu value=1\ncpu value=2\n")))
+				require.Len(t, reqs, 1)
+				m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_dropped_points_total",
+					map[string]string{"replicationID": id1.String(), "reason": metrics.DropReasonNonRetryable})
+				require.Equal(t, float64(2), m.Counter.GetValue())
+			})
+		})
+	}
+
+	t.Run("dead-lettered", func(t *testing.T) {
+		t.Parallel()
+
+		deadLetterBucket := platform.ID(30)
+		server, _ := newTestRemote(t, http.StatusBadRequest, "invalid")
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, DropNonRetryableData: true, DeadLetterBucketID: &deadLetterBucket})
+		w.SetMetrics(metrics.NewReplicationsMetrics())
+		reg := prom.NewRegistry(zaptest.NewLogger(t))
+		reg.MustRegister(w.metrics.PrometheusCollectors()...)
+
+		var gotLines []string
+		w.SetDeadLetterFunc(func(_ context.Context, _, bucketID platform.ID, lines []string, reason string) (int, error) {
+			require.Equal(t, deadLetterBucket, bucketID)
+			require.Equal(t, "invalid", reason)
+			gotLines = lines
+			return len(lines), nil
+		})
+
+		require.NoError(t, w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu value=1\ncpu value=\n")))
+		require.Equal(t, []string{"cpu value=1", "cpu value="}, gotLines)
+		mfs := promtest.MustGather(t, reg)
+		m := promtest.MustFindMetric(t, mfs, "replications_queue_dead_lettered_points_total", map[string]string{"replicationID": id1.String()})
+		require.Equal(t, float64(2), m.Counter.GetValue())
+		for _, mf := range mfs {
+			require.NotEqual(t, "replications_queue_dropped_points_total", mf.GetName())
+		}
+	})
+
+	// Rate limiting and timeouts aren't dropped.
+	for _, status := range []int{http.StatusRequestTimeout, http.StatusTooManyRequests} {
+		server, _ := newTestRemote(t, status, "try again later")
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, DropNonRetryableData: true})
+
+		var writeErr *RemoteWriteError
+		require.True(t, errors.As(w.Write(id1, []byte("cpu value=1\n")), &writeErr))
+		require.True(t, writeErr.Retryable())
+	}
+}
+
+func TestRemoteWriter_BucketNotFound(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestRemote(t, http.StatusNotFound, `{"code":"not found","message":"bucket \"0000000000000014\" not found"}`)
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+	require.True(t, errors.Is(w.Write(id1, []byte("data")), ErrRemoteBucketNotFound))
+
+	// 1.x remotes report missing databases in their own format.
+	server, _ = newTestRemote(t, http.StatusNotFound, `{"error":"database not found: \"telegraf\""}`)
+	w = newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+	require.True(t, errors.Is(w.Write(id1, []byte("data")), ErrRemoteBucketNotFound))
+
+	// Other 404s, i.e. from a proxy in front of the remote, aren't mistaken for a missing bucket.
+	server, _ = newTestRemote(t, http.StatusNotFound, "404 page not found")
+	w = newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+	err := w.Write(id1, []byte("data"))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrRemoteBucketNotFound))
+}
+
+func TestRemoteWriter_PartialWrite(t *testing.T) {
+	t.Parallel()
+
+	t.Run("retried", func(t *testing.T) {
+		t.Parallel()
+
+		server, _ := newTestRemote(t, http.StatusOK, partialWriteBody)
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+
+		err := w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu,host=a value=\ncpu,host=b value=1\ncpu value='x'\n"))
+		var pw *PartialWriteError
+		require.True(t, errors.As(err, &pw))
+		require.Equal(t, http.StatusOK, pw.StatusCode)
+		require.Equal(t, 2, pw.Dropped)
+		require.Equal(t, []string{`cpu,host=a value=`, `cpu value=\'x\'`}, pw.RejectedLines)
+		// Only the rejected points are retried, compressed like the queued block.
+		require.Equal(t, influxdb.CompressionGzip, BlockCompression(pw.Retry))
+		require.Equal(t, "cpu,host=a value=\ncpu value='x'\n", decompress(t, pw.Retry))
+	})
+
+	t.Run("unidentified rejections dropped", func(t *testing.T) {
+		t.Parallel()
+
+		server, _ := newTestRemote(t, http.StatusOK, partialWriteBody)
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL})
+		w.SetMetrics(metrics.NewReplicationsMetrics())
+		reg := prom.NewRegistry(zaptest.NewLogger(t))
+		reg.MustRegister(w.metrics.PrometheusCollectors()...)
+
+		// Retrying the whole block would write the accepted points twice.
+		require.NoError(t, w.Write(id1, []byte("cpu value=1\n")))
+		m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_dropped_points_total",
+			map[string]string{"replicationID": id1.String(), "reason": metrics.DropReasonNonRetryable})
+		require.Equal(t, float64(2), m.Counter.GetValue())
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		t.Parallel()
+
+		server, _ := newTestRemote(t, http.StatusOK, partialWriteBody)
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, DropNonRetryableData: true})
+		w.SetMetrics(metrics.NewReplicationsMetrics())
+		reg := prom.NewRegistry(zaptest.NewLogger(t))
+		reg.MustRegister(w.metrics.PrometheusCollectors()...)
+
+		require.NoError(t, w.Write(id1, []byte("data")))
+		m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_dropped_points_total",
+			map[string]string{"replicationID": id1.String(), "reason": metrics.DropReasonNonRetryable})
+		require.Equal(t, float64(2), m.Counter.GetValue())
+	})
+
+	t.Run("dead-lettered", func(t *testing.T) {
+		t.Parallel()
+
+		deadLetterBucket := platform.ID(30)
+		server, _ := newTestRemote(t, http.StatusOK, partialWriteBody)
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, DropNonRetryableData: true, DeadLetterBucketID: &deadLetterBucket})
+		w.SetMetrics(metrics.NewReplicationsMetrics())
+		reg := prom.NewRegistry(zaptest.NewLogger(t))
+		reg.MustRegister(w.metrics.PrometheusCollectors()...)
+
+		var gotLines []string
+		w.SetDeadLetterFunc(func(_ context.Context, replicationID, bucketID platform.ID, lines []string, reason string) (int, error) {
+			require.Equal(t, id1, replicationID)
+			require.Equal(t, deadLetterBucket, bucketID)
+			require.Contains(t, reason, "partial write")
+			gotLines = lines
+			return len(lines), nil
+		})
+
+		require.NoError(t, w.Write(id1, []byte("data")))
+		require.Equal(t, []string{`cpu,host=a value=`, `cpu value=\'x\'`}, gotLines)
+		mfs := promtest.MustGather(t, reg)
+		m := promtest.MustFindMetric(t, mfs, "replications_queue_dead_lettered_points_total", map[string]string{"replicationID": id1.String()})
+		require.Equal(t, float64(2), m.Counter.GetValue())
+		for _, mf := range mfs {
+			require.NotEqual(t, "replications_queue_dropped_points_total", mf.GetName())
+		}
+	})
+
+	t.Run("dead-lettering failed", func(t *testing.T) {
+		t.Parallel()
+
+		deadLetterBucket := platform.ID(30)
+		server, _ := newTestRemote(t, http.StatusOK, partialWriteBody)
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{RemoteURL: server.URL, DropNonRetryableData: true, DeadLetterBucketID: &deadLetterBucket})
+		w.SetMetrics(metrics.NewReplicationsMetrics())
+		reg := prom.NewRegistry(zaptest.NewLogger(t))
+		reg.MustRegister(w.metrics.PrometheusCollectors()...)
+		w.SetDeadLetterFunc(func(context.Context, platform.ID, platform.ID, []string, string) (int, error) {
+			return 0, errors.New("bucket not found")
+		})
+
+		// The rejected points are dropped as if there were no dead-letter bucket.
+		require.NoError(t, w.Write(id1, []byte("data")))
+		m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_dropped_points_total",
+			map[string]string{"replicationID": id1.String(), "reason": metrics.DropReasonNonRetryable})
+		require.Equal(t, float64(2), m.Counter.GetValue())
+	})
+}
+
+func TestParsePartialWrite(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		body    string
+		want    bool
+		dropped int
+	}{
+		{name: "empty body", body: ""},
+		{name: "not json", body: "ok"},
+		{name: "unrelated json", body: `{"code":"ok","message":"all good"}`},
+		{
+			name:    "field type conflict",
+			body:    `{"code":"unprocessable entity","message":"partial write: field type conflict: input field \"value\" on measurement \"cpu\" is type float, already exists as type integer dropped=3"}`,
+			want:    true,
+			dropped: 3,
+		},
+		{
+			name:    "no dropped count",
+			body:    `{"code":"invalid","message":"partial write error"}`,
+			want:    true,
+			dropped: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pw := parsePartialWrite(http.StatusOK, []byte(tt.body))
+			if !tt.want {
+				require.Nil(t, pw)
+				return
+			}
+			require.NotNil(t, pw)
+			require.Equal(t, tt.dropped, pw.Dropped)
+		})
+	}
+}
+
+func TestRemoteWriter_PinnedCertFingerprint(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	matching := hex.EncodeToString(sum[:])
+	mismatching := strings.Repeat("ab", sha256.Size)
+
+	t.Run("matching", func(t *testing.T) {
+		t.Parallel()
+
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+			RemoteURL:             server.URL,
+			AllowInsecureTLS:      true,
+			RemoteCertFingerprint: &matching,
+		})
+		require.NoError(t, w.Write(id1, []byte("data")))
+	})
+
+	t.Run("mismatching", func(t *testing.T) {
+		t.Parallel()
+
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+			RemoteURL:             server.URL,
+			AllowInsecureTLS:      true,
+			RemoteCertFingerprint: &mismatching,
+		})
+		err := w.Write(id1, []byte("data"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not match pinned fingerprint")
+	})
+}
+
+func TestRemoteWriter_Proxy(t *testing.T) {
+	t.Parallel()
+
+	// Requests to plain-HTTP remotes are forwarded by the proxy as-is, so the test server can stand in for it.
+	proxy, reqs := newTestRemote(t, http.StatusNoContent, "")
+	proxyURL := proxy.URL
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:      "http://remote.example.com",
+		RemoteToken:    "my-token",
+		RemoteOrgID:    platform.ID(10),
+		RemoteBucketID: platform.ID(20),
+		ProxyURL:       &proxyURL,
+	})
+
+	require.NoError(t, w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu value=1\n")))
+	req := <-reqs
+	require.Equal(t, "remote.example.com", req.Host)
+	require.Equal(t, "/api/v2/write", req.URL.Path)
+	require.Equal(t, "Token my-token", req.Header.Get("Authorization"))
+}
+
+func TestNewProxyFunc_NoProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "internal.example.com")
+
+	proxy := newProxyFunc("http://proxy.example.com:3128")
+	for target, proxied := range map[string]bool{
+		"http://remote.example.com/api/v2/write":    true,
+		"https://remote.example.com/api/v2/write":   true,
+		"https://internal.example.com/api/v2/write": false,
+	} {
+		req, err := http.NewRequest(http.MethodPost, target, nil)
+		require.NoError(t, err)
+		got, err := proxy(req)
+		require.NoError(t, err)
+		if !proxied {
+			require.Nil(t, got, target)
+			continue
+		}
+		require.Equal(t, "http://proxy.example.com:3128", got.String(), target)
+	}
+}
+
+func TestRemoteWriter_WriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	// The remote never responds, until the writer gives up on it.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	timeout := int32(1)
+	w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+		RemoteURL:           server.URL,
+		RemoteToken:         "my-token",
+		RemoteOrgID:         platform.ID(10),
+		RemoteBucketID:      platform.ID(20),
+		WriteTimeoutSeconds: &timeout,
+	})
+
+	start := time.Now()
+	err := w.Write(id1, compress(t, influxdb.CompressionGzip, "cpu value=1\n"))
+	require.Less(t, time.Since(start), 5*time.Second)
+	// Timed out writes are ambiguous, so they're retried rather than dropped.
+	require.ErrorIs(t, err, ErrAmbiguousWrite)
+	require.Contains(t, err.Error(), "1s write timeout")
+}
+
+// newTestClientCert returns a PEM-encoded self-signed certificate and private key for a TLS client.
+func newTestClientCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "replication"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestRemoteWriter_ClientCert(t *testing.T) {
+	t.Parallel()
+
+	clientCerts := make(chan []*x509.Certificate, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCerts <- r.TLS.PeerCertificates
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	// The remote's self-signed certificate is trusted through the configured CA certificate.
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	clientCert, clientKey := newTestClientCert(t)
+
+	t.Run("with client cert", func(t *testing.T) {
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+			RemoteURL:  server.URL,
+			ClientCert: &clientCert,
+			ClientKey:  &clientKey,
+			CACert:     &caCert,
+		})
+		require.NoError(t, w.Write(id1, []byte("data")))
+		certs := <-clientCerts
+		require.Len(t, certs, 1)
+		require.Equal(t, "replication", certs[0].Subject.CommonName)
+	})
+
+	t.Run("without client cert", func(t *testing.T) {
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+			RemoteURL: server.URL,
+			CACert:    &caCert,
+		})
+		require.Error(t, w.Write(id1, []byte("data")))
+	})
+
+	t.Run("invalid client key", func(t *testing.T) {
+		otherCert, _ := newTestClientCert(t)
+		w := newTestRemoteWriter(t, ReplicationHTTPConfig{
+			RemoteURL:  server.URL,
+			ClientCert: &otherCert,
+			ClientKey:  &clientKey,
+			CACert:     &caCert,
+		})
+		err := w.Write(id1, []byte("data"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid client certificate")
+	})
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+// rename applies rename rules to the points in a block of queued data, returning a block compressed with the same
+// codec. Lines of measurements without a rule are copied as-is; the others are rebuilt with their new measurement
+// and field names, keeping their tags and timestamp.
+func rename(data []byte, rules influxdb.ReplicationRenameRules) ([]byte, error) {
+	zr, err := Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var buf bytes.Buffer
+	cw, err := NewCompressor(BlockCompression(data), &buf)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(zr)
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			renamed, err := renameLine(trimmed, rules)
+			if err != nil {
+				return nil, fmt.Errorf("failed to rename replicated data: %w", err)
+			}
+			if _, err := cw.Write(renamed); err != nil {
+				return nil, err
+			}
+			if _, err := cw.Write([]byte{'\n'}); err != nil {
+				return nil, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renameLine applies the rule for the measurement of a line of line protocol, if it has one.
+func renameLine(line []byte, rules influxdb.ReplicationRenameRules) ([]byte, error) {
+	points, err := models.ParsePoints(line)
+	if err != nil {
+		return nil, err
+	}
+	p := points[0]
+	rule, ok := rules[string(p.Name())]
+	if !ok {
+		return line, nil
+	}
+
+	name := string(p.Name())
+	if rule.Measurement != "" {
+		name = rule.Measurement
+	}
+	fields, err := p.Fields()
+	if err != nil {
+		return nil, err
+	}
+	renamed := make(models.Fields, len(fields))
+	for k, v := range fields {
+		if to, ok := rule.Fields[k]; ok {
+			k = to
+		} else if _, ok := renamed[k]; ok {
+			// A field renamed to this one's name replaces it.
+			continue
+		}
+		renamed[k] = v
+	}
+	np, err := models.NewPoint(name, p.Tags(), renamed, p.Time())
+	if err != nil {
+		return nil, err
+	}
+	return []byte(np.String()), nil
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRename(t *testing.T) {
+	t.Parallel()
+
+	rules := influxdb.ReplicationRenameRules{
+		"cpu":  {Measurement: "site1_cpu", Fields: map[string]string{"usage": "usage_percent"}},
+		"mem":  {Measurement: "site1_mem"},
+		"disk": {Fields: map[string]string{"free": "used"}},
+	}
+	data := compress(t, influxdb.CompressionGzip, `cpu,host=a usage=1.5,idle=98i 1000
+mem,host=a free=2i 2000
+disk,host=a,path=/ free=3i,used=4i 3000
+net,host=a bytes_in=5i,ratio=1.50 4000
+no_timestamp value="x y"
+`)
+
+	renamed, err := rename(data, rules)
+	require.NoError(t, err)
+	require.Equal(t, influxdb.CompressionGzip, BlockCompression(renamed))
+	// Tags and timestamps are kept, and lines without a rule are passed through byte for byte. A field renamed to
+	// the name of another field replaces it.
+	require.Equal(t, `site1_cpu,host=a idle=98i,usage_percent=1.5 1000
+site1_mem,host=a free=2i 2000
+disk,host=a,path=/ used=3i 3000
+net,host=a bytes_in=5i,ratio=1.50 4000
+no_timestamp value="x y"
+`, decompress(t, renamed))
+}
+
+func TestRenameRules_OK(t *testing.T) {
+	require.NoError(t, influxdb.ReplicationRenameRules{"cpu": {Measurement: "prefix_cpu"}}.OK())
+	require.NoError(t, influxdb.ReplicationRenameRules{"cpu": {Fields: map[string]string{"a": "b", "b": "a"}}}.OK())
+
+	for _, rules := range []influxdb.ReplicationRenameRules{
+		{"cpu": {}},
+		{"": {Measurement: "x"}},
+		{"cpu": {Measurement: "bad\nname"}},
+		{"cpu": {Fields: map[string]string{"a": ""}}},
+		{"cpu": {Fields: map[string]string{"a": "c", "b": "c"}}},
+		{"cpu": {Measurement: "x", Fields: map[string]string{"a": "\x00"}}},
+	} {
+		require.Equal(t, &influxdb.ErrInvalidRenameRules, rules.OK(), rules)
+	}
+}
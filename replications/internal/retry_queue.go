@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+	"go.uber.org/zap"
+)
+
+// retryQueue holds the batches of a replication which failed to send, so they're retried on their own backoff
+// schedule instead of blocking the newer data behind them in the main queue. Retries back off exponentially
+// while they keep failing, and the backoff resets once the retry queue is emptied.
+//
+// The retry queue shares its replication's max queue size with the main queue.
+type retryQueue struct {
+	queue      *durablequeue.Queue
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	backoff time.Duration
+	// next is when the retry queue is next due to be sent. A timer signals the queue then.
+	next  time.Time
+	timer *time.Timer
+}
+
+// EnableRetryQueues gives every queue created after the call a retry queue. Batches which fail to send are moved
+// into it, and retried after minBackoff, doubling the wait up to maxBackoff while they keep failing, while the
+// main queue carries on sending newer data. Queues with ordered delivery keep retrying failed batches at the
+// head of the main queue, since moving them aside would deliver their series out of order.
+func (qm *durableQueueManager) EnableRetryQueues(minBackoff, maxBackoff time.Duration) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	qm.retryMinBackoff = minBackoff
+	qm.retryMaxBackoff = maxBackoff
+}
+
+// openRetryQueue opens the retry queue of a replication queue, if retry queues are enabled. Batches left in the
+// retry queue by a previous run are retried straight away.
+func (qm *durableQueueManager) openRetryQueue(rq *replicationQueue, maxQueueSizeBytes int64) error {
+	if qm.retryMinBackoff <= 0 {
+		return nil
+	}
+
+	dir := filepath.Join(qm.queuePath, "retry", rq.id.String())
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	queue, err := durablequeue.NewQueue(
+		dir,
+		maxQueueSizeBytes,
+		qm.segmentSize,
+		rq.totalSize,
+		durablequeue.MaxWritesPending,
+		func(bytes []byte) error {
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if err := queue.Open(); err != nil {
+		return err
+	}
+
+	rq.retry = &retryQueue{
+		queue:      queue,
+		minBackoff: qm.retryMinBackoff,
+		maxBackoff: qm.retryMaxBackoff,
+		backoff:    qm.retryMinBackoff,
+	}
+	return nil
+}
+
+// sendOrRetry sends a block of data from the main queue. If the send fails and the queue has a retry queue, the
+// block is moved into the retry queue so the main queue can carry on. Otherwise, the main queue backs off.
+func (rq *replicationQueue) sendOrRetry(block []byte) error {
+	err := rq.write(block)
+	if err == nil {
+		rq.resetBackoff()
+		return nil
+	}
+	if rq.retry == nil || rq.getSequences() != nil {
+		rq.backOff()
+		return err
+	}
+
+	if appendErr := rq.retry.queue.Append(block); appendErr != nil {
+		rq.logger.Warn("Failed to move batch into retry queue, retrying it in place", zap.Error(appendErr))
+		rq.backOff()
+		return err
+	}
+	rq.logger.Debug("Moved batch which failed to send into retry queue", zap.Error(err))
+	rq.scheduleRetry(false)
+	return nil
+}
+
+// requeueRejected queues the points a remote rejected from a partial write to be retried in place of the batch
+// they were sent in. They go into the retry queue if the queue has one, and onto the back of the main queue
+// otherwise.
+func (rq *replicationQueue) requeueRejected(data []byte) error {
+	block := encodeBatch(rq.now(), data, -1)
+	if rq.retry == nil {
+		if err := rq.queue.Append(block); err != nil {
+			return err
+		}
+		rq.recordSize()
+		return nil
+	}
+	if err := rq.retry.queue.Append(block); err != nil {
+		return err
+	}
+	rq.scheduleRetry(false)
+	return nil
+}
+
+// sendRetries sends the batches in the retry queue if they're due, and schedules the next attempt if any remain.
+func (rq *replicationQueue) sendRetries() {
+	if rq.retry == nil {
+		return
+	}
+	rq.retry.mu.Lock()
+	due := !rq.now().Before(rq.retry.next)
+	rq.retry.mu.Unlock()
+	if !due || rq.retry.queue.Empty() {
+		return
+	}
+
+	for !rq.isClosed() && !rq.isPaused() && rq.sendFrom(rq.retry.queue, rq.write) {
+	}
+
+	if rq.retry.queue.Empty() {
+		rq.retry.mu.Lock()
+		rq.retry.backoff = rq.retry.minBackoff
+		rq.retry.mu.Unlock()
+		return
+	}
+	// Batches held back by the send gate didn't fail, and are retried once the queue is woken.
+	if rq.gated() {
+		return
+	}
+	rq.scheduleRetry(true)
+}
+
+// scheduleRetry schedules the retry queue to be sent after the current backoff, unless it's already scheduled.
+// A failed retry doubles the backoff, and replaces any pending schedule.
+func (rq *replicationQueue) scheduleRetry(failed bool) {
+	r := rq.retry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if failed {
+		if r.backoff *= 2; r.backoff > r.maxBackoff {
+			r.backoff = r.maxBackoff
+		}
+	} else if r.timer != nil {
+		return
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.next = rq.now().Add(r.backoff)
+	r.timer = rq.afterFunc(r.backoff, func() {
+		r.mu.Lock()
+		r.timer = nil
+		r.mu.Unlock()
+		rq.signal()
+	})
+}
+
+// closeRetryQueue stops retries and closes the retry queue, if the queue has one.
+func (rq *replicationQueue) closeRetryQueue() error {
+	if rq.retry == nil {
+		return nil
+	}
+	rq.retry.mu.Lock()
+	if rq.retry.timer != nil {
+		rq.retry.timer.Stop()
+		rq.retry.timer = nil
+	}
+	rq.retry.mu.Unlock()
+	return rq.retry.queue.Close()
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRetryQueue_FreshDataNotBlocked(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var sent []string
+	var badAttempts int
+	healthy := false
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(_ platform.ID, b []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if string(b) == "bad" {
+			badAttempts++
+			if !healthy {
+				return errors.New("remote rejected the batch")
+			}
+		}
+		sent = append(sent, string(b))
+		return nil
+	})
+	qm.EnableRetryQueues(20*time.Millisecond, 100*time.Millisecond)
+	defer shutdown(t, qm)
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	rq := qm.replicationQueues[id1]
+	require.NotNil(t, rq.retry)
+
+	// The failing batch is moved aside, and the data enqueued after it is sent regardless.
+	for _, data := range []string{"bad", "good1", "good2"} {
+		require.NoError(t, qm.EnqueueData(id1, []byte(data), 1))
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 2
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	require.Equal(t, []string{"good1", "good2"}, sent)
+	mu.Unlock()
+
+	// The failing batch keeps being retried on its own schedule, backing off as it goes.
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return badAttempts >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+	rq.retry.mu.Lock()
+	require.Greater(t, rq.retry.backoff, 20*time.Millisecond)
+	rq.retry.mu.Unlock()
+	require.False(t, rq.retry.queue.Empty())
+
+	// Data waiting to be retried counts towards the size of the queue.
+	sizes, err := qm.CurrentQueueSizes([]platform.ID{id1})
+	require.NoError(t, err)
+	require.Greater(t, sizes[id1], int64(16))
+
+	// Once the remote accepts the batch, the retry queue drains and its backoff resets.
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 3
+	}, 2*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	require.Equal(t, "bad", sent[2])
+	mu.Unlock()
+	require.Eventually(t, rq.retry.queue.Empty, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		rq.retry.mu.Lock()
+		defer rq.retry.mu.Unlock()
+		return rq.retry.backoff == 20*time.Millisecond
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRetryQueue_Disabled(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var sent []string
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(_ platform.ID, b []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if string(b) == "bad" {
+			return errors.New("remote rejected the batch")
+		}
+		sent = append(sent, string(b))
+		return nil
+	})
+	defer shutdown(t, qm)
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	rq := qm.replicationQueues[id1]
+	require.Nil(t, rq.retry)
+
+	// Without a retry queue, a failing batch blocks the data behind it.
+	for _, data := range []string{"bad", "good"} {
+		require.NoError(t, qm.EnqueueData(id1, []byte(data), 1))
+	}
+	waitIdle(rq)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Empty(t, sent)
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"go.uber.org/zap"
+)
+
+// sendBackoff delays sending a replication's main queue again after its remote fails to accept data, so a remote
+// which is down isn't sent every block enqueued for it. The delay starts at interval and doubles on each
+// consecutive failure up to max, with jitter so replications of the same remote don't retry in lockstep. A
+// successful send resets it.
+type sendBackoff struct {
+	mu sync.Mutex
+	// interval is zero unless the replication backs off, in which case failed sends are retried whenever the
+	// queue is next signalled.
+	interval time.Duration
+	max      time.Duration
+	current  time.Duration
+	// next is when the queue may send again. A timer signals the queue then.
+	next  time.Time
+	timer *time.Timer
+}
+
+// SetRetryBackoff sets how long a replication's queue waits before sending again after a send fails, doubling up
+// to maxInterval while sends keep failing. A zero maxInterval uses influxdb.DefaultReplicationMaxRetryIntervalSeconds,
+// and a zero interval disables the backoff.
+func (qm *durableQueueManager) SetRetryBackoff(replicationID platform.ID, interval, maxInterval time.Duration) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+
+	if maxInterval <= 0 {
+		maxInterval = time.Duration(influxdb.DefaultReplicationMaxRetryIntervalSeconds) * time.Second
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+
+	b := &rq.backoff
+	b.mu.Lock()
+	b.interval, b.max = interval, maxInterval
+	disabled := interval <= 0
+	if disabled {
+		b.resetLocked()
+	} else if b.current > maxInterval {
+		b.current = maxInterval
+	}
+	b.mu.Unlock()
+
+	if disabled {
+		rq.signal()
+	}
+	return nil
+}
+
+// ResetRetryBackoff clears the backoff of a replication's queue after failed sends, including that of its retry
+// queue, and signals it to send again immediately, e.g. once its remote is known to be back.
+func (qm *durableQueueManager) ResetRetryBackoff(replicationID platform.ID) error {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	rq, exist := qm.replicationQueues[replicationID]
+	if !exist {
+		return fmt.Errorf("durable queue not found for replication ID %q", replicationID)
+	}
+
+	rq.resetBackoff()
+	if r := rq.retry; r != nil {
+		r.mu.Lock()
+		r.backoff = r.minBackoff
+		r.next = time.Time{}
+		if r.timer != nil {
+			r.timer.Stop()
+			r.timer = nil
+		}
+		r.mu.Unlock()
+	}
+	rq.signal()
+	return nil
+}
+
+// NextRetryTimes returns when each of the given queues which is backing off after a failed send will send again.
+// Queues which aren't backing off are left out.
+func (qm *durableQueueManager) NextRetryTimes(ids []platform.ID) map[platform.ID]time.Time {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	next := make(map[platform.ID]time.Time)
+	now := qm.now()
+	for _, id := range ids {
+		rq, exist := qm.replicationQueues[id]
+		if !exist {
+			continue
+		}
+		rq.backoff.mu.Lock()
+		if now.Before(rq.backoff.next) {
+			next[id] = rq.backoff.next
+		}
+		rq.backoff.mu.Unlock()
+	}
+	return next
+}
+
+// backOff records a failed send from the main queue, delaying the next one if the queue backs off.
+func (rq *replicationQueue) backOff() {
+	b := &rq.backoff
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.interval <= 0 {
+		return
+	}
+	if b.current == 0 {
+		b.current = b.interval
+	} else if b.current *= 2; b.current > b.max {
+		b.current = b.max
+	}
+	wait := jitter(b.current)
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.next = rq.now().Add(wait)
+	b.timer = rq.afterFunc(wait, rq.signal)
+	rq.logger.Debug("Backing off after failed send", zap.Duration("wait", wait))
+}
+
+// resetBackoff records a successful send from the main queue.
+func (rq *replicationQueue) resetBackoff() {
+	rq.backoff.mu.Lock()
+	defer rq.backoff.mu.Unlock()
+	rq.backoff.resetLocked()
+}
+
+// backingOff returns whether the queue is waiting to send again after a failed send.
+func (rq *replicationQueue) backingOff() bool {
+	rq.backoff.mu.Lock()
+	defer rq.backoff.mu.Unlock()
+	return rq.now().Before(rq.backoff.next)
+}
+
+// resetLocked clears the backoff. b.mu must be held.
+func (b *sendBackoff) resetLocked() {
+	b.current = 0
+	b.next = time.Time{}
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+}
+
+// jitter returns a random duration between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
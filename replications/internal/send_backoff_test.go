@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSendBackoff(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	attempts, failing := 0, true
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(platform.ID, []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if failing {
+			return errors.New("remote returned 503")
+		}
+		return nil
+	})
+	getAttempts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+
+	var clockMu sync.Mutex
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	qm.now = func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		now = now.Add(d)
+	}
+	// Capture the retries instead of waiting for real timers to fire.
+	type scheduled struct {
+		d time.Duration
+		f func()
+	}
+	retries := make(chan scheduled, 1)
+	qm.afterFunc = func(d time.Duration, f func()) *time.Timer {
+		retries <- scheduled{d: d, f: f}
+		return time.AfterFunc(time.Hour, func() {})
+	}
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+	rq := qm.replicationQueues[id1]
+	require.NoError(t, qm.SetRetryBackoff(id1, 10*time.Second, 40*time.Second))
+	require.Empty(t, qm.NextRetryTimes([]platform.ID{id1}))
+
+	// Each consecutive failure doubles the wait, with jitter, up to the max.
+	require.NoError(t, qm.EnqueueData(id1, []byte("a"), 1))
+	for _, backoff := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 40 * time.Second} {
+		retry := <-retries
+		waitIdle(rq)
+		require.GreaterOrEqual(t, retry.d, backoff/2)
+		require.LessOrEqual(t, retry.d, backoff)
+		require.Equal(t, map[platform.ID]time.Time{id1: qm.now().Add(retry.d)}, qm.NextRetryTimes([]platform.ID{id1}))
+
+		// More data doesn't bring the next attempt forward.
+		sent := getAttempts()
+		require.NoError(t, qm.EnqueueData(id1, []byte("b"), 1))
+		waitIdle(rq)
+		require.Equal(t, sent, getAttempts())
+
+		advance(retry.d)
+		retry.f()
+	}
+
+	// A successful send resets the backoff.
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	retry := <-retries
+	waitIdle(rq)
+	advance(retry.d)
+	retry.f()
+	require.Eventually(t, func() bool {
+		return rq.queue.TotalBytes() == 0
+	}, time.Second, 10*time.Millisecond)
+	waitIdle(rq)
+	require.Empty(t, qm.NextRetryTimes([]platform.ID{id1}))
+
+	require.EqualError(t, qm.SetRetryBackoff(id2, time.Second, 0), "durable queue not found for replication ID \"0000000000000002\"")
+}
+
+func TestResetRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	attempts, failing := 0, true
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(platform.ID, []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if failing {
+			return errors.New("remote returned 503")
+		}
+		return nil
+	})
+	getAttempts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+	// Capture the retries, and never fire them, so only a reset can send again.
+	retries := make(chan time.Duration, 1)
+	qm.afterFunc = func(d time.Duration, f func()) *time.Timer {
+		retries <- d
+		return time.AfterFunc(time.Hour, func() {})
+	}
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+	rq := qm.replicationQueues[id1]
+	require.NoError(t, qm.SetRetryBackoff(id1, time.Minute, time.Hour))
+
+	// A failed send starts backing off.
+	require.NoError(t, qm.EnqueueData(id1, []byte("a"), 1))
+	<-retries
+	waitIdle(rq)
+	require.Equal(t, 1, getAttempts())
+	require.Len(t, qm.NextRetryTimes([]platform.ID{id1}), 1)
+
+	// Resetting the backoff sends again immediately.
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	require.NoError(t, qm.ResetRetryBackoff(id1))
+	require.Eventually(t, func() bool {
+		return rq.queue.TotalBytes() == 0
+	}, time.Second, 10*time.Millisecond)
+	waitIdle(rq)
+	require.Equal(t, 2, getAttempts())
+	require.Empty(t, qm.NextRetryTimes([]platform.ID{id1}))
+
+	require.EqualError(t, qm.ResetRetryBackoff(id2), "durable queue not found for replication ID \"0000000000000002\"")
+}
+
+func TestJitter(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 100; i++ {
+		d := jitter(10 * time.Second)
+		require.GreaterOrEqual(t, d, 5*time.Second)
+		require.LessOrEqual(t, d, 10*time.Second)
+	}
+}
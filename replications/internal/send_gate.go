@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"github.com/influxdata/influxdb/v2/kit/platform"
+)
+
+// SetSendGate sets a function consulted by every queue created after the call before it sends each batch. While
+// the gate returns false for a queue, the queue stops sending and frees its sender pool worker for other queues,
+// leaving its data in place without backing off. The gate must call WakeQueue for the queue once it may send
+// again.
+func (qm *durableQueueManager) SetSendGate(gate func(replicationID platform.ID) bool) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	qm.sendGate = gate
+}
+
+// WakeQueue signals a queue which its send gate held back that it may send again.
+func (qm *durableQueueManager) WakeQueue(replicationID platform.ID) {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	if rq, exist := qm.replicationQueues[replicationID]; exist {
+		rq.signal()
+	}
+}
+
+// gated returns whether the queue's send gate is holding it back.
+func (rq *replicationQueue) gated() bool {
+	return rq.sendGate != nil && !rq.sendGate(rq.id)
+}
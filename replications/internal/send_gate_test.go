@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSendGate(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var sent []string
+	open := false
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(_ platform.ID, b []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, string(b))
+		// The gate closes after each batch.
+		open = false
+		return nil
+	})
+	qm.SetSendGate(func(platform.ID) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return open
+	})
+	getSent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), sent...)
+	}
+	wake := func() {
+		mu.Lock()
+		open = true
+		mu.Unlock()
+		qm.WakeQueue(id1)
+	}
+
+	require.NoError(t, qm.InitializeQueue(id1, maxQueueSizeBytes))
+	defer shutdown(t, qm)
+	rq := qm.replicationQueues[id1]
+
+	// Nothing is sent while the gate is closed, and the queue doesn't back off.
+	require.NoError(t, qm.EnqueueData(id1, []byte("a"), 1))
+	require.NoError(t, qm.EnqueueData(id1, []byte("b"), 1))
+	waitIdle(rq)
+	require.Empty(t, getSent())
+	require.False(t, rq.backingOff())
+
+	// Each time the queue is woken, it sends until the gate closes again, without resending what it sent.
+	wake()
+	waitIdle(rq)
+	require.Equal(t, []string{"a"}, getSent())
+	wake()
+	waitIdle(rq)
+	require.Equal(t, []string{"a", "b"}, getSent())
+	require.True(t, rq.queue.Empty())
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+)
+
+// DefaultSenderWorkers is the number of workers sending data from replication queues to remotes unless
+// configured otherwise.
+var DefaultSenderWorkers = 4 * runtime.GOMAXPROCS(0)
+
+// senderPool runs the senders of all replication queues on a bounded number of shared workers, so the number of
+// goroutines sending data doesn't grow with the number of replications. A queue with data to send is scheduled
+// onto the pool, and a worker drains it before moving on to the next scheduled queue. Queues are served in the
+// order they were scheduled, and each is scheduled at most once at a time.
+//
+// Workers are started when a queue is first scheduled, and stopped by stop.
+type senderPool struct {
+	metrics *metrics.ReplicationsMetrics
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	size    int
+	workers int
+	active  int
+	running bool
+	pending []*replicationQueue
+	wg      sync.WaitGroup
+}
+
+func newSenderPool(size int, metrics *metrics.ReplicationsMetrics) *senderPool {
+	if size <= 0 {
+		size = DefaultSenderWorkers
+	}
+	p := &senderPool{size: size, metrics: metrics}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// resize changes the number of workers. Surplus workers exit once they finish draining their current queue.
+func (p *senderPool) resize(size int) {
+	if size <= 0 {
+		size = DefaultSenderWorkers
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.size = size
+	if p.running {
+		p.startWorkers()
+	}
+	p.cond.Broadcast()
+}
+
+// submit schedules a queue to be drained by a worker.
+func (p *senderPool) submit(rq *replicationQueue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.running {
+		p.running = true
+		p.startWorkers()
+	}
+	p.pending = append(p.pending, rq)
+	p.updateMetrics()
+	p.cond.Signal()
+}
+
+// startWorkers starts workers until there are as many as the size of the pool. p.mu must be held.
+func (p *senderPool) startWorkers() {
+	for ; p.workers < p.size; p.workers++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+func (p *senderPool) work() {
+	defer p.wg.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		for p.running && p.workers <= p.size && len(p.pending) == 0 {
+			p.cond.Wait()
+		}
+		if !p.running || p.workers > p.size {
+			p.workers--
+			return
+		}
+
+		rq := p.pending[0]
+		p.pending[0] = nil
+		p.pending = p.pending[1:]
+		p.active++
+		p.updateMetrics()
+		p.mu.Unlock()
+
+		rq.drain()
+
+		p.mu.Lock()
+		p.active--
+		p.updateMetrics()
+	}
+}
+
+// stop waits for the workers to finish draining their current queues, and stops them. Queues still waiting
+// for a worker are dropped; they're scheduled again the next time data is enqueued into them. The pool starts
+// again when a queue is next scheduled.
+func (p *senderPool) stop() {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return
+	}
+	p.running = false
+	for _, rq := range p.pending {
+		rq.unschedule()
+	}
+	p.pending = nil
+	p.updateMetrics()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// stats returns the number of workers currently draining a queue, and the number of queues waiting for a worker.
+func (p *senderPool) stats() (active, queued int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active, len(p.pending)
+}
+
+// updateMetrics publishes the pool's worker counts. p.mu must be held.
+func (p *senderPool) updateMetrics() {
+	p.metrics.SenderWorkersActive.Set(float64(p.active))
+	p.metrics.SenderQueuesWaiting.Set(float64(len(p.pending)))
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSenderPool_BoundedGoroutines(t *testing.T) {
+	const (
+		replications = 1000
+		workers      = 8
+		// slack allows for goroutines started by the runtime and test framework while the test runs.
+		slack = 10
+	)
+
+	var inFlight, maxInFlight, sent int64
+	release := make(chan struct{})
+	qm := NewDurableQueueManager(zaptest.NewLogger(t), t.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(platform.ID, []byte) error {
+		n := atomic.AddInt64(&inFlight, 1)
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt64(&inFlight, -1)
+		atomic.AddInt64(&sent, 1)
+		return nil
+	})
+	qm.SetSenderWorkers(workers)
+	defer shutdown(t, qm)
+
+	baseline := runtime.NumGoroutine()
+	for i := 1; i <= replications; i++ {
+		id := platform.ID(i)
+		require.NoError(t, qm.InitializeQueue(id, maxQueueSizeBytes))
+		require.NoError(t, qm.EnqueueData(id, []byte(fmt.Sprintf("data %d", i)), 1))
+	}
+
+	// Every worker is busy sending, and the rest of the queues wait their turn.
+	require.Eventually(t, func() bool {
+		active, queued := qm.SenderStats()
+		return active == workers && queued == replications-workers
+	}, 5*time.Second, 10*time.Millisecond)
+	require.LessOrEqual(t, runtime.NumGoroutine()-baseline, workers+slack)
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(qm.metrics.PrometheusCollectors()...)
+	mfs := promtest.MustGather(t, reg)
+	m := promtest.MustFindMetric(t, mfs, "replications_queue_sender_workers_active", nil)
+	require.Equal(t, float64(workers), m.Gauge.GetValue())
+	m = promtest.MustFindMetric(t, mfs, "replications_queue_sender_queues_waiting", nil)
+	require.Equal(t, float64(replications-workers), m.Gauge.GetValue())
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&sent) == replications
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(workers), atomic.LoadInt64(&maxInFlight))
+
+	require.Eventually(t, func() bool {
+		active, queued := qm.SenderStats()
+		return active == 0 && queued == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSenderPool_Resize(t *testing.T) {
+	t.Parallel()
+
+	p := newSenderPool(4, metrics.NewReplicationsMetrics())
+	p.resize(2)
+	rq := &replicationQueue{senders: p, closed: true}
+	p.submit(rq)
+	p.mu.Lock()
+	require.Equal(t, 2, p.workers)
+	p.mu.Unlock()
+
+	p.resize(6)
+	p.mu.Lock()
+	require.Equal(t, 6, p.workers)
+	p.mu.Unlock()
+
+	// Surplus workers exit once the pool shrinks.
+	p.resize(1)
+	require.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.workers == 1
+	}, time.Second, 10*time.Millisecond)
+
+	p.stop()
+	require.Zero(t, p.workers)
+}
+
+func BenchmarkSenderPool_Replications(b *testing.B) {
+	for _, replications := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("replications=%d", replications), func(b *testing.B) {
+			var sent int64
+			qm := NewDurableQueueManager(zaptest.NewLogger(b), b.TempDir(), metrics.NewReplicationsMetrics(), MinSegmentSize, func(platform.ID, []byte) error {
+				atomic.AddInt64(&sent, 1)
+				return nil
+			})
+			for i := 1; i <= replications; i++ {
+				require.NoError(b, qm.InitializeQueue(platform.ID(i), maxQueueSizeBytes))
+			}
+			defer qm.CloseAll()
+
+			data := []byte("cpu value=1")
+			baseline := runtime.NumGoroutine()
+			peak := baseline
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for i := 1; i <= replications; i++ {
+					require.NoError(b, qm.EnqueueData(platform.ID(i), data, 1))
+				}
+				if g := runtime.NumGoroutine(); g > peak {
+					peak = g
+				}
+			}
+			for atomic.LoadInt64(&sent) < int64(b.N*replications) {
+				time.Sleep(time.Millisecond)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(peak-baseline), "goroutines")
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/pkg/file"
+)
+
+// sequencesFile is the name of the file in a queue's directory holding its series sequence log.
+const sequencesFile = "sequences.log"
+
+// maxSequenceLogRecords is the number of records appended to a sequence log before it's compacted.
+const maxSequenceLogRecords = 1024
+
+// seriesSequences assigns each point enqueued into a replication with ordered delivery a per-series sequence
+// number, and tracks the highest sequence number of each series successfully sent to the remote.
+//
+// Sequence numbers are assigned while appending to the queue, so a series' points sit in the queue in sequence
+// order. The sender uses the sent sequence numbers to skip points it already delivered when a batch is retried,
+// and to detect gaps left by batches which never reached the remote (i.e. because they were quarantined).
+//
+// Each change is appended to a log on disk and synced, so sequences stay monotonic across restarts. The log is
+// compacted into a snapshot of the state every maxSequenceLogRecords records, dropping series whose points have
+// all been sent; their sequences start over the next time they're written.
+type seriesSequences struct {
+	path string
+
+	mu    sync.Mutex
+	state sequenceState
+	// records is the number of records in the log.
+	records int
+}
+
+// sequenceState is the state of a queue's sequences, and the format of each record in its log. A record only
+// holds the entries it changes.
+type sequenceState struct {
+	// Assigned is the last sequence number assigned to each series.
+	Assigned map[string]uint64 `json:"assigned,omitempty"`
+	// Sent is the last sequence number of each series successfully sent.
+	Sent map[string]uint64 `json:"sent,omitempty"`
+}
+
+func loadSeriesSequences(dir string) (*seriesSequences, error) {
+	s := &seriesSequences{
+		path: filepath.Join(dir, sequencesFile),
+		state: sequenceState{
+			Assigned: make(map[string]uint64),
+			Sent:     make(map[string]uint64),
+		},
+	}
+
+	torn, err := s.replay()
+	if err != nil {
+		return nil, err
+	}
+	if torn {
+		// The last append was cut short, so rewrite the log before appending to it again.
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// replay applies the records of the log to the state, reporting whether the last record is incomplete.
+func (s *seriesSequences) replay() (bool, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return len(line) > 0, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		var record sequenceState
+		if err := json.Unmarshal(line, &record); err != nil {
+			if _, perr := r.Peek(1); perr == io.EOF {
+				return true, nil
+			}
+			return false, err
+		}
+		for key, seq := range record.Assigned {
+			s.state.Assigned[key] = seq
+		}
+		for key, seq := range record.Sent {
+			s.state.Sent[key] = seq
+		}
+		s.records++
+	}
+}
+
+// log appends a record of changes already applied to the state to the log, and syncs it. Once the log holds
+// maxSequenceLogRecords records it's compacted instead. s.mu must be held.
+func (s *seriesSequences) log(record sequenceState) error {
+	if s.records >= maxSequenceLogRecords {
+		return s.compact()
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if s.records == 0 {
+		// Make sure the new log itself survives a crash.
+		if err := file.SyncDir(filepath.Dir(s.path)); err != nil {
+			return err
+		}
+	}
+	s.records++
+	return nil
+}
+
+// compact drops series whose points have all been sent, and replaces the log with a single record of the
+// state. s.mu must be held.
+func (s *seriesSequences) compact() error {
+	for key, seq := range s.state.Assigned {
+		if s.state.Sent[key] >= seq {
+			delete(s.state.Assigned, key)
+			delete(s.state.Sent, key)
+		}
+	}
+	for key := range s.state.Sent {
+		if _, ok := s.state.Assigned[key]; !ok {
+			delete(s.state.Sent, key)
+		}
+	}
+
+	b, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	// Close the file handle before renaming to support Windows.
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := file.RenameFile(tmp, s.path); err != nil {
+		return err
+	}
+	if err := file.SyncDir(filepath.Dir(s.path)); err != nil {
+		return err
+	}
+	s.records = 1
+	return nil
+}
+
+// appendSequenced assigns sequence numbers to the points of a block of compressed line protocol, and appends
+// it to the queue with enqueue. Both happen under the lock, so blocks are appended in sequence order.
+func (s *seriesSequences) appendSequenced(data []byte, enqueue func(seqs []uint64) error) error {
+	_, keys, err := splitLines(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seqs := make([]uint64, len(keys))
+	assigned := make(map[string]uint64, len(keys))
+	for i, key := range keys {
+		last, ok := assigned[key]
+		if !ok {
+			last = s.state.Assigned[key]
+		}
+		seqs[i] = last + 1
+		assigned[key] = seqs[i]
+	}
+
+	if err := enqueue(seqs); err != nil {
+		return err
+	}
+	for key, seq := range assigned {
+		s.state.Assigned[key] = seq
+	}
+	return s.log(sequenceState{Assigned: assigned})
+}
+
+// sequencedBatch is a block of data read from the queue, along with the sequence numbers of its points.
+type sequencedBatch struct {
+	lines [][]byte
+	keys  []string
+	seqs  []uint64
+}
+
+// unsent drops the points of a block which were already sent to the remote, returning the remaining data to
+// send (nil if there's none) and any gaps found, keyed by series. A gap is the number of points of a series
+// missing between the last point sent and the first point in the block.
+func (s *seriesSequences) unsent(data []byte, seqs []uint64) (*sequencedBatch, map[string]uint64, error) {
+	lines, keys, err := splitLines(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lines) != len(seqs) {
+		return nil, nil, errors.New("number of sequence numbers does not match number of points in batch")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := &sequencedBatch{}
+	var gaps map[string]uint64
+	next := make(map[string]uint64)
+	for i, key := range keys {
+		expected, ok := next[key]
+		if !ok {
+			expected = s.state.Sent[key] + 1
+		}
+		if seqs[i] < expected || seqs[i] > s.state.Assigned[key] {
+			// Already delivered by an earlier attempt, possibly before the series was dropped from the log.
+			continue
+		}
+		if seqs[i] > expected {
+			if gaps == nil {
+				gaps = make(map[string]uint64)
+			}
+			gaps[key] += seqs[i] - expected
+		}
+		next[key] = seqs[i] + 1
+
+		batch.lines = append(batch.lines, lines[i])
+		batch.keys = append(batch.keys, key)
+		batch.seqs = append(batch.seqs, seqs[i])
+	}
+	return batch, gaps, nil
+}
+
+// markSent records the points of a batch as delivered.
+func (s *seriesSequences) markSent(batch *sequencedBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent := make(map[string]uint64)
+	for i, key := range batch.keys {
+		// Points numbered past the series' last assigned sequence number were sent before the series was dropped
+		// from the log, and mustn't hold back the series' new points.
+		if batch.seqs[i] > s.state.Sent[key] && batch.seqs[i] <= s.state.Assigned[key] {
+			s.state.Sent[key] = batch.seqs[i]
+			sent[key] = batch.seqs[i]
+		}
+	}
+	if len(sent) == 0 {
+		return nil
+	}
+	return s.log(sequenceState{Sent: sent})
+}
+
+// compressed returns the batch's points as a block of line protocol compressed with the given codec.
+func (b *sequencedBatch) compressed(compression influxdb.ReplicationCompression) ([]byte, error) {
+	return compressLines(b.lines, compression)
+}
+
+// compressLines compresses lines of line protocol into a block of data with the given codec.
+func compressLines(lines [][]byte, compression influxdb.ReplicationCompression) ([]byte, error) {
+	var buf bytes.Buffer
+	cw, err := NewCompressor(compression, &buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if _, err := cw.Write(line); err != nil {
+			return nil, err
+		}
+		if _, err := cw.Write([]byte{'\n'}); err != nil {
+			return nil, err
+		}
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// splitLines decompresses a block of line protocol, returning its non-empty lines and the series key of each.
+func splitLines(data []byte) ([][]byte, []string, error) {
+	zr, err := Decompress(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zr.Close()
+
+	var lines [][]byte
+	var keys []string
+	r := bufio.NewReader(zr)
+	for {
+		line, err := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			points, perr := models.ParsePoints(trimmed)
+			if perr != nil {
+				return nil, nil, perr
+			}
+			lines = append(lines, trimmed)
+			keys = append(keys, string(points[0].Key()))
+		}
+		if err == io.EOF {
+			return lines, keys, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesSequences_Log(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := loadSeriesSequences(dir)
+	require.NoError(t, err)
+
+	appendLines := func(lines string) []uint64 {
+		var seqs []uint64
+		require.NoError(t, s.appendSequenced(gzipLines(t, lines), func(assigned []uint64) error {
+			seqs = assigned
+			return nil
+		}))
+		return seqs
+	}
+	send := func(lines string, seqs []uint64) {
+		batch, _, err := s.unsent(gzipLines(t, lines), seqs)
+		require.NoError(t, err)
+		require.NoError(t, s.markSent(batch))
+	}
+
+	seqs := appendLines("cpu,host=a value=1 1\ncpu,host=b value=1 1\n")
+	require.Equal(t, []uint64{1, 1}, seqs)
+	send("cpu,host=a value=1 1\ncpu,host=b value=1 1\n", seqs)
+	require.Equal(t, []uint64{2}, appendLines("cpu,host=a value=2 2\n"))
+
+	// Each change is a record appended to the log, which is replayed on load.
+	s, err = loadSeriesSequences(dir)
+	require.NoError(t, err)
+	require.Equal(t, 3, s.records)
+	require.Equal(t, map[string]uint64{"cpu,host=a": 2, "cpu,host=b": 1}, s.state.Assigned)
+	require.Equal(t, map[string]uint64{"cpu,host=a": 1, "cpu,host=b": 1}, s.state.Sent)
+
+	// A record cut short by a crash is dropped, and the log rewritten.
+	f, err := os.OpenFile(filepath.Join(dir, sequencesFile), os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"assigned":{"cpu,host=a":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	s, err = loadSeriesSequences(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, s.records)
+	require.Equal(t, map[string]uint64{"cpu,host=a": 2}, s.state.Assigned)
+
+	// Compaction drops series whose points have all been sent, so their sequences start over.
+	s.records = maxSequenceLogRecords
+	require.Equal(t, []uint64{3}, appendLines("cpu,host=a value=3 3\n"))
+	require.Equal(t, 1, s.records)
+	require.Equal(t, map[string]uint64{"cpu,host=a": 3}, s.state.Assigned)
+	require.Equal(t, []uint64{1}, appendLines("cpu,host=b value=2 2\n"))
+
+	s, err = loadSeriesSequences(dir)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{"cpu,host=a": 3, "cpu,host=b": 1}, s.state.Assigned)
+	require.Equal(t, map[string]uint64{"cpu,host=a": 1}, s.state.Sent)
+
+	// Points of a dropped series sent again after a restart don't hold back its new points.
+	send("cpu,host=b value=9 9\n", []uint64{5})
+	require.Equal(t, map[string]uint64{"cpu,host=a": 1}, s.state.Sent)
+}
@@ -2,22 +2,36 @@ package internal
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"net/url"
+	"io"
+	"net"
+	"net/http"
+	"os"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/influxdata/influx-cli/v2/api"
+	"github.com/golang/snappy"
 	"github.com/influxdata/influxdb/v2"
 	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
 )
 
+// validationTimeout bounds how long validating a replication waits for its remote, so a misconfigured remote
+// fails validation instead of hanging it.
+const validationTimeout = 10 * time.Second
+
 func NewValidator() *noopWriteValidator {
-	return &noopWriteValidator{}
+	return &noopWriteValidator{timeout: validationTimeout}
 }
 
 // noopWriteValidator checks if replication parameters are valid by attempting to write an empty payload
 // to the remote host using the configured information.
-type noopWriteValidator struct{}
+type noopWriteValidator struct {
+	timeout time.Duration
+}
 
 var userAgent = fmt.Sprintf(
 	"influxdb-oss/%s (%s) Sha/%s Date/%s",
@@ -26,33 +40,103 @@ var userAgent = fmt.Sprintf(
 	influxdb.GetBuildInfo().Commit,
 	influxdb.GetBuildInfo().Date)
 
+// ValidationError is returned when the remote of a replication can't be written to, explaining why in terms a
+// user setting up the replication can act on.
+type ValidationError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 func (s noopWriteValidator) ValidateReplication(ctx context.Context, config *ReplicationHTTPConfig) error {
-	u, err := url.Parse(config.RemoteURL)
+	u, err := config.remoteURL()
 	if err != nil {
 		return &ierrors.Error{
 			Code: ierrors.EInvalid,
-			Msg:  fmt.Sprintf("host URL %q is invalid", config.RemoteURL),
 			Err:  err,
 		}
 	}
-	params := api.ConfigParams{
-		Host:             u,
-		UserAgent:        userAgent,
-		Token:            &config.RemoteToken,
-		AllowInsecureTLS: config.AllowInsecureTLS,
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	// The write goes through the same transport as replicated data, so proxies and client certificates apply.
+	transport, err := newTransport(config.transportSettings())
+	if err != nil {
+		return &ValidationError{Reason: "remote TLS settings are invalid", Err: err}
 	}
-	client := api.NewAPIClient(api.NewAPIConfig(params)).WriteApi
+	defer transport.CloseIdleConnections()
 
-	noopReq := client.PostWrite(ctx).
-		Org(config.RemoteOrgID.String()).
-		Bucket(config.RemoteBucketID.String()).
-		Body([]byte{})
+	// An empty write checks the credentials and target without writing anything.
+	body := []byte{}
+	if config.isPrometheusRemoteWrite() {
+		body = snappy.Encode(nil, nil)
+	}
+	req, err := newWriteRequest(ctx, config, body)
+	if err != nil {
+		if errors.Is(err, ErrRemoteDatabaseMissing) {
+			return &ValidationError{Reason: "remote is InfluxDB 1.x, but the replication has no remote database", Err: err}
+		}
+		return err
+	}
+	res, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return &ValidationError{Reason: connectionFailureReason(u.Hostname(), s.timeout, err), Err: err}
+	}
+	defer res.Body.Close()
 
-	if err := noopReq.Execute(); err != nil {
-		return &ierrors.Error{
-			Code: ierrors.EInvalid,
-			Err:  err,
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBodyBytes))
+	if err != nil {
+		return &ValidationError{Reason: connectionFailureReason(u.Hostname(), s.timeout, err), Err: err}
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	writeErr := &RemoteWriteError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	reason := fmt.Sprintf("remote responded with status %d", res.StatusCode)
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		reason = "remote rejected the API token"
+	case http.StatusForbidden:
+		reason = "API token is not allowed to write to the remote bucket"
+	case http.StatusNotFound:
+		if isBucketNotFound(body) {
+			writeErr.Err = ErrRemoteBucketNotFound
+			reason = fmt.Sprintf("remote bucket %s not found in remote org %s", config.RemoteBucketID, config.RemoteOrgID)
+			if config.isV1() {
+				reason = fmt.Sprintf("remote database %q not found", *config.RemoteDatabase)
+			}
+		} else {
+			reason = "remote has no write API at the configured URL"
 		}
 	}
-	return nil
+	return &ValidationError{Reason: reason, Err: writeErr}
+}
+
+// connectionFailureReason explains why a request to the remote at host failed without a response.
+func connectionFailureReason(host string, timeout time.Duration, err error) string {
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("could not resolve remote host %q", host)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Sprintf("remote host %q refused the connection", host)
+	case os.IsTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return fmt.Sprintf("remote host %q did not respond within %s", host, timeout)
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalidCert), errors.As(err, &hostnameErr):
+		return fmt.Sprintf("TLS certificate of remote host %q could not be verified", host)
+	default:
+		return fmt.Sprintf("could not connect to remote host %q", host)
+	}
 }
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator_ValidateReplication(t *testing.T) {
+	t.Parallel()
+
+	// A listener which is closed straight away leaves a port nothing accepts connections on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	refusedURL := "http://" + l.Addr().String()
+	require.NoError(t, l.Close())
+
+	tests := []struct {
+		name       string
+		remoteURL  string
+		status     int
+		body       string
+		wantReason string
+		wantErr    error
+	}{
+		{
+			name:   "valid",
+			status: http.StatusNoContent,
+		},
+		{
+			name:       "unauthorized",
+			status:     http.StatusUnauthorized,
+			body:       `{"code":"unauthorized","message":"unauthorized access"}`,
+			wantReason: "remote rejected the API token",
+		},
+		{
+			name:       "bucket not found",
+			status:     http.StatusNotFound,
+			body:       `{"code":"not found","message":"bucket \"0000000000000014\" not found"}`,
+			wantReason: "remote bucket 0000000000000014 not found in remote org 000000000000000a",
+			wantErr:    ErrRemoteBucketNotFound,
+		},
+		{
+			name:       "no write API",
+			status:     http.StatusNotFound,
+			body:       "404 page not found",
+			wantReason: "remote has no write API at the configured URL",
+		},
+		{
+			name:       "connection refused",
+			remoteURL:  refusedURL,
+			wantReason: `remote host "127.0.0.1" refused the connection`,
+		},
+		{
+			name:       "unresolvable host",
+			remoteURL:  "http://remote.invalid",
+			wantReason: `could not resolve remote host "remote.invalid"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			remoteURL := tt.remoteURL
+			if remoteURL == "" {
+				server, _ := newTestRemote(t, tt.status, tt.body)
+				remoteURL = server.URL
+			}
+			err := NewValidator().ValidateReplication(context.Background(), &ReplicationHTTPConfig{
+				RemoteURL:      remoteURL,
+				RemoteToken:    "my-token",
+				RemoteOrgID:    platform.ID(10),
+				RemoteBucketID: platform.ID(20),
+			})
+			if tt.wantReason == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), err)
+			require.Equal(t, tt.wantReason, validationErr.Reason)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+			if tt.status != 0 {
+				var writeErr *RemoteWriteError
+				require.True(t, errors.As(err, &writeErr))
+				require.Equal(t, tt.status, writeErr.StatusCode)
+			}
+		})
+	}
+}
+
+func TestValidator_Timeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	v := noopWriteValidator{timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err := v.ValidateReplication(context.Background(), &ReplicationHTTPConfig{RemoteURL: server.URL})
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), err)
+	require.Contains(t, validationErr.Reason, "did not respond within 100ms")
+}
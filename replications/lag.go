@@ -0,0 +1,27 @@
+package replications
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// replicationLag returns how far behind now the newest point delivered to a remote is. Points timestamped
+// in the future, or clocks skewed ahead of the local one, count as no lag rather than a negative one.
+func replicationLag(newestDeliveredNS int64, now time.Time) time.Duration {
+	lag := now.Sub(time.Unix(0, newestDeliveredNS))
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+// setReplicationLag fills in the lag of a replication which has delivered a timestamped point.
+func setReplicationLag(r *influxdb.Replication, now time.Time) {
+	if r.NewestDeliveredPointNS == nil {
+		r.ReplicationLag = nil
+		return
+	}
+	lag := replicationLag(*r.NewestDeliveredPointNS, now)
+	r.ReplicationLag = &lag
+}
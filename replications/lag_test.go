@@ -0,0 +1,100 @@
+package replications
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestReplicationLag(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, time.October, 1, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, 90*time.Second, replicationLag(now.Add(-90*time.Second).UnixNano(), now))
+	require.Equal(t, time.Duration(0), replicationLag(now.UnixNano(), now))
+	// Points from the future don't make the remote ahead of real time.
+	require.Equal(t, time.Duration(0), replicationLag(now.Add(time.Hour).UnixNano(), now))
+
+	r := influxdb.Replication{}
+	setReplicationLag(&r, now)
+	require.Nil(t, r.ReplicationLag)
+
+	newest := now.Add(-time.Minute).UnixNano()
+	r.NewestDeliveredPointNS = &newest
+	setReplicationLag(&r, now)
+	require.Equal(t, time.Minute, *r.ReplicationLag)
+}
+
+func TestGetReplication_Lag(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).AnyTimes()
+
+	// No lag is reported until something has been delivered.
+	r, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Nil(t, r.ReplicationLag)
+
+	deliver := func(timestamps ...time.Time) {
+		var lp bytes.Buffer
+		for i, ts := range timestamps {
+			fmt.Fprintf(&lp, "cpu value=%d %d\n", i, ts.UnixNano())
+		}
+		var buf bytes.Buffer
+		require.NoError(t, serializePoints(mustParsePoints(t, lp.String()), influxdb.CompressionGzip, 0, func(b []byte, _ int) error {
+			_, err := buf.Write(b)
+			return err
+		}))
+		write := newStatsRecorder(svc.store, zaptest.NewLogger(t)).observe(func(platform.ID, []byte) error { return nil })
+		require.NoError(t, write(initID, buf.Bytes()))
+	}
+
+	// The lag is measured from the newest point delivered, even if older points are delivered after it.
+	newest := time.Now().Add(-time.Hour)
+	deliver(newest.Add(-time.Minute), newest)
+	deliver(newest.Add(-2 * time.Hour))
+
+	before := time.Now()
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.NotNil(t, r.ReplicationLag)
+	require.GreaterOrEqual(t, *r.ReplicationLag, before.Sub(newest))
+	require.Less(t, *r.ReplicationLag, time.Since(newest)+time.Second)
+
+	rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID})
+	require.NoError(t, err)
+	require.Len(t, rs.Replications, 1)
+	require.NotNil(t, rs.Replications[0].ReplicationLag)
+
+	// The lag metric is refreshed with every queue size sample.
+	m := metrics.NewReplicationsMetrics()
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(m.PrometheusCollectors()...)
+	svc.queueGrowth = newQueueGrowthTracker(svc.store, mocks.durableQueueManager, time.Second, time.Minute, m, zaptest.NewLogger(t))
+	svc.queueGrowth.now = func() time.Time { return newest.Add(5 * time.Minute) }
+	svc.queueGrowth.sample(ctx)
+
+	mfs := promtest.MustGather(t, reg)
+	gauge := promtest.MustFindMetric(t, mfs, "replications_queue_lag_seconds", map[string]string{"replicationID": initID.String()})
+	require.InDelta(t, (5 * time.Minute).Seconds(), gauge.Gauge.GetValue(), 1e-6)
+}
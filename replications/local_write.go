@@ -0,0 +1,207 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/sqlite"
+)
+
+func errLocalWriteDisabled(bucketID platform.ID) error {
+	return &ierrors.Error{
+		Code: ierrors.EUnavailable,
+		Msg:  fmt.Sprintf("local writes are disabled for bucket %q and it has no replications to receive the data", bucketID),
+	}
+}
+
+// LocalFailurePolicy controls what WritePoints returns when the write to local storage fails, but the points
+// were enqueued into replications configured to replicate through local failures.
+type LocalFailurePolicy string
+
+const (
+	// LocalFailurePartial returns a partial failure: an error with the code of the local write's error, and
+	// the op OpLocalWriteFailedReplicated so callers can tell the points still reached the replications.
+	// This is the default.
+	LocalFailurePartial LocalFailurePolicy = "partial"
+	// LocalFailureSucceed returns success, since the points will reach the remotes.
+	LocalFailureSucceed LocalFailurePolicy = "succeed"
+	// LocalFailureFail returns the local write's error as-is, as if nothing had been replicated.
+	LocalFailureFail LocalFailurePolicy = "fail"
+)
+
+// OpLocalWriteFailedReplicated is the op of errors returned under LocalFailurePartial.
+const OpLocalWriteFailedReplicated = "replications/localWriteFailedReplicated"
+
+// localWriteFailed decides what WritePoints returns for a failed local write whose points were nonetheless
+// enqueued into the given replications.
+func localWriteFailed(policy LocalFailurePolicy, cause error, ids []platform.ID) error {
+	switch policy {
+	case LocalFailureSucceed:
+		return nil
+	case LocalFailureFail:
+		return cause
+	default:
+		return errLocalWriteFailedReplicated(cause, ids)
+	}
+}
+
+// errLocalWriteFailedReplicated reports a failed local write whose points were nonetheless enqueued into the
+// given replications, which are configured to replicate through local failures.
+func errLocalWriteFailedReplicated(cause error, ids []platform.ID) error {
+	return &ierrors.Error{
+		Code: ierrors.ErrorCode(cause),
+		Msg:  fmt.Sprintf("failed to write points to local storage, but points were enqueued for %d replication(s) %v", len(ids), ids),
+		Op:   OpLocalWriteFailedReplicated,
+		Err:  cause,
+	}
+}
+
+// LocalWriteGap is a window of time during which points written to a bucket were
+// enqueued for replication but not persisted to local storage. A window which is
+// still open has a zero End.
+type LocalWriteGap struct {
+	BucketID platform.ID
+	Start    time.Time
+	End      time.Time
+}
+
+// localWriteGate tracks buckets for which local writes have been temporarily disabled,
+// and records the windows of time during which they were disabled so the gap can be
+// backfilled later. Both are persisted, so a bucket stays disabled, and its gaps stay
+// recorded, across restarts.
+type localWriteGate struct {
+	store *sqlite.SqlStore
+
+	mu       sync.RWMutex
+	disabled map[platform.ID]time.Time
+	gaps     map[platform.ID][]LocalWriteGap
+	now      func() time.Time
+}
+
+func newLocalWriteGate(store *sqlite.SqlStore) *localWriteGate {
+	return &localWriteGate{
+		store:    store,
+		disabled: make(map[platform.ID]time.Time),
+		gaps:     make(map[platform.ID][]LocalWriteGap),
+		now:      time.Now,
+	}
+}
+
+// restore loads the persisted gaps, re-disabling local writes for the buckets whose gap is still open, i.e.
+// when the service is opened.
+func (g *localWriteGate) restore(ctx context.Context) error {
+	q := sq.Select("bucket_id", "start_time", "end_time").
+		From("local_write_gaps").
+		OrderBy("start_time")
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var rows []struct {
+		BucketID platform.ID  `db:"bucket_id"`
+		Start    time.Time    `db:"start_time"`
+		End      sql.NullTime `db:"end_time"`
+	}
+	if err := g.store.DB.SelectContext(ctx, &rows, query, args...); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disabled = make(map[platform.ID]time.Time)
+	g.gaps = make(map[platform.ID][]LocalWriteGap)
+	for _, row := range rows {
+		if !row.End.Valid {
+			g.disabled[row.BucketID] = row.Start.UTC()
+			continue
+		}
+		g.gaps[row.BucketID] = append(g.gaps[row.BucketID], LocalWriteGap{BucketID: row.BucketID, Start: row.Start.UTC(), End: row.End.Time.UTC()})
+	}
+	return nil
+}
+
+func (g *localWriteGate) enabled(bucketID platform.ID) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	_, disabled := g.disabled[bucketID]
+	return !disabled
+}
+
+func (g *localWriteGate) set(ctx context.Context, bucketID platform.ID, enabled bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	since, disabled := g.disabled[bucketID]
+	switch {
+	case enabled && disabled:
+		end := g.now()
+		q := sq.Update("local_write_gaps").
+			Set("end_time", end).
+			Where(sq.Eq{"bucket_id": bucketID, "end_time": nil})
+		if err := g.exec(ctx, q); err != nil {
+			return err
+		}
+		delete(g.disabled, bucketID)
+		g.gaps[bucketID] = append(g.gaps[bucketID], LocalWriteGap{BucketID: bucketID, Start: since, End: end})
+	case !enabled && !disabled:
+		start := g.now()
+		q := sq.Insert("local_write_gaps").
+			SetMap(sq.Eq{"bucket_id": bucketID, "start_time": start})
+		if err := g.exec(ctx, q); err != nil {
+			return err
+		}
+		g.disabled[bucketID] = start
+	}
+	return nil
+}
+
+// gapsFor returns all recorded gaps for the bucket, including the currently-open one (if any).
+func (g *localWriteGate) gapsFor(bucketID platform.ID) []LocalWriteGap {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	gaps := make([]LocalWriteGap, 0, len(g.gaps[bucketID])+1)
+	gaps = append(gaps, g.gaps[bucketID]...)
+	if since, disabled := g.disabled[bucketID]; disabled {
+		gaps = append(gaps, LocalWriteGap{BucketID: bucketID, Start: since})
+	}
+	return gaps
+}
+
+// clearGaps forgets all closed gaps recorded for the bucket, i.e. once they have been backfilled.
+func (g *localWriteGate) clearGaps(ctx context.Context, bucketID platform.ID) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	q := sq.Delete("local_write_gaps").
+		Where(sq.Eq{"bucket_id": bucketID}).
+		Where(sq.NotEq{"end_time": nil})
+	if err := g.exec(ctx, q); err != nil {
+		return err
+	}
+	delete(g.gaps, bucketID)
+	return nil
+}
+
+func (g *localWriteGate) exec(ctx context.Context, q sq.Sqlizer) error {
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+
+	g.store.Mu.Lock()
+	defer g.store.Mu.Unlock()
+
+	_, err = g.store.DB.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,219 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReplicationsMetrics holds metrics related to replication streams.
+type ReplicationsMetrics struct {
+	BatchesQuarantined *prometheus.CounterVec
+	QueueLatency       *prometheus.HistogramVec
+	// RemoteWriteLatency is the time taken by each write of queued data to the remote, whether it succeeded or not.
+	RemoteWriteLatency *prometheus.HistogramVec
+	// EnqueuePausedLowDisk is 1 while enqueueing into all replications is paused because disk space is low.
+	EnqueuePausedLowDisk prometheus.Gauge
+	QueueGrowthRate      *prometheus.GaugeVec
+	EnqueueTimeouts      *prometheus.CounterVec
+	// SenderWorkersActive and SenderQueuesWaiting track the shared pool of workers sending queued data to remotes.
+	SenderWorkersActive prometheus.Gauge
+	SenderQueuesWaiting prometheus.Gauge
+	ReplicationLag      *prometheus.GaugeVec
+	// QueueOpenFiles is the number of files held open by all replication queues.
+	QueueOpenFiles prometheus.Gauge
+	// DroppedPoints counts points discarded instead of being replicated, by the reason they were dropped.
+	DroppedPoints *prometheus.CounterVec
+	// QueueDiskUsage is the total size on disk of the replication queues of each org.
+	QueueDiskUsage *prometheus.GaugeVec
+	// QueueSizeBytes is the size on disk of each replication queue, updated as data is enqueued and sent.
+	QueueSizeBytes *prometheus.GaugeVec
+	// ErrorRate is the fraction of sends to each replication's remote over the recent window which failed.
+	ErrorRate *prometheus.GaugeVec
+	// QueueUnwritable is 1 while enqueues into a replication fail because its queue directory can't be written to.
+	QueueUnwritable *prometheus.GaugeVec
+	// EnqueueRate and SendRate are the points per second enqueued into and sent from each replication queue over
+	// the recent window. An enqueue rate persistently above the send rate means the queue will fill up.
+	EnqueueRate *prometheus.GaugeVec
+	SendRate    *prometheus.GaugeVec
+	// DeadLetteredPoints counts points rejected by the remote which were written to the replication's
+	// dead-letter bucket instead of being dropped.
+	DeadLetteredPoints *prometheus.CounterVec
+	// EgressQuotaPausedOrgs is the number of orgs whose replications are paused because they exceeded their
+	// egress quota for the current period.
+	EgressQuotaPausedOrgs prometheus.Gauge
+}
+
+// Reasons points are dropped, used to label DroppedPoints.
+const (
+	// DropReasonNonRetryable points were rejected by the remote, and the replication drops non-retryable data.
+	DropReasonNonRetryable = "non_retryable"
+	// DropReasonQueueFull points couldn't be enqueued into a best-effort replication because its queue was full.
+	DropReasonQueueFull = "queue_full"
+	// DropReasonEnqueueFailed points couldn't be enqueued into a best-effort replication for any other reason.
+	DropReasonEnqueueFailed = "enqueue_failed"
+	// DropReasonQueueUnwritable points couldn't be enqueued into a best-effort replication because its queue
+	// directory can't be written to.
+	DropReasonQueueUnwritable = "queue_unwritable"
+	// DropReasonNoFields points had no fields, so couldn't be written as valid line protocol.
+	DropReasonNoFields = "no_fields"
+	// DropReasonRemoteBucketDeleted points were dropped because the remote bucket was deleted, and the
+	// replication's remote bucket deleted policy is to drop data.
+	DropReasonRemoteBucketDeleted = "remote_bucket_deleted"
+	// DropReasonTimestampOutOfRange points were shifted out of the range of valid timestamps by the replication's
+	// timestamp offset.
+	DropReasonTimestampOutOfRange = "timestamp_out_of_range"
+	// DropReasonNonNumeric fields had no numeric value, so couldn't be sent to a Prometheus remote-write remote.
+	DropReasonNonNumeric = "non_numeric"
+)
+
+func NewReplicationsMetrics() *ReplicationsMetrics {
+	const (
+		namespace = "replications"
+		subsystem = "queue"
+	)
+
+	return &ReplicationsMetrics{
+		BatchesQuarantined: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "batches_quarantined_total",
+			Help:      "Count of queued batches which failed verification and were quarantined instead of being sent",
+		}, []string{"replicationID"}),
+		QueueLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "latency_seconds",
+			Help:      "Time from a batch being enqueued to it being successfully sent to the remote",
+			// 10ms up to ~11.6h, since data can stay queued for a long time while a remote is down.
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 12),
+		}, []string{"replicationID"}),
+		RemoteWriteLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "remote_write_duration_seconds",
+			Help:      "Time taken by each write of queued data to the remote, successful or not",
+			// 5ms up to ~41s, since some remotes are slow to respond.
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+		}, []string{"replicationID"}),
+		EnqueuePausedLowDisk: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "enqueue_paused_low_disk",
+			Help:      "Whether enqueueing into all replication queues is paused because free disk space is below the threshold",
+		}),
+		QueueGrowthRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "growth_rate_bytes_per_second",
+			Help:      "Rate at which the replication queue grew over the recent window, negative while it's draining",
+		}, []string{"replicationID"}),
+		EnqueueTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "enqueue_timeouts_total",
+			Help:      "Count of enqueues into the replication queue abandoned by writes because they took longer than the enqueue timeout",
+		}, []string{"replicationID"}),
+		SenderWorkersActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "sender_workers_active",
+			Help:      "Number of sender pool workers currently sending data from a replication queue to its remote",
+		}),
+		SenderQueuesWaiting: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "sender_queues_waiting",
+			Help:      "Number of replication queues with data to send waiting for a sender pool worker",
+		}),
+		ReplicationLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "lag_seconds",
+			Help:      "Time elapsed since the timestamp of the newest point delivered to the remote",
+		}, []string{"replicationID"}),
+		QueueOpenFiles: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "open_files",
+			Help:      "Number of segment files held open by all replication queues",
+		}),
+		DroppedPoints: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "dropped_points_total",
+			Help:      "Count of points discarded instead of being replicated to the remote",
+		}, []string{"replicationID", "reason"}),
+		QueueDiskUsage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "disk_usage_bytes",
+			Help:      "Total size on disk of the replication queues of an org",
+		}, []string{"orgID"}),
+		QueueSizeBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "size_bytes",
+			Help:      "Size on disk of the replication queue",
+		}, []string{"replicationID"}),
+		ErrorRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "error_rate",
+			Help:      "Fraction of the sends to the remote over the recent window which failed",
+		}, []string{"replicationID"}),
+		QueueUnwritable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "unwritable",
+			Help:      "Whether enqueues into the replication queue are failing because its directory can't be written to",
+		}, []string{"replicationID"}),
+		EnqueueRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "enqueue_rate_points_per_second",
+			Help:      "Rate at which points were enqueued into the replication queue over the recent window",
+		}, []string{"replicationID"}),
+		SendRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "send_rate_points_per_second",
+			Help:      "Rate at which points were sent from the replication queue to the remote over the recent window",
+		}, []string{"replicationID"}),
+		DeadLetteredPoints: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "dead_lettered_points_total",
+			Help:      "Count of points rejected by the remote which were written to the dead-letter bucket instead of being dropped",
+		}, []string{"replicationID"}),
+		EgressQuotaPausedOrgs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "egress_quota_paused_orgs",
+			Help:      "Number of orgs whose replications are paused because they exceeded their egress quota for the current period",
+		}),
+	}
+}
+
+// PrometheusCollectors satisfies the prom.PrometheusCollector interface.
+func (rm *ReplicationsMetrics) PrometheusCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		rm.BatchesQuarantined,
+		rm.QueueLatency,
+		rm.RemoteWriteLatency,
+		rm.EnqueuePausedLowDisk,
+		rm.QueueGrowthRate,
+		rm.EnqueueTimeouts,
+		rm.SenderWorkersActive,
+		rm.SenderQueuesWaiting,
+		rm.ReplicationLag,
+		rm.QueueOpenFiles,
+		rm.DroppedPoints,
+		rm.QueueDiskUsage,
+		rm.QueueSizeBytes,
+		rm.ErrorRate,
+		rm.QueueUnwritable,
+		rm.EnqueueRate,
+		rm.SendRate,
+		rm.DeadLetteredPoints,
+		rm.EgressQuotaPausedOrgs,
+	}
+}
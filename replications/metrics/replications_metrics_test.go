@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationsMetrics_PrometheusCollectors(t *testing.T) {
+	t.Parallel()
+
+	rm := NewReplicationsMetrics()
+	collectors := rm.PrometheusCollectors()
+
+	// Every metric must be exposed, otherwise it's silently never scraped.
+	v := reflect.ValueOf(rm).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i).Interface()
+		require.Contains(t, collectors, field, "%s is not returned by PrometheusCollectors", v.Type().Field(i).Name)
+	}
+
+	reg := prometheus.NewRegistry()
+	require.NotPanics(t, func() { reg.MustRegister(collectors...) })
+
+	descs := make(chan *prometheus.Desc, 64)
+	go func() {
+		for _, c := range collectors {
+			c.Describe(descs)
+		}
+		close(descs)
+	}()
+	for desc := range descs {
+		require.True(t, strings.Contains(desc.String(), `fqName: "replications_queue_`), desc.String())
+	}
+}
@@ -5,10 +5,13 @@
 package mock
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	platform "github.com/influxdata/influxdb/v2/kit/platform"
+	internal "github.com/influxdata/influxdb/v2/replications/internal"
 )
 
 // MockDurableQueueManager is a mock of DurableQueueManager interface.
@@ -78,17 +81,46 @@ func (mr *MockDurableQueueManagerMockRecorder) DeleteQueue(arg0 interface{}) *go
 }
 
 // EnqueueData mocks base method.
-func (m *MockDurableQueueManager) EnqueueData(arg0 platform.ID, arg1 []byte) error {
+func (m *MockDurableQueueManager) EnqueueData(arg0 platform.ID, arg1 []byte, arg2 int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "EnqueueData", arg0, arg1)
+	ret := m.ctrl.Call(m, "EnqueueData", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // EnqueueData indicates an expected call of EnqueueData.
-func (mr *MockDurableQueueManagerMockRecorder) EnqueueData(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockDurableQueueManagerMockRecorder) EnqueueData(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueData", reflect.TypeOf((*MockDurableQueueManager)(nil).EnqueueData), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueData", reflect.TypeOf((*MockDurableQueueManager)(nil).EnqueueData), arg0, arg1, arg2)
+}
+
+// EnqueueDataSync mocks base method.
+func (m *MockDurableQueueManager) EnqueueDataSync(arg0 platform.ID, arg1 []byte, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnqueueDataSync", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnqueueDataSync indicates an expected call of EnqueueDataSync.
+func (mr *MockDurableQueueManagerMockRecorder) EnqueueDataSync(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueDataSync", reflect.TypeOf((*MockDurableQueueManager)(nil).EnqueueDataSync), arg0, arg1, arg2)
+}
+
+// Flush mocks base method.
+func (m *MockDurableQueueManager) Flush(arg0 context.Context, arg1 platform.ID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockDurableQueueManagerMockRecorder) Flush(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockDurableQueueManager)(nil).Flush), arg0, arg1)
 }
 
 // InitializeQueue mocks base method.
@@ -105,6 +137,162 @@ func (mr *MockDurableQueueManagerMockRecorder) InitializeQueue(arg0, arg1 interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitializeQueue", reflect.TypeOf((*MockDurableQueueManager)(nil).InitializeQueue), arg0, arg1)
 }
 
+// PauseQueue mocks base method.
+func (m *MockDurableQueueManager) PauseQueue(arg0 platform.ID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseQueue", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PauseQueue indicates an expected call of PauseQueue.
+func (mr *MockDurableQueueManagerMockRecorder) PauseQueue(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseQueue", reflect.TypeOf((*MockDurableQueueManager)(nil).PauseQueue), arg0)
+}
+
+// PauseQueueFor mocks base method.
+func (m *MockDurableQueueManager) PauseQueueFor(arg0 platform.ID, arg1 internal.PauseReason) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseQueueFor", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PauseQueueFor indicates an expected call of PauseQueueFor.
+func (mr *MockDurableQueueManagerMockRecorder) PauseQueueFor(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseQueueFor", reflect.TypeOf((*MockDurableQueueManager)(nil).PauseQueueFor), arg0, arg1)
+}
+
+// PauseQueueUntil mocks base method.
+func (m *MockDurableQueueManager) PauseQueueUntil(arg0 platform.ID, arg1 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseQueueUntil", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PauseQueueUntil indicates an expected call of PauseQueueUntil.
+func (mr *MockDurableQueueManagerMockRecorder) PauseQueueUntil(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseQueueUntil", reflect.TypeOf((*MockDurableQueueManager)(nil).PauseQueueUntil), arg0, arg1)
+}
+
+// PeekQueue mocks base method.
+func (m *MockDurableQueueManager) PeekQueue(arg0 platform.ID, arg1 int) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PeekQueue", arg0, arg1)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PeekQueue indicates an expected call of PeekQueue.
+func (mr *MockDurableQueueManagerMockRecorder) PeekQueue(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeekQueue", reflect.TypeOf((*MockDurableQueueManager)(nil).PeekQueue), arg0, arg1)
+}
+
+// QueueStats mocks base method.
+func (m *MockDurableQueueManager) QueueStats(arg0 platform.ID) (internal.QueueStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueStats", arg0)
+	ret0, _ := ret[0].(internal.QueueStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueueStats indicates an expected call of QueueStats.
+func (mr *MockDurableQueueManagerMockRecorder) QueueStats(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueStats", reflect.TypeOf((*MockDurableQueueManager)(nil).QueueStats), arg0)
+}
+
+// ResetRetryBackoff mocks base method.
+func (m *MockDurableQueueManager) ResetRetryBackoff(arg0 platform.ID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetRetryBackoff", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetRetryBackoff indicates an expected call of ResetRetryBackoff.
+func (mr *MockDurableQueueManagerMockRecorder) ResetRetryBackoff(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetRetryBackoff", reflect.TypeOf((*MockDurableQueueManager)(nil).ResetRetryBackoff), arg0)
+}
+
+// ResumeQueue mocks base method.
+func (m *MockDurableQueueManager) ResumeQueue(arg0 platform.ID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResumeQueue", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResumeQueue indicates an expected call of ResumeQueue.
+func (mr *MockDurableQueueManagerMockRecorder) ResumeQueue(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeQueue", reflect.TypeOf((*MockDurableQueueManager)(nil).ResumeQueue), arg0)
+}
+
+// ResumeQueueFor mocks base method.
+func (m *MockDurableQueueManager) ResumeQueueFor(arg0 platform.ID, arg1 internal.PauseReason) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResumeQueueFor", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResumeQueueFor indicates an expected call of ResumeQueueFor.
+func (mr *MockDurableQueueManagerMockRecorder) ResumeQueueFor(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeQueueFor", reflect.TypeOf((*MockDurableQueueManager)(nil).ResumeQueueFor), arg0, arg1)
+}
+
+// SetFlushInterval mocks base method.
+func (m *MockDurableQueueManager) SetFlushInterval(arg0 platform.ID, arg1 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFlushInterval", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFlushInterval indicates an expected call of SetFlushInterval.
+func (mr *MockDurableQueueManagerMockRecorder) SetFlushInterval(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFlushInterval", reflect.TypeOf((*MockDurableQueueManager)(nil).SetFlushInterval), arg0, arg1)
+}
+
+// SetOrderedDelivery mocks base method.
+func (m *MockDurableQueueManager) SetOrderedDelivery(arg0 platform.ID, arg1 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetOrderedDelivery", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetOrderedDelivery indicates an expected call of SetOrderedDelivery.
+func (mr *MockDurableQueueManagerMockRecorder) SetOrderedDelivery(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOrderedDelivery", reflect.TypeOf((*MockDurableQueueManager)(nil).SetOrderedDelivery), arg0, arg1)
+}
+
+// SetRetryBackoff mocks base method.
+func (m *MockDurableQueueManager) SetRetryBackoff(arg0 platform.ID, arg1, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRetryBackoff", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRetryBackoff indicates an expected call of SetRetryBackoff.
+func (mr *MockDurableQueueManagerMockRecorder) SetRetryBackoff(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRetryBackoff", reflect.TypeOf((*MockDurableQueueManager)(nil).SetRetryBackoff), arg0, arg1, arg2)
+}
+
 // StartReplicationQueues mocks base method.
 func (m *MockDurableQueueManager) StartReplicationQueues(arg0 map[platform.ID]int64) error {
 	m.ctrl.T.Helper()
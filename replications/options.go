@@ -0,0 +1,308 @@
+package replications
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb/v2/remotes/tokencrypt"
+)
+
+// Option configures optional behavior of the replications service.
+type Option func(*config)
+
+type config struct {
+	sendDedupWindow     time.Duration
+	sendDedupMaxEntries int
+	verifyBatches       bool
+
+	retryMinBackoff time.Duration
+	retryMaxBackoff time.Duration
+
+	maxSerializationBufferBytes int
+	serializationWorkers        int
+
+	maxInFlightBytesPerRemote       int64
+	maxInFlightPointsPerReplication int64
+	remoteBucketAutoCreate          bool
+
+	httpConfigCacheSize *int
+	httpConfigCacheTTL  time.Duration
+
+	minFreeDiskBytes     uint64
+	diskWatchdogInterval time.Duration
+
+	queueGrowthInterval time.Duration
+	queueGrowthWindow   time.Duration
+	errorRateWindow     time.Duration
+
+	staleStatusThreshold time.Duration
+
+	capabilityProbeInterval time.Duration
+
+	enqueueTimeout     time.Duration
+	enqueueConcurrency int
+	localFailurePolicy LocalFailurePolicy
+
+	rejectFieldlessPoints bool
+
+	coalesceWindow    time.Duration
+	coalesceMaxPoints int
+
+	queueSegmentSize  int64
+	senderWorkers     int
+	maxQueueOpenFiles int
+	maxQueueSizeLimit int64
+
+	webhookURL      string
+	webhookDebounce time.Duration
+
+	backfillReader        PointsReader
+	backfillChunkDuration time.Duration
+
+	tokens *tokencrypt.Cipher
+}
+
+// WithSendDedup enables sender-side suppression of exact resends of a block of data within the given window,
+// for remotes which don't support idempotent writes. Each replication remembers at most maxEntries blocks.
+func WithSendDedup(window time.Duration, maxEntries int) Option {
+	return func(c *config) {
+		c.sendDedupWindow = window
+		c.sendDedupMaxEntries = maxEntries
+	}
+}
+
+// WithBatchVerification enables checking that every queued batch decompresses cleanly and holds valid line
+// protocol before it's sent. Corrupt batches are quarantined on disk instead of being sent to the remote.
+func WithBatchVerification() Option {
+	return func(c *config) {
+		c.verifyBatches = true
+	}
+}
+
+// WithRetryQueues moves batches which fail to send into a separate retry queue per replication, so newer data
+// keeps flowing to the remote instead of waiting behind them. Retries start after minBackoff, and back off
+// exponentially up to maxBackoff while they keep failing. Replications with ordered delivery always retry failed
+// batches in place.
+func WithRetryQueues(minBackoff, maxBackoff time.Duration) Option {
+	return func(c *config) {
+		c.retryMinBackoff = minBackoff
+		c.retryMaxBackoff = maxBackoff
+	}
+}
+
+// WithMaxSerializationBufferBytes caps the amount of line protocol WritePoints serializes into a single block
+// before flushing it into the replication queues. Large writes are split into multiple blocks at line boundaries,
+// bounding peak memory use regardless of the size of the write. Zero (the default) means no limit.
+func WithMaxSerializationBufferBytes(n int) Option {
+	return func(c *config) {
+		c.maxSerializationBufferBytes = n
+	}
+}
+
+// WithSerializationWorkers allows WritePoints to shard the serialization of large writes across up to n goroutines.
+// Point order is preserved in the resulting block. The worker pool is only used when the serialization buffer
+// is uncapped, since sharding requires holding the serialized output of all workers in memory at once.
+func WithSerializationWorkers(n int) Option {
+	return func(c *config) {
+		c.serializationWorkers = n
+	}
+}
+
+// WithMaxInFlightBytesPerRemote caps the total size of the batches being sent to each remote at once, across all
+// of the remote's replications. Once the cap is hit, the remote's replications stop reading new batches from their
+// queues until outstanding sends complete. Zero (the default) means no limit.
+func WithMaxInFlightBytesPerRemote(n int64) Option {
+	return func(c *config) {
+		c.maxInFlightBytesPerRemote = n
+	}
+}
+
+// WithMaxInFlightPointsPerReplication caps the number of points each replication has sent to its remote without
+// them being acknowledged yet. A replication only has one write in flight at a time, so this caps the points in
+// each write: replications with a flush interval stop combining queued batches into a write once the cap is hit.
+// Batches with more points than the cap are sent on their own. Zero (the default) means no limit.
+func WithMaxInFlightPointsPerReplication(n int64) Option {
+	return func(c *config) {
+		c.maxInFlightPointsPerReplication = n
+	}
+}
+
+// WithRemoteBucketAutoCreate allows replications with the "recreate" remote bucket deleted policy to create a
+// new bucket on their remote when the remote bucket is found to be missing.
+func WithRemoteBucketAutoCreate() Option {
+	return func(c *config) {
+		c.remoteBucketAutoCreate = true
+	}
+}
+
+// WithHTTPConfigCache sets the number of resolved remote HTTP configs cached in memory, and how long each is
+// cached for. A size of zero disables the cache. By default up to 1024 configs are cached for a minute.
+func WithHTTPConfigCache(size int, ttl time.Duration) Option {
+	return func(c *config) {
+		c.httpConfigCacheSize = &size
+		c.httpConfigCacheTTL = ttl
+	}
+}
+
+// WithLowDiskWatchdog pauses enqueueing into all replications while the free space on the disk holding the
+// replication queues is below minFreeBytes, checking it at the given interval (10s if zero). Writes to
+// replications with the guaranteed durability tier fail while enqueueing is paused.
+func WithLowDiskWatchdog(minFreeBytes uint64, interval time.Duration) Option {
+	return func(c *config) {
+		c.minFreeDiskBytes = minFreeBytes
+		c.diskWatchdogInterval = interval
+	}
+}
+
+// WithQueueGrowthTracking sets how often the size of each replication queue is sampled to track its growth rate,
+// and the window the rate is computed over. Defaults to sampling every 10s over a 5m window.
+func WithQueueGrowthTracking(interval, window time.Duration) Option {
+	return func(c *config) {
+		c.queueGrowthInterval = interval
+		c.queueGrowthWindow = window
+	}
+}
+
+// WithErrorRateWindow sets the rolling window the error rate of each replication's sends to its remote is
+// computed over. Defaults to 5m.
+func WithErrorRateWindow(d time.Duration) Option {
+	return func(c *config) {
+		c.errorRateWindow = d
+	}
+}
+
+// WithStaleStatusThreshold reports the status of replications which haven't recorded a response from their remote
+// within d as unknown, instead of the old response. Idle replications don't send, so without a threshold their
+// status can reflect a response from long ago. Validating a replication refreshes its status. Zero (the default)
+// means statuses never go stale.
+func WithStaleStatusThreshold(d time.Duration) Option {
+	return func(c *config) {
+		c.staleStatusThreshold = d
+	}
+}
+
+// WithCapabilityProbeInterval sets how often the remote of each replication is re-probed to detect its
+// capabilities, such as its version and the compression codecs it accepts. Replications are also probed when they
+// are validated. Defaults to an hour.
+func WithCapabilityProbeInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.capabilityProbeInterval = d
+	}
+}
+
+// WithEnqueueTimeout bounds how long a write waits to enqueue its points into each replication's queue. Enqueues
+// taking longer are abandoned, so one slow queue can't hold up acknowledging the write. Abandoned enqueues are
+// dropped for best-effort replications, and fail the write for guaranteed ones. Zero (the default) means no limit.
+func WithEnqueueTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.enqueueTimeout = d
+	}
+}
+
+// WithEnqueueConcurrency caps the number of replications of a bucket a write enqueues its points into at once.
+// Defaults to 16. Replications waiting on their turn in ordered delivery, or for room in a full queue, hold up the
+// others past the cap.
+func WithEnqueueConcurrency(n int) Option {
+	return func(c *config) {
+		c.enqueueConcurrency = n
+	}
+}
+
+// WithLocalFailurePolicy controls what WritePoints returns when the write to local storage fails, but the points
+// were enqueued into replications with enqueueOnLocalFailure set. Defaults to LocalFailurePartial.
+func WithLocalFailurePolicy(p LocalFailurePolicy) Option {
+	return func(c *config) {
+		c.localFailurePolicy = p
+	}
+}
+
+// WithRejectFieldlessPoints fails writes to buckets with replications if they contain points without fields,
+// instead of the default of replicating the write without those points. Field-less points can't be written as
+// valid line protocol, so the remote would reject any batch holding them.
+func WithRejectFieldlessPoints() Option {
+	return func(c *config) {
+		c.rejectFieldlessPoints = true
+	}
+}
+
+// WithEnqueueCoalescing merges small writes to the same bucket arriving within the given window into a single
+// block before enqueueing them, cutting per-block overhead in the queues and on the remote for workloads made of
+// many tiny concurrent writes. Each coalesced write waits up to the window for its block to be enqueued, adding
+// that much latency to it. Blocks are enqueued early once they hold maxPoints points (5000 if zero), and larger
+// writes aren't coalesced. Writes into replications preserving write boundaries, enqueueing in order, or
+// enqueueing through local failures are never coalesced.
+func WithEnqueueCoalescing(window time.Duration, maxPoints int) Option {
+	return func(c *config) {
+		c.coalesceWindow = window
+		c.coalesceMaxPoints = maxPoints
+	}
+}
+
+// WithMaxQueueOpenFiles sets a budget for the number of files held open by all replication queues. Queues with
+// nothing to send have their files closed while the budget is exceeded, and reopened when data is next enqueued.
+// Zero (the default) means no limit.
+func WithMaxQueueOpenFiles(n int) Option {
+	return func(c *config) {
+		c.maxQueueOpenFiles = n
+	}
+}
+
+// WithQueueSegmentSize sets the size of the segment files backing each replication queue. Space is reclaimed a
+// segment at a time once all of its data has been sent, so smaller segments suit many low-volume replications,
+// while larger ones reduce file churn for high-throughput replications. Must be between 64 KiB and just under
+// 16 MiB, half the smallest allowed max queue size; invalid sizes fall back to the default of 10 MiB.
+func WithQueueSegmentSize(n int64) Option {
+	return func(c *config) {
+		c.queueSegmentSize = n
+	}
+}
+
+// WithMaxQueueSizeLimit caps the max queue size replications can be created or updated with, so one replication
+// can't be given more of the disk than the operator intends. Zero (the default) means no limit.
+func WithMaxQueueSizeLimit(n int64) Option {
+	return func(c *config) {
+		c.maxQueueSizeLimit = n
+	}
+}
+
+// WithSenderWorkers sets the number of workers shared by all replications to send queued data to their remotes.
+// Replications with data to send wait their turn for a worker, so the number of goroutines sending data stays
+// bounded however many replications there are. Defaults to four per CPU.
+func WithSenderWorkers(n int) Option {
+	return func(c *config) {
+		c.senderWorkers = n
+	}
+}
+
+// WithFailureWebhook sets a URL the service POSTs a JSON notification to whenever a replication starts failing
+// to write to its remote, and when it recovers. A replication must stay failing or recovered for the debounce
+// period (30s if zero) before it's reported, so flapping replications don't flood the webhook.
+func WithFailureWebhook(url string, debounce time.Duration) Option {
+	return func(c *config) {
+		c.webhookURL = url
+		c.webhookDebounce = debounce
+	}
+}
+
+// WithBackfillReader sets the reader used to load historical points from local storage when backfilling
+// a replication. Backfills are unsupported without one.
+func WithBackfillReader(r PointsReader) Option {
+	return func(c *config) {
+		c.backfillReader = r
+	}
+}
+
+// WithBackfillChunkDuration sets the width of the time windows a backfill reads and enqueues at once.
+// Defaults to DefaultBackfillChunkDuration.
+func WithBackfillChunkDuration(d time.Duration) Option {
+	return func(c *config) {
+		c.backfillChunkDuration = d
+	}
+}
+
+// WithTokenCipher sets the cipher the API tokens of remotes were stored with, which must match the one given to
+// the remotes service. Without one, tokens are expected in plaintext.
+func WithTokenCipher(tokens *tokencrypt.Cipher) Option {
+	return func(c *config) {
+		c.tokens = tokens
+	}
+}
@@ -0,0 +1,91 @@
+package replications
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+)
+
+// defaultBreakdownSampleBytes is the amount of queued data sampled when QueueBreakdownByMeasurement isn't
+// given a sample size.
+const defaultBreakdownSampleBytes = 1 << 20
+
+// QueueBreakdownByMeasurement counts the points of each measurement in the oldest data in a replication's queue,
+// to help find the measurements dominating a backlog. About sampleBytes of compressed data are read from the head
+// of the queue, without removing it.
+func (s service) QueueBreakdownByMeasurement(ctx context.Context, id platform.ID, sampleBytes int) (*influxdb.ReplicationQueueBreakdown, error) {
+	q := sq.Select("id").From("replications").Where(sq.Eq{"id": id})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var found platform.ID
+	if err := s.store.DB.GetContext(ctx, &found, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errReplicationNotFound
+		}
+		return nil, err
+	}
+
+	if sampleBytes <= 0 {
+		sampleBytes = defaultBreakdownSampleBytes
+	}
+	blocks, err := s.durableQueueManager.PeekQueue(id, sampleBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown := &influxdb.ReplicationQueueBreakdown{
+		ReplicationID: id,
+		Measurements:  make(map[string]int64),
+	}
+	for _, b := range blocks {
+		if err := countMeasurements(b, breakdown.Measurements); err != nil {
+			return nil, err
+		}
+		breakdown.SampledBytes += int64(len(b))
+	}
+	for _, n := range breakdown.Measurements {
+		breakdown.SampledPoints += n
+	}
+	return breakdown, nil
+}
+
+// countMeasurements decompresses a block of line protocol, adding the number of points of each
+// measurement in it to counts.
+func countMeasurements(data []byte, counts map[string]int64) error {
+	zr, err := internal.Decompress(data)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	r := bufio.NewReader(zr)
+	for {
+		line, err := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			points, perr := models.ParsePoints(trimmed)
+			if perr != nil {
+				return perr
+			}
+			for _, p := range points {
+				counts[string(p.Name())]++
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package replications
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueBreakdownByMeasurement(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	_, err := svc.QueueBreakdownByMeasurement(ctx, initID, 0)
+	require.Equal(t, errReplicationNotFound, err)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err = svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	// The queue holds 3 cpu points for every mem point, spread over several blocks.
+	var lp bytes.Buffer
+	for i := 0; i < 400; i++ {
+		measurement := "cpu"
+		if i%4 == 3 {
+			measurement = "mem"
+		}
+		fmt.Fprintf(&lp, "%s,host=h%d value=%d %d\n", measurement, i%7, i, 1633089600000000000+int64(i))
+	}
+	var blocks [][]byte
+	require.NoError(t, serializePoints(mustParsePoints(t, lp.String()), influxdb.CompressionGzip, 1024, func(b []byte, _ int) error {
+		blocks = append(blocks, append([]byte{}, b...))
+		return nil
+	}))
+	require.Greater(t, len(blocks), 2)
+
+	// Only the sampled head of the queue is counted.
+	sample := blocks[:2]
+	mocks.durableQueueManager.EXPECT().PeekQueue(initID, 4096).Return(sample, nil)
+	breakdown, err := svc.QueueBreakdownByMeasurement(ctx, initID, 4096)
+	require.NoError(t, err)
+	require.Equal(t, initID, breakdown.ReplicationID)
+	require.Equal(t, int64(len(sample[0])+len(sample[1])), breakdown.SampledBytes)
+	require.Equal(t, breakdown.Measurements["cpu"]+breakdown.Measurements["mem"], breakdown.SampledPoints)
+	require.Less(t, breakdown.SampledPoints, int64(400))
+	require.InDelta(t, 0.75, float64(breakdown.Measurements["cpu"])/float64(breakdown.SampledPoints), 0.05)
+
+	// Without a sample size, the default amount of data is sampled.
+	mocks.durableQueueManager.EXPECT().PeekQueue(initID, defaultBreakdownSampleBytes).Return(blocks, nil)
+	breakdown, err = svc.QueueBreakdownByMeasurement(ctx, initID, 0)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"cpu": 300, "mem": 100}, breakdown.Measurements)
+	require.Equal(t, int64(400), breakdown.SampledPoints)
+
+	// An empty queue has nothing to break down.
+	mocks.durableQueueManager.EXPECT().PeekQueue(initID, defaultBreakdownSampleBytes).Return(nil, nil)
+	breakdown, err = svc.QueueBreakdownByMeasurement(ctx, initID, 0)
+	require.NoError(t, err)
+	require.Empty(t, breakdown.Measurements)
+	require.Zero(t, breakdown.SampledPoints)
+}
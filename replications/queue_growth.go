@@ -0,0 +1,206 @@
+package replications
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/influxdata/influxdb/v2/sqlite"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueGrowthInterval = 10 * time.Second
+	defaultQueueGrowthWindow   = 5 * time.Minute
+)
+
+// queueGrowthTracker periodically samples the size of every replication queue, and derives each queue's growth
+// rate over a rolling window from the samples. The rate is used to project when a queue will hit its max size.
+// Each sample also refreshes the replication lag, queue disk usage and queue rate metrics.
+type queueGrowthTracker struct {
+	store    *sqlite.SqlStore
+	queues   DurableQueueManager
+	interval time.Duration
+	window   time.Duration
+	now      func() time.Time
+	metrics  *metrics.ReplicationsMetrics
+	log      *zap.Logger
+
+	mu      sync.Mutex
+	samples map[platform.ID][]queueSizeSample
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type queueSizeSample struct {
+	at    time.Time
+	bytes int64
+}
+
+func newQueueGrowthTracker(store *sqlite.SqlStore, queues DurableQueueManager, interval, window time.Duration, metrics *metrics.ReplicationsMetrics, log *zap.Logger) *queueGrowthTracker {
+	if interval <= 0 {
+		interval = defaultQueueGrowthInterval
+	}
+	if window <= 0 {
+		window = defaultQueueGrowthWindow
+	}
+	return &queueGrowthTracker{
+		store:    store,
+		queues:   queues,
+		interval: interval,
+		window:   window,
+		now:      time.Now,
+		metrics:  metrics,
+		log:      log,
+		samples:  make(map[platform.ID][]queueSizeSample),
+	}
+}
+
+// start samples the queue sizes immediately, then periodically until stop is called.
+func (t *queueGrowthTracker) start() {
+	t.sample(context.Background())
+
+	t.done = make(chan struct{})
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+				t.sample(context.Background())
+			}
+		}
+	}()
+}
+
+func (t *queueGrowthTracker) stop() {
+	if t.done == nil {
+		return
+	}
+	close(t.done)
+	t.wg.Wait()
+	t.done = nil
+}
+
+// sample records the current size of every replication queue, and forgets replications which were deleted.
+// The lag of each replication is published alongside, so it keeps growing between deliveries.
+func (t *queueGrowthTracker) sample(ctx context.Context) {
+	query, args, err := sq.Select("id", "org_id", "newest_delivered_point_ns").From("replications").ToSql()
+	if err != nil {
+		t.log.Warn("Failed to sample replication queue sizes", zap.Error(err))
+		return
+	}
+	var rs []influxdb.Replication
+	if err := t.store.DB.SelectContext(ctx, &rs, query, args...); err != nil {
+		t.log.Warn("Failed to sample replication queue sizes", zap.Error(err))
+		return
+	}
+	ids := make([]platform.ID, len(rs))
+	for i, r := range rs {
+		ids[i] = r.ID
+	}
+
+	sizes, err := t.queues.CurrentQueueSizes(ids)
+	if err != nil {
+		t.log.Warn("Failed to sample replication queue sizes", zap.Error(err))
+		return
+	}
+
+	now := t.now()
+	for id, size := range sizes {
+		t.record(id, now, size)
+		// Refresh the enqueue and send rate metrics, which are otherwise only published when a replication's
+		// queue is used, so they fall to zero once it goes idle.
+		if _, err := t.queues.QueueStats(id); err != nil {
+			t.log.Warn("Failed to refresh replication queue rates", zap.Error(err), zap.String("id", id.String()))
+		}
+	}
+	recordQueueDiskUsage(t.metrics, queueDiskUsage(rs, sizes))
+	for _, r := range rs {
+		if r.NewestDeliveredPointNS != nil {
+			t.metrics.ReplicationLag.WithLabelValues(r.ID.String()).Set(replicationLag(*r.NewestDeliveredPointNS, now).Seconds())
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.samples {
+		if _, ok := sizes[id]; !ok {
+			delete(t.samples, id)
+			t.metrics.QueueGrowthRate.DeleteLabelValues(id.String())
+			t.metrics.ReplicationLag.DeleteLabelValues(id.String())
+		}
+	}
+}
+
+// record adds a sample of a queue's size, dropping samples which have fallen out of the window.
+func (t *queueGrowthTracker) record(id platform.ID, at time.Time, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples := append(t.samples[id], queueSizeSample{at: at, bytes: bytes})
+	cutoff := at.Add(-t.window)
+	for len(samples) > 0 && samples[0].at.Before(cutoff) {
+		samples = samples[1:]
+	}
+	t.samples[id] = samples
+
+	if rate, ok := growthRate(samples); ok {
+		t.metrics.QueueGrowthRate.WithLabelValues(id.String()).Set(rate)
+	}
+}
+
+// rate returns the growth rate of a queue in bytes per second over the window, or false if there aren't
+// enough samples to tell. A nil tracker never knows the rate.
+func (t *queueGrowthTracker) rate(id platform.ID) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return growthRate(t.samples[id])
+}
+
+func growthRate(samples []queueSizeSample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return float64(last.bytes-first.bytes) / elapsed, true
+}
+
+// timeToFull projects how long a queue growing at rate bytes per second takes to grow from size to max.
+// It returns nil if the queue isn't growing.
+func timeToFull(size, max int64, rate float64) *time.Duration {
+	if rate <= 0 {
+		return nil
+	}
+	var d time.Duration
+	if remaining := max - size; remaining > 0 {
+		d = time.Duration(float64(remaining) / rate * float64(time.Second))
+	}
+	return &d
+}
+
+// setQueueSaturation fills in how much room is left in the queue of a replication whose current size is set.
+func setQueueSaturation(r *influxdb.Replication) {
+	r.RemainingQueueBytes = r.MaxQueueSizeBytes - r.CurrentQueueSizeBytes
+	if r.RemainingQueueBytes < 0 {
+		r.RemainingQueueBytes = 0
+	}
+	r.QueueFull = r.RemainingQueueBytes == 0
+}
@@ -0,0 +1,135 @@
+package replications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestEstimateTimeToFull(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	_, err := svc.EstimateTimeToFull(ctx, initID)
+	require.Equal(t, errReplicationNotFound, err)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err = svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	m := metrics.NewReplicationsMetrics()
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(m.PrometheusCollectors()...)
+
+	now := time.Date(2021, time.October, 1, 0, 0, 0, 0, time.UTC)
+	svc.queueGrowth = newQueueGrowthTracker(svc.store, mocks.durableQueueManager, time.Second, time.Minute, m, zaptest.NewLogger(t))
+	svc.queueGrowth.now = func() time.Time { return now }
+
+	sample := func(size int64) {
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: size}, nil)
+		svc.queueGrowth.sample(ctx)
+	}
+	estimate := func(size int64) *influxdb.ReplicationTimeToFull {
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: size}, nil)
+		est, err := svc.EstimateTimeToFull(ctx, initID)
+		require.NoError(t, err)
+		return est
+	}
+
+	// A single sample isn't enough to tell the rate.
+	sample(1000)
+	est := estimate(1000)
+	require.False(t, est.Growing)
+	require.Nil(t, est.TimeToFull)
+	require.Equal(t, createReq.MaxQueueSizeBytes, est.MaxQueueSizeBytes)
+
+	// Grow by 100 bytes/s.
+	for i := 1; i <= 10; i++ {
+		now = now.Add(time.Second)
+		sample(1000 + int64(i)*100)
+	}
+	est = estimate(2000)
+	require.True(t, est.Growing)
+	require.Equal(t, float64(100), est.GrowthRateBytesPerSecond)
+	require.InDelta(t, float64(createReq.MaxQueueSizeBytes-2000)/100, est.TimeToFull.Seconds(), 0.001)
+
+	mfs := promtest.MustGather(t, reg)
+	gauge := promtest.MustFindMetric(t, mfs, "replications_queue_growth_rate_bytes_per_second", map[string]string{"replicationID": initID.String()})
+	require.Equal(t, float64(100), gauge.Gauge.GetValue())
+
+	// Once the growth falls out of the window and the queue drains, it's no longer growing.
+	now = now.Add(2 * time.Minute)
+	sample(2000)
+	now = now.Add(time.Second)
+	sample(1500)
+	est = estimate(1500)
+	require.False(t, est.Growing)
+	require.Nil(t, est.TimeToFull)
+	require.Equal(t, float64(-500), est.GrowthRateBytesPerSecond)
+}
+
+func TestTimeToFull(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, timeToFull(100, 1000, 0))
+	require.Nil(t, timeToFull(100, 1000, -10))
+	require.Equal(t, 90*time.Second, *timeToFull(100, 1000, 10))
+	// Queues at or over their max size are already full.
+	require.Equal(t, time.Duration(0), *timeToFull(1000, 1000, 10))
+}
+
+func TestGetReplication_QueueSaturation(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	created, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	require.Equal(t, createReq.MaxQueueSizeBytes, created.RemainingQueueBytes)
+	require.False(t, created.QueueFull)
+
+	for _, tt := range []struct {
+		size      int64
+		remaining int64
+		full      bool
+	}{
+		{size: 1000, remaining: createReq.MaxQueueSizeBytes - 1000},
+		{size: createReq.MaxQueueSizeBytes, remaining: 0, full: true},
+		// Queues can briefly exceed their max size after it's lowered.
+		{size: createReq.MaxQueueSizeBytes + 1000, remaining: 0, full: true},
+	} {
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).
+			Return(map[platform.ID]int64{initID: tt.size}, nil).Times(2)
+
+		r, err := svc.GetReplication(ctx, initID)
+		require.NoError(t, err)
+		require.Equal(t, tt.remaining, r.RemainingQueueBytes)
+		require.Equal(t, tt.full, r.QueueFull)
+
+		rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID})
+		require.NoError(t, err)
+		require.Len(t, rs.Replications, 1)
+		require.Equal(t, tt.remaining, rs.Replications[0].RemainingQueueBytes)
+		require.Equal(t, tt.full, rs.Replications[0].QueueFull)
+	}
+}
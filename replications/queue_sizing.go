@@ -0,0 +1,224 @@
+package replications
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+)
+
+const (
+	// queueSizingWindow is how far back enqueue rates and remote outages are considered when recommending
+	// a queue size.
+	queueSizingWindow = 7 * 24 * time.Hour
+	// queueSizingBucket is the granularity enqueued bytes are tracked at.
+	queueSizingBucket = time.Hour
+	// queueSizingHeadroom is the factor the size needed to buffer through the longest outage is scaled by,
+	// to allow for outages or bursts of writes somewhat worse than those seen so far.
+	queueSizingHeadroom = 1.5
+)
+
+// queueSizingTracker keeps the recent history needed to recommend a queue size for each replication: how fast
+// data is enqueued into it, and how long its remote was unreachable. The history is kept in memory, so it
+// starts over when the server restarts.
+type queueSizingTracker struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	enqueues map[platform.ID]*enqueueHistory
+	outages  map[platform.ID]*outageHistory
+}
+
+// enqueueHistory counts the bytes enqueued into a replication in fixed-size time buckets.
+type enqueueHistory struct {
+	since   time.Time
+	buckets []enqueueBucket
+}
+
+type enqueueBucket struct {
+	start time.Time
+	bytes int64
+}
+
+// outageHistory tracks the remote outages of a replication. An outage starts with a write failing because
+// the remote couldn't be reached or was unavailable, and ends with the next successful write.
+type outageHistory struct {
+	failingSince *time.Time
+	past         []outage
+}
+
+type outage struct {
+	start, end time.Time
+}
+
+func newQueueSizingTracker() *queueSizingTracker {
+	return &queueSizingTracker{
+		window:   queueSizingWindow,
+		now:      time.Now,
+		enqueues: make(map[platform.ID]*enqueueHistory),
+		outages:  make(map[platform.ID]*outageHistory),
+	}
+}
+
+// observe wraps a durable queue write function, tracking the outages of each replication's remote.
+func (t *queueSizingTracker) observe(write func(platform.ID, []byte) error) func(platform.ID, []byte) error {
+	return func(replicationID platform.ID, data []byte) error {
+		err := write(replicationID, data)
+		t.recordWrite(replicationID, t.now(), err)
+		return err
+	}
+}
+
+// enqueued counts bytes enqueued into a replication now. A nil tracker records nothing.
+func (t *queueSizingTracker) enqueued(id platform.ID, bytes int) {
+	if t == nil {
+		return
+	}
+	t.recordEnqueue(id, t.now(), bytes)
+}
+
+// recordEnqueue counts bytes enqueued into a replication at the given time.
+func (t *queueSizingTracker) recordEnqueue(id platform.ID, at time.Time, bytes int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.enqueues[id]
+	if !ok {
+		h = &enqueueHistory{since: at}
+		t.enqueues[id] = h
+	}
+	start := at.Truncate(queueSizingBucket)
+	if n := len(h.buckets); n > 0 && h.buckets[n-1].start.Equal(start) {
+		h.buckets[n-1].bytes += int64(bytes)
+	} else {
+		h.buckets = append(h.buckets, enqueueBucket{start: start, bytes: int64(bytes)})
+	}
+
+	cutoff := at.Add(-t.window)
+	for len(h.buckets) > 0 && h.buckets[0].start.Add(queueSizingBucket).Before(cutoff) {
+		h.buckets = h.buckets[1:]
+	}
+}
+
+// recordWrite tracks the outcome of a write to a replication's remote at the given time. Writes rejected by
+// the remote for reasons other than its availability neither start nor end an outage.
+func (t *queueSizingTracker) recordWrite(id platform.ID, at time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.outages[id]
+	if !ok {
+		h = &outageHistory{}
+		t.outages[id] = h
+	}
+	switch {
+	case err == nil:
+		if h.failingSince != nil {
+			h.past = append(h.past, outage{start: *h.failingSince, end: at})
+			h.failingSince = nil
+		}
+	case isOutage(err):
+		if h.failingSince == nil {
+			h.failingSince = &at
+		}
+	}
+
+	cutoff := at.Add(-t.window)
+	for len(h.past) > 0 && h.past[0].end.Before(cutoff) {
+		h.past = h.past[1:]
+	}
+}
+
+// isOutage returns whether a failed write indicates the remote was unreachable or unavailable.
+func isOutage(err error) bool {
+	code := responseCode(err)
+	return code == nil || *code >= http.StatusInternalServerError || *code == http.StatusTooManyRequests
+}
+
+// forget drops the history of a deleted replication.
+func (t *queueSizingTracker) forget(id platform.ID) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.enqueues, id)
+	delete(t.outages, id)
+}
+
+// enqueueRate returns the average rate data was enqueued into a replication over the window, in bytes per second.
+func (t *queueSizingTracker) enqueueRate(id platform.ID, now time.Time) float64 {
+	h, ok := t.enqueues[id]
+	if !ok {
+		return 0
+	}
+	since := h.since
+	if cutoff := now.Add(-t.window); since.Before(cutoff) {
+		since = cutoff
+	}
+	elapsed := now.Sub(since).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	var bytes int64
+	for _, b := range h.buckets {
+		bytes += b.bytes
+	}
+	return float64(bytes) / elapsed
+}
+
+// longestOutage returns the duration of the longest outage of a replication's remote within the window,
+// including an ongoing one.
+func (t *queueSizingTracker) longestOutage(id platform.ID, now time.Time) time.Duration {
+	h, ok := t.outages[id]
+	if !ok {
+		return 0
+	}
+	var longest time.Duration
+	cutoff := now.Add(-t.window)
+	for _, o := range h.past {
+		if o.end.Before(cutoff) {
+			continue
+		}
+		if d := o.end.Sub(o.start); d > longest {
+			longest = d
+		}
+	}
+	if h.failingSince != nil {
+		if d := now.Sub(*h.failingSince); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// recommend suggests a max queue size for a replication, large enough to have buffered everything enqueued
+// during the longest recent outage at the recent enqueue rate, with headroom. The recommendation is never
+// below the minimum allowed queue size. A nil tracker has no history to recommend from.
+func (t *queueSizingTracker) recommend(id platform.ID, currentMax int64) *influxdb.ReplicationQueueSizeRecommendation {
+	rec := &influxdb.ReplicationQueueSizeRecommendation{
+		ReplicationID:     id,
+		MaxQueueSizeBytes: currentMax,
+		Headroom:          queueSizingHeadroom,
+	}
+	if t != nil {
+		now := t.now()
+		t.mu.Lock()
+		rec.EnqueueRateBytesPerSecond = t.enqueueRate(id, now)
+		rec.LongestOutage = t.longestOutage(id, now)
+		t.mu.Unlock()
+	}
+
+	needed := rec.EnqueueRateBytesPerSecond * rec.LongestOutage.Seconds() * queueSizingHeadroom
+	rec.RecommendedMaxQueueSizeBytes = influxdb.MinReplicationMaxQueueSizeBytes
+	if needed > float64(rec.RecommendedMaxQueueSizeBytes) {
+		rec.RecommendedMaxQueueSizeBytes = int64(math.Ceil(needed))
+	}
+	return rec
+}
@@ -0,0 +1,126 @@
+package replications
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecommendQueueSize(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	_, err := svc.RecommendQueueSize(ctx, initID)
+	require.Equal(t, errReplicationNotFound, err)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err = svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	// Without any history, the minimum queue size is recommended.
+	rec, err := svc.RecommendQueueSize(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, createReq.MaxQueueSizeBytes, rec.MaxQueueSizeBytes)
+	require.Equal(t, influxdb.MinReplicationMaxQueueSizeBytes, rec.RecommendedMaxQueueSizeBytes)
+
+	start := time.Date(2021, time.October, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	svc.queueSizing = newQueueSizingTracker()
+	svc.queueSizing.now = func() time.Time { return now }
+
+	// Enqueue 10 KiB/s for a day, during which the remote is down for two hours.
+	for i := 0; i < 24*60; i++ {
+		now = start.Add(time.Duration(i) * time.Minute)
+		svc.queueSizing.enqueued(initID, 10*1024*60)
+	}
+	svc.queueSizing.recordWrite(initID, start.Add(3*time.Hour), errors.New("connection refused"))
+	svc.queueSizing.recordWrite(initID, start.Add(4*time.Hour), &internal.RemoteWriteError{StatusCode: http.StatusServiceUnavailable})
+	svc.queueSizing.recordWrite(initID, start.Add(5*time.Hour), nil)
+	now = start.Add(24 * time.Hour)
+
+	rec, err = svc.RecommendQueueSize(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, rec.LongestOutage)
+	require.InDelta(t, 10*1024, rec.EnqueueRateBytesPerSecond, 10)
+	require.InDelta(t, 10*1024*7200*queueSizingHeadroom, float64(rec.RecommendedMaxQueueSizeBytes), 10*1024*7200*0.01)
+}
+
+func TestQueueSizingTracker(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	// history builds a tracker which saw data enqueued at rate bytes per second for a day, with an outage of
+	// the given duration in the middle of it.
+	history := func(rate int, outage time.Duration) *queueSizingTracker {
+		tr := newQueueSizingTracker()
+		for i := 0; i < 24*60; i++ {
+			tr.recordEnqueue(initID, start.Add(time.Duration(i)*time.Minute), rate*60)
+		}
+		tr.recordWrite(initID, start.Add(time.Hour), nil)
+		tr.recordWrite(initID, start.Add(2*time.Hour), errors.New("connection refused"))
+		tr.recordWrite(initID, start.Add(2*time.Hour).Add(outage), nil)
+		tr.now = func() time.Time { return start.Add(24 * time.Hour) }
+		return tr
+	}
+	recommend := func(rate int, outage time.Duration) int64 {
+		return history(rate, outage).recommend(initID, createReq.MaxQueueSizeBytes).RecommendedMaxQueueSizeBytes
+	}
+
+	t.Run("scales with outage duration", func(t *testing.T) {
+		oneHour := recommend(100*1024, time.Hour)
+		twoHours := recommend(100*1024, 2*time.Hour)
+		require.Greater(t, oneHour, influxdb.MinReplicationMaxQueueSizeBytes)
+		require.InDelta(t, 2*float64(oneHour), float64(twoHours), float64(oneHour)*0.01)
+	})
+
+	t.Run("scales with enqueue rate", func(t *testing.T) {
+		slow := recommend(100*1024, time.Hour)
+		fast := recommend(300*1024, time.Hour)
+		require.InDelta(t, 3*float64(slow), float64(fast), float64(slow)*0.01)
+	})
+
+	t.Run("never below the minimum", func(t *testing.T) {
+		require.Equal(t, influxdb.MinReplicationMaxQueueSizeBytes, recommend(1, time.Minute))
+	})
+
+	t.Run("ongoing outage", func(t *testing.T) {
+		tr := newQueueSizingTracker()
+		tr.recordWrite(initID, start, errors.New("connection refused"))
+		tr.recordWrite(initID, start.Add(time.Hour), errors.New("connection refused"))
+		require.Equal(t, 3*time.Hour, tr.longestOutage(initID, start.Add(3*time.Hour)))
+	})
+
+	t.Run("rejected writes aren't outages", func(t *testing.T) {
+		tr := newQueueSizingTracker()
+		tr.recordWrite(initID, start, &internal.RemoteWriteError{StatusCode: http.StatusBadRequest})
+		require.Equal(t, time.Duration(0), tr.longestOutage(initID, start.Add(time.Hour)))
+	})
+
+	t.Run("old history is forgotten", func(t *testing.T) {
+		tr := history(100*1024, 10*time.Hour)
+		later := start.Add(24 * time.Hour).Add(queueSizingWindow)
+		tr.recordWrite(initID, later, nil)
+		require.Equal(t, time.Duration(0), tr.longestOutage(initID, later))
+	})
+
+	t.Run("forget", func(t *testing.T) {
+		tr := history(100*1024, time.Hour)
+		tr.forget(initID)
+		rec := tr.recommend(initID, createReq.MaxQueueSizeBytes)
+		require.Zero(t, rec.EnqueueRateBytesPerSecond)
+		require.Zero(t, rec.LongestOutage)
+	})
+}
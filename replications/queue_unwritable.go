@@ -0,0 +1,56 @@
+package replications
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+)
+
+// unwritableQueues tracks the replications whose latest enqueue failed because their queue directory can't be
+// written to, to report them as such until an enqueue succeeds again.
+type unwritableQueues struct {
+	mu  sync.Mutex
+	ids map[platform.ID]struct{}
+}
+
+func newUnwritableQueues() *unwritableQueues {
+	return &unwritableQueues{ids: make(map[platform.ID]struct{})}
+}
+
+// record updates whether a replication's queue is writable from the outcome of enqueueing into it. Failures
+// unrelated to the queue's directory, like the queue being full, leave it as it was. It's a no-op on a nil tracker.
+func (u *unwritableQueues) record(id platform.ID, err error) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch {
+	case err == nil:
+		delete(u.ids, id)
+	case errors.Is(err, internal.ErrQueueUnwritable):
+		u.ids[id] = struct{}{}
+	}
+}
+
+func (u *unwritableQueues) forget(id platform.ID) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.ids, id)
+}
+
+// setQueueUnwritable fills in whether the queue of a replication is unwritable.
+func (u *unwritableQueues) setQueueUnwritable(r *influxdb.Replication) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	_, r.QueueUnwritable = u.ids[r.ID]
+}
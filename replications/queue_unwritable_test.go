@@ -0,0 +1,68 @@
+package replications
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestWritePoints_QueueUnwritable(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.unwritable = newUnwritableQueues()
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).AnyTimes()
+
+	points := mustParsePoints(t, `cpu,host=A value=1.2 2000000000`)
+	write := func(enqueueErr error) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(enqueueErr)
+		// Points which can't be enqueued into a best-effort replication are dropped, and the write says so.
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnprocessableEntity, ierrors.ErrorCode(err))
+	}
+	queueUnwritable := func() bool {
+		r, err := svc.GetReplication(ctx, initID)
+		require.NoError(t, err)
+		return r.QueueUnwritable
+	}
+
+	require.False(t, queueUnwritable())
+	write(&internal.QueueUnwritableError{Dir: "/queues/" + initID.String(), Err: &os.PathError{Op: "open", Path: "/queues", Err: syscall.EROFS}})
+	require.True(t, queueUnwritable())
+
+	// Points dropped for an unwritable queue are told apart from ones dropped for a full queue.
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(svc.metrics.PrometheusCollectors()...)
+	m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_dropped_points_total",
+		map[string]string{"replicationID": initID.String(), "reason": metrics.DropReasonQueueUnwritable})
+	require.Equal(t, float64(1), m.Counter.GetValue())
+
+	// Unrelated failures don't say whether the queue is writable.
+	write(durablequeue.ErrQueueFull)
+	require.True(t, queueUnwritable())
+
+	write(nil)
+	require.False(t, queueUnwritable())
+}
@@ -0,0 +1,227 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+	"github.com/influxdata/influxdb/v2/sqlite"
+	"go.uber.org/zap"
+)
+
+// remoteBucketCreator creates a bucket with the given name in the remote org of a replication.
+type remoteBucketCreator func(ctx context.Context, conf *internal.ReplicationHTTPConfig, name string) (platform.ID, error)
+
+// remoteBucketGuard applies each replication's remote bucket deleted policy when its remote reports that
+// the remote bucket doesn't exist, and records the condition in the replication's status.
+type remoteBucketGuard struct {
+	store   *sqlite.SqlStore
+	queues  DurableQueueManager
+	buckets BucketService
+	configs internal.HTTPConfigFunc
+	log     *zap.Logger
+
+	// create is nil unless remote bucket auto-creation is enabled.
+	create remoteBucketCreator
+	// invalidate, if set, is called when the remote bucket of a replication changes.
+	invalidate func(replicationID platform.ID)
+	// metrics, if set, counts the points dropped because of a missing remote bucket.
+	metrics *metrics.ReplicationsMetrics
+
+	mu      sync.Mutex
+	missing map[platform.ID]bool // replication ID -> whether its queue was paused
+}
+
+func newRemoteBucketGuard(store *sqlite.SqlStore, buckets BucketService, configs internal.HTTPConfigFunc, create remoteBucketCreator, log *zap.Logger) *remoteBucketGuard {
+	return &remoteBucketGuard{
+		store:   store,
+		buckets: buckets,
+		configs: configs,
+		create:  create,
+		log:     log,
+		missing: make(map[platform.ID]bool),
+	}
+}
+
+// guard wraps a durable queue write function, handling writes failing because the remote bucket is gone.
+func (g *remoteBucketGuard) guard(write func(platform.ID, []byte) error) func(platform.ID, []byte) error {
+	return func(replicationID platform.ID, data []byte) error {
+		ctx := context.Background()
+
+		writeErr := write(replicationID, data)
+		if writeErr == nil {
+			g.clear(ctx, replicationID)
+			return nil
+		}
+		if !errors.Is(writeErr, internal.ErrRemoteBucketNotFound) {
+			return writeErr
+		}
+
+		var target struct {
+			LocalBucketID platform.ID                        `db:"local_bucket_id"`
+			Policy        influxdb.RemoteBucketDeletedPolicy `db:"remote_bucket_deleted_policy"`
+		}
+		q := sq.Select("local_bucket_id", "remote_bucket_deleted_policy").From("replications").Where(sq.Eq{"id": replicationID})
+		query, args, err := q.ToSql()
+		if err != nil {
+			return err
+		}
+		if err := g.store.DB.GetContext(ctx, &target, query, args...); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errReplicationNotFound
+			}
+			return err
+		}
+
+		if err := g.setMissing(ctx, replicationID, true); err != nil {
+			g.log.Warn("Failed to record missing remote bucket", zap.String("id", replicationID.String()), zap.Error(err))
+		}
+
+		switch target.Policy {
+		case influxdb.RemoteBucketDeletedDrop:
+			g.log.Warn("Remote bucket of replication not found, dropping data",
+				zap.String("id", replicationID.String()), zap.Int("bytes", len(data)))
+			g.countDropped(replicationID, data)
+			g.mu.Lock()
+			g.missing[replicationID] = false
+			g.mu.Unlock()
+			return nil
+		case influxdb.RemoteBucketDeletedRecreate:
+			if g.create == nil {
+				g.log.Warn("Remote bucket auto-creation is disabled, pausing replication instead of recreating its remote bucket",
+					zap.String("id", replicationID.String()))
+				break
+			}
+			if err := g.recreate(ctx, replicationID, target.LocalBucketID); err != nil {
+				g.log.Error("Failed to recreate remote bucket of replication, pausing it", zap.String("id", replicationID.String()), zap.Error(err))
+				break
+			}
+			if writeErr = write(replicationID, data); writeErr == nil {
+				g.clear(ctx, replicationID)
+				return nil
+			}
+			if !errors.Is(writeErr, internal.ErrRemoteBucketNotFound) {
+				return writeErr
+			}
+		}
+
+		g.log.Error("Remote bucket of replication not found, pausing replication until it's updated",
+			zap.String("id", replicationID.String()), zap.Error(writeErr))
+		if err := g.queues.PauseQueueFor(replicationID, internal.PauseReasonBucketMissing); err != nil {
+			g.log.Error("Failed to pause replication", zap.String("id", replicationID.String()), zap.Error(err))
+		}
+		g.mu.Lock()
+		g.missing[replicationID] = true
+		g.mu.Unlock()
+		return writeErr
+	}
+}
+
+// recreate creates a bucket on the remote named after the replication's local bucket, and points the
+// replication at it.
+func (g *remoteBucketGuard) recreate(ctx context.Context, replicationID, localBucketID platform.ID) error {
+	bucket, err := g.buckets.FindBucketByID(ctx, localBucketID)
+	if err != nil {
+		return errLocalBucketNotFound(localBucketID, err)
+	}
+	conf, err := g.configs(ctx, replicationID)
+	if err != nil {
+		return err
+	}
+	remoteBucketID, err := g.create(ctx, conf, bucket.Name)
+	if err != nil {
+		return err
+	}
+
+	g.store.Mu.Lock()
+	defer g.store.Mu.Unlock()
+
+	query, args, err := sq.Update("replications").
+		SetMap(sq.Eq{"remote_bucket_id": remoteBucketID, "updated_at": sq.Expr("datetime('now')")}).
+		Where(sq.Eq{"id": replicationID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := g.store.DB.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	if g.invalidate != nil {
+		g.invalidate(replicationID)
+	}
+
+	g.log.Info("Recreated remote bucket of replication", zap.String("id", replicationID.String()),
+		zap.String("name", bucket.Name), zap.String("remote_bucket_id", remoteBucketID.String()))
+	return nil
+}
+
+// resume restarts a replication which was paused because its remote bucket was missing. It's called
+// whenever the replication is updated, since the update may have fixed the problem.
+func (g *remoteBucketGuard) resume(replicationID platform.ID) {
+	g.mu.Lock()
+	paused := g.missing[replicationID]
+	if paused {
+		g.missing[replicationID] = false
+	}
+	g.mu.Unlock()
+
+	if !paused {
+		return
+	}
+	if err := g.queues.ResumeQueueFor(replicationID, internal.PauseReasonBucketMissing); err != nil {
+		g.log.Error("Failed to resume replication", zap.String("id", replicationID.String()), zap.Error(err))
+	}
+}
+
+// clear records that the remote bucket of a replication exists again, following a successful write.
+func (g *remoteBucketGuard) clear(ctx context.Context, replicationID platform.ID) {
+	g.mu.Lock()
+	_, wasMissing := g.missing[replicationID]
+	delete(g.missing, replicationID)
+	g.mu.Unlock()
+
+	if !wasMissing {
+		return
+	}
+	if err := g.setMissing(ctx, replicationID, false); err != nil {
+		g.log.Warn("Failed to clear missing remote bucket", zap.String("id", replicationID.String()), zap.Error(err))
+	}
+}
+
+func (g *remoteBucketGuard) setMissing(ctx context.Context, replicationID platform.ID, missing bool) error {
+	g.store.Mu.Lock()
+	defer g.store.Mu.Unlock()
+
+	query, args, err := sq.Update("replications").
+		SetMap(sq.Eq{"remote_bucket_missing": missing}).
+		Where(sq.Eq{"id": replicationID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = g.store.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// countDropped counts the points of a block of data dropped because the remote bucket is missing.
+func (g *remoteBucketGuard) countDropped(replicationID platform.ID, data []byte) {
+	if g.metrics == nil {
+		return
+	}
+	counts := make(map[string]int64)
+	if err := countMeasurements(data, counts); err != nil {
+		g.log.Warn("Failed to count dropped points", zap.String("id", replicationID.String()), zap.Error(err))
+		return
+	}
+	var n int64
+	for _, c := range counts {
+		n += c
+	}
+	g.metrics.DroppedPoints.WithLabelValues(replicationID.String(), metrics.DropReasonRemoteBucketDeleted).Add(float64(n))
+}
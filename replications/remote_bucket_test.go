@@ -0,0 +1,162 @@
+package replications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// newBucketNotFoundRemote starts a remote which only has the bucket with the given ID.
+func newBucketNotFoundRemote(t *testing.T, existing platform.ID) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("bucket") != existing.String() {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"not found","message":"bucket \"` + r.URL.Query().Get("bucket") + `\" not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setupRemoteBucketGuard(t *testing.T, policy influxdb.RemoteBucketDeletedPolicy, remoteURL string) (*service, mocks, func(t *testing.T)) {
+	t.Helper()
+
+	svc, mocks, clean := newTestService(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	_, err := svc.store.DB.Exec("UPDATE remotes SET remote_url = ? WHERE id = ?", remoteURL, createReq.RemoteID)
+	require.NoError(t, err)
+
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+
+	req := createReq
+	req.RemoteBucketDeletedPolicy = policy
+	_, err = svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+
+	return svc, mocks, clean
+}
+
+func getRemoteBucketStatus(t *testing.T, svc *service) (platform.ID, bool) {
+	t.Helper()
+
+	var status struct {
+		RemoteBucketID platform.ID `db:"remote_bucket_id"`
+		Missing        bool        `db:"remote_bucket_missing"`
+	}
+	query, args, err := sq.Select("remote_bucket_id", "remote_bucket_missing").From("replications").Where(sq.Eq{"id": initID}).ToSql()
+	require.NoError(t, err)
+	require.NoError(t, svc.store.DB.Get(&status, query, args...))
+	return status.RemoteBucketID, status.Missing
+}
+
+func TestRemoteBucketDeleted_PauseAndAlert(t *testing.T) {
+	t.Parallel()
+
+	server := newBucketNotFoundRemote(t, platform.ID(1))
+	svc, mocks, clean := setupRemoteBucketGuard(t, "", server.URL)
+	defer clean(t)
+
+	write := svc.remoteBuckets.guard(internal.NewRemoteWriter(svc.getFullHTTPConfig, zaptest.NewLogger(t)).Write)
+
+	// The policy defaults to pausing the replication, keeping the data in the queue.
+	mocks.durableQueueManager.EXPECT().PauseQueueFor(initID, internal.PauseReasonBucketMissing)
+	err := write(initID, []byte("data"))
+	require.True(t, errors.Is(err, internal.ErrRemoteBucketNotFound))
+
+	_, missing := getRemoteBucketStatus(t, svc)
+	require.True(t, missing)
+
+	// Pointing the replication at a bucket which exists resumes it, and the next send clears the condition.
+	mocks.durableQueueManager.EXPECT().ResumeQueueFor(initID, internal.PauseReasonBucketMissing)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	remoteBucketID := platform.ID(1)
+	_, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{RemoteBucketID: &remoteBucketID})
+	require.NoError(t, err)
+
+	require.NoError(t, write(initID, []byte("data")))
+	_, missing = getRemoteBucketStatus(t, svc)
+	require.False(t, missing)
+}
+
+func TestRemoteBucketDeleted_Drop(t *testing.T) {
+	t.Parallel()
+
+	server := newBucketNotFoundRemote(t, platform.ID(1))
+	svc, _, clean := setupRemoteBucketGuard(t, influxdb.RemoteBucketDeletedDrop, server.URL)
+	defer clean(t)
+
+	write := svc.remoteBuckets.guard(internal.NewRemoteWriter(svc.getFullHTTPConfig, zaptest.NewLogger(t)).Write)
+
+	// The data is dropped without pausing the replication.
+	require.NoError(t, write(initID, []byte("data")))
+	_, missing := getRemoteBucketStatus(t, svc)
+	require.True(t, missing)
+
+	// Updating the replication doesn't try to resume it (which the mock would reject), since it was never paused.
+	svc.remoteBuckets.resume(initID)
+}
+
+func TestRemoteBucketDeleted_Recreate(t *testing.T) {
+	t.Parallel()
+
+	newBucketID := platform.ID(2)
+	server := newBucketNotFoundRemote(t, newBucketID)
+
+	t.Run("auto-create enabled", func(t *testing.T) {
+		t.Parallel()
+
+		svc, mocks, clean := setupRemoteBucketGuard(t, influxdb.RemoteBucketDeletedRecreate, server.URL)
+		defer clean(t)
+
+		var createdName string
+		svc.remoteBuckets.create = func(_ context.Context, conf *internal.ReplicationHTTPConfig, name string) (platform.ID, error) {
+			require.Equal(t, server.URL, conf.RemoteURL)
+			createdName = name
+			return newBucketID, nil
+		}
+		write := svc.remoteBuckets.guard(internal.NewRemoteWriter(svc.getFullHTTPConfig, zaptest.NewLogger(t)).Write)
+
+		mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{Name: "local"}, nil)
+		require.NoError(t, write(initID, []byte("data")))
+		require.Equal(t, "local", createdName)
+
+		remoteBucketID, missing := getRemoteBucketStatus(t, svc)
+		require.Equal(t, newBucketID, remoteBucketID)
+		require.False(t, missing)
+	})
+
+	t.Run("auto-create disabled", func(t *testing.T) {
+		t.Parallel()
+
+		svc, mocks, clean := setupRemoteBucketGuard(t, influxdb.RemoteBucketDeletedRecreate, server.URL)
+		defer clean(t)
+
+		write := svc.remoteBuckets.guard(internal.NewRemoteWriter(svc.getFullHTTPConfig, zaptest.NewLogger(t)).Write)
+
+		mocks.durableQueueManager.EXPECT().PauseQueueFor(initID, internal.PauseReasonBucketMissing)
+		err := write(initID, []byte("data"))
+		require.True(t, errors.Is(err, internal.ErrRemoteBucketNotFound))
+
+		remoteBucketID, missing := getRemoteBucketStatus(t, svc)
+		require.Equal(t, createReq.RemoteBucketID, remoteBucketID)
+		require.True(t, missing)
+	})
+}
@@ -0,0 +1,45 @@
+package replications
+
+import (
+	"context"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	remotesTransport "github.com/influxdata/influxdb/v2/remotes/transport"
+)
+
+type RemoteConfigInvalidator interface {
+	// InvalidateRemoteHTTPConfigs drops any cached connection info for the remote with the given ID.
+	InvalidateRemoteHTTPConfigs(platform.ID)
+}
+
+type remoteService struct {
+	remotesTransport.RemoteConnectionService
+	invalidator RemoteConfigInvalidator
+}
+
+// NewRemoteService wraps a remotes service, invalidating the cached connection info of remotes
+// which are updated or deleted.
+func NewRemoteService(remoteSvc remotesTransport.RemoteConnectionService, invalidator RemoteConfigInvalidator) *remoteService {
+	return &remoteService{
+		RemoteConnectionService: remoteSvc,
+		invalidator:             invalidator,
+	}
+}
+
+func (s *remoteService) UpdateRemoteConnection(ctx context.Context, id platform.ID, request influxdb.UpdateRemoteConnectionRequest) (*influxdb.RemoteConnection, error) {
+	rc, err := s.RemoteConnectionService.UpdateRemoteConnection(ctx, id, request)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidator.InvalidateRemoteHTTPConfigs(id)
+	return rc, nil
+}
+
+func (s *remoteService) DeleteRemoteConnection(ctx context.Context, id platform.ID, cascade bool) error {
+	if err := s.RemoteConnectionService.DeleteRemoteConnection(ctx, id, cascade); err != nil {
+		return err
+	}
+	s.invalidator.InvalidateRemoteHTTPConfigs(id)
+	return nil
+}
@@ -0,0 +1,60 @@
+package replications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+)
+
+// retryBackoffSource reports when the replications backing off after failing to send will send again.
+type retryBackoffSource interface {
+	NextRetryTimes(ids []platform.ID) map[platform.ID]time.Time
+}
+
+// nextRetryTimes returns when each of the given replications backing off after failing to send will send again.
+// Without a source, none are.
+func (s service) nextRetryTimes(ids []platform.ID) map[platform.ID]time.Time {
+	if s.retryBackoffs == nil {
+		return nil
+	}
+	return s.retryBackoffs.NextRetryTimes(ids)
+}
+
+// ResetRetryBackoff stops a replication and its additional destinations from backing off after failed sends, so
+// they send again immediately instead of waiting out the backoff, e.g. once their remote is known to be back.
+func (s service) ResetRetryBackoff(ctx context.Context, id platform.ID) error {
+	q := sq.Select("id").From("replications").Where(sq.Eq{"id": id})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+	var found platform.ID
+	if err := s.store.DB.GetContext(ctx, &found, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errReplicationNotFound
+		}
+		return err
+	}
+
+	destinationIDs, err := s.destinationIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, d := range append([]platform.ID{id}, destinationIDs...) {
+		if err := s.durableQueueManager.ResetRetryBackoff(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setNextRetryAt(r *influxdb.Replication, next map[platform.ID]time.Time) {
+	if t, ok := next[r.ID]; ok {
+		r.NextRetryAt = &t
+	}
+}
@@ -0,0 +1,77 @@
+package replications
+
+import (
+	"context"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+)
+
+// ExplainRouting reports, for each replication of a local bucket, whether a point written to the bucket would be
+// enqueued into it and why. It applies the same filters as WritePoints, without writing or enqueueing anything.
+func (s service) ExplainRouting(ctx context.Context, orgID, bucketID platform.ID, point models.Point) ([]influxdb.ReplicationRoutingDecision, error) {
+	q := sq.Select("id", "name", "enqueue_on_local_failure", "durability_tier", "serialized_enqueue",
+		"preserve_write_boundaries", "filter_expression", "durable_ack", "compression", "measurement_filter", "tag_filter").
+		From("replications").
+		Where(sq.Eq{"org_id": orgID, "local_bucket_id": bucketID}).
+		OrderBy("id")
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []struct {
+		replicationTarget
+		Name string `db:"name"`
+	}
+	if err := s.store.DB.SelectContext(ctx, &targets, query, args...); err != nil {
+		return nil, err
+	}
+
+	decisions := make([]influxdb.ReplicationRoutingDecision, 0, len(targets))
+	for _, t := range targets {
+		included, reason := s.route(t.replicationTarget, point)
+		decisions = append(decisions, influxdb.ReplicationRoutingDecision{
+			ReplicationID: t.ID,
+			Name:          t.Name,
+			Included:      included,
+			Reason:        reason,
+		})
+	}
+	return decisions, nil
+}
+
+// route decides whether a point is enqueued into a replication, explaining the decision.
+func (s service) route(t replicationTarget, point models.Point) (bool, string) {
+	measurements, err := s.filters.getMeasurementFilter(t.MeasurementFilter)
+	if err != nil {
+		return false, fmt.Sprintf("measurement filter can't be evaluated: %v", err)
+	}
+	filter, err := s.filters.get(t.FilterExpression)
+	if err != nil {
+		return false, fmt.Sprintf("filter expression can't be evaluated: %v", err)
+	}
+	tags := s.filters.getTagFilter(t.TagFilter)
+	if measurements == nil && tags == nil && filter == nil {
+		return true, "replication has no filters"
+	}
+	if measurements != nil && !measurements.match(point) {
+		return false, fmt.Sprintf("point's measurement %q does not match measurement filter %q", point.Name(), *t.MeasurementFilter)
+	}
+	if tags != nil && !tags.match(point) {
+		return false, fmt.Sprintf("point's tags do not match tag filter %s", tagFilterString(t.TagFilter))
+	}
+	if filter == nil && tags != nil {
+		return true, fmt.Sprintf("point's tags match tag filter %s", tagFilterString(t.TagFilter))
+	}
+	if filter == nil {
+		return true, fmt.Sprintf("point's measurement %q matches measurement filter %q", point.Name(), *t.MeasurementFilter)
+	}
+	if !filter.match(point) {
+		return false, fmt.Sprintf("point does not match filter expression %q", *t.FilterExpression)
+	}
+	return true, fmt.Sprintf("point matches filter expression %q", *t.FilterExpression)
+}
@@ -0,0 +1,77 @@
+package replications
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainRouting(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	cpuUS := `measurement == "cpu" && tags.region == "us"`
+	mem := `measurement == "mem"`
+	reqs := []influxdb.CreateReplicationRequest{createReq, createReq, createReq}
+	reqs[1].Name, reqs[1].FilterExpression = "cpu-us", &cpuUS
+	reqs[2].Name, reqs[2].FilterExpression = "mem", &mem
+
+	mocks.bucketSvc.EXPECT().RLock().Times(len(reqs))
+	mocks.bucketSvc.EXPECT().RUnlock().Times(len(reqs))
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(len(reqs))
+	for _, req := range reqs {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name  string
+		point string
+		want  []bool
+	}{
+		{name: "matches cpu filter", point: `cpu,region=us value=1 1`, want: []bool{true, true, false}},
+		{name: "wrong tag", point: `cpu,region=eu value=1 1`, want: []bool{true, false, false}},
+		{name: "matches mem filter", point: `mem,region=us value=1 1`, want: []bool{true, false, true}},
+		{name: "matches no filter", point: `disk value=1 1`, want: []bool{true, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			point := mustParsePoints(t, tt.point)[0]
+			decisions, err := svc.ExplainRouting(ctx, replication.OrgID, replication.LocalBucketID, point)
+			require.NoError(t, err)
+			require.Len(t, decisions, len(reqs))
+
+			for i, d := range decisions {
+				require.Equal(t, initID+platform.ID(i), d.ReplicationID)
+				require.Equal(t, reqs[i].Name, d.Name)
+				require.Equal(t, tt.want[i], d.Included, d.Reason)
+
+				// Filters explain the decision in terms of the expression.
+				if reqs[i].FilterExpression != nil {
+					require.Contains(t, d.Reason, *reqs[i].FilterExpression)
+				}
+			}
+
+			// The explanation agrees with what's actually enqueued by a write.
+			for i, want := range tt.want {
+				filter, err := svc.filters.get(reqs[i].FilterExpression)
+				require.NoError(t, err)
+				require.Equal(t, want, len(filter.filter([]models.Point{point})) == 1)
+			}
+		})
+	}
+
+	// Buckets without replications have nothing to explain.
+	decisions, err := svc.ExplainRouting(ctx, replication.OrgID, platform.ID(12345), mustParsePoints(t, `cpu value=1 1`)[0])
+	require.NoError(t, err)
+	require.Empty(t, decisions)
+}
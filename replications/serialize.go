@@ -0,0 +1,279 @@
+package replications
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"golang.org/x/sync/errgroup"
+)
+
+// minPointsPerSerializationWorker is the smallest shard of points worth serializing in its own goroutine.
+const minPointsPerSerializationWorker = 1000
+
+// maxPooledSerializationBufferBytes is the largest serialization buffer kept for reuse. Buffers grown past it
+// by an unusually large write are left to the garbage collector, rather than pinning their memory.
+const maxPooledSerializationBufferBytes = 32 * 1024 * 1024
+
+// serializationBuffers holds the buffers blocks are serialized into, so writes reuse the room grown by earlier
+// writes instead of growing a new buffer, and transiently holding a copy of it, every time.
+var serializationBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getSerializationBuffer() *bytes.Buffer {
+	return serializationBuffers.Get().(*bytes.Buffer)
+}
+
+func putSerializationBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledSerializationBufferBytes {
+		return
+	}
+	buf.Reset()
+	serializationBuffers.Put(buf)
+}
+
+// compressors holds a pool of compressors for each codec. Setting up a gzip or zstd compressor allocates
+// hundreds of kilobytes of state, which would otherwise be paid on every write.
+var compressors = map[influxdb.ReplicationCompression]*sync.Pool{
+	influxdb.CompressionGzip: {},
+	influxdb.CompressionZstd: {},
+	influxdb.CompressionNone: {},
+}
+
+// getCompressor returns a compressor writing blocks compressed with the given codec into w, reusing a pooled one
+// if there is one.
+func getCompressor(compression influxdb.ReplicationCompression, w io.Writer) (internal.Compressor, error) {
+	if compression == "" {
+		compression = influxdb.CompressionGzip
+	}
+	if pool, ok := compressors[compression]; ok {
+		if cw, ok := pool.Get().(internal.Compressor); ok {
+			cw.Reset(w)
+			return cw, nil
+		}
+	}
+	return internal.NewCompressor(compression, w)
+}
+
+// putCompressor returns a compressor to the pool of its codec. It's detached from the buffer it was writing into,
+// so the buffer can be reused independently.
+func putCompressor(compression influxdb.ReplicationCompression, cw internal.Compressor) {
+	if compression == "" {
+		compression = influxdb.CompressionGzip
+	}
+	cw.Reset(io.Discard)
+	compressors[compression].Put(cw)
+}
+
+// serializePoints writes points as line protocol compressed with the given codec, passing each completed
+// block (along with the number of points it contains) to flush.
+// When maxBufferBytes is positive, a block is completed and flushed as soon as the line protocol written
+// into it reaches the limit, splitting large writes into several blocks at line boundaries. The slice passed
+// to flush is only valid until flush returns: its buffer is reused for the next block, and by later writes.
+func serializePoints(points []models.Point, compression influxdb.ReplicationCompression, maxBufferBytes int, flush func(data []byte, points int) error) error {
+	buf := getSerializationBuffer()
+	defer putSerializationBuffer(buf)
+	cw, err := getCompressor(compression, buf)
+	if err != nil {
+		return err
+	}
+	defer putCompressor(compression, cw)
+
+	var line []byte
+	var pending, pendingPoints int
+	var flushed bool
+	for _, p := range points {
+		line = append(p.AppendString(line[:0]), '\n')
+		n, err := cw.Write(line)
+		if err != nil {
+			_ = cw.Close()
+			return fmt.Errorf("failed to serialize points for replication: %w", err)
+		}
+		pending += n
+		pendingPoints++
+
+		if maxBufferBytes > 0 && pending >= maxBufferBytes {
+			if err := cw.Close(); err != nil {
+				return err
+			}
+			if err := flush(buf.Bytes(), pendingPoints); err != nil {
+				return err
+			}
+			buf.Reset()
+			cw.Reset(buf)
+			pending, pendingPoints, flushed = 0, 0, true
+		}
+	}
+
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if pending > 0 || !flushed {
+		return flush(buf.Bytes(), pendingPoints)
+	}
+	return nil
+}
+
+// withoutFieldlessPoints returns the points which have at least one field, and the number of points without any.
+// Points without fields can't be written as valid line protocol. The slice is only copied if points are removed.
+func withoutFieldlessPoints(points []models.Point) ([]models.Point, int) {
+	for i, p := range points {
+		if p.FieldIterator().Next() {
+			continue
+		}
+		kept := append(make([]models.Point, 0, len(points)-1), points[:i]...)
+		for _, p := range points[i+1:] {
+			if p.FieldIterator().Next() {
+				kept = append(kept, p)
+			}
+		}
+		return kept, len(points) - len(kept)
+	}
+	return points, 0
+}
+
+// serializePointsParallel is like serializePoints without a buffer cap, but shards the points across up to
+// workers goroutines. Each worker compresses its shard separately, and the results are concatenated in order
+// into a single block. Concatenated gzip members and zstd frames are decompressed transparently, so the block
+// holds exactly the same line protocol as the sequential path would produce.
+func serializePointsParallel(points []models.Point, compression influxdb.ReplicationCompression, workers int, flush func(data []byte, points int) error) error {
+	shards := workers
+	if max := len(points) / minPointsPerSerializationWorker; max < shards {
+		shards = max
+	}
+	if shards <= 1 {
+		return serializePoints(points, compression, 0, flush)
+	}
+
+	members := make([]*bytes.Buffer, shards)
+	defer func() {
+		for _, m := range members {
+			if m != nil {
+				putSerializationBuffer(m)
+			}
+		}
+	}()
+	size := (len(points) + shards - 1) / shards
+
+	var egroup errgroup.Group
+	for i := 0; i < shards; i++ {
+		i := i
+		lo, hi := i*size, (i+1)*size
+		if hi > len(points) {
+			hi = len(points)
+		}
+		if lo >= hi {
+			continue
+		}
+		members[i] = getSerializationBuffer()
+		egroup.Go(func() error {
+			buf := members[i]
+			cw, err := getCompressor(compression, buf)
+			if err != nil {
+				return err
+			}
+			defer putCompressor(compression, cw)
+
+			var line []byte
+			for _, p := range points[lo:hi] {
+				line = append(p.AppendString(line[:0]), '\n')
+				if _, err := cw.Write(line); err != nil {
+					_ = cw.Close()
+					return fmt.Errorf("failed to serialize points for replication: %w", err)
+				}
+			}
+			return cw.Close()
+		})
+	}
+	if err := egroup.Wait(); err != nil {
+		return err
+	}
+
+	var total int
+	for _, m := range members {
+		if m != nil {
+			total += m.Len()
+		}
+	}
+	block := getSerializationBuffer()
+	defer putSerializationBuffer(block)
+	block.Grow(total)
+	for _, m := range members {
+		if m != nil {
+			block.Write(m.Bytes())
+		}
+	}
+	return flush(block.Bytes(), len(points))
+}
+
+// timestampTail is the number of bytes at the end of a line of line protocol which always hold its timestamp,
+// if it has one: a separating space, an optional sign and at most 19 digits, and the newline.
+const timestampTail = 32
+
+// summarizeBatch returns the number of lines of line protocol in a compressed block of data, and the newest
+// timestamp among them in nanoseconds, or nil if none of the lines have a timestamp.
+func summarizeBatch(data []byte) (int64, *int64, error) {
+	zr, err := internal.Decompress(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+
+	var (
+		n       int64
+		newest  *int64
+		partial []byte
+	)
+	br := bufio.NewReaderSize(zr, 32*1024)
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Only the end of an overlong line is needed to find its timestamp.
+			partial = keepTail(append(partial, line...))
+			continue
+		}
+		if len(partial) > 0 {
+			line = keepTail(append(partial, line...))
+			partial = partial[:0]
+		}
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			n++
+			if ts, ok := lineTimestamp(line); ok && (newest == nil || ts > *newest) {
+				newest = &ts
+			}
+		}
+		if err == io.EOF {
+			return n, newest, nil
+		}
+		if err != nil {
+			return n, newest, err
+		}
+	}
+}
+
+func keepTail(b []byte) []byte {
+	if len(b) <= timestampTail {
+		return b
+	}
+	copy(b, b[len(b)-timestampTail:])
+	return b[:timestampTail]
+}
+
+// lineTimestamp parses the timestamp at the end of a line of line protocol. The last space-separated token
+// of a line without a timestamp is its field set, which never parses as an integer.
+func lineTimestamp(line []byte) (int64, bool) {
+	line = bytes.TrimRight(line, "\n")
+	i := bytes.LastIndexByte(line, ' ')
+	if i < 0 {
+		return 0, false
+	}
+	ts, err := strconv.ParseInt(string(line[i+1:]), 10, 64)
+	return ts, err == nil
+}
@@ -0,0 +1,184 @@
+package replications
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func generatePoints(tb testing.TB, n int) []models.Point {
+	tb.Helper()
+
+	var lp strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&lp, "cpu,host=host%d,region=r%d usage_user=%d,usage_system=%d.5 %d\n", i%1000, i%7, i, i, i)
+	}
+	points, err := models.ParsePointsString(lp.String())
+	require.NoError(tb, err)
+	return points
+}
+
+func gunzip(tb testing.TB, data []byte) []byte {
+	tb.Helper()
+
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(tb, err)
+	defer gzr.Close()
+
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(gzr)
+	require.NoError(tb, err)
+	return buf.Bytes()
+}
+
+func TestSerializePointsParallel(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int{0, 10, 2500, 10000} {
+		points := generatePoints(t, n)
+
+		var sequential []byte
+		require.NoError(t, serializePoints(points, influxdb.CompressionGzip, 0, func(data []byte, count int) error {
+			require.Equal(t, n, count)
+			sequential = gunzip(t, data)
+			return nil
+		}))
+
+		for _, workers := range []int{2, 4, 7} {
+			t.Run(fmt.Sprintf("%d points, %d workers", n, workers), func(t *testing.T) {
+				var flushes int
+				require.NoError(t, serializePointsParallel(points, influxdb.CompressionGzip, workers, func(data []byte, count int) error {
+					flushes++
+					require.Equal(t, n, count)
+					require.Equal(t, sequential, gunzip(t, data))
+					return nil
+				}))
+				require.Equal(t, 1, flushes)
+			})
+		}
+	}
+}
+
+func TestSerializePoints_Compression(t *testing.T) {
+	t.Parallel()
+
+	points := generatePoints(t, 2500)
+	var want bytes.Buffer
+	for _, p := range points {
+		want.WriteString(p.PrecisionString("ns") + "\n")
+	}
+
+	for _, compression := range []influxdb.ReplicationCompression{influxdb.CompressionGzip, influxdb.CompressionZstd, influxdb.CompressionNone} {
+		compression := compression
+		t.Run(string(compression), func(t *testing.T) {
+			t.Parallel()
+
+			check := func(data []byte, count int) error {
+				require.Equal(t, compression, internal.BlockCompression(data))
+				zr, err := internal.Decompress(data)
+				require.NoError(t, err)
+				defer zr.Close()
+				lp, err := io.ReadAll(zr)
+				require.NoError(t, err)
+				require.Equal(t, want.String(), string(lp))
+				require.Equal(t, len(points), count)
+
+				n, _, err := summarizeBatch(data)
+				require.NoError(t, err)
+				require.Equal(t, int64(len(points)), n)
+				return nil
+			}
+			require.NoError(t, serializePoints(points, compression, 0, check))
+			require.NoError(t, serializePointsParallel(points, compression, 4, check))
+			// The pooled compressors and buffers reused by later writes produce the same blocks.
+			require.NoError(t, serializePoints(points, compression, 0, check))
+		})
+	}
+
+	require.Error(t, serializePoints(points, "lz4", 0, func([]byte, int) error { return nil }))
+}
+
+func TestSummarizeBatch(t *testing.T) {
+	t.Parallel()
+
+	gz := func(lp string) []byte {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		_, err := gzw.Write([]byte(lp))
+		require.NoError(t, err)
+		require.NoError(t, gzw.Close())
+		return buf.Bytes()
+	}
+	longString := strings.Repeat("a b ", 20000)
+
+	for _, tt := range []struct {
+		name   string
+		lp     string
+		points int64
+		newest *int64
+	}{
+		{name: "empty", lp: ""},
+		{name: "timestamps", lp: "cpu value=1 30\ncpu value=2 10\ncpu value=3 20\n", points: 3, newest: int64Pointer(30)},
+		{name: "negative timestamps", lp: "cpu value=1 -30\ncpu value=2 -10\n", points: 2, newest: int64Pointer(-10)},
+		{name: "no timestamps", lp: "cpu value=1\ncpu value=2i\n", points: 2},
+		{name: "some timestamps", lp: "cpu value=1\ncpu value=2 5\n", points: 2, newest: int64Pointer(5)},
+		{name: "string field with spaces", lp: `cpu msg="up 99"` + "\n", points: 1},
+		{name: "overlong lines", lp: `cpu msg="` + longString + `" 1234567890123456789` + "\n" + `cpu msg="` + longString + `"` + "\n", points: 2, newest: int64Pointer(1234567890123456789)},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			points, newest, err := summarizeBatch(gz(tt.lp))
+			require.NoError(t, err)
+			require.Equal(t, tt.points, points)
+			require.Equal(t, tt.newest, newest)
+		})
+	}
+
+	_, _, err := summarizeBatch([]byte("not gzipped"))
+	require.Error(t, err)
+}
+
+func int64Pointer(i int64) *int64 {
+	return &i
+}
+
+func BenchmarkSerializePoints(b *testing.B) {
+	points := generatePoints(b, 100000)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := serializePointsParallel(points, influxdb.CompressionGzip, workers, func([]byte, int) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSerializePoints_Allocs(b *testing.B) {
+	points := generatePoints(b, 100000)
+
+	// Uncapped writes are serialized into a single block, capped ones are flushed in blocks of the given size.
+	for _, maxBufferBytes := range []int{0, 1024 * 1024} {
+		for _, compression := range []influxdb.ReplicationCompression{influxdb.CompressionGzip, influxdb.CompressionZstd} {
+			b.Run(fmt.Sprintf("%s/maxBufferBytes=%d", compression, maxBufferBytes), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := serializePoints(points, compression, maxBufferBytes, func([]byte, int) error { return nil }); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -1,27 +1,37 @@
 package replications
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"net/url"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/influxdata/influxdb/v2"
 	"github.com/influxdata/influxdb/v2/kit/platform"
 	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
 	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+	"github.com/influxdata/influxdb/v2/remotes/tokencrypt"
 	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
 	"github.com/influxdata/influxdb/v2/snowflake"
 	"github.com/influxdata/influxdb/v2/sqlite"
+	"github.com/influxdata/influxdb/v2/sqlite/migrations"
 	"github.com/influxdata/influxdb/v2/storage"
 	"github.com/mattn/go-sqlite3"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
 )
 
 var errReplicationNotFound = &ierrors.Error{
@@ -45,20 +55,244 @@ func errLocalBucketNotFound(id platform.ID, cause error) error {
 	}
 }
 
-func NewService(store *sqlite.SqlStore, bktSvc BucketService, localWriter storage.PointsWriter, log *zap.Logger, enginePath string) *service {
-	return &service{
+func errReplicationNameTaken(name string, cause error) error {
+	return &ierrors.Error{
+		Code: ierrors.EConflict,
+		Msg:  fmt.Sprintf("a replication named %q already exists in the organization", name),
+		Err:  cause,
+	}
+}
+
+func errRemoteInUse(id platform.ID, replicationIDs []platform.ID) error {
+	return &ierrors.Error{
+		Code: ierrors.EConflict,
+		Msg:  fmt.Sprintf("remote %q is in use by replication(s) %v, delete them first or delete the remote with cascade", id, replicationIDs),
+	}
+}
+
+func errEnqueueTimedOut(id platform.ID, timeout time.Duration) error {
+	return &ierrors.Error{
+		Code: ierrors.EUnavailable,
+		Msg:  fmt.Sprintf("enqueueing points into replication %q timed out after %s", id, timeout),
+	}
+}
+
+func errQueueFullWaitEnded(id platform.ID, err error) error {
+	return &ierrors.Error{
+		Code: ierrors.EUnavailable,
+		Msg:  fmt.Sprintf("gave up waiting for room in the full queue of replication %q", id),
+		Err:  err,
+	}
+}
+
+func errFieldlessPoints(n int) error {
+	return &ierrors.Error{
+		Code: ierrors.EInvalid,
+		Msg:  fmt.Sprintf("write contains %d point(s) without fields, which can't be replicated", n),
+	}
+}
+
+// OpEnqueueFailed is the op of errors returned by WritePoints when the points of a write couldn't be enqueued
+// into some of its replications. The details are available from EnqueueFailures.
+const OpEnqueueFailed = "replications/enqueueFailed"
+
+// errEnqueueFailed reports the replications a write's points couldn't be enqueued into. Failures of replications
+// with the guaranteed durability tier or durable acks are unavailable errors, so the client retries the write.
+// Failures of best-effort replications alone are reported as a partial write instead: the write was stored
+// locally, and retrying it wouldn't replicate the dropped points without duplicating the others.
+func errEnqueueFailed(failed *PartialEnqueueError) error {
+	if !failed.failsWrite {
+		return &ierrors.Error{
+			Code: ierrors.EUnprocessableEntity,
+			Msg:  fmt.Sprintf("points were written, but dropped by best-effort replication(s) %v", failed.IDs()),
+			Op:   OpEnqueueFailed,
+			Err:  failed,
+		}
+	}
+	return &ierrors.Error{
+		Code: ierrors.EUnavailable,
+		Msg:  fmt.Sprintf("failed to durably enqueue points for replication(s) %v, retry the write", failed.IDs()),
+		Op:   OpEnqueueFailed,
+		Err:  failed,
+	}
+}
+
+// EnqueueFailures returns the replications a write returning err failed to enqueue into, if that's why it failed.
+func EnqueueFailures(err error) (*PartialEnqueueError, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *PartialEnqueueError:
+			return e, true
+		case *ierrors.Error:
+			err = e.Err
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// PartialEnqueueError is wrapped by the error WritePoints returns when a write's points couldn't be enqueued into
+// some of its bucket's replications, whatever their durability tier. The write still completed locally, and its
+// points were enqueued into the bucket's other replications. If any replication with the guaranteed durability
+// tier or durable acks failed, callers can retry the write to replicate its points, at the cost of the other
+// replications receiving them again. Best-effort replications drop the points they fail to enqueue.
+type PartialEnqueueError struct {
+	// Failed holds the error enqueueing into each replication which failed.
+	Failed map[platform.ID]error
+
+	// failsWrite is set if any of the failed replications fail the write, see enqueueFailsWrite.
+	failsWrite bool
+}
+
+// IDs returns the IDs of the replications which failed, in order.
+func (e *PartialEnqueueError) IDs() []platform.ID {
+	ids := make([]platform.ID, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (e *PartialEnqueueError) Error() string {
+	ids := e.IDs()
+	causes := make([]string, len(ids))
+	for i, id := range ids {
+		causes[i] = fmt.Sprintf("%s: %v", id, e.Failed[id])
+	}
+	return fmt.Sprintf("failed to enqueue points for %d replication(s): %s", len(ids), strings.Join(causes, "; "))
+}
+
+// add records the failures of e into the aggregate of a write's failures, returning the aggregate.
+func (e *PartialEnqueueError) add(other *PartialEnqueueError) *PartialEnqueueError {
+	if e == nil {
+		e = &PartialEnqueueError{Failed: make(map[platform.ID]error)}
+	}
+	for id, err := range other.Failed {
+		e.Failed[id] = err
+	}
+	e.failsWrite = e.failsWrite || other.failsWrite
+	return e
+}
+
+func NewService(store *sqlite.SqlStore, bktSvc BucketService, localWriter storage.PointsWriter, log *zap.Logger, enginePath string, opts ...Option) *service {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cacheSize, cacheTTL := defaultHTTPConfigCacheSize, defaultHTTPConfigCacheTTL
+	if cfg.httpConfigCacheSize != nil {
+		cacheSize, cacheTTL = *cfg.httpConfigCacheSize, cfg.httpConfigCacheTTL
+	}
+
+	svc := &service{
 		store:         store,
 		idGenerator:   snowflake.NewIDGenerator(),
 		bucketService: bktSvc,
 		localWriter:   localWriter,
 		validator:     internal.NewValidator(),
 		log:           log,
-		durableQueueManager: internal.NewDurableQueueManager(
-			log,
-			filepath.Join(enginePath, "replicationq"),
-			internal.WriteFunc,
-		),
+		localWrites:   newLocalWriteGate(store),
+		metrics:       metrics.NewReplicationsMetrics(),
+		inFlight:      newInFlightLimiter(store, cfg.maxInFlightBytesPerRemote),
+		configCache:   newHTTPConfigCache(cacheSize, cacheTTL),
+
+		maxSerializationBufferBytes: cfg.maxSerializationBufferBytes,
+		serializationWorkers:        cfg.serializationWorkers,
+		enqueueTimeout:              cfg.enqueueTimeout,
+		enqueueConcurrency:          cfg.enqueueConcurrency,
+		localFailurePolicy:          cfg.localFailurePolicy,
+		rejectFieldlessPoints:       cfg.rejectFieldlessPoints,
+		staleStatusThreshold:        cfg.staleStatusThreshold,
+		maxQueueSizeLimit:           cfg.maxQueueSizeLimit,
+
+		backfillReader:        cfg.backfillReader,
+		backfillChunkDuration: cfg.backfillChunkDuration,
+		backfills:             newBackfillJobs(),
+
+		sequencers: newEnqueueSequencers(),
+		filters:    newFilterExprCache(),
+
+		queueSizing: newQueueSizingTracker(),
+		unwritable:  newUnwritableQueues(),
+		tokens:      cfg.tokens,
+	}
+	svc.errorRates = newErrorRateTracker(cfg.errorRateWindow, svc.metrics)
+	if cfg.coalesceWindow > 0 {
+		maxPoints := cfg.coalesceMaxPoints
+		if maxPoints <= 0 {
+			maxPoints = defaultCoalesceMaxPoints
+		}
+		svc.coalescer = newEnqueueCoalescer(cfg.coalesceWindow, maxPoints, func(targets []replicationTarget, points []models.Point) error {
+			return svc.enqueueCoalesced(targets, points)
+		})
+	}
+	if cfg.webhookURL != "" {
+		svc.webhooks = newWebhookNotifier(cfg.webhookURL, cfg.webhookDebounce, store, log)
+	}
+
+	egress := newEgressTracker(store, nil, log)
+	egress.metrics = svc.metrics
+	stats := newStatsRecorder(store, log)
+	remoteWriter := internal.NewRemoteWriter(svc.getFullHTTPConfig, log)
+	remoteWriter.SetMetrics(svc.metrics)
+	remoteWriter.SetDeadLetterFunc(svc.writeDeadLetter)
+	var createBucket remoteBucketCreator
+	if cfg.remoteBucketAutoCreate {
+		createBucket = remoteWriter.CreateBucket
+	}
+	remoteBuckets := newRemoteBucketGuard(store, bktSvc, svc.getFullHTTPConfig, createBucket, log)
+	remoteBuckets.invalidate = svc.configCache.invalidateReplication
+	remoteBuckets.metrics = svc.metrics
+	durableQueueManager := internal.NewDurableQueueManager(
+		log,
+		filepath.Join(enginePath, "replicationq"),
+		svc.metrics,
+		cfg.queueSegmentSize,
+		remoteBuckets.guard(egress.observe(stats.observe(svc.webhooks.observe(svc.queueSizing.observe(svc.errorRates.observe(svc.inFlight.limit(remoteWriter.Write))))))),
+	)
+	if cfg.sendDedupWindow > 0 {
+		durableQueueManager.EnableSendDedup(cfg.sendDedupWindow, cfg.sendDedupMaxEntries)
+	}
+	if cfg.verifyBatches {
+		durableQueueManager.EnableBatchVerification()
 	}
+	if cfg.retryMinBackoff > 0 {
+		durableQueueManager.EnableRetryQueues(cfg.retryMinBackoff, cfg.retryMaxBackoff)
+	}
+	if cfg.senderWorkers > 0 {
+		durableQueueManager.SetSenderWorkers(cfg.senderWorkers)
+	}
+	if cfg.maxQueueOpenFiles > 0 {
+		durableQueueManager.SetMaxOpenFiles(cfg.maxQueueOpenFiles)
+	}
+	if cfg.maxInFlightPointsPerReplication > 0 {
+		durableQueueManager.SetMaxWritePoints(cfg.maxInFlightPointsPerReplication)
+	}
+	if cfg.maxInFlightBytesPerRemote > 0 {
+		durableQueueManager.SetSendGate(svc.inFlight.admit)
+		svc.inFlight.wake = durableQueueManager.WakeQueue
+	}
+	egress.queues = durableQueueManager
+	remoteBuckets.queues = durableQueueManager
+	svc.retryBackoffs = durableQueueManager
+
+	if cfg.minFreeDiskBytes > 0 {
+		svc.diskWatchdog = newDiskWatchdog(filepath.Join(enginePath, "replicationq"), cfg.minFreeDiskBytes,
+			cfg.diskWatchdogInterval, svc.metrics, log)
+	}
+
+	svc.capabilities = newCapabilityDetector(store, internal.ProbeRemoteCapabilities, svc.getFullHTTPConfig, cfg.capabilityProbeInterval, log)
+	svc.capabilities.invalidate = svc.configCache.invalidateReplication
+
+	svc.queueGrowth = newQueueGrowthTracker(store, durableQueueManager, cfg.queueGrowthInterval, cfg.queueGrowthWindow, svc.metrics, log)
+
+	svc.egress = egress
+	svc.stats = stats
+	svc.remoteBuckets = remoteBuckets
+	svc.durableQueueManager = durableQueueManager
+	return svc
 }
 
 type ReplicationValidator interface {
@@ -76,9 +310,26 @@ type DurableQueueManager interface {
 	DeleteQueue(replicationID platform.ID) error
 	UpdateMaxQueueSize(replicationID platform.ID, maxQueueSizeBytes int64) error
 	CurrentQueueSizes(ids []platform.ID) (map[platform.ID]int64, error)
+	PeekQueue(replicationID platform.ID, maxBytes int) ([][]byte, error)
 	StartReplicationQueues(trackedReplications map[platform.ID]int64) error
 	CloseAll() error
-	EnqueueData(replicationID platform.ID, data []byte) error
+	// EnqueueData and EnqueueDataSync append a block into a replication's queue. The same block is enqueued
+	// into every replication sharing its serialization, concurrently, so implementations must only read data,
+	// and must not hold on to it after returning: its buffer is reused by later writes. points is the number of
+	// points in data.
+	EnqueueData(replicationID platform.ID, data []byte, points int) error
+	EnqueueDataSync(replicationID platform.ID, data []byte, points int) error
+	PauseQueue(replicationID platform.ID) error
+	PauseQueueUntil(replicationID platform.ID, until time.Time) error
+	ResumeQueue(replicationID platform.ID) error
+	PauseQueueFor(replicationID platform.ID, reason internal.PauseReason) error
+	ResumeQueueFor(replicationID platform.ID, reason internal.PauseReason) error
+	SetOrderedDelivery(replicationID platform.ID, enabled bool) error
+	SetFlushInterval(replicationID platform.ID, interval time.Duration) error
+	SetRetryBackoff(replicationID platform.ID, interval, maxInterval time.Duration) error
+	ResetRetryBackoff(replicationID platform.ID) error
+	Flush(ctx context.Context, replicationID platform.ID) (int64, error)
+	QueueStats(replicationID platform.ID) (internal.QueueStats, error)
 }
 
 type service struct {
@@ -88,24 +339,121 @@ type service struct {
 	validator           ReplicationValidator
 	durableQueueManager DurableQueueManager
 	localWriter         storage.PointsWriter
-	log                 *zap.Logger
+	localWrites         *localWriteGate
+	metrics             *metrics.ReplicationsMetrics
+	inFlight            *inFlightLimiter
+	egress              *egressTracker
+	remoteBuckets       *remoteBucketGuard
+	configCache         *httpConfigCache
+	diskWatchdog        *diskWatchdog
+	queueGrowth         *queueGrowthTracker
+	queueSizing         *queueSizingTracker
+	errorRates          *errorRateTracker
+	// webhooks is nil unless a failure webhook is configured.
+	webhooks *webhookNotifier
+	log      *zap.Logger
+
+	// maxSerializationBufferBytes caps the size of the line protocol serialized into a single block by WritePoints.
+	// Zero means unlimited.
+	maxSerializationBufferBytes int
+	// serializationWorkers is the maximum number of goroutines used to serialize a single large write.
+	serializationWorkers int
+	// enqueueTimeout bounds the time spent enqueueing a block into a single replication. Zero means unlimited.
+	enqueueTimeout time.Duration
+	// enqueueConcurrency is the maximum number of replications a block is enqueued into at once. Zero means
+	// defaultEnqueueConcurrency.
+	enqueueConcurrency int
+	// localFailurePolicy decides what WritePoints returns when the local write fails but its points were
+	// replicated anyway.
+	localFailurePolicy LocalFailurePolicy
+	// rejectFieldlessPoints fails writes containing points without fields, rather than not replicating those points.
+	rejectFieldlessPoints bool
+	// coalescer is nil unless enqueue coalescing is configured.
+	coalescer *enqueueCoalescer
+	// staleStatusThreshold is the age after which the status of a replication is reported as unknown. Zero means
+	// statuses never go stale.
+	staleStatusThreshold time.Duration
+	// stats is nil in tests which don't record the outcome of sends.
+	stats *statsRecorder
+	// capabilities is nil in tests which don't probe remotes.
+	capabilities *capabilityDetector
+	// unwritable is nil in tests which don't track unwritable queues.
+	unwritable *unwritableQueues
+	// retryBackoffs is nil in tests which don't report the backoff of failed sends.
+	retryBackoffs retryBackoffSource
+	// queueFullRetryInterval is how often enqueues waiting for room in a full queue retry. Zero means the default.
+	queueFullRetryInterval time.Duration
+	// maxQueueSizeLimit is the largest max queue size a replication may have. Zero means unlimited.
+	maxQueueSizeLimit int64
+
+	backfillReader        PointsReader
+	backfillChunkDuration time.Duration
+	backfills             *backfillJobs
+
+	sequencers *enqueueSequencers
+	filters    *filterExprCache
+	// tokens decrypts the API tokens of remotes. It's nil if they're stored in plaintext.
+	tokens *tokencrypt.Cipher
+}
+
+// replicationSortColumns maps the fields replications can be listed in order of to their columns. Only these are
+// ever put in the ORDER BY clause.
+var replicationSortColumns = map[string]string{
+	"id":            "id",
+	"name":          "name",
+	"createdAt":     "created_at",
+	"updatedAt":     "updated_at",
+	"remoteID":      "remote_id",
+	"localBucketID": "local_bucket_id",
 }
 
 func (s service) ListReplications(ctx context.Context, filter influxdb.ReplicationListFilter) (*influxdb.Replications, error) {
-	q := sq.Select(
-		"id", "org_id", "name", "description", "remote_id", "local_bucket_id", "remote_bucket_id",
-		"max_queue_size_bytes", "latest_response_code", "latest_error_message", "drop_non_retryable_data").
-		From("replications").
-		Where(sq.Eq{"org_id": filter.OrgID})
+	if err := filter.OK(); err != nil {
+		return nil, err
+	}
 
+	// Destinations are listed as part of the replication they belong to.
+	conds := sq.Eq{"org_id": filter.OrgID, "fanout_parent_id": nil}
 	if filter.Name != nil {
-		q = q.Where(sq.Eq{"name": *filter.Name})
+		conds["name"] = *filter.Name
 	}
 	if filter.RemoteID != nil {
-		q = q.Where(sq.Eq{"remote_id": *filter.RemoteID})
+		conds["remote_id"] = *filter.RemoteID
 	}
 	if filter.LocalBucketID != nil {
-		q = q.Where(sq.Eq{"local_bucket_id": *filter.LocalBucketID})
+		conds["local_bucket_id"] = *filter.LocalBucketID
+	}
+
+	q := sq.Select(
+		"id", "org_id", "name", "description", "remote_id", "local_bucket_id", "remote_bucket_id",
+		"max_queue_size_bytes", "latest_response_code", "latest_error_message", "latest_status_at", "latest_success_at", "drop_non_retryable_data",
+		"enqueue_on_local_failure", "durability_tier", "serialized_enqueue", "delivered_bytes", "delivered_points", "consecutive_failures",
+		"remote_bucket_deleted_policy", "remote_bucket_missing", "ordered_delivery", "preserve_write_boundaries", "filter_expression", "durable_ack",
+		"paused", "paused_until", "watermark", "newest_delivered_point_ns", "remote_write_precision", "flush_interval_seconds", "compression",
+		"remote_capabilities", "remote_bucket_tag", "remote_bucket_mapping", "block_on_full_queue", "timestamp_offset_seconds", "measurement_filter", "tag_filter",
+		"retry_interval_seconds", "max_retry_interval_seconds", "fanout_parent_id", "dead_letter_bucket_id", "dead_lettered_points", "remote_database", "remote_retention_policy", "downsample", "rename_rules").
+		From("replications").
+		Where(conds)
+
+	if filter.SortBy != "" || filter.Paginated() {
+		// Pages are only stable with a total order, so ties are broken by ID.
+		column := replicationSortColumns[filter.SortBy]
+		if column == "" {
+			column = "id"
+		}
+		direction := "ASC"
+		if filter.Descending {
+			direction = "DESC"
+		}
+		q = q.OrderBy(fmt.Sprintf("%s %s", column, direction), fmt.Sprintf("id %s", direction))
+	}
+	if filter.Paginated() {
+		// SQLite only takes an offset along with a limit.
+		limit := uint64(math.MaxInt64)
+		if filter.Limit > 0 {
+			limit = uint64(filter.Limit)
+		}
+		q = q.Limit(limit).Offset(uint64(filter.Offset))
 	}
 
 	query, args, err := q.ToSql()
@@ -118,6 +466,16 @@ func (s service) ListReplications(ctx context.Context, filter influxdb.Replicati
 		return nil, err
 	}
 
+	if filter.Paginated() {
+		query, args, err := sq.Select("COUNT(*)").From("replications").Where(conds).ToSql()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.DB.GetContext(ctx, &rs.TotalCount, query, args...); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(rs.Replications) == 0 {
 		return &rs, nil
 	}
@@ -126,12 +484,28 @@ func (s service) ListReplications(ctx context.Context, filter influxdb.Replicati
 	for i := range rs.Replications {
 		ids[i] = rs.Replications[i].ID
 	}
-	sizes, err := s.durableQueueManager.CurrentQueueSizes(ids)
+	destinations, destinationIDs, err := s.destinations(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := s.durableQueueManager.CurrentQueueSizes(append(ids, destinationIDs...))
 	if err != nil {
 		return nil, err
 	}
+	nextRetries := s.nextRetryTimes(ids)
+	now := time.Now()
 	for i := range rs.Replications {
 		rs.Replications[i].CurrentQueueSizeBytes = sizes[rs.Replications[i].ID]
+		setQueueSaturation(&rs.Replications[i])
+		setStatusReason(&rs.Replications[i])
+		markStaleStatus(&rs.Replications[i], now, s.staleStatusThreshold)
+		clearExpiredPause(&rs.Replications[i], now)
+		setReplicationLag(&rs.Replications[i], now)
+		s.errorRates.setErrorRate(&rs.Replications[i], now)
+		s.unwritable.setQueueUnwritable(&rs.Replications[i])
+		setNextRetryAt(&rs.Replications[i], nextRetries)
+		s.setHealth(&rs.Replications[i], now)
+		setDestinations(&rs.Replications[i], destinations, sizes)
 	}
 
 	return &rs, nil
@@ -147,6 +521,81 @@ func (s service) CreateReplication(ctx context.Context, request influxdb.CreateR
 	if _, err := s.bucketService.FindBucketByID(ctx, request.LocalBucketID); err != nil {
 		return nil, errLocalBucketNotFound(request.LocalBucketID, err)
 	}
+	if request.DeadLetterBucketID != nil {
+		if err := s.checkDeadLetterBucket(ctx, request.OrgID, *request.DeadLetterBucketID); err != nil {
+			return nil, err
+		}
+	}
+	if err := request.ValidateDestinations(); err != nil {
+		return nil, err
+	}
+
+	r, err := s.insertReplication(ctx, request, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.insertDestinations(ctx, r, request); err != nil {
+		return nil, err
+	}
+	s.setHealth(r, time.Now())
+
+	return r, nil
+}
+
+// insertReplication persists a new replication and initializes its queue. Replications delivering to one of the
+// additional destinations of another replication are inserted with its ID as their parentID.
+func (s service) insertReplication(ctx context.Context, request influxdb.CreateReplicationRequest, parentID *platform.ID) (*influxdb.Replication, error) {
+	tier := request.DurabilityTier
+	if tier == "" {
+		tier = influxdb.DurabilityBestEffort
+	}
+	bucketDeletedPolicy := request.RemoteBucketDeletedPolicy
+	if bucketDeletedPolicy == "" {
+		bucketDeletedPolicy = influxdb.RemoteBucketDeletedPauseAndAlert
+	}
+	precision := request.RemoteWritePrecision
+	if precision == "" {
+		precision = influxdb.WritePrecisionNanoseconds
+	}
+	compression := request.Compression
+	if compression == "" {
+		compression = influxdb.CompressionGzip
+	}
+	if _, err := s.filters.get(request.FilterExpression); err != nil {
+		return nil, err
+	}
+	var filterExpression *string
+	if request.FilterExpression != nil && *request.FilterExpression != "" {
+		filterExpression = request.FilterExpression
+	}
+	if _, err := s.filters.getMeasurementFilter(request.MeasurementFilter); err != nil {
+		return nil, err
+	}
+	var measurementFilter *string
+	if request.MeasurementFilter != nil && *request.MeasurementFilter != "" {
+		measurementFilter = request.MeasurementFilter
+	}
+	if err := request.TagFilter.OK(); err != nil {
+		return nil, err
+	}
+	if err := request.RenameRules.OK(); err != nil {
+		return nil, err
+	}
+	var remoteBucketTag *string
+	if request.RemoteBucketTag != nil && *request.RemoteBucketTag != "" {
+		remoteBucketTag = request.RemoteBucketTag
+	}
+	var remoteDatabase, remoteRetentionPolicy *string
+	if request.RemoteDatabase != nil && *request.RemoteDatabase != "" {
+		remoteDatabase = request.RemoteDatabase
+	}
+	if request.RemoteRetentionPolicy != nil && *request.RemoteRetentionPolicy != "" {
+		remoteRetentionPolicy = request.RemoteRetentionPolicy
+	}
+
+	if err := s.validateMaxQueueSize(request.MaxQueueSizeBytes); err != nil {
+		return nil, err
+	}
 
 	newID := s.idGenerator.ID()
 	if err := s.durableQueueManager.InitializeQueue(newID, request.MaxQueueSizeBytes); err != nil {
@@ -155,19 +604,45 @@ func (s service) CreateReplication(ctx context.Context, request influxdb.CreateR
 
 	q := sq.Insert("replications").
 		SetMap(sq.Eq{
-			"id":                      newID,
-			"org_id":                  request.OrgID,
-			"name":                    request.Name,
-			"description":             request.Description,
-			"remote_id":               request.RemoteID,
-			"local_bucket_id":         request.LocalBucketID,
-			"remote_bucket_id":        request.RemoteBucketID,
-			"max_queue_size_bytes":    request.MaxQueueSizeBytes,
-			"drop_non_retryable_data": request.DropNonRetryableData,
-			"created_at":              "datetime('now')",
-			"updated_at":              "datetime('now')",
+			"id":                       newID,
+			"org_id":                   request.OrgID,
+			"name":                     request.Name,
+			"description":              request.Description,
+			"remote_id":                request.RemoteID,
+			"local_bucket_id":          request.LocalBucketID,
+			"remote_bucket_id":         request.RemoteBucketID,
+			"max_queue_size_bytes":     request.MaxQueueSizeBytes,
+			"drop_non_retryable_data":  request.DropNonRetryableData,
+			"enqueue_on_local_failure": request.EnqueueOnLocalFailure,
+			"durability_tier":          tier,
+			"serialized_enqueue":       request.SerializedEnqueue,
+			"created_at":               "datetime('now')",
+			"updated_at":               "datetime('now')",
+
+			"remote_bucket_deleted_policy": bucketDeletedPolicy,
+			"ordered_delivery":             request.OrderedDelivery,
+			"preserve_write_boundaries":    request.PreserveWriteBoundaries,
+			"filter_expression":            filterExpression,
+			"durable_ack":                  request.DurableAck,
+			"remote_write_precision":       precision,
+			"flush_interval_seconds":       request.FlushIntervalSeconds,
+			"compression":                  compression,
+			"remote_bucket_tag":            remoteBucketTag,
+			"remote_bucket_mapping":        request.RemoteBucketMapping,
+			"block_on_full_queue":          request.BlockOnFullQueue,
+			"timestamp_offset_seconds":     request.TimestampOffsetSeconds,
+			"measurement_filter":           measurementFilter,
+			"tag_filter":                   request.TagFilter,
+			"retry_interval_seconds":       request.RetryIntervalSeconds,
+			"max_retry_interval_seconds":   request.MaxRetryIntervalSeconds,
+			"fanout_parent_id":             parentID,
+			"dead_letter_bucket_id":        request.DeadLetterBucketID,
+			"remote_database":              remoteDatabase,
+			"remote_retention_policy":      remoteRetentionPolicy,
+			"downsample":                   request.Downsample,
+			"rename_rules":                 request.RenameRules,
 		}).
-		Suffix("RETURNING id, org_id, name, description, remote_id, local_bucket_id, remote_bucket_id, max_queue_size_bytes, drop_non_retryable_data")
+		Suffix("RETURNING id, org_id, name, description, remote_id, local_bucket_id, remote_bucket_id, max_queue_size_bytes, drop_non_retryable_data, enqueue_on_local_failure, durability_tier, serialized_enqueue, remote_bucket_deleted_policy, remote_bucket_missing, ordered_delivery, preserve_write_boundaries, filter_expression, durable_ack, paused, paused_until, watermark, remote_write_precision, flush_interval_seconds, compression, remote_capabilities, remote_bucket_tag, remote_bucket_mapping, block_on_full_queue, timestamp_offset_seconds, measurement_filter, tag_filter, retry_interval_seconds, max_retry_interval_seconds, fanout_parent_id, dead_letter_bucket_id, remote_database, remote_retention_policy, downsample, rename_rules")
 
 	cleanupQueue := func() {
 		if cleanupErr := s.durableQueueManager.DeleteQueue(newID); cleanupErr != nil {
@@ -175,6 +650,26 @@ func (s service) CreateReplication(ctx context.Context, request influxdb.CreateR
 		}
 	}
 
+	if request.OrderedDelivery {
+		if err := s.durableQueueManager.SetOrderedDelivery(newID, true); err != nil {
+			cleanupQueue()
+			return nil, err
+		}
+	}
+	if request.FlushIntervalSeconds > 0 {
+		if err := s.durableQueueManager.SetFlushInterval(newID, time.Duration(request.FlushIntervalSeconds)*time.Second); err != nil {
+			cleanupQueue()
+			return nil, err
+		}
+	}
+	if request.RetryIntervalSeconds > 0 {
+		if err := s.durableQueueManager.SetRetryBackoff(newID, time.Duration(request.RetryIntervalSeconds)*time.Second,
+			time.Duration(request.MaxRetryIntervalSeconds)*time.Second); err != nil {
+			cleanupQueue()
+			return nil, err
+		}
+	}
+
 	query, args, err := q.ToSql()
 	if err != nil {
 		cleanupQueue()
@@ -188,9 +683,20 @@ func (s service) CreateReplication(ctx context.Context, request influxdb.CreateR
 			cleanupQueue()
 			return nil, errRemoteNotFound(request.RemoteID, err)
 		}
+		// Names are unique within an org, enforced by the replications_uniq_orgid_name constraint.
+		if sqlErr, ok := err.(sqlite3.Error); ok && sqlErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			cleanupQueue()
+			return nil, errReplicationNameTaken(request.Name, err)
+		}
 		cleanupQueue()
 		return nil, err
 	}
+	setQueueSaturation(&r)
+
+	// Replications created while their org is over its egress quota start out paused like the org's others.
+	if err := s.egress.pauseIfOverQuota(ctx, r.OrgID, r.ID); err != nil {
+		s.log.Error("Failed to apply replication egress quota", zap.String("id", r.ID.String()), zap.Error(err))
+	}
 
 	return &r, nil
 }
@@ -200,7 +706,15 @@ func (s service) ValidateNewReplication(ctx context.Context, request influxdb.Cr
 		return errLocalBucketNotFound(request.LocalBucketID, err)
 	}
 
-	config := internal.ReplicationHTTPConfig{RemoteBucketID: request.RemoteBucketID}
+	config := internal.ReplicationHTTPConfig{
+		RemoteBucketID:        request.RemoteBucketID,
+		RemoteWritePrecision:  request.RemoteWritePrecision,
+		RemoteDatabase:        request.RemoteDatabase,
+		RemoteRetentionPolicy: request.RemoteRetentionPolicy,
+	}
+	if config.RemoteWritePrecision == "" {
+		config.RemoteWritePrecision = influxdb.WritePrecisionNanoseconds
+	}
 	if err := s.populateRemoteHTTPConfig(ctx, request.RemoteID, &config); err != nil {
 		return err
 	}
@@ -212,13 +726,38 @@ func (s service) ValidateNewReplication(ctx context.Context, request influxdb.Cr
 			Err:  err,
 		}
 	}
+
+	// Every additional destination has to be reachable too.
+	for _, d := range request.AdditionalDestinations {
+		destConfig := internal.ReplicationHTTPConfig{
+			RemoteBucketID:        d.RemoteBucketID,
+			RemoteWritePrecision:  config.RemoteWritePrecision,
+			RemoteDatabase:        config.RemoteDatabase,
+			RemoteRetentionPolicy: config.RemoteRetentionPolicy,
+		}
+		if err := s.populateRemoteHTTPConfig(ctx, d.RemoteID, &destConfig); err != nil {
+			return err
+		}
+		if err := s.validator.ValidateReplication(ctx, &destConfig); err != nil {
+			return &ierrors.Error{
+				Code: ierrors.EInvalid,
+				Msg:  fmt.Sprintf("replication parameters fail validation for destination remote %q", d.RemoteID),
+				Err:  err,
+			}
+		}
+	}
 	return nil
 }
 
 func (s service) GetReplication(ctx context.Context, id platform.ID) (*influxdb.Replication, error) {
 	q := sq.Select(
 		"id", "org_id", "name", "description", "remote_id", "local_bucket_id", "remote_bucket_id",
-		"max_queue_size_bytes", "latest_response_code", "latest_error_message", "drop_non_retryable_data").
+		"max_queue_size_bytes", "latest_response_code", "latest_error_message", "latest_status_at", "latest_success_at", "drop_non_retryable_data",
+		"enqueue_on_local_failure", "durability_tier", "serialized_enqueue", "delivered_bytes", "delivered_points", "consecutive_failures",
+		"remote_bucket_deleted_policy", "remote_bucket_missing", "ordered_delivery", "preserve_write_boundaries", "filter_expression", "durable_ack",
+		"paused", "paused_until", "watermark", "newest_delivered_point_ns", "remote_write_precision", "flush_interval_seconds", "compression",
+		"remote_capabilities", "remote_bucket_tag", "remote_bucket_mapping", "block_on_full_queue", "timestamp_offset_seconds", "measurement_filter", "tag_filter",
+		"retry_interval_seconds", "max_retry_interval_seconds", "fanout_parent_id", "dead_letter_bucket_id", "dead_lettered_points", "remote_database", "remote_retention_policy", "downsample", "rename_rules").
 		From("replications").
 		Where(sq.Eq{"id": id})
 
@@ -235,19 +774,74 @@ func (s service) GetReplication(ctx context.Context, id platform.ID) (*influxdb.
 		return nil, err
 	}
 
-	sizes, err := s.durableQueueManager.CurrentQueueSizes([]platform.ID{r.ID})
+	destinations, destinationIDs, err := s.destinations(ctx, []platform.ID{r.ID})
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := s.durableQueueManager.CurrentQueueSizes(append([]platform.ID{r.ID}, destinationIDs...))
 	if err != nil {
 		return nil, err
 	}
 	r.CurrentQueueSizeBytes = sizes[r.ID]
+	stats, err := s.durableQueueManager.QueueStats(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	r.EnqueueRatePointsPerSecond = stats.EnqueueRate
+	r.SendRatePointsPerSecond = stats.SendRate
+	setQueueSaturation(&r)
+	setStatusReason(&r)
+	now := time.Now()
+	markStaleStatus(&r, now, s.staleStatusThreshold)
+	clearExpiredPause(&r, now)
+	setReplicationLag(&r, now)
+	s.errorRates.setErrorRate(&r, now)
+	s.unwritable.setQueueUnwritable(&r)
+	setNextRetryAt(&r, s.nextRetryTimes([]platform.ID{r.ID}))
+	s.setHealth(&r, now)
+	setDestinations(&r, destinations, sizes)
 
 	return &r, nil
 }
 
+// validateMaxQueueSize checks the max queue size of a replication against the smallest queue that can hold its
+// segments, and the configured limit on queue sizes if there is one.
+func (s service) validateMaxQueueSize(maxQueueSizeBytes int64) error {
+	if maxQueueSizeBytes < influxdb.MinReplicationMaxQueueSizeBytes {
+		return &influxdb.ErrMaxQueueSizeTooSmall
+	}
+	if s.maxQueueSizeLimit > 0 && maxQueueSizeBytes > s.maxQueueSizeLimit {
+		return &ierrors.Error{
+			Code: ierrors.EInvalid,
+			Msg:  fmt.Sprintf("maxQueueSize too large, must be at most %d", s.maxQueueSizeLimit),
+		}
+	}
+	return nil
+}
+
 func (s service) UpdateReplication(ctx context.Context, id platform.ID, request influxdb.UpdateReplicationRequest) (*influxdb.Replication, error) {
+	if request.DeadLetterBucketID != nil {
+		s.bucketService.RLock()
+		defer s.bucketService.RUnlock()
+		if err := s.checkUpdatedDeadLetterBucket(ctx, id, *request.DeadLetterBucketID); err != nil {
+			return nil, err
+		}
+	}
+
 	s.store.Mu.Lock()
 	defer s.store.Mu.Unlock()
 
+	r, err := s.updateReplication(ctx, id, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateDestinations(ctx, r, request); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s service) updateReplication(ctx context.Context, id platform.ID, request influxdb.UpdateReplicationRequest) (*influxdb.Replication, error) {
 	updates := sq.Eq{"updated_at": sq.Expr("datetime('now')")}
 	if request.Name != nil {
 		updates["name"] = *request.Name
@@ -257,19 +851,151 @@ func (s service) UpdateReplication(ctx context.Context, id platform.ID, request
 	}
 	if request.RemoteID != nil {
 		updates["remote_id"] = *request.RemoteID
+		// The new remote is probed afresh.
+		updates["remote_capabilities"] = nil
 	}
 	if request.RemoteBucketID != nil {
 		updates["remote_bucket_id"] = *request.RemoteBucketID
 	}
 	if request.MaxQueueSizeBytes != nil {
+		if err := s.validateMaxQueueSize(*request.MaxQueueSizeBytes); err != nil {
+			return nil, err
+		}
 		updates["max_queue_size_bytes"] = *request.MaxQueueSizeBytes
 	}
 	if request.DropNonRetryableData != nil {
 		updates["drop_non_retryable_data"] = *request.DropNonRetryableData
 	}
+	if request.EnqueueOnLocalFailure != nil {
+		updates["enqueue_on_local_failure"] = *request.EnqueueOnLocalFailure
+	}
+	if request.DurabilityTier != nil {
+		updates["durability_tier"] = *request.DurabilityTier
+	}
+	if request.SerializedEnqueue != nil {
+		updates["serialized_enqueue"] = *request.SerializedEnqueue
+	}
+	if request.RemoteBucketDeletedPolicy != nil {
+		updates["remote_bucket_deleted_policy"] = *request.RemoteBucketDeletedPolicy
+	}
+	if request.OrderedDelivery != nil {
+		updates["ordered_delivery"] = *request.OrderedDelivery
+	}
+	if request.PreserveWriteBoundaries != nil {
+		updates["preserve_write_boundaries"] = *request.PreserveWriteBoundaries
+	}
+	if request.FilterExpression != nil {
+		// An empty expression removes the filter.
+		var filterExpression *string
+		if *request.FilterExpression != "" {
+			if _, err := s.filters.get(request.FilterExpression); err != nil {
+				return nil, err
+			}
+			filterExpression = request.FilterExpression
+		}
+		updates["filter_expression"] = filterExpression
+	}
+	if request.MeasurementFilter != nil {
+		// An empty filter removes it.
+		var measurementFilter *string
+		if *request.MeasurementFilter != "" {
+			if _, err := s.filters.getMeasurementFilter(request.MeasurementFilter); err != nil {
+				return nil, err
+			}
+			measurementFilter = request.MeasurementFilter
+		}
+		updates["measurement_filter"] = measurementFilter
+	}
+	if request.TagFilter != nil {
+		if err := request.TagFilter.OK(); err != nil {
+			return nil, err
+		}
+		// An empty filter removes it; its Value is NULL.
+		updates["tag_filter"] = request.TagFilter
+	}
+	if request.DurableAck != nil {
+		updates["durable_ack"] = *request.DurableAck
+	}
+	if request.BlockOnFullQueue != nil {
+		updates["block_on_full_queue"] = *request.BlockOnFullQueue
+	}
+	if request.TimestampOffsetSeconds != nil {
+		updates["timestamp_offset_seconds"] = *request.TimestampOffsetSeconds
+	}
+	if request.RemoteWritePrecision != nil {
+		updates["remote_write_precision"] = *request.RemoteWritePrecision
+	}
+	if request.FlushIntervalSeconds != nil {
+		updates["flush_interval_seconds"] = *request.FlushIntervalSeconds
+	}
+	if request.RetryIntervalSeconds != nil {
+		updates["retry_interval_seconds"] = *request.RetryIntervalSeconds
+	}
+	if request.MaxRetryIntervalSeconds != nil {
+		updates["max_retry_interval_seconds"] = *request.MaxRetryIntervalSeconds
+	}
+	if request.Compression != nil {
+		updates["compression"] = *request.Compression
+	}
+	if request.RemoteBucketMapping != nil {
+		updates["remote_bucket_mapping"] = request.RemoteBucketMapping
+	}
+	if request.RemoteBucketTag != nil {
+		// An empty tag removes the routing.
+		if *request.RemoteBucketTag == "" {
+			updates["remote_bucket_tag"] = nil
+			updates["remote_bucket_mapping"] = nil
+		} else {
+			updates["remote_bucket_tag"] = *request.RemoteBucketTag
+		}
+	}
+	if request.DeadLetterBucketID != nil {
+		updates["dead_letter_bucket_id"] = *request.DeadLetterBucketID
+	} else if request.RemoveDeadLetterBucket {
+		updates["dead_letter_bucket_id"] = nil
+	}
+	if request.RemoteDatabase != nil {
+		// An empty database removes it.
+		var database *string
+		if *request.RemoteDatabase != "" {
+			database = request.RemoteDatabase
+		}
+		updates["remote_database"] = database
+	}
+	if request.RemoteRetentionPolicy != nil {
+		// An empty retention policy goes back to the database's default one.
+		var rp *string
+		if *request.RemoteRetentionPolicy != "" {
+			rp = request.RemoteRetentionPolicy
+		}
+		updates["remote_retention_policy"] = rp
+	}
+	if request.Downsample != nil {
+		// The zero value removes the downsampling.
+		var downsample *influxdb.ReplicationDownsample
+		if !request.Downsample.IsZero() {
+			downsample = request.Downsample
+		}
+		updates["downsample"] = downsample
+	}
+	if request.RenameRules != nil {
+		if err := request.RenameRules.OK(); err != nil {
+			return nil, err
+		}
+		// Empty rules remove them; their Value is NULL.
+		updates["rename_rules"] = request.RenameRules
+	}
+	if request.Watermark != nil {
+		// The zero time removes the watermark.
+		var watermark *time.Time
+		if !request.Watermark.IsZero() {
+			watermark = request.Watermark
+		}
+		updates["watermark"] = watermark
+	}
 
 	q := sq.Update("replications").SetMap(updates).Where(sq.Eq{"id": id}).
-		Suffix("RETURNING id, org_id, name, description, remote_id, local_bucket_id, remote_bucket_id, max_queue_size_bytes, drop_non_retryable_data")
+		Suffix("RETURNING id, org_id, name, description, remote_id, local_bucket_id, remote_bucket_id, max_queue_size_bytes, drop_non_retryable_data, enqueue_on_local_failure, durability_tier, serialized_enqueue, remote_bucket_deleted_policy, remote_bucket_missing, ordered_delivery, preserve_write_boundaries, filter_expression, durable_ack, paused, paused_until, watermark, remote_write_precision, flush_interval_seconds, compression, remote_capabilities, remote_bucket_tag, remote_bucket_mapping, block_on_full_queue, timestamp_offset_seconds, measurement_filter, tag_filter, retry_interval_seconds, max_retry_interval_seconds, fanout_parent_id, dead_letter_bucket_id, remote_database, remote_retention_policy, downsample, rename_rules")
 
 	query, args, err := q.ToSql()
 	if err != nil {
@@ -284,9 +1010,32 @@ func (s service) UpdateReplication(ctx context.Context, id platform.ID, request
 		if sqlErr, ok := err.(sqlite3.Error); ok && request.RemoteID != nil && sqlErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
 			return nil, errRemoteNotFound(*request.RemoteID, err)
 		}
+		if sqlErr, ok := err.(sqlite3.Error); ok && request.Name != nil && sqlErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, errReplicationNameTaken(*request.Name, err)
+		}
 		return nil, err
 	}
 
+	s.configCache.invalidateReplication(id)
+	s.inFlight.forget(id)
+
+	if request.OrderedDelivery != nil {
+		if err := s.durableQueueManager.SetOrderedDelivery(id, *request.OrderedDelivery); err != nil {
+			return nil, err
+		}
+	}
+	if request.FlushIntervalSeconds != nil {
+		if err := s.durableQueueManager.SetFlushInterval(id, time.Duration(*request.FlushIntervalSeconds)*time.Second); err != nil {
+			return nil, err
+		}
+	}
+	if request.RetryIntervalSeconds != nil || request.MaxRetryIntervalSeconds != nil {
+		if err := s.durableQueueManager.SetRetryBackoff(id, time.Duration(r.RetryIntervalSeconds)*time.Second,
+			time.Duration(r.MaxRetryIntervalSeconds)*time.Second); err != nil {
+			return nil, err
+		}
+	}
+
 	if request.MaxQueueSizeBytes != nil {
 		if err := s.durableQueueManager.UpdateMaxQueueSize(id, *request.MaxQueueSizeBytes); err != nil {
 			s.log.Warn("actual max queue size does not match the max queue size recorded in database", zap.String("id", id.String()))
@@ -294,11 +1043,15 @@ func (s service) UpdateReplication(ctx context.Context, id platform.ID, request
 		}
 	}
 
+	// Give replications paused because their remote bucket was missing another try.
+	s.remoteBuckets.resume(id)
+
 	sizes, err := s.durableQueueManager.CurrentQueueSizes([]platform.ID{r.ID})
 	if err != nil {
 		return nil, err
 	}
 	r.CurrentQueueSizeBytes = sizes[r.ID]
+	setQueueSaturation(&r)
 
 	return &r, nil
 }
@@ -311,6 +1064,15 @@ func (s service) ValidateUpdatedReplication(ctx context.Context, id platform.ID,
 	if request.RemoteBucketID != nil {
 		baseConfig.RemoteBucketID = *request.RemoteBucketID
 	}
+	if request.RemoteWritePrecision != nil {
+		baseConfig.RemoteWritePrecision = *request.RemoteWritePrecision
+	}
+	if request.RemoteDatabase != nil {
+		baseConfig.RemoteDatabase = request.RemoteDatabase
+	}
+	if request.RemoteRetentionPolicy != nil {
+		baseConfig.RemoteRetentionPolicy = request.RemoteRetentionPolicy
+	}
 
 	if request.RemoteID != nil {
 		if err := s.populateRemoteHTTPConfig(ctx, *request.RemoteID, baseConfig); err != nil {
@@ -332,27 +1094,48 @@ func (s service) DeleteReplication(ctx context.Context, id platform.ID) error {
 	s.store.Mu.Lock()
 	defer s.store.Mu.Unlock()
 
-	q := sq.Delete("replications").Where(sq.Eq{"id": id}).Suffix("RETURNING id")
+	return s.deleteReplication(ctx, id)
+}
+
+// deleteReplication deletes a replication along with its additional destinations, and their queues.
+func (s service) deleteReplication(ctx context.Context, id platform.ID) error {
+	q := sq.Delete("replications").Where(sq.Or{sq.Eq{"id": id}, sq.Eq{"fanout_parent_id": id}}).Suffix("RETURNING id")
 	query, args, err := q.ToSql()
 	if err != nil {
 		return err
 	}
 
-	var d platform.ID
-	if err := s.store.DB.GetContext(ctx, &d, query, args...); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errReplicationNotFound
-		}
+	var deleted []platform.ID
+	if err := s.store.DB.SelectContext(ctx, &deleted, query, args...); err != nil {
 		return err
 	}
+	if len(deleted) == 0 {
+		return errReplicationNotFound
+	}
 
-	if err := s.durableQueueManager.DeleteQueue(id); err != nil {
-		return err
+	for _, d := range deleted {
+		s.forgetReplication(d)
+
+		if err := s.durableQueueManager.DeleteQueue(d); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// forgetReplication drops the state kept in memory for a replication which was deleted.
+func (s service) forgetReplication(id platform.ID) {
+	s.configCache.invalidateReplication(id)
+	s.inFlight.forget(id)
+	s.queueSizing.forget(id)
+	s.errorRates.forget(id)
+	s.unwritable.forget(id)
+	s.webhooks.forget(id)
+	s.sequencers.forget(id)
+	s.egress.forget(id)
+}
+
 func (s service) DeleteBucketReplications(ctx context.Context, localBucketID platform.ID) error {
 	s.store.Mu.Lock()
 	defer s.store.Mu.Unlock()
@@ -374,8 +1157,10 @@ func (s service) DeleteBucketReplications(ctx context.Context, localBucketID pla
 		if err != nil {
 			s.log.Error("durable queue remaining on disk after deletion failure", zap.Error(err), zap.String("id", replication))
 			errOccurred = true
+			continue
 		}
 
+		s.forgetReplication(*id)
 		if err := s.durableQueueManager.DeleteQueue(*id); err != nil {
 			s.log.Error("durable queue remaining on disk after deletion failure", zap.Error(err), zap.String("id", replication))
 			errOccurred = true
@@ -392,85 +1177,1070 @@ func (s service) DeleteBucketReplications(ctx context.Context, localBucketID pla
 	return nil
 }
 
-func (s service) ValidateReplication(ctx context.Context, id platform.ID) error {
-	config, err := s.getFullHTTPConfig(ctx, id)
+// DeleteOrgReplications deletes every replication of an org, along with their queues, i.e. when offboarding a
+// tenant. The replications are deleted even if some of their queues can't be; the error lists those replications,
+// so their queue directories can be cleaned up by hand.
+func (s service) DeleteOrgReplications(ctx context.Context, orgID platform.ID) error {
+	s.store.Mu.Lock()
+	defer s.store.Mu.Unlock()
+
+	q := sq.Delete("replications").Where(sq.Eq{"org_id": orgID}).Suffix("RETURNING id")
+	query, args, err := q.ToSql()
 	if err != nil {
 		return err
 	}
-	if err := s.validator.ValidateReplication(ctx, config); err != nil {
+
+	var deleted []platform.ID
+	if err := s.store.DB.SelectContext(ctx, &deleted, query, args...); err != nil {
+		return err
+	}
+
+	var remaining []string
+	for _, id := range deleted {
+		s.forgetReplication(id)
+		if err := s.durableQueueManager.DeleteQueue(id); err != nil {
+			s.log.Error("durable queue remaining on disk after deletion failure", zap.Error(err), zap.String("id", id.String()))
+			remaining = append(remaining, id.String())
+		}
+	}
+
+	s.log.Debug("Deleted all replications for org",
+		zap.String("org_id", orgID.String()), zap.Int("count", len(deleted)))
+
+	if len(remaining) > 0 {
+		return fmt.Errorf("deleted replications for org %q, but the durable queues of %d of them remain on disk: %s, see server logs for details",
+			orgID, len(remaining), strings.Join(remaining, ", "))
+	}
+	return nil
+}
+
+// OnRemoteDeleting is called by the remotes service before a remote is deleted. If cascade is true, all
+// replications to the remote are deleted along with their queues. Otherwise, the delete is refused while any
+// replications to the remote exist, rather than leaving them to be silently removed by the database.
+func (s service) OnRemoteDeleting(ctx context.Context, remoteID platform.ID, cascade bool) error {
+	s.store.Mu.Lock()
+	defer s.store.Mu.Unlock()
+
+	if !cascade {
+		q := sq.Select("id").From("replications").Where(sq.Eq{"remote_id": remoteID})
+		query, args, err := q.ToSql()
+		if err != nil {
+			return err
+		}
+
+		var ids []platform.ID
+		if err := s.store.DB.SelectContext(ctx, &ids, query, args...); err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			return errRemoteInUse(remoteID, ids)
+		}
+		return nil
+	}
+
+	// Destinations of replications to the remote go with them.
+	q := sq.Delete("replications").
+		Where(sq.Or{
+			sq.Eq{"remote_id": remoteID},
+			sq.Expr("fanout_parent_id IN (SELECT id FROM replications WHERE remote_id = ?)", remoteID),
+		}).
+		Suffix("RETURNING id")
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var deleted []platform.ID
+	if err := s.store.DB.SelectContext(ctx, &deleted, query, args...); err != nil {
+		return err
+	}
+
+	errOccurred := false
+	for _, id := range deleted {
+		s.forgetReplication(id)
+		if err := s.durableQueueManager.DeleteQueue(id); err != nil {
+			s.log.Error("durable queue remaining on disk after deletion failure", zap.Error(err), zap.String("id", id.String()))
+			errOccurred = true
+		}
+	}
+
+	s.log.Debug("Deleted all replications for remote", zap.String("remote_id", remoteID.String()), zap.Int("count", len(deleted)))
+
+	if errOccurred {
+		return fmt.Errorf("deleting replications for remote %q failed, see server logs for details", remoteID)
+	}
+	return nil
+}
+
+// ResetReplicationStats zeroes the cumulative delivery and failure counters of a replication,
+// without touching its configuration or queued data.
+func (s service) ResetReplicationStats(ctx context.Context, id platform.ID) error {
+	s.store.Mu.Lock()
+	defer s.store.Mu.Unlock()
+
+	q := sq.Update("replications").
+		SetMap(sq.Eq{
+			"delivered_bytes":      0,
+			"delivered_points":     0,
+			"consecutive_failures": 0,
+		}).
+		Where(sq.Eq{"id": id}).
+		Suffix("RETURNING id")
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var d platform.ID
+	if err := s.store.DB.GetContext(ctx, &d, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errReplicationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// PauseReplication stops a replication from sending data to its remote, while still queueing points written
+// to its local bucket. If until is set, the replication resumes automatically at that time; otherwise it stays
+// paused until ResumeReplication is called. The pause is persisted, and restored when the service is reopened.
+func (s service) PauseReplication(ctx context.Context, id platform.ID, until *time.Time) error {
+	ids, err := s.setPaused(ctx, id, true, until)
+	if err != nil {
+		return err
+	}
+	for _, d := range ids {
+		if until != nil {
+			err = s.durableQueueManager.PauseQueueUntil(d, *until)
+		} else {
+			err = s.durableQueueManager.PauseQueue(d)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResumeReplication restarts a paused replication, immediately sending any data queued while it was paused.
+func (s service) ResumeReplication(ctx context.Context, id platform.ID) error {
+	ids, err := s.setPaused(ctx, id, false, nil)
+	if err != nil {
+		return err
+	}
+	for _, d := range ids {
+		if err := s.durableQueueManager.ResumeQueue(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPaused records whether a replication and its additional destinations are paused, returning their IDs.
+func (s service) setPaused(ctx context.Context, id platform.ID, paused bool, until *time.Time) ([]platform.ID, error) {
+	s.store.Mu.Lock()
+	defer s.store.Mu.Unlock()
+
+	q := sq.Update("replications").
+		SetMap(sq.Eq{
+			"paused":       paused,
+			"paused_until": until,
+			"updated_at":   sq.Expr("datetime('now')"),
+		}).
+		Where(sq.Or{sq.Eq{"id": id}, sq.Eq{"fanout_parent_id": id}}).
+		Suffix("RETURNING id")
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []platform.ID
+	if err := s.store.DB.SelectContext(ctx, &ids, query, args...); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errReplicationNotFound
+	}
+	return ids, nil
+}
+
+// clearExpiredPause reports a replication whose pause has passed its deadline as resumed, since its queue
+// resumed sending automatically at the deadline.
+func clearExpiredPause(r *influxdb.Replication, now time.Time) {
+	if r.Paused && r.PausedUntil != nil && !now.Before(*r.PausedUntil) {
+		r.Paused = false
+		r.PausedUntil = nil
+	}
+}
+
+func (s service) ValidateReplication(ctx context.Context, id platform.ID) error {
+	if err := s.validateReplication(ctx, id); err != nil {
+		return err
+	}
+
+	// The additional destinations of a replication are validated along with it.
+	destinationIDs, err := s.destinationIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, d := range destinationIDs {
+		if err := s.validateReplication(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s service) validateReplication(ctx context.Context, id platform.ID) error {
+	config, err := s.getFullHTTPConfig(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.validator.ValidateReplication(ctx, config)
+	// Validating a replication refreshes its status, i.e. after it went stale while the replication was idle.
+	s.stats.recordValidation(ctx, id, err)
+	if err != nil {
 		return &ierrors.Error{
 			Code: ierrors.EInvalid,
 			Msg:  "replication failed validation",
 			Err:  err,
 		}
 	}
+	// Valid replications have their remote's capabilities re-detected.
+	s.capabilities.refresh(ctx, id, config)
 	return nil
 }
 
+// maxConcurrentValidations bounds the number of replications ValidateReplications validates at once.
+const maxConcurrentValidations = 8
+
+// ValidateReplications validates a batch of replications against their remotes, up to maxConcurrentValidations at
+// a time. The error validating each replication is returned keyed by its ID, with a nil error for valid ones.
+//
+// Cancelling ctx abandons the batch promptly: no more validations are started, and the requests of those
+// already running are interrupted. Every replication whose validation didn't finish gets the context's error.
+func (s service) ValidateReplications(ctx context.Context, ids []platform.ID) map[platform.ID]error {
+	results := make(map[platform.ID]error, len(ids))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentValidations)
+
+	for i, id := range ids {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			mu.Lock()
+			for _, id := range ids[i:] {
+				results[id] = ctx.Err()
+			}
+			mu.Unlock()
+			break
+		}
+
+		wg.Add(1)
+		go func(id platform.ID) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			err := s.ValidateReplication(ctx, id)
+			if err != nil && ctx.Err() != nil {
+				// The failure is down to the batch being abandoned, not the replication.
+				err = ctx.Err()
+			}
+			mu.Lock()
+			results[id] = err
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return results
+}
+
+// maxConcurrentValidationsPerRemote bounds the number of replications sharing a remote which
+// ValidateAllReplications validates at once, so a remote used by many replications isn't flooded with probes.
+const maxConcurrentValidationsPerRemote = 2
+
+// ValidateAllReplications validates every replication of an org against its remote, up to
+// maxConcurrentValidations at a time, and up to maxConcurrentValidationsPerRemote at a time for each remote.
+// Replications are grouped by their remote; any additional destinations are validated along with them. The
+// error validating each replication is returned keyed by its ID, with a nil error for valid ones.
+//
+// Like ValidateReplications, cancelling ctx abandons the validations which haven't finished, with the context's
+// error as their result.
+func (s service) ValidateAllReplications(ctx context.Context, orgID platform.ID) (map[platform.ID]error, error) {
+	q := sq.Select("id", "remote_id").From("replications").
+		Where(sq.Eq{"org_id": orgID, "fanout_parent_id": nil})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rs []struct {
+		ID       platform.ID `db:"id"`
+		RemoteID platform.ID `db:"remote_id"`
+	}
+	if err := s.store.DB.SelectContext(ctx, &rs, query, args...); err != nil {
+		return nil, err
+	}
+
+	byRemote := make(map[platform.ID][]platform.ID)
+	for _, r := range rs {
+		byRemote[r.RemoteID] = append(byRemote[r.RemoteID], r.ID)
+	}
+
+	results := make(map[platform.ID]error, len(rs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentValidations)
+	validate := func(id platform.ID) error {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-sem }()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := s.ValidateReplication(ctx, id)
+		if err != nil && ctx.Err() != nil {
+			// The failure is down to the validations being abandoned, not the replication.
+			err = ctx.Err()
+		}
+		return err
+	}
+
+	// Each remote gets its own workers, which take turns validating its replications.
+	for _, ids := range byRemote {
+		queue := make(chan platform.ID, len(ids))
+		for _, id := range ids {
+			queue <- id
+		}
+		close(queue)
+
+		workers := maxConcurrentValidationsPerRemote
+		if len(ids) < workers {
+			workers = len(ids)
+		}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for id := range queue {
+					err := validate(id)
+					mu.Lock()
+					results[id] = err
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return results, nil
+}
+
 func (s service) WritePoints(ctx context.Context, orgID platform.ID, bucketID platform.ID, points []models.Point) error {
-	q := sq.Select("id").From("replications").Where(sq.Eq{"org_id": orgID, "local_bucket_id": bucketID})
+	// Writes with nothing in them, i.e. because all of their points were filtered out, have nothing to
+	// persist or replicate.
+	if len(points) == 0 {
+		return nil
+	}
+
+	q := sq.Select("id", "enqueue_on_local_failure", "durability_tier", "serialized_enqueue", "preserve_write_boundaries", "filter_expression", "durable_ack", "compression",
+		"remote_bucket_tag", "block_on_full_queue", "timestamp_offset_seconds", "measurement_filter", "tag_filter").
+		From("replications").
+		Where(sq.Eq{"org_id": orgID, "local_bucket_id": bucketID})
 	query, args, err := q.ToSql()
 	if err != nil {
 		return err
 	}
 
-	var ids []platform.ID
-	if err := s.store.DB.SelectContext(ctx, &ids, query, args...); err != nil {
+	var targets []replicationTarget
+	if err := s.store.DB.SelectContext(ctx, &targets, query, args...); err != nil {
 		return err
 	}
 
+	localWriteEnabled := s.localWrites.enabled(bucketID)
+
 	// If there are no registered replications, all we need to do is a local write.
-	if len(ids) == 0 {
+	if len(targets) == 0 {
+		if !localWriteEnabled {
+			return errLocalWriteDisabled(bucketID)
+		}
 		return s.localWriter.WritePoints(ctx, orgID, bucketID, points)
 	}
 
+	// Points without fields would be serialized into invalid line protocol, poisoning the batches they're
+	// enqueued in. They're left out of replication, or fail the whole write if they're rejected. Local storage
+	// still gets the write as it was made.
+	localPoints := points
+	points, err = s.replicablePoints(targets, points)
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		// With local writes disabled, the write would go nowhere.
+		if !localWriteEnabled {
+			return errLocalWriteDisabled(bucketID)
+		}
+		return s.localWriter.WritePoints(ctx, orgID, bucketID, localPoints)
+	}
+
+	// Small writes may be merged with concurrent writes to the same bucket, once they're written locally.
+	if s.coalescer.canCoalesce(targets, len(points)) {
+		if localWriteEnabled {
+			if err := s.localWriter.WritePoints(ctx, orgID, bucketID, localPoints); err != nil {
+				return err
+			}
+		}
+		return s.coalescer.write(bucketID, targets, points)
+	}
+
+	failureTargets := localFailureTargets(targets)
+	var serializedIDs []platform.ID
+	for _, t := range targets {
+		if t.SerializedEnqueue {
+			serializedIDs = append(serializedIDs, t.ID)
+		}
+	}
+
+	// Take our place in line for replications which must receive blocks in the order writes arrived.
+	tickets := s.sequencers.acquire(serializedIDs)
+	defer s.sequencers.release(tickets)
+
 	// Concurrently...
-	var egroup errgroup.Group
-	var buf bytes.Buffer
-	gzw := gzip.NewWriter(&buf)
+	// 1. Write points to local TSM, unless local writes are disabled for maintenance
+	localErr := make(chan error, 1)
+	if localWriteEnabled {
+		go func() {
+			localErr <- s.localWriter.WritePoints(ctx, orgID, bucketID, localPoints)
+		}()
+	} else {
+		localErr <- nil
+	}
+	var localWaited bool
+	var localWriteErr error
+	waitLocal := func() error {
+		if !localWaited {
+			localWriteErr = <-localErr
+			localWaited = true
+		}
+		return localWriteErr
+	}
 
-	// 1. Write points to local TSM
-	egroup.Go(func() error {
-		return s.localWriter.WritePoints(ctx, orgID, bucketID, points)
-	})
-	// 2. Serialize points to gzipped line protocol, to be enqueued for replication if the local write succeeds.
-	//    We gzip the LP to take up less room on disk. On the other end of the queue, we can send the gzip data
-	//    directly to the remote API without needing to decompress it.
-	egroup.Go(func() error {
-		for _, p := range points {
-			if _, err := gzw.Write(append([]byte(p.PrecisionString("ns")), '\n')); err != nil {
-				_ = gzw.Close()
-				return fmt.Errorf("failed to serialize points for replication: %w", err)
+	// 2. Serialize points to compressed line protocol, to be enqueued for replication if the local write succeeds.
+	//    We compress the LP to take up less room on disk, with each replication's codec (gzip by default). On the
+	//    other end of the queue, we can send the compressed data directly to the remote API without needing to
+	//    decompress it.
+	//    If the local write fails, points are only enqueued into replications which opted in to replicating
+	//    through local failures.
+	//    If the serialization buffer is capped, blocks are flushed into the queues as soon as they're full, which
+	//    requires waiting for the local write to finish first.
+	//    Large uncapped writes can be sharded across a pool of serialization workers.
+	//    Failing to enqueue into a guaranteed-durability replication fails the write, so the client retries it.
+	//    Durable-ack replications make the write wait until the points are flushed to stable storage.
+	//    Replications blocking on a full queue make the write wait for room, for as long as its context allows.
+	//    Replications preserving write boundaries always get the whole write as a single block.
+	flushTo := func(targets, groupFailureTargets []replicationTarget) func(data []byte, n int) error {
+		return func(data []byte, n int) error {
+			if err := waitLocal(); err != nil {
+				if len(failureTargets) == 0 {
+					return err
+				}
+				return s.enqueue(ctx, groupFailureTargets, tickets, data, n)
+			}
+			return s.enqueue(ctx, targets, tickets, data, n)
+		}
+	}
+	serialize := func(points []models.Point, compression influxdb.ReplicationCompression, flush func(data []byte, n int) error, maxBufferBytes int) error {
+		if s.serializationWorkers > 1 && maxBufferBytes == 0 {
+			return serializePointsParallel(points, compression, s.serializationWorkers, flush)
+		}
+		return serializePoints(points, compression, maxBufferBytes, flush)
+	}
+	// Failing to enqueue into some replications doesn't stop the points being enqueued into the others. The
+	// replications which failed across the whole write are reported together.
+	var enqueueFailed *PartialEnqueueError
+	collectFailed := func(err error) error {
+		if pe, ok := err.(*PartialEnqueueError); ok {
+			enqueueFailed = enqueueFailed.add(pe)
+			return nil
+		}
+		return err
+	}
+	serializeGroup := func(points []models.Point, compression influxdb.ReplicationCompression, targets []replicationTarget) error {
+		groupFailureTargets := localFailureTargets(targets)
+		wholeTargets, splitTargets := partitionTargets(targets)
+		if s.maxSerializationBufferBytes == 0 || len(wholeTargets) == 0 {
+			return collectFailed(serialize(points, compression, flushTo(targets, groupFailureTargets), s.maxSerializationBufferBytes))
+		}
+		if len(splitTargets) > 0 {
+			// A write fitting in a single block is the same block whether or not it's split, so it's serialized
+			// once and enqueued into all of the group's replications.
+			_, splitFailureTargets := partitionTargets(groupFailureTargets)
+			flushSplit, flushAll := flushTo(splitTargets, splitFailureTargets), flushTo(targets, groupFailureTargets)
+			var wholeEnqueued bool
+			err := serialize(points, compression, func(data []byte, n int) error {
+				if n == len(points) {
+					wholeEnqueued = true
+					return flushAll(data, n)
+				}
+				return flushSplit(data, n)
+			}, s.maxSerializationBufferBytes)
+			if err := collectFailed(err); err != nil || wholeEnqueued {
+				return err
 			}
 		}
-		if err := gzw.Close(); err != nil {
+		wholeFailureTargets, _ := partitionTargets(groupFailureTargets)
+		return collectFailed(serialize(points, compression, flushTo(wholeTargets, wholeFailureTargets), 0))
+	}
+
+	// Replications with a measurement filter, tag filter or filter expression are sent only the points matching all of them, so each
+	// distinct combination of filters needs its own serialization pass, as does each distinct compression codec.
+	// Replications sharing a pass are all enqueued the same block, rather than a copy each.
+	// Replications of the same bucket with different filters each get only their own matching points. Writes with no matching points aren't
+	// enqueued at all. Replications routing points to remote buckets by a tag get the points for each bucket as
+	// a contiguous sub-batch of lines, which the sender posts to the bucket. Replications with a timestamp offset
+	// get the points shifted by it.
+	var serializeErr error
+	for _, group := range s.groupTargetsByFilter(targets) {
+		groupPoints := s.shiftGroupTimestamps(group, group.filter.filter(points))
+		if len(groupPoints) == 0 {
+			continue
+		}
+		if group.routeTag != "" {
+			groupPoints = groupPointsByTag(groupPoints, group.routeTag)
+		}
+		if serializeErr = serializeGroup(groupPoints, group.compression, group.targets); serializeErr != nil {
+			break
+		}
+	}
+	if serializeErr == nil && enqueueFailed != nil {
+		serializeErr = errEnqueueFailed(enqueueFailed)
+	}
+
+	if err := waitLocal(); err != nil {
+		if len(failureTargets) == 0 || serializeErr != nil {
 			return err
 		}
-		return nil
-	})
+		failureIDs := make([]platform.ID, len(failureTargets))
+		for i, t := range failureTargets {
+			failureIDs[i] = t.ID
+		}
+		return localWriteFailed(s.localFailurePolicy, err, failureIDs)
+	}
+	return serializeErr
+}
+
+// replicablePoints removes the points without fields from a write into the given replications, counting them as
+// dropped for each replication. If field-less points are rejected, writes containing any fail instead.
+func (s service) replicablePoints(targets []replicationTarget, points []models.Point) ([]models.Point, error) {
+	kept, skipped := withoutFieldlessPoints(points)
+	if skipped == 0 {
+		return points, nil
+	}
+	if s.rejectFieldlessPoints {
+		return nil, errFieldlessPoints(skipped)
+	}
+	s.log.Debug("Skipping points without fields for replication", zap.Int("skipped", skipped))
+	for _, t := range targets {
+		s.metrics.DroppedPoints.WithLabelValues(t.ID.String(), metrics.DropReasonNoFields).Add(float64(skipped))
+	}
+	return kept, nil
+}
 
-	if err := egroup.Wait(); err != nil {
+// replicationTarget is a replication which points written to its local bucket are enqueued into.
+type replicationTarget struct {
+	ID                      platform.ID                     `db:"id"`
+	EnqueueOnLocalFailure   bool                            `db:"enqueue_on_local_failure"`
+	DurabilityTier          influxdb.DurabilityTier         `db:"durability_tier"`
+	SerializedEnqueue       bool                            `db:"serialized_enqueue"`
+	PreserveWriteBoundaries bool                            `db:"preserve_write_boundaries"`
+	FilterExpression        *string                         `db:"filter_expression"`
+	DurableAck              bool                            `db:"durable_ack"`
+	Compression             influxdb.ReplicationCompression `db:"compression"`
+	RemoteBucketTag         *string                         `db:"remote_bucket_tag"`
+	BlockOnFullQueue        bool                            `db:"block_on_full_queue"`
+	TimestampOffsetSeconds  int64                           `db:"timestamp_offset_seconds"`
+	MeasurementFilter       *string                         `db:"measurement_filter"`
+	TagFilter               influxdb.ReplicationTagFilter   `db:"tag_filter"`
+}
+
+// enqueueFailsWrite returns whether a failure to enqueue a write's points into the replication fails the write,
+// rather than dropping them.
+func (t replicationTarget) enqueueFailsWrite() bool {
+	return t.DurabilityTier == influxdb.DurabilityGuaranteed || t.DurableAck || t.BlockOnFullQueue
+}
+
+// partitionTargets splits replications into those preserving write boundaries, and the rest.
+func partitionTargets(targets []replicationTarget) (whole, split []replicationTarget) {
+	for _, t := range targets {
+		if t.PreserveWriteBoundaries {
+			whole = append(whole, t)
+		} else {
+			split = append(split, t)
+		}
+	}
+	return whole, split
+}
+
+// enqueueData appends a block into the queue of a replication, giving up once the enqueue timeout passes.
+// An abandoned enqueue can't be cancelled, so it may still complete in the background.
+func (s service) enqueueData(id platform.ID, data []byte, points int) error {
+	if s.enqueueTimeout <= 0 {
+		return s.durableQueueManager.EnqueueData(id, data, points)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.durableQueueManager.EnqueueData(id, data, points)
+	}()
+
+	timer := time.NewTimer(s.enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
 		return err
+	case <-timer.C:
+		s.metrics.EnqueueTimeouts.WithLabelValues(id.String()).Inc()
+		return errEnqueueTimedOut(id, s.enqueueTimeout)
 	}
+}
 
-	// Enqueue the data into all registered replications.
-	var wg sync.WaitGroup
-	wg.Add(len(ids))
-	for _, id := range ids {
-		go func(id platform.ID) {
-			defer wg.Done()
-			if err := s.durableQueueManager.EnqueueData(id, buf.Bytes()); err != nil {
-				s.log.Error("Failed to enqueue points for replication", zap.String("id", id.String()), zap.Error(err))
+// defaultEnqueueConcurrency is the number of replications a block is enqueued into at once, unless configured
+// otherwise.
+const defaultEnqueueConcurrency = 16
+
+// defaultQueueFullRetryInterval is how often enqueues waiting for room in a full queue retry by default.
+const defaultQueueFullRetryInterval = 100 * time.Millisecond
+
+// waitForRoom wraps a function appending a block into the queue of a replication, so appends into a full queue
+// are retried as the sender drains it, until the context ends.
+func (s service) waitForRoom(ctx context.Context, enqueueData func(id platform.ID, data []byte, points int) error) func(id platform.ID, data []byte, points int) error {
+	return func(id platform.ID, data []byte, points int) error {
+		interval := s.queueFullRetryInterval
+		if interval <= 0 {
+			interval = defaultQueueFullRetryInterval
+		}
+		for {
+			err := enqueueData(id, data, points)
+			if !errors.Is(err, durablequeue.ErrQueueFull) {
+				return err
 			}
-		}(id)
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return errQueueFullWaitEnded(id, ctx.Err())
+			case <-timer.C:
+			}
+		}
 	}
-	wg.Wait()
+}
+
+// localFailureTargets returns the replications which points are enqueued into even if the local write fails.
+func localFailureTargets(targets []replicationTarget) []replicationTarget {
+	var failureTargets []replicationTarget
+	for _, t := range targets {
+		if t.EnqueueOnLocalFailure {
+			failureTargets = append(failureTargets, t)
+		}
+	}
+	return failureTargets
+}
+
+// filterGroup is a set of replications sharing the same filters, compression codec, remote bucket tag and
+// timestamp offset, which can be enqueued the same serialized blocks.
+type filterGroup struct {
+	// filter combines the measurement filter, tag filter and filter expression of the group's replications.
+	filter      *filterExpr
+	compression influxdb.ReplicationCompression
+	// routeTag, if set, is the tag the group's points are routed to remote buckets by.
+	routeTag        string
+	timestampOffset time.Duration
+	targets         []replicationTarget
+}
+
+// groupTargetsByFilter groups replications by their filters, compression codec, remote bucket tag and timestamp
+// offset, in the order each combination first appears. Replications whose filters fail to compile are skipped, since there's no telling
+// which points they're meant to receive. That can only happen if the expression was stored by a newer release.
+func (s service) groupTargetsByFilter(targets []replicationTarget) []filterGroup {
+	type groupKey struct {
+		filter      string
+		measurement string
+		tags        string
+		compression influxdb.ReplicationCompression
+		routeTag    string
+		offset      int64
+	}
+	var groups []filterGroup
+	index := make(map[groupKey]int)
+	for _, t := range targets {
+		key := groupKey{compression: t.Compression, offset: t.TimestampOffsetSeconds}
+		if t.FilterExpression != nil {
+			key.filter = *t.FilterExpression
+		}
+		if t.MeasurementFilter != nil {
+			key.measurement = *t.MeasurementFilter
+		}
+		key.tags = tagFilterString(t.TagFilter)
+		if t.RemoteBucketTag != nil {
+			key.routeTag = *t.RemoteBucketTag
+		}
+		if i, ok := index[key]; ok {
+			groups[i].targets = append(groups[i].targets, t)
+			continue
+		}
+
+		filter, err := s.filters.forTarget(t)
+		if err != nil {
+			s.log.Error("Failed to compile filters of replication, not enqueueing points",
+				zap.String("id", t.ID.String()), zap.Error(err))
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, filterGroup{
+			filter:          filter,
+			compression:     t.Compression,
+			routeTag:        key.routeTag,
+			timestampOffset: time.Duration(t.TimestampOffsetSeconds) * time.Second,
+			targets:         []replicationTarget{t},
+		})
+	}
+	return groups
+}
 
+// enqueue appends a block of data holding the given number of points into the durable queues of all given
+// replications. Each enqueue is traced as a child span of the span in ctx.
+//
+// Replications with different durability tiers may share a bucket. Each is handled according to its own tier:
+// best-effort replications drop the block if it can't be enqueued, while a failure to enqueue into any
+// guaranteed replication fails the write. The block is still enqueued into all other replications in that case,
+// so a retried write may deliver some points to them twice. Failures are returned for every tier, as a
+// PartialEnqueueError.
+//
+// Durable-ack replications wait for the block to be flushed to stable storage, without regard for the enqueue
+// timeout, and fail the write if that fails no matter their durability tier.
+//
+// Enqueues into replications with a ticket in tickets wait for their turn, see enqueueSequencers.
+func (s service) enqueue(ctx context.Context, targets []replicationTarget, tickets map[platform.ID]uint64, data []byte, points int) error {
+	if s.enqueueTimeout > 0 {
+		// Abandoned enqueues keep reading the block after we return, while the caller may reuse its buffer.
+		data = append([]byte(nil), data...)
+	}
+
+	var mu sync.Mutex
+	failed := &PartialEnqueueError{Failed: make(map[platform.ID]error)}
+	enqueueTarget := func(target replicationTarget) {
+		if err := s.enqueueTarget(ctx, target, tickets, data, points); err != nil {
+			mu.Lock()
+			failed.Failed[target.ID] = err
+			failed.failsWrite = failed.failsWrite || target.enqueueFailsWrite()
+			mu.Unlock()
+		}
+	}
+
+	// Replications are enqueued into by a pool of workers, rather than a goroutine each, so writes into buckets
+	// with many replications don't spawn hundreds of goroutines. A block for a single replication is enqueued
+	// without leaving this goroutine.
+	workers := s.enqueueConcurrency
+	if workers <= 0 {
+		workers = defaultEnqueueConcurrency
+	}
+	if len(targets) < workers {
+		workers = len(targets)
+	}
+	if workers <= 1 {
+		for _, target := range targets {
+			enqueueTarget(target)
+		}
+	} else {
+		queue := make(chan replicationTarget, len(targets))
+		for _, target := range targets {
+			queue <- target
+		}
+		close(queue)
+
+		var wg sync.WaitGroup
+		wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for target := range queue {
+					enqueueTarget(target)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	if len(failed.Failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// enqueueTarget enqueues a block into the queue of a single replication. Failures are logged and returned, and
+// counted as dropped points for replications whose failures don't fail the write.
+func (s service) enqueueTarget(ctx context.Context, target replicationTarget, tickets map[platform.ID]uint64, data []byte, points int) error {
+	id := target.ID
+	span, _ := tracing.StartSpanFromContextWithOperationName(ctx, "replication.enqueue."+id.String())
+	defer span.Finish()
+	span.SetTag("replication_id", id.String())
+	span.SetTag("bytes", len(data))
+	span.SetTag("points", points)
+
+	if ticket, ok := tickets[id]; ok {
+		if err := s.waitTurn(ctx, id, ticket); err != nil {
+			return s.enqueueFailed(span, target, points, err)
+		}
+	}
+
+	enqueueData := s.enqueueData
+	if target.DurableAck {
+		enqueueData = s.durableQueueManager.EnqueueDataSync
+	}
+	if target.BlockOnFullQueue {
+		enqueueData = s.waitForRoom(ctx, enqueueData)
+	}
+
+	var err error
+	if s.diskWatchdog.enqueuePaused() {
+		err = errEnqueuePausedLowDisk
+	} else {
+		err = enqueueData(id, data, points)
+	}
+	s.unwritable.record(id, err)
+	if err == nil {
+		s.queueSizing.enqueued(id, len(data))
+		return nil
+	}
+	return s.enqueueFailed(span, target, points, err)
+}
+
+// waitTurn waits for the turn of a serialized replication's ticket to enqueue, for no longer than the enqueue
+// timeout or the write's context allow.
+func (s service) waitTurn(ctx context.Context, id platform.ID, ticket uint64) error {
+	if s.enqueueTimeout <= 0 {
+		return s.sequencers.wait(ctx, id, ticket)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, s.enqueueTimeout)
+	defer cancel()
+	err := s.sequencers.wait(waitCtx, id, ticket)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		s.metrics.EnqueueTimeouts.WithLabelValues(id.String()).Inc()
+		return errEnqueueTimedOut(id, s.enqueueTimeout)
+	}
+	return err
+}
+
+// enqueueFailed handles a failure to enqueue a block into the queue of a replication, see enqueueTarget.
+func (s service) enqueueFailed(span opentracing.Span, target replicationTarget, points int, err error) error {
+	id := target.ID
+	ext.Error.Set(span, true)
+	_ = tracing.LogError(span, err)
+	s.log.Error("Failed to enqueue points for replication", zap.String("id", id.String()),
+		zap.String("durability_tier", string(target.DurabilityTier)), zap.Error(err))
+
+	if target.enqueueFailsWrite() {
+		return err
+	}
+	reason := metrics.DropReasonEnqueueFailed
+	switch {
+	case errors.Is(err, durablequeue.ErrQueueFull):
+		reason = metrics.DropReasonQueueFull
+	case errors.Is(err, internal.ErrQueueUnwritable):
+		reason = metrics.DropReasonQueueUnwritable
+	}
+	s.metrics.DroppedPoints.WithLabelValues(id.String(), reason).Add(float64(points))
+	return err
+}
+
+// SetLocalWriteEnabled toggles whether WritePoints persists points to local storage for the given bucket.
+// While disabled, points are still enqueued into the bucket's replications. The windows during which local
+// writes were disabled are tracked, and can be retrieved via LocalWriteGaps to backfill the local gap.
+func (s service) SetLocalWriteEnabled(ctx context.Context, bucketID platform.ID, enabled bool) error {
+	if err := s.localWrites.set(ctx, bucketID, enabled); err != nil {
+		return err
+	}
+	if enabled {
+		s.log.Info("Re-enabled local writes for bucket", zap.String("bucket_id", bucketID.String()))
+	} else {
+		s.log.Warn("Disabled local writes for bucket, points will only be enqueued for replication",
+			zap.String("bucket_id", bucketID.String()))
+	}
 	return nil
 }
 
+// LocalWriteGaps returns the windows of time during which local writes were disabled for the given bucket.
+func (s service) LocalWriteGaps(ctx context.Context, bucketID platform.ID) []LocalWriteGap {
+	return s.localWrites.gapsFor(bucketID)
+}
+
+// ClearLocalWriteGaps forgets the closed windows during which local writes were disabled for the given bucket,
+// i.e. once they have been backfilled. A window which is still open is kept.
+func (s service) ClearLocalWriteGaps(ctx context.Context, bucketID platform.ID) error {
+	return s.localWrites.clearGaps(ctx, bucketID)
+}
+
+// RemoteInFlightBytes returns the number of bytes currently being sent to the remote, across all of its replications.
+func (s service) RemoteInFlightBytes(ctx context.Context, remoteID platform.ID) int64 {
+	return s.inFlight.bytes(remoteID)
+}
+
+// EstimateTimeToFull projects when the queue of a replication will reach its max size, based on how fast it
+// grew over the recent window.
+func (s service) EstimateTimeToFull(ctx context.Context, id platform.ID) (*influxdb.ReplicationTimeToFull, error) {
+	q := sq.Select("max_queue_size_bytes").From("replications").Where(sq.Eq{"id": id})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var maxQueueSizeBytes int64
+	if err := s.store.DB.GetContext(ctx, &maxQueueSizeBytes, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errReplicationNotFound
+		}
+		return nil, err
+	}
+
+	sizes, err := s.durableQueueManager.CurrentQueueSizes([]platform.ID{id})
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &influxdb.ReplicationTimeToFull{
+		ReplicationID:         id,
+		CurrentQueueSizeBytes: sizes[id],
+		MaxQueueSizeBytes:     maxQueueSizeBytes,
+	}
+	if rate, ok := s.queueGrowth.rate(id); ok {
+		estimate.GrowthRateBytesPerSecond = rate
+		estimate.TimeToFull = timeToFull(estimate.CurrentQueueSizeBytes, maxQueueSizeBytes, rate)
+	}
+	estimate.Growing = estimate.TimeToFull != nil
+	return estimate, nil
+}
+
+// RecommendQueueSize suggests a max queue size for a replication which would have buffered all data enqueued
+// into it through the longest outage of its remote over the past week, with headroom, at the rate data was
+// enqueued over the same period.
+func (s service) RecommendQueueSize(ctx context.Context, id platform.ID) (*influxdb.ReplicationQueueSizeRecommendation, error) {
+	q := sq.Select("max_queue_size_bytes").From("replications").Where(sq.Eq{"id": id})
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var maxQueueSizeBytes int64
+	if err := s.store.DB.GetContext(ctx, &maxQueueSizeBytes, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errReplicationNotFound
+		}
+		return nil, err
+	}
+	return s.queueSizing.recommend(id, maxQueueSizeBytes), nil
+}
+
+// SchemaVersion reports the migration state of the metadata store holding replications, so deployment tooling
+// can check that all migrations known to this release have been applied.
+func (s service) SchemaVersion(ctx context.Context) (*influxdb.ReplicationsSchemaVersion, error) {
+	status, err := sqlite.NewMigrator(s.store, s.log).Status(ctx, migrations.AllUp)
+	if err != nil {
+		return nil, err
+	}
+	return &influxdb.ReplicationsSchemaVersion{
+		Version:           status.Version,
+		LatestVersion:     status.LatestVersion,
+		PendingMigrations: status.Pending,
+	}, nil
+}
+
+// GetOrgEgressUsage returns the number of bytes the org's replications have sent to remotes
+// during the current quota period.
+func (s service) GetOrgEgressUsage(ctx context.Context, orgID platform.ID) (*influxdb.OrgEgressUsage, error) {
+	return s.egress.usage(ctx, orgID)
+}
+
+// SetOrgEgressQuota sets the maximum number of bytes the org's replications may send to remotes
+// per period. Once the quota is exceeded, all of the org's replications are paused until the
+// period ends or the quota is raised. A nil quota removes the limit.
+func (s service) SetOrgEgressQuota(ctx context.Context, orgID platform.ID, quotaBytes *int64) error {
+	if quotaBytes != nil && *quotaBytes < 0 {
+		return &ierrors.Error{
+			Code: ierrors.EInvalid,
+			Msg:  "egress quota must not be negative",
+		}
+	}
+	return s.egress.setQuota(ctx, orgID, quotaBytes)
+}
+
+// redactedSecret replaces the value of secrets in configs returned to users.
+const redactedSecret = "[REDACTED]"
+
+// GetEffectiveConfig returns the fully-resolved configuration of a replication, as used by the sender
+// to write to its remote. The remote's API token is redacted.
+func (s service) GetEffectiveConfig(ctx context.Context, id platform.ID) (*influxdb.ReplicationEffectiveConfig, error) {
+	r, err := s.GetReplication(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := s.getFullHTTPConfig(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ec := &influxdb.ReplicationEffectiveConfig{
+		Replication:           *r,
+		RemoteURL:             conf.RemoteURL,
+		RemoteOrgID:           conf.RemoteOrgID,
+		AllowInsecureTLS:      conf.AllowInsecureTLS,
+		RemoteCertFingerprint: conf.RemoteCertFingerprint,
+		RemoteContentType:     conf.RemoteContentType,
+		RemoteWritePath:       conf.RemoteWritePath,
+		WriteTimeoutSeconds:   conf.WriteTimeoutSeconds,
+		ClientCert:            conf.ClientCert,
+		CACert:                conf.CACert,
+	}
+	if conf.ProxyURL != nil {
+		// The proxy's credentials, if any, are secret too.
+		proxyURL := *conf.ProxyURL
+		if u, err := url.Parse(proxyURL); err == nil {
+			proxyURL = u.Redacted()
+		}
+		ec.ProxyURL = &proxyURL
+	}
+	if conf.RemoteToken != "" {
+		ec.RemoteToken = redactedSecret
+	}
+	if conf.ClientKey != nil {
+		clientKey := redactedSecret
+		ec.ClientKey = &clientKey
+	}
+	if len(conf.RemoteHeaders) > 0 {
+		ec.RemoteHeaders = make(influxdb.RemoteHeaders, len(conf.RemoteHeaders))
+		for k := range conf.RemoteHeaders {
+			ec.RemoteHeaders[k] = redactedSecret
+		}
+	}
+	return ec, nil
+}
+
 func (s service) getFullHTTPConfig(ctx context.Context, id platform.ID) (*internal.ReplicationHTTPConfig, error) {
-	q := sq.Select("c.remote_url", "c.remote_api_token", "c.remote_org_id", "c.allow_insecure_tls", "r.remote_bucket_id").
+	if rc, ok := s.configCache.getReplication(id); ok {
+		return rc, nil
+	}
+
+	q := sq.Select("c.remote_url", "c.remote_api_token", "c.remote_org_id", "c.allow_insecure_tls", "c.remote_cert_fingerprint", "c.remote_content_type", "c.remote_write_path", "c.remote_headers", "c.proxy_url", "c.write_timeout_seconds", "c.client_cert", "c.client_key", "c.ca_cert", "c.remote_api_type", "c.remote_username", "c.remote_format", "r.remote_bucket_id",
+		"r.drop_non_retryable_data", "r.dead_letter_bucket_id", "r.remote_write_precision", "r.remote_capabilities",
+		"r.remote_bucket_tag", "r.remote_bucket_mapping", "r.remote_database", "r.remote_retention_policy", "r.downsample", "r.rename_rules", "r.remote_id").
 		From("replications r").InnerJoin("remotes c ON r.remote_id = c.id AND r.id = ?", id)
 
 	query, args, err := q.ToSql()
@@ -478,18 +2248,48 @@ func (s service) getFullHTTPConfig(ctx context.Context, id platform.ID) (*intern
 		return nil, err
 	}
 
-	var rc internal.ReplicationHTTPConfig
+	var rc struct {
+		internal.ReplicationHTTPConfig
+		RemoteID platform.ID `db:"remote_id"`
+	}
 	if err := s.store.DB.GetContext(ctx, &rc, query, args...); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errReplicationNotFound
 		}
 		return nil, err
 	}
-	return &rc, nil
+	if rc.RemoteToken, err = s.tokens.Decrypt(rc.RemoteToken); err != nil {
+		return nil, err
+	}
+	if rc.ClientKey, err = s.decryptClientKey(rc.ClientKey); err != nil {
+		return nil, err
+	}
+	s.configCache.putReplication(id, rc.RemoteID, rc.ReplicationHTTPConfig)
+	return &rc.ReplicationHTTPConfig, nil
 }
 
 func (s service) populateRemoteHTTPConfig(ctx context.Context, id platform.ID, target *internal.ReplicationHTTPConfig) error {
-	q := sq.Select("remote_url", "remote_api_token", "remote_org_id", "allow_insecure_tls").
+	if rc, ok := s.configCache.getRemote(id); ok {
+		target.RemoteURL = rc.RemoteURL
+		target.RemoteToken = rc.RemoteToken
+		target.RemoteOrgID = rc.RemoteOrgID
+		target.AllowInsecureTLS = rc.AllowInsecureTLS
+		target.RemoteCertFingerprint = rc.RemoteCertFingerprint
+		target.RemoteContentType = rc.RemoteContentType
+		target.RemoteWritePath = rc.RemoteWritePath
+		target.RemoteHeaders = rc.RemoteHeaders
+		target.ProxyURL = rc.ProxyURL
+		target.WriteTimeoutSeconds = rc.WriteTimeoutSeconds
+		target.ClientCert = rc.ClientCert
+		target.ClientKey = rc.ClientKey
+		target.CACert = rc.CACert
+		target.RemoteAPIType = rc.RemoteAPIType
+		target.RemoteUsername = rc.RemoteUsername
+		target.RemoteFormat = rc.RemoteFormat
+		return nil
+	}
+
+	q := sq.Select("remote_url", "remote_api_token", "remote_org_id", "allow_insecure_tls", "remote_cert_fingerprint", "remote_content_type", "remote_write_path", "remote_headers", "proxy_url", "write_timeout_seconds", "client_cert", "client_key", "ca_cert", "remote_api_type", "remote_username", "remote_format").
 		From("remotes").Where(sq.Eq{"id": id})
 	query, args, err := q.ToSql()
 	if err != nil {
@@ -502,16 +2302,64 @@ func (s service) populateRemoteHTTPConfig(ctx context.Context, id platform.ID, t
 		}
 		return err
 	}
+	if target.RemoteToken, err = s.tokens.Decrypt(target.RemoteToken); err != nil {
+		return err
+	}
+	if target.ClientKey, err = s.decryptClientKey(target.ClientKey); err != nil {
+		return err
+	}
+	s.configCache.putRemote(id, internal.ReplicationHTTPConfig{
+		RemoteURL:             target.RemoteURL,
+		RemoteToken:           target.RemoteToken,
+		RemoteOrgID:           target.RemoteOrgID,
+		AllowInsecureTLS:      target.AllowInsecureTLS,
+		RemoteCertFingerprint: target.RemoteCertFingerprint,
+		RemoteContentType:     target.RemoteContentType,
+		RemoteWritePath:       target.RemoteWritePath,
+		RemoteHeaders:         target.RemoteHeaders,
+		ProxyURL:              target.ProxyURL,
+		WriteTimeoutSeconds:   target.WriteTimeoutSeconds,
+		ClientCert:            target.ClientCert,
+		ClientKey:             target.ClientKey,
+		CACert:                target.CACert,
+		RemoteAPIType:         target.RemoteAPIType,
+		RemoteUsername:        target.RemoteUsername,
+		RemoteFormat:          target.RemoteFormat,
+	})
 
 	return nil
 }
 
+// decryptClientKey recovers the stored private key of a remote's client certificate, if it has one.
+func (s service) decryptClientKey(stored *string) (*string, error) {
+	if stored == nil {
+		return nil, nil
+	}
+	key, err := s.tokens.Decrypt(*stored)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// InvalidateRemoteHTTPConfigs drops the cached connection info of a remote, and of all replications
+// sending to it. It must be called whenever a remote is updated or deleted.
+func (s service) InvalidateRemoteHTTPConfigs(remoteID platform.ID) {
+	s.configCache.invalidateRemote(remoteID)
+}
+
+// PrometheusCollectors satisfies the prom.PrometheusCollector interface.
+func (s service) PrometheusCollectors() []prometheus.Collector {
+	return s.metrics.PrometheusCollectors()
+}
+
 func (s service) Open(ctx context.Context) error {
 	var trackedReplications influxdb.Replications
 
 	// Get replications from sqlite
 	q := sq.Select(
-		"id", "max_queue_size_bytes").
+		"id", "max_queue_size_bytes", "ordered_delivery", "paused", "paused_until", "flush_interval_seconds",
+		"retry_interval_seconds", "max_retry_interval_seconds").
 		From("replications")
 
 	query, args, err := q.ToSql()
@@ -532,12 +2380,73 @@ func (s service) Open(ctx context.Context) error {
 	if err := s.durableQueueManager.StartReplicationQueues(trackedReplicationsMap); err != nil {
 		return err
 	}
+
+	now := time.Now()
+	for _, r := range trackedReplications.Replications {
+		if r.OrderedDelivery {
+			if err := s.durableQueueManager.SetOrderedDelivery(r.ID, true); err != nil {
+				return err
+			}
+		}
+		if r.FlushIntervalSeconds > 0 {
+			if err := s.durableQueueManager.SetFlushInterval(r.ID, time.Duration(r.FlushIntervalSeconds)*time.Second); err != nil {
+				return err
+			}
+		}
+		if r.RetryIntervalSeconds > 0 {
+			if err := s.durableQueueManager.SetRetryBackoff(r.ID, time.Duration(r.RetryIntervalSeconds)*time.Second,
+				time.Duration(r.MaxRetryIntervalSeconds)*time.Second); err != nil {
+				return err
+			}
+		}
+		clearExpiredPause(&r, now)
+		if r.Paused {
+			var err error
+			if r.PausedUntil != nil {
+				err = s.durableQueueManager.PauseQueueUntil(r.ID, *r.PausedUntil)
+			} else {
+				err = s.durableQueueManager.PauseQueue(r.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.egress.restore(ctx); err != nil {
+		return err
+	}
+	if err := s.localWrites.restore(ctx); err != nil {
+		return err
+	}
+
+	if s.diskWatchdog != nil {
+		s.diskWatchdog.start()
+	}
+	if s.queueGrowth != nil {
+		s.queueGrowth.start()
+	}
+	if s.capabilities != nil {
+		s.capabilities.start()
+	}
+	s.egress.start()
 	return nil
 }
 
 func (s service) Close() error {
+	if s.diskWatchdog != nil {
+		s.diskWatchdog.stop()
+	}
+	if s.queueGrowth != nil {
+		s.queueGrowth.stop()
+	}
+	if s.capabilities != nil {
+		s.capabilities.stop()
+	}
+	s.egress.stop()
 	if err := s.durableQueueManager.CloseAll(); err != nil {
 		return err
 	}
-	return nil
+	s.webhooks.close()
+	// Persist the usage of the sends made until the queues were closed.
+	return s.egress.flush(context.Background())
 }
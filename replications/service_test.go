@@ -6,19 +6,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/golang/mock/gomock"
 	"github.com/influxdata/influxdb/v2"
 	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/influxdata/influxdb/v2/kit/prom"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
 	"github.com/influxdata/influxdb/v2/mock"
 	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/pkg/durablequeue"
+	"github.com/influxdata/influxdb/v2/remotes/tokencrypt"
 	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
 	replicationsMock "github.com/influxdata/influxdb/v2/replications/mock"
 	"github.com/influxdata/influxdb/v2/sqlite"
 	"github.com/influxdata/influxdb/v2/sqlite/migrations"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 )
 
@@ -40,6 +54,12 @@ var (
 		LocalBucketID:     platform.ID(1000),
 		RemoteBucketID:    platform.ID(99999),
 		MaxQueueSizeBytes: 3 * influxdb.DefaultReplicationMaxQueueSizeBytes,
+		DurabilityTier:    influxdb.DurabilityBestEffort,
+
+		RemoteBucketDeletedPolicy: influxdb.RemoteBucketDeletedPauseAndAlert,
+		RemoteWritePrecision:      influxdb.WritePrecisionNanoseconds,
+		RemainingQueueBytes:       3 * influxdb.DefaultReplicationMaxQueueSizeBytes,
+		Status:                    influxdb.ReplicationHealthy,
 	}
 	createReq = influxdb.CreateReplicationRequest{
 		OrgID:             replication.OrgID,
@@ -51,11 +71,12 @@ var (
 		MaxQueueSizeBytes: replication.MaxQueueSizeBytes,
 	}
 	httpConfig = internal.ReplicationHTTPConfig{
-		RemoteURL:        fmt.Sprintf("http://%s.cloud", replication.RemoteID),
-		RemoteToken:      replication.RemoteID.String(),
-		RemoteOrgID:      platform.ID(888888),
-		AllowInsecureTLS: true,
-		RemoteBucketID:   replication.RemoteBucketID,
+		RemoteURL:            fmt.Sprintf("http://%s.cloud", replication.RemoteID),
+		RemoteToken:          replication.RemoteID.String(),
+		RemoteOrgID:          platform.ID(888888),
+		AllowInsecureTLS:     true,
+		RemoteBucketID:       replication.RemoteBucketID,
+		RemoteWritePrecision: influxdb.WritePrecisionNanoseconds,
 	}
 	newRemoteID  = platform.ID(200)
 	newQueueSize = influxdb.MinReplicationMaxQueueSizeBytes
@@ -74,13 +95,19 @@ var (
 		RemoteBucketID:       replication.RemoteBucketID,
 		MaxQueueSizeBytes:    *updateReq.MaxQueueSizeBytes,
 		DropNonRetryableData: true,
+		DurabilityTier:       replication.DurabilityTier,
+		RemainingQueueBytes:  *updateReq.MaxQueueSizeBytes,
+
+		RemoteBucketDeletedPolicy: replication.RemoteBucketDeletedPolicy,
+		RemoteWritePrecision:      replication.RemoteWritePrecision,
 	}
 	updatedHttpConfig = internal.ReplicationHTTPConfig{
-		RemoteURL:        fmt.Sprintf("http://%s.cloud", updatedReplication.RemoteID),
-		RemoteToken:      updatedReplication.RemoteID.String(),
-		RemoteOrgID:      platform.ID(888888),
-		AllowInsecureTLS: true,
-		RemoteBucketID:   updatedReplication.RemoteBucketID,
+		RemoteURL:            fmt.Sprintf("http://%s.cloud", updatedReplication.RemoteID),
+		RemoteToken:          updatedReplication.RemoteID.String(),
+		RemoteOrgID:          platform.ID(888888),
+		AllowInsecureTLS:     true,
+		RemoteBucketID:       updatedReplication.RemoteBucketID,
+		RemoteWritePrecision: influxdb.WritePrecisionNanoseconds,
 	}
 )
 
@@ -169,6 +196,38 @@ func TestCreateMissingRemote(t *testing.T) {
 	require.Nil(t, got)
 }
 
+func TestDuplicateReplicationName(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock().Times(3)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(3)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(3)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), createReq.MaxQueueSizeBytes).Times(3)
+
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	// Creating a replication with a name already taken in the org fails, and cleans up its queue.
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID + 1)
+	created, err := svc.CreateReplication(ctx, createReq)
+	require.Equal(t, ierrors.EConflict, ierrors.ErrorCode(err))
+	require.Contains(t, err.Error(), fmt.Sprintf("a replication named %q already exists", createReq.Name))
+	require.Nil(t, created)
+
+	// So does renaming a replication to a taken name.
+	createReq2 := createReq
+	createReq2.Name = "test2"
+	_, err = svc.CreateReplication(ctx, createReq2)
+	require.NoError(t, err)
+	updated, err := svc.UpdateReplication(ctx, initID+2, influxdb.UpdateReplicationRequest{Name: &createReq.Name})
+	require.Equal(t, ierrors.EConflict, ierrors.ErrorCode(err))
+	require.Nil(t, updated)
+}
+
 func TestValidateReplicationWithoutPersisting(t *testing.T) {
 	t.Parallel()
 
@@ -235,6 +294,86 @@ func TestValidateReplicationWithoutPersisting(t *testing.T) {
 	})
 }
 
+func TestValidateReplications(t *testing.T) {
+	t.Parallel()
+
+	// createReplications registers n replications, returning their IDs.
+	createReplications := func(t *testing.T, svc *service, mocks mocks, n int) []platform.ID {
+		t.Helper()
+
+		mocks.bucketSvc.EXPECT().RLock().Times(n)
+		mocks.bucketSvc.EXPECT().RUnlock().Times(n)
+		mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(n)
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), createReq.MaxQueueSizeBytes).Times(n)
+		insertRemote(t, svc.store, createReq.RemoteID)
+
+		ids := make([]platform.ID, n)
+		for i := range ids {
+			req := createReq
+			req.Name = fmt.Sprintf("test%d", i)
+			r, err := svc.CreateReplication(ctx, req)
+			require.NoError(t, err)
+			ids[i] = r.ID
+		}
+		return ids
+	}
+
+	t.Run("results", func(t *testing.T) {
+		svc, mocks, clean := newTestService(t)
+		defer clean(t)
+
+		ids := createReplications(t, svc, mocks, 3)
+		mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).Return(errors.New("O NO"))
+
+		results := svc.ValidateReplications(ctx, append(ids, platform.ID(1000)))
+		require.Len(t, results, 4)
+		require.Equal(t, errReplicationNotFound, results[platform.ID(1000)])
+		var failed int
+		for _, id := range ids {
+			if err := results[id]; err != nil {
+				require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+				failed++
+			}
+		}
+		require.Equal(t, 1, failed)
+	})
+
+	t.Run("cancel mid-batch", func(t *testing.T) {
+		svc, mocks, clean := newTestService(t)
+		defer clean(t)
+
+		ids := createReplications(t, svc, mocks, 2*maxConcurrentValidations)
+
+		// Validations hang until they're interrupted by the context.
+		started := make(chan struct{}, len(ids))
+		mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ *internal.ReplicationHTTPConfig) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}).Times(maxConcurrentValidations)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			for i := 0; i < maxConcurrentValidations; i++ {
+				<-started
+			}
+			cancel()
+		}()
+
+		begin := time.Now()
+		results := svc.ValidateReplications(ctx, ids)
+		require.Less(t, time.Since(begin), 5*time.Second)
+
+		require.Len(t, results, len(ids))
+		for _, id := range ids {
+			require.Equal(t, context.Canceled, results[id], id)
+		}
+		require.Len(t, started, 0)
+	})
+}
+
 func TestUpdateAndGetReplication(t *testing.T) {
 	t.Parallel()
 
@@ -425,6 +564,65 @@ func TestValidateUpdatedReplicationWithoutPersisting(t *testing.T) {
 	})
 }
 
+func TestGetReplicationQueueRates(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	queues := replicationsMock.NewMockDurableQueueManager(gomock.NewController(t))
+	svc.durableQueueManager = queues
+	queues.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	queues.EXPECT().QueueStats(initID).Return(internal.QueueStats{EnqueueRate: 150, SendRate: 100}, nil)
+
+	got, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, 150.0, got.EnqueueRatePointsPerSecond)
+	require.Equal(t, 100.0, got.SendRatePointsPerSecond)
+}
+
+func TestGetEffectiveConfig(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).
+		Return(&influxdb.Bucket{}, nil)
+
+	// Getting the config of an invalid ID should return an error.
+	got, err := svc.GetEffectiveConfig(ctx, initID)
+	require.Equal(t, errReplicationNotFound, err)
+	require.Nil(t, got)
+
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err = svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).
+		Return(map[platform.ID]int64{initID: replication.CurrentQueueSizeBytes}, nil)
+	got, err = svc.GetEffectiveConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, influxdb.ReplicationEffectiveConfig{
+		Replication:      replication,
+		RemoteURL:        httpConfig.RemoteURL,
+		RemoteToken:      redactedSecret,
+		RemoteOrgID:      httpConfig.RemoteOrgID,
+		AllowInsecureTLS: httpConfig.AllowInsecureTLS,
+	}, *got)
+}
+
 func TestDeleteReplication(t *testing.T) {
 	t.Parallel()
 
@@ -500,6 +698,57 @@ func TestDeleteReplications(t *testing.T) {
 	require.Equal(t, createReq2.LocalBucketID, listed.Replications[0].LocalBucketID)
 }
 
+func TestDeleteOrgReplications(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	// Deleting when the org has no replications is OK.
+	require.NoError(t, svc.DeleteOrgReplications(ctx, replication.OrgID))
+
+	// Register replications across two buckets of the org, and one in another org.
+	createReq2, createReq3, otherOrgReq := createReq, createReq, createReq
+	createReq2.Name, createReq3.Name, otherOrgReq.Name = "test2", "test3", "other"
+	createReq2.LocalBucketID = platform.ID(77777)
+	createReq3.RemoteID = updatedReplication.RemoteID
+	otherOrgReq.OrgID = platform.ID(55555)
+	mocks.bucketSvc.EXPECT().RLock().Times(4)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(4)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(3)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq2.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	insertRemote(t, svc.store, createReq.RemoteID)
+	insertRemote(t, svc.store, createReq3.RemoteID)
+
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, createReq2, createReq3, otherOrgReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+
+	// All of the org's replications are deleted, even if some of their queues can't be. The error names the
+	// replications whose queues were left behind.
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID)
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID + 1).Return(errors.New("permission denied"))
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID + 2)
+	err := svc.DeleteOrgReplications(ctx, replication.OrgID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), (initID + 1).String())
+	require.NotContains(t, err.Error(), initID.String())
+
+	listed, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: replication.OrgID})
+	require.NoError(t, err)
+	require.Empty(t, listed.Replications)
+
+	// The other org's replication is untouched.
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID + 3}).
+		Return(map[platform.ID]int64{initID + 3: 0}, nil)
+	listed, err = svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: otherOrgReq.OrgID})
+	require.NoError(t, err)
+	require.Len(t, listed.Replications, 1)
+	require.Equal(t, otherOrgReq.Name, listed.Replications[0].Name)
+}
+
 func TestListReplications(t *testing.T) {
 	t.Parallel()
 
@@ -602,6 +851,43 @@ func TestListReplications(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, influxdb.Replications{}, *listed)
 	})
+
+	t.Run("paginated", func(t *testing.T) {
+		t.Parallel()
+
+		svc, mocks, clean := newTestService(t)
+		defer clean(t)
+		allRepls := setup(t, svc, mocks)
+
+		// Pages are counted across the whole listing.
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID + 2, initID + 1}).
+			Return(map[platform.ID]int64{initID + 1: 0, initID + 2: 0}, nil)
+		listed, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{
+			OrgID:      createReq.OrgID,
+			Limit:      2,
+			SortBy:     "name",
+			Descending: true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, influxdb.Replications{Replications: []influxdb.Replication{allRepls[2], allRepls[1]}, TotalCount: 3}, *listed)
+
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).
+			Return(map[platform.ID]int64{initID: 0}, nil)
+		listed, err = svc.ListReplications(ctx, influxdb.ReplicationListFilter{
+			OrgID:      createReq.OrgID,
+			Offset:     2,
+			SortBy:     "name",
+			Descending: true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, influxdb.Replications{Replications: allRepls[0:1], TotalCount: 3}, *listed)
+
+		// Only allowlisted fields can be sorted by.
+		_, err = svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID, SortBy: "name; DROP TABLE replications"})
+		require.Equal(t, &influxdb.ErrInvalidReplicationSortBy, err)
+		_, err = svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID, Limit: -1})
+		require.Equal(t, &influxdb.ErrInvalidReplicationPage, err)
+	})
 }
 
 func TestWritePoints(t *testing.T) {
@@ -645,8 +931,8 @@ disk,host=C value=1.3 1000000000`)
 	// Points should successfully be enqueued in the 2 replications associated with the local bucket.
 	for _, id := range []platform.ID{initID, initID + 2} {
 		mocks.durableQueueManager.EXPECT().
-			EnqueueData(id, gomock.Any()).
-			DoAndReturn(func(_ platform.ID, data []byte) error {
+			EnqueueData(id, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
 				gzBuf := bytes.NewBuffer(data)
 				gzr, err := gzip.NewReader(gzBuf)
 				require.NoError(t, err)
@@ -667,6 +953,32 @@ disk,host=C value=1.3 1000000000`)
 	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
 }
 
+func TestWritePoints_Empty(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	// Querying the replications of the bucket with a cancelled context would fail the write, and the mocks
+	// fail the test if anything is written locally or enqueued.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.NoError(t, svc.WritePoints(cancelled, replication.OrgID, replication.LocalBucketID, nil))
+	require.NoError(t, svc.WritePoints(cancelled, replication.OrgID, replication.LocalBucketID, []models.Point{}))
+
+	// Even with local writes disabled, an empty write succeeds.
+	require.NoError(t, svc.SetLocalWriteEnabled(ctx, replication.LocalBucketID, false))
+	require.NoError(t, svc.WritePoints(cancelled, replication.OrgID, replication.LocalBucketID, nil))
+}
+
 func TestWritePoints_LocalFailure(t *testing.T) {
 	t.Parallel()
 
@@ -709,65 +1021,1733 @@ disk,host=C value=1.3 1000000000`)
 	require.Equal(t, writeErr, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
 }
 
-type mocks struct {
-	bucketSvc           *replicationsMock.MockBucketService
-	validator           *replicationsMock.MockReplicationValidator
-	durableQueueManager *replicationsMock.MockDurableQueueManager
-	pointWriter         *replicationsMock.MockPointsWriter
+func TestWritePoints_EnqueueOnLocalFailure(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	// Register two replications on the same bucket, only one of which replicates through local failures.
+	createReq2 := createReq
+	createReq2.Name = "test2"
+	createReq2.EnqueueOnLocalFailure = true
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, createReq2} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+
+	points := mustParsePoints(t, `
+cpu,host=A value=1.2 2000000000
+cpu,host=B value=1.3 4000000000`)
+
+	// Points should fail to write to local TSM.
+	writeErr := errors.New("O NO")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(writeErr)
+
+	// Points should only be enqueued into the replication which opted in.
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID+1, gomock.Any(), gomock.Any()).Return(nil)
+
+	err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+	var ierr *ierrors.Error
+	require.True(t, errors.As(err, &ierr))
+	require.Equal(t, writeErr, ierr.Err)
+	require.Contains(t, ierr.Msg, "enqueued for 1 replication(s)")
 }
 
-func newTestService(t *testing.T) (*service, mocks, func(t *testing.T)) {
-	store, clean := sqlite.NewTestStore(t)
-	logger := zaptest.NewLogger(t)
-	sqliteMigrator := sqlite.NewMigrator(store, logger)
-	require.NoError(t, sqliteMigrator.Up(ctx, migrations.AllUp))
+func TestWritePoints_LocalFailurePolicy(t *testing.T) {
+	t.Parallel()
 
-	// Make sure foreign-key checking is enabled.
-	_, err := store.DB.Exec("PRAGMA foreign_keys = ON;")
-	require.NoError(t, err)
+	writeErr := &ierrors.Error{Code: ierrors.EUnavailable, Msg: "O NO"}
+	for _, tc := range []struct {
+		policy LocalFailurePolicy
+		check  func(t *testing.T, err error)
+	}{
+		{
+			policy: "",
+			check: func(t *testing.T, err error) {
+				require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+				require.Equal(t, OpLocalWriteFailedReplicated, ierrors.ErrorOp(err))
+				var ierr *ierrors.Error
+				require.True(t, errors.As(err, &ierr))
+				require.Equal(t, writeErr, ierr.Err)
+			},
+		},
+		{
+			policy: LocalFailurePartial,
+			check: func(t *testing.T, err error) {
+				require.Equal(t, OpLocalWriteFailedReplicated, ierrors.ErrorOp(err))
+			},
+		},
+		{
+			policy: LocalFailureSucceed,
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			policy: LocalFailureFail,
+			check: func(t *testing.T, err error) {
+				require.Equal(t, writeErr, err)
+			},
+		},
+	} {
+		tc := tc
+		t.Run(string(tc.policy), func(t *testing.T) {
+			svc, mocks, clean := newTestService(t)
+			defer clean(t)
+			svc.localFailurePolicy = tc.policy
+
+			req := createReq
+			req.EnqueueOnLocalFailure = true
+			insertRemote(t, svc.store, req.RemoteID)
+			mocks.bucketSvc.EXPECT().RLock()
+			mocks.bucketSvc.EXPECT().RUnlock()
+			mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), req.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+			mocks.durableQueueManager.EXPECT().InitializeQueue(initID, req.MaxQueueSizeBytes)
+			_, err := svc.CreateReplication(ctx, req)
+			require.NoError(t, err)
 
-	ctrl := gomock.NewController(t)
-	mocks := mocks{
-		bucketSvc:           replicationsMock.NewMockBucketService(ctrl),
-		validator:           replicationsMock.NewMockReplicationValidator(ctrl),
-		durableQueueManager: replicationsMock.NewMockDurableQueueManager(ctrl),
-		pointWriter:         replicationsMock.NewMockPointsWriter(ctrl),
+			points := mustParsePoints(t, `cpu,host=A value=1.2 2000000000`)
+			mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(writeErr)
+			mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil)
+
+			tc.check(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+		})
 	}
-	svc := service{
-		store:               store,
-		idGenerator:         mock.NewIncrementingIDGenerator(initID),
-		bucketService:       mocks.bucketSvc,
-		validator:           mocks.validator,
-		log:                 logger,
-		durableQueueManager: mocks.durableQueueManager,
-		localWriter:         mocks.pointWriter,
+}
+
+// fieldlessPoint is a point which reports having no fields, as if it was marshalled without any.
+type fieldlessPoint struct {
+	models.Point
+}
+
+func (fieldlessPoint) FieldIterator() models.FieldIterator {
+	return noFields{}
+}
+
+type noFields struct {
+	models.FieldIterator
+}
+
+func (noFields) Next() bool {
+	return false
+}
+
+func TestWritePoints_FieldlessPoints(t *testing.T) {
+	t.Parallel()
+
+	valid := mustParsePoints(t, "cpu,host=A value=1.2 2000000000\ncpu,host=B value=3.4 2000000000")
+	points := []models.Point{valid[0], fieldlessPoint{mustParsePoints(t, `cpu,host=C value=5.6 2000000000`)[0]}, valid[1]}
+
+	setup := func(t *testing.T) (*service, mocks, func(t *testing.T)) {
+		svc, mocks, clean := newTestService(t)
+		insertRemote(t, svc.store, createReq.RemoteID)
+		mocks.bucketSvc.EXPECT().RLock()
+		mocks.bucketSvc.EXPECT().RUnlock()
+		mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+		mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, createReq)
+		require.NoError(t, err)
+		return svc, mocks, clean
 	}
 
-	return &svc, mocks, clean
+	t.Run("skipped", func(t *testing.T) {
+		svc, mocks, clean := setup(t)
+		defer clean(t)
+
+		// Local storage still gets the whole write.
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		var enqueued []byte
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			enqueued = gunzip(t, data)
+			return nil
+		})
+
+		require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+		require.Equal(t, "cpu,host=A value=1.2 2000000000\ncpu,host=B value=3.4 2000000000\n", string(enqueued))
+
+		reg := prom.NewRegistry(zaptest.NewLogger(t))
+		reg.MustRegister(svc.metrics.PrometheusCollectors()...)
+		m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_dropped_points_total",
+			map[string]string{"replicationID": initID.String(), "reason": metrics.DropReasonNoFields})
+		require.Equal(t, float64(1), m.Counter.GetValue())
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		svc, _, clean := setup(t)
+		defer clean(t)
+		svc.rejectFieldlessPoints = true
+
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+	})
 }
 
-func insertRemote(t *testing.T, store *sqlite.SqlStore, id platform.ID) {
-	store.Mu.Lock()
-	defer store.Mu.Unlock()
+func TestWritePoints_DurabilityTiers(t *testing.T) {
+	t.Parallel()
 
-	q := sq.Insert("remotes").SetMap(sq.Eq{
-		"id":                 id,
-		"org_id":             replication.OrgID,
-		"name":               fmt.Sprintf("foo-%s", id),
-		"remote_url":         fmt.Sprintf("http://%s.cloud", id),
-		"remote_api_token":   id.String(),
-		"remote_org_id":      platform.ID(888888),
-		"allow_insecure_tls": true,
-		"created_at":         "datetime('now')",
-		"updated_at":         "datetime('now')",
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	// Register a best-effort and a guaranteed replication on the same bucket.
+	guaranteedReq := createReq
+	guaranteedReq.Name = "test2"
+	guaranteedReq.DurabilityTier = influxdb.DurabilityGuaranteed
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, guaranteedReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+	bestEffortID, guaranteedID := initID, initID+1
+
+	points := mustParsePoints(t, `cpu,host=A value=1.2 2000000000`)
+
+	t.Run("best-effort failure is dropped", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(bestEffortID, gomock.Any(), gomock.Any()).Return(durablequeue.ErrQueueFull)
+		mocks.durableQueueManager.EXPECT().EnqueueData(guaranteedID, gomock.Any(), gomock.Any()).Return(nil)
+
+		// The failure is reported, but not as one to retry the write for.
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnprocessableEntity, ierrors.ErrorCode(err))
+		require.Equal(t, OpEnqueueFailed, ierrors.ErrorOp(err))
+		failures, ok := EnqueueFailures(err)
+		require.True(t, ok)
+		require.Equal(t, []platform.ID{bestEffortID}, failures.IDs())
+
+		reg := prom.NewRegistry(zaptest.NewLogger(t))
+		reg.MustRegister(svc.metrics.PrometheusCollectors()...)
+		m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_dropped_points_total",
+			map[string]string{"replicationID": bestEffortID.String(), "reason": metrics.DropReasonQueueFull})
+		require.Equal(t, float64(1), m.Counter.GetValue())
 	})
-	query, args, err := q.ToSql()
-	require.NoError(t, err)
 
-	_, err = store.DB.Exec(query, args...)
-	require.NoError(t, err)
+	t.Run("guaranteed failure fails the write", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(bestEffortID, gomock.Any(), gomock.Any()).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(guaranteedID, gomock.Any(), gomock.Any()).Return(durablequeue.ErrQueueFull)
+
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+		require.Contains(t, err.Error(), guaranteedID.String())
+	})
+
+	t.Run("guaranteed failure reports the failed replications", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(bestEffortID, gomock.Any(), gomock.Any()).Return(durablequeue.ErrQueueFull)
+		mocks.durableQueueManager.EXPECT().EnqueueData(guaranteedID, gomock.Any(), gomock.Any()).Return(durablequeue.ErrQueueFull)
+
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, OpEnqueueFailed, ierrors.ErrorOp(err))
+		require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+		failures, ok := EnqueueFailures(err)
+		require.True(t, ok)
+		// The best-effort replication's failure is reported along with the guaranteed one's.
+		require.Equal(t, []platform.ID{bestEffortID, guaranteedID}, failures.IDs())
+		require.ErrorIs(t, failures.Failed[bestEffortID], durablequeue.ErrQueueFull)
+		require.ErrorIs(t, failures.Failed[guaranteedID], durablequeue.ErrQueueFull)
+
+		_, ok = EnqueueFailures(errors.New("O NO"))
+		require.False(t, ok)
+	})
+
+	t.Run("invalid tier", func(t *testing.T) {
+		invalid := influxdb.DurabilityTier("sometimes")
+		req := createReq
+		req.DurabilityTier = invalid
+		require.Equal(t, &influxdb.ErrInvalidDurabilityTier, req.OK())
+		require.Equal(t, &influxdb.ErrInvalidDurabilityTier, (&influxdb.UpdateReplicationRequest{DurabilityTier: &invalid}).OK())
+	})
 }
 
-func boolPointer(b bool) *bool {
+func TestWritePoints_SerializedEnqueue(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	req.SerializedEnqueue = true
+	insertRemote(t, svc.store, req.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), req.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, req.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+
+	const writes = 20
+	started := make(chan struct{})
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ platform.ID, points []models.Point) error {
+			started <- struct{}{}
+			// Later writes finish their local write sooner, so would be enqueued first if enqueues weren't serialized.
+			time.Sleep(time.Duration(writes-points[0].UnixNano()) * time.Millisecond)
+			return nil
+		}).Times(writes)
+
+	var mu sync.Mutex
+	var order []int64
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			points, err := models.ParsePoints(gunzip(t, data))
+			require.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, points[0].UnixNano())
+			return nil
+		}).Times(writes)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writes; i++ {
+		points := mustParsePoints(t, fmt.Sprintf("cpu value=1 %d", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+		}()
+		// Wait for the write to take its place in line before starting the next one.
+		<-started
+	}
+	wg.Wait()
+
+	expected := make([]int64, writes)
+	for i := range expected {
+		expected[i] = int64(i)
+	}
+	require.Equal(t, expected, order)
+}
+
+func TestWritePoints_LocalWriteDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	now := time.Unix(1000, 0)
+	svc.localWrites.now = func() time.Time { return now }
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	points, err := models.ParsePointsString(`cpu,host=A value=1.1 1000000000`)
+	require.NoError(t, err)
+
+	// While disabled, points should only be enqueued.
+	require.NoError(t, svc.SetLocalWriteEnabled(ctx, replication.LocalBucketID, false))
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, []LocalWriteGap{{BucketID: replication.LocalBucketID, Start: now}},
+		svc.LocalWriteGaps(ctx, replication.LocalBucketID))
+
+	// Buckets without replications can't accept writes while local writes are disabled.
+	otherBucket := platform.ID(77777)
+	require.NoError(t, svc.SetLocalWriteEnabled(ctx, otherBucket, false))
+	require.Equal(t, errLocalWriteDisabled(otherBucket), svc.WritePoints(ctx, replication.OrgID, otherBucket, points))
+
+	// Neither can writes whose points are all left out of replication.
+	fieldless := []models.Point{fieldlessPoint{points[0]}}
+	require.Equal(t, errLocalWriteDisabled(replication.LocalBucketID), svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, fieldless))
+
+	// Once re-enabled, points should be written locally and enqueued, and the gap closed.
+	later := now.Add(time.Minute)
+	svc.localWrites.now = func() time.Time { return later }
+	require.NoError(t, svc.SetLocalWriteEnabled(ctx, replication.LocalBucketID, true))
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil)
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Equal(t, []LocalWriteGap{{BucketID: replication.LocalBucketID, Start: now, End: later}},
+		svc.LocalWriteGaps(ctx, replication.LocalBucketID))
+}
+
+func TestLocalWriteGaps_Restored(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	start := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	bucketID, otherBucket := replication.LocalBucketID, platform.ID(77777)
+
+	svc.localWrites.now = func() time.Time { return start }
+	require.NoError(t, svc.SetLocalWriteEnabled(ctx, bucketID, false))
+	require.NoError(t, svc.SetLocalWriteEnabled(ctx, otherBucket, false))
+	svc.localWrites.now = func() time.Time { return end }
+	require.NoError(t, svc.SetLocalWriteEnabled(ctx, bucketID, true))
+
+	// The gaps, and which buckets still have local writes disabled, survive a restart.
+	svc.localWrites = newLocalWriteGate(svc.store)
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{})
+	require.NoError(t, svc.Open(ctx))
+	require.True(t, svc.localWrites.enabled(bucketID))
+	require.False(t, svc.localWrites.enabled(otherBucket))
+	require.Equal(t, []LocalWriteGap{{BucketID: bucketID, Start: start, End: end}}, svc.LocalWriteGaps(ctx, bucketID))
+	require.Equal(t, []LocalWriteGap{{BucketID: otherBucket, Start: start}}, svc.LocalWriteGaps(ctx, otherBucket))
+
+	// Once backfilled, closed gaps can be cleared, while open ones are kept.
+	require.NoError(t, svc.ClearLocalWriteGaps(ctx, bucketID))
+	require.NoError(t, svc.ClearLocalWriteGaps(ctx, otherBucket))
+	svc.localWrites = newLocalWriteGate(svc.store)
+	require.NoError(t, svc.localWrites.restore(ctx))
+	require.Empty(t, svc.LocalWriteGaps(ctx, bucketID))
+	require.Equal(t, []LocalWriteGap{{BucketID: otherBucket, Start: start}}, svc.LocalWriteGaps(ctx, otherBucket))
+}
+
+func TestOrgEgressQuota(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	now := time.Date(2021, time.October, 15, 12, 0, 0, 0, time.UTC)
+	svc.egress.now = func() time.Time { return now }
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	quota := int64(100)
+	require.NoError(t, svc.SetOrgEgressQuota(ctx, replication.OrgID, &quota))
+
+	// Sends under the quota are tracked without pausing anything.
+	write := svc.egress.observe(func(platform.ID, []byte) error { return nil })
+	require.NoError(t, write(initID, make([]byte, 60)))
+	usage, err := svc.GetOrgEgressUsage(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.Equal(t, &influxdb.OrgEgressUsage{
+		OrgID:       replication.OrgID,
+		PeriodStart: time.Date(2021, time.October, 1, 0, 0, 0, 0, time.UTC),
+		BytesSent:   60,
+		QuotaBytes:  &quota,
+	}, usage)
+
+	// Going over the quota pauses the org's replications.
+	mocks.durableQueueManager.EXPECT().PauseQueueFor(initID, internal.PauseReasonQuota)
+	require.NoError(t, write(initID, make([]byte, 60)))
+	usage, err = svc.GetOrgEgressUsage(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.Equal(t, int64(120), usage.BytesSent)
+	require.True(t, usage.Paused)
+
+	// Failed sends don't count against the quota.
+	failed := svc.egress.observe(func(platform.ID, []byte) error { return errors.New("O NO") })
+	require.Error(t, failed(initID, make([]byte, 60)))
+
+	// Raising the quota resumes them.
+	quota = 1000
+	mocks.durableQueueManager.EXPECT().ResumeQueueFor(initID, internal.PauseReasonQuota)
+	require.NoError(t, svc.SetOrgEgressQuota(ctx, replication.OrgID, &quota))
+	usage, err = svc.GetOrgEgressUsage(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.Equal(t, int64(120), usage.BytesSent)
+	require.False(t, usage.Paused)
+
+	// Usage resets when the period rolls over.
+	now = now.AddDate(0, 1, 0)
+	usage, err = svc.GetOrgEgressUsage(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), usage.BytesSent)
+	require.Equal(t, time.Date(2021, time.November, 1, 0, 0, 0, 0, time.UTC), usage.PeriodStart)
+
+	// Deleted replications are dropped from the cache of their orgs.
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID)
+	require.NoError(t, svc.DeleteReplication(ctx, initID))
+	require.Empty(t, svc.egress.orgs)
+}
+
+func TestOrgEgressQuota_Flushed(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	now := time.Date(2021, time.October, 15, 12, 0, 0, 0, time.UTC)
+	svc.egress.now = func() time.Time { return now }
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	quota := int64(100)
+	require.NoError(t, svc.SetOrgEgressQuota(ctx, replication.OrgID, &quota))
+
+	storedBytes := func() int64 {
+		var n int64
+		require.NoError(t, svc.store.DB.Get(&n, "SELECT bytes_sent FROM replication_egress WHERE org_id = ?", replication.OrgID))
+		return n
+	}
+
+	// Sends are added up in memory, and the quota enforced against the total before it's persisted.
+	write := svc.egress.observe(func(platform.ID, []byte) error { return nil })
+	require.NoError(t, write(initID, make([]byte, 60)))
+	mocks.durableQueueManager.EXPECT().PauseQueueFor(initID, internal.PauseReasonQuota)
+	require.NoError(t, write(initID, make([]byte, 60)))
+	require.Equal(t, int64(0), storedBytes())
+
+	require.NoError(t, svc.egress.flush(ctx))
+	require.Equal(t, int64(120), storedBytes())
+
+	// Closing the service stops the timer resuming the org, and persists the usage of the last sends.
+	require.NoError(t, write(initID, make([]byte, 30)))
+	mocks.durableQueueManager.EXPECT().CloseAll()
+	require.NoError(t, svc.Close())
+	require.Empty(t, svc.egress.pausedOrgs)
+	require.Equal(t, int64(150), storedBytes())
+
+	// Quotas aren't enforced once closed.
+	quota = 1000
+	require.NoError(t, svc.SetOrgEgressQuota(ctx, replication.OrgID, &quota))
+}
+
+func TestOrgEgressQuota_Restored(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	now := time.Date(2021, time.October, 15, 12, 0, 0, 0, time.UTC)
+	svc.egress.now = func() time.Time { return now }
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	quota := int64(100)
+	require.NoError(t, svc.SetOrgEgressQuota(ctx, replication.OrgID, &quota))
+	mocks.durableQueueManager.EXPECT().PauseQueueFor(initID, internal.PauseReasonQuota)
+	require.NoError(t, svc.egress.observe(func(platform.ID, []byte) error { return nil })(initID, make([]byte, 120)))
+
+	// Which orgs are paused is recomputed from their persisted usage when the service is reopened.
+	svc.egress.stop()
+	require.NoError(t, svc.egress.flush(ctx))
+	svc.egress = newEgressTracker(svc.store, mocks.durableQueueManager, zaptest.NewLogger(t))
+	svc.egress.now = func() time.Time { return now }
+	svc.egress.metrics = svc.metrics
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{initID: createReq.MaxQueueSizeBytes})
+	mocks.durableQueueManager.EXPECT().PauseQueueFor(initID, internal.PauseReasonQuota)
+	require.NoError(t, svc.Open(ctx))
+	defer svc.egress.stop()
+	usage, err := svc.GetOrgEgressUsage(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.True(t, usage.Paused)
+
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(svc.metrics.PrometheusCollectors()...)
+	m := promtest.MustFindMetric(t, promtest.MustGather(t, reg), "replications_queue_egress_quota_paused_orgs", nil)
+	require.Equal(t, float64(1), m.Gauge.GetValue())
+
+	// Replications created while the org is over its quota start out paused.
+	req := createReq
+	req.Name = "test2"
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID+1, createReq.MaxQueueSizeBytes)
+	mocks.durableQueueManager.EXPECT().PauseQueueFor(initID+1, internal.PauseReasonQuota)
+	_, err = svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+}
+
+func TestWritePoints_SerializationBufferCap(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.maxSerializationBufferBytes = 1024
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	var lp strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&lp, "cpu,host=host%d value=%d %d\n", i%100, i, i)
+	}
+	points, err := models.ParsePointsString(lp.String())
+	require.NoError(t, err)
+
+	var enqueued []models.Point
+	var blocks int
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			blocks++
+			// The compressed block held in memory never grows past the cap.
+			require.LessOrEqual(t, len(data), svc.maxSerializationBufferBytes)
+
+			gzr, err := gzip.NewReader(bytes.NewReader(data))
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			_, err = buf.ReadFrom(gzr)
+			require.NoError(t, err)
+
+			// Blocks are split at line boundaries.
+			require.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\n")))
+			ps, err := models.ParsePoints(buf.Bytes())
+			require.NoError(t, err)
+			enqueued = append(enqueued, ps...)
+			return nil
+		}).MinTimes(2)
+
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Greater(t, blocks, 1)
+	require.Equal(t, points, enqueued)
+}
+
+func TestWritePoints_PreserveWriteBoundaries(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.maxSerializationBufferBytes = 1024
+
+	// Register a replication preserving write boundaries next to one that doesn't, on the same bucket.
+	preservingReq := createReq
+	preservingReq.Name = "test2"
+	preservingReq.PreserveWriteBoundaries = true
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, preservingReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		r, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, req.PreserveWriteBoundaries, r.PreserveWriteBoundaries)
+	}
+	splitID, preservingID := initID, initID+1
+
+	var lp strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&lp, "cpu,host=host%d value=%d %d\n", i%100, i, i)
+	}
+	points, err := models.ParsePointsString(lp.String())
+	require.NoError(t, err)
+
+	var splitBlocks int
+	var preserved []byte
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(splitID, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(platform.ID, []byte, int) error {
+			splitBlocks++
+			return nil
+		}).MinTimes(2)
+	// The whole write is enqueued as a single block, so it's sent to the remote in a single request.
+	mocks.durableQueueManager.EXPECT().EnqueueData(preservingID, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			preserved = append([]byte(nil), data...)
+			return nil
+		}).Times(1)
+
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Greater(t, splitBlocks, 1)
+
+	gzr, err := gzip.NewReader(bytes.NewReader(preserved))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(gzr)
+	require.NoError(t, err)
+	ps, err := models.ParsePoints(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, points, ps)
+
+	// The flag can be turned off again.
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{preservingID}).Return(map[platform.ID]int64{preservingID: 0}, nil)
+	r, err := svc.UpdateReplication(ctx, preservingID, influxdb.UpdateReplicationRequest{PreserveWriteBoundaries: boolPointer(false)})
+	require.NoError(t, err)
+	require.False(t, r.PreserveWriteBoundaries)
+}
+
+func TestWritePoints_SingleSerialization(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.maxSerializationBufferBytes = 1024
+
+	// Replications without filters sharing a codec are serialized together, whether or not they preserve write
+	// boundaries, as long as the write fits in a single block.
+	const n = 5
+	mocks.bucketSvc.EXPECT().RLock().Times(n)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(n)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(n)
+	insertRemote(t, svc.store, createReq.RemoteID)
+	for i := 0; i < n; i++ {
+		req := createReq
+		req.Name = fmt.Sprintf("test%d", i)
+		req.PreserveWriteBoundaries = i%2 == 1
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+
+	// Every replication is enqueued the very same block, rather than a copy serialized for it.
+	points := mustParsePoints(t, "cpu value=1 1\nmem value=2 2")
+	var mu sync.Mutex
+	blocks := make(map[*byte]int)
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(gomock.Any(), gomock.Any(), gomock.Any()).Times(n).
+		DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+			require.Equal(t, "cpu value=1 1\nmem value=2 2\n", string(gunzip(t, data)))
+			mu.Lock()
+			defer mu.Unlock()
+			blocks[&data[0]]++
+			return nil
+		})
+
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	require.Len(t, blocks, 1)
+}
+
+func TestOnRemoteDeleting(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	// Unused remotes can be deleted either way.
+	unused := platform.ID(9999)
+	require.NoError(t, svc.OnRemoteDeleting(ctx, unused, false))
+	require.NoError(t, svc.OnRemoteDeleting(ctx, unused, true))
+
+	// Deleting a remote in use is blocked without cascade.
+	err = svc.OnRemoteDeleting(ctx, createReq.RemoteID, false)
+	require.Equal(t, ierrors.EConflict, ierrors.ErrorCode(err))
+	require.Contains(t, err.Error(), initID.String())
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	_, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+
+	// Cascading deletes the remote's replications and their queues.
+	mocks.durableQueueManager.EXPECT().DeleteQueue(initID)
+	require.NoError(t, svc.OnRemoteDeleting(ctx, createReq.RemoteID, true))
+	_, err = svc.GetReplication(ctx, initID)
+	require.Equal(t, errReplicationNotFound, err)
+}
+
+func TestWritePoints_EnqueueTimeout(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.enqueueTimeout = 50 * time.Millisecond
+	svc.metrics = metrics.NewReplicationsMetrics()
+	reg := prom.NewRegistry(zaptest.NewLogger(t))
+	reg.MustRegister(svc.metrics.PrometheusCollectors()...)
+
+	// Register a best-effort and a guaranteed replication on the same bucket.
+	guaranteedReq := createReq
+	guaranteedReq.Name = "test2"
+	guaranteedReq.DurabilityTier = influxdb.DurabilityGuaranteed
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, guaranteedReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+	bestEffortID, guaranteedID := initID, initID+1
+
+	points := mustParsePoints(t, `cpu,host=A value=1.2 2000000000`)
+	unblock := make(chan struct{})
+	defer close(unblock)
+	blocked := func(platform.ID, []byte, int) error {
+		<-unblock
+		return nil
+	}
+	timeouts := func(id platform.ID) float64 {
+		mfs := promtest.MustGather(t, reg)
+		return promtest.MustFindMetric(t, mfs, "replications_queue_enqueue_timeouts_total", map[string]string{"replicationID": id.String()}).Counter.GetValue()
+	}
+
+	t.Run("best-effort timeout is dropped", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(bestEffortID, gomock.Any(), gomock.Any()).DoAndReturn(blocked)
+		mocks.durableQueueManager.EXPECT().EnqueueData(guaranteedID, gomock.Any(), gomock.Any()).Return(nil)
+
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnprocessableEntity, ierrors.ErrorCode(err))
+		require.Equal(t, float64(1), timeouts(bestEffortID))
+	})
+
+	t.Run("guaranteed timeout fails the write", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(bestEffortID, gomock.Any(), gomock.Any()).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(guaranteedID, gomock.Any(), gomock.Any()).DoAndReturn(blocked)
+
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+		require.Contains(t, err.Error(), "timed out")
+		require.Equal(t, float64(1), timeouts(guaranteedID))
+	})
+}
+
+func TestWritePoints_DurableAck(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	// Durable-ack enqueues ignore the timeout.
+	svc.enqueueTimeout = 10 * time.Millisecond
+	svc.metrics = metrics.NewReplicationsMetrics()
+
+	durableReq := createReq
+	durableReq.Name = "test2"
+	durableReq.DurableAck = true
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	insertRemote(t, svc.store, createReq.RemoteID)
+
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, durableReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+	regularID, durableID := initID, initID+1
+
+	got, err := svc.GetReplication(ctx, durableID)
+	require.NoError(t, err)
+	require.True(t, got.DurableAck)
+
+	points := mustParsePoints(t, `cpu,host=A value=1.2 2000000000`)
+
+	t.Run("write waits for sync", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(regularID, gomock.Any(), gomock.Any()).Return(nil)
+
+		release := make(chan struct{})
+		var synced int32
+		mocks.durableQueueManager.EXPECT().EnqueueDataSync(durableID, gomock.Any(), gomock.Any()).DoAndReturn(func(platform.ID, []byte, int) error {
+			<-release
+			atomic.StoreInt32(&synced, 1)
+			return nil
+		})
+
+		done := make(chan error, 1)
+		go func() {
+			done <- svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		}()
+
+		select {
+		case err := <-done:
+			t.Fatalf("write returned before the durable enqueue finished: %v", err)
+		case <-time.After(5 * svc.enqueueTimeout):
+		}
+
+		close(release)
+		require.NoError(t, <-done)
+		require.Equal(t, int32(1), atomic.LoadInt32(&synced))
+	})
+
+	t.Run("sync failure fails the write", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(regularID, gomock.Any(), gomock.Any()).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueDataSync(durableID, gomock.Any(), gomock.Any()).Return(errors.New("fsync failed"))
+
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+		require.Contains(t, err.Error(), "fsync failed")
+	})
+
+	t.Run("disabled by update", func(t *testing.T) {
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{durableID})
+		got, err := svc.UpdateReplication(ctx, durableID, influxdb.UpdateReplicationRequest{DurableAck: boolPointer(false)})
+		require.NoError(t, err)
+		require.False(t, got.DurableAck)
+
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(regularID, gomock.Any(), gomock.Any()).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(durableID, gomock.Any(), gomock.Any()).Return(nil)
+		require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+	})
+}
+
+func TestWritePoints_BlockOnFullQueue(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.queueFullRetryInterval = time.Millisecond
+
+	blockingReq := createReq
+	blockingReq.BlockOnFullQueue = true
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	created, err := svc.CreateReplication(ctx, blockingReq)
+	require.NoError(t, err)
+	require.True(t, created.BlockOnFullQueue)
+
+	points := mustParsePoints(t, `cpu,host=A value=1.2 2000000000`)
+
+	t.Run("write waits for the queue to drain", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+
+		// The queue stays full until the sender drains it.
+		drained := make(chan struct{})
+		var attempts int32
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).DoAndReturn(func(platform.ID, []byte, int) error {
+			atomic.AddInt32(&attempts, 1)
+			select {
+			case <-drained:
+				return nil
+			default:
+				return durablequeue.ErrQueueFull
+			}
+		}).MinTimes(2)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		}()
+
+		select {
+		case err := <-done:
+			t.Fatalf("write returned while the queue was full: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(drained)
+		require.NoError(t, <-done)
+		require.Greater(t, atomic.LoadInt32(&attempts), int32(1))
+	})
+
+	t.Run("write fails once its context ends", func(t *testing.T) {
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(durablequeue.ErrQueueFull).MinTimes(1)
+
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+		failures, ok := EnqueueFailures(err)
+		require.True(t, ok)
+		require.Equal(t, []platform.ID{initID}, failures.IDs())
+		waitErr, ok := failures.Failed[initID].(*ierrors.Error)
+		require.True(t, ok)
+		require.ErrorIs(t, waitErr.Err, context.DeadlineExceeded)
+	})
+
+	t.Run("disabled by update", func(t *testing.T) {
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID})
+		got, err := svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{BlockOnFullQueue: boolPointer(false)})
+		require.NoError(t, err)
+		require.False(t, got.BlockOnFullQueue)
+
+		// Best-effort replications drop points which don't fit in the queue.
+		mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+		mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(durablequeue.ErrQueueFull)
+		err = svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+		require.Equal(t, ierrors.EUnprocessableEntity, ierrors.ErrorCode(err))
+	})
+}
+
+func TestResetReplicationStats(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	require.Equal(t, errReplicationNotFound, svc.ResetReplicationStats(ctx, initID))
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, serializePoints(mustParsePoints(t, "cpu value=1 1\ncpu value=2 2"), influxdb.CompressionGzip, 0, func(b []byte, _ int) error {
+		_, err := buf.Write(b)
+		return err
+	}))
+
+	// Record a couple of deliveries, then a failure.
+	stats := newStatsRecorder(svc.store, zaptest.NewLogger(t))
+	succeed := stats.observe(func(platform.ID, []byte) error { return nil })
+	fail := stats.observe(func(platform.ID, []byte) error { return errors.New("O NO") })
+	require.NoError(t, succeed(initID, buf.Bytes()))
+	require.NoError(t, succeed(initID, buf.Bytes()))
+	require.Error(t, fail(initID, buf.Bytes()))
+	require.Error(t, fail(initID, buf.Bytes()))
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).
+		Return(map[platform.ID]int64{initID: 1234}, nil).Times(2)
+	got, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2*buf.Len()), got.DeliveredBytes)
+	require.Equal(t, int64(4), got.DeliveredPoints)
+	require.Equal(t, int64(2), got.ConsecutiveFailures)
+
+	// Resetting zeroes the counters, but leaves the config and queue alone.
+	require.NoError(t, svc.ResetReplicationStats(ctx, initID))
+	got, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	expected := replication
+	expected.CurrentQueueSizeBytes = 1234
+	expected.RemainingQueueBytes -= 1234
+	require.Equal(t, expected, *got)
+}
+
+func TestEncryptedRemoteToken(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	tokens, err := tokencrypt.New(bytes.Repeat([]byte{1}, tokencrypt.KeySize))
+	require.NoError(t, err)
+	encrypted, err := tokens.Encrypt(replication.RemoteID.String())
+	require.NoError(t, err)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	_, err = svc.store.DB.Exec("UPDATE remotes SET remote_api_token = ? WHERE id = ?", encrypted, replication.RemoteID)
+	require.NoError(t, err)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err = svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	// Replications can't be sent without the key the remote's token was encrypted with.
+	_, err = svc.getFullHTTPConfig(ctx, initID)
+	require.Equal(t, tokencrypt.ErrKeyMissing, err)
+
+	// With it, they're sent with the decrypted token.
+	svc.tokens = tokens
+	got, err := svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, &httpConfig, got)
+}
+
+func mustParsePoints(t *testing.T, lp string) []models.Point {
+	t.Helper()
+
+	points, err := models.ParsePointsString(lp)
+	require.NoError(t, err)
+	return points
+}
+
+func TestWritePoints_EnqueueSpans(t *testing.T) {
+	// Not parallel, since the test swaps out the global tracer.
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	createReq2 := createReq
+	createReq2.Name = "test2"
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, createReq2} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+
+	points := mustParsePoints(t, "cpu value=1 1\ncpu value=2 2\ncpu value=3 3")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID, gomock.Any(), gomock.Any()).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(initID+1, gomock.Any(), gomock.Any()).Return(errors.New("O NO"))
+
+	parent := tracer.StartSpan("write")
+	spanCtx := opentracing.ContextWithSpan(ctx, parent)
+	_, failed := EnqueueFailures(svc.WritePoints(spanCtx, replication.OrgID, replication.LocalBucketID, points))
+	require.True(t, failed)
+	parent.Finish()
+
+	children := make(map[string]*mocktracer.MockSpan)
+	for _, span := range tracer.FinishedSpans() {
+		if span.ParentID == parent.(*mocktracer.MockSpan).SpanContext.SpanID {
+			children[span.OperationName] = span
+		}
+	}
+	require.Len(t, children, 2)
+
+	ok := children["replication.enqueue."+initID.String()]
+	require.NotNil(t, ok)
+	require.Equal(t, initID.String(), ok.Tag("replication_id"))
+	require.Equal(t, 3, ok.Tag("points"))
+	require.Greater(t, ok.Tag("bytes").(int), 0)
+	require.Nil(t, ok.Tag("error"))
+
+	failed := children["replication.enqueue."+(initID+1).String()]
+	require.NotNil(t, failed)
+	require.Equal(t, true, failed.Tag("error"))
+}
+
+type mocks struct {
+	bucketSvc           *replicationsMock.MockBucketService
+	validator           *replicationsMock.MockReplicationValidator
+	durableQueueManager *replicationsMock.MockDurableQueueManager
+	pointWriter         *replicationsMock.MockPointsWriter
+}
+
+func TestSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	svc, _, clean := newTestService(t)
+	defer clean(t)
+
+	known, err := migrations.AllUp.ReadDir(".")
+	require.NoError(t, err)
+	latest := len(known)
+
+	v, err := svc.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, &influxdb.ReplicationsSchemaVersion{Version: latest, LatestVersion: latest}, v)
+	require.False(t, v.Pending())
+
+	// Roll back the latest migration, so it's pending.
+	require.NoError(t, sqlite.NewMigrator(svc.store, zaptest.NewLogger(t)).Down(ctx, latest-1, migrations.AllDown))
+	v, err = svc.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, latest-1, v.Version)
+	require.Equal(t, latest, v.LatestVersion)
+	require.True(t, v.Pending())
+	require.Equal(t, []string{strings.TrimSuffix(known[latest-1].Name(), ".up.sql")}, v.PendingMigrations)
+}
+
+func newTestService(t *testing.T) (*service, mocks, func(t *testing.T)) {
+	store, clean := sqlite.NewTestStore(t)
+	logger := zaptest.NewLogger(t)
+	sqliteMigrator := sqlite.NewMigrator(store, logger)
+	require.NoError(t, sqliteMigrator.Up(ctx, migrations.AllUp))
+
+	// Make sure foreign-key checking is enabled.
+	_, err := store.DB.Exec("PRAGMA foreign_keys = ON;")
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	mocks := mocks{
+		bucketSvc:           replicationsMock.NewMockBucketService(ctrl),
+		validator:           replicationsMock.NewMockReplicationValidator(ctrl),
+		durableQueueManager: replicationsMock.NewMockDurableQueueManager(ctrl),
+		pointWriter:         replicationsMock.NewMockPointsWriter(ctrl),
+	}
+	svc := service{
+		store:               store,
+		idGenerator:         mock.NewIncrementingIDGenerator(initID),
+		bucketService:       mocks.bucketSvc,
+		validator:           mocks.validator,
+		log:                 logger,
+		durableQueueManager: mocks.durableQueueManager,
+		localWriter:         mocks.pointWriter,
+		localWrites:         newLocalWriteGate(store),
+		metrics:             metrics.NewReplicationsMetrics(),
+		egress:              newEgressTracker(store, mocks.durableQueueManager, logger),
+		backfills:           newBackfillJobs(),
+		sequencers:          newEnqueueSequencers(),
+		filters:             newFilterExprCache(),
+	}
+	svc.remoteBuckets = newRemoteBucketGuard(store, mocks.bucketSvc, svc.getFullHTTPConfig, nil, logger)
+	svc.remoteBuckets.queues = mocks.durableQueueManager
+
+	// Queue rates are reported alongside most reads of a replication, and are zero unless a test says otherwise.
+	mocks.durableQueueManager.EXPECT().QueueStats(gomock.Any()).Return(internal.QueueStats{}, nil).AnyTimes()
+
+	return &svc, mocks, clean
+}
+
+func insertRemote(t *testing.T, store *sqlite.SqlStore, id platform.ID) {
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+
+	q := sq.Insert("remotes").SetMap(sq.Eq{
+		"id":                 id,
+		"org_id":             replication.OrgID,
+		"name":               fmt.Sprintf("foo-%s", id),
+		"remote_url":         fmt.Sprintf("http://%s.cloud", id),
+		"remote_api_token":   id.String(),
+		"remote_org_id":      platform.ID(888888),
+		"allow_insecure_tls": true,
+		"created_at":         "datetime('now')",
+		"updated_at":         "datetime('now')",
+	})
+	query, args, err := q.ToSql()
+	require.NoError(t, err)
+
+	_, err = store.DB.Exec(query, args...)
+	require.NoError(t, err)
+}
+
+func boolPointer(b bool) *bool {
 	return &b
 }
+
+func TestOrderedDelivery(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	mocks.durableQueueManager.EXPECT().SetOrderedDelivery(initID, true)
+
+	req := createReq
+	req.OrderedDelivery = true
+	r, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.True(t, r.OrderedDelivery)
+
+	// Ordered delivery is restored when the service is reopened.
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{initID: createReq.MaxQueueSizeBytes})
+	mocks.durableQueueManager.EXPECT().SetOrderedDelivery(initID, true)
+	require.NoError(t, svc.Open(ctx))
+
+	mocks.durableQueueManager.EXPECT().SetOrderedDelivery(initID, false)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{OrderedDelivery: boolPointer(false)})
+	require.NoError(t, err)
+	require.False(t, r.OrderedDelivery)
+}
+
+func TestFlushInterval(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	req.FlushIntervalSeconds = influxdb.MaxReplicationFlushIntervalSeconds + 1
+	require.Equal(t, &influxdb.ErrInvalidFlushInterval, req.OK())
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	mocks.durableQueueManager.EXPECT().SetFlushInterval(initID, 10*time.Second)
+
+	req.FlushIntervalSeconds = 10
+	require.NoError(t, req.OK())
+	r, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), r.FlushIntervalSeconds)
+
+	// The flush interval is restored when the service is reopened.
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{initID: createReq.MaxQueueSizeBytes})
+	mocks.durableQueueManager.EXPECT().SetFlushInterval(initID, 10*time.Second)
+	require.NoError(t, svc.Open(ctx))
+
+	// Setting the interval to zero goes back to sending data as soon as it's queued.
+	var zero int64
+	mocks.durableQueueManager.EXPECT().SetFlushInterval(initID, time.Duration(0))
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{FlushIntervalSeconds: &zero})
+	require.NoError(t, err)
+	require.Zero(t, r.FlushIntervalSeconds)
+}
+
+type fakeRetryBackoffs map[platform.ID]time.Time
+
+func (f fakeRetryBackoffs) NextRetryTimes([]platform.ID) map[platform.ID]time.Time {
+	return f
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	req.RetryIntervalSeconds = influxdb.MaxReplicationRetryIntervalSeconds + 1
+	require.Equal(t, &influxdb.ErrInvalidRetryInterval, req.OK())
+	req.RetryIntervalSeconds, req.MaxRetryIntervalSeconds = 10, 5
+	require.Equal(t, &influxdb.ErrMaxRetryIntervalTooSmall, req.OK())
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	mocks.durableQueueManager.EXPECT().SetRetryBackoff(initID, 10*time.Second, 60*time.Second)
+
+	req.MaxRetryIntervalSeconds = 60
+	require.NoError(t, req.OK())
+	r, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), r.RetryIntervalSeconds)
+	require.Equal(t, int64(60), r.MaxRetryIntervalSeconds)
+	require.Nil(t, r.NextRetryAt)
+
+	// The backoff is restored when the service is reopened.
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{initID: createReq.MaxQueueSizeBytes})
+	mocks.durableQueueManager.EXPECT().SetRetryBackoff(initID, 10*time.Second, 60*time.Second)
+	require.NoError(t, svc.Open(ctx))
+
+	// Changing the max keeps the interval.
+	maxInterval := int64(120)
+	mocks.durableQueueManager.EXPECT().SetRetryBackoff(initID, 10*time.Second, 120*time.Second)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).AnyTimes()
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{MaxRetryIntervalSeconds: &maxInterval})
+	require.NoError(t, err)
+	require.Equal(t, int64(10), r.RetryIntervalSeconds)
+	require.Equal(t, int64(120), r.MaxRetryIntervalSeconds)
+
+	// Replications backing off report when they'll send again.
+	next := time.Now().Add(time.Minute).Round(0)
+	svc.retryBackoffs = fakeRetryBackoffs{initID: next}
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, &next, r.NextRetryAt)
+	rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: replication.OrgID})
+	require.NoError(t, err)
+	require.Equal(t, &next, rs.Replications[0].NextRetryAt)
+
+	// Resetting the backoff sends again immediately, so the replication no longer reports a retry time.
+	mocks.durableQueueManager.EXPECT().ResetRetryBackoff(initID).DoAndReturn(func(platform.ID) error {
+		svc.retryBackoffs = fakeRetryBackoffs{}
+		return nil
+	})
+	require.NoError(t, svc.ResetRetryBackoff(ctx, initID))
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Nil(t, r.NextRetryAt)
+	require.Equal(t, errReplicationNotFound, svc.ResetRetryBackoff(ctx, initID+1))
+}
+
+func TestPauseReplication(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	require.Equal(t, errReplicationNotFound, svc.PauseReplication(ctx, initID, nil))
+	require.Equal(t, errReplicationNotFound, svc.ResumeReplication(ctx, initID))
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).AnyTimes()
+
+	// Without a deadline, the replication stays paused until it's resumed.
+	mocks.durableQueueManager.EXPECT().PauseQueue(initID)
+	require.NoError(t, svc.PauseReplication(ctx, initID, nil))
+	r, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.True(t, r.Paused)
+	require.Nil(t, r.PausedUntil)
+
+	// Pauses are restored when the service is reopened.
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{initID: createReq.MaxQueueSizeBytes})
+	mocks.durableQueueManager.EXPECT().PauseQueue(initID)
+	require.NoError(t, svc.Open(ctx))
+
+	// With a deadline, the pause is reported until the deadline passes.
+	until := time.Now().Add(time.Hour)
+	mocks.durableQueueManager.EXPECT().PauseQueueUntil(initID, until)
+	require.NoError(t, svc.PauseReplication(ctx, initID, &until))
+	rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID})
+	require.NoError(t, err)
+	require.Len(t, rs.Replications, 1)
+	require.True(t, rs.Replications[0].Paused)
+	require.NotNil(t, rs.Replications[0].PausedUntil)
+	require.WithinDuration(t, until, *rs.Replications[0].PausedUntil, time.Millisecond)
+
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{initID: createReq.MaxQueueSizeBytes})
+	mocks.durableQueueManager.EXPECT().PauseQueueUntil(initID, gomock.Any())
+	require.NoError(t, svc.Open(ctx))
+
+	past := time.Now().Add(-time.Minute)
+	mocks.durableQueueManager.EXPECT().PauseQueueUntil(initID, past)
+	require.NoError(t, svc.PauseReplication(ctx, initID, &past))
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.False(t, r.Paused)
+	require.Nil(t, r.PausedUntil)
+
+	// Expired pauses aren't restored.
+	mocks.durableQueueManager.EXPECT().StartReplicationQueues(map[platform.ID]int64{initID: createReq.MaxQueueSizeBytes})
+	require.NoError(t, svc.Open(ctx))
+
+	mocks.durableQueueManager.EXPECT().ResumeQueue(initID)
+	require.NoError(t, svc.ResumeReplication(ctx, initID))
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.False(t, r.Paused)
+	require.Nil(t, r.PausedUntil)
+}
+
+func TestWritePoints_EnqueueFailuresAcrossFilters(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	// Each filter is serialized and enqueued separately.
+	insertRemote(t, svc.store, createReq.RemoteID)
+	cpu, mem := `measurement == "cpu"`, `measurement == "mem"`
+	reqs := []influxdb.CreateReplicationRequest{createReq, createReq, createReq}
+	reqs[0].Name, reqs[0].FilterExpression = "cpu", &cpu
+	reqs[1].Name, reqs[1].FilterExpression = "mem", &mem
+	reqs[2].Name = "all"
+	mocks.bucketSvc.EXPECT().RLock().Times(len(reqs))
+	mocks.bucketSvc.EXPECT().RUnlock().Times(len(reqs))
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(len(reqs))
+	for _, req := range reqs {
+		req.DurabilityTier = influxdb.DurabilityGuaranteed
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+	cpuID, memID, allID := initID, initID+1, initID+2
+
+	// A failure enqueueing the first filter's points doesn't stop the others being enqueued, and the local write
+	// still completes.
+	points := mustParsePoints(t, "cpu value=1 1\nmem value=2 2")
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, points).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(cpuID, gomock.Any(), gomock.Any()).Return(errors.New("disk on fire"))
+	mocks.durableQueueManager.EXPECT().EnqueueData(memID, gomock.Any(), gomock.Any()).Return(nil)
+	mocks.durableQueueManager.EXPECT().EnqueueData(allID, gomock.Any(), gomock.Any()).Return(durablequeue.ErrQueueFull)
+
+	err := svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points)
+	require.Equal(t, ierrors.EUnavailable, ierrors.ErrorCode(err))
+	failures, ok := EnqueueFailures(err)
+	require.True(t, ok)
+	require.Equal(t, []platform.ID{cpuID, allID}, failures.IDs())
+	require.EqualError(t, failures.Failed[cpuID], "disk on fire")
+	require.ErrorIs(t, failures.Failed[allID], durablequeue.ErrQueueFull)
+	require.Contains(t, err.Error(), cpuID.String())
+	require.Contains(t, err.Error(), allID.String())
+}
+
+func TestEnqueue_BoundedConcurrency(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.enqueueConcurrency = 3
+
+	targets := make([]replicationTarget, 20)
+	for i := range targets {
+		targets[i] = replicationTarget{ID: platform.ID(i + 1), DurabilityTier: influxdb.DurabilityBestEffort}
+	}
+	failing := &targets[7]
+	failing.DurabilityTier = influxdb.DurabilityGuaranteed
+
+	// Every replication is enqueued into, no more than enqueueConcurrency at once.
+	var running, peak int64
+	mocks.durableQueueManager.EXPECT().EnqueueData(gomock.Any(), gomock.Any(), gomock.Any()).Times(len(targets)).
+		DoAndReturn(func(id platform.ID, _ []byte, _ int) error {
+			n := atomic.AddInt64(&running, 1)
+			defer atomic.AddInt64(&running, -1)
+			for {
+				p := atomic.LoadInt64(&peak)
+				if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			if id == failing.ID {
+				return errors.New("disk on fire")
+			}
+			return nil
+		})
+
+	err := svc.enqueue(ctx, targets, nil, []byte("block"), 1)
+	pe, ok := err.(*PartialEnqueueError)
+	require.True(t, ok)
+	require.Equal(t, []platform.ID{failing.ID}, pe.IDs())
+	require.LessOrEqual(t, peak, int64(svc.enqueueConcurrency))
+	require.Greater(t, peak, int64(1))
+}
+
+func BenchmarkEnqueue_ManyReplications(b *testing.B) {
+	targets := make([]replicationTarget, 500)
+	for i := range targets {
+		targets[i] = replicationTarget{ID: platform.ID(i + 1), DurabilityTier: influxdb.DurabilityBestEffort}
+	}
+	data := []byte("block")
+
+	// One worker per replication is how enqueues were fanned out before they were bounded.
+	for _, concurrency := range []int{len(targets), defaultEnqueueConcurrency} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			queues := replicationsMock.NewMockDurableQueueManager(gomock.NewController(b))
+			var peak int64
+			queues.EXPECT().EnqueueData(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+				DoAndReturn(func(platform.ID, []byte, int) error {
+					if n := int64(runtime.NumGoroutine()); n > atomic.LoadInt64(&peak) {
+						atomic.StoreInt64(&peak, n)
+					}
+					return nil
+				})
+			svc := service{
+				log:                 zap.NewNop(),
+				metrics:             metrics.NewReplicationsMetrics(),
+				durableQueueManager: queues,
+				sequencers:          newEnqueueSequencers(),
+				enqueueConcurrency:  concurrency,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := svc.enqueue(ctx, targets, nil, data, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&peak)), "peak-goroutines")
+		})
+	}
+}
+
+func TestMaxQueueSizeBounds(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.maxQueueSizeLimit = 4 * influxdb.MinReplicationMaxQueueSizeBytes
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock().AnyTimes()
+	mocks.bucketSvc.EXPECT().RUnlock().AnyTimes()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).
+		Return(&influxdb.Bucket{}, nil).AnyTimes()
+
+	tooLarge := &ierrors.Error{
+		Code: ierrors.EInvalid,
+		Msg:  fmt.Sprintf("maxQueueSize too large, must be at most %d", svc.maxQueueSizeLimit),
+	}
+	for _, size := range []int64{-1, 0, influxdb.MinReplicationMaxQueueSizeBytes - 1} {
+		req := createReq
+		req.MaxQueueSizeBytes = size
+		_, err := svc.CreateReplication(ctx, req)
+		require.Equal(t, &influxdb.ErrMaxQueueSizeTooSmall, err, size)
+	}
+	req := createReq
+	req.MaxQueueSizeBytes = svc.maxQueueSizeLimit + 1
+	_, err := svc.CreateReplication(ctx, req)
+	require.Equal(t, tooLarge, err)
+
+	// Both bounds are inclusive.
+	req.MaxQueueSizeBytes = influxdb.MinReplicationMaxQueueSizeBytes
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, req.MaxQueueSizeBytes)
+	_, err = svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+
+	for _, size := range []int64{0, influxdb.MinReplicationMaxQueueSizeBytes - 1} {
+		size := size
+		_, err := svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{MaxQueueSizeBytes: &size})
+		require.Equal(t, &influxdb.ErrMaxQueueSizeTooSmall, err, size)
+	}
+	size := svc.maxQueueSizeLimit + 1
+	_, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{MaxQueueSizeBytes: &size})
+	require.Equal(t, tooLarge, err)
+
+	size = svc.maxQueueSizeLimit
+	mocks.durableQueueManager.EXPECT().UpdateMaxQueueSize(initID, size)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	updated, err := svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{MaxQueueSizeBytes: &size})
+	require.NoError(t, err)
+	require.Equal(t, size, updated.MaxQueueSizeBytes)
+}
+
+func TestValidateAllReplications(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	// Five replications share one remote, and one has a remote to itself.
+	remotes := []platform.ID{replication.RemoteID, replication.RemoteID, replication.RemoteID, replication.RemoteID, replication.RemoteID, newRemoteID}
+	insertRemote(t, svc.store, replication.RemoteID)
+	insertRemote(t, svc.store, newRemoteID)
+	mocks.bucketSvc.EXPECT().RLock().Times(len(remotes))
+	mocks.bucketSvc.EXPECT().RUnlock().Times(len(remotes))
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(len(remotes))
+	mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), createReq.MaxQueueSizeBytes).Times(len(remotes))
+	ids := make([]platform.ID, len(remotes))
+	for i, remoteID := range remotes {
+		req := createReq
+		req.Name = fmt.Sprintf("test%d", i)
+		req.RemoteID = remoteID
+		r, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+		ids[i] = r.ID
+	}
+
+	// Track how many validations run against each remote at once.
+	var mu sync.Mutex
+	running, maxRunning := make(map[string]int), make(map[string]int)
+	failURL := fmt.Sprintf("http://%s.cloud", newRemoteID)
+	mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, conf *internal.ReplicationHTTPConfig) error {
+		mu.Lock()
+		running[conf.RemoteURL]++
+		if running[conf.RemoteURL] > maxRunning[conf.RemoteURL] {
+			maxRunning[conf.RemoteURL] = running[conf.RemoteURL]
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running[conf.RemoteURL]--
+		mu.Unlock()
+		if conf.RemoteURL == failURL {
+			return errors.New("O NO")
+		}
+		return nil
+	}).Times(len(remotes))
+
+	results, err := svc.ValidateAllReplications(ctx, replication.OrgID)
+	require.NoError(t, err)
+	require.Len(t, results, len(ids))
+	for i, id := range ids[:len(ids)-1] {
+		require.NoError(t, results[id], i)
+	}
+	require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(results[ids[len(ids)-1]]))
+	require.LessOrEqual(t, maxRunning[fmt.Sprintf("http://%s.cloud", replication.RemoteID)], maxConcurrentValidationsPerRemote)
+
+	// Other orgs have nothing to validate.
+	results, err = svc.ValidateAllReplications(ctx, platform.ID(11))
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestV1Remote(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	_, err := svc.store.DB.Exec("UPDATE remotes SET remote_api_type = 'v1', remote_username = 'writer' WHERE id = ?", replication.RemoteID)
+	require.NoError(t, err)
+
+	req := createReq
+	rp := "autogen"
+	req.RemoteRetentionPolicy = &rp
+	require.Equal(t, &influxdb.ErrInvalidRemoteDatabase, req.OK())
+
+	db := "telegraf"
+	req.RemoteDatabase = &db
+	require.NoError(t, req.OK())
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	r, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, &db, r.RemoteDatabase)
+	require.Equal(t, &rp, r.RemoteRetentionPolicy)
+
+	conf, err := svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	apiType, username := influxdb.RemoteAPITypeV1, "writer"
+	require.Equal(t, &apiType, conf.RemoteAPIType)
+	require.Equal(t, &username, conf.RemoteUsername)
+	require.Equal(t, &db, conf.RemoteDatabase)
+	require.Equal(t, &rp, conf.RemoteRetentionPolicy)
+
+	// An empty retention policy goes back to the database's default one.
+	empty := ""
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{RemoteRetentionPolicy: &empty})
+	require.NoError(t, err)
+	require.Equal(t, &db, r.RemoteDatabase)
+	require.Nil(t, r.RemoteRetentionPolicy)
+}
+
+func TestDownsampleConfig(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	req := createReq
+	req.Downsample = &influxdb.ReplicationDownsample{WindowSeconds: 0, Aggregate: influxdb.DownsampleMean}
+	require.Equal(t, &influxdb.ErrInvalidDownsample, req.OK())
+	req.Downsample = &influxdb.ReplicationDownsample{WindowSeconds: 60, Aggregate: "median"}
+	require.Equal(t, &influxdb.ErrInvalidDownsample, req.OK())
+
+	downsample := influxdb.ReplicationDownsample{WindowSeconds: 60, Aggregate: influxdb.DownsampleMean}
+	req.Downsample = &downsample
+	require.NoError(t, req.OK())
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	r, err := svc.CreateReplication(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, &downsample, r.Downsample)
+
+	conf, err := svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, &downsample, conf.Downsample)
+
+	// The zero value removes the downsampling.
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+	r, err = svc.UpdateReplication(ctx, initID, influxdb.UpdateReplicationRequest{Downsample: &influxdb.ReplicationDownsample{}})
+	require.NoError(t, err)
+	require.Nil(t, r.Downsample)
+
+	conf, err = svc.getFullHTTPConfig(ctx, initID)
+	require.NoError(t, err)
+	require.Nil(t, conf.Downsample)
+}
@@ -0,0 +1,116 @@
+package replications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/influxdata/influxdb/v2/sqlite"
+	"go.uber.org/zap"
+)
+
+// statsRecorder persists cumulative counters about the data each replication has delivered to its remote.
+type statsRecorder struct {
+	store *sqlite.SqlStore
+	log   *zap.Logger
+	now   func() time.Time
+}
+
+func newStatsRecorder(store *sqlite.SqlStore, log *zap.Logger) *statsRecorder {
+	return &statsRecorder{store: store, log: log, now: time.Now}
+}
+
+// observe wraps a durable queue write function, counting the bytes and points delivered by every
+// successful write and the number of consecutive failed writes, and recording the outcome of the latest write,
+// the time of the latest successful one and the timestamp of the newest point delivered.
+func (r *statsRecorder) observe(write func(platform.ID, []byte) error) func(platform.ID, []byte) error {
+	return func(replicationID platform.ID, data []byte) error {
+		writeErr := write(replicationID, data)
+
+		var updates sq.Eq
+		if writeErr != nil {
+			updates = sq.Eq{
+				"consecutive_failures": sq.Expr("consecutive_failures + 1"),
+				"latest_response_code": responseCode(writeErr),
+				"latest_error_message": writeErr.Error(),
+				"latest_status_at":     r.now(),
+			}
+		} else {
+			points, newest, err := summarizeBatch(data)
+			if err != nil {
+				r.log.Warn("Failed to count points delivered by replication", zap.String("id", replicationID.String()), zap.Error(err))
+			}
+			updates = sq.Eq{
+				"delivered_bytes":      sq.Expr("delivered_bytes + ?", len(data)),
+				"delivered_points":     sq.Expr("delivered_points + ?", points),
+				"consecutive_failures": 0,
+				// The write API responds to successful writes with a 204.
+				"latest_response_code": http.StatusNoContent,
+				"latest_error_message": nil,
+				"latest_status_at":     r.now(),
+				"latest_success_at":    r.now(),
+			}
+			if newest != nil {
+				updates["newest_delivered_point_ns"] = sq.Expr("MAX(COALESCE(newest_delivered_point_ns, ?), ?)", *newest, *newest)
+			}
+		}
+
+		if err := r.update(context.Background(), replicationID, updates); err != nil {
+			r.log.Warn("Failed to record replication stats", zap.String("id", replicationID.String()), zap.Error(err))
+		}
+		return writeErr
+	}
+}
+
+// recordValidation records the outcome of validating a replication against its remote as its latest status.
+// A nil recorder records nothing.
+func (r *statsRecorder) recordValidation(ctx context.Context, replicationID platform.ID, validateErr error) {
+	if r == nil {
+		return
+	}
+	updates := sq.Eq{
+		"latest_response_code": http.StatusNoContent,
+		"latest_error_message": nil,
+		"latest_status_at":     r.now(),
+	}
+	if validateErr != nil {
+		updates["latest_response_code"] = responseCode(validateErr)
+		updates["latest_error_message"] = validateErr.Error()
+	}
+	if err := r.update(ctx, replicationID, updates); err != nil {
+		r.log.Warn("Failed to record replication status", zap.String("id", replicationID.String()), zap.Error(err))
+	}
+}
+
+func (r *statsRecorder) update(ctx context.Context, replicationID platform.ID, updates sq.Eq) error {
+	r.store.Mu.Lock()
+	defer r.store.Mu.Unlock()
+
+	query, args, err := sq.Update("replications").SetMap(updates).Where(sq.Eq{"id": replicationID}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.store.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// responseCode returns the status code the remote responded to a failed write with, or nil if the
+// write failed without a response.
+func responseCode(err error) *int32 {
+	var code int32
+	var writeErr *internal.RemoteWriteError
+	var partialErr *internal.PartialWriteError
+	switch {
+	case errors.As(err, &writeErr):
+		code = int32(writeErr.StatusCode)
+	case errors.As(err, &partialErr):
+		code = int32(partialErr.StatusCode)
+	default:
+		return nil
+	}
+	return &code
+}
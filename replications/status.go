@@ -0,0 +1,79 @@
+package replications
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+)
+
+// statusReason derives a human-readable explanation of a replication's latest write from the stored
+// response code and error message, so every client interprets them the same way.
+func statusReason(code *int32, errMsg *string) string {
+	if code == nil {
+		switch {
+		case errMsg == nil:
+			// Nothing has been sent yet.
+			return ""
+		case strings.Contains(*errMsg, internal.ErrAmbiguousWrite.Error()):
+			return "remote timed out"
+		default:
+			return "remote unreachable"
+		}
+	}
+
+	switch c := int(*code); {
+	case c >= 200 && c < 300:
+		return "ok"
+	case c == http.StatusBadRequest:
+		return "data rejected by remote"
+	case c == http.StatusUnauthorized:
+		return "authentication failed"
+	case c == http.StatusForbidden:
+		return "permission denied"
+	case c == http.StatusNotFound:
+		if errMsg != nil && strings.Contains(*errMsg, internal.ErrRemoteBucketNotFound.Error()) {
+			return "remote bucket not found"
+		}
+		return "remote write endpoint not found"
+	case c == http.StatusRequestEntityTooLarge:
+		return "batch too large"
+	case c == http.StatusUnprocessableEntity:
+		return "data rejected by remote"
+	case c == http.StatusTooManyRequests:
+		return "rate limited by remote"
+	case c == http.StatusServiceUnavailable:
+		return "remote unavailable"
+	case c >= 400 && c < 500:
+		return fmt.Sprintf("request rejected by remote (%d)", c)
+	case c >= 500:
+		return fmt.Sprintf("remote error (%d)", c)
+	default:
+		return fmt.Sprintf("unexpected response (%d)", c)
+	}
+}
+
+func setStatusReason(r *influxdb.Replication) {
+	r.StatusReason = statusReason(r.LatestResponseCode, r.LatestErrorMessage)
+}
+
+// statusUnknown is the status reason of a replication whose status has gone stale.
+const statusUnknown = "unknown"
+
+// markStaleStatus reports the status of a replication as unknown if it was recorded longer than threshold ago,
+// rather than a response which may no longer reflect the remote. Statuses recorded before their time was tracked
+// count as stale. A zero threshold never marks statuses stale.
+func markStaleStatus(r *influxdb.Replication, now time.Time, threshold time.Duration) {
+	if threshold <= 0 || (r.LatestResponseCode == nil && r.LatestErrorMessage == nil) {
+		return
+	}
+	if r.LatestStatusAt != nil && now.Sub(*r.LatestStatusAt) <= threshold {
+		return
+	}
+	r.LatestResponseCode = nil
+	r.LatestErrorMessage = nil
+	r.StatusReason = statusUnknown
+}
@@ -0,0 +1,194 @@
+package replications
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/replications/internal"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestStatusReason(t *testing.T) {
+	t.Parallel()
+
+	code := func(c int32) *int32 { return &c }
+	msg := func(m string) *string { return &m }
+
+	tests := []struct {
+		code   *int32
+		errMsg *string
+		want   string
+	}{
+		{want: ""},
+		{code: code(http.StatusNoContent), want: "ok"},
+		{code: code(http.StatusUnauthorized), errMsg: msg("unauthorized"), want: "authentication failed"},
+		{code: code(http.StatusForbidden), errMsg: msg("forbidden"), want: "permission denied"},
+		{code: code(http.StatusRequestEntityTooLarge), errMsg: msg("too large"), want: "batch too large"},
+		{code: code(http.StatusTooManyRequests), errMsg: msg("slow down"), want: "rate limited by remote"},
+		{code: code(http.StatusNotFound), errMsg: msg("remote bucket not found: {}"), want: "remote bucket not found"},
+		{code: code(http.StatusNotFound), errMsg: msg("404 page not found"), want: "remote write endpoint not found"},
+		{code: code(http.StatusServiceUnavailable), errMsg: msg("try later"), want: "remote unavailable"},
+		{code: code(http.StatusBadGateway), errMsg: msg("bad gateway"), want: "remote error (502)"},
+		{code: code(http.StatusConflict), errMsg: msg("conflict"), want: "request rejected by remote (409)"},
+		{errMsg: msg("dial tcp: connection refused"), want: "remote unreachable"},
+		{errMsg: msg(fmt.Sprintf("%v: i/o timeout", internal.ErrAmbiguousWrite)), want: "remote timed out"},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, statusReason(tt.code, tt.errMsg))
+	}
+}
+
+func TestGetReplication_StatusReason(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	var writeErr error
+	write := newStatsRecorder(svc.store, zaptest.NewLogger(t)).observe(func(platform.ID, []byte) error {
+		return writeErr
+	})
+	getReason := func() string {
+		mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil)
+		r, err := svc.GetReplication(ctx, initID)
+		require.NoError(t, err)
+		return r.StatusReason
+	}
+
+	require.Equal(t, "", getReason())
+
+	writeErr = &internal.RemoteWriteError{StatusCode: http.StatusUnauthorized, Message: "unauthorized access"}
+	require.Error(t, write(initID, nil))
+	require.Equal(t, "authentication failed", getReason())
+
+	writeErr = errors.New("dial tcp: connection refused")
+	require.Error(t, write(initID, nil))
+	require.Equal(t, "remote unreachable", getReason())
+
+	writeErr = nil
+	require.NoError(t, write(initID, nil))
+	require.Equal(t, "ok", getReason())
+}
+
+func TestGetReplication_StaleStatus(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.staleStatusThreshold = time.Hour
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).AnyTimes()
+
+	now := time.Now()
+	svc.stats = newStatsRecorder(svc.store, zaptest.NewLogger(t))
+	svc.stats.now = func() time.Time { return now }
+	write := svc.stats.observe(func(platform.ID, []byte) error { return nil })
+	require.NoError(t, write(initID, nil))
+
+	r, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, "ok", r.StatusReason)
+	require.NotNil(t, r.LatestResponseCode)
+	statusAt := *r.LatestStatusAt
+
+	// Once the status is older than the threshold, the old response is no longer reported.
+	markStaleStatus(r, statusAt.Add(time.Hour), svc.staleStatusThreshold)
+	require.Equal(t, "ok", r.StatusReason)
+	markStaleStatus(r, statusAt.Add(time.Hour+time.Second), svc.staleStatusThreshold)
+	require.Equal(t, statusUnknown, r.StatusReason)
+	require.Nil(t, r.LatestResponseCode)
+
+	// The replication has been idle since a write recorded 2h ago.
+	now = now.Add(-2 * time.Hour)
+	require.NoError(t, write(initID, nil))
+	rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID})
+	require.NoError(t, err)
+	require.Len(t, rs.Replications, 1)
+	require.Equal(t, statusUnknown, rs.Replications[0].StatusReason)
+	require.Nil(t, rs.Replications[0].LatestResponseCode)
+
+	// Validating the replication refreshes its status.
+	now = time.Now()
+	mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).Return(nil)
+	require.NoError(t, svc.ValidateReplication(ctx, initID))
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, "ok", r.StatusReason)
+
+	mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).Return(errors.New("dial tcp: connection refused"))
+	require.Error(t, svc.ValidateReplication(ctx, initID))
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, "remote unreachable", r.StatusReason)
+}
+
+func TestLatestSuccessAt(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+	svc.staleStatusThreshold = time.Hour
+
+	insertRemote(t, svc.store, replication.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{initID}).Return(map[platform.ID]int64{initID: 0}, nil).AnyTimes()
+
+	r, err := svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Nil(t, r.LatestSuccessAt)
+
+	now := time.Now().Add(-5 * time.Hour)
+	svc.stats = newStatsRecorder(svc.store, zaptest.NewLogger(t))
+	svc.stats.now = func() time.Time { return now }
+	var writeErr error
+	write := svc.stats.observe(func(platform.ID, []byte) error { return writeErr })
+	require.NoError(t, write(initID, nil))
+	successAt := now
+
+	// Failed writes and validations update the latest status, but not the latest success.
+	now = now.Add(time.Hour)
+	writeErr = errors.New("dial tcp: connection refused")
+	require.Error(t, write(initID, nil))
+	now = now.Add(time.Hour)
+	mocks.validator.EXPECT().ValidateReplication(gomock.Any(), gomock.Any()).Return(nil)
+	require.NoError(t, svc.ValidateReplication(ctx, initID))
+
+	// The latest success is still reported once the status has gone stale.
+	r, err = svc.GetReplication(ctx, initID)
+	require.NoError(t, err)
+	require.Equal(t, statusUnknown, r.StatusReason)
+	require.WithinDuration(t, now, *r.LatestStatusAt, time.Millisecond)
+	require.WithinDuration(t, successAt, *r.LatestSuccessAt, time.Millisecond)
+
+	rs, err := svc.ListReplications(ctx, influxdb.ReplicationListFilter{OrgID: createReq.OrgID})
+	require.NoError(t, err)
+	require.WithinDuration(t, successAt, *rs.Replications[0].LatestSuccessAt, time.Millisecond)
+}
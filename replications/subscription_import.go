@@ -0,0 +1,180 @@
+package replications
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+)
+
+// Modes of InfluxDB 1.x subscriptions.
+const (
+	// SubscriptionModeAll subscriptions forward every write to all of their destinations.
+	SubscriptionModeAll = "ALL"
+	// SubscriptionModeAny subscriptions forward each write to one of their destinations.
+	SubscriptionModeAny = "ANY"
+)
+
+// SubscriptionSpec describes an InfluxDB 1.x subscription to be imported as replications.
+//
+// Subscriptions only record the URLs of their destinations, so each destination is matched with an existing
+// remote with the same URL in the org, and must be given the ID of the bucket on that remote to replicate into.
+type SubscriptionSpec struct {
+	Name            string
+	Database        string
+	RetentionPolicy string
+	Mode            string
+	Destinations    []string
+
+	// LocalBucketID is the bucket the subscription's database and retention policy are mapped to.
+	LocalBucketID platform.ID
+	// RemoteBucketIDs maps each destination to the ID of the bucket to replicate into on its remote.
+	RemoteBucketIDs map[string]platform.ID
+	// MaxQueueSizeBytes is the max queue size of the replications created. Zero uses the default size.
+	MaxQueueSizeBytes int64
+}
+
+// SubscriptionImport is the result of importing a subscription: the replications created, and the destinations
+// which couldn't be mapped to a replication.
+type SubscriptionImport struct {
+	Replications []influxdb.Replication
+	Unmapped     []UnmappedDestination
+}
+
+// UnmappedDestination is a subscription destination which couldn't be imported, and why.
+type UnmappedDestination struct {
+	Destination string
+	Reason      string
+}
+
+// ImportFromSubscription creates a replication from the subscription's local bucket to each destination of an
+// InfluxDB 1.x subscription, easing migration from 1.x. Destinations which can't be mapped to a replication are
+// reported rather than failing the import. Since ANY-mode subscriptions write to a single destination, only their
+// first mappable destination is imported.
+func (s service) ImportFromSubscription(ctx context.Context, orgID platform.ID, sub SubscriptionSpec) (*SubscriptionImport, error) {
+	mode := strings.ToUpper(sub.Mode)
+	if mode != SubscriptionModeAll && mode != SubscriptionModeAny {
+		return nil, &ierrors.Error{
+			Code: ierrors.EInvalid,
+			Msg:  fmt.Sprintf("subscription mode must be %q or %q, got %q", SubscriptionModeAll, SubscriptionModeAny, sub.Mode),
+		}
+	}
+	maxQueueSizeBytes := sub.MaxQueueSizeBytes
+	if maxQueueSizeBytes == 0 {
+		maxQueueSizeBytes = influxdb.DefaultReplicationMaxQueueSizeBytes
+	}
+
+	remotes, err := s.remotesByURL(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SubscriptionImport{}
+	unmapped := func(dest, reason string) {
+		result.Unmapped = append(result.Unmapped, UnmappedDestination{Destination: dest, Reason: reason})
+	}
+	var requests []influxdb.CreateReplicationRequest
+	for _, dest := range sub.Destinations {
+		if mode == SubscriptionModeAny && len(requests) > 0 {
+			unmapped(dest, "ANY-mode subscriptions write to only one destination")
+			continue
+		}
+		remoteURL, reason := subscriptionRemoteURL(dest)
+		if reason != "" {
+			unmapped(dest, reason)
+			continue
+		}
+		remoteID, ok := remotes[remoteURL]
+		if !ok {
+			unmapped(dest, fmt.Sprintf("no remote with URL %q exists in the org", remoteURL))
+			continue
+		}
+		remoteBucketID, ok := sub.RemoteBucketIDs[dest]
+		if !ok {
+			unmapped(dest, "no remote bucket given for the destination")
+			continue
+		}
+
+		description := fmt.Sprintf("Imported from subscription %q on %q.%q", sub.Name, sub.Database, sub.RetentionPolicy)
+		requests = append(requests, influxdb.CreateReplicationRequest{
+			OrgID:             orgID,
+			Name:              fmt.Sprintf("%s: %s", sub.Name, dest),
+			Description:       &description,
+			RemoteID:          remoteID,
+			LocalBucketID:     sub.LocalBucketID,
+			RemoteBucketID:    remoteBucketID,
+			MaxQueueSizeBytes: maxQueueSizeBytes,
+		})
+	}
+
+	for _, req := range requests {
+		if err := req.OK(); err != nil {
+			return nil, err
+		}
+		r, err := s.CreateReplication(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		result.Replications = append(result.Replications, *r)
+	}
+	return result, nil
+}
+
+// subscriptionRemoteURL converts the URL of a subscription destination into the canonical URL of a remote, or
+// explains why it can't be.
+func subscriptionRemoteURL(dest string) (string, string) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "", fmt.Sprintf("invalid destination URL: %v", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+	case "":
+		return "", "invalid destination URL: missing scheme"
+	default:
+		return "", fmt.Sprintf("%s destinations are not supported, replications only write over HTTP", u.Scheme)
+	}
+	// Credentials belong to the remote, not its URL.
+	u.User = nil
+	remoteURL, err := influxdb.NormalizeRemoteURL(u.String())
+	if err != nil {
+		return "", fmt.Sprintf("invalid destination URL: %v", err)
+	}
+	return remoteURL, ""
+}
+
+// remotesByURL maps the canonical URLs of the remotes in an org to their IDs. If several remotes have the same
+// URL, the one with the lowest ID is used.
+func (s service) remotesByURL(ctx context.Context, orgID platform.ID) (map[string]platform.ID, error) {
+	q := sq.Select("id", "remote_url").From("remotes").Where(sq.Eq{"org_id": orgID}).OrderBy("id")
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rs []struct {
+		ID        platform.ID `db:"id"`
+		RemoteURL string      `db:"remote_url"`
+	}
+	if err := s.store.DB.SelectContext(ctx, &rs, query, args...); err != nil {
+		return nil, err
+	}
+
+	remotes := make(map[string]platform.ID, len(rs))
+	for _, r := range rs {
+		// Remotes created before URLs were normalized may not be stored in canonical form.
+		remoteURL, err := influxdb.NormalizeRemoteURL(r.RemoteURL)
+		if err != nil {
+			continue
+		}
+		if _, ok := remotes[remoteURL]; !ok {
+			remotes[remoteURL] = r.ID
+		}
+	}
+	return remotes, nil
+}
@@ -0,0 +1,120 @@
+package replications
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	ierrors "github.com/influxdata/influxdb/v2/kit/platform/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportFromSubscription(t *testing.T) {
+	t.Parallel()
+
+	remote1, remote2 := platform.ID(100), platform.ID(200)
+	dest1 := fmt.Sprintf("http://%s.cloud", remote1)
+	// Credentials and trailing slashes in destination URLs don't stop them matching a remote.
+	dest2 := fmt.Sprintf("http://admin:secret@%s.cloud/", remote2)
+	sub := SubscriptionSpec{
+		Name:            "sub0",
+		Database:        "telegraf",
+		RetentionPolicy: "autogen",
+		Mode:            "all",
+		Destinations:    []string{dest1, dest2, "udp://10.0.0.1:9999", "http://unknown.example.com:8086", "not a url"},
+		LocalBucketID:   replication.LocalBucketID,
+		RemoteBucketIDs: map[string]platform.ID{
+			dest1: platform.ID(1001),
+			dest2: platform.ID(2001),
+		},
+	}
+
+	setup := func(t *testing.T, replications int) (*service, func(t *testing.T)) {
+		svc, mocks, clean := newTestService(t)
+		insertRemote(t, svc.store, remote1)
+		insertRemote(t, svc.store, remote2)
+		mocks.bucketSvc.EXPECT().RLock().Times(replications)
+		mocks.bucketSvc.EXPECT().RUnlock().Times(replications)
+		mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), sub.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(replications)
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), influxdb.DefaultReplicationMaxQueueSizeBytes).Times(replications)
+		return svc, clean
+	}
+
+	t.Run("all", func(t *testing.T) {
+		svc, clean := setup(t, 2)
+		defer clean(t)
+
+		imported, err := svc.ImportFromSubscription(ctx, replication.OrgID, sub)
+		require.NoError(t, err)
+
+		description := `Imported from subscription "sub0" on "telegraf"."autogen"`
+		require.Len(t, imported.Replications, 2)
+		for i, want := range []struct {
+			name           string
+			remoteID       platform.ID
+			remoteBucketID platform.ID
+		}{
+			{"sub0: " + dest1, remote1, 1001},
+			{"sub0: " + dest2, remote2, 2001},
+		} {
+			r := imported.Replications[i]
+			require.Equal(t, want.name, r.Name)
+			require.Equal(t, description, *r.Description)
+			require.Equal(t, replication.OrgID, r.OrgID)
+			require.Equal(t, want.remoteID, r.RemoteID)
+			require.Equal(t, sub.LocalBucketID, r.LocalBucketID)
+			require.Equal(t, want.remoteBucketID, r.RemoteBucketID)
+			require.Equal(t, influxdb.DefaultReplicationMaxQueueSizeBytes, r.MaxQueueSizeBytes)
+		}
+
+		require.Len(t, imported.Unmapped, 3)
+		require.Equal(t, "udp://10.0.0.1:9999", imported.Unmapped[0].Destination)
+		require.Contains(t, imported.Unmapped[0].Reason, "udp destinations are not supported")
+		require.Equal(t, "http://unknown.example.com:8086", imported.Unmapped[1].Destination)
+		require.Contains(t, imported.Unmapped[1].Reason, "no remote")
+		require.Equal(t, "not a url", imported.Unmapped[2].Destination)
+	})
+
+	t.Run("any", func(t *testing.T) {
+		svc, clean := setup(t, 1)
+		defer clean(t)
+
+		anySub := sub
+		anySub.Mode = SubscriptionModeAny
+		anySub.Destinations = []string{"udp://10.0.0.1:9999", dest2, dest1}
+		imported, err := svc.ImportFromSubscription(ctx, replication.OrgID, anySub)
+		require.NoError(t, err)
+
+		// Only the first destination which can be mapped is imported.
+		require.Len(t, imported.Replications, 1)
+		require.Equal(t, remote2, imported.Replications[0].RemoteID)
+		require.Len(t, imported.Unmapped, 2)
+		require.Equal(t, dest1, imported.Unmapped[1].Destination)
+		require.Contains(t, imported.Unmapped[1].Reason, "only one destination")
+	})
+
+	t.Run("missing remote bucket", func(t *testing.T) {
+		svc, clean := setup(t, 0)
+		defer clean(t)
+
+		noBuckets := sub
+		noBuckets.Destinations = []string{dest1}
+		noBuckets.RemoteBucketIDs = nil
+		imported, err := svc.ImportFromSubscription(ctx, replication.OrgID, noBuckets)
+		require.NoError(t, err)
+		require.Empty(t, imported.Replications)
+		require.Equal(t, []UnmappedDestination{{Destination: dest1, Reason: "no remote bucket given for the destination"}}, imported.Unmapped)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		svc, clean := setup(t, 0)
+		defer clean(t)
+
+		invalid := sub
+		invalid.Mode = "SOME"
+		_, err := svc.ImportFromSubscription(ctx, replication.OrgID, invalid)
+		require.Equal(t, ierrors.EInvalid, ierrors.ErrorCode(err))
+	})
+}
@@ -0,0 +1,71 @@
+package replications
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/replications/metrics"
+)
+
+// shiftedPoint is a point whose timestamp is serialized shifted by an offset, without copying the point.
+type shiftedPoint struct {
+	models.Point
+	offset time.Duration
+}
+
+func (p shiftedPoint) Time() time.Time {
+	return p.Point.Time().Add(p.offset)
+}
+
+func (p shiftedPoint) UnixNano() int64 {
+	return p.Time().UnixNano()
+}
+
+func (p shiftedPoint) String() string {
+	return p.PrecisionString("ns")
+}
+
+func (p shiftedPoint) PrecisionString(precision string) string {
+	s := p.Point.PrecisionString(precision)
+	// The timestamp is always the last element of a line.
+	i := strings.LastIndexByte(s, ' ')
+	return s[:i+1] + strconv.FormatInt(p.UnixNano()/models.GetPrecisionMultiplier(precision), 10)
+}
+
+// shiftTimestamps returns the points with their timestamps shifted by offset, and the number of points left out
+// because the offset would move them out of the range of valid timestamps. Points without a timestamp are kept
+// as they are, for the remote to timestamp. The given points aren't modified, so local writes keep the original
+// timestamps.
+func shiftTimestamps(points []models.Point, offset time.Duration) ([]models.Point, int) {
+	if offset == 0 {
+		return points, 0
+	}
+	shifted := make([]models.Point, 0, len(points))
+	var outOfRange int
+	for _, p := range points {
+		if p.Time().IsZero() {
+			shifted = append(shifted, p)
+			continue
+		}
+		if err := models.CheckTime(p.Time().Add(offset)); err != nil {
+			outOfRange++
+			continue
+		}
+		shifted = append(shifted, shiftedPoint{Point: p, offset: offset})
+	}
+	return shifted, outOfRange
+}
+
+// shiftGroupTimestamps shifts the timestamps of the points enqueued into a group of replications by the group's
+// offset, counting points shifted out of range as dropped for each replication.
+func (s service) shiftGroupTimestamps(group filterGroup, points []models.Point) []models.Point {
+	shifted, outOfRange := shiftTimestamps(points, group.timestampOffset)
+	if outOfRange > 0 {
+		for _, t := range group.targets {
+			s.metrics.DroppedPoints.WithLabelValues(t.ID.String(), metrics.DropReasonTimestampOutOfRange).Add(float64(outOfRange))
+		}
+	}
+	return shifted
+}
@@ -0,0 +1,96 @@
+package replications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShiftTimestamps(t *testing.T) {
+	t.Parallel()
+
+	points := mustParsePoints(t, "cpu,host=A value=1.2,msg=\"a b\" 2000000000\ncpu,host=B value=2 3000000000")
+
+	shifted, outOfRange := shiftTimestamps(points, 0)
+	require.Zero(t, outOfRange)
+	require.Equal(t, points, shifted)
+
+	shifted, outOfRange = shiftTimestamps(points, -time.Second)
+	require.Zero(t, outOfRange)
+	require.Len(t, shifted, 2)
+	require.Equal(t, `cpu,host=A value=1.2,msg="a b" 1000000000`, shifted[0].String())
+	require.Equal(t, "cpu,host=B value=2 2", shifted[1].PrecisionString("s"))
+	require.Equal(t, int64(2000000000), shifted[1].UnixNano())
+	// The original points are untouched.
+	require.Equal(t, int64(2000000000), points[0].UnixNano())
+
+	// Points shifted past the range of valid timestamps are left out.
+	late := mustParsePoints(t, "cpu value=1 9223372036000000000")
+	shifted, outOfRange = shiftTimestamps(append(points[:1:1], late...), time.Hour)
+	require.Equal(t, 1, outOfRange)
+	require.Len(t, shifted, 1)
+	require.Equal(t, int64(2000000000)+int64(time.Hour), shifted[0].UnixNano())
+}
+
+func TestWritePoints_TimestampOffset(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	// Register a replication shifting timestamps back a day, next to one leaving them alone.
+	shiftedReq := createReq
+	shiftedReq.Name = "test2"
+	shiftedReq.TimestampOffsetSeconds = -24 * 60 * 60
+	mocks.bucketSvc.EXPECT().RLock().Times(2)
+	mocks.bucketSvc.EXPECT().RUnlock().Times(2)
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil).Times(2)
+	insertRemote(t, svc.store, createReq.RemoteID)
+	for _, req := range []influxdb.CreateReplicationRequest{createReq, shiftedReq} {
+		mocks.durableQueueManager.EXPECT().InitializeQueue(gomock.Any(), req.MaxQueueSizeBytes)
+		_, err := svc.CreateReplication(ctx, req)
+		require.NoError(t, err)
+	}
+	regularID, shiftedID := initID, initID+1
+
+	mocks.durableQueueManager.EXPECT().CurrentQueueSizes([]platform.ID{shiftedID})
+	got, err := svc.GetReplication(ctx, shiftedID)
+	require.NoError(t, err)
+	require.Equal(t, shiftedReq.TimestampOffsetSeconds, got.TimestampOffsetSeconds)
+
+	ts := time.Date(2021, time.October, 2, 0, 0, 0, 0, time.UTC)
+	points := []models.Point{models.MustNewPoint("cpu", models.NewTags(map[string]string{"host": "A"}), models.Fields{"value": 1.2}, ts)}
+
+	// Local storage gets the original timestamps.
+	mocks.pointWriter.EXPECT().WritePoints(gomock.Any(), replication.OrgID, replication.LocalBucketID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ platform.ID, written []models.Point) error {
+			require.Len(t, written, 1)
+			require.Equal(t, ts.UnixNano(), written[0].UnixNano())
+			return nil
+		})
+	var regular, shifted []byte
+	mocks.durableQueueManager.EXPECT().EnqueueData(regularID, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+		regular = gunzip(t, data)
+		return nil
+	})
+	mocks.durableQueueManager.EXPECT().EnqueueData(shiftedID, gomock.Any(), gomock.Any()).DoAndReturn(func(_ platform.ID, data []byte, _ int) error {
+		shifted = gunzip(t, data)
+		return nil
+	})
+	require.NoError(t, svc.WritePoints(ctx, replication.OrgID, replication.LocalBucketID, points))
+
+	require.Equal(t, "cpu,host=A value=1.2 1633132800000000000\n", string(regular))
+	require.Equal(t, "cpu,host=A value=1.2 1633046400000000000\n", string(shifted))
+
+	// Offsets beyond the limit are rejected.
+	tooFar := influxdb.MaxReplicationTimestampOffsetSeconds + 1
+	require.Error(t, (&influxdb.UpdateReplicationRequest{TimestampOffsetSeconds: &tooFar}).OK())
+	shiftedReq.TimestampOffsetSeconds = -tooFar
+	require.Error(t, shiftedReq.OK())
+}
@@ -3,6 +3,7 @@ package transport
 import (
 	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -35,6 +36,16 @@ var (
 		Msg:  "invalid local bucket ID",
 	}
 
+	errBadPage = &errors.Error{
+		Code: errors.EInvalid,
+		Msg:  "limit and offset must be non-negative integers",
+	}
+
+	errBadDescending = &errors.Error{
+		Code: errors.EInvalid,
+		Msg:  "descending must be true or false",
+	}
+
 	errBadId = &errors.Error{
 		Code: errors.EInvalid,
 		Msg:  "replication ID is invalid",
@@ -175,6 +186,31 @@ func (h *ReplicationHandler) handleGetReplications(w http.ResponseWriter, r *htt
 		filters.LocalBucketID = i
 	}
 
+	// limit, offset, sortBy, and descending page through the results.
+	for param, dst := range map[string]*int{"limit": &filters.Limit, "offset": &filters.Offset} {
+		if v := q.Get(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				h.api.Err(w, r, errBadPage)
+				return
+			}
+			*dst = n
+		}
+	}
+	filters.SortBy = q.Get("sortBy")
+	if v := q.Get("descending"); v != "" {
+		d, err := strconv.ParseBool(v)
+		if err != nil {
+			h.api.Err(w, r, errBadDescending)
+			return
+		}
+		filters.Descending = d
+	}
+	if err := filters.OK(); err != nil {
+		h.api.Err(w, r, err)
+		return
+	}
+
 	rs, err := h.replicationsService.ListReplications(r.Context(), filters)
 	if err != nil {
 		h.api.Err(w, r, err)
@@ -72,6 +72,48 @@ func TestReplicationHandler(t *testing.T) {
 		require.Equal(t, expected, got)
 	})
 
+	t.Run("get replications paginated", func(t *testing.T) {
+		ts, svc := newTestServer(t)
+		defer ts.Close()
+
+		req := newTestRequest(t, "GET", ts.URL, nil)
+
+		q := req.URL.Query()
+		q.Add("orgID", orgStr)
+		q.Add("limit", "10")
+		q.Add("offset", "20")
+		q.Add("sortBy", "name")
+		q.Add("descending", "true")
+		req.URL.RawQuery = q.Encode()
+
+		expected := influxdb.Replications{Replications: []influxdb.Replication{testReplication}, TotalCount: 21}
+
+		svc.EXPECT().
+			ListReplications(gomock.Any(), influxdb.ReplicationListFilter{
+				OrgID:      *orgID,
+				Limit:      10,
+				Offset:     20,
+				SortBy:     "name",
+				Descending: true,
+			}).Return(&expected, nil)
+
+		res := doTestRequest(t, req, http.StatusOK, true)
+
+		var got influxdb.Replications
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+		require.Equal(t, expected, got)
+	})
+
+	t.Run("get replications with an invalid page", func(t *testing.T) {
+		ts, _ := newTestServer(t)
+		defer ts.Close()
+
+		for _, param := range []string{"limit=-1", "offset=x", "sortBy=bogus"} {
+			req := newTestRequest(t, "GET", ts.URL+"?orgID="+orgStr+"&"+param, nil)
+			doTestRequest(t, req, http.StatusBadRequest, true)
+		}
+	})
+
 	t.Run("create replication happy path", func(t *testing.T) {
 
 		body := influxdb.CreateReplicationRequest{
@@ -20,6 +20,16 @@ type authCheckingService struct {
 var _ ReplicationService = (*authCheckingService)(nil)
 
 func (a authCheckingService) ListReplications(ctx context.Context, filter influxdb.ReplicationListFilter) (*influxdb.Replications, error) {
+	// Replications the caller can't read are filtered out before paginating, so pages, and the total count,
+	// only cover the ones they can. Everything matching is listed, in the requested order, and paged here.
+	page := filter
+	if filter.Paginated() {
+		filter.Limit, filter.Offset = 0, 0
+		if filter.SortBy == "" {
+			filter.SortBy = "id"
+		}
+	}
+
 	rs, err := a.underlying.ListReplications(ctx, filter)
 	if err != nil {
 		return nil, err
@@ -36,7 +46,20 @@ func (a authCheckingService) ListReplications(ctx context.Context, filter influx
 		}
 		rrs = append(rrs, r)
 	}
-	return &influxdb.Replications{Replications: rrs}, nil
+	if !page.Paginated() {
+		return &influxdb.Replications{Replications: rrs}, nil
+	}
+
+	total := len(rrs)
+	if page.Offset < total {
+		rrs = rrs[page.Offset:]
+	} else {
+		rrs = rrs[:0]
+	}
+	if page.Limit > 0 && len(rrs) > page.Limit {
+		rrs = rrs[:page.Limit]
+	}
+	return &influxdb.Replications{Replications: rrs, TotalCount: total}, nil
 }
 
 func (a authCheckingService) CreateReplication(ctx context.Context, request influxdb.CreateReplicationRequest) (*influxdb.Replication, error) {
@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	icontext "github.com/influxdata/influxdb/v2/context"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	influxdbmock "github.com/influxdata/influxdb/v2/mock"
+	"github.com/influxdata/influxdb/v2/replications/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthCheckingService_ListReplicationsPaginated(t *testing.T) {
+	readableOrg, otherOrg := platform.ID(1), platform.ID(2)
+
+	var all []influxdb.Replication
+	for i := 1; i <= 6; i++ {
+		org := readableOrg
+		if i%2 == 0 {
+			org = otherOrg
+		}
+		all = append(all, influxdb.Replication{ID: platform.ID(i), OrgID: org})
+	}
+
+	ctx := icontext.SetAuthorizer(context.Background(), influxdbmock.NewMockAuthorizer(false, []influxdb.Permission{{
+		Action:   influxdb.ReadAction,
+		Resource: influxdb.Resource{Type: influxdb.ReplicationsResourceType, OrgID: &readableOrg},
+	}}))
+
+	tests := []struct {
+		name   string
+		filter influxdb.ReplicationListFilter
+		want   []platform.ID
+	}{
+		{name: "first page", filter: influxdb.ReplicationListFilter{Limit: 2}, want: []platform.ID{1, 3}},
+		{name: "last page", filter: influxdb.ReplicationListFilter{Limit: 2, Offset: 2}, want: []platform.ID{5}},
+		{name: "past the end", filter: influxdb.ReplicationListFilter{Limit: 2, Offset: 4}, want: []platform.ID{}},
+		{name: "offset only", filter: influxdb.ReplicationListFilter{Offset: 1, SortBy: "name"}, want: []platform.ID{3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			underlying := mock.NewMockReplicationService(gomock.NewController(t))
+			svc := newAuthCheckingService(underlying)
+
+			// Everything matching is listed, in the requested order, so it can be paged after filtering.
+			want := tt.filter
+			want.Limit, want.Offset = 0, 0
+			if want.SortBy == "" {
+				want.SortBy = "id"
+			}
+			rs := append([]influxdb.Replication(nil), all...)
+			underlying.EXPECT().ListReplications(gomock.Any(), want).Return(&influxdb.Replications{Replications: rs}, nil)
+
+			got, err := svc.ListReplications(ctx, tt.filter)
+			require.NoError(t, err)
+			require.Equal(t, 3, got.TotalCount)
+			ids := []platform.ID{}
+			for _, r := range got.Replications {
+				ids = append(ids, r.ID)
+			}
+			require.Equal(t, tt.want, ids)
+		})
+	}
+}
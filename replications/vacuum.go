@@ -0,0 +1,27 @@
+package replications
+
+import (
+	"context"
+	"fmt"
+)
+
+// replicationTables are the tables in the metadata store holding remotes and replications.
+var replicationTables = []string{"remotes", "replications", "replication_egress"}
+
+// Vacuum reclaims the space left in the metadata store by deleted remotes and replications, and refreshes the
+// query planner's statistics for their tables. SQLite can only vacuum a database as a whole, so the entire store
+// is rebuilt, holding the store's write lock throughout. It's intended to be run during a maintenance window.
+func (s service) Vacuum(ctx context.Context) error {
+	s.store.Mu.Lock()
+	defer s.store.Mu.Unlock()
+
+	for _, table := range replicationTables {
+		if _, err := s.store.DB.ExecContext(ctx, "ANALYZE "+table); err != nil {
+			return fmt.Errorf("failed to analyze table %q: %w", table, err)
+		}
+	}
+	if _, err := s.store.DB.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum metadata store: %w", err)
+	}
+	return nil
+}
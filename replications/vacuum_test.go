@@ -0,0 +1,73 @@
+package replications
+
+import (
+	"strings"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVacuum(t *testing.T) {
+	t.Parallel()
+
+	svc, _, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, replication.RemoteID)
+
+	pages := func(pragma string) int64 {
+		t.Helper()
+		var n int64
+		require.NoError(t, svc.store.DB.Get(&n, "PRAGMA "+pragma))
+		return n
+	}
+
+	// churn creates and deletes a batch of replications with large descriptions, as repeatedly creating and
+	// deleting replications would.
+	description := strings.Repeat("x", 4096)
+	churn := func() {
+		t.Helper()
+		for round := 0; round < 10; round++ {
+			for i := 0; i < 50; i++ {
+				id := platform.ID(round*50 + i + 1)
+				q := sq.Insert("replications").SetMap(sq.Eq{
+					"id":                      id,
+					"org_id":                  replication.OrgID,
+					"name":                    id.String(),
+					"description":             description,
+					"remote_id":               replication.RemoteID,
+					"local_bucket_id":         replication.LocalBucketID,
+					"remote_bucket_id":        replication.RemoteBucketID,
+					"max_queue_size_bytes":    replication.MaxQueueSizeBytes,
+					"drop_non_retryable_data": false,
+					"created_at":              "datetime('now')",
+					"updated_at":              "datetime('now')",
+				})
+				query, args, err := q.ToSql()
+				require.NoError(t, err)
+				_, err = svc.store.DB.Exec(query, args...)
+				require.NoError(t, err)
+			}
+			_, err := svc.store.DB.Exec("DELETE FROM replications")
+			require.NoError(t, err)
+		}
+	}
+
+	churn()
+	churned := pages("page_count")
+	require.Positive(t, pages("freelist_count"))
+
+	require.NoError(t, svc.Vacuum(ctx))
+	require.Zero(t, pages("freelist_count"))
+	vacuumed := pages("page_count")
+	require.Less(t, vacuumed, churned)
+
+	// Further churn doesn't grow the store beyond what vacuuming reclaims.
+	for i := 0; i < 3; i++ {
+		churn()
+		require.NoError(t, svc.Vacuum(ctx))
+		require.LessOrEqual(t, pages("page_count"), vacuumed)
+	}
+}
@@ -0,0 +1,235 @@
+package replications
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/influxdata/influxdb/v2/sqlite"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWebhookDebounce = 30 * time.Second
+	webhookAttempts        = 3
+	webhookRetryBackoff    = time.Second
+	webhookTimeout         = 10 * time.Second
+)
+
+// States reported by replication webhook notifications.
+const (
+	WebhookStateFailing   = "failing"
+	WebhookStateRecovered = "recovered"
+)
+
+// WebhookNotification is the JSON payload POSTed to the failure webhook when a replication starts failing
+// or recovers.
+type WebhookNotification struct {
+	ReplicationID platform.ID `json:"replicationID"`
+	Name          string      `json:"name"`
+	State         string      `json:"state"`
+	LastError     *string     `json:"lastError,omitempty"`
+	Time          time.Time   `json:"time"`
+}
+
+// webhookNotifier POSTs a notification to a webhook whenever writes to a replication's remote start failing,
+// and when they succeed again. Notifications are debounced: a replication must stay in its new state for the
+// debounce period before it's reported, so a replication flapping between failing and succeeding doesn't
+// send a notification per write. Failed deliveries are retried a few times with backoff.
+type webhookNotifier struct {
+	url      string
+	debounce time.Duration
+	backoff  time.Duration
+	client   *http.Client
+	store    *sqlite.SqlStore
+	log      *zap.Logger
+	now      func() time.Time
+
+	mu     sync.Mutex
+	states map[platform.ID]*webhookState
+	wg     sync.WaitGroup
+}
+
+type webhookState struct {
+	// failing is the state of the latest write, and notified is the state last reported to the webhook.
+	failing   bool
+	notified  bool
+	lastError string
+	// timer is pending while failing differs from notified, and reports the change once it fires.
+	timer *time.Timer
+}
+
+func newWebhookNotifier(url string, debounce time.Duration, store *sqlite.SqlStore, log *zap.Logger) *webhookNotifier {
+	if debounce <= 0 {
+		debounce = defaultWebhookDebounce
+	}
+	return &webhookNotifier{
+		url:      url,
+		debounce: debounce,
+		backoff:  webhookRetryBackoff,
+		client:   &http.Client{Timeout: webhookTimeout},
+		store:    store,
+		log:      log,
+		now:      time.Now,
+		states:   make(map[platform.ID]*webhookState),
+	}
+}
+
+// observe wraps a durable queue write function, tracking whether each replication is failing. A nil notifier
+// returns the write function unchanged.
+func (n *webhookNotifier) observe(write func(platform.ID, []byte) error) func(platform.ID, []byte) error {
+	if n == nil {
+		return write
+	}
+	return func(replicationID platform.ID, data []byte) error {
+		err := write(replicationID, data)
+		n.record(replicationID, err)
+		return err
+	}
+}
+
+// record tracks the outcome of a write, scheduling a notification if it changed the replication's state.
+func (n *webhookNotifier) record(id platform.ID, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	st, ok := n.states[id]
+	if !ok {
+		st = &webhookState{}
+		n.states[id] = st
+	}
+	failing := err != nil
+	if failing {
+		st.lastError = err.Error()
+	}
+	if failing == st.failing {
+		return
+	}
+	st.failing = failing
+
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	// Changing back to the state last reported within the debounce period cancels the notification.
+	if failing == st.notified {
+		return
+	}
+	st.timer = time.AfterFunc(n.debounce, func() { n.fire(id) })
+}
+
+// fire reports the state of a replication if it still differs from the state last reported.
+func (n *webhookNotifier) fire(id platform.ID) {
+	n.mu.Lock()
+	st, ok := n.states[id]
+	if !ok || st.failing == st.notified {
+		n.mu.Unlock()
+		return
+	}
+	st.notified = st.failing
+	st.timer = nil
+
+	notification := WebhookNotification{
+		ReplicationID: id,
+		State:         WebhookStateRecovered,
+		Time:          n.now(),
+	}
+	if st.failing {
+		notification.State = WebhookStateFailing
+		lastError := st.lastError
+		notification.LastError = &lastError
+	}
+	n.wg.Add(1)
+	n.mu.Unlock()
+
+	defer n.wg.Done()
+	if err := n.send(context.Background(), notification); err != nil {
+		n.log.Warn("Failed to send replication webhook notification", zap.String("id", id.String()),
+			zap.String("state", notification.State), zap.Error(err))
+	}
+}
+
+// send looks up the name of the replication and delivers a notification, retrying failed deliveries.
+func (n *webhookNotifier) send(ctx context.Context, notification WebhookNotification) error {
+	query, args, err := sq.Select("name").From("replications").Where(sq.Eq{"id": notification.ReplicationID}).ToSql()
+	if err != nil {
+		return err
+	}
+	if err := n.store.DB.GetContext(ctx, &notification.Name, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The replication was deleted since the write.
+			return nil
+		}
+		return err
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, body)
+		if err == nil || attempt+1 >= webhookAttempts {
+			return err
+		}
+		time.Sleep(n.backoff << attempt)
+	}
+}
+
+func (n *webhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// forget drops the state of a deleted replication, cancelling any pending notification.
+func (n *webhookNotifier) forget(id platform.ID) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if st, ok := n.states[id]; ok && st.timer != nil {
+		st.timer.Stop()
+	}
+	delete(n.states, id)
+}
+
+// close cancels pending notifications, and waits for notifications being sent to finish.
+func (n *webhookNotifier) close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	for _, st := range n.states {
+		if st.timer != nil {
+			st.timer.Stop()
+			st.timer = nil
+		}
+	}
+	n.mu.Unlock()
+
+	n.wg.Wait()
+}
@@ -0,0 +1,109 @@
+package replications
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/platform"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	t.Parallel()
+
+	svc, mocks, clean := newTestService(t)
+	defer clean(t)
+
+	insertRemote(t, svc.store, createReq.RemoteID)
+	mocks.bucketSvc.EXPECT().RLock()
+	mocks.bucketSvc.EXPECT().RUnlock()
+	mocks.bucketSvc.EXPECT().FindBucketByID(gomock.Any(), createReq.LocalBucketID).Return(&influxdb.Bucket{}, nil)
+	mocks.durableQueueManager.EXPECT().InitializeQueue(initID, createReq.MaxQueueSizeBytes)
+	_, err := svc.CreateReplication(ctx, createReq)
+	require.NoError(t, err)
+
+	// The receiver rejects the first delivery attempt of every notification, to exercise retries.
+	var attempts int32
+	received := make(chan WebhookNotification, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if atomic.AddInt32(&attempts, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var n WebhookNotification
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+		received <- n
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	notifier := newWebhookNotifier(receiver.URL, 50*time.Millisecond, svc.store, zaptest.NewLogger(t))
+	notifier.backoff = time.Millisecond
+	defer notifier.close()
+
+	var writeErr error
+	write := notifier.observe(func(platform.ID, []byte) error { return writeErr })
+	expect := func(state string) WebhookNotification {
+		t.Helper()
+		select {
+		case n := <-received:
+			require.Equal(t, initID, n.ReplicationID)
+			require.Equal(t, createReq.Name, n.Name)
+			require.Equal(t, state, n.State)
+			return n
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s notification received", state)
+			return WebhookNotification{}
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case n := <-received:
+			t.Fatalf("unexpected notification: %+v", n)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	// Successful writes to a healthy replication don't notify.
+	require.NoError(t, write(initID, nil))
+	expectNone()
+
+	// Repeated failures notify once, with the latest error.
+	writeErr = errors.New("connection refused")
+	require.Error(t, write(initID, nil))
+	writeErr = errors.New("remote unavailable")
+	require.Error(t, write(initID, nil))
+	n := expect(WebhookStateFailing)
+	require.Equal(t, "remote unavailable", *n.LastError)
+	require.Error(t, write(initID, nil))
+	expectNone()
+
+	// Recovering notifies once.
+	writeErr = nil
+	require.NoError(t, write(initID, nil))
+	require.NoError(t, write(initID, nil))
+	n = expect(WebhookStateRecovered)
+	require.Nil(t, n.LastError)
+	expectNone()
+
+	// Flapping back within the debounce period doesn't notify at all.
+	writeErr = errors.New("connection refused")
+	require.Error(t, write(initID, nil))
+	writeErr = nil
+	require.NoError(t, write(initID, nil))
+	expectNone()
+
+	// Every notification needed a retry.
+	require.Equal(t, int32(4), atomic.LoadInt32(&attempts))
+}
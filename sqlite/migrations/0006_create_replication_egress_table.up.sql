@@ -0,0 +1,7 @@
+CREATE TABLE replication_egress
+(
+    org_id       VARCHAR(16) NOT NULL PRIMARY KEY,
+    period_start TIMESTAMP   NOT NULL,
+    bytes_sent   INTEGER     NOT NULL,
+    quota_bytes  INTEGER
+);
@@ -0,0 +1,3 @@
+ALTER TABLE replications DROP COLUMN consecutive_failures;
+ALTER TABLE replications DROP COLUMN delivered_points;
+ALTER TABLE replications DROP COLUMN delivered_bytes;
@@ -0,0 +1,3 @@
+ALTER TABLE replications ADD COLUMN delivered_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE replications ADD COLUMN delivered_points INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE replications ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE replications DROP COLUMN enqueue_on_local_failure;
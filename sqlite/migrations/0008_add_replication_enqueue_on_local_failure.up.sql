@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN enqueue_on_local_failure BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN durability_tier TEXT NOT NULL DEFAULT 'best_effort';
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN serialized_enqueue BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE replications DROP COLUMN remote_bucket_missing;
+ALTER TABLE replications DROP COLUMN remote_bucket_deleted_policy;
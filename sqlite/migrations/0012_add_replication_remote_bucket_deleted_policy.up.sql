@@ -0,0 +1,2 @@
+ALTER TABLE replications ADD COLUMN remote_bucket_deleted_policy TEXT NOT NULL DEFAULT 'pause-and-alert';
+ALTER TABLE replications ADD COLUMN remote_bucket_missing BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN ordered_delivery BOOLEAN NOT NULL DEFAULT FALSE;
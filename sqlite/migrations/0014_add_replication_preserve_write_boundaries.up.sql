@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN preserve_write_boundaries BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN filter_expression TEXT;
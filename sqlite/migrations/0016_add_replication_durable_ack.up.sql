@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN durable_ack BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE remotes ADD COLUMN remote_content_type TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE replications DROP COLUMN paused_until;
+ALTER TABLE replications DROP COLUMN paused;
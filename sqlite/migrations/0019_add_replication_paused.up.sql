@@ -0,0 +1,2 @@
+ALTER TABLE replications ADD COLUMN paused BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE replications ADD COLUMN paused_until TIMESTAMP;
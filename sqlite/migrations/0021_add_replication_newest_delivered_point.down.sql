@@ -0,0 +1 @@
+ALTER TABLE replications DROP COLUMN newest_delivered_point_ns;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN newest_delivered_point_ns INTEGER;
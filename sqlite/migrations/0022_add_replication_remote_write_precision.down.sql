@@ -0,0 +1 @@
+ALTER TABLE replications DROP COLUMN remote_write_precision;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN remote_write_precision TEXT NOT NULL DEFAULT 'ns';
@@ -0,0 +1 @@
+ALTER TABLE replications DROP COLUMN flush_interval_seconds;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN flush_interval_seconds INTEGER NOT NULL DEFAULT 0;
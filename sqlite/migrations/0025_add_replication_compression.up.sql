@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN compression TEXT NOT NULL DEFAULT 'gzip';
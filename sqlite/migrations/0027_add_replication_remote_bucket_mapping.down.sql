@@ -0,0 +1,2 @@
+ALTER TABLE replications DROP COLUMN remote_bucket_mapping;
+ALTER TABLE replications DROP COLUMN remote_bucket_tag;
@@ -0,0 +1,2 @@
+ALTER TABLE replications ADD COLUMN remote_bucket_tag TEXT;
+ALTER TABLE replications ADD COLUMN remote_bucket_mapping TEXT;
@@ -0,0 +1 @@
+ALTER TABLE replications DROP COLUMN block_on_full_queue;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN block_on_full_queue BOOLEAN NOT NULL DEFAULT FALSE;
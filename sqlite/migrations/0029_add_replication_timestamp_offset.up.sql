@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN timestamp_offset_seconds INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN measurement_filter TEXT;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN tag_filter TEXT;
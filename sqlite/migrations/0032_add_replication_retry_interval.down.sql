@@ -0,0 +1,2 @@
+ALTER TABLE replications DROP COLUMN max_retry_interval_seconds;
+ALTER TABLE replications DROP COLUMN retry_interval_seconds;
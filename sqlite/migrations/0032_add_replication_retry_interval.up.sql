@@ -0,0 +1,2 @@
+ALTER TABLE replications ADD COLUMN retry_interval_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE replications ADD COLUMN max_retry_interval_seconds INTEGER NOT NULL DEFAULT 0;
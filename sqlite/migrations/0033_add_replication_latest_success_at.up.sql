@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN latest_success_at TIMESTAMP;
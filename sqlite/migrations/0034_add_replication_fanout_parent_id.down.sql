@@ -0,0 +1,3 @@
+DROP INDEX idx_fanout_parent_id;
+
+ALTER TABLE replications DROP COLUMN fanout_parent_id;
@@ -0,0 +1,3 @@
+ALTER TABLE replications ADD COLUMN fanout_parent_id VARCHAR(16);
+
+CREATE INDEX idx_fanout_parent_id ON replications (fanout_parent_id);
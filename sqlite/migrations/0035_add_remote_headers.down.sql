@@ -0,0 +1 @@
+ALTER TABLE remotes DROP COLUMN remote_headers;
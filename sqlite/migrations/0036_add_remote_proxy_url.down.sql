@@ -0,0 +1 @@
+ALTER TABLE remotes DROP COLUMN proxy_url;
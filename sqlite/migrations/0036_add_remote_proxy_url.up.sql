@@ -0,0 +1 @@
+ALTER TABLE remotes ADD COLUMN proxy_url TEXT;
@@ -0,0 +1 @@
+ALTER TABLE remotes DROP COLUMN write_timeout_seconds;
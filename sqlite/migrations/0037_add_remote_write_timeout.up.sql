@@ -0,0 +1 @@
+ALTER TABLE remotes ADD COLUMN write_timeout_seconds INTEGER;
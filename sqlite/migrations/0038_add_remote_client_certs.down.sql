@@ -0,0 +1,3 @@
+ALTER TABLE remotes DROP COLUMN ca_cert;
+ALTER TABLE remotes DROP COLUMN client_key;
+ALTER TABLE remotes DROP COLUMN client_cert;
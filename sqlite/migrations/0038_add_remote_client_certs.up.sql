@@ -0,0 +1,3 @@
+ALTER TABLE remotes ADD COLUMN client_cert TEXT;
+ALTER TABLE remotes ADD COLUMN client_key TEXT;
+ALTER TABLE remotes ADD COLUMN ca_cert TEXT;
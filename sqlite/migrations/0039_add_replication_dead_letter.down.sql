@@ -0,0 +1,2 @@
+ALTER TABLE replications DROP COLUMN dead_letter_bucket_id;
+ALTER TABLE replications DROP COLUMN dead_lettered_points;
@@ -0,0 +1,2 @@
+ALTER TABLE replications ADD COLUMN dead_letter_bucket_id VARCHAR(16);
+ALTER TABLE replications ADD COLUMN dead_lettered_points INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE replications DROP COLUMN remote_retention_policy;
+ALTER TABLE replications DROP COLUMN remote_database;
+ALTER TABLE remotes DROP COLUMN remote_username;
+ALTER TABLE remotes DROP COLUMN remote_api_type;
@@ -0,0 +1,4 @@
+ALTER TABLE remotes ADD COLUMN remote_api_type TEXT;
+ALTER TABLE remotes ADD COLUMN remote_username TEXT;
+ALTER TABLE replications ADD COLUMN remote_database TEXT;
+ALTER TABLE replications ADD COLUMN remote_retention_policy TEXT;
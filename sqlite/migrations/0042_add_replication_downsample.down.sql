@@ -0,0 +1 @@
+ALTER TABLE replications DROP COLUMN downsample;
@@ -0,0 +1 @@
+ALTER TABLE replications ADD COLUMN rename_rules TEXT;
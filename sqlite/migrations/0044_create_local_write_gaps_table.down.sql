@@ -0,0 +1 @@
+DROP TABLE local_write_gaps;
@@ -0,0 +1,7 @@
+CREATE TABLE local_write_gaps
+(
+    bucket_id  VARCHAR(16) NOT NULL,
+    start_time TIMESTAMP   NOT NULL,
+    end_time   TIMESTAMP,
+    PRIMARY KEY (bucket_id, start_time)
+);
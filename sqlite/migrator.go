@@ -4,6 +4,7 @@ import (
 	"context"
 	"embed"
 	"fmt"
+	"io/fs"
 	"os"
 	"sort"
 	"strconv"
@@ -48,16 +49,9 @@ func (m *Migrator) Up(ctx context.Context, source embed.FS) error {
 		return err
 	}
 
-	var lastMigration int
-	for idx := range executedMigrations {
-		if idx > len(knownMigrations)-1 || executedMigrations[idx] != dropExtension(knownMigrations[idx].Name()) {
-			return migration.ErrInvalidMigration(executedMigrations[idx])
-		}
-
-		lastMigration, err = scriptVersion(executedMigrations[idx])
-		if err != nil {
-			return err
-		}
+	lastMigration, err := appliedVersion(executedMigrations, knownMigrations)
+	if err != nil {
+		return err
 	}
 
 	migrationsToDo := len(knownMigrations[lastMigration:])
@@ -105,6 +99,46 @@ func (m *Migrator) Up(ctx context.Context, source embed.FS) error {
 	return nil
 }
 
+// MigrationStatus describes the migration state of the SQL database relative to a set of known migrations.
+type MigrationStatus struct {
+	// Version is the version of the latest migration applied to the database, or 0 if none have been.
+	Version int
+	// LatestVersion is the version of the latest known migration.
+	LatestVersion int
+	// Pending are the names of the known migrations which haven't been applied yet, in the order they'd be run.
+	Pending []string
+}
+
+// Status reports which of the migrations in source have been applied to the SQL database, without applying any.
+func (m *Migrator) Status(ctx context.Context, source embed.FS) (*MigrationStatus, error) {
+	knownMigrations, err := source.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(knownMigrations, func(i, j int) bool {
+		return knownMigrations[i].Name() < knownMigrations[j].Name()
+	})
+
+	executedMigrations, err := m.store.allMigrationNames()
+	if err != nil {
+		return nil, err
+	}
+
+	status := MigrationStatus{}
+	if status.Version, err = appliedVersion(executedMigrations, knownMigrations); err != nil {
+		return nil, err
+	}
+	if len(knownMigrations) > 0 {
+		if status.LatestVersion, err = scriptVersion(knownMigrations[len(knownMigrations)-1].Name()); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range knownMigrations[len(executedMigrations):] {
+		status.Pending = append(status.Pending, dropExtension(f.Name()))
+	}
+	return &status, nil
+}
+
 // Down applies the "down" migrations until the SQL database has migrations only >= untilMigration. Use untilMigration = 0 to apply all
 // down migrations, which will delete all data from the database.
 func (m *Migrator) Down(ctx context.Context, untilMigration int, source embed.FS) error {
@@ -173,6 +207,24 @@ func (m *Migrator) Down(ctx context.Context, untilMigration int, source embed.FS
 	return nil
 }
 
+// appliedVersion checks that the executed migrations are a prefix of the known migrations, returning the
+// version of the last one executed.
+func appliedVersion(executedMigrations []string, knownMigrations []fs.DirEntry) (int, error) {
+	var lastMigration int
+	for idx := range executedMigrations {
+		if idx > len(knownMigrations)-1 || executedMigrations[idx] != dropExtension(knownMigrations[idx].Name()) {
+			return 0, migration.ErrInvalidMigration(executedMigrations[idx])
+		}
+
+		var err error
+		lastMigration, err = scriptVersion(executedMigrations[idx])
+		if err != nil {
+			return 0, err
+		}
+	}
+	return lastMigration, nil
+}
+
 // extract the version number as an integer from a file named like "0002_migration_name.sql"
 func scriptVersion(filename string) (int, error) {
 	vString := strings.Split(filename, "_")[0]
@@ -171,6 +171,45 @@ func TestDown(t *testing.T) {
 	migrateDownAndCheck(t, migrator, store, test_migrations.AllDown, upsOnlyFirst, 2)
 }
 
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	store, clean := NewTestStore(t)
+	defer clean(t)
+	ctx := context.Background()
+
+	migrator := NewMigrator(store, zaptest.NewLogger(t))
+
+	// Nothing has been applied to an empty db.
+	status, err := migrator.Status(ctx, test_migrations.AllUp)
+	require.NoError(t, err)
+	require.Equal(t, &MigrationStatus{
+		Version:       0,
+		LatestVersion: 4,
+		Pending:       []string{"0001_create_migrations_table", "0002_create_test_table_1", "0003_rename_test_table_id_1", "0004_create_test_table_2"},
+	}, status)
+
+	// Migrations known to a newer release are reported as pending.
+	require.NoError(t, migrator.Up(ctx, test_migrations.FirstUp))
+	status, err = migrator.Status(ctx, test_migrations.AllUp)
+	require.NoError(t, err)
+	require.Equal(t, &MigrationStatus{
+		Version:       2,
+		LatestVersion: 4,
+		Pending:       []string{"0003_rename_test_table_id_1", "0004_create_test_table_2"},
+	}, status)
+
+	require.NoError(t, migrator.Up(ctx, test_migrations.AllUp))
+	status, err = migrator.Status(ctx, test_migrations.AllUp)
+	require.NoError(t, err)
+	require.Equal(t, &MigrationStatus{Version: 4, LatestVersion: 4}, status)
+
+	// Unknown migrations are an error, as with Up.
+	require.NoError(t, store.execTrans(ctx, `INSERT INTO migrations (name) VALUES ("0010_some_bad_migration")`))
+	_, err = migrator.Status(ctx, test_migrations.AllUp)
+	require.Equal(t, migration.ErrInvalidMigration("0010_some_bad_migration"), err)
+}
+
 func TestScriptVersion(t *testing.T) {
 	t.Parallel()
 